@@ -0,0 +1,54 @@
+package mkconf
+
+import (
+	"fmt"
+	"time"
+)
+
+// adaptiveIdleFactor relates the interval of adaptive polling to the time since the last change: a configuration
+// that has not changed for ten minutes is checked every minute, within the bounds set with SetAdaptivePolling.
+const adaptiveIdleFactor = 10
+
+// SetAdaptivePolling lets the check interval of the specified configuration follow its activity when it is
+// polled: right after a change it is checked every minInterval, and the longer it stays unchanged, the further the
+// interval backs off, to a tenth of the time since the last change, up to maxInterval. Hosts watching hundreds of
+// mostly idle configurations cut their I/O while recently changed configurations still react quickly. It applies
+// to monitors polling the file, including the watcher pool, and replaces the interval set with SetCheckSec;
+// monitors woken by file notifications (see SetFileNotify) are not affected. A zero maxInterval disables adaptive
+// polling.
+func (cm *ConfigManager) SetAdaptivePolling(configName string, minInterval, maxInterval time.Duration) error {
+	settings, ok := cm.configList.getSettings(configName)
+	if !ok {
+		return fmt.Errorf("config with name %s not found", configName)
+	}
+	if maxInterval != 0 && (minInterval <= 0 || maxInterval < minInterval) {
+		return fmt.Errorf("config %v: invalid adaptive polling bounds %v to %v", configName, minInterval, maxInterval)
+	}
+	settings.mu.Lock()
+	defer settings.mu.Unlock()
+	settings.adaptiveMin, settings.adaptiveMax = minInterval, maxInterval
+	return nil
+}
+
+// pollInterval returns the interval until the next check of a polled configuration: interval, or the adaptive
+// interval if adaptive polling is enabled.
+func (c *ConfigSettings) pollInterval(interval time.Duration) time.Duration {
+	c.mu.Lock()
+	minInterval, maxInterval := c.adaptiveMin, c.adaptiveMax
+	c.mu.Unlock()
+	if maxInterval == 0 {
+		return interval
+	}
+
+	interval = minInterval
+	if applied := c.lastApplied.Load(); applied != 0 {
+		interval = time.Since(time.Unix(0, applied)) / adaptiveIdleFactor
+	}
+	if interval < minInterval {
+		return minInterval
+	}
+	if interval > maxInterval {
+		return maxInterval
+	}
+	return interval
+}
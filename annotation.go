@@ -0,0 +1,254 @@
+package mkconf
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	reader "mkconf/readers"
+)
+
+// Annotation describes who changed a value at runtime, when and why.
+type Annotation struct {
+	Actor  string    // Who made the change, e.g. a user or service name
+	Reason string    // Why the value was changed, if given
+	Time   time.Time // When the value was changed; the current time if zero
+}
+
+// String formats the annotation as written into configuration files.
+func (a Annotation) String() string {
+	actor := a.Actor
+	if actor == "" {
+		actor = "unknown"
+	}
+	note := fmt.Sprintf("set by %v at %v", actor, a.Time.UTC().Format(time.RFC3339))
+	if a.Reason != "" {
+		note += ": " + a.Reason
+	}
+	return note
+}
+
+// Set changes the value at the dot-separated key path (e.g. "db.port") of a configuration and persists it with
+// UpdateConfig. Keys are matched like when decoding: by the format tags or the field names. If annotation is not
+// nil and the file is YAML, TOML or INI, the written entry gets a comment such as
+// "# mkconf: set by alice at 2024-05-01T10:00:00Z: raise pool size", replacing an earlier one, so people editing
+// the file later see that the value was machine-written. INI files are rewritten on update, so they only keep the
+// latest annotation. Set fails on values pinned with Pin and on values the Authorizer denies.
+func (cm *ConfigManager) Set(configName, key string, value interface{}, annotation *Annotation) error {
+	return cm.SetContext(context.Background(), configName, key, value, annotation)
+}
+
+// SetContext is like Set, passing the identity of the caller carried by ctx (see WithIdentity) to the Authorizer.
+func (cm *ConfigManager) SetContext(ctx context.Context, configName, key string, value interface{}, annotation *Annotation) error {
+	if err := cm.authorize(ctx, AccessSet, configName, key); err != nil {
+		return err
+	}
+	configInterface, err := cm.GetConfig(configName)
+	if err != nil {
+		return err
+	}
+	settings, ok := cm.configList.getSettings(configName)
+	if !ok {
+		return fmt.Errorf("config with name %s not found", configName)
+	}
+
+	path := strings.Split(key, ".")
+	edit := func() error {
+		settings.mu.Lock()
+		defer settings.mu.Unlock()
+		if pin, ok := settings.pinFor(key); ok {
+			return fmt.Errorf("set %v in config %v: %v is pinned", key, configName, pin)
+		}
+		if err := setPath(reflect.ValueOf(configInterface), path, value); err != nil {
+			return fmt.Errorf("set %v in config %v: %v", key, configName, err)
+		}
+		return nil
+	}
+
+	var annotate func(settings *ConfigSettings) error
+	if annotation != nil {
+		note := *annotation
+		if note.Time.IsZero() {
+			note.Time = time.Now()
+		}
+		annotate = func(settings *ConfigSettings) error {
+			_, err := reader.AnnotateEntry(settings.source(), settings.configFullPath, settings.configType, path, note.String())
+			return err
+		}
+	}
+	return cm.configList.updateConfig(configName, configInterface, edit, annotate)
+}
+
+// Get returns the value at the dot-separated key path (e.g. "db.port") of a configuration. Keys are matched like
+// in Set; list elements are addressed by index, e.g. "servers.0.host". Get fails on values the Authorizer denies,
+// and with ErrConfigFailed while the file of the configuration is gone under FileFail (see SetFileEventPolicy).
+func (cm *ConfigManager) Get(configName, key string) (interface{}, error) {
+	return cm.GetContext(context.Background(), configName, key)
+}
+
+// GetContext is like Get, passing the identity of the caller carried by ctx (see WithIdentity) to the Authorizer.
+func (cm *ConfigManager) GetContext(ctx context.Context, configName, key string) (interface{}, error) {
+	if err := cm.authorize(ctx, AccessGet, configName, key); err != nil {
+		return nil, err
+	}
+	configInterface, err := cm.GetConfig(configName)
+	if err != nil {
+		return nil, err
+	}
+	settings, ok := cm.configList.getSettings(configName)
+	if !ok {
+		return nil, fmt.Errorf("config with name %s not found", configName)
+	}
+
+	settings.mu.Lock()
+	defer settings.mu.Unlock()
+	if settings.state == ConfigFailed {
+		return nil, fmt.Errorf("get %v in config %v: %w: %v", key, configName, ErrConfigFailed, settings.stateError)
+	}
+	value, err := getPath(reflect.ValueOf(configInterface), strings.Split(key, "."))
+	if err != nil {
+		return nil, fmt.Errorf("get %v in config %v: %v", key, configName, err)
+	}
+	return value.Interface(), nil
+}
+
+// getPath returns the value at path in the struct, map or list v holds.
+func getPath(v reflect.Value, path []string) (reflect.Value, error) {
+	for _, key := range path {
+		for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+			if v.IsNil() {
+				return reflect.Value{}, fmt.Errorf("%v is nil", key)
+			}
+			v = v.Elem()
+		}
+
+		switch v.Kind() {
+		case reflect.Struct:
+			field, ok := fieldByKey(v.Type(), key)
+			if !ok {
+				return reflect.Value{}, fmt.Errorf("unknown key %v", key)
+			}
+			v = v.FieldByIndex(field.Index)
+		case reflect.Map:
+			mapKey, err := mapKeyValue(v.Type(), key)
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			element := v.MapIndex(mapKey)
+			if !element.IsValid() {
+				return reflect.Value{}, fmt.Errorf("unknown key %v", key)
+			}
+			v = element
+		case reflect.Slice, reflect.Array:
+			index, err := strconv.Atoi(key)
+			if err != nil || index < 0 || index >= v.Len() {
+				return reflect.Value{}, fmt.Errorf("invalid index %v of a list of %d", key, v.Len())
+			}
+			v = v.Index(index)
+		default:
+			return reflect.Value{}, fmt.Errorf("cannot get %v in a %v", key, v.Kind())
+		}
+	}
+	return v, nil
+}
+
+// setPath stores value at path in the struct or map v points to, converting it to the type of the target.
+func setPath(v reflect.Value, path []string, value interface{}) error {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return fmt.Errorf("%v is nil", path[0])
+		}
+		v = v.Elem()
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		field, ok := fieldByKey(v.Type(), path[0])
+		if !ok {
+			return fmt.Errorf("unknown key %v", path[0])
+		}
+		target := v.FieldByIndex(field.Index)
+		if len(path) > 1 {
+			return setPath(target.Addr(), path[1:], value)
+		}
+		return assignValue(target, value)
+	case reflect.Map:
+		mapKey, err := mapKeyValue(v.Type(), path[0])
+		if err != nil {
+			return err
+		}
+		if v.IsNil() {
+			return fmt.Errorf("%v is nil", path[0])
+		}
+		if len(path) > 1 {
+			current := v.MapIndex(mapKey)
+			if !current.IsValid() {
+				return fmt.Errorf("unknown key %v", path[0])
+			}
+			// Map elements are not addressable, so nested values are updated on a copy.
+			element := reflect.New(current.Type()).Elem()
+			element.Set(current)
+			if err := setPath(element.Addr(), path[1:], value); err != nil {
+				return err
+			}
+			v.SetMapIndex(mapKey, element)
+			return nil
+		}
+		element := reflect.New(v.Type().Elem()).Elem()
+		if err := assignValue(element, value); err != nil {
+			return err
+		}
+		v.SetMapIndex(mapKey, element)
+		return nil
+	default:
+		return fmt.Errorf("cannot set %v in a %v", path[0], v.Kind())
+	}
+}
+
+// mapKeyValue returns key as a key of the map type t, whose keys are strings or, as decoded from YAML, interfaces.
+func mapKeyValue(t reflect.Type, key string) (reflect.Value, error) {
+	switch t.Key().Kind() {
+	case reflect.String:
+		return reflect.ValueOf(key).Convert(t.Key()), nil
+	case reflect.Interface:
+		return reflect.ValueOf(key), nil
+	}
+	return reflect.Value{}, fmt.Errorf("unsupported map key type %v", t.Key())
+}
+
+// assignValue stores value in target, converting between compatible types or through JSON otherwise.
+// A string stored in a non-string target is parsed as JSON, so "8080" sets an int.
+func assignValue(target reflect.Value, value interface{}) error {
+	if value == nil {
+		target.Set(reflect.Zero(target.Type()))
+		return nil
+	}
+	source := reflect.ValueOf(value)
+	switch {
+	case source.Type().AssignableTo(target.Type()):
+		target.Set(source)
+		return nil
+	case source.Type().ConvertibleTo(target.Type()) && source.Kind() != reflect.String && target.Kind() != reflect.String:
+		target.Set(source.Convert(target.Type()))
+		return nil
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	if text, ok := value.(string); ok && target.Kind() != reflect.String {
+		// Values given as text, e.g. on a command line, are parsed.
+		data = []byte(text)
+	}
+	converted := reflect.New(target.Type())
+	if err := json.Unmarshal(data, converted.Interface()); err != nil {
+		return fmt.Errorf("cannot use %v as %v", value, target.Type())
+	}
+	target.Set(converted.Elem())
+	return nil
+}
@@ -0,0 +1,163 @@
+package mkconf
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	reader "mkconf/readers"
+)
+
+// AnomalyGuard configures the detection of suspicious changes of a configuration, such as a truncated or
+// accidentally emptied file, before change monitoring applies them.
+type AnomalyGuard struct {
+	MaxShrinkPercent float64                     // Percentage the content may shrink by in one change, e.g. 50; unchecked if zero
+	MaxRemovedFields int                         // Number of values that may be removed in one change; unchecked if zero
+	RequireApproval  bool                        // Flag holding suspicious changes until ApproveChange is called; they are applied and only reported otherwise
+	OnAnomaly        func(anomaly ConfigAnomaly) // Function called for every suspicious change; reported as an AnomalyError if nil
+}
+
+// ConfigAnomaly describes a suspicious change of a configuration.
+type ConfigAnomaly struct {
+	ConfigName    string   // Name of the configuration
+	Reasons       []string // Why the change is suspicious, e.g. "content shrank by 80% (1200 to 240 bytes)"
+	OldSize       int      // Size in bytes of the content last applied
+	NewSize       int      // Size in bytes of the changed content
+	RemovedFields []string // Dot-separated paths of the values the change removes, sorted; list elements are indexes
+	Held          bool     // Flag indicating the change waits for approval
+}
+
+// AnomalyError reports a suspicious change to the function set with SetErrorFunc if its guard has no OnAnomaly.
+type AnomalyError struct {
+	Anomaly ConfigAnomaly // The suspicious change
+}
+
+// Error implements error.
+func (e *AnomalyError) Error() string {
+	action := "applied"
+	if e.Anomaly.Held {
+		action = "held for approval"
+	}
+	return fmt.Sprintf("suspicious change of config %v %v: %v", e.Anomaly.ConfigName, action, strings.Join(e.Anomaly.Reasons, "; "))
+}
+
+// SetAnomalyGuard guards the specified configuration against suspicious changes: when change monitoring detects
+// new content that is more than guard.MaxShrinkPercent smaller than the content last applied, or removes more than
+// guard.MaxRemovedFields values at once, the change is reported to guard.OnAnomaly, or as an *AnomalyError to the
+// function set with SetErrorFunc, and, with guard.RequireApproval, held like with SetRequireApproval until
+// ApproveChange is called. Each content is reported once. Status shows the reasons of a held change. Changes loaded
+// explicitly, e.g. with LoadConfig, are not guarded. A zero guard disables the detection.
+func (cm *ConfigManager) SetAnomalyGuard(configName string, guard AnomalyGuard) error {
+	settings, ok := cm.configList.getSettings(configName)
+	if !ok {
+		return fmt.Errorf("config with name %s not found", configName)
+	}
+	settings.mu.Lock()
+	defer settings.mu.Unlock()
+	settings.anomalyGuard, settings.anomalyHash, settings.anomaly = nil, "", nil
+	if guard.MaxShrinkPercent > 0 || guard.MaxRemovedFields > 0 {
+		settings.anomalyGuard = &guard
+	}
+	return nil
+}
+
+// checkAnomaly checks the content read from the file, with the given hash, against the anomaly guard. It returns
+// whether the change must be held, and the anomaly if the content is suspicious and was not reported before.
+// The caller must hold c.mu.
+func (c *ConfigSettings) checkAnomaly(hash string, content []byte) (bool, *ConfigAnomaly) {
+	if c.anomalyGuard == nil {
+		return false, nil
+	}
+	if hash == c.anomalyHash {
+		return c.anomaly != nil && c.anomaly.Held, nil
+	}
+	c.anomalyHash, c.anomaly = hash, nil
+
+	if len(c.lastGoodContent) == 0 {
+		return false, nil
+	}
+	anomaly := ConfigAnomaly{ConfigName: c.configName, OldSize: len(c.lastGoodContent), NewSize: len(content)}
+	shrink := 100 * float64(anomaly.OldSize-anomaly.NewSize) / float64(anomaly.OldSize)
+	if c.anomalyGuard.MaxShrinkPercent > 0 && shrink > c.anomalyGuard.MaxShrinkPercent {
+		anomaly.Reasons = append(anomaly.Reasons, fmt.Sprintf("content shrank by %.0f%% (%d to %d bytes)", shrink, anomaly.OldSize, anomaly.NewSize))
+	}
+	if c.anomalyGuard.MaxRemovedFields > 0 {
+		anomaly.RemovedFields = c.removedFields(c.lastGoodContent, content)
+		if len(anomaly.RemovedFields) > c.anomalyGuard.MaxRemovedFields {
+			anomaly.Reasons = append(anomaly.Reasons, fmt.Sprintf("%d values removed", len(anomaly.RemovedFields)))
+		}
+	}
+	if len(anomaly.Reasons) == 0 {
+		return false, nil
+	}
+	anomaly.Held = c.anomalyGuard.RequireApproval
+	c.anomaly = &anomaly
+	return anomaly.Held, &anomaly
+}
+
+// heldAnomaly returns the reasons of the anomaly of the change waiting for approval, if it was held by the guard.
+// The caller must hold c.mu.
+func (c *ConfigSettings) heldAnomaly() string {
+	if c.anomaly == nil || !c.anomaly.Held || c.pendingHash != c.anomalyHash || c.pendingHash == c.lastConfigHash {
+		return ""
+	}
+	return strings.Join(c.anomaly.Reasons, "; ")
+}
+
+// removedFields returns the paths of the values of oldContent missing in newContent, sorted. It returns nil if
+// the reader cannot decode streams or either content does not decode; content that does not decode is rejected
+// when it is read.
+func (c *ConfigSettings) removedFields(oldContent, newContent []byte) []string {
+	streamReader, ok := c.Reader.(reader.StreamReader)
+	if !ok {
+		return nil
+	}
+	var oldValues, newValues map[string]interface{}
+	if streamReader.ReadConfigFrom(bytes.NewReader(oldContent), &oldValues) != nil ||
+		streamReader.ReadConfigFrom(bytes.NewReader(newContent), &newValues) != nil {
+		return nil
+	}
+
+	oldPaths, newPaths := make(map[string]bool), make(map[string]bool)
+	collectValuePaths(oldValues, "", oldPaths)
+	collectValuePaths(newValues, "", newPaths)
+	var removed []string
+	for path := range oldPaths {
+		if !newPaths[path] {
+			removed = append(removed, path)
+		}
+	}
+	sort.Strings(removed)
+	return removed
+}
+
+// collectValuePaths adds the paths of the scalar values of a decoded value at path to paths.
+func collectValuePaths(value interface{}, path string, paths map[string]bool) {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		for key, element := range value {
+			collectValuePaths(element, joinPath(path, key), paths)
+		}
+	case map[interface{}]interface{}:
+		for key, element := range value {
+			collectValuePaths(element, joinPath(path, fmt.Sprint(key)), paths)
+		}
+	case []interface{}:
+		for i, element := range value {
+			collectValuePaths(element, joinPath(path, strconv.Itoa(i)), paths)
+		}
+	default:
+		paths[path] = true
+	}
+}
+
+// reportAnomaly passes an anomaly to the callback of the guard, or reports it as an AnomalyError.
+func (c *ConfigSettings) reportAnomaly(onAnomaly func(anomaly ConfigAnomaly), anomaly ConfigAnomaly) {
+	if onAnomaly != nil {
+		onAnomaly(anomaly)
+		return
+	}
+	c.reportError(&AnomalyError{Anomaly: anomaly})
+}
@@ -0,0 +1,48 @@
+package mkconf
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAnomalyReportedThroughErrorFunc(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "guarded.json")
+	if err := os.WriteFile(path, []byte(`{"version": 1, "name": "a long enough name to shrink"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var reported []error
+	config := &stressConfig{}
+	cm := NewConfigManager()
+	cm.SetErrorFunc(func(err error) { reported = append(reported, err) })
+	if err := cm.AddConfig("guarded", dir, ".json", config); err != nil {
+		t.Fatalf("AddConfig: %v", err)
+	}
+	if err := cm.LoadConfig("guarded"); err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	if err := cm.SetAnomalyGuard("guarded", AnomalyGuard{MaxShrinkPercent: 50, RequireApproval: true}); err != nil {
+		t.Fatalf("SetAnomalyGuard: %v", err)
+	}
+	if err := os.WriteFile(path, []byte(`{}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := cm.CheckOnce("guarded"); err != nil {
+			t.Fatalf("CheckOnce: %v", err)
+		}
+	}
+
+	var anomaly *AnomalyError
+	if len(reported) != 1 || !errors.As(reported[0], &anomaly) {
+		t.Fatalf("reported %v, want one *AnomalyError", reported)
+	}
+	if anomaly.Anomaly.ConfigName != "guarded" || !anomaly.Anomaly.Held || len(anomaly.Anomaly.Reasons) == 0 {
+		t.Fatalf("anomaly %+v, want a held change of config guarded with reasons", anomaly.Anomaly)
+	}
+	if config.Version != 1 {
+		t.Fatalf("version %v, want the held change not to be applied", config.Version)
+	}
+}
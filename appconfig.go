@@ -0,0 +1,282 @@
+package mkconf
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AppConfigSource is a configuration profile deployed with AWS AppConfig. It keeps a configuration session
+// with the AppConfig data plane and polls it at the interval the service asks for, so new deployment versions
+// are rolled out according to AppConfig's deployment strategies. New versions are applied through the normal
+// validation and change callbacks.
+type AppConfigSource struct {
+	application  string             // Application identifier
+	environment  string             // Environment identifier
+	profile      string             // Configuration profile identifier
+	configName   string             // Name of the registered configuration
+	options      AWSOptions         // Source options
+	manager      *ConfigManager     // Manager the configuration is registered with
+	content      []byte             // Last received configuration
+	loaded       bool               // Flag indicating content holds a value
+	contentType  string             // Content type of the last received configuration
+	versionLabel string             // Version label of the last received configuration, if any
+	token        string             // Token of the next poll; empty if a new session must be started
+	pollInterval time.Duration      // Interval the service asked to poll at
+	mu           sync.Mutex         // Mutex for synchronizing access to the content and the session
+	cancel       context.CancelFunc // Function canceling the running polling
+	waitGroup    sync.WaitGroup     // WaitGroup to wait for the polling goroutine
+}
+
+// AddAppConfig registers a configuration deployed with AWS AppConfig, identified by its application, environment
+// and configuration profile (names or IDs). The current deployment is fetched immediately; an empty configType
+// is derived from its content type (JSON, YAML or TOML). options.Interval is the minimum poll interval requested
+// from AppConfig (at least 15 seconds). The configuration is read-only. Call StartWatching on the returned source
+// to apply new deployments.
+func (cm *ConfigManager) AddAppConfig(configName, application, environment, profile, configType string, configInterface interface{}, options AWSOptions) (*AppConfigSource, error) {
+	options, err := awsDefaults(options)
+	if err != nil {
+		return nil, fmt.Errorf("appconfig %v: %v", configName, err)
+	}
+	if options.Interval <= 0 {
+		options.Interval = 30 * time.Second
+	}
+	if options.Interval < 15*time.Second {
+		options.Interval = 15 * time.Second
+	}
+
+	s := &AppConfigSource{application: application, environment: environment, profile: profile, configName: configName, options: options, manager: cm, pollInterval: options.Interval}
+	if _, err := s.poll(context.Background()); err != nil {
+		return nil, err
+	}
+	if configType == "" {
+		if configType = appConfigType(s.contentType); configType == "" {
+			return nil, fmt.Errorf("appconfig %v: unsupported content type %q, set the config type", configName, s.contentType)
+		}
+	}
+
+	if err := cm.AddConfigFS(s, configName, "", configType, configInterface); err != nil {
+		return nil, err
+	}
+	cm.addRemoteSource(configName, s)
+	return s, nil
+}
+
+// VersionLabel returns the version label of the deployed configuration, if the profile sets one.
+func (s *AppConfigSource) VersionLabel() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.versionLabel
+}
+
+// Open implements fs.FS. Every name resolves to the last received configuration.
+func (s *AppConfigSource) Open(name string) (fs.File, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.loaded {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return newRemoteFile(name, s.content), nil
+}
+
+// Refresh polls AppConfig and loads the configuration if a new version was deployed.
+// It is not needed while the source is watched.
+func (s *AppConfigSource) Refresh() error {
+	changed, err := s.poll(context.Background())
+	if err != nil || !changed {
+		return err
+	}
+	return s.manager.LoadConfig(s.configName)
+}
+
+// StartWatching polls AppConfig at the interval it asks for and applies new deployment versions.
+// Errors are reported through errorFunc if it is set.
+func (s *AppConfigSource) StartWatching(errorFunc func(err error)) error {
+	s.StopWatching()
+	errorFunc = quietCircuitErrors(errorFunc)
+	if err := s.manager.setRemoteWatching(s.configName, true); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.mu.Lock()
+	s.cancel = cancel
+	s.mu.Unlock()
+
+	s.waitGroup.Add(1)
+	s.manager.configList.resources.acquire(s.configName, resourceRemoteWatch)
+	go func() {
+		defer s.waitGroup.Done()
+		defer s.manager.configList.resources.release(s.configName, resourceRemoteWatch)
+		for {
+			s.mu.Lock()
+			timer := time.NewTimer(s.pollInterval)
+			s.mu.Unlock()
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+
+			changed, err := s.poll(ctx)
+			if err == nil && changed {
+				err = s.manager.applyRemoteChange(s.configName)
+			}
+			if err != nil && ctx.Err() == nil && errorFunc != nil {
+				errorFunc(err)
+			}
+		}
+	}()
+	return nil
+}
+
+// StopWatching stops polling AppConfig and waits for the polling to finish.
+func (s *AppConfigSource) StopWatching() {
+	s.mu.Lock()
+	cancel := s.cancel
+	s.cancel = nil
+	s.mu.Unlock()
+
+	if cancel == nil {
+		return
+	}
+	cancel()
+	s.waitGroup.Wait()
+	s.manager.setRemoteWatching(s.configName, false)
+}
+
+// poll calls pollOnce according to the retry policy and circuit breaker of the configuration.
+func (s *AppConfigSource) poll(ctx context.Context) (bool, error) {
+	var changed bool
+	err := s.manager.retryFetch(ctx, s.configName, func() error {
+		var err error
+		changed, err = s.pollOnce(ctx)
+		return err
+	})
+	return changed, err
+}
+
+// pollOnce fetches the latest configuration of the session, starting a new session if there is none,
+// and reports whether a new version was received.
+func (s *AppConfigSource) pollOnce(ctx context.Context) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.token == "" {
+		token, err := s.startSession(ctx)
+		if err != nil {
+			return false, fmt.Errorf("appconfig %v: start session: %v", s.configName, err)
+		}
+		s.token = token
+	}
+
+	req, err := s.newRequest(ctx, http.MethodGet, "/configuration?configuration_token="+url.QueryEscape(s.token), nil)
+	if err != nil {
+		return false, err
+	}
+	resp, err := doBlobRequest(s.options.HTTPClient, req)
+	if err != nil {
+		// Tokens expire after 24 hours; the next poll starts a new session.
+		s.token = ""
+		return false, fmt.Errorf("appconfig %v: %v", s.configName, err)
+	}
+	content, err := readBlobResponse(resp)
+	if err != nil {
+		s.token = ""
+		return false, fmt.Errorf("appconfig %v: %v", s.configName, err)
+	}
+
+	s.token = resp.Header.Get("Next-Poll-Configuration-Token")
+	if seconds, err := strconv.Atoi(resp.Header.Get("Next-Poll-Interval-In-Seconds")); err == nil && seconds > 0 {
+		s.pollInterval = time.Duration(seconds) * time.Second
+	}
+	// An empty body means the deployed version did not change since the last poll.
+	if len(content) == 0 && s.loaded {
+		s.manager.sourceReached(s.configName)
+		return false, nil
+	}
+
+	changed := !s.loaded || !bytes.Equal(s.content, content)
+	s.content, s.loaded = content, true
+	s.contentType = resp.Header.Get("Content-Type")
+	s.versionLabel = resp.Header.Get("Version-Label")
+	s.manager.sourceReached(s.configName)
+	return changed, nil
+}
+
+// startSession starts a configuration session and returns its initial token. The caller must hold s.mu.
+func (s *AppConfigSource) startSession(ctx context.Context) (string, error) {
+	payload, err := json.Marshal(map[string]interface{}{
+		"ApplicationIdentifier":                s.application,
+		"EnvironmentIdentifier":                s.environment,
+		"ConfigurationProfileIdentifier":       s.profile,
+		"RequiredMinimumPollIntervalInSeconds": int(s.options.Interval / time.Second),
+	})
+	if err != nil {
+		return "", err
+	}
+	req, err := s.newRequest(ctx, http.MethodPost, "/configurationsessions", payload)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := doBlobRequest(s.options.HTTPClient, req)
+	if err != nil {
+		return "", err
+	}
+	content, err := readBlobResponse(resp)
+	if err != nil {
+		return "", err
+	}
+
+	var output struct {
+		InitialConfigurationToken string
+	}
+	if err := json.Unmarshal(content, &output); err != nil {
+		return "", err
+	}
+	if output.InitialConfigurationToken == "" {
+		return "", fmt.Errorf("no configuration token in response")
+	}
+	return output.InitialConfigurationToken, nil
+}
+
+// newRequest creates a signed request to the AppConfig data plane.
+func (s *AppConfigSource) newRequest(ctx context.Context, method, path string, payload []byte) (*http.Request, error) {
+	endpoint := s.options.Endpoint
+	if endpoint == "" {
+		endpoint = "https://appconfigdata." + s.options.Region + ".amazonaws.com"
+	}
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(endpoint, "/")+path, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	signAWSRequest(req, payload, s.options.AccessKeyID, s.options.SecretAccessKey, s.options.SessionToken, s.options.Region, "appconfig", time.Now())
+	return req, nil
+}
+
+// appConfigType returns the config type of an AppConfig content type, or "" if it is not supported.
+func appConfigType(contentType string) string {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch mediaType {
+	case "application/json":
+		return ".json"
+	case "application/x-yaml", "application/yaml", "text/yaml":
+		return ".yaml"
+	case "application/toml":
+		return ".toml"
+	default:
+		return ""
+	}
+}
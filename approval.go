@@ -0,0 +1,70 @@
+package mkconf
+
+import (
+	"fmt"
+)
+
+// SetRequireApproval enables or disables change approval for the specified configuration.
+// With approval required, monitoring detects changes of the file but holds them until ApproveChange is called.
+func (cm *ConfigManager) SetRequireApproval(configName string, require bool) error {
+	settings, ok := cm.configList.getSettings(configName)
+	if !ok {
+		return fmt.Errorf("config with name %s not found", configName)
+	}
+	settings.mu.Lock()
+	defer settings.mu.Unlock()
+	settings.requireApproval = require
+	return nil
+}
+
+// ApproveChange applies the change of the specified configuration that is waiting for approval.
+// The approval covers the file content the change was detected for; a file changed again needs a new approval.
+func (cm *ConfigManager) ApproveChange(configName string) error {
+	configInterface, err := cm.GetConfig(configName)
+	if err != nil {
+		return err
+	}
+	settings, _ := cm.configList.getSettings(configName)
+
+	settings.mu.Lock()
+	pending := settings.pendingHash
+	monitoring := settings.enableChangeValidation
+	if pending == "" || pending == settings.lastConfigHash {
+		settings.mu.Unlock()
+		return fmt.Errorf("config %v: no change is waiting for approval", configName)
+	}
+	settings.approvedHash = pending
+	settings.mu.Unlock()
+
+	if monitoring {
+		return cm.configList.checkConfigChanges(configName, configInterface)
+	}
+	if err := cm.LoadConfig(configName); err != nil {
+		return err
+	}
+	settings.mu.Lock()
+	settings.lastConfigHash = pending
+	settings.mu.Unlock()
+	return nil
+}
+
+// Diff returns a line diff between the last applied content of the specified configuration and its current file,
+// preceded by the impacts of the changed values registered with SetImpact, one line each, prefixed with "!".
+func (cm *ConfigManager) Diff(configName string) (string, error) {
+	settings, ok := cm.configList.getSettings(configName)
+	if !ok {
+		return "", fmt.Errorf("config with name %s not found", configName)
+	}
+
+	settings.mu.Lock()
+	applied := settings.lastGoodContent
+	path, source := settings.configFullPath, settings.source()
+	settings.mu.Unlock()
+
+	current, err := source.ReadSourceFile(path)
+	if err != nil {
+		return "", fmt.Errorf("config %v: %v", configName, err)
+	}
+	notes := impactNotes(cm.configList.previewImpacts(configName, path, applied, current))
+	return notes + lineDiff(string(applied), string(current)), nil
+}
@@ -0,0 +1,77 @@
+package mkconf
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrAccessDenied can be returned by an Authorizer to deny access; GetContext and SetContext wrap it.
+var ErrAccessDenied = errors.New("config access denied")
+
+// AccessOp is the kind of access to a configuration value.
+type AccessOp string
+
+const (
+	AccessGet AccessOp = "get" // The value is read with Get or GetContext
+	AccessSet AccessOp = "set" // The value is changed with Set or SetContext
+)
+
+// AccessRequest describes an access to a configuration value to be authorized.
+type AccessRequest struct {
+	ConfigName string      // Name of the configuration
+	Key        string      // Dot-separated key path of the value, e.g. "tenants.acme.quota"
+	Op         AccessOp    // Kind of access
+	Identity   interface{} // Identity of the caller set with WithIdentity, or nil if none was set
+}
+
+// Authorizer decides whether an access is allowed, returning an error to deny it, e.g. ErrAccessDenied.
+type Authorizer func(ctx context.Context, request AccessRequest) error
+
+// identityKey is the context key of the caller identity.
+type identityKey struct{}
+
+// WithIdentity returns a copy of ctx carrying the identity of the caller, e.g. the name of a plugin, for the
+// Authorizer set with SetAuthorizer.
+func WithIdentity(ctx context.Context, identity interface{}) context.Context {
+	return context.WithValue(ctx, identityKey{}, identity)
+}
+
+// IdentityFrom returns the identity of the caller carried by ctx, if set with WithIdentity.
+func IdentityFrom(ctx context.Context) (interface{}, bool) {
+	identity := ctx.Value(identityKey{})
+	return identity, identity != nil
+}
+
+// SetAuthorizer sets a function authorizing every Get and Set call, so plugins embedded in one process can be
+// restricted to their own configurations or key namespaces, e.g.
+//
+//	cm.SetAuthorizer(func(ctx context.Context, r mkconf.AccessRequest) error {
+//		if tenant, _ := r.Identity.(string); strings.HasPrefix(r.Key, "tenants."+tenant+".") {
+//			return nil
+//		}
+//		return mkconf.ErrAccessDenied
+//	})
+//
+// Callers pass their identity with GetContext and SetContext and a context made by WithIdentity; Get and Set
+// are authorized without identity. A nil authorizer allows every access.
+func (cm *ConfigManager) SetAuthorizer(authorizer Authorizer) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	cm.authorizer = authorizer
+}
+
+// authorize checks an access with the authorizer, if set.
+func (cm *ConfigManager) authorize(ctx context.Context, op AccessOp, configName, key string) error {
+	cm.mu.RLock()
+	authorizer := cm.authorizer
+	cm.mu.RUnlock()
+	if authorizer == nil {
+		return nil
+	}
+	identity, _ := IdentityFrom(ctx)
+	if err := authorizer(ctx, AccessRequest{ConfigName: configName, Key: key, Op: op, Identity: identity}); err != nil {
+		return fmt.Errorf("%v %v in config %v: %w", op, key, configName, err)
+	}
+	return nil
+}
@@ -0,0 +1,508 @@
+package mkconf
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// azureKeyVaultReference is the content type of App Configuration values referring to a Key Vault secret.
+const azureKeyVaultReference = "application/vnd.microsoft.appconfig.keyvaultref+json"
+
+// AzureAppConfigOptions configures an Azure App Configuration source.
+type AzureAppConfigOptions struct {
+	ConnectionString  string                                    // "Endpoint=...;Id=...;Secret=..." access key; AZURE_APPCONFIG_CONNECTION_STRING if empty and no token is set
+	Endpoint          string                                    // Endpoint of the store, e.g. "https://myapp.azconfig.io"; taken from the connection string if empty
+	Token             string                                    // Static Azure AD access token for the store, used instead of an access key
+	TokenFunc         func(ctx context.Context) (string, error) // Function returning a current Azure AD token for the store; takes precedence over Token
+	KeyVaultTokenFunc func(ctx context.Context) (string, error) // Function returning an Azure AD token for Key Vault; required to resolve Key Vault references
+	Separator         string                                    // Separator of nested keys; ":" if empty
+	Labels            []string                                  // Further labels whose key-values override those of the label, in order, e.g. an environment
+	SentinelKey       string                                    // Key (with the label) whose change triggers a reload of all key-values; only it is polled if set
+	Interval          time.Duration                             // Polling interval while the source is watched; 30 seconds if zero
+	HTTPClient        *http.Client                              // Client used for requests; http.DefaultClient if nil
+	Source            SourceOptions                             // TLS, proxy and token provider settings; TokenFunc takes precedence over the token provider
+}
+
+// azureKeyValue is a key-value as returned by App Configuration.
+type azureKeyValue struct {
+	Key         string  `json:"key"`
+	Label       *string `json:"label"`
+	Value       string  `json:"value"`
+	ContentType string  `json:"content_type"`
+}
+
+// AzureAppConfigSource is a configuration assembled from the key-values of an Azure App Configuration store
+// matching a key filter and a label. Keys are split at the separator into nested fields, values with a JSON
+// content type are decoded, and Key Vault references are resolved to the secret values. The store is polled
+// with the ETag of the key-values, or of a sentinel key if one is set, so unchanged configurations are not
+// downloaded again. Changes can also be pushed with Notify or an Event Grid subscription (EventGridHandler).
+type AzureAppConfigSource struct {
+	keyFilter  string                // Key filter, e.g. "myapp:*"
+	label      string                // Label filter; "" selects key-values without a label
+	configName string                // Name of the registered configuration
+	options    AzureAppConfigOptions // Source options
+	keyID      string                // Id of the access key, if access keys are used
+	keySecret  []byte                // Secret of the access key, if access keys are used
+	manager    *ConfigManager        // Manager the configuration is registered with
+	content    []byte                // Last assembled configuration
+	loaded     bool                  // Flag indicating content holds a value
+	etag       string                // ETag of the last downloaded key-values
+	sentinel   string                // ETag of the sentinel key when the key-values were downloaded
+	notify     chan struct{}         // Channel waking the polling up for an immediate check
+	mu         sync.Mutex            // Mutex for synchronizing access to the content
+	cancel     context.CancelFunc    // Function canceling the running polling
+	waitGroup  sync.WaitGroup        // WaitGroup to wait for the polling goroutine
+	secretRedaction
+}
+
+// AddAzureAppConfig registers a configuration assembled from the key-values of an Azure App Configuration store
+// matching keyFilter (e.g. "myapp:*") and label. The part of the keys matched by the filter prefix is removed, so
+// "myapp:db:host" becomes db.host. The configuration is read-only. Call StartWatching on the returned source to
+// reload it when a key-value changes. Key-values of options.Labels override those of label, so a label per
+// environment can refine shared defaults.
+func (cm *ConfigManager) AddAzureAppConfig(configName, keyFilter, label string, configInterface interface{}, options AzureAppConfigOptions) (*AzureAppConfigSource, error) {
+	s := &AzureAppConfigSource{keyFilter: keyFilter, label: label, configName: configName, manager: cm, notify: make(chan struct{}, 1)}
+	if options.TokenFunc == nil {
+		options.TokenFunc = options.Source.TokenFunc
+	}
+	if options.ConnectionString == "" && options.Token == "" && options.TokenFunc == nil {
+		options.ConnectionString = os.Getenv("AZURE_APPCONFIG_CONNECTION_STRING")
+	}
+	if options.ConnectionString != "" {
+		for _, part := range strings.Split(options.ConnectionString, ";") {
+			name, value := part, ""
+			if i := strings.Index(part, "="); i >= 0 {
+				name, value = part[:i], part[i+1:]
+			}
+			switch name {
+			case "Endpoint":
+				if options.Endpoint == "" {
+					options.Endpoint = value
+				}
+			case "Id":
+				s.keyID = value
+			case "Secret":
+				secret, err := base64.StdEncoding.DecodeString(value)
+				if err != nil {
+					return nil, fmt.Errorf("azure app config %v: invalid access key secret: %v", configName, err)
+				}
+				s.keySecret = secret
+			}
+		}
+	}
+	if options.Endpoint == "" {
+		return nil, fmt.Errorf("azure app config %v: endpoint is not set", configName)
+	}
+	if options.Separator == "" {
+		options.Separator = ":"
+	}
+	if options.Interval <= 0 {
+		options.Interval = 30 * time.Second
+	}
+	client, err := options.Source.httpClient(options.HTTPClient)
+	if err != nil {
+		return nil, fmt.Errorf("azure app config %v: %v", configName, err)
+	}
+	options.HTTPClient = client
+	s.options = options
+
+	if err := cm.AddConfigFS(s, configName, "", ".json", configInterface); err != nil {
+		return nil, err
+	}
+	cm.addRemoteSource(configName, s)
+	return s, nil
+}
+
+// Open implements fs.FS. Every name resolves to the assembled configuration; it is downloaded if it was not yet.
+func (s *AzureAppConfigSource) Open(name string) (fs.File, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.loaded {
+		if _, err := s.fetchLocked(context.Background()); err != nil {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+		}
+	}
+	return newRemoteFile(name, s.content), nil
+}
+
+// Refresh downloads the key-values, resolves the Key Vault references again and loads the configuration.
+// It is not needed while the source is watched, except to pick up rotated Key Vault secrets.
+func (s *AzureAppConfigSource) Refresh() error {
+	s.mu.Lock()
+	s.etag, s.sentinel = "", ""
+	_, err := s.fetchLocked(context.Background())
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return s.manager.LoadConfig(s.configName)
+}
+
+// StartWatching polls the store every interval and applies changed key-values.
+// Errors are reported through errorFunc if it is set.
+func (s *AzureAppConfigSource) StartWatching(errorFunc func(err error)) error {
+	s.StopWatching()
+	errorFunc = quietCircuitErrors(errorFunc)
+	if err := s.manager.setRemoteWatching(s.configName, true); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.mu.Lock()
+	s.cancel = cancel
+	s.mu.Unlock()
+
+	s.waitGroup.Add(1)
+	s.manager.configList.resources.acquire(s.configName, resourceRemoteWatch)
+	go func() {
+		defer s.waitGroup.Done()
+		defer s.manager.configList.resources.release(s.configName, resourceRemoteWatch)
+		ticker := time.NewTicker(s.options.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			case <-s.notify:
+			}
+
+			s.mu.Lock()
+			changed, err := s.fetchLocked(ctx)
+			s.mu.Unlock()
+			if err == nil && changed {
+				err = s.manager.applyRemoteChange(s.configName)
+			}
+			if err != nil && ctx.Err() == nil && errorFunc != nil {
+				errorFunc(err)
+			}
+		}
+	}()
+	return nil
+}
+
+// Notify makes the watching source check the store immediately instead of waiting for the next poll,
+// e.g. when a change notification was received.
+func (s *AzureAppConfigSource) Notify() {
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+}
+
+// EventGridHandler returns an HTTP handler for an Event Grid subscription to the store's events. It answers the
+// subscription validation handshake and calls Notify when a key-value matching the source (or the sentinel key)
+// is modified or deleted, so changes are pushed instead of waiting for the next poll.
+func (s *AzureAppConfigSource) EventGridHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var events []struct {
+			EventType string `json:"eventType"`
+			Data      struct {
+				Key            string `json:"key"`
+				ValidationCode string `json:"validationCode"`
+			} `json:"data"`
+		}
+		if err := json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&events); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		for _, event := range events {
+			switch event.EventType {
+			case "Microsoft.EventGrid.SubscriptionValidationEvent":
+				w.Header().Set("Content-Type", "application/json")
+				json.NewEncoder(w).Encode(map[string]string{"validationResponse": event.Data.ValidationCode})
+				return
+			case "Microsoft.AppConfiguration.KeyValueModified", "Microsoft.AppConfiguration.KeyValueDeleted":
+				if s.matchesKey(event.Data.Key) {
+					s.Notify()
+				}
+			}
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+}
+
+// matchesKey reports whether a change of key affects the configuration.
+func (s *AzureAppConfigSource) matchesKey(key string) bool {
+	if s.options.SentinelKey != "" {
+		return key == s.options.SentinelKey
+	}
+	if strings.HasSuffix(s.keyFilter, "*") {
+		return strings.HasPrefix(key, strings.TrimSuffix(s.keyFilter, "*"))
+	}
+	return key == s.keyFilter
+}
+
+// StopWatching stops polling the store and waits for the polling to finish.
+func (s *AzureAppConfigSource) StopWatching() {
+	s.mu.Lock()
+	cancel := s.cancel
+	s.cancel = nil
+	s.mu.Unlock()
+
+	if cancel == nil {
+		return
+	}
+	cancel()
+	s.waitGroup.Wait()
+	s.manager.setRemoteWatching(s.configName, false)
+}
+
+// fetchLocked calls fetchOnceLocked according to the retry policy and circuit breaker of the configuration.
+// The caller must hold s.mu.
+func (s *AzureAppConfigSource) fetchLocked(ctx context.Context) (bool, error) {
+	var changed bool
+	err := s.manager.retryFetch(ctx, s.configName, func() error {
+		var err error
+		changed, err = s.fetchOnceLocked(ctx)
+		return err
+	})
+	return changed, err
+}
+
+// fetchOnceLocked downloads the key-values unless their ETag (or that of the sentinel key) is unchanged, assembles
+// the configuration and reports whether it changed. The caller must hold s.mu.
+func (s *AzureAppConfigSource) fetchOnceLocked(ctx context.Context) (bool, error) {
+	sentinel := ""
+	if s.options.SentinelKey != "" {
+		etag, err := s.sentinelETag(ctx)
+		if err != nil {
+			return false, fmt.Errorf("azure app config %v: sentinel %v: %v", s.configName, s.options.SentinelKey, err)
+		}
+		if s.loaded && etag == s.sentinel {
+			s.manager.sourceReached(s.configName)
+			return false, nil
+		}
+		sentinel = etag
+	}
+
+	labels := append([]string{s.label}, s.options.Labels...)
+	filters := make([]string, len(labels))
+	for i, label := range labels {
+		if filters[i] = label; label == "" {
+			filters[i] = "\x00"
+		}
+	}
+	query := url.Values{"key": {s.keyFilter}, "label": {strings.Join(filters, ",")}, "api-version": {"1.0"}}
+	next := "/kv?" + query.Encode()
+
+	var keyValues []azureKeyValue
+	etag := ""
+	for next != "" {
+		conditional := ""
+		if etag == "" && s.loaded && s.options.SentinelKey == "" {
+			conditional = s.etag
+		}
+		resp, err := s.do(ctx, next, conditional)
+		if err != nil {
+			return false, fmt.Errorf("azure app config %v: %v", s.configName, err)
+		}
+		if resp.StatusCode == http.StatusNotModified {
+			resp.Body.Close()
+			s.manager.sourceReached(s.configName)
+			return false, nil
+		}
+		var page struct {
+			Items    []azureKeyValue `json:"items"`
+			NextLink string          `json:"@nextLink"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			return false, fmt.Errorf("azure app config %v: %v", s.configName, err)
+		}
+		if etag == "" {
+			etag = resp.Header.Get("ETag")
+		}
+		keyValues = append(keyValues, page.Items...)
+		next = page.NextLink
+	}
+
+	// Key-values of later labels override those of earlier ones.
+	precedence := func(keyValue azureKeyValue) int {
+		label := ""
+		if keyValue.Label != nil {
+			label = *keyValue.Label
+		}
+		for i := len(labels) - 1; i >= 0; i-- {
+			if labels[i] == label {
+				return i
+			}
+		}
+		return 0
+	}
+	sort.SliceStable(keyValues, func(i, j int) bool { return precedence(keyValues[i]) < precedence(keyValues[j]) })
+
+	content, err := s.assemble(ctx, keyValues)
+	if err != nil {
+		return false, fmt.Errorf("azure app config %v: %v", s.configName, err)
+	}
+	changed := !s.loaded || !bytes.Equal(s.content, content)
+	s.content, s.loaded, s.etag, s.sentinel = content, true, etag, sentinel
+	s.manager.sourceReached(s.configName)
+	return changed, nil
+}
+
+// sentinelETag returns the ETag of the sentinel key, or "" if it does not exist.
+func (s *AzureAppConfigSource) sentinelETag(ctx context.Context) (string, error) {
+	label := s.label
+	if label == "" {
+		label = "\x00"
+	}
+	query := url.Values{"label": {label}, "api-version": {"1.0"}}
+	resp, err := s.do(ctx, "/kv/"+url.PathEscape(s.options.SentinelKey)+"?"+query.Encode(), s.sentinel)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusNotModified:
+		return s.sentinel, nil
+	case http.StatusNotFound:
+		return "", nil
+	}
+	return resp.Header.Get("ETag"), nil
+}
+
+// assemble builds the JSON configuration from the key-values, resolving Key Vault references.
+func (s *AzureAppConfigSource) assemble(ctx context.Context, keyValues []azureKeyValue) ([]byte, error) {
+	prefix := strings.TrimSuffix(s.keyFilter, "*")
+	tree := make(map[string]interface{})
+	secrets := make(map[string]interface{})
+	for _, keyValue := range keyValues {
+		var value interface{} = keyValue.Value
+		contentType := strings.ToLower(keyValue.ContentType)
+		switch {
+		case strings.HasPrefix(contentType, azureKeyVaultReference):
+			secret, err := s.resolveKeyVault(ctx, keyValue)
+			if err != nil {
+				return nil, err
+			}
+			value = secret
+		case strings.HasPrefix(contentType, "application/json") || strings.Contains(contentType, "+json"):
+			if err := json.Unmarshal([]byte(keyValue.Value), &value); err != nil {
+				return nil, fmt.Errorf("key %v: %v", keyValue.Key, err)
+			}
+		}
+
+		path := strings.Split(strings.TrimPrefix(keyValue.Key, prefix), s.options.Separator)
+		if err := setParameter(tree, path, value); err != nil {
+			return nil, fmt.Errorf("key %v: %v", keyValue.Key, err)
+		}
+		if strings.HasPrefix(contentType, azureKeyVaultReference) {
+			setParameter(secrets, path, value)
+		}
+	}
+	if len(secrets) > 0 {
+		s.recordSecrets(secrets)
+	}
+	return json.Marshal(tree)
+}
+
+// resolveKeyVault reads the Key Vault secret a key-value refers to.
+func (s *AzureAppConfigSource) resolveKeyVault(ctx context.Context, keyValue azureKeyValue) (string, error) {
+	var reference struct {
+		URI string `json:"uri"`
+	}
+	if err := json.Unmarshal([]byte(keyValue.Value), &reference); err != nil || reference.URI == "" {
+		return "", fmt.Errorf("key %v: invalid Key Vault reference", keyValue.Key)
+	}
+	if s.options.KeyVaultTokenFunc == nil {
+		return "", fmt.Errorf("key %v: Key Vault reference without KeyVaultTokenFunc", keyValue.Key)
+	}
+	token, err := s.options.KeyVaultTokenFunc(ctx)
+	if err != nil {
+		return "", fmt.Errorf("key %v: Key Vault token: %v", keyValue.Key, err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, reference.URI+"?api-version=7.4", nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := doBlobRequest(s.options.HTTPClient, req)
+	if err != nil {
+		return "", fmt.Errorf("key %v: Key Vault: %v", keyValue.Key, err)
+	}
+	content, err := readBlobResponse(resp)
+	if err != nil {
+		return "", fmt.Errorf("key %v: Key Vault: %v", keyValue.Key, err)
+	}
+	var secret struct {
+		Value string `json:"value"`
+	}
+	if err := json.Unmarshal(content, &secret); err != nil {
+		return "", fmt.Errorf("key %v: Key Vault: %v", keyValue.Key, err)
+	}
+	return secret.Value, nil
+}
+
+// do sends an authenticated GET request for pathAndQuery (or an absolute next link) to the store.
+// If ifNoneMatch is set, the request is conditional and may return 304 Not Modified; 404 Not Found is
+// returned as a response too. The caller must close the body of the response.
+func (s *AzureAppConfigSource) do(ctx context.Context, pathAndQuery, ifNoneMatch string) (*http.Response, error) {
+	target := pathAndQuery
+	if !strings.HasPrefix(target, "http://") && !strings.HasPrefix(target, "https://") {
+		target = strings.TrimSuffix(s.options.Endpoint, "/") + pathAndQuery
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	if ifNoneMatch != "" {
+		req.Header.Set("If-None-Match", ifNoneMatch)
+	}
+
+	switch {
+	case s.options.TokenFunc != nil || s.options.Token != "":
+		token := s.options.Token
+		if s.options.TokenFunc != nil {
+			if token, err = s.options.TokenFunc(ctx); err != nil {
+				return nil, fmt.Errorf("token: %v", err)
+			}
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	case s.keyID != "":
+		signAzureAppConfigRequest(req, s.keyID, s.keySecret, time.Now())
+	}
+
+	resp, err := s.options.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotModified && resp.StatusCode != http.StatusNotFound {
+		message, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		resp.Body.Close()
+		return nil, fmt.Errorf("unexpected status %v: %s", resp.Status, bytes.TrimSpace(message))
+	}
+	return resp, nil
+}
+
+// signAzureAppConfigRequest signs a request without a body with an App Configuration access key (HMAC-SHA256).
+func signAzureAppConfigRequest(req *http.Request, id string, secret []byte, now time.Time) {
+	date := now.UTC().Format(http.TimeFormat)
+	contentHash := sha256.Sum256(nil)
+	encodedHash := base64.StdEncoding.EncodeToString(contentHash[:])
+	req.Header.Set("x-ms-date", date)
+	req.Header.Set("x-ms-content-sha256", encodedHash)
+
+	stringToSign := req.Method + "\n" + req.URL.RequestURI() + "\n" + date + ";" + req.URL.Host + ";" + encodedHash
+	signature := base64.StdEncoding.EncodeToString(hmacSHA256(secret, stringToSign))
+	req.Header.Set("Authorization", "HMAC-SHA256 Credential="+id+"&SignedHeaders=x-ms-date;host;x-ms-content-sha256&Signature="+signature)
+}
@@ -0,0 +1,214 @@
+package mkconf
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// BlobStore is an object storage configurations are published to, e.g. an S3 bucket.
+// Implementations are provided for S3 (NewS3Store), GCS (NewGCSStore) and Azure Blob Storage (NewAzureBlobStore).
+type BlobStore interface {
+	// Version returns the current version of the object (a version ID, generation or ETag) without downloading it.
+	Version(ctx context.Context, key string) (string, error)
+	// Fetch downloads the object and returns its content and version.
+	Fetch(ctx context.Context, key string) ([]byte, string, error)
+}
+
+// BlobConfigSource is a configuration stored as an object in a BlobStore. The object is parsed with the
+// reader of its config type. While the source is watched, the object version is polled and the object is
+// downloaded and applied through the normal change callbacks only when the version changes.
+type BlobConfigSource struct {
+	store      BlobStore          // Object storage holding the configuration
+	key        string             // Key of the object
+	configName string             // Name of the registered configuration
+	interval   time.Duration      // Polling interval
+	manager    *ConfigManager     // Manager the configuration is registered with
+	content    []byte             // Last downloaded content
+	loaded     bool               // Flag indicating content holds a value
+	version    string             // Version of the last downloaded content
+	mu         sync.Mutex         // Mutex for synchronizing access to the content
+	cancel     context.CancelFunc // Function canceling the running polling
+	waitGroup  sync.WaitGroup     // WaitGroup to wait for the polling goroutine
+}
+
+// AddBlobConfig registers a configuration stored as the object key in store. An empty configType is derived
+// from the extension of the key (e.g. ".yaml"); a zero interval polls every 30 seconds. The configuration
+// is read-only. Call StartWatching on the returned source to reload it when the object changes.
+func (cm *ConfigManager) AddBlobConfig(configName string, store BlobStore, key, configType string, configInterface interface{}, interval time.Duration) (*BlobConfigSource, error) {
+	if store == nil {
+		return nil, fmt.Errorf("blob config %v: store is not set", configName)
+	}
+	if configType == "" {
+		_, configType = splitConfigFileName(path.Base(key))
+	}
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+
+	s := &BlobConfigSource{store: store, key: key, configName: configName, interval: interval, manager: cm}
+	if err := cm.AddConfigFS(s, configName, "", configType, configInterface); err != nil {
+		return nil, err
+	}
+	cm.addRemoteSource(configName, s)
+	return s, nil
+}
+
+// Open implements fs.FS. Every name resolves to the object content; it is downloaded if it was not yet.
+func (s *BlobConfigSource) Open(name string) (fs.File, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.loaded {
+		if err := s.fetchLocked(context.Background()); err != nil {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+		}
+	}
+	return newRemoteFile(name, s.content), nil
+}
+
+// Refresh downloads the object and loads the configuration from it.
+// It is not needed while the source is watched.
+func (s *BlobConfigSource) Refresh() error {
+	s.mu.Lock()
+	err := s.fetchLocked(context.Background())
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return s.manager.LoadConfig(s.configName)
+}
+
+// StartWatching polls the object version every interval and applies the object when it changed.
+// Errors are reported through errorFunc if it is set.
+func (s *BlobConfigSource) StartWatching(errorFunc func(err error)) error {
+	s.StopWatching()
+	errorFunc = quietCircuitErrors(errorFunc)
+	if err := s.manager.setRemoteWatching(s.configName, true); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.mu.Lock()
+	s.cancel = cancel
+	s.mu.Unlock()
+
+	s.waitGroup.Add(1)
+	s.manager.configList.resources.acquire(s.configName, resourceRemoteWatch)
+	go func() {
+		defer s.waitGroup.Done()
+		defer s.manager.configList.resources.release(s.configName, resourceRemoteWatch)
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			if err := s.poll(ctx); err != nil && ctx.Err() == nil && errorFunc != nil {
+				errorFunc(fmt.Errorf("blob config %v: %w", s.configName, err))
+			}
+		}
+	}()
+	return nil
+}
+
+// StopWatching stops polling the object and waits for the polling to finish.
+func (s *BlobConfigSource) StopWatching() {
+	s.mu.Lock()
+	cancel := s.cancel
+	s.cancel = nil
+	s.mu.Unlock()
+
+	if cancel == nil {
+		return
+	}
+	cancel()
+	s.waitGroup.Wait()
+	s.manager.setRemoteWatching(s.configName, false)
+}
+
+// poll downloads and applies the object if its version changed.
+func (s *BlobConfigSource) poll(ctx context.Context) error {
+	version, err := s.store.Version(ctx, s.key)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	if version != "" && version == s.version {
+		s.mu.Unlock()
+		return nil
+	}
+	previous := s.content
+	err = s.fetchLocked(ctx)
+	changed := err == nil && !bytes.Equal(previous, s.content)
+	s.mu.Unlock()
+	if err != nil || !changed {
+		return err
+	}
+	return s.manager.applyRemoteChange(s.configName)
+}
+
+// fetchLocked calls fetchOnceLocked according to the retry policy and circuit breaker of the configuration.
+// The caller must hold s.mu.
+func (s *BlobConfigSource) fetchLocked(ctx context.Context) error {
+	return s.manager.retryFetch(ctx, s.configName, func() error { return s.fetchOnceLocked(ctx) })
+}
+
+// fetchOnceLocked downloads the object. The caller must hold s.mu.
+func (s *BlobConfigSource) fetchOnceLocked(ctx context.Context) error {
+	content, version, err := s.store.Fetch(ctx, s.key)
+	if err != nil {
+		return err
+	}
+	s.content, s.version, s.loaded = content, version, true
+	s.manager.sourceReached(s.configName)
+	return nil
+}
+
+// doBlobRequest sends a request to an object storage and returns the response of a successful (2xx) request.
+// For HEAD requests the body is closed; otherwise the caller must close it.
+func doBlobRequest(client *http.Client, req *http.Request) (*http.Response, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		message, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		resp.Body.Close()
+		return nil, fmt.Errorf("%v %v: unexpected status %v: %s", req.Method, req.URL.Path, resp.Status, bytes.TrimSpace(message))
+	}
+	if req.Method == http.MethodHead {
+		resp.Body.Close()
+	}
+	return resp, nil
+}
+
+// readBlobResponse reads the body of an object download and closes it.
+func readBlobResponse(resp *http.Response) ([]byte, error) {
+	defer resp.Body.Close()
+	return ioutil.ReadAll(resp.Body)
+}
+
+// escapeObjectPath percent-encodes every segment of a slash-separated object key, keeping only unreserved characters.
+func escapeObjectPath(p string) string {
+	segments := strings.Split(p, "/")
+	for i, segment := range segments {
+		segments[i] = awsEscape(segment)
+	}
+	return strings.Join(segments, "/")
+}
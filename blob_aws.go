@@ -0,0 +1,296 @@
+package mkconf
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// AWSOptions configures the SSM Parameter Store, Secrets Manager and AppConfig sources.
+type AWSOptions struct {
+	Region          string        // Region of the service; AWS_REGION if empty
+	Endpoint        string        // Optional endpoint of the service, e.g. "http://localstack:4566"
+	AccessKeyID     string        // Access key; AWS_ACCESS_KEY_ID if empty
+	SecretAccessKey string        // Secret key; AWS_SECRET_ACCESS_KEY if empty
+	SessionToken    string        // Session token of temporary credentials; AWS_SESSION_TOKEN if empty
+	Interval        time.Duration // Polling interval while the source is watched; 30 seconds if zero
+	HTTPClient      *http.Client  // Client used for requests; http.DefaultClient if nil
+	Source          SourceOptions // TLS and proxy settings; the token provider is not used, as requests are signed with the keys
+}
+
+// awsStore calls an AWS JSON API (SSM or Secrets Manager) with signed requests.
+type awsStore struct {
+	service string     // Signing name of the service, e.g. "ssm"
+	target  string     // Prefix of the X-Amz-Target header, e.g. "AmazonSSM"
+	options AWSOptions // Store options
+}
+
+// newAWSStore applies the environment defaults to options and returns a store calling service.
+func newAWSStore(service, target string, options AWSOptions) (*awsStore, error) {
+	options, err := awsDefaults(options)
+	if err != nil {
+		return nil, fmt.Errorf("%v store: %v", service, err)
+	}
+	return &awsStore{service: service, target: target, options: options}, nil
+}
+
+// awsDefaults fills the region and credentials missing in options from the environment and applies the source
+// options to the client.
+func awsDefaults(options AWSOptions) (AWSOptions, error) {
+	if options.Region == "" {
+		options.Region = os.Getenv("AWS_REGION")
+	}
+	if options.Region == "" {
+		options.Region = "us-east-1"
+	}
+	if options.AccessKeyID == "" {
+		options.AccessKeyID = os.Getenv("AWS_ACCESS_KEY_ID")
+		options.SecretAccessKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
+		options.SessionToken = os.Getenv("AWS_SESSION_TOKEN")
+	}
+	if options.AccessKeyID == "" {
+		return options, fmt.Errorf("AWS credentials are not set")
+	}
+	client, err := options.Source.httpClient(options.HTTPClient)
+	if err != nil {
+		return options, err
+	}
+	options.HTTPClient = client
+	return options, nil
+}
+
+// call invokes the API action with input and decodes the response into output.
+func (s *awsStore) call(ctx context.Context, action string, input, output interface{}) error {
+	payload, err := json.Marshal(input)
+	if err != nil {
+		return err
+	}
+	endpoint := s.options.Endpoint
+	if endpoint == "" {
+		endpoint = "https://" + s.service + "." + s.options.Region + ".amazonaws.com"
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(endpoint, "/")+"/", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", s.target+"."+action)
+	signAWSRequest(req, payload, s.options.AccessKeyID, s.options.SecretAccessKey, s.options.SessionToken, s.options.Region, s.service, time.Now())
+
+	resp, err := doBlobRequest(s.options.HTTPClient, req)
+	if err != nil {
+		return fmt.Errorf("%v %v: %v", s.service, action, err)
+	}
+	content, err := readBlobResponse(resp)
+	if err != nil {
+		return fmt.Errorf("%v %v: %v", s.service, action, err)
+	}
+	if err := json.Unmarshal(content, output); err != nil {
+		return fmt.Errorf("%v %v: %v", s.service, action, err)
+	}
+	return nil
+}
+
+// ssmParameter is a parameter returned by GetParametersByPath.
+type ssmParameter struct {
+	Name    string // Full name of the parameter
+	Type    string // String, StringList or SecureString
+	Value   string // Value of the parameter, decrypted if requested
+	Version int64  // Version of the parameter
+}
+
+// ssmStore is a BlobStore mapping the parameters under a path prefix to a JSON document.
+type ssmStore struct {
+	*awsStore
+}
+
+// NewSSMParameterStore returns a BlobStore reading the parameters under a path prefix of the AWS Systems Manager
+// Parameter Store. The key is the path prefix, e.g. "/app/prod". The parameters below it are mapped to a JSON object
+// following the path hierarchy, so "/app/prod/db/host" becomes {"db": {"host": ...}}. SecureString parameters are
+// decrypted, StringList parameters become arrays. The version changes whenever a parameter is added, removed or updated.
+func NewSSMParameterStore(options AWSOptions) (BlobStore, error) {
+	s, err := newAWSStore("ssm", "AmazonSSM", options)
+	if err != nil {
+		return nil, err
+	}
+	return &ssmStore{s}, nil
+}
+
+// Version implements BlobStore. Parameters are listed without decryption.
+func (s *ssmStore) Version(ctx context.Context, key string) (string, error) {
+	parameters, err := s.parameters(ctx, key, false)
+	if err != nil {
+		return "", err
+	}
+	return ssmVersion(parameters), nil
+}
+
+// Fetch implements BlobStore.
+func (s *ssmStore) Fetch(ctx context.Context, key string) ([]byte, string, error) {
+	parameters, err := s.parameters(ctx, key, true)
+	if err != nil {
+		return nil, "", err
+	}
+
+	prefix := strings.TrimSuffix(key, "/") + "/"
+	tree := make(map[string]interface{})
+	for _, parameter := range parameters {
+		var value interface{} = parameter.Value
+		if parameter.Type == "StringList" {
+			value = strings.Split(parameter.Value, ",")
+		}
+		path := strings.Split(strings.TrimPrefix(parameter.Name, prefix), "/")
+		if err := setParameter(tree, path, value); err != nil {
+			return nil, "", fmt.Errorf("ssm %v: parameter %v: %v", key, parameter.Name, err)
+		}
+	}
+
+	content, err := json.Marshal(tree)
+	if err != nil {
+		return nil, "", err
+	}
+	return content, ssmVersion(parameters), nil
+}
+
+// parameters lists all parameters under the path prefix.
+func (s *ssmStore) parameters(ctx context.Context, path string, decrypt bool) ([]ssmParameter, error) {
+	input := struct {
+		Path           string
+		Recursive      bool
+		WithDecryption bool
+		NextToken      string `json:",omitempty"`
+	}{Path: path, Recursive: true, WithDecryption: decrypt}
+
+	var parameters []ssmParameter
+	for {
+		var output struct {
+			Parameters []ssmParameter
+			NextToken  string
+		}
+		if err := s.call(ctx, "GetParametersByPath", input, &output); err != nil {
+			return nil, err
+		}
+		parameters = append(parameters, output.Parameters...)
+		if output.NextToken == "" {
+			return parameters, nil
+		}
+		input.NextToken = output.NextToken
+	}
+}
+
+// ssmVersion derives a version from the names and versions of the parameters.
+func ssmVersion(parameters []ssmParameter) string {
+	versions := make([]string, 0, len(parameters))
+	for _, parameter := range parameters {
+		versions = append(versions, fmt.Sprintf("%s@%d", parameter.Name, parameter.Version))
+	}
+	sort.Strings(versions)
+	sum := sha256.Sum256([]byte(strings.Join(versions, "\n")))
+	return hex.EncodeToString(sum[:])
+}
+
+// setParameter stores value in tree at path, creating the intermediate objects.
+func setParameter(tree map[string]interface{}, path []string, value interface{}) error {
+	for i, segment := range path {
+		if i == len(path)-1 {
+			if _, ok := tree[segment].(map[string]interface{}); ok {
+				return fmt.Errorf("%v is both a value and a path", strings.Join(path, "/"))
+			}
+			tree[segment] = value
+			return nil
+		}
+		switch next := tree[segment].(type) {
+		case nil:
+			child := make(map[string]interface{})
+			tree[segment] = child
+			tree = child
+		case map[string]interface{}:
+			tree = next
+		default:
+			return fmt.Errorf("%v is both a value and a path", strings.Join(path[:i+1], "/"))
+		}
+	}
+	return nil
+}
+
+// secretsManagerStore is a BlobStore reading secrets from AWS Secrets Manager.
+type secretsManagerStore struct {
+	*awsStore
+}
+
+// NewSecretsManagerStore returns a BlobStore reading secrets from AWS Secrets Manager. The key is the secret ID
+// (name or ARN) and the object is the secret string, typically a JSON blob. The version is the ID of the version
+// labeled AWSCURRENT, so a rotation is picked up without downloading the secret on every poll.
+func NewSecretsManagerStore(options AWSOptions) (BlobStore, error) {
+	s, err := newAWSStore("secretsmanager", "secretsmanager", options)
+	if err != nil {
+		return nil, err
+	}
+	return &secretsManagerStore{s}, nil
+}
+
+// Version implements BlobStore.
+func (s *secretsManagerStore) Version(ctx context.Context, key string) (string, error) {
+	var output struct {
+		VersionIdsToStages map[string][]string
+	}
+	if err := s.call(ctx, "DescribeSecret", map[string]string{"SecretId": key}, &output); err != nil {
+		return "", err
+	}
+	for version, stages := range output.VersionIdsToStages {
+		if containsString(stages, "AWSCURRENT") {
+			return version, nil
+		}
+	}
+	return "", nil
+}
+
+// Fetch implements BlobStore.
+func (s *secretsManagerStore) Fetch(ctx context.Context, key string) ([]byte, string, error) {
+	var output struct {
+		SecretString string
+		SecretBinary []byte
+		VersionId    string
+	}
+	if err := s.call(ctx, "GetSecretValue", map[string]string{"SecretId": key}, &output); err != nil {
+		return nil, "", err
+	}
+	if output.SecretString == "" {
+		return output.SecretBinary, output.VersionId, nil
+	}
+	return []byte(output.SecretString), output.VersionId, nil
+}
+
+// AddSSMConfig registers a configuration read from the SSM parameters under the path prefix, mapped as described
+// for NewSSMParameterStore. The configuration is read-only. Call StartWatching on the returned source to reload it
+// when a parameter changes; changes are recorded in the change log like file changes.
+func (cm *ConfigManager) AddSSMConfig(configName, path string, configInterface interface{}, options AWSOptions) (*BlobConfigSource, error) {
+	store, err := NewSSMParameterStore(options)
+	if err != nil {
+		return nil, err
+	}
+	return cm.AddBlobConfig(configName, store, path, ".json", configInterface, options.Interval)
+}
+
+// AddSecretsManagerConfig registers a configuration read from an AWS Secrets Manager secret. An empty configType
+// parses the secret as JSON. The configuration is read-only. Call StartWatching on the returned source to reload
+// it when the secret is rotated.
+func (cm *ConfigManager) AddSecretsManagerConfig(configName, secretID, configType string, configInterface interface{}, options AWSOptions) (*BlobConfigSource, error) {
+	store, err := NewSecretsManagerStore(options)
+	if err != nil {
+		return nil, err
+	}
+	if configType == "" {
+		configType = ".json"
+	}
+	return cm.AddBlobConfig(configName, store, secretID, configType, configInterface, options.Interval)
+}
@@ -0,0 +1,103 @@
+package mkconf
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// azureStorageVersion is the Blob service REST API version requests are made with.
+const azureStorageVersion = "2021-08-06"
+
+// AzureBlobOptions configures an Azure Blob Storage object store.
+type AzureBlobOptions struct {
+	Account    string                                    // Name of the storage account
+	Container  string                                    // Name of the container
+	SASToken   string                                    // Shared access signature query string, if set
+	TokenFunc  func(ctx context.Context) (string, error) // Function returning a Microsoft Entra ID access token, if set
+	Endpoint   string                                    // Optional endpoint, e.g. of Azurite; "https://<account>.blob.core.windows.net" if empty
+	HTTPClient *http.Client                              // Client used for requests; http.DefaultClient if nil
+	Source     SourceOptions                             // TLS, proxy and token provider settings; TokenFunc takes precedence over the token provider
+}
+
+// azureBlobStore is a BlobStore backed by an Azure Blob Storage container.
+type azureBlobStore struct {
+	options AzureBlobOptions // Store options
+}
+
+// NewAzureBlobStore returns a BlobStore reading blobs from an Azure Blob Storage container.
+// Object versions are ETags. Requests are authorized with the SAS token or the access token, if configured.
+func NewAzureBlobStore(options AzureBlobOptions) (BlobStore, error) {
+	if options.Container == "" {
+		return nil, fmt.Errorf("azure blob store: container is not set")
+	}
+	if options.Endpoint == "" {
+		if options.Account == "" {
+			return nil, fmt.Errorf("azure blob store: account is not set")
+		}
+		options.Endpoint = "https://" + options.Account + ".blob.core.windows.net"
+	}
+	options.SASToken = strings.TrimPrefix(options.SASToken, "?")
+	if options.TokenFunc == nil {
+		options.TokenFunc = options.Source.TokenFunc
+	}
+	client, err := options.Source.httpClient(options.HTTPClient)
+	if err != nil {
+		return nil, fmt.Errorf("azure blob store: %v", err)
+	}
+	options.HTTPClient = client
+	return &azureBlobStore{options: options}, nil
+}
+
+// Version implements BlobStore.
+func (s *azureBlobStore) Version(ctx context.Context, key string) (string, error) {
+	req, err := s.newRequest(ctx, http.MethodHead, key)
+	if err != nil {
+		return "", err
+	}
+	resp, err := doBlobRequest(s.options.HTTPClient, req)
+	if err != nil {
+		return "", fmt.Errorf("azure blob %v/%v: %v", s.options.Container, key, err)
+	}
+	return resp.Header.Get("ETag"), nil
+}
+
+// Fetch implements BlobStore.
+func (s *azureBlobStore) Fetch(ctx context.Context, key string) ([]byte, string, error) {
+	req, err := s.newRequest(ctx, http.MethodGet, key)
+	if err != nil {
+		return nil, "", err
+	}
+	resp, err := doBlobRequest(s.options.HTTPClient, req)
+	if err != nil {
+		return nil, "", fmt.Errorf("azure blob %v/%v: %v", s.options.Container, key, err)
+	}
+	content, err := readBlobResponse(resp)
+	if err != nil {
+		return nil, "", fmt.Errorf("azure blob %v/%v: %v", s.options.Container, key, err)
+	}
+	return content, resp.Header.Get("ETag"), nil
+}
+
+// newRequest creates an authorized request for the blob key.
+func (s *azureBlobStore) newRequest(ctx context.Context, method, key string) (*http.Request, error) {
+	target := strings.TrimSuffix(s.options.Endpoint, "/") + "/" + s.options.Container + "/" + escapeObjectPath(strings.TrimPrefix(key, "/"))
+	if s.options.SASToken != "" {
+		target += "?" + s.options.SASToken
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("x-ms-version", azureStorageVersion)
+
+	if s.options.TokenFunc != nil {
+		token, err := s.options.TokenFunc(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("azure blob %v/%v: token: %v", s.options.Container, key, err)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return req, nil
+}
@@ -0,0 +1,107 @@
+package mkconf
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// GCSOptions configures a Google Cloud Storage object store.
+type GCSOptions struct {
+	Bucket     string                                    // Name of the bucket
+	Token      string                                    // Static OAuth2 access token, if set
+	TokenFunc  func(ctx context.Context) (string, error) // Function returning a current OAuth2 access token; takes precedence over Token
+	Endpoint   string                                    // Optional endpoint, e.g. of an emulator; "https://storage.googleapis.com" if empty
+	HTTPClient *http.Client                              // Client used for requests; http.DefaultClient if nil
+	Source     SourceOptions                             // TLS, proxy and token provider settings; TokenFunc takes precedence over the token provider
+}
+
+// gcsStore is a BlobStore backed by a GCS bucket.
+type gcsStore struct {
+	options GCSOptions // Store options
+}
+
+// NewGCSStore returns a BlobStore reading objects from a GCS bucket through the JSON API.
+// Object versions are generations. Requests are anonymous if no token is configured.
+func NewGCSStore(options GCSOptions) (BlobStore, error) {
+	if options.Bucket == "" {
+		return nil, fmt.Errorf("gcs store: bucket is not set")
+	}
+	if options.Endpoint == "" {
+		options.Endpoint = "https://storage.googleapis.com"
+	}
+	if options.TokenFunc == nil {
+		options.TokenFunc = options.Source.TokenFunc
+	}
+	client, err := options.Source.httpClient(options.HTTPClient)
+	if err != nil {
+		return nil, fmt.Errorf("gcs store: %v", err)
+	}
+	options.HTTPClient = client
+	return &gcsStore{options: options}, nil
+}
+
+// Version implements BlobStore.
+func (s *gcsStore) Version(ctx context.Context, key string) (string, error) {
+	req, err := s.newRequest(ctx, key, false)
+	if err != nil {
+		return "", err
+	}
+	resp, err := doBlobRequest(s.options.HTTPClient, req)
+	if err != nil {
+		return "", fmt.Errorf("gcs %v/%v: %v", s.options.Bucket, key, err)
+	}
+	defer resp.Body.Close()
+
+	var metadata struct {
+		Generation string `json:"generation"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&metadata); err != nil {
+		return "", fmt.Errorf("gcs %v/%v: %v", s.options.Bucket, key, err)
+	}
+	return metadata.Generation, nil
+}
+
+// Fetch implements BlobStore.
+func (s *gcsStore) Fetch(ctx context.Context, key string) ([]byte, string, error) {
+	req, err := s.newRequest(ctx, key, true)
+	if err != nil {
+		return nil, "", err
+	}
+	resp, err := doBlobRequest(s.options.HTTPClient, req)
+	if err != nil {
+		return nil, "", fmt.Errorf("gcs %v/%v: %v", s.options.Bucket, key, err)
+	}
+	content, err := readBlobResponse(resp)
+	if err != nil {
+		return nil, "", fmt.Errorf("gcs %v/%v: %v", s.options.Bucket, key, err)
+	}
+	return content, resp.Header.Get("X-Goog-Generation"), nil
+}
+
+// newRequest creates a request for the metadata or, if media is set, the content of the object key.
+func (s *gcsStore) newRequest(ctx context.Context, key string, media bool) (*http.Request, error) {
+	target := strings.TrimSuffix(s.options.Endpoint, "/") + "/storage/v1/b/" + url.PathEscape(s.options.Bucket) +
+		"/o/" + url.PathEscape(strings.TrimPrefix(key, "/"))
+	if media {
+		target += "?alt=media"
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	token := s.options.Token
+	if s.options.TokenFunc != nil {
+		if token, err = s.options.TokenFunc(ctx); err != nil {
+			return nil, fmt.Errorf("gcs %v/%v: token: %v", s.options.Bucket, key, err)
+		}
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return req, nil
+}
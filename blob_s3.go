@@ -0,0 +1,213 @@
+package mkconf
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// S3Options configures an S3 object store.
+type S3Options struct {
+	Bucket          string        // Name of the bucket
+	Region          string        // Region of the bucket; AWS_REGION if empty
+	Endpoint        string        // Optional endpoint of an S3-compatible service, e.g. "http://minio:9000"
+	PathStyle       bool          // Flag to address the bucket in the path instead of the host name
+	AccessKeyID     string        // Access key; AWS_ACCESS_KEY_ID if empty. Requests are anonymous without a key
+	SecretAccessKey string        // Secret key; AWS_SECRET_ACCESS_KEY if empty
+	SessionToken    string        // Session token of temporary credentials; AWS_SESSION_TOKEN if empty
+	HTTPClient      *http.Client  // Client used for requests; http.DefaultClient if nil
+	Source          SourceOptions // TLS and proxy settings; the token provider is not used, as requests are signed with the keys
+}
+
+// s3Store is a BlobStore backed by an S3 bucket.
+type s3Store struct {
+	options S3Options // Store options
+}
+
+// NewS3Store returns a BlobStore reading objects from an S3 (or S3-compatible) bucket with Signature Version 4.
+// Object versions are version IDs on versioned buckets and ETags otherwise.
+func NewS3Store(options S3Options) (BlobStore, error) {
+	if options.Bucket == "" {
+		return nil, fmt.Errorf("s3 store: bucket is not set")
+	}
+	if options.Region == "" {
+		options.Region = os.Getenv("AWS_REGION")
+	}
+	if options.Region == "" {
+		options.Region = "us-east-1"
+	}
+	if options.AccessKeyID == "" {
+		options.AccessKeyID = os.Getenv("AWS_ACCESS_KEY_ID")
+		options.SecretAccessKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
+		options.SessionToken = os.Getenv("AWS_SESSION_TOKEN")
+	}
+	client, err := options.Source.httpClient(options.HTTPClient)
+	if err != nil {
+		return nil, fmt.Errorf("s3 store: %v", err)
+	}
+	options.HTTPClient = client
+	return &s3Store{options: options}, nil
+}
+
+// Version implements BlobStore.
+func (s *s3Store) Version(ctx context.Context, key string) (string, error) {
+	req, err := s.newRequest(ctx, http.MethodHead, key)
+	if err != nil {
+		return "", err
+	}
+	resp, err := doBlobRequest(s.options.HTTPClient, req)
+	if err != nil {
+		return "", fmt.Errorf("s3 %v/%v: %v", s.options.Bucket, key, err)
+	}
+	return s3Version(resp), nil
+}
+
+// Fetch implements BlobStore.
+func (s *s3Store) Fetch(ctx context.Context, key string) ([]byte, string, error) {
+	req, err := s.newRequest(ctx, http.MethodGet, key)
+	if err != nil {
+		return nil, "", err
+	}
+	resp, err := doBlobRequest(s.options.HTTPClient, req)
+	if err != nil {
+		return nil, "", fmt.Errorf("s3 %v/%v: %v", s.options.Bucket, key, err)
+	}
+	content, err := readBlobResponse(resp)
+	if err != nil {
+		return nil, "", fmt.Errorf("s3 %v/%v: %v", s.options.Bucket, key, err)
+	}
+	return content, s3Version(resp), nil
+}
+
+// s3Version returns the version ID of an object response, or its ETag on unversioned buckets.
+func s3Version(resp *http.Response) string {
+	if version := resp.Header.Get("X-Amz-Version-Id"); version != "" && version != "null" {
+		return version
+	}
+	return resp.Header.Get("ETag")
+}
+
+// newRequest creates a signed request for the object key.
+func (s *s3Store) newRequest(ctx context.Context, method, key string) (*http.Request, error) {
+	endpoint := s.options.Endpoint
+	if endpoint == "" {
+		endpoint = "https://s3." + s.options.Region + ".amazonaws.com"
+	}
+	endpoint = strings.TrimSuffix(endpoint, "/")
+
+	objectPath := "/" + escapeObjectPath(strings.TrimPrefix(key, "/"))
+	target := endpoint + "/" + s.options.Bucket + objectPath
+	if !s.options.PathStyle {
+		scheme, host := "https://", endpoint
+		if i := strings.Index(endpoint, "://"); i >= 0 {
+			scheme, host = endpoint[:i+3], endpoint[i+3:]
+		}
+		target = scheme + s.options.Bucket + "." + host + objectPath
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	if s.options.AccessKeyID != "" {
+		signAWSRequest(req, nil, s.options.AccessKeyID, s.options.SecretAccessKey, s.options.SessionToken, s.options.Region, "s3", time.Now())
+	}
+	return req, nil
+}
+
+// signAWSRequest signs a request whose body is payload with AWS Signature Version 4.
+// The host, Range and x-amz-* headers are signed.
+func signAWSRequest(req *http.Request, payload []byte, accessKey, secretKey, sessionToken, region, service string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	day := amzDate[:8]
+	payloadHash := sha256.Sum256(payload)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", hex.EncodeToString(payloadHash[:]))
+	if sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", sessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		lower := strings.ToLower(name)
+		if strings.HasPrefix(lower, "x-amz-") || lower == "range" {
+			headers[lower] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalPath := req.URL.EscapedPath()
+	if canonicalPath == "" {
+		canonicalPath = "/"
+	}
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		canonicalPath,
+		awsCanonicalQuery(req),
+		canonicalHeaders.String(),
+		signedHeaders,
+		hex.EncodeToString(payloadHash[:]),
+	}, "\n")
+
+	scope := day + "/" + region + "/" + service + "/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+secretKey), day)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", accessKey, scope, signedHeaders, signature))
+}
+
+// awsCanonicalQuery returns the query of the request in canonical form: sorted and strictly escaped.
+func awsCanonicalQuery(req *http.Request) string {
+	query := req.URL.Query()
+	pairs := make([]string, 0, len(query))
+	for name, values := range query {
+		for _, value := range values {
+			pairs = append(pairs, awsEscape(name)+"="+awsEscape(value))
+		}
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, "&")
+}
+
+// awsEscape percent-encodes everything except unreserved characters, as required by Signature Version 4.
+func awsEscape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || c == '-' || c == '.' || c == '_' || c == '~' {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
+
+// hmacSHA256 returns the HMAC-SHA256 of data with key.
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,334 @@
+package mkconf
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// BundleFactory is a function type used to create the interface a bundle member is decoded into.
+// Returning nil skips the member.
+type BundleFactory func(configName string) interface{}
+
+// BundleVerifyFunc is a function type used to verify a bundle (e.g. its signature) before it is extracted.
+type BundleVerifyFunc func(bundle []byte) error
+
+// BundleOptions configures an archive bundle config source.
+type BundleOptions struct {
+	ExtractDir string           // Directory the members are extracted to
+	Verify     BundleVerifyFunc // Optional verification of the whole bundle before extraction
+	HTTPClient *http.Client     // Client used for remote bundles; http.DefaultClient if nil
+	Source     SourceOptions    // TLS, proxy and token provider settings of remote bundles; a provided token is sent as "Authorization: Bearer"
+
+	OnChange GroupChangeCallbackFunc // Optional callback invoked once with all members after the bundle was applied
+}
+
+// ConfigBundle is a tar or zip archive whose members are registered as individual configurations.
+// The bundle can be a local file or an http(s) URL.
+type ConfigBundle struct {
+	source    string         // Path or URL of the bundle
+	options   BundleOptions  // Bundle options
+	manager   *ConfigManager // Manager the members are registered with
+	factory   BundleFactory  // Factory creating member interfaces
+	members   []string       // Names of the registered member configurations
+	lastHash  string         // Hash of the last extracted bundle
+	mu        sync.Mutex     // Mutex for synchronizing refreshes
+	stop      chan struct{}  // Channel closed to stop bundle monitoring
+	waitGroup sync.WaitGroup // WaitGroup to wait for the monitoring goroutine
+}
+
+// AddConfigBundle fetches the bundle, verifies and extracts it, and registers and loads every member
+// whose type has a reader. Member names are their paths inside the bundle without the extension.
+// Returns the bundle handle, which can be used to refresh or monitor the bundle.
+func (cm *ConfigManager) AddConfigBundle(source string, options BundleOptions, factory BundleFactory) (*ConfigBundle, error) {
+	if options.ExtractDir == "" {
+		return nil, fmt.Errorf("bundle %v: extract directory is not set", source)
+	}
+	if factory == nil {
+		return nil, fmt.Errorf("bundle %v: factory is not set", source)
+	}
+	client, err := options.Source.httpClient(options.HTTPClient)
+	if err != nil {
+		return nil, fmt.Errorf("bundle %v: %v", source, err)
+	}
+	options.HTTPClient = client
+
+	b := &ConfigBundle{source: source, options: options, manager: cm, factory: factory}
+	if _, err := b.Refresh(); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// Members returns the names of the configurations registered from the bundle.
+func (b *ConfigBundle) Members() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]string(nil), b.members...)
+}
+
+// Refresh fetches the bundle and, if it changed, verifies it, re-extracts it and reloads its members.
+// All members are validated first and applied together, or none of them is applied.
+// New members are registered; members that disappeared from the bundle are kept with their last content.
+// Returns whether the bundle changed.
+func (b *ConfigBundle) Refresh() (bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	data, err := b.fetch()
+	if err != nil {
+		return false, fmt.Errorf("bundle %v: %v", b.source, err)
+	}
+
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+	if hash == b.lastHash {
+		return false, nil
+	}
+
+	if b.options.Verify != nil {
+		if err := b.options.Verify(data); err != nil {
+			return false, fmt.Errorf("bundle %v: verification failed: %v", b.source, err)
+		}
+	}
+
+	files, err := readBundle(b.source, data)
+	if err != nil {
+		return false, fmt.Errorf("bundle %v: %v", b.source, err)
+	}
+
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		target := filepath.Join(b.options.ExtractDir, filepath.FromSlash(name))
+		if err := writeFileAtomic(target, files[name], 0644); err != nil {
+			return false, fmt.Errorf("bundle %v: error extracting %v: %v", b.source, name, err)
+		}
+	}
+
+	var loadErrors []string
+	var applied []string
+	for _, name := range names {
+		configName, configType := splitConfigFileName(name)
+		if configType == "" {
+			continue
+		}
+
+		if _, err := b.manager.GetConfig(configName); err != nil {
+			settings := ConfigSettings{configType: configType}
+			if settings.checkReader() == nil {
+				continue
+			}
+			v := b.factory(configName)
+			if v == nil {
+				continue
+			}
+			if err := b.manager.AddConfig(configName, b.options.ExtractDir, configType, v); err != nil {
+				loadErrors = append(loadErrors, err.Error())
+				continue
+			}
+			b.members = append(b.members, configName)
+		}
+		applied = append(applied, configName)
+	}
+	if len(loadErrors) > 0 {
+		return true, fmt.Errorf("bundle %v: %v", b.source, strings.Join(loadErrors, "; "))
+	}
+
+	if err := b.manager.applyConfigsAtomically(applied); err != nil {
+		return true, fmt.Errorf("bundle %v: %v", b.source, err)
+	}
+	b.lastHash = hash
+	if b.options.OnChange != nil {
+		b.options.OnChange(b.source, applied)
+	}
+	return true, nil
+}
+
+// StartMonitoring periodically refreshes the bundle until StopMonitoring is called.
+// Errors are reported through errorFunc if it is set.
+func (b *ConfigBundle) StartMonitoring(interval time.Duration, errorFunc func(err error)) {
+	b.StopMonitoring()
+
+	b.mu.Lock()
+	stop := make(chan struct{})
+	b.stop = stop
+	b.mu.Unlock()
+
+	b.waitGroup.Add(1)
+	go func() {
+		defer b.waitGroup.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				if _, err := b.Refresh(); err != nil && errorFunc != nil {
+					errorFunc(err)
+				}
+			}
+		}
+	}()
+}
+
+// StopMonitoring stops the periodic refresh of the bundle and waits for it to finish.
+func (b *ConfigBundle) StopMonitoring() {
+	b.mu.Lock()
+	stop := b.stop
+	b.stop = nil
+	b.mu.Unlock()
+
+	if stop != nil {
+		close(stop)
+	}
+	b.waitGroup.Wait()
+}
+
+// fetch reads the bundle from disk or downloads it.
+func (b *ConfigBundle) fetch() ([]byte, error) {
+	if !strings.HasPrefix(b.source, "http://") && !strings.HasPrefix(b.source, "https://") {
+		return ioutil.ReadFile(b.source)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, b.source, nil)
+	if err != nil {
+		return nil, err
+	}
+	token, err := b.options.Source.token(req.Context(), "")
+	if err != nil {
+		return nil, err
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := b.options.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %v", resp.Status)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+// readBundle returns the regular files of a zip, tar or gzipped tar archive keyed by their slash-separated path.
+func readBundle(source string, data []byte) (map[string][]byte, error) {
+	files := make(map[string][]byte)
+	lower := strings.ToLower(source)
+
+	if strings.HasSuffix(lower, ".zip") || bytes.HasPrefix(data, []byte("PK\x03\x04")) {
+		zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range zr.File {
+			if f.FileInfo().IsDir() {
+				continue
+			}
+			name, err := bundleMemberName(f.Name)
+			if err != nil {
+				return nil, err
+			}
+			rc, err := f.Open()
+			if err != nil {
+				return nil, err
+			}
+			content, err := ioutil.ReadAll(rc)
+			rc.Close()
+			if err != nil {
+				return nil, err
+			}
+			files[name] = content
+		}
+		return files, nil
+	}
+
+	var r io.Reader = bytes.NewReader(data)
+	if bytes.HasPrefix(data, []byte{0x1f, 0x8b}) {
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		name, err := bundleMemberName(header.Name)
+		if err != nil {
+			return nil, err
+		}
+		content, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return nil, err
+		}
+		files[name] = content
+	}
+	return files, nil
+}
+
+// bundleMemberName cleans an archive member name and rejects names escaping the extract directory.
+func bundleMemberName(name string) (string, error) {
+	cleaned := path.Clean("/" + strings.ReplaceAll(name, "\\", "/"))[1:]
+	if cleaned == "" || strings.HasPrefix(cleaned, "../") || cleaned != strings.TrimPrefix(path.Clean(name), "./") {
+		return "", fmt.Errorf("invalid bundle member name %q", name)
+	}
+	return cleaned, nil
+}
+
+// writeFileAtomic writes content to a temporary file next to target and renames it over target.
+func writeFileAtomic(target string, content []byte, perm os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(target), "."+filepath.Base(target)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), target)
+}
@@ -0,0 +1,251 @@
+package mkconf
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrChangeVetoed is wrapped by the errors reporting a change rejected with ChangeEvent.Veto.
+var ErrChangeVetoed = errors.New("change vetoed")
+
+// CallbackMode selects where the change callbacks and event listeners of a configuration run.
+type CallbackMode int
+
+const (
+	CallbackDispatch CallbackMode = iota // Run on the WatchForChanges goroutines of the configuration, one change after the other
+	CallbackSync                         // Run on the monitoring goroutine in reload order, before the change is applied, see ChangeEvent.Veto
+	CallbackAsync                        // Run on the bounded worker pool of the manager, see SetCallbackWorkers
+)
+
+// defaultCallbackWorkers is the number of workers of the callback pool if SetCallbackWorkers is not called.
+const defaultCallbackWorkers = 4
+
+// String returns the name of the mode.
+func (m CallbackMode) String() string {
+	switch m {
+	case CallbackDispatch:
+		return "dispatch"
+	case CallbackSync:
+		return "sync"
+	case CallbackAsync:
+		return "async"
+	}
+	return fmt.Sprintf("CallbackMode(%d)", int(m))
+}
+
+// MarshalText encodes the mode by its name.
+func (m CallbackMode) MarshalText() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// UnmarshalText decodes a mode encoded by MarshalText.
+func (m *CallbackMode) UnmarshalText(text []byte) error {
+	for _, mode := range []CallbackMode{CallbackDispatch, CallbackSync, CallbackAsync} {
+		if string(text) == mode.String() {
+			*m = mode
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown callback mode %q", text)
+}
+
+// SetCallbackMode sets where the change callback and the event listeners of the specified configuration run.
+// With CallbackDispatch, the default, they run on the WatchForChanges goroutines, one change after the other.
+// With CallbackSync, they run on the monitoring goroutine in reload order once a change is decoded and has passed
+// the hooks, but before it is applied: the configuration still holds the old values, the event carries the new
+// ones, and a listener may reject the change with ChangeEvent.Veto. The next check waits for them, and
+// WatchForChanges only dispatches the tracking callback. Changes with nothing to apply, like a deleted file, are
+// delivered once recorded. With CallbackAsync, they are handed to a bounded worker pool, so slow work like
+// reopening database pools does not delay the next change; callbacks of successive changes may then run
+// concurrently and out of order, and handing them over waits while all workers are busy.
+func (cm *ConfigManager) SetCallbackMode(configName string, mode CallbackMode) error {
+	settings, ok := cm.configList.getSettings(configName)
+	if !ok {
+		return fmt.Errorf("config with name %s not found", configName)
+	}
+	settings.mu.Lock()
+	defer settings.mu.Unlock()
+	settings.callbackMode = mode
+	return nil
+}
+
+// SetCallbackWorkers sets the number of workers running the callbacks of configurations in CallbackAsync mode,
+// 4 by default. The pool is started by the first asynchronous callback; its size cannot be changed until it is
+// stopped with StopCallbackWorkers.
+func (cm *ConfigManager) SetCallbackWorkers(workers int) error {
+	if workers < 1 {
+		return fmt.Errorf("callback workers must be positive, got %d", workers)
+	}
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	if cm.callbackPool != nil {
+		return fmt.Errorf("callback pool is already running")
+	}
+	cm.callbackWorkers = workers
+	return nil
+}
+
+// callbacks returns the callback mode of the configuration.
+func (c *ConfigSettings) callbacks() CallbackMode {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.callbackMode
+}
+
+// syncCallbacks runs the callbacks of changes on the monitoring goroutine, see CallbackSync.
+type syncCallbacks interface {
+	runSyncCallbacks(event ChangeEvent)
+}
+
+// runSyncCallbacks implements syncCallbacks, running the change callback and the event listeners of the
+// configuration of the event.
+func (cm *ConfigManager) runSyncCallbacks(event ChangeEvent) {
+	cm.mu.RLock()
+	changeCallback := cm.changeCallbacks[event.ConfigName]
+	cm.mu.RUnlock()
+	if changeCallback != nil {
+		call := CallbackCall{ConfigName: event.ConfigName, Kind: CallbackKindChange, Event: &event}
+		cm.callCallback(call, func() { changeCallback(event.ConfigName) })
+	}
+	cm.publishEvent(event)
+}
+
+// runCallback runs a callback of the configuration according to its callback mode: on the worker pool in
+// CallbackAsync mode, on the calling goroutine otherwise.
+func (cm *ConfigManager) runCallback(settings *ConfigSettings, call CallbackCall, callback func()) {
+	if settings.callbacks() != CallbackAsync {
+		cm.callCallback(call, callback)
+		return
+	}
+	cm.workers().submit(func() { cm.callCallback(call, callback) })
+}
+
+// workers returns the callback pool, starting it on first use.
+func (cm *ConfigManager) workers() *callbackPool {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	if cm.callbackPool == nil {
+		workers := cm.callbackWorkers
+		if workers == 0 {
+			workers = defaultCallbackWorkers
+		}
+		cm.callbackPool = newCallbackPool(workers)
+	}
+	return cm.callbackPool
+}
+
+// StopCallbackWorkers stops the worker pool running the callbacks of configurations in CallbackAsync mode and waits
+// for the queued and running callbacks to return, or for ctx to be done, returning its error. The pool is also
+// stopped, without waiting, once the last configuration is removed. A later asynchronous callback starts a new pool.
+func (cm *ConfigManager) StopCallbackWorkers(ctx context.Context) error {
+	cm.mu.Lock()
+	pool := cm.callbackPool
+	cm.callbackPool = nil
+	cm.mu.Unlock()
+	if pool == nil {
+		return nil
+	}
+	pool.close()
+	select {
+	case <-pool.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// changeVeto collects the veto of a change delivered before it is applied, see ChangeEvent.Veto.
+type changeVeto struct {
+	mu     sync.Mutex // Mutex for synchronizing concurrent vetoes
+	reason error      // Reason of the first veto, if any
+	closed bool       // Flag indicating the change was decided, so vetoes are ignored
+}
+
+// set records a veto with reason unless one was recorded before or the change was decided.
+func (v *changeVeto) set(reason error) {
+	if reason == nil {
+		reason = errors.New("no reason given")
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if !v.closed && v.reason == nil {
+		v.reason = reason
+	}
+}
+
+// decide closes the veto and returns its reason, if any.
+func (v *changeVeto) decide() error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.closed = true
+	return v.reason
+}
+
+// callbackPool is a bounded pool of goroutines running callbacks.
+type callbackPool struct {
+	tasks   chan func()    // Callbacks waiting for a worker; closed once no submission is pending after close
+	stop    chan struct{}  // Channel closed by close, releasing submissions waiting for a worker
+	mu      sync.Mutex     // Mutex for synchronizing close with the start of submissions
+	closed  bool           // Flag indicating stop is closed
+	pending sync.WaitGroup // Submissions that may still send on tasks
+	done    chan struct{}  // Channel closed once all workers finished
+}
+
+// newCallbackPool starts a pool with the given number of workers.
+func newCallbackPool(workers int) *callbackPool {
+	p := &callbackPool{tasks: make(chan func(), workers), stop: make(chan struct{}), done: make(chan struct{})}
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for task := range p.tasks {
+				task()
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(p.done)
+	}()
+	return p
+}
+
+// submit hands a callback to the pool, waiting while all workers are busy and the queue is full. A callback
+// submitted to a closed pool, or still waiting when the pool is closed, runs on the calling goroutine.
+func (p *callbackPool) submit(task func()) {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		task()
+		return
+	}
+	p.pending.Add(1)
+	p.mu.Unlock()
+	defer p.pending.Done()
+
+	// The lock is not held while waiting, so close does not wait for a worker to become free.
+	select {
+	case p.tasks <- task:
+	case <-p.stop:
+		task()
+	}
+}
+
+// close stops the pool once the queued callbacks ran, without waiting for them.
+func (p *callbackPool) close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return
+	}
+	p.closed = true
+	close(p.stop)
+	go func() {
+		// Tasks is closed once no submission can send on it anymore.
+		p.pending.Wait()
+		close(p.tasks)
+	}()
+}
@@ -0,0 +1,189 @@
+package mkconf
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStopCallbackWorkers(t *testing.T) {
+	calls := make(chan string, 1)
+	release := make(chan struct{})
+	cm, dir := newStressManager(t, func(configName string) {
+		calls <- configName
+		<-release
+	})
+	if err := cm.SetCallbackMode("stress", CallbackAsync); err != nil {
+		t.Fatalf("SetCallbackMode: %v", err)
+	}
+
+	writeStressConfig(t, dir, 1)
+	if _, err := cm.CheckOnce("stress"); err != nil {
+		t.Fatalf("CheckOnce: %v", err)
+	}
+	waitForCall(t, calls)
+
+	// The running callback holds up the pool until it is released.
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := cm.StopCallbackWorkers(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("StopCallbackWorkers with a running callback = %v, want %v", err, context.DeadlineExceeded)
+	}
+	close(release)
+
+	// A later asynchronous callback starts a new pool.
+	writeStressConfig(t, dir, 2)
+	if _, err := cm.CheckOnce("stress"); err != nil {
+		t.Fatalf("CheckOnce: %v", err)
+	}
+	waitForCall(t, calls)
+	if err := cm.StopCallbackWorkers(context.Background()); err != nil {
+		t.Fatalf("StopCallbackWorkers: %v", err)
+	}
+	if err := cm.StopCallbackWorkers(context.Background()); err != nil {
+		t.Fatalf("StopCallbackWorkers of a stopped pool: %v", err)
+	}
+}
+
+func TestRemoveLastConfigStopsCallbackWorkers(t *testing.T) {
+	calls := make(chan string, 1)
+	cm, dir := newStressManager(t, func(configName string) { calls <- configName })
+	if err := cm.SetCallbackMode("stress", CallbackAsync); err != nil {
+		t.Fatalf("SetCallbackMode: %v", err)
+	}
+	writeStressConfig(t, dir, 1)
+	if _, err := cm.CheckOnce("stress"); err != nil {
+		t.Fatalf("CheckOnce: %v", err)
+	}
+	waitForCall(t, calls)
+
+	cm.mu.RLock()
+	pool := cm.callbackPool
+	cm.mu.RUnlock()
+	if pool == nil {
+		t.Fatal("callback pool not started")
+	}
+	if err := cm.RemoveConfig("stress"); err != nil {
+		t.Fatalf("RemoveConfig: %v", err)
+	}
+	select {
+	case <-pool.done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("callback pool still running after the last configuration was removed")
+	}
+}
+
+func TestCallbackSyncRunsBeforeApply(t *testing.T) {
+	var seen []interface{}
+	var cm *ConfigManager
+	cm, dir := newStressManager(t, func(configName string) {
+		version, _ := cm.Get(configName, "version")
+		seen = append(seen, version)
+	})
+	if err := cm.SetCallbackMode("stress", CallbackSync); err != nil {
+		t.Fatalf("SetCallbackMode: %v", err)
+	}
+	var events []ChangeEvent
+	cm.ChangeEventFunc("stress", func(event ChangeEvent) { events = append(events, event) })
+
+	writeStressConfig(t, dir, 1)
+	if changed, err := cm.CheckOnce("stress"); err != nil || !changed {
+		t.Fatalf("CheckOnce = %v, %v, want true", changed, err)
+	}
+	if len(seen) != 1 || seen[0] != 0 {
+		t.Fatalf("change callback saw versions %v, want the old version [0]", seen)
+	}
+	if len(events) != 1 || events[0].NewSnapshot["version"] != float64(1) || events[0].OldSnapshot["version"] != float64(0) {
+		t.Fatalf("got events %+v, want one event from version 0 to 1", events)
+	}
+	if version, err := cm.Get("stress", "version"); err != nil || version != 1 {
+		t.Fatalf("Get version after the callbacks = %v, %v, want 1", version, err)
+	}
+}
+
+func TestCallbackSyncVeto(t *testing.T) {
+	cm, dir := newStressManager(t, nil)
+	if err := cm.SetCallbackMode("stress", CallbackSync); err != nil {
+		t.Fatalf("SetCallbackMode: %v", err)
+	}
+	var applied []ChangeEvent
+	cm.ChangeEventFunc("stress", func(event ChangeEvent) {
+		if event.NewSnapshot["version"] == float64(2) {
+			event.Veto(errors.New("version 2 is broken"))
+		}
+		applied = append(applied, event)
+	})
+
+	writeStressConfig(t, dir, 2)
+	changed, err := cm.CheckOnce("stress")
+	if !errors.Is(err, ErrChangeVetoed) || changed {
+		t.Fatalf("CheckOnce of a vetoed change = %v, %v, want an error wrapping %v", changed, err, ErrChangeVetoed)
+	}
+	if !strings.Contains(err.Error(), "version 2 is broken") {
+		t.Fatalf("error %q does not name the reason of the veto", err)
+	}
+	if version, _ := cm.Get("stress", "version"); version != 0 {
+		t.Fatalf("Get version after a veto = %v, want 0", version)
+	}
+
+	writeStressConfig(t, dir, 3)
+	if changed, err := cm.CheckOnce("stress"); err != nil || !changed {
+		t.Fatalf("CheckOnce = %v, %v, want true", changed, err)
+	}
+	if version, _ := cm.Get("stress", "version"); version != 3 {
+		t.Fatalf("Get version = %v, want 3", version)
+	}
+
+	// Events of applied changes ignore vetoes.
+	applied[len(applied)-1].Veto(errors.New("too late"))
+	if version, _ := cm.Get("stress", "version"); version != 3 {
+		t.Fatalf("Get version after a late veto = %v, want 3", version)
+	}
+}
+
+func TestCallbackPoolCloseWithFullQueue(t *testing.T) {
+	pool := newCallbackPool(1)
+	release := make(chan struct{})
+	running := make(chan struct{})
+	pool.submit(func() {
+		close(running)
+		<-release
+	})
+	<-running
+	pool.submit(func() {}) // Fills the queue while the worker is busy.
+
+	ran := make(chan struct{})
+	submitted := make(chan struct{})
+	go func() {
+		pool.submit(func() { close(ran) })
+		close(submitted)
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	closed := make(chan struct{})
+	go func() {
+		pool.close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("close waited for a submission blocked on a full queue")
+	}
+	// The blocked submission runs its callback on its own goroutine instead.
+	select {
+	case <-ran:
+	case <-time.After(5 * time.Second):
+		t.Fatal("callback of the blocked submission did not run")
+	}
+	<-submitted
+
+	close(release)
+	select {
+	case <-pool.done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("pool did not finish the queued callbacks")
+	}
+}
@@ -0,0 +1,169 @@
+package mkconf
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"sync"
+
+	reader "mkconf/readers"
+)
+
+// SearchMode selects how the candidate files of a configuration added with AddConfigCandidates are used.
+type SearchMode int
+
+const (
+	SearchFirst    SearchMode = iota // The first candidate that exists is used
+	SearchMergeAll                   // All candidates that exist are merged in order, later files taking precedence
+)
+
+// String returns the name of the search mode.
+func (m SearchMode) String() string {
+	switch m {
+	case SearchFirst:
+		return "first"
+	case SearchMergeAll:
+		return "merge-all"
+	}
+	return fmt.Sprintf("SearchMode(%d)", int(m))
+}
+
+// candidatesFS presents the candidate files of a configuration that exist as a single configuration file.
+type candidatesFS struct {
+	paths    []string      // Candidate paths in search order
+	mode     SearchMode    // How the existing candidates are used
+	reader   reader.Reader // Reader of the configuration type; a reader.StreamWriter with SearchMergeAll
+	loaded   []string      // Candidates the configuration was last read from
+	loadedMu sync.Mutex    // Mutex for synchronizing access to loaded
+	valueOrigins
+}
+
+// firstCandidateFS is a candidatesFS using the first existing candidate, which is written on updates.
+type firstCandidateFS struct {
+	*candidatesFS
+}
+
+// loadedFiler is implemented by config sources read from files that change over time, telling which were read.
+type loadedFiler interface {
+	loadedFiles() []string
+}
+
+// AddConfigCandidates adds a configuration looked up in several candidate files, e.g. a local file, then one in
+// the user's config directory, then one in /etc:
+//
+//	cm.AddConfigCandidates("app", []string{"app.yaml", home + "/.config/app/app.yaml", "/etc/app/app.yaml"}, mkconf.SearchFirst, &cfg)
+//
+// With SearchFirst, the first candidate that exists is used; all candidates must be of the same config type, and
+// updates are written to the file in use, or to the first candidate if none exists. With SearchMergeAll, every
+// candidate that exists is merged in order, later files taking precedence, as in AddMergedConfig; the candidates
+// may be of any format with a stream reader, and the configuration is read-only. The candidates are searched on
+// every read, so change monitoring picks up candidates that are created or removed. The config type is that of
+// the first candidate. LoadedFiles of the settings reports the files actually read.
+func (cm *ConfigManager) AddConfigCandidates(configName string, paths []string, mode SearchMode, configInterface interface{}) error {
+	if len(paths) == 0 {
+		return fmt.Errorf("config %v: no candidate files", configName)
+	}
+	configType := fileConfigType(paths[0])
+	configReader := (&ConfigSettings{configType: configType}).checkReader()
+	c := &candidatesFS{paths: append([]string(nil), paths...), mode: mode, reader: configReader}
+
+	switch mode {
+	case SearchFirst:
+		if configReader == nil {
+			return fmt.Errorf("config %v: config type %v is not supported", configName, configType)
+		}
+		for _, path := range paths[1:] {
+			if fileConfigType(path) != configType {
+				return fmt.Errorf("config %v: candidate %v is not of config type %v", configName, path, configType)
+			}
+		}
+		return cm.AddConfigFS(firstCandidateFS{c}, configName, "", configType, configInterface)
+	case SearchMergeAll:
+		_, canRead := configReader.(reader.StreamReader)
+		_, canWrite := configReader.(reader.StreamWriter)
+		if !canRead || !canWrite {
+			return fmt.Errorf("config %v: merging is not supported for config type %v", configName, configType)
+		}
+		return cm.AddConfigFS(c, configName, "", configType, configInterface)
+	}
+	return fmt.Errorf("config %v: unknown search mode %v", configName, mode)
+}
+
+// LoadedFiles returns the paths of the files the configuration was last read from: the candidates in use for
+// configurations added with AddConfigCandidates, otherwise the configuration file.
+func (c *ConfigSettings) LoadedFiles() []string {
+	if filer, ok := c.fsys.(loadedFiler); ok {
+		return filer.loadedFiles()
+	}
+	return []string{c.configFullPath}
+}
+
+// Open implements fs.FS. Every name resolves to the existing candidates.
+func (c *candidatesFS) Open(name string) (fs.File, error) {
+	var existing []string
+	for _, path := range c.paths {
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			existing = append(existing, path)
+		}
+	}
+	if len(existing) == 0 {
+		c.setLoaded(nil)
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fmt.Errorf("none of the candidates exists: %w", fs.ErrNotExist)}
+	}
+
+	if c.mode == SearchFirst {
+		content, err := ioutil.ReadFile(existing[0])
+		if err != nil {
+			return nil, err
+		}
+		c.setLoaded(existing[:1])
+		return newRemoteFile(name, content), nil
+	}
+
+	values := make(map[string]interface{})
+	origins := make(map[string]string)
+	for _, path := range existing {
+		fileValues, err := FileLayer{Path: path}.Load()
+		if err != nil {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: fmt.Errorf("candidate %v: %v", path, err)}
+		}
+		mergeValues(values, fileValues)
+		collectOrigins(fileValues, "", "file "+path, origins)
+	}
+	c.setOrigins(origins)
+	c.setLoaded(existing)
+
+	var b bytes.Buffer
+	if err := c.reader.(reader.StreamWriter).WriteConfigTo(&b, values); err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	return newRemoteFile(name, b.Bytes()), nil
+}
+
+// WriteFile implements reader.WriteFileFS, writing the candidate in use, or the first candidate if none exists.
+func (c firstCandidateFS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	path := c.paths[0]
+	for _, candidate := range c.paths {
+		if info, err := os.Stat(candidate); err == nil && !info.IsDir() {
+			path = candidate
+			break
+		}
+	}
+	return ioutil.WriteFile(path, data, perm)
+}
+
+// setLoaded records the candidates the configuration was read from.
+func (c *candidatesFS) setLoaded(paths []string) {
+	c.loadedMu.Lock()
+	defer c.loadedMu.Unlock()
+	c.loaded = append([]string(nil), paths...)
+}
+
+// loadedFiles implements loadedFiler.
+func (c *candidatesFS) loadedFiles() []string {
+	c.loadedMu.Lock()
+	defer c.loadedMu.Unlock()
+	return append([]string(nil), c.loaded...)
+}
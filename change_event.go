@@ -0,0 +1,121 @@
+package mkconf
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Reasons of a ChangeEvent.
+const (
+	ReasonContent   = "content"  // The content of the configuration changed
+	ReasonFileEvent = "file"     // The file was deleted, renamed, truncated or recreated; the file event is the first change
+	ReasonApproved  = "approved" // A held change was approved with ApproveChange
+)
+
+// ChangeEvent describes an applied change of a configuration, or one about to be applied in CallbackSync mode, so
+// callbacks need not fetch and diff the configuration themselves. Snapshots hold the values as encoded by JSON,
+// like SnapshotHash.
+type ChangeEvent struct {
+	ConfigName  string                 // Name of the configuration
+	OldSnapshot map[string]interface{} // Values before the change
+	NewSnapshot map[string]interface{} // Values after the change
+	Changes     []ConfigChangeLog      // Changed values; the tracked changes if change tracking is enabled
+	Timestamp   time.Time              // Time the change was applied
+	Reason      string                 // Reason of the change, e.g. ReasonContent
+
+	veto *changeVeto // Veto of a change not applied yet, see Veto
+}
+
+// Veto rejects the change of the event with the given reason. It only takes effect while the listeners of a
+// configuration in CallbackSync mode run, as they receive the event before the change is applied; the change is then
+// rejected like by a ConfigHook, with an error wrapping ErrChangeVetoed. Events of applied changes ignore it.
+func (e ChangeEvent) Veto(reason error) {
+	if e.veto != nil {
+		e.veto.set(reason)
+	}
+}
+
+// delivered reports whether the event was delivered to the callbacks before its change was applied, see CallbackSync.
+func (e ChangeEvent) delivered() bool {
+	return e.veto != nil
+}
+
+// ChangeEventFunc is a function type used for change callbacks receiving a ChangeEvent.
+type ChangeEventFunc func(event ChangeEvent)
+
+// ChangeEventFunc sets a change callback receiving a ChangeEvent for every applied change of a specific
+// configuration, dispatched by WatchForChanges like the callback set with ChangeCallbackFunc. A nil callback
+// removes it. See Subscribe to add more listeners.
+func (cm *ConfigManager) ChangeEventFunc(configName string, callback ChangeEventFunc) {
+	cm.mu.Lock()
+	if callback == nil {
+		delete(cm.eventCallbacks, configName)
+	} else {
+		cm.eventCallbacks[configName] = callback
+	}
+	cm.mu.Unlock()
+	cm.updateEvents(configName)
+}
+
+// enableEvents enables or disables building a ChangeEvent for every applied change, taking the snapshot of v
+// the first event starts from.
+func (c *ConfigSettings) enableEvents(enabled bool, v interface{}) {
+	c.eventsEnabled = enabled
+	c.snapshot = nil
+	if enabled {
+		c.snapshot = snapshotValues(v)
+	}
+}
+
+// changeEventsEnabled reports whether a ChangeEvent is built for every applied change of the configuration.
+func (c *ConfigSettings) changeEventsEnabled() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.eventsEnabled
+}
+
+// refreshSnapshot takes the snapshot of v applied without an event, e.g. by LoadConfig, if events are enabled.
+func (c *ConfigSettings) refreshSnapshot(v interface{}) {
+	if c.eventsEnabled {
+		c.snapshot = snapshotValues(v)
+	}
+}
+
+// changeEvent returns the event of a change applied to v, updating the snapshot if events are enabled. If changes
+// are not tracked, they are computed from the snapshots.
+func (c *ConfigSettings) changeEvent(v interface{}, reason string, changes []ConfigChangeLog) ChangeEvent {
+	event := c.previewEvent(v, reason, changes)
+	if c.eventsEnabled {
+		c.snapshot = event.NewSnapshot
+	}
+	return event
+}
+
+// previewEvent returns the event of a change of the configuration to v like changeEvent, without updating the
+// snapshot, so the change can still be rejected.
+func (c *ConfigSettings) previewEvent(v interface{}, reason string, changes []ConfigChangeLog) ChangeEvent {
+	event := ChangeEvent{ConfigName: c.configName, Changes: changes, Timestamp: time.Now(), Reason: reason}
+	if !c.eventsEnabled {
+		return event
+	}
+	event.OldSnapshot = c.snapshot
+	event.NewSnapshot = snapshotValues(v)
+	if !c.enableChangeTracking && event.OldSnapshot != nil && event.NewSnapshot != nil {
+		compareFields(c.configName, event.OldSnapshot, event.NewSnapshot, &event.Changes)
+		c.redactChanges(event.Changes)
+	}
+	return event
+}
+
+// snapshotValues returns the values of v as encoded by JSON, or nil if they do not encode as a JSON object.
+func snapshotValues(v interface{}) map[string]interface{} {
+	data, err := json.Marshal(jsonCompatible(v))
+	if err != nil {
+		return nil
+	}
+	var values map[string]interface{}
+	if err := json.Unmarshal(data, &values); err != nil {
+		return nil
+	}
+	return values
+}
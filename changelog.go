@@ -8,11 +8,15 @@ import (
 
 // ConfigChangeLog represents a log entry capturing changes in configuration fields.
 type ConfigChangeLog struct {
-	ConfigName string      // Name of the configuration.
-	FieldName  string      // Name of the field that changed.
-	OldValue   interface{} // Previous value of the field.
-	NewValue   interface{} // New value of the field.
-	Timestamp  time.Time   // Timestamp of when the change occurred.
+	ConfigName string         // Name of the configuration.
+	FieldName  string         // Name of the field that changed.
+	OldValue   interface{}    // Previous value of the field.
+	NewValue   interface{}    // New value of the field.
+	Timestamp  time.Time      // Timestamp of when the change occurred.
+	Reason     string         // Reason code of a remote change that was rejected, e.g. RejectReplayed; empty for applied changes.
+	Source     string         // Origin of the change: "env" for environment overrides and "flag" for flags, including removed ones; empty for the configuration source.
+	Impacts    []ChangeImpact // Consequences of the change registered with SetImpact; nil if none.
+	Event      string         // File event, e.g. FileDeleted, with the old and new path of the file as values; empty for value changes.
 }
 
 // compareFields compares two configurations represented as maps and records changes.
@@ -71,23 +75,72 @@ func compareFields(configName string, oldConfig, newConfig interface{}, changes
 	return nil
 }
 
+// changeSink receives the tracked changes of configurations, e.g. to send notifications.
+// publishChanges is called without locks held and must not block.
+type changeSink interface {
+	publishChanges(configName string, changes []ConfigChangeLog)
+}
+
 // logChanges records the changes in the configuration log for a specific configuration.
-// It acquires a lock to ensure thread safety during the log update.
+// It acquires a lock to ensure thread safety during the log update and notifies the sinks and the tracking channel after releasing it.
 func (c *ConfigList) logChanges(configName string, changes []ConfigChangeLog) {
+	c.recordChanges(configName, changes)
+
+	if settings, ok := c.getSettings(configName); ok {
+		settings.deliverName(settings.Ch_ConfigTracking, configName)
+	}
+}
+
+// recordChanges appends the changes to the log of a configuration and publishes them to the sinks,
+// without notifying the tracking channel.
+func (c *ConfigList) recordChanges(configName string, changes []ConfigChangeLog) {
 	c.logMutex.Lock()
-	defer c.logMutex.Unlock()
+	changes = c.annotateImpacts(configName, changes)
 	c.changeLogs[configName] = append(c.changeLogs[configName], changes...)
-	c.settings[configName].Ch_ConfigTracking <- configName
+	sinks := c.changeSinks
+	c.logMutex.Unlock()
+
+	if len(changes) > 0 {
+		for _, sink := range sinks {
+			sink.publishChanges(configName, changes)
+		}
+	}
+}
+
+// addChangeSink registers a sink receiving the tracked changes of all configurations.
+func (c *ConfigList) addChangeSink(sink changeSink) {
+	c.logMutex.Lock()
+	defer c.logMutex.Unlock()
+	c.changeSinks = append(c.changeSinks, sink)
+}
+
+// removeChangeSink unregisters a sink.
+func (c *ConfigList) removeChangeSink(sink changeSink) {
+	c.logMutex.Lock()
+	defer c.logMutex.Unlock()
+	sinks := make([]changeSink, 0, len(c.changeSinks))
+	for _, s := range c.changeSinks {
+		if s != sink {
+			sinks = append(sinks, s)
+		}
+	}
+	c.changeSinks = sinks
 }
 
-// GetLogChanges retrieves the log of changes for a specific configuration.
+// GetLogChanges retrieves a copy of the log of changes for a specific configuration.
 func (c *ConfigList) GetLogChanges(configName string) []ConfigChangeLog {
-	return c.changeLogs[configName]
+	c.logMutex.Lock()
+	defer c.logMutex.Unlock()
+	return append([]ConfigChangeLog(nil), c.changeLogs[configName]...)
 }
 
 // GetChanLogChanges retrieves the channel for tracking changes for a specific configuration.
 func (c *ConfigList) GetChanLogChanges(configName string) chan string {
-	return c.settings[configName].Ch_ConfigTracking
+	settings, ok := c.getSettings(configName)
+	if !ok {
+		return nil
+	}
+	return settings.Ch_ConfigTracking
 }
 
 // ClearAllChangeLogs clears all change logs in the ConfigList.
@@ -2,63 +2,188 @@ package mkconf
 
 import (
 	"context"
-	"crypto/md5"
-	"encoding/hex"
 	"fmt"
-	"io/ioutil"
-	"sync"
 	"time"
 )
 
+// MonitorState is the lifecycle state of the change monitoring of a configuration.
+// Monitoring moves from MonitorIdle to MonitorRunning when started, to MonitorStopping when canceled
+// and back to MonitorIdle once its goroutine finished, so it can be started and stopped repeatedly.
+type MonitorState int
+
+const (
+	MonitorIdle     MonitorState = iota // Monitoring is not running
+	MonitorRunning                      // The monitoring goroutine is checking for changes
+	MonitorStopping                     // Monitoring was canceled and its goroutine is finishing
+)
+
+// String returns the name of the monitoring state.
+func (s MonitorState) String() string {
+	switch s {
+	case MonitorIdle:
+		return "idle"
+	case MonitorRunning:
+		return "running"
+	case MonitorStopping:
+		return "stopping"
+	}
+	return fmt.Sprintf("MonitorState(%d)", int(s))
+}
+
+// MarshalText implements encoding.TextMarshaler, so the state is encoded by name.
+func (s MonitorState) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// UnmarshalText decodes a state encoded by MarshalText, e.g. in the status of an attached manager.
+func (s *MonitorState) UnmarshalText(text []byte) error {
+	for _, state := range []MonitorState{MonitorIdle, MonitorRunning, MonitorStopping} {
+		if string(text) == state.String() {
+			*s = state
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown monitor state %q", text)
+}
+
 // StartChangeMonitoring initiates monitoring for changes in the specified configuration.
-// It sets up a goroutine that periodically checks for configuration changes and triggers notifications.
-// The monitoring continues until the associated context is canceled or the quit signal is received.
+// It sets up a goroutine (or schedules the configuration on the watcher pool, if set) that periodically
+// checks for configuration changes and triggers notifications.
+// The monitoring continues until it is stopped or the configuration is removed.
+// Monitoring that is already running for the configuration is stopped first, so it is restarted.
 // Returns an error if the configuration is not found.
 func (c *ConfigList) StartChangeMonitoring(configName string, v interface{}) error {
-	quit := make(chan struct{})
-	settings, ok := c.settings[configName]
+	return c.StartChangeMonitoringContext(context.Background(), configName, v)
+}
+
+// StartChangeMonitoringContext is like StartChangeMonitoring, tying the monitoring to ctx: once ctx is done, the
+// monitoring is stopped as with StopChangeMonitoring. Returns the error of ctx if it is done already.
+func (c *ConfigList) StartChangeMonitoringContext(parent context.Context, configName string, v interface{}) error {
+	settings, ok := c.getSettings(configName)
 	if !ok {
 		return fmt.Errorf("config not found: %s", configName)
 	}
-	c.settings[configName].enableChangeValidation = true
-	settings.ctx, settings.cancel = context.WithCancel(context.Background())
-	settings.waitGroup.Add(1)
+	if err := parent.Err(); err != nil {
+		return fmt.Errorf("monitoring config %s: %w", configName, err)
+	}
+	c.settingsMutex.Lock()
+	passive, fileNotify, pollJitter := c.passive, c.fileNotify, c.pollJitter
+	c.settingsMutex.Unlock()
+	if passive {
+		return fmt.Errorf("monitoring config %s: %w", configName, ErrPassiveMode)
+	}
+	pool := c.watcherPool()
+
+	// Another Start may win the race between stopping and locking; stop again until the monitor is idle.
+	for {
+		c.stopMonitor(settings)
+		settings.mu.Lock()
+		if settings.monitorState == MonitorIdle {
+			break
+		}
+		settings.mu.Unlock()
+	}
+
+	ctx, cancel := context.WithCancel(parent)
+	done := make(chan struct{})
+	settings.enableChangeValidation = true
+	settings.ctx, settings.cancel = ctx, cancel
+	settings.monitorParent = parent
+	settings.monitorDone = done
+	settings.monitorState = MonitorRunning
+	checkSec := settings.checkSec
+	firstInterval := time.Second * time.Duration(checkSec)
+	if settings.adaptiveMax > 0 {
+		firstInterval = settings.adaptiveMin
+	}
+	startDelay := jitterPart(pollJitter, firstInterval)
+	filePath := settings.configFullPath
+	fileNotify = fileNotify && settings.fsys == nil
+	c.resources.acquire(configName, resourceMonitorContext)
+	if parent.Done() != nil {
+		go c.stopMonitorWith(settings, parent, done)
+	}
+
+	if pool != nil {
+		entry := &watchEntry{configName: configName, v: v, interval: time.Second * time.Duration(checkSec), ctx: ctx, done: done}
+		remove := pool.add(entry, startDelay)
+		settings.cancel = func() {
+			cancel()
+			remove()
+		}
+		settings.mu.Unlock()
+		return nil
+	}
+	settings.mu.Unlock()
+	c.resources.acquire(configName, resourceMonitorGoroutine)
 
 	go func() {
-		defer settings.waitGroup.Done()
-		mu := &sync.Mutex{}
+		defer close(done)
+		defer c.resources.release(configName, resourceMonitorGoroutine)
 
-		for {
+		var fileEvents <-chan struct{}
+		var subscription *fileSubscription
+		if fileNotify {
+			var err error
+			subscription, err = c.notifier.subscribe(filePath)
+			if err != nil {
+				c.reportError(fmt.Errorf("monitoring: file notifications unavailable for config %v, polling: %w", configName, err))
+			} else {
+				defer subscription.close()
+				fileEvents = subscription.events
+			}
+		}
+
+		if fileEvents == nil && startDelay > 0 {
+			// Monitors started together spread their first checks like the later ones, see SetPollJitter.
+			timer := time.NewTimer(startDelay)
 			select {
 			case <-settings.ch_ChangeValidation:
-				close(quit)
+				timer.Stop()
 				return
-			case <-settings.ctx.Done():
-				close(quit)
+			case <-ctx.Done():
+				timer.Stop()
 				return
-			default:
-				err := func() error {
-					mu.Lock()
-					defer mu.Unlock()
-
-					err := c.checkConfigChanges(configName, v)
-					if err != nil {
-						fmt.Printf("monitoring: error checking config changes %v : %v\n", configName, err)
-						time.Sleep(time.Second * 10)
-					}
-
-					return err
-				}()
-
-				if err != nil {
-					continue
-				}
+			case <-timer.C:
+			}
+		}
 
-				select {
-				case <-time.After(time.Second * time.Duration(settings.checkSec)):
-				case <-quit:
+		for {
+			wait := time.Second * time.Duration(checkSec)
+			if fileEvents != nil && wait < notifyFallbackInterval {
+				wait = notifyFallbackInterval
+			}
+			if err := c.checkConfigChanges(configName, v); err != nil {
+				if _, ok := c.getSettings(configName); !ok {
+					// The configuration was removed; RemoveConfig is waiting for the goroutine to finish.
 					return
 				}
+				c.reportError(fmt.Errorf("monitoring: error checking config changes %v: %w", configName, err))
+				wait = time.Second * 10
+			} else {
+				if fileEvents == nil {
+					wait = c.jitter(settings.pollInterval(wait))
+				}
+				if debounce := settings.debounceWait(); debounce > 0 && debounce < wait {
+					wait = debounce
+				}
+			}
+
+			timer := time.NewTimer(wait)
+			select {
+			case <-settings.ch_ChangeValidation:
+				timer.Stop()
+				return
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-fileEvents:
+				timer.Stop()
+			case <-timer.C:
+			}
+			if subscription != nil {
+				// Symlinks may point elsewhere now, e.g. after a ConfigMap update; follow them before checking.
+				subscription.refresh()
 			}
 		}
 	}()
@@ -68,74 +193,324 @@ func (c *ConfigList) StartChangeMonitoring(configName string, v interface{}) err
 // StopChangeMonitoring stops the change monitoring for the specified configuration.
 // It cancels the associated context, waits for the goroutine to finish, and disables change validation.
 func (c *ConfigList) StopChangeMonitoring(configName string) {
-	if settings, ok := c.settings[configName]; ok {
+	settings, ok := c.getSettings(configName)
+	if !ok {
+		return
+	}
+	c.stopMonitor(settings)
+
+	settings.mu.Lock()
+	settings.enableChangeValidation = false
+	settings.mu.Unlock()
+	c.reportLingering(configName, "StopChangeMonitoring", resourceMonitorGoroutine, resourceMonitorContext)
+}
+
+// stopMonitorWith stops the monitoring started with done once parent is done, unless it was stopped before.
+// A monitoring restarted in between is left running.
+func (c *ConfigList) stopMonitorWith(settings *ConfigSettings, parent context.Context, done chan struct{}) {
+	select {
+	case <-parent.Done():
+	case <-done:
+		// The goroutine also finishes when parent is done; only then is the monitoring still to be stopped.
+		if parent.Err() == nil {
+			return
+		}
+	}
+	if c.stopMonitorDone(settings, done) {
+		settings.mu.Lock()
+		if settings.monitorState == MonitorIdle {
+			settings.enableChangeValidation = false
+		}
+		settings.mu.Unlock()
+	}
+}
+
+// stopMonitor moves the monitoring of the configuration to MonitorIdle: a running monitor is canceled,
+// and the call waits for the goroutine of a running or stopping monitor to finish.
+func (c *ConfigList) stopMonitor(settings *ConfigSettings) {
+	c.stopMonitorDone(settings, nil)
+}
+
+// stopMonitorDone is like stopMonitor, but only stops the monitoring started with done, or any if done is nil.
+// It returns whether it stopped that monitoring.
+func (c *ConfigList) stopMonitorDone(settings *ConfigSettings, expected chan struct{}) bool {
+	settings.mu.Lock()
+	if expected != nil && settings.monitorDone != expected {
+		settings.mu.Unlock()
+		return false
+	}
+	switch settings.monitorState {
+	case MonitorIdle:
+		settings.mu.Unlock()
+		return false
+	case MonitorRunning:
 		settings.cancel()
-		settings.waitGroup.Wait()
-		c.settings[configName].enableChangeValidation = false
+		settings.monitorState = MonitorStopping
+	}
+	done := settings.monitorDone
+	settings.mu.Unlock()
+
+	<-done
+
+	settings.mu.Lock()
+	defer settings.mu.Unlock()
+	// Only one of the concurrent stoppers completes the transition.
+	if settings.monitorState == MonitorStopping && settings.monitorDone == done {
+		settings.monitorState = MonitorIdle
+		settings.ctx, settings.cancel, settings.monitorDone, settings.monitorParent = nil, nil, nil, nil
+		c.resources.release(settings.configName, resourceMonitorContext)
+	}
+	return true
+}
+
+// MonitorState returns the state of the change monitoring of the specified configuration.
+func (c *ConfigList) MonitorState(configName string) MonitorState {
+	settings, ok := c.getSettings(configName)
+	if !ok {
+		return MonitorIdle
 	}
+	settings.mu.Lock()
+	defer settings.mu.Unlock()
+	return settings.monitorState
 }
 
 // checkConfigChanges checks for changes in the configuration file and triggers updates accordingly.
-// It calculates the hash of the file content, compares it with the last recorded hash,
-// and reads the configuration file if a change is detected.
+// It reads the file once, compares the hash of its content with the last recorded hash,
+// and decodes the same content if a change is detected.
 // If change tracking is enabled, it logs the changes.
 // Finally, it updates the configuration settings and notifies listeners of the changes.
 // Returns an error if there is an issue reading the configuration or calculating the hash.
 func (c *ConfigList) checkConfigChanges(configName string, v interface{}) error {
-	if c.settings[configName].enableChangeValidation {
-		var configMap map[string]interface{}
-		var err error
-		hash, err := c.settings[configName].calculateFileHash(c.settings[configName].configFullPath)
-		if err != nil {
-			return err
+	settings, ok := c.getSettings(configName)
+	if !ok {
+		return fmt.Errorf("config not found: %s", configName)
+	}
+
+	changed, tracking, event, err := c.applyConfigChanges(settings, v, false)
+	if err != nil || !changed {
+		return err
+	}
+
+	if event.delivered() || c.syncCallbacks != nil && settings.callbacks() == CallbackSync {
+		if !event.delivered() {
+			c.syncCallbacks.runSyncCallbacks(event)
+		}
+		if tracking {
+			c.logChanges(configName, event.Changes)
 		}
+		return nil
+	}
+
+	if tracking {
+		c.logChanges(configName, event.Changes)
+	}
 
-		c.settings[configName].mu.Lock()
-		defer c.settings[configName].mu.Unlock()
+	if settings.delivery() == DeliverBlock {
+		select {
+		case settings.Ch_ConfigChanged <- configName:
+		case settings.Ch_ConfigTracking <- configName:
+		case <-settings.ch_ChangeValidation:
+		}
+	} else {
+		settings.deliverName(settings.Ch_ConfigChanged, configName)
+	}
 
-		if hash != c.settings[configName].lastConfigHash {
-			err := c.settings[configName].Reader.ReadConfig(c.settings[configName].configFullPath, &v)
-			if err != nil {
-				return err
+	if settings.changeEventsEnabled() {
+		settings.deliverEvent(event)
+	}
+
+	return nil
+}
+
+// applyConfigChanges applies the content of the configuration file to v if it changed since it was last applied,
+// like checkConfigChanges, without logging the changes or notifying listeners. Unless force is set, nothing is
+// checked while change monitoring is disabled. It returns whether the content was applied, whether changes are
+// tracked, and the event of the change. In CallbackSync mode, the callbacks run before the content is applied, and
+// the returned event reports whether they did, see ChangeEvent.delivered.
+func (c *ConfigList) applyConfigChanges(settings *ConfigSettings, v interface{}, force bool) (bool, bool, ChangeEvent, error) {
+	// The settings lock is released before reporting anomalies, so callbacks may safely call back into the manager.
+	var anomaly *ConfigAnomaly
+	var pending *pendingChange
+	var onAnomaly func(anomaly ConfigAnomaly)
+	var event *ConfigChangeLog
+	var present bool
+	reason := ReasonContent
+	configName := settings.configName
+	changed, tracking, changes, err := func() (bool, bool, []ConfigChangeLog, error) {
+		settings.mu.Lock()
+		defer settings.mu.Unlock()
+
+		if !settings.enableChangeValidation && !force {
+			return false, false, nil, nil
+		}
+
+		var gone bool
+		if event, gone = settings.checkFile(); gone {
+			return false, false, nil, nil
+		}
+		present = true
+
+		// The file is read once: hashing, decoding and the map conversion all work on the same content.
+		content, err := settings.source().ReadSourceFile(settings.configFullPath)
+		if err != nil {
+			return false, false, nil, err
+		}
+		hash := settings.hashContent(content)
+		settings.markRead(false)
+		if hash == settings.lastConfigHash {
+			settings.debounceHash = ""
+			return false, false, nil, nil
+		}
+		if settings.debouncing(hash) {
+			return false, false, nil, nil
+		}
+		settings.debounceHash = ""
+		if hash == settings.approvedHash {
+			reason = ReasonApproved
+		} else {
+			var held bool
+			if held, anomaly = settings.checkAnomaly(hash, content); anomaly != nil {
+				onAnomaly = settings.anomalyGuard.OnAnomaly
 			}
-			if c.settings[configName].enableChangeTracking {
-				changes := make([]ConfigChangeLog, 0)
-				configMap, err = c.settings[configName].convertToMap(c.settings[configName].configFullPath)
-				compareFields(configName, c.settings[configName].configMAP, configMap, &changes)
-				c.logChanges(configName, changes)
-				if err != nil {
-					return fmt.Errorf("monitoring: error v is not of type map[string]interface{}")
-				}
+			if held || settings.requireApproval {
+				settings.pendingHash = hash
+				return false, false, nil, nil
 			}
-			set := c.settings[configName]
-			set.config = &v
-			set.configMAP = configMap
-			set.lastConfigHash = hash
-			c.settings[configName] = set
+		}
 
-			select {
-			case c.settings[configName].Ch_ConfigChanged <- configName:
-			case c.settings[configName].Ch_ConfigTracking <- configName:
+		newMap, mapErr := settings.contentToMap(settings.configFullPath, content)
+		if mapErr == nil {
+			if err := settings.checkMapCoercions(newMap, v); err != nil {
+				c.quarantineRejected(settings, content, err)
+				return false, false, nil, err
+			}
+		}
+		apply, decoded, err := settings.decodeContentValue(settings.configFullPath, content, v)
+		if err != nil {
+			c.quarantineRejected(settings, content, err)
+			return false, false, nil, err
+		}
+		beforeApply := c.syncCallbacks != nil && settings.callbackMode == CallbackSync
+		if !beforeApply {
+			apply()
+		}
+
+		changes := make([]ConfigChangeLog, 0)
+		configMap := settings.configMAP
+		if settings.enableChangeTracking {
+			if mapErr != nil {
+				return false, false, nil, fmt.Errorf("monitoring: error v is not of type map[string]interface{}")
+			}
+			configMap = newMap
+			settings.pinMap(settings.configMAP, configMap)
+			compareFields(configName, settings.configMAP, configMap, &changes)
+			settings.redactChanges(changes)
+			changes = append(changes, settings.takeEnvChanges()...)
+			changes = append(changes, settings.takePinChanges()...)
+		}
+
+		if beforeApply {
+			if event != nil {
+				changes, reason = append([]ConfigChangeLog{*event}, changes...), ReasonFileEvent
 			}
+			pending = &pendingChange{
+				apply: apply, hash: hash, content: content, configMap: configMap, lastHash: settings.lastConfigHash,
+				event: settings.previewEvent(decoded, reason, changes),
+			}
+			return false, false, nil, nil
 		}
+
+		settings.config = &v
+		settings.configMAP = configMap
+		settings.lastConfigHash = hash
+		settings.rememberContent(content)
+		settings.recordHistory(v)
+		return true, settings.enableChangeTracking, changes, nil
+	}()
+	if anomaly != nil {
+		settings.reportAnomaly(onAnomaly, *anomaly)
+	}
+	if err != nil {
+		return changed, tracking, ChangeEvent{}, err
+	}
+	if pending != nil {
+		return c.applyPendingChange(settings, v, pending)
 	}
+	if present {
+		// A file that is back ends its event even if its content was not applied, e.g. as it was applied before.
+		settings.mu.Lock()
+		settings.resolveFileEvent()
+		settings.mu.Unlock()
+	}
+	if event != nil {
+		// File events are reported like changes, ahead of the changes of the content of a recreated file.
+		changes = append([]ConfigChangeLog{*event}, changes...)
+		changed = true
+		reason = ReasonFileEvent
+	}
+	if !changed {
+		return false, tracking, ChangeEvent{}, nil
+	}
+	settings.mu.Lock()
+	defer settings.mu.Unlock()
+	return true, settings.enableChangeTracking, settings.changeEvent(v, reason, changes), nil
+}
 
-	return nil
+// pendingChange is a change decoded but not applied yet, as its callbacks run first, see CallbackSync.
+type pendingChange struct {
+	apply     func()                 // Function copying the decoded content into the configuration interface
+	hash      string                 // Hash of the content
+	content   []byte                 // Content read from the file
+	configMap map[string]interface{} // Map of the configuration once the change is applied
+	lastHash  string                 // Hash of the content applied when the change was decoded
+	event     ChangeEvent            // Event of the change, passed to the callbacks
 }
 
-// calculateFileHash calculates the MD5 hash of the file content at the specified filename.
-// It returns the hexadecimal representation of the hash and an error if there is an issue reading the file.
-func (c *ConfigSettings) calculateFileHash(filename string) (string, error) {
-	fileContent, err := ioutil.ReadFile(filename)
-	if err != nil {
-		return "", err
+// applyPendingChange runs the sync callbacks of a pending change with the settings lock released, and applies
+// the change unless a callback vetoed it or another change was applied meanwhile, which the next check picks up.
+func (c *ConfigList) applyPendingChange(settings *ConfigSettings, v interface{}, pending *pendingChange) (bool, bool, ChangeEvent, error) {
+	event := pending.event
+	event.veto = &changeVeto{}
+	c.syncCallbacks.runSyncCallbacks(event)
+
+	settings.mu.Lock()
+	defer settings.mu.Unlock()
+	if reason := event.veto.decide(); reason != nil {
+		err := fmt.Errorf("%w: config %v: %v", ErrChangeVetoed, settings.configName, reason)
+		c.quarantineRejected(settings, pending.content, err)
+		return false, false, ChangeEvent{}, err
+	}
+	if settings.lastConfigHash != pending.lastHash {
+		return false, false, ChangeEvent{}, nil
 	}
 
-	hash := md5.New()
-	_, err = hash.Write(fileContent)
+	pending.apply()
+	settings.config = &v
+	settings.configMAP = pending.configMap
+	settings.lastConfigHash = pending.hash
+	settings.rememberContent(pending.content)
+	settings.recordHistory(v)
+	settings.resolveFileEvent()
+	settings.refreshSnapshot(v)
+	return true, settings.enableChangeTracking, event, nil
+}
+
+// calculateFileHash calculates the hash of the file content at the specified filename with the Hasher of the
+// configuration, SHA-256 by default.
+// It returns the representation of the hash and an error if there is an issue reading the file.
+func (c *ConfigSettings) calculateFileHash(filename string) (string, error) {
+	fileContent, err := c.source().ReadSourceFile(filename)
 	if err != nil {
 		return "", err
 	}
+	return c.hashContent(fileContent), nil
+}
 
-	return hex.EncodeToString(hash.Sum(nil)), nil
+// hashContent calculates the hash of file content with the Hasher of the configuration, SHA-256 by default.
+func (c *ConfigSettings) hashContent(content []byte) string {
+	hasher := c.hasher
+	if hasher == nil {
+		hasher = SHA256Hasher
+	}
+	return hasher.Hash(content)
 }
@@ -0,0 +1,164 @@
+package mkconf
+
+import (
+	"testing"
+	"time"
+)
+
+// waitForState polls the monitor state of the configuration until it is want, failing the test after a while.
+func waitForState(t *testing.T, cm *ConfigManager, configName string, want MonitorState) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for cm.MonitorState(configName) != want {
+		if time.Now().After(deadline) {
+			t.Fatalf("MonitorState = %v, want %v", cm.MonitorState(configName), want)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// monitorGoroutines returns the number of live monitoring goroutines of the configuration.
+func monitorGoroutines(cm *ConfigManager, configName string) int {
+	return cm.LiveResources()[configName][resourceMonitorGoroutine]
+}
+
+// waitForCall waits for the callback to be called, failing the test after a while.
+func waitForCall(t *testing.T, calls <-chan string) {
+	t.Helper()
+	select {
+	case <-calls:
+	case <-time.After(5 * time.Second):
+		t.Fatal("change callback not called")
+	}
+}
+
+func TestMonitorDoubleStart(t *testing.T) {
+	cm, _ := newStressManager(t, func(string) {})
+	v, _ := cm.GetConfig("stress")
+	if state := cm.MonitorState("stress"); state != MonitorIdle {
+		t.Fatalf("MonitorState before start = %v, want %v", state, MonitorIdle)
+	}
+
+	for i := 0; i < 3; i++ {
+		if err := cm.StartChangeMonitoring("stress", v); err != nil {
+			t.Fatalf("StartChangeMonitoring #%d: %v", i+1, err)
+		}
+		if state := cm.MonitorState("stress"); state != MonitorRunning {
+			t.Fatalf("MonitorState after start #%d = %v, want %v", i+1, state, MonitorRunning)
+		}
+	}
+	// A start of a running monitor restarts it: the goroutine of the previous run finished.
+	if n := monitorGoroutines(cm, "stress"); n != 1 {
+		t.Fatalf("got %d monitoring goroutines, want 1", n)
+	}
+
+	cm.StopChangeMonitoring("stress")
+	if state := cm.MonitorState("stress"); state != MonitorIdle {
+		t.Fatalf("MonitorState after stop = %v, want %v", state, MonitorIdle)
+	}
+	if n := monitorGoroutines(cm, "stress"); n != 0 {
+		t.Fatalf("got %d monitoring goroutines after stop, want 0", n)
+	}
+	// Stopping an idle monitor is a no-op.
+	cm.StopChangeMonitoring("stress")
+	if state := cm.MonitorState("stress"); state != MonitorIdle {
+		t.Fatalf("MonitorState after second stop = %v, want %v", state, MonitorIdle)
+	}
+}
+
+func TestMonitorStopWhileStopping(t *testing.T) {
+	calls := make(chan string)
+	release := make(chan struct{})
+	cm, dir := newStressManager(t, func(configName string) {
+		calls <- configName
+		<-release
+	})
+	// The change callback runs on the monitoring goroutine, so it holds the monitor in MonitorStopping.
+	if err := cm.SetCallbackMode("stress", CallbackSync); err != nil {
+		t.Fatalf("SetCallbackMode: %v", err)
+	}
+	cm.SetFileNotify(true)
+	v, _ := cm.GetConfig("stress")
+	if err := cm.StartChangeMonitoring("stress", v); err != nil {
+		t.Fatalf("StartChangeMonitoring: %v", err)
+	}
+	writeStressConfig(t, dir, 1)
+	waitForCall(t, calls)
+
+	stopped := make(chan struct{}, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			cm.StopChangeMonitoring("stress")
+			stopped <- struct{}{}
+		}()
+	}
+	waitForState(t, cm, "stress", MonitorStopping)
+
+	select {
+	case <-stopped:
+		t.Fatal("StopChangeMonitoring returned before the monitoring goroutine finished")
+	case <-time.After(50 * time.Millisecond):
+	}
+	if state := cm.MonitorState("stress"); state != MonitorStopping {
+		t.Fatalf("MonitorState while the callback runs = %v, want %v", state, MonitorStopping)
+	}
+
+	close(release)
+	for i := 0; i < 2; i++ {
+		select {
+		case <-stopped:
+		case <-time.After(5 * time.Second):
+			t.Fatal("StopChangeMonitoring did not return")
+		}
+	}
+	if state := cm.MonitorState("stress"); state != MonitorIdle {
+		t.Fatalf("MonitorState after stop = %v, want %v", state, MonitorIdle)
+	}
+	if n := monitorGoroutines(cm, "stress"); n != 0 {
+		t.Fatalf("got %d monitoring goroutines after stop, want 0", n)
+	}
+}
+
+func TestMonitorRestartAfterStop(t *testing.T) {
+	calls := make(chan string, 1)
+	cm, dir := newStressManager(t, func(configName string) { calls <- configName })
+	if err := cm.SetCallbackMode("stress", CallbackSync); err != nil {
+		t.Fatalf("SetCallbackMode: %v", err)
+	}
+	cm.SetFileNotify(true)
+	v, _ := cm.GetConfig("stress")
+
+	for version := 1; version <= 3; version++ {
+		if err := cm.StartChangeMonitoring("stress", v); err != nil {
+			t.Fatalf("StartChangeMonitoring #%d: %v", version, err)
+		}
+		if state := cm.MonitorState("stress"); state != MonitorRunning {
+			t.Fatalf("MonitorState after start #%d = %v, want %v", version, state, MonitorRunning)
+		}
+
+		writeStressConfig(t, dir, version)
+		waitForCall(t, calls)
+
+		// The callback runs before the change is applied; stopping waits for the monitoring goroutine to apply it.
+		cm.StopChangeMonitoring("stress")
+		if state := cm.MonitorState("stress"); state != MonitorIdle {
+			t.Fatalf("MonitorState after stop #%d = %v, want %v", version, state, MonitorIdle)
+		}
+		if got, err := cm.Get("stress", "version"); err != nil || got != version {
+			t.Fatalf("Get version after start #%d = %v, %v, want %v", version, got, err, version)
+		}
+	}
+
+	// Changes made while monitoring is stopped are not applied until it is started again.
+	writeStressConfig(t, dir, 4)
+	select {
+	case <-calls:
+		t.Fatal("change applied while monitoring was stopped")
+	case <-time.After(100 * time.Millisecond):
+	}
+	if err := cm.StartChangeMonitoring("stress", v); err != nil {
+		t.Fatalf("StartChangeMonitoring: %v", err)
+	}
+	waitForCall(t, calls)
+	cm.StopChangeMonitoring("stress")
+}
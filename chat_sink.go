@@ -0,0 +1,230 @@
+package mkconf
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxChatDiff is the maximum length of a diff posted to a chat; longer diffs are truncated.
+const maxChatDiff = 2800
+
+// ChatSinkOptions configures a Slack or Microsoft Teams sink.
+type ChatSinkOptions struct {
+	WebhookURL string                         // Incoming webhook URL of the channel
+	Labels     []string                       // Labels selecting the configurations whose changes are posted (any of them); all configurations if empty
+	ActorFunc  func(configName string) string // Function returning who made the change of a configuration, if known
+	ErrorFunc  func(err error)                // Function receiving errors posting messages, if set
+	HTTPClient *http.Client                   // Client used for requests; a client with a 10 second timeout if nil
+}
+
+// chatNotification is a change of a configuration to be posted.
+type chatNotification struct {
+	configName string            // Name of the changed configuration
+	actor      string            // Who made the change, if known
+	version    string            // Short snapshot hash of the configuration after the change
+	changes    []ConfigChangeLog // Changed fields, redacted
+}
+
+// ChatSink posts the tracked changes of configurations to a Slack or Microsoft Teams channel through an incoming
+// webhook, as a message with the configuration name, the actor (if known), the version (a short SnapshotHash) and
+// a line diff of the changed fields. Secret values are redacted as in the change log. Messages are posted in the
+// background in the order of the changes.
+type ChatSink struct {
+	manager *ConfigManager                                  // Manager the sink is registered with
+	options ChatSinkOptions                                 // Sink options
+	format  func(notification chatNotification) interface{} // Function building the webhook payload
+	queue   chan chatNotification                           // Notifications waiting to be posted
+	closed  bool                                            // Flag indicating the sink was closed
+	mu      sync.Mutex                                      // Mutex for synchronizing closing with queueing
+	done    chan struct{}                                   // Channel closed when the posting goroutine finished
+}
+
+// AddSlackSink registers a sink posting the tracked changes of the selected configurations to a Slack channel.
+// Close the sink to post the queued changes and unregister it.
+func (cm *ConfigManager) AddSlackSink(options ChatSinkOptions) (*ChatSink, error) {
+	return cm.addChatSink("slack", options, slackMessage)
+}
+
+// AddTeamsSink registers a sink posting the tracked changes of the selected configurations to a Microsoft Teams
+// channel as an Adaptive Card. Close the sink to post the queued changes and unregister it.
+func (cm *ConfigManager) AddTeamsSink(options ChatSinkOptions) (*ChatSink, error) {
+	return cm.addChatSink("teams", options, teamsMessage)
+}
+
+// addChatSink registers a sink posting payloads built by format.
+func (cm *ConfigManager) addChatSink(kind string, options ChatSinkOptions, format func(notification chatNotification) interface{}) (*ChatSink, error) {
+	if options.WebhookURL == "" {
+		return nil, fmt.Errorf("%v sink: webhook URL is not set", kind)
+	}
+	if options.HTTPClient == nil {
+		options.HTTPClient = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	s := &ChatSink{manager: cm, options: options, format: format, queue: make(chan chatNotification, 100), done: make(chan struct{})}
+	go s.run(kind)
+	cm.configList.addChangeSink(s)
+	return s, nil
+}
+
+// Close unregisters the sink and waits until the queued changes are posted.
+func (s *ChatSink) Close() {
+	s.manager.configList.removeChangeSink(s)
+
+	s.mu.Lock()
+	if !s.closed {
+		s.closed = true
+		close(s.queue)
+	}
+	s.mu.Unlock()
+	<-s.done
+}
+
+// publishChanges implements changeSink. Changes of selected configurations are queued for posting;
+// if the queue is full, they are dropped and reported through ErrorFunc.
+func (s *ChatSink) publishChanges(configName string, changes []ConfigChangeLog) {
+	if !s.selects(configName) {
+		return
+	}
+	notification := chatNotification{configName: configName, changes: changes}
+	if s.options.ActorFunc != nil {
+		notification.actor = s.options.ActorFunc(configName)
+	}
+	if hash, err := s.manager.SnapshotHash(configName); err == nil {
+		notification.version = hash[:12]
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+	select {
+	case s.queue <- notification:
+	default:
+		if s.options.ErrorFunc != nil {
+			s.options.ErrorFunc(fmt.Errorf("chat sink: queue is full, dropped %d change(s) of %v", len(changes), configName))
+		}
+	}
+}
+
+// selects reports whether the changes of the configuration are posted.
+func (s *ChatSink) selects(configName string) bool {
+	if len(s.options.Labels) == 0 {
+		return true
+	}
+	settings, ok := s.manager.configList.getSettings(configName)
+	if !ok {
+		return false
+	}
+	for _, label := range s.options.Labels {
+		if settings.hasLabel(label) {
+			return true
+		}
+	}
+	return false
+}
+
+// run posts the queued notifications until the queue is closed.
+func (s *ChatSink) run(kind string) {
+	defer close(s.done)
+	for notification := range s.queue {
+		if err := s.post(s.format(notification)); err != nil && s.options.ErrorFunc != nil {
+			s.options.ErrorFunc(fmt.Errorf("%v sink: %v: %v", kind, notification.configName, err))
+		}
+	}
+}
+
+// post sends a payload to the webhook.
+func (s *ChatSink) post(payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	resp, err := s.options.HTTPClient.Post(s.options.WebhookURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		message, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("unexpected status %v: %s", resp.Status, bytes.TrimSpace(message))
+	}
+	return nil
+}
+
+// chatDiff returns the diff of the notification, truncated to fit into a chat message.
+func chatDiff(notification chatNotification) string {
+	diff := strings.TrimPrefix(changesDiff(notification.changes), "\n")
+	if len(diff) > maxChatDiff {
+		// Cut at a line end, so no character or diff line is split.
+		diff = diff[:strings.LastIndex(diff[:maxChatDiff], "\n")+1] + "… (truncated)"
+	}
+	return diff
+}
+
+// chatFacts returns the actor and version of the notification as "name: value" pairs, skipping unknown ones.
+func chatFacts(notification chatNotification) [][2]string {
+	var facts [][2]string
+	if notification.actor != "" {
+		facts = append(facts, [2]string{"Actor", notification.actor})
+	}
+	if notification.version != "" {
+		facts = append(facts, [2]string{"Version", notification.version})
+	}
+	return facts
+}
+
+// slackMessage builds a Slack message with Block Kit blocks.
+func slackMessage(notification chatNotification) interface{} {
+	title := fmt.Sprintf("Configuration `%v` changed (%d field(s))", notification.configName, len(notification.changes))
+	var context []string
+	for _, fact := range chatFacts(notification) {
+		context = append(context, fmt.Sprintf("*%v:* %v", fact[0], fact[1]))
+	}
+
+	blocks := []interface{}{
+		map[string]interface{}{"type": "section", "text": map[string]string{"type": "mrkdwn", "text": title}},
+	}
+	if len(context) > 0 {
+		blocks = append(blocks, map[string]interface{}{
+			"type":     "context",
+			"elements": []interface{}{map[string]string{"type": "mrkdwn", "text": strings.Join(context, "  •  ")}},
+		})
+	}
+	blocks = append(blocks, map[string]interface{}{
+		"type": "section",
+		"text": map[string]string{"type": "mrkdwn", "text": "```" + chatDiff(notification) + "```"},
+	})
+	return map[string]interface{}{"text": strings.ReplaceAll(title, "`", ""), "blocks": blocks}
+}
+
+// teamsMessage builds a Microsoft Teams message holding an Adaptive Card.
+func teamsMessage(notification chatNotification) interface{} {
+	facts := []interface{}{map[string]string{"title": "Config", "value": notification.configName}}
+	for _, fact := range chatFacts(notification) {
+		facts = append(facts, map[string]string{"title": fact[0], "value": fact[1]})
+	}
+
+	card := map[string]interface{}{
+		"$schema": "http://adaptivecards.io/schemas/adaptive-card.json",
+		"type":    "AdaptiveCard",
+		"version": "1.4",
+		"body": []interface{}{
+			map[string]interface{}{"type": "TextBlock", "size": "Medium", "weight": "Bolder", "wrap": true,
+				"text": fmt.Sprintf("Configuration %v changed (%d field(s))", notification.configName, len(notification.changes))},
+			map[string]interface{}{"type": "FactSet", "facts": facts},
+			map[string]interface{}{"type": "TextBlock", "fontType": "Monospace", "wrap": true, "text": chatDiff(notification)},
+		},
+	}
+	return map[string]interface{}{
+		"type":        "message",
+		"attachments": []interface{}{map[string]interface{}{"contentType": "application/vnd.microsoft.card.adaptive", "content": card}},
+	}
+}
@@ -0,0 +1,219 @@
+// Command mkconf is a command-line tool for mkconf-managed configuration files.
+//
+// Usage:
+//
+//	mkconf get <file> <path>
+//	mkconf set <file> <path> <value>
+//	mkconf edit [-editor cmd] [-impacts file] [-y] <file>
+//	mkconf soak [-rate n] [-duration d] [-pattern p] [-burst n] [-size bytes] [-check sec] [-notify] [-dir dir]
+//
+// The get command prints the value at a dot-separated key path, e.g. "db.port" or "servers.0.host": strings as they
+// are, other values as JSON. The set command changes the value at a path (see ConfigManager.Set); the value is
+// parsed as JSON if it is valid JSON, so 8080 sets a number and '["a","b"]' a list, and is a string otherwise.
+// YAML and TOML files keep their comments and formatting. Both let deployment scripts read and tweak
+// configurations of any format without format-specific tools.
+//
+// The edit command opens the file in $VISUAL or $EDITOR (see ConfigManager.EditConfig). The editor works on a
+// temporary copy; when it exits, the copy is checked to decode, its diff against the file is shown and, once
+// confirmed, it is written atomically over the file. Invalid content can be edited again and never reaches the
+// file, so services watching it never see a broken configuration. With -impacts, the consequences of changing
+// values are read from a JSON file mapping dot-separated key paths to descriptions, e.g.
+// {"db.dsn": "reconnects all database pools"}, and listed ahead of the diff for the changed values
+// (see ConfigManager.SetImpact).
+//
+// Files are decoded into generic values, so only formats that decode into a map are supported (JSON, YAML, TOML, Plist, Jsonnet and CUE); to check the content
+// against a config struct, call EditConfig from the service binary instead. Jsonnet and CUE files are evaluated with
+// the jsonnet and cue command-line tools, which must be installed.
+//
+// The soak command benchmarks change detection on the current machine (see mkconf.RunSoakTest): it writes changes
+// to a temporary configuration at the given rate and pattern (in-place, atomic, burst or mixed) while mkconf
+// monitors it, and prints the detection latencies and the number of dropped changes.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"mkconf"
+	reader "mkconf/readers"
+)
+
+// genericTypes lists the config types that can be decoded into a generic map.
+var genericTypes = []string{".json", ".yaml", ".yml", ".toml", ".plist", ".jsonnet", ".cue"}
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage:\n  mkconf get <file> <path>\n  mkconf set <file> <path> <value>\n  mkconf edit [-editor cmd] [-impacts file] [-y] <file>\n  mkconf soak [-rate n] [-duration d] [-pattern p] [-burst n] [-size bytes] [-check sec] [-notify] [-dir dir]\n")
+	}
+	flag.Parse()
+	if flag.NArg() < 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	var err error
+	switch flag.Arg(0) {
+	case "get":
+		err = get(flag.Args()[1:])
+	case "set":
+		err = set(flag.Args()[1:])
+	case "edit":
+		err = edit(flag.Args()[1:])
+	case "soak":
+		err = soak(flag.Args()[1:])
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "mkconf: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// get runs the get command with its arguments.
+func get(args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("get needs a file and a path")
+	}
+	cm, name, err := openFile(args[0])
+	if err != nil {
+		return err
+	}
+	if err := cm.LoadConfig(name); err != nil {
+		return err
+	}
+	value, err := cm.Get(name, args[1])
+	if err != nil {
+		return err
+	}
+	if text, ok := value.(string); ok {
+		fmt.Println(text)
+		return nil
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(data))
+	return nil
+}
+
+// set runs the set command with its arguments.
+func set(args []string) error {
+	if len(args) != 3 {
+		return fmt.Errorf("set needs a file, a path and a value")
+	}
+	cm, name, err := openFile(args[0])
+	if err != nil {
+		return err
+	}
+	if err := cm.LoadConfig(name); err != nil {
+		return err
+	}
+	var value interface{}
+	if err := json.Unmarshal([]byte(args[2]), &value); err != nil {
+		value = args[2]
+	}
+	return cm.Set(name, args[1], value, nil)
+}
+
+// edit runs the edit command with its arguments.
+func edit(args []string) error {
+	flags := flag.NewFlagSet("edit", flag.ExitOnError)
+	editor := flags.String("editor", "", "editor command; $VISUAL, $EDITOR or vi if empty")
+	impacts := flags.String("impacts", "", "JSON file mapping key paths to the impacts of changing them")
+	yes := flags.Bool("y", false, "write valid changes without asking for confirmation")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		return fmt.Errorf("edit needs exactly one file")
+	}
+
+	cm, name, err := openFile(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	if *impacts != "" {
+		if err := loadImpacts(cm, name, *impacts); err != nil {
+			return err
+		}
+	}
+	return cm.EditConfig(name, mkconf.EditOptions{Editor: *editor, Yes: *yes})
+}
+
+// soak runs the soak command with its arguments.
+func soak(args []string) error {
+	flags := flag.NewFlagSet("soak", flag.ExitOnError)
+	var options mkconf.SoakOptions
+	flags.Float64Var(&options.Rate, "rate", 10, "changes written per second")
+	flags.DurationVar(&options.Duration, "duration", 10*time.Second, "time changes are written for")
+	flags.TextVar(&options.Pattern, "pattern", mkconf.SoakAtomic, "write pattern: in-place, atomic, burst or mixed")
+	flags.IntVar(&options.Burst, "burst", 10, "changes per burst with the burst pattern")
+	flags.IntVar(&options.Size, "size", 1024, "approximate size of the configuration file in bytes")
+	flags.IntVar(&options.CheckSec, "check", 1, "interval of the change checks in seconds")
+	flags.BoolVar(&options.FileNotify, "notify", false, "wait for file system notifications instead of polling")
+	flags.StringVar(&options.Dir, "dir", "", "directory the temporary configuration is created in")
+	flags.Parse(args)
+	if flags.NArg() != 0 {
+		return fmt.Errorf("soak takes no arguments")
+	}
+
+	report, err := mkconf.RunSoakTest(options)
+	if err != nil {
+		return err
+	}
+	fmt.Print(report)
+	return nil
+}
+
+// loadImpacts registers the impacts of the JSON file for the configuration.
+func loadImpacts(cm *mkconf.ConfigManager, name, file string) error {
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	var impacts map[string]string
+	if err := json.Unmarshal(content, &impacts); err != nil {
+		return fmt.Errorf("impacts %v: %v", file, err)
+	}
+	for key, description := range impacts {
+		if err := cm.SetImpact(name, key, description); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// openFile registers the file as a configuration decoded into a generic map and returns its name.
+func openFile(file string) (*mkconf.ConfigManager, string, error) {
+	configType := genericType(file)
+	if configType == "" {
+		return nil, "", fmt.Errorf("%v: unsupported file type", file)
+	}
+	name := strings.TrimSuffix(filepath.Base(file), configType)
+
+	cm := mkconf.NewConfigManager()
+	if err := cm.AddConfig(name, filepath.Dir(file), configType, new(map[string]interface{})); err != nil {
+		return nil, "", err
+	}
+	// Jsonnet and CUE files are evaluated with the jsonnet and cue command-line tools, if installed.
+	cm.GetSettings(name).SetJsonnetEvaluator(reader.EvaluateJsonnetCommand).SetCUEEvaluator(reader.EvaluateCUECommand)
+	return cm, name, nil
+}
+
+// genericType returns the config type of the file name if it can be decoded into a generic map.
+func genericType(fileName string) string {
+	lower := strings.ToLower(fileName)
+	for _, configType := range genericTypes {
+		if strings.HasSuffix(lower, configType) {
+			return fileName[len(fileName)-len(configType):]
+		}
+	}
+	return ""
+}
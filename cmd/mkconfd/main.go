@@ -0,0 +1,142 @@
+// Command mkconfd serves the configurations of a directory over the mkconf snapshot socket protocol,
+// so components written in other languages can get and watch mkconf-managed configurations.
+//
+// Usage:
+//
+//	mkconfd -dir /etc/app -socket /run/app/mkconf.sock
+//	mkconfd -dir /etc/app -tree
+//
+// With -tree, the configurations are printed as trees with value types and provenance markers (see
+// ConfigManager.DumpTree) instead of being served.
+//
+// Clients connect to the unix socket and send one request line:
+//
+//	GET <name>      the configuration as a JSON line
+//	LIST            the configuration names as a JSON line
+//	ALL             all configurations keyed by name
+//	WATCH [<name>]  a JSON line now and on every change, until the client disconnects
+//
+// Files are decoded into generic values, so only formats that decode into a map are served
+// (JSON, YAML, TOML, Plist, Jsonnet and CUE). Files are reloaded when they change. Jsonnet and CUE files are
+// evaluated with the jsonnet and cue command-line tools, which must be installed.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"mkconf"
+	reader "mkconf/readers"
+)
+
+// genericTypes lists the config types that can be decoded into a generic map.
+var genericTypes = []string{".json", ".yaml", ".yml", ".toml", ".plist", ".jsonnet", ".cue"}
+
+func main() {
+	dir := flag.String("dir", ".", "directory with the configuration files")
+	socket := flag.String("socket", "mkconf.sock", "path of the unix socket to serve")
+	checkSec := flag.Int("interval", 1, "interval in seconds for checking configuration changes")
+	tree := flag.Bool("tree", false, "print the configurations as trees and exit")
+	flag.Parse()
+
+	cm := mkconf.NewConfigManager()
+	names, err := loadDirectory(cm, *dir, *checkSec)
+	if err != nil {
+		log.Fatalf("mkconfd: %v", err)
+	}
+
+	if *tree {
+		for _, name := range names {
+			cm.StopChangeMonitoring(name)
+			if err := cm.DumpTree(os.Stdout, name); err != nil {
+				log.Fatalf("mkconfd: %v", err)
+			}
+		}
+		return
+	}
+
+	watcher, err := cm.Watch()
+	if err != nil {
+		log.Printf("mkconfd: %v", err)
+	}
+
+	server, err := cm.ServeSnapshot(*socket)
+	if err != nil {
+		log.Fatalf("mkconfd: %v", err)
+	}
+	log.Printf("mkconfd: serving %d configurations from %v on %v", len(names), *dir, *socket)
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	<-signals
+
+	server.Close()
+	for _, name := range names {
+		cm.StopChangeMonitoring(name)
+	}
+	if watcher != nil {
+		watcher.Stop(context.Background())
+	}
+}
+
+// loadDirectory adds, loads and starts monitoring every supported file of the directory.
+// It returns the names of the added configurations.
+func loadDirectory(cm *mkconf.ConfigManager, dir string, checkSec int) ([]string, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, file := range files {
+		if file.IsDir() {
+			continue
+		}
+		configType := genericType(file.Name())
+		if configType == "" {
+			continue
+		}
+		name := strings.TrimSuffix(file.Name(), configType)
+		value := new(map[string]interface{})
+
+		err := cm.AddConfigCallback(name, dir, configType, value, func(configName string) {
+			log.Printf("mkconfd: %v changed", configName)
+		})
+		if err != nil {
+			log.Printf("mkconfd: skipping %v: %v", file.Name(), err)
+			continue
+		}
+		// Jsonnet and CUE files are evaluated with the jsonnet and cue command-line tools, if installed.
+		cm.GetSettings(name).SetJsonnetEvaluator(reader.EvaluateJsonnetCommand).SetCUEEvaluator(reader.EvaluateCUECommand)
+		if err := cm.LoadConfig(name); err != nil {
+			log.Printf("mkconfd: %v", err)
+		}
+		cm.GetSettings(name).SetCheckSec(checkSec)
+		if err := cm.StartChangeMonitoring(name, value); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("no supported configuration files in %v", dir)
+	}
+	return names, nil
+}
+
+// genericType returns the config type of the file name if it can be decoded into a generic map.
+func genericType(fileName string) string {
+	lower := strings.ToLower(fileName)
+	for _, configType := range genericTypes {
+		if strings.HasSuffix(lower, configType) {
+			return fileName[len(fileName)-len(configType):]
+		}
+	}
+	return ""
+}
@@ -0,0 +1,298 @@
+package mkconf
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	reader "mkconf/readers"
+)
+
+// CoercionWarning describes a file value that the reader of the configuration coerces to fit the type of a struct field.
+type CoercionWarning struct {
+	ConfigName string      // Name of the configuration
+	Path       string      // Dot-separated path of the value in the configuration file
+	FileValue  interface{} // Value as found in the configuration file
+	FieldType  string      // Type of the struct field the value is decoded into
+	Lossy      bool        // Whether the coercion loses information (e.g. float truncated to int, string "true" parsed as bool)
+}
+
+// String returns a human-readable description of the coercion.
+func (w CoercionWarning) String() string {
+	kind := "coercion"
+	if w.Lossy {
+		kind = "lossy coercion"
+	}
+	return fmt.Sprintf("config %v: %v of %v (%T %v) into %v", w.ConfigName, kind, w.Path, w.FileValue, w.FileValue, w.FieldType)
+}
+
+// Error implements error, so warnings can be passed to the function set with SetErrorFunc.
+func (w CoercionWarning) Error() string {
+	return w.String()
+}
+
+// CoercionWarningFunc is a function type used to report coercion warnings.
+type CoercionWarningFunc func(warning CoercionWarning)
+
+// SetStrictCoercion enables or disables strict mode, in which loading a configuration that requires lossy coercions fails.
+// Coercions that keep the value intact are still reported as warnings.
+func (c *ConfigSettings) SetStrictCoercion(strict bool) *ConfigSettings {
+	c.strictCoercion = strict
+	return c
+}
+
+// SetCoercionWarningFunc sets the function receiving coercion warnings. By default warnings are passed to the
+// function set with SetErrorFunc.
+func (c *ConfigSettings) SetCoercionWarningFunc(fn CoercionWarningFunc) *ConfigSettings {
+	c.coercionWarning = fn
+	return c
+}
+
+// coercionKind describes which file values a reader coerces into struct fields of another type.
+type coercionKind int
+
+const (
+	coercesNothing coercionKind = iota // Values must match the field type or fail to decode, e.g. JSON, TOML and plist
+	coercesYAML                        // Floats are truncated into integer fields and scalars are stored as text into string fields
+	coercesINI                         // Values are text parsed into the field type; values that do not parse are dropped
+	coercesXML                         // Values are text parsed into the field type; values that do not parse fail to decode
+)
+
+// readerCoercions returns the coercions r performs when decoding into a struct. Readers registered with
+// RegisterReader are assumed to perform none.
+func readerCoercions(r reader.Reader) coercionKind {
+	switch r.(type) {
+	case *reader.YAMLConfigReader:
+		return coercesYAML
+	case *reader.INIConfigReader:
+		return coercesINI
+	case *reader.XMLConfigReader:
+		return coercesXML
+	default:
+		return coercesNothing
+	}
+}
+
+// durationType is the type of time.Duration fields, which the YAML and INI readers parse from text like "5s".
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// checkCoercions compares the file content with the type of v and reports values that need coercion.
+// In strict mode it returns an error instead, before anything is decoded into v.
+func (c *ConfigSettings) checkCoercions(v interface{}) error {
+	configMap, err := c.convertToMap(c.configFullPath)
+	if err != nil {
+		return nil
+	}
+	return c.checkMapCoercions(configMap, v)
+}
+
+// checkMapCoercions is checkCoercions for file content already converted to configMap.
+func (c *ConfigSettings) checkMapCoercions(configMap map[string]interface{}, v interface{}) error {
+	kind := readerCoercions(c.Reader)
+	if v == nil || kind == coercesNothing {
+		return nil
+	}
+
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return nil
+		}
+		rv = rv.Elem()
+	}
+	t := rv.Type()
+
+	if defaults, ok := configMap["DEFAULT"].(map[string]interface{}); kind == coercesINI && ok {
+		// Keys of the INI default section map onto the top-level struct fields.
+		merged := make(map[string]interface{}, len(configMap)+len(defaults))
+		for key, value := range configMap {
+			merged[key] = value
+		}
+		for key, value := range defaults {
+			merged[key] = value
+		}
+		configMap = merged
+	}
+
+	var warnings []CoercionWarning
+	findCoercions(c.configName, "", configMap, t, kind, &warnings)
+	if len(warnings) == 0 {
+		return nil
+	}
+
+	if c.strictCoercion {
+		var messages []string
+		for _, w := range warnings {
+			if w.Lossy {
+				messages = append(messages, w.String())
+			}
+		}
+		if len(messages) > 0 {
+			return fmt.Errorf("strict coercion: %v", strings.Join(messages, "; "))
+		}
+	}
+
+	for _, w := range warnings {
+		if c.coercionWarning != nil {
+			c.coercionWarning(w)
+		} else {
+			c.reportError(w)
+		}
+	}
+	return nil
+}
+
+// findCoercions walks value alongside type t and collects warnings for the coercions of the given kind the reader
+// performs. Values the reader rejects are not reported, as they fail to decode anyway.
+func findCoercions(configName, path string, value interface{}, t reflect.Type, kind coercionKind, warnings *[]CoercionWarning) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if value == nil {
+		return
+	}
+
+	warn := func(lossy bool) {
+		*warnings = append(*warnings, CoercionWarning{
+			ConfigName: configName,
+			Path:       path,
+			FileValue:  value,
+			FieldType:  t.String(),
+			Lossy:      lossy,
+		})
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		for key, item := range toStringMap(value) {
+			if field, ok := fieldByKey(t, key); ok {
+				findCoercions(configName, joinPath(path, key), item, field.Type, kind, warnings)
+			}
+		}
+	case reflect.Map:
+		for key, item := range toStringMap(value) {
+			findCoercions(configName, joinPath(path, key), item, t.Elem(), kind, warnings)
+		}
+	case reflect.Slice, reflect.Array:
+		if items, ok := value.([]interface{}); ok {
+			for i, item := range items {
+				findCoercions(configName, fmt.Sprintf("%v[%d]", path, i), item, t.Elem(), kind, warnings)
+			}
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		switch val := value.(type) {
+		case float64:
+			// YAML truncates floats into integer fields; values out of range fail to decode.
+			if kind == coercesYAML && !overflowsInt(t, val) {
+				warn(val != math.Trunc(val))
+			}
+		case string:
+			if t == durationType && kind != coercesXML {
+				if _, err := time.ParseDuration(strings.TrimSpace(val)); err == nil {
+					return
+				}
+			}
+			warnText(t, val, kind, warn)
+		}
+	case reflect.Float32, reflect.Float64, reflect.Bool:
+		if val, ok := value.(string); ok {
+			warnText(t, val, kind, warn)
+		}
+	case reflect.String:
+		// YAML stores scalars into string fields as written.
+		switch value.(type) {
+		case string, []byte, map[string]interface{}, map[interface{}]interface{}, []interface{}:
+		default:
+			if kind == coercesYAML {
+				warn(false)
+			}
+		}
+	}
+}
+
+// warnText reports a string parsed into a number or bool field by the text formats as a lossy coercion, as the text
+// is lost. INI drops values that do not parse, XML fails to decode them.
+func warnText(t reflect.Type, text string, kind coercionKind, warn func(lossy bool)) {
+	if kind == coercesINI || kind == coercesXML && parsesXML(t, text) {
+		warn(true)
+	}
+}
+
+// parsesXML reports whether the XML decoder parses text into a field of type t.
+func parsesXML(t reflect.Type, text string) bool {
+	text = strings.TrimSpace(text)
+	var err error
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		_, err = strconv.ParseInt(text, 10, t.Bits())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		_, err = strconv.ParseUint(text, 10, t.Bits())
+	case reflect.Float32, reflect.Float64:
+		_, err = strconv.ParseFloat(text, t.Bits())
+	case reflect.Bool:
+		_, err = strconv.ParseBool(text)
+	}
+	return err == nil
+}
+
+// overflowsInt reports whether f does not fit into the integer type t.
+func overflowsInt(t reflect.Type, f float64) bool {
+	switch t.Kind() {
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return f < 0 || f >= math.Pow(2, float64(t.Bits()))
+	default:
+		limit := math.Pow(2, float64(t.Bits()-1))
+		return f < -limit || f >= limit
+	}
+}
+
+// toStringMap converts the map types produced by the readers to map[string]interface{}.
+func toStringMap(value interface{}) map[string]interface{} {
+	switch m := value.(type) {
+	case map[string]interface{}:
+		return m
+	case map[interface{}]interface{}:
+		result := make(map[string]interface{}, len(m))
+		for k, v := range m {
+			result[fmt.Sprint(k)] = v
+		}
+		return result
+	default:
+		return nil
+	}
+}
+
+// fieldByKey finds the struct field a configuration key is decoded into, using the format tags or the field name.
+func fieldByKey(t reflect.Type, key string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		for _, tag := range []string{"json", "yaml", "toml", "ini", "xml"} {
+			name := strings.Split(field.Tag.Get(tag), ",")[0]
+			if name == key {
+				return field, true
+			}
+		}
+	}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath == "" && strings.EqualFold(field.Name, key) {
+			return field, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+// joinPath appends key to a dot-separated path.
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
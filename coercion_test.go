@@ -0,0 +1,109 @@
+package mkconf
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	reader "mkconf/readers"
+)
+
+type coercionConfig struct {
+	Port    int           `json:"port" yaml:"port" toml:"port" ini:"port" xml:"port"`
+	Enabled bool          `json:"enabled" yaml:"enabled" toml:"enabled" ini:"enabled" xml:"enabled"`
+	Ratio   float64       `json:"ratio" yaml:"ratio" toml:"ratio" ini:"ratio" xml:"ratio"`
+	Name    string        `json:"name" yaml:"name" toml:"name" ini:"name" xml:"name"`
+	Timeout time.Duration `json:"timeout" yaml:"timeout" toml:"timeout" ini:"timeout" xml:"timeout"`
+}
+
+func TestCoercionsFollowTheReader(t *testing.T) {
+	tests := []struct {
+		name       string
+		configType string
+		content    string
+		strict     bool
+		wantErr    bool
+		lossless   int
+		lossy      int
+		want       coercionConfig
+	}{
+		{"json match", ".json", `{"port": 8080, "enabled": true, "ratio": 0.5, "name": "app"}`, true, false, 0, 0,
+			coercionConfig{Port: 8080, Enabled: true, Ratio: 0.5, Name: "app"}},
+		{"json string into int fails to decode", ".json", `{"port": "8080"}`, false, true, 0, 0, coercionConfig{}},
+		{"json float into int fails to decode", ".json", `{"port": 80.5}`, false, true, 0, 0, coercionConfig{}},
+		{"toml string into bool fails to decode", ".toml", `enabled = "true"`, false, true, 0, 0, coercionConfig{}},
+
+		{"yaml match", ".yaml", "port: 8080\nenabled: true\nratio: 0.5\ntimeout: 5s\n", true, false, 0, 0,
+			coercionConfig{Port: 8080, Enabled: true, Ratio: 0.5, Timeout: 5 * time.Second}},
+		{"yaml integral float into int", ".yaml", "port: 8080.0\n", true, false, 1, 0, coercionConfig{Port: 8080}},
+		{"yaml number into string", ".yaml", "name: 5\n", true, false, 1, 0, coercionConfig{Name: "5"}},
+		{"yaml float truncated into int", ".yaml", "port: 80.5\n", false, false, 0, 1, coercionConfig{Port: 80}},
+		{"yaml float truncated into int in strict mode", ".yaml", "port: 80.5\n", true, true, 0, 0, coercionConfig{}},
+		{"yaml string into int fails to decode", ".yaml", "port: \"8080\"\n", false, true, 0, 0, coercionConfig{}},
+
+		{"ini strings parsed", ".ini", "port = 8080\nenabled = true\nratio = 0.5\nname = app\ntimeout = 5s\n", false, false, 0, 3,
+			coercionConfig{Port: 8080, Enabled: true, Ratio: 0.5, Name: "app", Timeout: 5 * time.Second}},
+		{"ini string into bool in strict mode", ".ini", "enabled = true\n", true, true, 0, 0, coercionConfig{}},
+		{"ini unparseable string dropped", ".ini", "port = 80.5\n", false, false, 0, 1, coercionConfig{}},
+
+		{"xml strings parsed", ".xml", "<config><port>8080</port><enabled>true</enabled></config>", false, false, 0, 2,
+			coercionConfig{Port: 8080, Enabled: true}},
+		{"xml string into int in strict mode", ".xml", "<config><port>8080</port></config>", true, true, 0, 0, coercionConfig{}},
+		{"xml unparseable string fails to decode", ".xml", "<config><port>80.5</port></config>", false, true, 0, 0, coercionConfig{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if err := os.WriteFile(filepath.Join(dir, "app"+tt.configType), []byte(tt.content), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			var reported []error
+			cm := NewConfigManager()
+			cm.SetErrorFunc(func(err error) { reported = append(reported, err) })
+			config := &coercionConfig{}
+			if err := cm.AddConfig("app", dir, tt.configType, config); err != nil {
+				t.Fatalf("AddConfig: %v", err)
+			}
+			settings, _ := cm.configList.getSettings("app")
+			settings.SetStrictCoercion(tt.strict)
+
+			err := cm.LoadConfig("app")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadConfig error = %v, want error %v", err, tt.wantErr)
+			}
+			lossless, lossy := 0, 0
+			for _, err := range reported {
+				var warning CoercionWarning
+				if !errors.As(err, &warning) {
+					continue
+				}
+				if warning.Lossy {
+					lossy++
+				} else {
+					lossless++
+				}
+			}
+			if lossless != tt.lossless || lossy != tt.lossy {
+				t.Fatalf("got %d lossless and %d lossy warnings %v, want %d and %d", lossless, lossy, reported, tt.lossless, tt.lossy)
+			}
+			if !tt.wantErr && *config != tt.want {
+				t.Fatalf("loaded %+v, want %+v", *config, tt.want)
+			}
+		})
+	}
+}
+
+func TestCoercionWarningFuncReceivesWarnings(t *testing.T) {
+	var warnings []CoercionWarning
+	settings := &ConfigSettings{configName: "app", Reader: &reader.YAMLConfigReader{}}
+	settings.SetCoercionWarningFunc(func(w CoercionWarning) { warnings = append(warnings, w) })
+
+	if err := settings.checkMapCoercions(map[string]interface{}{"port": 80.5}, &coercionConfig{}); err != nil {
+		t.Fatalf("checkMapCoercions: %v", err)
+	}
+	if len(warnings) != 1 || warnings[0].Path != "port" || !warnings[0].Lossy || warnings[0].FieldType != "int" {
+		t.Fatalf("got warnings %v, want a lossy coercion of port into int", warnings)
+	}
+}
@@ -0,0 +1,185 @@
+package mkconf
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// These tests exercise the concurrency contract documented on ConfigManager and are meant to be run with -race.
+
+type stressConfig struct {
+	Version int    `json:"version"`
+	Name    string `json:"name"`
+}
+
+// writeStressConfig atomically replaces the configuration file, so the monitor never reads a partial write.
+// It may be called from any goroutine of the test.
+func writeStressConfig(t *testing.T, dir string, version int) {
+	t.Helper()
+	tmp := filepath.Join(dir, "stress.json.tmp")
+	content := fmt.Sprintf(`{"version": %d, "name": "stress"}`, version)
+	if err := os.WriteFile(tmp, []byte(content), 0o644); err != nil {
+		t.Error(err)
+		return
+	}
+	if err := os.Rename(tmp, filepath.Join(dir, "stress.json")); err != nil {
+		t.Error(err)
+	}
+}
+
+// newStressManager returns a manager with the loaded configuration "stress" in a temporary directory, with the
+// given change callback.
+func newStressManager(t *testing.T, callback ChangeCallbackFunc) (*ConfigManager, string) {
+	t.Helper()
+	dir := t.TempDir()
+	writeStressConfig(t, dir, 0)
+
+	cm := NewConfigManager()
+	cm.SetErrorFunc(func(err error) { t.Errorf("reported error: %v", err) })
+	err := cm.AddConfigCallback("stress", dir, ".json", &stressConfig{}, callback)
+	if err != nil {
+		t.Fatalf("AddConfigCallback: %v", err)
+	}
+	if err := cm.LoadConfig("stress"); err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	return cm, dir
+}
+
+// runFor calls fn repeatedly on n goroutines until stop is closed.
+func runFor(wg *sync.WaitGroup, stop <-chan struct{}, n int, fn func(i int)) {
+	for g := 0; g < n; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; ; i++ {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				fn(i)
+			}
+		}()
+	}
+}
+
+func TestConcurrentLoadReloadSubscribe(t *testing.T) {
+	var changes, events atomic.Int64
+	cm, dir := newStressManager(t, func(string) { changes.Add(1) })
+	cm.SetFileNotify(true)
+	v, _ := cm.GetConfig("stress")
+	if err := cm.StartChangeMonitoring("stress", v); err != nil {
+		t.Fatalf("StartChangeMonitoring: %v", err)
+	}
+	if _, err := cm.Subscribe("stress", func(ChangeEvent) { events.Add(1) }); err != nil {
+		t.Fatalf("Subscribe: %v", err)
+	}
+	watcher, err := cm.Watch()
+	if err != nil {
+		t.Fatalf("Watch: %v", err)
+	}
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	runFor(&wg, stop, 2, func(int) {
+		if err := cm.LoadConfig("stress"); err != nil {
+			t.Errorf("LoadConfig: %v", err)
+		}
+	})
+	runFor(&wg, stop, 2, func(int) {
+		if _, err := cm.CheckOnce("stress"); err != nil {
+			t.Errorf("CheckOnce: %v", err)
+		}
+	})
+	runFor(&wg, stop, 4, func(int) {
+		if _, err := cm.Get("stress", "version"); err != nil {
+			t.Errorf("Get: %v", err)
+		}
+		if _, err := cm.GetConfig("stress"); err != nil {
+			t.Errorf("GetConfig: %v", err)
+		}
+		cm.GetChangesForConfig("stress")
+	})
+	runFor(&wg, stop, 4, func(int) {
+		id, err := cm.Subscribe("stress", func(ChangeEvent) {})
+		if err != nil {
+			t.Errorf("Subscribe: %v", err)
+			return
+		}
+		cm.Unsubscribe(id)
+	})
+
+	const versions = 100
+	for version := 1; version <= versions; version++ {
+		writeStressConfig(t, dir, version)
+		time.Sleep(5 * time.Millisecond)
+	}
+	close(stop)
+	wg.Wait()
+
+	// Monitoring is stopped while the watcher still drains its notifications.
+	cm.StopChangeMonitoring("stress")
+	if err := watcher.Stop(context.Background()); err != nil {
+		t.Fatalf("Watcher.Stop: %v", err)
+	}
+	if _, err := cm.CheckOnce("stress"); err != nil {
+		t.Fatalf("CheckOnce: %v", err)
+	}
+	if version, err := cm.Get("stress", "version"); err != nil || fmt.Sprint(version) != fmt.Sprint(versions) {
+		t.Fatalf("Get version = %v, %v, want %v", version, err, versions)
+	}
+	if changes.Load() == 0 || events.Load() == 0 {
+		t.Fatalf("got %d changes and %d events, want both to be reported", changes.Load(), events.Load())
+	}
+}
+
+func TestConcurrentMonitoringAndRemove(t *testing.T) {
+	cm, dir := newStressManager(t, func(string) {})
+	v, _ := cm.GetConfig("stress")
+	if err := cm.StartChangeMonitoring("stress", v); err != nil {
+		t.Fatalf("StartChangeMonitoring: %v", err)
+	}
+	watcher, err := cm.Watch()
+	if err != nil {
+		t.Fatalf("Watch: %v", err)
+	}
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	runFor(&wg, stop, 2, func(int) {
+		// Start fails once the configuration is removed below.
+		cm.StartChangeMonitoring("stress", v)
+	})
+	runFor(&wg, stop, 2, func(int) {
+		cm.StopChangeMonitoring("stress")
+		cm.MonitorState("stress")
+	})
+	runFor(&wg, stop, 1, func(i int) {
+		writeStressConfig(t, dir, i)
+		time.Sleep(time.Millisecond)
+	})
+
+	time.Sleep(200 * time.Millisecond)
+	if err := cm.RemoveConfig("stress"); err != nil {
+		t.Fatalf("RemoveConfig: %v", err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(stop)
+	wg.Wait()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := watcher.Stop(ctx); err != nil {
+		t.Fatalf("Watcher.Stop: %v", err)
+	}
+	if state := cm.MonitorState("stress"); state != MonitorIdle {
+		t.Fatalf("MonitorState after RemoveConfig = %v, want %v", state, MonitorIdle)
+	}
+}
@@ -0,0 +1,153 @@
+package mkconf
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ConfigDir is a directory whose configuration files are registered automatically, see AddConfigDir.
+type ConfigDir struct {
+	manager   *ConfigManager                // Manager the configurations are registered with
+	dir       string                        // Directory of the configuration files
+	pattern   string                        // Glob pattern the file names must match, e.g. "*.yaml"
+	factory   func(name string) interface{} // Function returning the value a configuration is decoded into
+	names     []string                      // Names of the configurations registered so far, in order
+	known     map[string]bool               // File names already registered or rejected
+	mu        sync.Mutex                    // Mutex for synchronizing scans
+	cancel    context.CancelFunc            // Function stopping the watching goroutine, if running
+	waitGroup sync.WaitGroup                // Wait group of the watching goroutine
+}
+
+// AddConfigDir registers every file in dir whose name matches pattern (see filepath.Match, e.g. "*.yaml") as a
+// configuration and loads it. A configuration is named after its file without the extension, which selects the
+// reader like the configType of AddConfig, e.g. "billing" for billing.json, and is decoded into the value factory
+// returns for its name. Local override files (see SetLocalOverlays) are not registered on their own. The files are
+// registered even if others fail; the error lists the failures. StartWatching on the returned directory registers
+// files dropped into it later.
+func (cm *ConfigManager) AddConfigDir(dir, pattern string, factory func(name string) interface{}) (*ConfigDir, error) {
+	if _, err := filepath.Match(pattern, ""); err != nil {
+		return nil, fmt.Errorf("config dir %v: %v", dir, err)
+	}
+	if factory == nil {
+		return nil, fmt.Errorf("config dir %v: no factory", dir)
+	}
+
+	d := &ConfigDir{manager: cm, dir: dir, pattern: pattern, factory: factory, known: make(map[string]bool)}
+	_, err := d.Refresh()
+	return d, err
+}
+
+// Names returns the names of the configurations registered from the directory, in the order they were registered.
+func (d *ConfigDir) Names() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]string(nil), d.names...)
+}
+
+// Refresh scans the directory once and registers and loads the files not registered yet, returning the names of
+// their configurations. A file that cannot be registered is reported once.
+func (d *ConfigDir) Refresh() ([]string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	entries, err := ioutil.ReadDir(d.dir)
+	if err != nil {
+		return nil, fmt.Errorf("config dir %v: %v", d.dir, err)
+	}
+	d.manager.configList.settingsMutex.Lock()
+	localOverlays := d.manager.configList.localOverlays
+	d.manager.configList.settingsMutex.Unlock()
+
+	var added, failures []string
+	for _, entry := range entries {
+		fileName := entry.Name()
+		if entry.IsDir() || d.known[fileName] {
+			continue
+		}
+		if matched, _ := filepath.Match(d.pattern, fileName); !matched {
+			continue
+		}
+		configType := fileConfigType(fileName)
+		name := strings.TrimSuffix(fileName, configType)
+		if configType == "" || name == "" || (localOverlays && strings.HasSuffix(name, ".local")) {
+			continue
+		}
+
+		d.known[fileName] = true
+		if err := d.manager.AddConfig(name, d.dir, configType, d.factory(name)); err != nil {
+			failures = append(failures, fmt.Sprintf("%v: %v", fileName, err))
+			continue
+		}
+		d.names = append(d.names, name)
+		added = append(added, name)
+		if err := d.manager.LoadConfig(name); err != nil {
+			failures = append(failures, fmt.Sprintf("%v: %v", fileName, err))
+		}
+	}
+
+	if len(failures) > 0 {
+		sort.Strings(failures)
+		return added, fmt.Errorf("config dir %v: %v", d.dir, strings.Join(failures, "; "))
+	}
+	return added, nil
+}
+
+// StartWatching scans the directory every interval and registers the files dropped into it, calling onAdd, if
+// set, with the name of every new configuration. Errors are reported through errorFunc if it is set.
+func (d *ConfigDir) StartWatching(interval time.Duration, onAdd func(name string), errorFunc func(err error)) error {
+	if interval <= 0 {
+		return fmt.Errorf("config dir %v: invalid interval %v", d.dir, interval)
+	}
+	d.StopWatching()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	d.mu.Lock()
+	d.cancel = cancel
+	d.mu.Unlock()
+
+	d.waitGroup.Add(1)
+	go func() {
+		defer d.waitGroup.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			added, err := d.Refresh()
+			if onAdd != nil {
+				for _, name := range added {
+					onAdd(name)
+				}
+			}
+			if err != nil && errorFunc != nil {
+				errorFunc(err)
+			}
+		}
+	}()
+	return nil
+}
+
+// StopWatching stops scanning the directory and waits for the watching goroutine to finish. The registered
+// configurations stay registered.
+func (d *ConfigDir) StopWatching() {
+	d.mu.Lock()
+	cancel := d.cancel
+	d.cancel = nil
+	d.mu.Unlock()
+
+	if cancel == nil {
+		return
+	}
+	cancel()
+	d.waitGroup.Wait()
+}
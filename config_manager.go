@@ -1,10 +1,16 @@
 package mkconf
 
 import (
+	"context"
 	"fmt"
+	"io"
+	"io/fs"
 	"path/filepath"
 	"strings"
 	"sync"
+	"sync/atomic"
+
+	reader "mkconf/readers"
 )
 
 // ChangeCallbackFunc is a function type used for change callbacks.
@@ -14,63 +20,115 @@ type ChangeCallbackFunc func(configName string)
 type TrackCallbackFunc func(configName string)
 
 // ConfigManager is a manager that handles the configuration settings and interfaces for multiple configurations.
+//
+// Concurrency contract:
+//   - All ConfigManager and ConfigList methods are safe for concurrent use once a configuration is added.
+//   - ConfigSettings setters (SetCheckSec, SetReader, ...) configure a configuration and must be called
+//     before its monitoring is started.
+//   - Change and tracking callbacks run on the WatchForChanges goroutines and may call any read-only method
+//     (GetConfig, GetSettings, LoadConfig, GetChangesForConfig, ...). Calls that stop monitoring of the
+//     config being dispatched (StopChangeMonitoring, UpdateConfig) must be made from a separate goroutine.
 type ConfigManager struct {
-	configList      *ConfigList                   // ConfigList instance to manage configuration settings and updates.
-	configs         map[string]interface{}        // Map to store configuration interfaces with their respective names.
-	changeCallbacks map[string]ChangeCallbackFunc // Map to store callback functions for each configuration.
-	trackCallback   map[string]TrackCallbackFunc  // Map to store tracking callback functions for each configuration.
+	configList         *ConfigList                     // ConfigList instance to manage configuration settings and updates.
+	configs            map[string]interface{}          // Map to store configuration interfaces with their respective names.
+	changeCallbacks    map[string]ChangeCallbackFunc   // Map to store callback functions for each configuration.
+	trackCallback      map[string]TrackCallbackFunc    // Map to store tracking callback functions for each configuration.
+	eventCallbacks     map[string]ChangeEventFunc      // Map to store change callbacks receiving a ChangeEvent for each configuration.
+	subscriptions      map[SubscriptionID]subscription // Map to store the listeners subscribed to change events.
+	lastSubscription   SubscriptionID                  // Identifier of the last subscription made.
+	groups             map[string]*configGroup         // Map to store groups of configurations applied together.
+	remoteSources      map[string]remoteSource         // Map to store remote sources watching configurations.
+	remoteManagers     map[string]*remoteManager       // Map to store other managers attached for the federated view.
+	retryPolicies      map[string]RetryPolicy          // Map to store the retry policies of remote configurations.
+	defaultRetryPolicy RetryPolicy                     // Retry policy of remote configurations without their own.
+	breakers           map[string]*circuitBreaker      // Map to store the circuit breakers of remote configurations.
+	retryMu            sync.Mutex                      // Mutex for synchronizing access to the retry policies and circuit breakers.
+	authorizer         Authorizer                      // Function authorizing Get and Set calls, if set.
+	errorFunc          atomic.Pointer[func(err error)] // Function receiving errors not returned to a caller, see SetErrorFunc.
+	callbackPool       *callbackPool                   // Pool running callbacks in CallbackAsync mode, started on first use, see StopCallbackWorkers.
+	callbackWorkers    int                             // Number of workers of the callback pool, see SetCallbackWorkers.
+	middleware         []CallbackMiddleware            // Middleware wrapping every callback, see UseCallbackMiddleware.
+	order              []string                        // Names of the configurations in registration order.
+	loadPriorities     map[string]int                  // Map to store the load priorities set with SetLoadPriority.
+	mu                 sync.RWMutex                    // Mutex for synchronizing access to the configs and callback maps.
 }
 
 // NewConfigManager creates a new instance of ConfigManager with an initialized ConfigList and an empty configs map.
 func NewConfigManager() *ConfigManager {
-	return &ConfigManager{
+	cm := &ConfigManager{
 		configList:      NewConfigList(),
 		configs:         make(map[string]interface{}),
 		changeCallbacks: map[string]ChangeCallbackFunc{},
 		trackCallback:   make(map[string]TrackCallbackFunc),
+		eventCallbacks:  make(map[string]ChangeEventFunc),
 	}
+	cm.configList.syncCallbacks = cm
+	cm.configList.errorFunc = cm.reportError
+	return cm
 }
 
 // AddConfig adds a new configuration to the manager with the specified name, path, type, and interface.
 // It associates the provided interface with the given name and sets up the corresponding configuration in the ConfigList.
 // Returns an error if a configuration with the same name already exists.
 func (cm *ConfigManager) AddConfig(configName, configPath, configType string, configInterface interface{}) error {
+	return cm.AddConfigFS(nil, configName, configPath, configType, configInterface)
+}
+
+// AddConfigFS adds a new configuration read from the given file system (e.g. an embed.FS) instead of the OS file system.
+// configPath is a slash-separated directory inside fsys; a nil fsys uses the OS file system like AddConfig.
+// Configurations on a file system that does not implement reader.WriteFileFS are read-only.
+func (cm *ConfigManager) AddConfigFS(fsys fs.FS, configName, configPath, configType string, configInterface interface{}) error {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
 	if _, ok := cm.configs[configName]; ok {
 		return fmt.Errorf("config with name %s already exists", configName)
 	}
+	if fsys == nil {
+		fsys = cm.localFilesFor(configType)
+	}
 
-	err := cm.configList.AddConfigList(configName, configPath, configType, configInterface)
+	err := cm.configList.addConfigList(fsys, configName, configPath, configType, configInterface)
 	if err != nil {
 		return err
 	}
 
 	cm.configs[configName] = configInterface
+	cm.order = append(cm.order, configName)
 	return nil
 }
 
 // AddConfigCallback adds a new configuration along with a change callback function.
 func (cm *ConfigManager) AddConfigCallback(configName, configPath, configType string, configInterface interface{}, callback ChangeCallbackFunc) error {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
 	if _, ok := cm.configs[configName]; ok {
 		return fmt.Errorf("config with name %s already exists", configName)
 	}
 
-	err := cm.configList.AddConfigList(configName, configPath, configType, configInterface)
+	err := cm.configList.addConfigList(cm.localFilesFor(configType), configName, configPath, configType, configInterface)
 	if err != nil {
 		return err
 	}
 
 	cm.configs[configName] = configInterface
+	cm.order = append(cm.order, configName)
 	cm.changeCallbacks[configName] = callback
 	return nil
 }
 
 // ChangeCallbackFunc sets a change callback function for a specific configuration.
 func (cm *ConfigManager) ChangeCallbackFunc(configName string, callback ChangeCallbackFunc) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
 	cm.changeCallbacks[configName] = callback
 }
 
 // ChangeCallbackFuncAll sets a change callback function for all configurations.
 func (cm *ConfigManager) ChangeCallbackFuncAll(callback ChangeCallbackFunc) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
 	for name := range cm.configs {
 		cm.changeCallbacks[name] = callback
 	}
@@ -78,11 +136,15 @@ func (cm *ConfigManager) ChangeCallbackFuncAll(callback ChangeCallbackFunc) {
 
 // TrackingCallbackFunc sets a tracking callback function for a specific configuration.
 func (cm *ConfigManager) TrackingCallbackFunc(configName string, callback TrackCallbackFunc) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
 	cm.trackCallback[configName] = callback
 }
 
 // TrackingCallbackFuncAll sets a tracking callback function for all configurations.
 func (cm *ConfigManager) TrackingCallbackFuncAll(callback TrackCallbackFunc) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
 	for name := range cm.configs {
 		cm.trackCallback[name] = callback
 	}
@@ -90,7 +152,7 @@ func (cm *ConfigManager) TrackingCallbackFuncAll(callback TrackCallbackFunc) {
 
 // GetSettings returns the ConfigSettings associated with the specified configuration name.
 func (cm *ConfigManager) GetSettings(configName string) *ConfigSettings {
-	return cm.configList.settings[configName]
+	return cm.configList.GetSettings(configName)
 }
 
 // GetConfigList returns the ConfigList instance associated with the ConfigManager.
@@ -101,24 +163,24 @@ func (cm *ConfigManager) GetConfigList(configName string) *ConfigList {
 // GetConfig returns the configuration interface associated with the specified name.
 // Returns an error if the configuration is not found.
 func (cm *ConfigManager) GetConfig(configName string) (interface{}, error) {
+	cm.mu.RLock()
 	configInterface, ok := cm.configs[configName]
+	cm.mu.RUnlock()
 	if !ok {
 		return nil, fmt.Errorf("config with name %s not found", configName)
 	}
 	return configInterface, nil
 }
 
-// LoadConfigs loads configurations for all registered interfaces in the manager.
-// It iterates through each configuration and loads the corresponding settings using ConfigList.
-// If any configuration fails to load, it logs an error and continues with the remaining configurations.
-// Returns a slice of errors encountered during the loading process.
+// LoadMultipleConfigs loads all registered configurations in load order (see LoadAllConfigs).
+// If any configuration fails to load, it continues with the remaining configurations.
+// Returns the errors encountered during the loading process, in load order.
 func (cm *ConfigManager) LoadMultipleConfigs() []error {
 	var loadErrors []error
 
-	for configName, configInterface := range cm.configs {
-		err := cm.configList.LoadConfig(configName, configInterface)
-		if err != nil {
-			loadErrors = append(loadErrors, fmt.Errorf("error loading config %s: %v", configName, err))
+	for _, result := range cm.LoadAllConfigs() {
+		if result.Err != nil {
+			loadErrors = append(loadErrors, fmt.Errorf("error loading config %s: %v", result.Name, result.Err))
 		}
 	}
 
@@ -126,7 +188,9 @@ func (cm *ConfigManager) LoadMultipleConfigs() []error {
 }
 
 func (cm *ConfigManager) LoadConfig(configName string) error {
+	cm.mu.RLock()
 	configInterface, isExist := cm.configs[configName]
+	cm.mu.RUnlock()
 	if isExist {
 		err := cm.configList.LoadConfig(configName, configInterface)
 		if err != nil {
@@ -139,10 +203,25 @@ func (cm *ConfigManager) LoadConfig(configName string) error {
 	return nil
 }
 
+// LoadConfigContext is like LoadConfig, but gives up once ctx is done, e.g. when its deadline passed, returning the
+// error of ctx. A load that was given up still completes in the background.
+func (cm *ConfigManager) LoadConfigContext(ctx context.Context, configName string) error {
+	return runContext(ctx, "error loading config "+configName, func() error { return cm.LoadConfig(configName) })
+}
+
+// LoadConfigFromReader loads the configuration with the specified name from a stream instead of its file.
+func (cm *ConfigManager) LoadConfigFromReader(configName string, r io.Reader) error {
+	configInterface, err := cm.GetConfig(configName)
+	if err != nil {
+		return err
+	}
+	return cm.configList.LoadConfigFromReader(configName, r, configInterface)
+}
+
 // PrintConfigs prints the names and interface values of all registered configurations.
 // Useful for debugging and checking the current state of registered configurations.
 func (cm *ConfigManager) PrintConfigs() {
-	for configName, configInterface := range cm.configs {
+	for configName, configInterface := range cm.configsSnapshot() {
 		fmt.Printf("%s - %v\n", configName, configInterface)
 	}
 }
@@ -151,6 +230,11 @@ func (cm *ConfigManager) PrintConfigs() {
 // It adds configurations using AddConfig method and then loads them using LoadConfigs method.
 // Returns a slice of errors encountered during the loading process, or nil if there are no errors.
 func (cm *ConfigManager) LoadConfigsFromPath(configPath string, configNames []string, configInterfaces []interface{}) []error {
+	return cm.LoadConfigsFromFS(nil, configPath, configNames, configInterfaces)
+}
+
+// LoadConfigsFromFS is like LoadConfigsFromPath, but reads the files from the given file system.
+func (cm *ConfigManager) LoadConfigsFromFS(fsys fs.FS, configPath string, configNames []string, configInterfaces []interface{}) []error {
 	if len(configNames) != len(configInterfaces) {
 		return []error{fmt.Errorf("number of config names does not match number of config interfaces")}
 	}
@@ -158,9 +242,8 @@ func (cm *ConfigManager) LoadConfigsFromPath(configPath string, configNames []st
 	var loadErrors []error
 
 	for i, configName := range configNames {
-		configBase := strings.TrimSuffix(configName, filepath.Ext(configName))
-		configType := filepath.Ext(configName)
-		if configType == "" {
+		configBase, configType := splitConfigFileName(configName)
+		if configType == "" && !cm.contentSniffingEnabled() {
 			loadErrors = append(loadErrors, fmt.Errorf("unable to determine config type for %s", configName))
 			continue
 		}
@@ -168,7 +251,7 @@ func (cm *ConfigManager) LoadConfigsFromPath(configPath string, configNames []st
 		configType = strings.ToLower(configType)
 		configInterface := configInterfaces[i]
 
-		err := cm.AddConfig(configBase, configPath, configType, configInterface)
+		err := cm.AddConfigFS(fsys, configBase, configPath, configType, configInterface)
 		if err != nil {
 			loadErrors = append(loadErrors, err)
 		}
@@ -181,6 +264,17 @@ func (cm *ConfigManager) LoadConfigsFromPath(configPath string, configNames []st
 	return loadErrors
 }
 
+// splitConfigFileName splits a file name into the config name and the config type.
+// Compressed files keep their format extension in the type, e.g. ".json.gz".
+func splitConfigFileName(fileName string) (string, string) {
+	configType := filepath.Ext(fileName)
+	if compressionExt := reader.CompressionExt(fileName); compressionExt != "" {
+		trimmed := fileName[:len(fileName)-len(compressionExt)]
+		configType = filepath.Ext(trimmed) + fileName[len(trimmed):]
+	}
+	return strings.TrimSuffix(fileName, configType), configType
+}
+
 // StartChangeMonitoring starts change monitoring for a specific configuration.
 // It enables the validation of changes and starts a goroutine to watch for changes in the configuration.
 // The method returns an error if the specified configuration is not found.
@@ -188,102 +282,99 @@ func (cm *ConfigManager) StartChangeMonitoring(configName string, v interface{})
 	return cm.configList.StartChangeMonitoring(configName, v)
 }
 
+// StartChangeMonitoringContext is like StartChangeMonitoring, but ties the monitoring to ctx instead of the
+// lifetime of the manager: it is stopped once ctx is done, e.g. when the request or service owning it ends.
+func (cm *ConfigManager) StartChangeMonitoringContext(ctx context.Context, configName string, v interface{}) error {
+	return cm.configList.StartChangeMonitoringContext(ctx, configName, v)
+}
+
 // StopChangeMonitoring stops change monitoring for a specific configuration.
 // It cancels the change monitoring goroutine and waits for it to finish.
 func (cm *ConfigManager) StopChangeMonitoring(configName string) {
 	cm.configList.StopChangeMonitoring(configName)
 }
 
-// StartAllChangeMonitoring starts change monitoring for all configurations that have change validation enabled.
-// It iterates through all configurations and starts change monitoring for each one.
-func (cm *ConfigManager) StartAllChangeMonitoring() {
-	for configName, settings := range cm.configList.settings {
-		if !settings.enableChangeValidation {
-			cm.StartChangeMonitoring(configName, settings.config)
+// MonitorState returns the state of the change monitoring of a specific configuration.
+func (cm *ConfigManager) MonitorState(configName string) MonitorState {
+	return cm.configList.MonitorState(configName)
+}
+
+// MonitorResult is the outcome of a bulk monitoring operation for one configuration.
+type MonitorResult struct {
+	Changed bool         // Flag indicating the operation started or stopped the monitoring
+	State   MonitorState // State of the monitoring after the operation
+	Error   error        // Error starting the monitoring, if any
+}
+
+// StartAllChangeMonitoring starts change monitoring for all configurations that are not monitored yet.
+// It is idempotent: running monitors are left untouched, as are configurations watched by a remote source.
+// Returns the result for every configuration, keyed by name.
+func (cm *ConfigManager) StartAllChangeMonitoring() map[string]MonitorResult {
+	results := make(map[string]MonitorResult)
+	for configName := range cm.configList.settingsSnapshot() {
+		cm.mu.RLock()
+		v, ok := cm.configs[configName]
+		_, remote := cm.remoteSources[configName]
+		cm.mu.RUnlock()
+
+		state := cm.MonitorState(configName)
+		if !ok || remote || state == MonitorRunning {
+			results[configName] = MonitorResult{State: state}
+			continue
 		}
+		err := cm.StartChangeMonitoring(configName, v)
+		results[configName] = MonitorResult{Changed: err == nil, State: cm.MonitorState(configName), Error: err}
 	}
+	return results
 }
 
-// StopAllChangeMonitoring stops change monitoring for all configurations that have change validation disabled.
-// It iterates through all configurations and stops change monitoring for each one.
-func (cm *ConfigManager) StopAllChangeMonitoring() {
-	for configName, settings := range cm.configList.settings {
-		if settings.enableChangeValidation {
-			cm.StopChangeMonitoring(configName)
+// StopAllChangeMonitoring stops change monitoring for all configurations whose monitoring is running.
+// It is idempotent: idle monitors are left untouched. Returns the result for every configuration, keyed by name.
+func (cm *ConfigManager) StopAllChangeMonitoring() map[string]MonitorResult {
+	results := make(map[string]MonitorResult)
+	for configName := range cm.configList.settingsSnapshot() {
+		state := cm.MonitorState(configName)
+		if state == MonitorIdle {
+			results[configName] = MonitorResult{State: state}
+			continue
 		}
+		cm.StopChangeMonitoring(configName)
+		results[configName] = MonitorResult{Changed: true, State: cm.MonitorState(configName)}
 	}
+	return results
 }
 
-// WatchForChanges starts watching for changes in configurations.
-// It iterates through all configurations and launches goroutines to handle change validation and tracking.
-// It waits for all goroutines to finish using a WaitGroup before returning.
-// Returns an error if change or track callback functions are not set for any configuration.
+// WatchForChanges starts watching for changes in configurations like Watch, and blocks until all watched
+// configurations are removed. Returns an error if change or track callback functions are not set for any configuration.
+//
+// Deprecated: WatchForChanges blocks and cannot be stopped; use Watch, which returns immediately with a Watcher
+// that is stopped with Watcher.Stop.
 func (cm *ConfigManager) WatchForChanges() error {
-	var wg sync.WaitGroup
-
-	// Iterate through all configurations
-	for _, configName := range cm.configList.GetConfigNames() {
-		// Get settings for the current configuration
-		settings := cm.configList.GetSettings(configName)
-
-		// Handle change validation
-		if settings.enableChangeValidation {
-			var changeCallback ChangeCallbackFunc
-			// Check if change callback function is set for the configuration
-			if cb, ok := cm.changeCallbacks[configName]; ok {
-				changeCallback = cb
-			}
-
-			// Launch goroutine to handle change validation
-			if changeCallback != nil {
-				wg.Add(1)
-				go func(ch <-chan string, cb ChangeCallbackFunc) {
-					defer wg.Done()
-					// Listen for changes in the channel and invoke the callback function
-					for name := range ch {
-						cb(name)
-					}
-				}(settings.Ch_ConfigChanged, changeCallback)
-			} else {
-				// Return error if change callback function is not set
-				return fmt.Errorf("change callback function not set for config '%s'", configName)
-			}
-		}
-
-		// Handle change tracking
-		if settings.enableChangeTracking {
-			var trackCallback TrackCallbackFunc
-			// Check if track callback function is set for the configuration
-			if cb, ok := cm.trackCallback[configName]; ok {
-				trackCallback = cb
-			}
-
-			// Launch goroutine to handle change tracking
-			if trackCallback != nil {
-				wg.Add(1)
-				go func(ch <-chan string, cb TrackCallbackFunc) {
-					defer wg.Done()
-					// Listen for changes in the channel and invoke the callback function
-					for name := range ch {
-						cb(name)
-					}
-				}(settings.Ch_ConfigTracking, trackCallback)
-			} else {
-				// Return error if track callback function is not set
-				return fmt.Errorf("track callback function not set for config '%s'", configName)
-			}
-		}
+	watcher, err := cm.Watch()
+	if err != nil {
+		return err
 	}
-
-	// Wait for all goroutines to finish
-	wg.Wait()
-
+	<-watcher.Done()
 	return nil
 }
 
+// configsSnapshot returns a copy of the configs map, so it can be iterated without holding the manager lock.
+func (cm *ConfigManager) configsSnapshot() map[string]interface{} {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+	snapshot := make(map[string]interface{}, len(cm.configs))
+	for name, configInterface := range cm.configs {
+		snapshot[name] = configInterface
+	}
+	return snapshot
+}
+
 // GetConfigNames returns a slice containing the names of all configurations in the ConfigList.
 // It iterates through the settings map and collects the names of each configuration.
 func (c *ConfigList) GetConfigNames() []string {
+	c.settingsMutex.Lock()
+	defer c.settingsMutex.Unlock()
+
 	var names []string
 	for name := range c.settings {
 		names = append(names, name)
@@ -293,9 +384,34 @@ func (c *ConfigList) GetConfigNames() []string {
 
 // UpdateConfig updates the specified configuration with a new interface.
 // It delegates the update operation to the ConfigList.
+// Returns ErrReadOnlySource (wrapped) if the configuration's reader cannot write.
 func (cm *ConfigManager) UpdateConfig(configName string, configInterface interface{}) error {
-	cm.configList.UpdateConfig(configName, configInterface)
-	return nil
+	return cm.configList.UpdateConfig(configName, configInterface)
+}
+
+// UpdateConfigContext is like UpdateConfig, but gives up once ctx is done, returning the error of ctx. An update
+// that was given up still completes in the background.
+func (cm *ConfigManager) UpdateConfigContext(ctx context.Context, configName string, configInterface interface{}) error {
+	return runContext(ctx, "update config "+configName, func() error { return cm.UpdateConfig(configName, configInterface) })
+}
+
+// runContext runs fn and returns its error, or the error of ctx prefixed with op if ctx is done first.
+// fn is not run if ctx is done already.
+func runContext(ctx context.Context, op string, fn func() error) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if ctx.Done() == nil {
+		return fn()
+	}
+	result := make(chan error, 1)
+	go func() { result <- fn() }()
+	select {
+	case err := <-result:
+		return err
+	case <-ctx.Done():
+		return fmt.Errorf("%s: %w", op, ctx.Err())
+	}
 }
 
 // UpdateConfigs updates multiple configurations with new interfaces.
@@ -320,20 +436,24 @@ func (cm *ConfigManager) UpdateConfigs(configNames []string, configInterfaces []
 // StartAllLogChanges starts logging changes for all configurations.
 // It iterates through all configurations and enables change tracking for those which do not have change validation enabled.
 func (cm *ConfigManager) StartAllLogChanges() {
-	for _, settings := range cm.configList.settings {
+	for _, settings := range cm.configList.settingsSnapshot() {
+		settings.mu.Lock()
 		if !settings.enableChangeValidation {
 			settings.SetChangeTracking(true)
 		}
+		settings.mu.Unlock()
 	}
 }
 
 // StopAllLogChanges stops logging changes for all configurations.
 // It iterates through all configurations and disables change tracking for those which have change validation enabled.
 func (cm *ConfigManager) StopAllLogChanges() {
-	for _, settings := range cm.configList.settings {
+	for _, settings := range cm.configList.settingsSnapshot() {
+		settings.mu.Lock()
 		if settings.enableChangeValidation {
 			settings.SetChangeTracking(false)
 		}
+		settings.mu.Unlock()
 	}
 }
 
@@ -342,8 +462,8 @@ func (cm *ConfigManager) StopAllLogChanges() {
 func (cm *ConfigManager) GetAllLogChanges() map[string]chan string {
 	allChanLogChanges := make(map[string]chan string)
 
-	for configName, settings := range cm.configList.settings {
-		if settings.enableChangeValidation {
+	for configName, settings := range cm.configList.settingsSnapshot() {
+		if settings.changeValidationEnabled() {
 			allChanLogChanges[configName] = cm.configList.GetChanLogChanges(configName)
 		}
 	}
@@ -356,8 +476,8 @@ func (cm *ConfigManager) GetAllLogChanges() map[string]chan string {
 func (cm *ConfigManager) GetLogChanges(confName string) map[string]chan string {
 	allChanLogChanges := make(map[string]chan string)
 
-	for configName, settings := range cm.configList.settings {
-		if settings.enableChangeValidation && configName == confName {
+	for configName, settings := range cm.configList.settingsSnapshot() {
+		if settings.changeValidationEnabled() && configName == confName {
 			allChanLogChanges[configName] = cm.configList.GetChanLogChanges(configName)
 		}
 		break
@@ -369,9 +489,6 @@ func (cm *ConfigManager) GetLogChanges(confName string) map[string]chan string {
 // GetChangesForConfig waits for changes for a specific configuration.
 // It takes the configuration name as a parameter and returns a slice of ConfigChangeLog for that configuration.
 func (cm *ConfigManager) GetChangesForConfig(configName string) []ConfigChangeLog {
-	cm.configList.logMutex.Lock()
-	defer cm.configList.logMutex.Unlock()
-
 	changes := make([]ConfigChangeLog, 0)
 	changes = append(changes, cm.configList.GetLogChanges(configName)...)
 
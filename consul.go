@@ -0,0 +1,277 @@
+package mkconf
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// consulWaitTime is the maximum time a Consul blocking query waits for a change.
+const consulWaitTime = 5 * time.Minute
+
+// ConsulConfigSource is a configuration stored under a Consul KV key. The value can be in any registered format.
+// Like EtcdConfigSource, it is exposed to the manager as a file system; changes are detected with Consul blocking
+// queries and delivered through the same callbacks and change logs as file changes.
+// Requests are authenticated with the CONSUL_HTTP_TOKEN environment variable if it is set.
+type ConsulConfigSource struct {
+	address    string             // Base URL of the Consul agent
+	key        string             // KV key holding the configuration
+	configName string             // Name of the registered configuration
+	manager    *ConfigManager     // Manager the configuration is registered with
+	client     *http.Client       // Client used for requests
+	source     SourceOptions      // TLS, proxy and token provider settings
+	content    []byte             // Last value read from Consul
+	loaded     bool               // Flag indicating content holds a value
+	index      uint64             // Consul index the content was read at
+	mu         sync.Mutex         // Mutex for synchronizing access to the content
+	cancel     context.CancelFunc // Function canceling the running watch
+	waitGroup  sync.WaitGroup     // WaitGroup to wait for the watch goroutine
+}
+
+// AddRemoteConfig registers a configuration loaded from a Consul KV key. consulAddr is the agent address
+// (e.g. "127.0.0.1:8500" or "https://consul:8501") and format selects the reader (e.g. ".json").
+// UpdateConfig writes the value back to the key. Call StartWatching on the returned source to apply changes
+// as soon as they are made.
+func (cm *ConfigManager) AddRemoteConfig(configName, consulAddr, key, format string, configInterface interface{}) (*ConsulConfigSource, error) {
+	return cm.AddRemoteConfigWithOptions(configName, consulAddr, key, format, configInterface, SourceOptions{})
+}
+
+// AddRemoteConfigWithOptions is like AddRemoteConfig with TLS, proxy and token provider settings for the agent.
+// A provided token is sent as the Consul token instead of CONSUL_HTTP_TOKEN.
+func (cm *ConfigManager) AddRemoteConfigWithOptions(configName, consulAddr, key, format string, configInterface interface{}, options SourceOptions) (*ConsulConfigSource, error) {
+	if consulAddr == "" {
+		return nil, fmt.Errorf("consul config %v: no address", configName)
+	}
+	if !strings.Contains(consulAddr, "://") {
+		consulAddr = "http://" + consulAddr
+	}
+
+	s := &ConsulConfigSource{
+		address:    strings.TrimSuffix(consulAddr, "/"),
+		key:        strings.TrimPrefix(key, "/"),
+		configName: configName,
+		manager:    cm,
+		source:     options,
+	}
+	client, err := options.httpClient(nil)
+	if err != nil {
+		return nil, fmt.Errorf("consul config %v: %v", configName, err)
+	}
+	s.client = client
+	if err := cm.AddConfigFS(s, configName, "", format, configInterface); err != nil {
+		return nil, err
+	}
+	cm.addRemoteSource(configName, s)
+	return s, nil
+}
+
+// Open implements fs.FS. Every name resolves to the value of the key; it is fetched if it was not read yet.
+func (s *ConsulConfigSource) Open(name string) (fs.File, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.loaded {
+		content, index, err := s.get(context.Background(), 0)
+		if err != nil {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+		}
+		s.content, s.index, s.loaded = content, index, true
+	}
+	return newRemoteFile(name, s.content), nil
+}
+
+// WriteFile implements reader.WriteFileFS by putting the content to the key.
+func (s *ConsulConfigSource) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	req, err := s.newRequest(context.Background(), http.MethodPut, nil, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("consul put %v: %v", s.key, err)
+	}
+	defer resp.Body.Close()
+
+	result, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("consul put %v: unexpected status %v: %s", s.key, resp.Status, bytes.TrimSpace(result))
+	}
+	if strings.TrimSpace(string(result)) != "true" {
+		return fmt.Errorf("consul put %v: write was not applied", s.key)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.content = append([]byte(nil), data...)
+	s.loaded = true
+	return nil
+}
+
+// Refresh re-reads the key and loads the configuration from its current value.
+// It is not needed while the source is watched.
+func (s *ConsulConfigSource) Refresh() error {
+	content, index, err := s.get(context.Background(), 0)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.content, s.index, s.loaded = content, index, true
+	s.mu.Unlock()
+	return s.manager.LoadConfig(s.configName)
+}
+
+// StartWatching watches the key with blocking queries and applies every change as soon as Consul reports it.
+// Errors are reported through errorFunc if it is set; the watch is retried after them.
+func (s *ConsulConfigSource) StartWatching(errorFunc func(err error)) error {
+	s.StopWatching()
+	errorFunc = quietCircuitErrors(errorFunc)
+	if err := s.manager.setRemoteWatching(s.configName, true); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.mu.Lock()
+	s.cancel = cancel
+	s.mu.Unlock()
+
+	s.waitGroup.Add(1)
+	s.manager.configList.resources.acquire(s.configName, resourceRemoteWatch)
+	go func() {
+		defer s.waitGroup.Done()
+		defer s.manager.configList.resources.release(s.configName, resourceRemoteWatch)
+		for {
+			err := s.watch(ctx)
+			if ctx.Err() != nil {
+				return
+			}
+			if err != nil {
+				if errorFunc != nil {
+					errorFunc(err)
+				}
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(time.Second):
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+// StopWatching stops watching the key and waits for the watch to finish.
+func (s *ConsulConfigSource) StopWatching() {
+	s.mu.Lock()
+	cancel := s.cancel
+	s.cancel = nil
+	s.mu.Unlock()
+
+	if cancel == nil {
+		return
+	}
+	cancel()
+	s.waitGroup.Wait()
+	s.manager.setRemoteWatching(s.configName, false)
+}
+
+// watch runs a single blocking query and applies the value if it changed.
+func (s *ConsulConfigSource) watch(ctx context.Context) error {
+	s.mu.Lock()
+	index := s.index
+	s.mu.Unlock()
+
+	content, newIndex, err := s.get(ctx, index)
+	if err != nil {
+		return err
+	}
+	if newIndex < index {
+		// The index went backwards (e.g. after a snapshot restore); start over.
+		newIndex = 0
+	}
+
+	s.mu.Lock()
+	changed := !bytes.Equal(s.content, content)
+	s.content, s.index, s.loaded = content, newIndex, true
+	s.mu.Unlock()
+
+	if !changed {
+		return nil
+	}
+	return s.manager.applyRemoteChange(s.configName)
+}
+
+// get calls getOnce according to the retry policy and circuit breaker of the configuration.
+func (s *ConsulConfigSource) get(ctx context.Context, index uint64) ([]byte, uint64, error) {
+	var content []byte
+	var newIndex uint64
+	err := s.manager.retryFetch(ctx, s.configName, func() error {
+		var err error
+		content, newIndex, err = s.getOnce(ctx, index)
+		return err
+	})
+	return content, newIndex, err
+}
+
+// getOnce reads the value of the key. A non-zero index turns the request into a blocking query
+// that returns once the key changed after index or the wait time elapsed.
+func (s *ConsulConfigSource) getOnce(ctx context.Context, index uint64) ([]byte, uint64, error) {
+	query := url.Values{"raw": {""}}
+	if index > 0 {
+		query.Set("index", strconv.FormatUint(index, 10))
+		query.Set("wait", consulWaitTime.String())
+	}
+	req, err := s.newRequest(ctx, http.MethodGet, query, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, 0, fmt.Errorf("consul get %v: %v", s.key, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, 0, fmt.Errorf("consul get %v: key not found", s.key)
+	}
+	if resp.StatusCode != http.StatusOK {
+		message, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, 0, fmt.Errorf("consul get %v: unexpected status %v: %s", s.key, resp.Status, bytes.TrimSpace(message))
+	}
+	content, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, 0, fmt.Errorf("consul get %v: %v", s.key, err)
+	}
+	newIndex, _ := strconv.ParseUint(resp.Header.Get("X-Consul-Index"), 10, 64)
+	s.manager.sourceReached(s.configName)
+	return content, newIndex, nil
+}
+
+// newRequest creates a request for the key with the given query parameters.
+func (s *ConsulConfigSource) newRequest(ctx context.Context, method string, query url.Values, body io.Reader) (*http.Request, error) {
+	target := s.address + "/v1/kv/" + s.key
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, body)
+	if err != nil {
+		return nil, err
+	}
+	token, err := s.source.token(ctx, os.Getenv("CONSUL_HTTP_TOKEN"))
+	if err != nil {
+		return nil, err
+	}
+	if token != "" {
+		req.Header.Set("X-Consul-Token", token)
+	}
+	return req, nil
+}
@@ -0,0 +1,172 @@
+package mkconf
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"os"
+	"sort"
+	"sync"
+)
+
+// ControlArgs holds the arguments of control requests addressing a configuration.
+type ControlArgs struct {
+	Name string // Name of the configuration
+}
+
+// ControlService implements the methods of the control interface. It is exported for net/rpc only;
+// use ServeControl to start a control server.
+type ControlService struct {
+	manager *ConfigManager // Manager controlled by the service
+}
+
+// List returns the status of all configurations ordered by name.
+func (s *ControlService) List(_ ControlArgs, reply *[]ConfigStatus) error {
+	status := s.manager.Status()
+	list := make([]ConfigStatus, 0, len(status))
+	for _, configStatus := range status {
+		list = append(list, configStatus)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	*reply = list
+	return nil
+}
+
+// Get returns the effective value of a configuration.
+func (s *ControlService) Get(args ControlArgs, reply *json.RawMessage) error {
+	value, err := s.manager.effectiveConfig(args.Name)
+	if err != nil {
+		return err
+	}
+	*reply = value
+	return nil
+}
+
+// Reload loads a configuration from its file.
+func (s *ControlService) Reload(args ControlArgs, reply *bool) error {
+	if err := s.manager.LoadConfig(args.Name); err != nil {
+		return err
+	}
+	*reply = true
+	return nil
+}
+
+// Diff returns a line diff between the applied content of a configuration and its current file, preceded by
+// the impacts of the changed values.
+func (s *ControlService) Diff(args ControlArgs, reply *string) error {
+	diff, err := s.manager.Diff(args.Name)
+	if err != nil {
+		return err
+	}
+	*reply = diff
+	return nil
+}
+
+// Approve applies the change of a configuration that is waiting for approval.
+func (s *ControlService) Approve(args ControlArgs, reply *bool) error {
+	if err := s.manager.ApproveChange(args.Name); err != nil {
+		return err
+	}
+	*reply = true
+	return nil
+}
+
+// ControlServer is a JSON-RPC control endpoint on a local unix socket for CLI tooling and automation.
+// It is disabled by default and started with ServeControl.
+//
+// The protocol is JSON-RPC 1.0 as implemented by net/rpc/jsonrpc, with the methods Control.List, Control.Get,
+// Control.Reload, Control.Diff and Control.Approve, each taking {"Name": "<config>"} as its single parameter:
+//
+//	{"method": "Control.Get", "params": [{"Name": "app"}], "id": 1}
+type ControlServer struct {
+	listener  net.Listener          // Unix socket listener
+	path      string                // Path of the socket file; empty for listeners passed to ServeControlListener
+	server    *rpc.Server           // RPC server dispatching to the ControlService
+	conns     map[net.Conn]struct{} // Open connections, closed when the server is closed
+	mu        sync.Mutex            // Mutex for synchronizing access to conns
+	waitGroup sync.WaitGroup        // WaitGroup to wait for the accept loop and connections
+}
+
+// ServeControl starts a ControlServer on the unix socket at socketPath, replacing a stale socket file.
+// The socket is only accessible by the owner of the process. Close the server to stop it.
+func (cm *ConfigManager) ServeControl(socketPath string) (*ControlServer, error) {
+	server := rpc.NewServer()
+	if err := server.RegisterName("Control", &ControlService{manager: cm}); err != nil {
+		return nil, fmt.Errorf("control server: %v", err)
+	}
+
+	if info, err := os.Lstat(socketPath); err == nil && info.Mode()&os.ModeSocket != 0 {
+		os.Remove(socketPath)
+	}
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return nil, fmt.Errorf("control server: %v", err)
+	}
+	if err := os.Chmod(socketPath, 0600); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("control server: %v", err)
+	}
+
+	s := cm.serveControl(listener, server)
+	s.path = socketPath
+	return s, nil
+}
+
+// ServeControlListener starts a ControlServer on an existing listener, e.g. a TCP listener, so other
+// managers can attach this one with AttachRemoteManager. Access control is up to the caller; the server
+// accepts every connection. Close the server to stop it; the listener is closed with it.
+func (cm *ConfigManager) ServeControlListener(listener net.Listener) (*ControlServer, error) {
+	server := rpc.NewServer()
+	if err := server.RegisterName("Control", &ControlService{manager: cm}); err != nil {
+		return nil, fmt.Errorf("control server: %v", err)
+	}
+	return cm.serveControl(listener, server), nil
+}
+
+// serveControl starts serving server on listener.
+func (cm *ConfigManager) serveControl(listener net.Listener, server *rpc.Server) *ControlServer {
+	s := &ControlServer{listener: listener, server: server, conns: make(map[net.Conn]struct{})}
+	s.waitGroup.Add(1)
+	go s.serve()
+	return s
+}
+
+// Close stops the server, closes open connections and removes the socket file, if any.
+func (s *ControlServer) Close() error {
+	err := s.listener.Close()
+	s.mu.Lock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+	s.waitGroup.Wait()
+	if s.path != "" {
+		os.Remove(s.path)
+	}
+	return err
+}
+
+// serve accepts connections until the listener is closed.
+func (s *ControlServer) serve() {
+	defer s.waitGroup.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.conns[conn] = struct{}{}
+		s.mu.Unlock()
+
+		s.waitGroup.Add(1)
+		go func() {
+			defer s.waitGroup.Done()
+			s.server.ServeCodec(jsonrpc.NewServerCodec(conn))
+			s.mu.Lock()
+			delete(s.conns, conn)
+			s.mu.Unlock()
+		}()
+	}
+}
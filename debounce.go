@@ -0,0 +1,55 @@
+package mkconf
+
+import (
+	"fmt"
+	"time"
+)
+
+// SetDebounce sets a debounce window for the specified configuration: a changed file is only applied once its
+// content stayed the same for window, so editors and CI jobs writing a file several times in quick succession
+// cause one reload and one callback with the final content instead of one per write. Change monitoring checks
+// again when the window ends; CheckOnce applies the content on the first call after it. Changes approved with
+// ApproveChange are not delayed. A zero window, the default, applies changes as soon as they are detected.
+func (cm *ConfigManager) SetDebounce(configName string, window time.Duration) error {
+	settings, ok := cm.configList.getSettings(configName)
+	if !ok {
+		return fmt.Errorf("config with name %s not found", configName)
+	}
+	if window < 0 {
+		return fmt.Errorf("config %v: negative debounce window %v", configName, window)
+	}
+	settings.mu.Lock()
+	defer settings.mu.Unlock()
+	settings.debounce = window
+	settings.debounceHash = ""
+	return nil
+}
+
+// debouncing reports whether applying the changed content with the given hash must wait, because it was first
+// seen less than the debounce window ago. Content seen for the first time starts the window. The caller must hold
+// c.mu.
+func (c *ConfigSettings) debouncing(hash string) bool {
+	if c.debounce <= 0 || hash == c.approvedHash {
+		return false
+	}
+	now := time.Now()
+	if hash != c.debounceHash {
+		c.debounceHash, c.debounceSince = hash, now
+		return true
+	}
+	return now.Sub(c.debounceSince) < c.debounce
+}
+
+// debounceWait returns the time until the debounce window of changed content ends, or zero if no change waits.
+func (c *ConfigSettings) debounceWait() time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.debounce <= 0 || c.debounceHash == "" {
+		return 0
+	}
+	if wait := c.debounce - time.Since(c.debounceSince); wait > 0 {
+		return wait
+	}
+	// The window ended while the check was running; check again right away.
+	return time.Millisecond
+}
@@ -0,0 +1,155 @@
+package mkconf
+
+import (
+	"fmt"
+)
+
+// DeliveryPolicy selects what happens when a change notification cannot be delivered because the consumer, e.g.
+// the WatchForChanges goroutine running a slow callback, has not received the previous ones yet.
+type DeliveryPolicy int
+
+const (
+	DeliverBlock          DeliveryPolicy = iota // Wait for the consumer, holding up the monitoring of the configuration
+	DeliverDropOldest                           // Drop the oldest buffered notification to make room
+	DeliverCoalesceLatest                       // Merge the buffered notifications with the new one, so the consumer gets the latest state once
+)
+
+// String returns the name of the policy.
+func (p DeliveryPolicy) String() string {
+	switch p {
+	case DeliverBlock:
+		return "block"
+	case DeliverDropOldest:
+		return "drop-oldest"
+	case DeliverCoalesceLatest:
+		return "coalesce-latest"
+	}
+	return fmt.Sprintf("DeliveryPolicy(%d)", int(p))
+}
+
+// MarshalText encodes the policy by its name, e.g. for JSON status output.
+func (p DeliveryPolicy) MarshalText() ([]byte, error) {
+	return []byte(p.String()), nil
+}
+
+// UnmarshalText decodes a policy encoded by MarshalText.
+func (p *DeliveryPolicy) UnmarshalText(text []byte) error {
+	for _, policy := range []DeliveryPolicy{DeliverBlock, DeliverDropOldest, DeliverCoalesceLatest} {
+		if string(text) == policy.String() {
+			*p = policy
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown delivery policy %q", text)
+}
+
+// SetDelivery sets how the change notifications of the specified configuration are delivered to their consumer:
+// the channels Ch_ConfigChanged and Ch_ConfigTracking and the events of ChangeEventFunc and Subscribe are buffered
+// for up to buffer notifications, and policy decides what happens once a buffer is full. With DeliverBlock, the
+// default, monitoring waits for the consumer, as with the unbuffered channels used without SetDelivery. The other
+// policies never wait, so a slow consumer cannot hold up monitoring, and need a buffer of at least one, which is
+// used if buffer is smaller. Notifications dropped or merged are counted in ConfigStatus.DroppedDeliveries.
+// SetDelivery replaces the channels, so it must be called before monitoring and watching are started; it fails
+// while monitoring is running.
+func (cm *ConfigManager) SetDelivery(configName string, buffer int, policy DeliveryPolicy) error {
+	settings, ok := cm.configList.getSettings(configName)
+	if !ok {
+		return fmt.Errorf("config with name %s not found", configName)
+	}
+	if buffer < 0 {
+		return fmt.Errorf("set delivery of config %s: negative buffer %d", configName, buffer)
+	}
+	if policy != DeliverBlock && buffer < 1 {
+		buffer = 1
+	}
+	settings.mu.Lock()
+	defer settings.mu.Unlock()
+	if settings.monitorState != MonitorIdle {
+		return fmt.Errorf("set delivery of config %s: monitoring is %v", configName, settings.monitorState)
+	}
+	settings.deliveryPolicy = policy
+	settings.Ch_ConfigChanged = make(chan string, buffer)
+	settings.Ch_ConfigTracking = make(chan string, buffer)
+	settings.ch_ConfigEvents = make(chan ChangeEvent, buffer)
+	return nil
+}
+
+// delivery returns the delivery policy of the configuration.
+func (c *ConfigSettings) delivery() DeliveryPolicy {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.deliveryPolicy
+}
+
+// deliverName sends the name of the configuration on ch following its delivery policy, until the configuration is
+// removed. As all notifications on ch carry the same name, dropping the oldest and coalescing both drop the new one
+// if ch is full: the buffered one already tells the consumer to look at the latest state.
+func (c *ConfigSettings) deliverName(ch chan string, name string) {
+	if c.delivery() == DeliverBlock {
+		select {
+		case ch <- name:
+		case <-c.ch_ChangeValidation:
+		}
+		return
+	}
+	select {
+	case ch <- name:
+	default:
+		c.droppedDeliveries.Add(1)
+	}
+}
+
+// deliverEvent sends the event on the event channel of the configuration following its delivery policy, until the
+// configuration is removed.
+func (c *ConfigSettings) deliverEvent(event ChangeEvent) {
+	policy := c.delivery()
+	if policy == DeliverBlock {
+		select {
+		case c.ch_ConfigEvents <- event:
+		case <-c.ch_ChangeValidation:
+		}
+		return
+	}
+	for {
+		select {
+		case c.ch_ConfigEvents <- event:
+			return
+		default:
+		}
+		if policy == DeliverDropOldest {
+			select {
+			case <-c.ch_ConfigEvents:
+				c.droppedDeliveries.Add(1)
+			default:
+			}
+			continue
+		}
+		// Merge all buffered events, oldest first, into the new one, so the events stay in order.
+		var pending []ChangeEvent
+	drain:
+		for {
+			select {
+			case older := <-c.ch_ConfigEvents:
+				pending = append(pending, older)
+			default:
+				break drain
+			}
+		}
+		if len(pending) > 0 {
+			c.droppedDeliveries.Add(uint64(len(pending)))
+			merged := pending[0]
+			for _, older := range pending[1:] {
+				merged = mergeEvents(merged, older)
+			}
+			event = mergeEvents(merged, event)
+		}
+	}
+}
+
+// mergeEvents returns an event covering the older event and the newer one following it.
+func mergeEvents(older, newer ChangeEvent) ChangeEvent {
+	merged := newer
+	merged.OldSnapshot = older.OldSnapshot
+	merged.Changes = append(append([]ConfigChangeLog(nil), older.Changes...), newer.Changes...)
+	return merged
+}
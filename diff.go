@@ -0,0 +1,84 @@
+package mkconf
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// lineDiff returns a line-based diff of two texts, prefixing removed lines with "-",
+// added lines with "+" and unchanged lines with a space.
+func lineDiff(oldText, newText string) string {
+	oldLines := strings.Split(strings.TrimSuffix(oldText, "\n"), "\n")
+	newLines := strings.Split(strings.TrimSuffix(newText, "\n"), "\n")
+	if oldText == "" {
+		oldLines = nil
+	}
+	if newText == "" {
+		newLines = nil
+	}
+
+	// Longest common subsequence table, filled from the end.
+	lcs := make([][]int, len(oldLines)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(newLines)+1)
+	}
+	for i := len(oldLines) - 1; i >= 0; i-- {
+		for j := len(newLines) - 1; j >= 0; j-- {
+			if oldLines[i] == newLines[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var b strings.Builder
+	i, j := 0, 0
+	for i < len(oldLines) || j < len(newLines) {
+		switch {
+		case i < len(oldLines) && j < len(newLines) && oldLines[i] == newLines[j]:
+			b.WriteString(" " + oldLines[i] + "\n")
+			i++
+			j++
+		case i < len(oldLines) && (j == len(newLines) || lcs[i+1][j] >= lcs[i][j+1]):
+			b.WriteString("-" + oldLines[i] + "\n")
+			i++
+		default:
+			b.WriteString("+" + newLines[j] + "\n")
+			j++
+		}
+	}
+	return b.String()
+}
+
+// changesDiff formats change log entries as a line diff per changed field, each headed by the field name (or the
+// file event), the time of the change and its impacts.
+func changesDiff(changes []ConfigChangeLog) string {
+	var b strings.Builder
+	for _, change := range changes {
+		name := change.FieldName
+		if change.Event != "" {
+			name = "file " + change.Event
+		}
+		fmt.Fprintf(&b, "\n%v (%v)\n", name, change.Timestamp.Format(time.RFC3339))
+		b.WriteString(impactNotes(change.Impacts))
+		b.WriteString(lineDiff(formatChangeValue(change.OldValue), formatChangeValue(change.NewValue)))
+	}
+	return b.String()
+}
+
+// formatChangeValue renders a changed value as indented JSON, or "" if it is absent.
+func formatChangeValue(value interface{}) string {
+	if value == nil {
+		return ""
+	}
+	content, err := json.MarshalIndent(jsonCompatible(value), "", "  ")
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(content)
+}
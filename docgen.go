@@ -0,0 +1,265 @@
+package mkconf
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DocFormat is the markup of generated reference documentation.
+type DocFormat int
+
+const (
+	DocMarkdown DocFormat = iota // Markdown table
+	DocHTML                      // HTML fragment with a table
+)
+
+// DocOptions configures GenerateDocs.
+type DocOptions struct {
+	Format DocFormat // Markup of the documentation; Markdown if zero
+	Title  string    // Heading of the documentation; "Configuration reference" if empty
+	Tag    string    // Struct tag the keys are taken from, e.g. "yaml"; the first format tag of each field if empty
+}
+
+// docField is a documented field of a configuration.
+type docField struct {
+	path        string   // Dot-separated key path; "[]" stands for list elements and "<key>" for map keys
+	typeName    string   // Type in operator terms, e.g. "duration" or "list of string"
+	defaultText string   // Default value; empty inside lists and maps
+	allowed     []string // Allowed values of enum fields
+	description string   // Description from the doc tag
+	restart     bool     // Flag indicating a change only takes effect after a restart
+}
+
+// GenerateDocs writes reference documentation of the configuration struct v points to: one row per field with its
+// key path, type, default, allowed values, description and whether a change requires a restart. Defaults are the
+// values of v, so pass the struct as initialized before loading. Descriptions come from the doc tag and the restart
+// flag from the restart tag, e.g.
+//
+//	Timeout time.Duration `yaml:"timeout" doc:"Timeout of requests" restart:"true"`
+//
+// Allowed values come from oneof tags and Enum types. Generating the documentation from the struct in a build step
+// keeps operator documentation in sync with the code.
+func GenerateDocs(w io.Writer, v interface{}, options DocOptions) error {
+	value := reflect.ValueOf(v)
+	for value.Kind() == reflect.Ptr || value.Kind() == reflect.Interface {
+		if value.IsNil() {
+			return fmt.Errorf("generate docs: config is nil")
+		}
+		value = value.Elem()
+	}
+	if value.Kind() != reflect.Struct {
+		return fmt.Errorf("generate docs: config is a %v, not a struct", value.Kind())
+	}
+	if options.Title == "" {
+		options.Title = "Configuration reference"
+	}
+
+	var fields []docField
+	collectDocFields(value, "", options.Tag, true, &fields)
+
+	var b strings.Builder
+	switch options.Format {
+	case DocMarkdown:
+		writeMarkdownDocs(&b, options.Title, fields)
+	case DocHTML:
+		writeHTMLDocs(&b, options.Title, fields)
+	default:
+		return fmt.Errorf("generate docs: unknown format %v", options.Format)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// collectDocFields appends the fields of the struct value at path to fields. hasDefaults tells whether value holds
+// defaults, which is not the case for the element types of lists and maps.
+func collectDocFields(value reflect.Value, path, tag string, hasDefaults bool, fields *[]docField) {
+	for _, field := range treeFields(value, tag) {
+		doc := docField{
+			path:        joinPath(path, field.key),
+			typeName:    docTypeName(field.value.Type()),
+			allowed:     docAllowed(field.value, field.tag),
+			description: field.tag.Get("doc"),
+		}
+		doc.restart, _ = strconv.ParseBool(field.tag.Get("restart"))
+		if hasDefaults {
+			doc.defaultText = docDefault(field.value)
+		}
+		*fields = append(*fields, doc)
+
+		// Fields of nested structs, and of the structs in lists and maps, are documented below their container.
+		element, elementPath, elementDefaults := field.value, doc.path, hasDefaults
+		for element.Kind() == reflect.Ptr {
+			if element.IsNil() {
+				element, elementDefaults = reflect.Zero(element.Type().Elem()), false
+				continue
+			}
+			element = element.Elem()
+		}
+		switch element.Kind() {
+		case reflect.Slice, reflect.Array:
+			element, elementPath, elementDefaults = docElement(element.Type().Elem()), elementPath+"[]", false
+		case reflect.Map:
+			element, elementPath, elementDefaults = docElement(element.Type().Elem()), joinPath(elementPath, "<key>"), false
+		}
+		if element.Kind() == reflect.Struct && docTypeName(element.Type()) == "object" {
+			collectDocFields(element, elementPath, tag, elementDefaults, fields)
+		}
+	}
+}
+
+// docElement returns the zero value of the element type of a list or map, dereferencing pointers.
+func docElement(t reflect.Type) reflect.Value {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return reflect.Zero(t)
+}
+
+// docTypeName returns the name of a type in operator terms.
+func docTypeName(t reflect.Type) string {
+	switch {
+	case t == reflect.TypeOf(time.Duration(0)):
+		return "duration"
+	case t == reflect.TypeOf(time.Time{}):
+		return "time"
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		return docTypeName(t.Elem())
+	case reflect.Bool:
+		return "bool"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return "integer"
+	case reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.String:
+		return "string"
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return "bytes"
+		}
+		return "list of " + docTypeName(t.Elem())
+	case reflect.Map:
+		return "map of " + docTypeName(t.Elem())
+	case reflect.Struct:
+		return "object"
+	}
+	return "any"
+}
+
+// docAllowed returns the allowed values of a field from its oneof tag or its Enum type.
+func docAllowed(value reflect.Value, tag reflect.StructTag) []string {
+	if oneof, ok := tag.Lookup("oneof"); ok {
+		var allowed []string
+		for _, option := range strings.Split(oneof, ",") {
+			allowed = append(allowed, strings.TrimSpace(option))
+		}
+		return allowed
+	}
+	t := value.Type()
+	for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice || t.Kind() == reflect.Array || t.Kind() == reflect.Map {
+		t = t.Elem()
+	}
+	switch {
+	case t.Implements(enumType):
+		return reflect.Zero(t).Interface().(Enum).EnumValues()
+	case reflect.PtrTo(t).Implements(enumType):
+		return reflect.New(t).Interface().(Enum).EnumValues()
+	}
+	return nil
+}
+
+// docDefault returns the text of a default value.
+func docDefault(value reflect.Value) string {
+	for value.Kind() == reflect.Ptr || value.Kind() == reflect.Interface {
+		if value.IsNil() {
+			return "null"
+		}
+		value = value.Elem()
+	}
+	switch {
+	case value.Type() == reflect.TypeOf(time.Duration(0)):
+		return time.Duration(value.Int()).String()
+	case value.Type() == reflect.TypeOf(time.Time{}):
+		if value.Interface().(time.Time).IsZero() {
+			return ""
+		}
+		return value.Interface().(time.Time).Format(time.RFC3339)
+	case value.Kind() == reflect.String:
+		return strconv.Quote(value.String())
+	case value.Kind() == reflect.Struct:
+		return ""
+	case value.Kind() == reflect.Slice || value.Kind() == reflect.Array || value.Kind() == reflect.Map:
+		if value.Len() == 0 {
+			return ""
+		}
+		data, err := json.Marshal(value.Interface())
+		if err != nil {
+			return ""
+		}
+		return string(data)
+	}
+	return scalarText(value)
+}
+
+// writeMarkdownDocs writes the fields as a Markdown table.
+func writeMarkdownDocs(b *strings.Builder, title string, fields []docField) {
+	cell := func(text string) string {
+		return strings.ReplaceAll(strings.ReplaceAll(text, "|", "\\|"), "\n", " ")
+	}
+	code := func(text string) string {
+		if text == "" {
+			return ""
+		}
+		return "`" + cell(text) + "`"
+	}
+
+	fmt.Fprintf(b, "# %v\n\n", title)
+	b.WriteString("| Field | Type | Default | Allowed values | Restart | Description |\n")
+	b.WriteString("|-------|------|---------|----------------|---------|-------------|\n")
+	for _, field := range fields {
+		var allowed []string
+		for _, option := range field.allowed {
+			allowed = append(allowed, code(option))
+		}
+		restart := ""
+		if field.restart {
+			restart = "yes"
+		}
+		fmt.Fprintf(b, "| %v | %v | %v | %v | %v | %v |\n", code(field.path), cell(field.typeName), code(field.defaultText),
+			strings.Join(allowed, ", "), restart, cell(field.description))
+	}
+}
+
+// writeHTMLDocs writes the fields as an HTML table.
+func writeHTMLDocs(b *strings.Builder, title string, fields []docField) {
+	code := func(text string) string {
+		if text == "" {
+			return ""
+		}
+		return "<code>" + html.EscapeString(text) + "</code>"
+	}
+
+	fmt.Fprintf(b, "<h1>%v</h1>\n<table>\n", html.EscapeString(title))
+	b.WriteString("<thead><tr><th>Field</th><th>Type</th><th>Default</th><th>Allowed values</th><th>Restart</th><th>Description</th></tr></thead>\n<tbody>\n")
+	for _, field := range fields {
+		var allowed []string
+		for _, option := range field.allowed {
+			allowed = append(allowed, code(option))
+		}
+		restart := ""
+		if field.restart {
+			restart = "yes"
+		}
+		fmt.Fprintf(b, "<tr><td>%v</td><td>%v</td><td>%v</td><td>%v</td><td>%v</td><td>%v</td></tr>\n", code(field.path),
+			html.EscapeString(field.typeName), code(field.defaultText), strings.Join(allowed, ", "), restart, html.EscapeString(field.description))
+	}
+	b.WriteString("</tbody>\n</table>\n")
+}
@@ -0,0 +1,166 @@
+package mkconf
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	reader "mkconf/readers"
+)
+
+// DualWriteOptions configures writing a configuration to a second file in another format during a migration.
+type DualWriteOptions struct {
+	NewPath      string                               // Path of the file in the new format, e.g. "conf/app.toml"; its extension selects the writer
+	OnDivergence func(divergence DualWriteDivergence) // Function called when the files parse to different values; reported as a DivergenceError if nil
+}
+
+// DualWriteDivergence describes the values that differ between the old and the new file of a format migration.
+type DualWriteDivergence struct {
+	ConfigName string   // Name of the configuration
+	OldPath    string   // Path of the configuration file in the old format
+	NewPath    string   // Path of the file in the new format
+	Fields     []string // Dot-separated paths of the values that differ or are missing in one file, sorted
+}
+
+// DivergenceError reports a divergence to the function set with SetErrorFunc if the dual write has no OnDivergence.
+type DivergenceError struct {
+	Divergence DualWriteDivergence // The values that differ
+}
+
+// Error implements error.
+func (e *DivergenceError) Error() string {
+	return fmt.Sprintf("dual write of config %v diverges from %v: %v", e.Divergence.ConfigName, e.Divergence.NewPath, strings.Join(e.Divergence.Fields, ", "))
+}
+
+// SetDualWrite starts a format migration of the specified configuration, e.g. from INI to TOML: the current values
+// are written to options.NewPath, and from then on every update with UpdateConfig or Set is written to both files.
+// After every write both files are parsed and compared; values are compared as text, so 8080 in TOML matches
+// "8080" in INI. Divergences are reported to options.OnDivergence, or as a *DivergenceError to the function set
+// with SetErrorFunc. Once the files have matched for the transition period, switch the configuration to the new
+// file and call SetDualWrite with an empty NewPath to stop.
+func (cm *ConfigManager) SetDualWrite(configName string, options DualWriteOptions) error {
+	configInterface, err := cm.GetConfig(configName)
+	if err != nil {
+		return err
+	}
+	settings, ok := cm.configList.getSettings(configName)
+	if !ok {
+		return fmt.Errorf("config with name %s not found", configName)
+	}
+	if options.NewPath == "" {
+		settings.mu.Lock()
+		settings.dualWrite = nil
+		settings.mu.Unlock()
+		return nil
+	}
+	newType := fileConfigType(options.NewPath)
+	if _, ok := (&ConfigSettings{configType: newType}).checkReader().(reader.Writer); !ok {
+		return fmt.Errorf("dual write of config %v: config type %v is not writable", configName, newType)
+	}
+
+	settings.mu.Lock()
+	settings.dualWrite = &options
+	settings.mu.Unlock()
+	return cm.configList.writeDualFile(settings, configInterface)
+}
+
+// VerifyDualWrite parses both files of a format migration started with SetDualWrite and returns the paths of the
+// values that differ, sorted, or nil if the files match.
+func (cm *ConfigManager) VerifyDualWrite(configName string) ([]string, error) {
+	settings, ok := cm.configList.getSettings(configName)
+	if !ok {
+		return nil, fmt.Errorf("config with name %s not found", configName)
+	}
+	settings.mu.Lock()
+	defer settings.mu.Unlock()
+	if settings.dualWrite == nil {
+		return nil, fmt.Errorf("dual write of config %v: not started", configName)
+	}
+	return settings.dualWriteDivergence()
+}
+
+// writeDualFile writes v, the values of a configuration, to the new file of its format migration, if one is
+// started, and reports a divergence of the files.
+func (c *ConfigList) writeDualFile(settings *ConfigSettings, v interface{}) error {
+	settings.mu.Lock()
+	options := settings.dualWrite
+	if options == nil {
+		settings.mu.Unlock()
+		return nil
+	}
+	newWriter := (&ConfigSettings{configType: fileConfigType(options.NewPath)}).checkReader().(reader.Writer)
+	if err := newWriter.UpdateConfig(options.NewPath, v); errors.Is(err, reader.ErrRewritten) {
+		c.reportError(fmt.Errorf("dual write of config %v: %w", settings.configName, err))
+	} else if err != nil {
+		settings.mu.Unlock()
+		return fmt.Errorf("dual write of config %v: %v", settings.configName, err)
+	}
+	fields, err := settings.dualWriteDivergence()
+	oldPath := settings.configFullPath
+	settings.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if len(fields) > 0 {
+		divergence := DualWriteDivergence{ConfigName: settings.configName, OldPath: oldPath, NewPath: options.NewPath, Fields: fields}
+		if options.OnDivergence != nil {
+			options.OnDivergence(divergence)
+		} else {
+			c.reportError(&DivergenceError{Divergence: divergence})
+		}
+	}
+	return nil
+}
+
+// dualWriteDivergence parses both files of the format migration and returns the paths of the values that differ.
+// The caller must hold c.mu.
+func (c *ConfigSettings) dualWriteDivergence() ([]string, error) {
+	oldValues, err := c.convertToMap(c.configFullPath)
+	if err != nil {
+		return nil, fmt.Errorf("dual write of config %v: %v", c.configName, err)
+	}
+	newReader := (&ConfigSettings{configType: fileConfigType(c.dualWrite.NewPath)}).checkReader()
+	newValues, err := newReader.ReadConfigToMap(c.dualWrite.NewPath)
+	if err != nil {
+		return nil, fmt.Errorf("dual write of config %v: %v", c.configName, err)
+	}
+
+	oldTexts, newTexts := make(map[string]string), make(map[string]string)
+	collectValueTexts(oldValues, "", oldTexts)
+	collectValueTexts(newValues, "", newTexts)
+	var fields []string
+	for path, text := range oldTexts {
+		if newText, ok := newTexts[path]; !ok || newText != text {
+			fields = append(fields, path)
+		}
+	}
+	for path := range newTexts {
+		if _, ok := oldTexts[path]; !ok {
+			fields = append(fields, path)
+		}
+	}
+	sort.Strings(fields)
+	return fields, nil
+}
+
+// collectValueTexts adds the text of the scalar values of a decoded value at path to texts, keyed by lower-case
+// path, so values of formats with and without types and with differently cased keys compare equal.
+func collectValueTexts(value interface{}, path string, texts map[string]string) {
+	if values := toStringMap(value); values != nil {
+		for key, element := range values {
+			collectValueTexts(element, joinPath(path, strings.ToLower(key)), texts)
+		}
+		return
+	}
+	if list := reflect.ValueOf(value); value != nil && list.Kind() == reflect.Slice {
+		for i := 0; i < list.Len(); i++ {
+			collectValueTexts(list.Index(i).Interface(), joinPath(path, strconv.Itoa(i)), texts)
+		}
+		return
+	}
+	texts[path] = fmt.Sprint(value)
+}
@@ -0,0 +1,52 @@
+package mkconf
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type dualWriteConfig struct {
+	Name string   `json:"name" toml:"name"`
+	Tags []string `json:"tags" toml:"tags"`
+}
+
+func TestDualWriteDivergenceReportedThroughErrorFunc(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "migrated.json"), []byte(`{"name": "a", "tags": ["x"]}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var reported []error
+	cm := NewConfigManager()
+	cm.SetErrorFunc(func(err error) { reported = append(reported, err) })
+	if err := cm.AddConfig("migrated", dir, ".json", &dualWriteConfig{}); err != nil {
+		t.Fatalf("AddConfig: %v", err)
+	}
+	if err := cm.LoadConfig("migrated"); err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	// UpdateConfig restarts the monitoring, which must stop before the directory is removed; removing the
+	// configuration also drops the notification of the update nobody watches.
+	t.Cleanup(func() { cm.RemoveConfig("migrated") })
+	newPath := filepath.Join(dir, "migrated.toml")
+	if err := cm.SetDualWrite("migrated", DualWriteOptions{NewPath: newPath}); err != nil {
+		t.Fatalf("SetDualWrite: %v", err)
+	}
+	if len(reported) != 0 {
+		t.Fatalf("reported %v for matching files", reported)
+	}
+
+	// JSON keeps the empty list as null, TOML drops it.
+	if err := cm.UpdateConfig("migrated", &dualWriteConfig{Name: "b"}); err != nil {
+		t.Fatalf("UpdateConfig: %v", err)
+	}
+	var divergence *DivergenceError
+	if len(reported) != 1 || !errors.As(reported[0], &divergence) {
+		t.Fatalf("reported %v, want one *DivergenceError", reported)
+	}
+	if divergence.Divergence.ConfigName != "migrated" || divergence.Divergence.NewPath != newPath ||
+		len(divergence.Divergence.Fields) != 1 || divergence.Divergence.Fields[0] != "tags" {
+		t.Fatalf("divergence %+v, want tags of config migrated to differ", divergence.Divergence)
+	}
+}
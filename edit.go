@@ -0,0 +1,163 @@
+package mkconf
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// EditOptions configures EditConfig.
+type EditOptions struct {
+	Editor string    // Editor command, e.g. "code --wait"; $VISUAL, $EDITOR or vi if empty
+	Input  io.Reader // Input the editor and the prompts read from; os.Stdin if nil
+	Output io.Writer // Output of the editor, the diff and the prompts; os.Stdout if nil
+	Yes    bool      // Flag writing valid changes without asking for confirmation
+}
+
+// EditConfig opens the file of the configuration with the specified name in an editor, so it can be edited safely
+// while it is watched. The editor works on a temporary copy outside the watched directory. When the editor exits,
+// the copy is decoded into the registered struct, with env overrides, enum checks and hooks applied, without touching
+// the current values. Invalid content is reported and can be edited again; valid content is shown as a diff
+// against the file, preceded by the impacts of the changed values (see SetImpact), and, once confirmed, written
+// atomically over the file and loaded. A broken or half-written file never reaches the watched path. It returns nil
+// without writing if nothing was changed or the write was declined, and an error if the file was changed by someone
+// else while it was being edited.
+func (cm *ConfigManager) EditConfig(configName string, options EditOptions) error {
+	settings, ok := cm.configList.getSettings(configName)
+	if !ok {
+		return fmt.Errorf("config with name %s not found", configName)
+	}
+	configInterface, err := cm.GetConfig(configName)
+	if err != nil {
+		return err
+	}
+	settings.mu.Lock()
+	fullPath, configReader, fsys, source := settings.configFullPath, settings.Reader, settings.fsys, settings.source()
+	settings.mu.Unlock()
+	// The editor works on the main file of configurations drawing on local override or included files.
+	if _, overlay := fsys.(*localFilesFS); (fsys != nil && !overlay) || !source.IsWritable() {
+		return fmt.Errorf("edit config %s: %w", configName, ErrReadOnlySource)
+	}
+	if configReader == nil {
+		return fmt.Errorf("reader not set for config %s", configName)
+	}
+
+	if options.Editor == "" {
+		options.Editor = os.Getenv("VISUAL")
+	}
+	if options.Editor == "" {
+		options.Editor = os.Getenv("EDITOR")
+	}
+	if options.Editor == "" {
+		options.Editor = "vi"
+	}
+	if options.Input == nil {
+		options.Input = os.Stdin
+	}
+	if options.Output == nil {
+		options.Output = os.Stdout
+	}
+	input := bufio.NewReader(options.Input)
+
+	original, err := ioutil.ReadFile(fullPath)
+	if err != nil {
+		return fmt.Errorf("edit config %s: %v", configName, err)
+	}
+	info, err := os.Stat(fullPath)
+	if err != nil {
+		return fmt.Errorf("edit config %s: %v", configName, err)
+	}
+
+	// The copy keeps the extension, so editors pick the right syntax.
+	tmp, err := ioutil.TempFile("", "mkconf-"+configName+"-*"+filepath.Ext(fullPath))
+	if err != nil {
+		return fmt.Errorf("edit config %s: %v", configName, err)
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(original)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("edit config %s: %v", configName, err)
+	}
+
+	for {
+		if err := runEditor(options.Editor, tmp.Name(), options.Input, options.Output); err != nil {
+			return fmt.Errorf("edit config %s: %v", configName, err)
+		}
+		edited, err := ioutil.ReadFile(tmp.Name())
+		if err != nil {
+			return fmt.Errorf("edit config %s: %v", configName, err)
+		}
+		if bytes.Equal(edited, original) {
+			fmt.Fprintf(options.Output, "%v: no changes\n", configName)
+			return nil
+		}
+
+		settings.mu.Lock()
+		_, err = settings.decodeContent(tmp.Name(), edited, configInterface)
+		settings.mu.Unlock()
+		if err != nil {
+			fmt.Fprintf(options.Output, "%v: invalid config: %v\n", configName, err)
+			if !confirm(input, options.Output, "Edit again?", true) {
+				return fmt.Errorf("edit config %s: %v", configName, err)
+			}
+			continue
+		}
+
+		fmt.Fprint(options.Output, impactNotes(cm.configList.previewImpacts(configName, fullPath, original, edited)))
+		fmt.Fprint(options.Output, lineDiff(string(original), string(edited)))
+		if !options.Yes && !confirm(input, options.Output, "Write changes to "+fullPath+"?", false) {
+			fmt.Fprintf(options.Output, "%v: changes discarded\n", configName)
+			return nil
+		}
+		current, err := ioutil.ReadFile(fullPath)
+		if err != nil {
+			return fmt.Errorf("edit config %s: %v", configName, err)
+		}
+		if !bytes.Equal(current, original) {
+			return fmt.Errorf("edit config %s: %v was changed while it was being edited; the edited copy is discarded", configName, fullPath)
+		}
+		if err := writeFileAtomic(fullPath, edited, info.Mode().Perm()); err != nil {
+			return fmt.Errorf("edit config %s: %v", configName, err)
+		}
+		return cm.LoadConfig(configName)
+	}
+}
+
+// runEditor runs the editor command on the named file, attached to output and, if it is a terminal or other file,
+// to input. Other inputs are kept for the prompts.
+func runEditor(editor, name string, input io.Reader, output io.Writer) error {
+	args := strings.Fields(editor)
+	cmd := exec.Command(args[0], append(args[1:], name)...)
+	if file, ok := input.(*os.File); ok {
+		cmd.Stdin = file
+	}
+	cmd.Stdout, cmd.Stderr = output, output
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("editor %v: %v", editor, err)
+	}
+	return nil
+}
+
+// confirm asks a yes or no question, returning def for an empty answer and false when the input is exhausted.
+func confirm(input *bufio.Reader, output io.Writer, question string, def bool) bool {
+	choices := "[y/N]"
+	if def {
+		choices = "[Y/n]"
+	}
+	fmt.Fprintf(output, "%v %v ", question, choices)
+	answer, err := input.ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	if answer == "" {
+		return def && err == nil
+	}
+	return answer == "y" || answer == "yes"
+}
@@ -0,0 +1,179 @@
+package mkconf
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"net/smtp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// EmailSinkOptions configures an EmailSink.
+type EmailSinkOptions struct {
+	Addr        string                                                                     // Address of the SMTP server, e.g. "smtp.example.com:587"
+	Username    string                                                                     // User name for PLAIN authentication; no authentication if empty
+	Password    string                                                                     // Password for PLAIN authentication
+	From        string                                                                     // Sender address
+	To          []string                                                                   // Recipient addresses
+	Label       string                                                                     // Label of the configurations whose changes are sent; "critical" if empty
+	BatchWindow time.Duration                                                              // Time changes are collected before they are sent in one email; 1 minute if zero
+	MaxPerHour  int                                                                        // Maximum number of emails per hour; further changes wait for the next allowed email; 10 if zero
+	ErrorFunc   func(err error)                                                            // Function receiving errors sending emails, if set
+	SendFunc    func(addr string, a smtp.Auth, from string, to []string, msg []byte) error // Function sending an email; smtp.SendMail if nil
+}
+
+// EmailSink emails line diffs of the tracked changes of configurations carrying a label (by default "critical").
+// Changes are collected for a batch window and sent in one email, and the number of emails per hour is limited,
+// so a burst of changes does not flood the recipients. Only configurations with change tracking enabled produce
+// changes; secret values are redacted as in the change log.
+type EmailSink struct {
+	manager *ConfigManager    // Manager the sink is registered with
+	options EmailSinkOptions  // Sink options
+	pending []ConfigChangeLog // Changes waiting to be sent
+	sent    []time.Time       // Times of the emails sent in the last hour
+	timer   *time.Timer       // Timer sending the pending changes, if any are pending
+	closed  bool              // Flag indicating the sink was closed
+	mu      sync.Mutex        // Mutex for synchronizing access to the pending changes and the timer
+}
+
+// AddEmailSink registers a sink emailing the tracked changes of configurations labeled with options.Label
+// (see ConfigSettings.SetLabels). Close the sink to send the pending changes and unregister it.
+func (cm *ConfigManager) AddEmailSink(options EmailSinkOptions) (*EmailSink, error) {
+	if options.Addr == "" {
+		return nil, fmt.Errorf("email sink: SMTP address is not set")
+	}
+	if options.From == "" || len(options.To) == 0 {
+		return nil, fmt.Errorf("email sink: sender or recipients are not set")
+	}
+	if options.Label == "" {
+		options.Label = "critical"
+	}
+	if options.BatchWindow <= 0 {
+		options.BatchWindow = time.Minute
+	}
+	if options.MaxPerHour <= 0 {
+		options.MaxPerHour = 10
+	}
+	if options.SendFunc == nil {
+		options.SendFunc = smtp.SendMail
+	}
+
+	s := &EmailSink{manager: cm, options: options}
+	cm.configList.addChangeSink(s)
+	return s, nil
+}
+
+// Close unregisters the sink and sends the pending changes immediately, ignoring the rate limit.
+func (s *EmailSink) Close() error {
+	s.manager.configList.removeChangeSink(s)
+
+	s.mu.Lock()
+	s.closed = true
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+	changes := s.pending
+	s.pending = nil
+	s.mu.Unlock()
+
+	if len(changes) == 0 {
+		return nil
+	}
+	return s.send(changes)
+}
+
+// publishChanges implements changeSink. Changes of labeled configurations are queued for the next email.
+func (s *EmailSink) publishChanges(configName string, changes []ConfigChangeLog) {
+	settings, ok := s.manager.configList.getSettings(configName)
+	if !ok || !settings.hasLabel(s.options.Label) {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+	s.pending = append(s.pending, changes...)
+	if s.timer == nil {
+		s.timer = time.AfterFunc(s.options.BatchWindow, s.flush)
+	}
+}
+
+// flush sends the pending changes, or postpones them until the rate limit allows another email.
+func (s *EmailSink) flush() {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return
+	}
+	now := time.Now()
+	recent := s.sent[:0]
+	for _, sent := range s.sent {
+		if now.Sub(sent) < time.Hour {
+			recent = append(recent, sent)
+		}
+	}
+	s.sent = recent
+	if len(s.sent) >= s.options.MaxPerHour {
+		s.timer = time.AfterFunc(s.sent[0].Add(time.Hour).Sub(now), s.flush)
+		s.mu.Unlock()
+		return
+	}
+	s.sent = append(s.sent, now)
+	changes := s.pending
+	s.pending = nil
+	s.timer = nil
+	s.mu.Unlock()
+
+	if err := s.send(changes); err != nil && s.options.ErrorFunc != nil {
+		s.options.ErrorFunc(err)
+	}
+}
+
+// send emails the changes.
+func (s *EmailSink) send(changes []ConfigChangeLog) error {
+	var auth smtp.Auth
+	if s.options.Username != "" {
+		host, _, err := net.SplitHostPort(s.options.Addr)
+		if err != nil {
+			host = s.options.Addr
+		}
+		auth = smtp.PlainAuth("", s.options.Username, s.options.Password, host)
+	}
+	if err := s.options.SendFunc(s.options.Addr, auth, s.options.From, s.options.To, s.message(changes)); err != nil {
+		return fmt.Errorf("email sink: %v", err)
+	}
+	return nil
+}
+
+// message formats the changes as a plain text email with a line diff per changed field.
+func (s *EmailSink) message(changes []ConfigChangeLog) []byte {
+	byConfig := make(map[string][]ConfigChangeLog)
+	for _, change := range changes {
+		byConfig[change.ConfigName] = append(byConfig[change.ConfigName], change)
+	}
+	names := make([]string, 0, len(byConfig))
+	for name := range byConfig {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %v\r\n", s.options.From)
+	fmt.Fprintf(&b, "To: %v\r\n", strings.Join(s.options.To, ", "))
+	fmt.Fprintf(&b, "Subject: [mkconf] %d configuration change(s) in %v\r\n", len(changes), strings.Join(names, ", "))
+	fmt.Fprintf(&b, "Date: %v\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n")
+
+	for _, name := range names {
+		fmt.Fprintf(&b, "== %v ==\r\n", name)
+		b.WriteString(strings.ReplaceAll(changesDiff(byConfig[name]), "\n", "\r\n"))
+		b.WriteString("\r\n")
+	}
+	return b.Bytes()
+}
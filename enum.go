@@ -0,0 +1,118 @@
+package mkconf
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Enum is implemented by types with a fixed set of allowed values, e.g. a log level type. Fields of such types are
+// validated and normalized on load like fields tagged with oneof.
+type Enum interface {
+	EnumValues() []string
+}
+
+// enumType is the reflect type of Enum.
+var enumType = reflect.TypeOf((*Enum)(nil)).Elem()
+
+// validateEnums checks the enum fields of the struct v points to: fields tagged `oneof:"debug,info,warn,error"`
+// and fields of types implementing Enum, including the elements of slices and maps of them. Values matching an
+// allowed value case-insensitively are normalized to it; other values fail with an error listing the allowed
+// values. Empty strings are left alone, so enum fields can be optional.
+func (c *ConfigSettings) validateEnums(v interface{}) error {
+	value := reflect.ValueOf(v)
+	for value.Kind() == reflect.Ptr || value.Kind() == reflect.Interface {
+		if value.IsNil() {
+			return nil
+		}
+		value = value.Elem()
+	}
+	if value.Kind() != reflect.Struct || !value.CanSet() {
+		return nil
+	}
+
+	var errs []string
+	checkEnumFields(value, "", formatTag(c.configType), &errs)
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// checkEnumFields checks the fields of the struct value at path, appending the errors to errs.
+func checkEnumFields(value reflect.Value, path, tag string, errs *[]string) {
+	for _, field := range treeFields(value, tag) {
+		var allowed []string
+		if oneof, ok := field.tag.Lookup("oneof"); ok {
+			for _, option := range strings.Split(oneof, ",") {
+				allowed = append(allowed, strings.TrimSpace(option))
+			}
+		}
+		checkEnumValue(field.value, joinPath(path, field.key), allowed, tag, errs)
+	}
+}
+
+// checkEnumValue checks value at path against allowed, or the values of its Enum type if allowed is empty.
+func checkEnumValue(value reflect.Value, path string, allowed []string, tag string, errs *[]string) {
+	if len(allowed) == 0 && value.Kind() != reflect.Ptr && value.Kind() != reflect.Interface {
+		if value.Type().Implements(enumType) {
+			allowed = value.Interface().(Enum).EnumValues()
+		} else if value.CanAddr() && value.Addr().Type().Implements(enumType) {
+			allowed = value.Addr().Interface().(Enum).EnumValues()
+		}
+	}
+
+	switch value.Kind() {
+	case reflect.Ptr:
+		if !value.IsNil() {
+			checkEnumValue(value.Elem(), path, allowed, tag, errs)
+		}
+	case reflect.Interface:
+		// Values of interface fields, e.g. decoded into interface{}, are only checked against a oneof tag.
+		if !value.IsNil() && len(allowed) > 0 {
+			// Values held by interfaces are not settable; they are checked on a copy.
+			copied := reflect.New(value.Elem().Type()).Elem()
+			copied.Set(value.Elem())
+			checkEnumValue(copied, path, allowed, tag, errs)
+			value.Set(copied)
+		}
+	case reflect.Struct:
+		checkEnumFields(value, path, tag, errs)
+	case reflect.Slice, reflect.Array:
+		if value.Type().Elem().Kind() == reflect.Uint8 {
+			return
+		}
+		for i := 0; i < value.Len(); i++ {
+			checkEnumValue(value.Index(i), fmt.Sprintf("%v[%d]", path, i), allowed, tag, errs)
+		}
+	case reflect.Map:
+		for _, key := range value.MapKeys() {
+			// Map elements are not addressable, so they are checked on a copy.
+			element := reflect.New(value.Type().Elem()).Elem()
+			element.Set(value.MapIndex(key))
+			checkEnumValue(element, joinPath(path, fmt.Sprint(key.Interface())), allowed, tag, errs)
+			value.SetMapIndex(key, element)
+		}
+	default:
+		if len(allowed) == 0 {
+			return
+		}
+		text := fmt.Sprint(value.Interface())
+		if value.Kind() == reflect.String {
+			text = value.String()
+			if text == "" {
+				return
+			}
+		}
+		for _, option := range allowed {
+			if strings.EqualFold(option, text) {
+				if value.Kind() == reflect.String {
+					value.SetString(option)
+				}
+				return
+			}
+		}
+		*errs = append(*errs, fmt.Sprintf("%v: invalid value %q, allowed values: %v", path, text, strings.Join(allowed, ", ")))
+	}
+}
@@ -0,0 +1,98 @@
+package mkconf
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// logLevel is an Enum of log levels.
+type logLevel string
+
+func (logLevel) EnumValues() []string { return []string{"debug", "info", "warn", "error"} }
+
+type enumConfig struct {
+	Mode   string              `json:"mode" oneof:"dev, prod"`
+	Level  logLevel            `json:"level"`
+	Levels map[string]logLevel `json:"levels"`
+	Sinks  []logLevel          `json:"sinks"`
+	Retry  int                 `json:"retry" oneof:"1,3,5"`
+}
+
+func TestValidateEnums(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    enumConfig
+		wantErr []string
+	}{
+		{
+			name:    "accepted values",
+			content: `{"mode": "prod", "level": "warn", "levels": {"db": "debug"}, "sinks": ["info"], "retry": 3}`,
+			want:    enumConfig{Mode: "prod", Level: "warn", Levels: map[string]logLevel{"db": "debug"}, Sinks: []logLevel{"info"}, Retry: 3},
+		},
+		{
+			name:    "values normalized ignoring case",
+			content: `{"mode": "PROD", "level": "Warn", "levels": {"db": "DEBUG"}, "sinks": ["Info"], "retry": 5}`,
+			want:    enumConfig{Mode: "prod", Level: "warn", Levels: map[string]logLevel{"db": "debug"}, Sinks: []logLevel{"info"}, Retry: 5},
+		},
+		{
+			name:    "empty strings are optional",
+			content: `{"mode": "", "level": "", "retry": 1}`,
+			want:    enumConfig{Retry: 1},
+		},
+		{
+			name:    "tagged field",
+			content: `{"mode": "staging"}`,
+			wantErr: []string{`mode: invalid value "staging", allowed values: dev, prod`},
+		},
+		{
+			name:    "enum type",
+			content: `{"level": "verbose"}`,
+			wantErr: []string{`level: invalid value "verbose", allowed values: debug, info, warn, error`},
+		},
+		{
+			name:    "tagged number",
+			content: `{"retry": 2}`,
+			wantErr: []string{`retry: invalid value "2", allowed values: 1, 3, 5`},
+		},
+		{
+			name:    "map and slice elements",
+			content: `{"levels": {"db": "loud"}, "sinks": ["info", "quiet"]}`,
+			wantErr: []string{`levels.db: invalid value "loud"`, `sinks[1]: invalid value "quiet"`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if err := os.WriteFile(filepath.Join(dir, "app.json"), []byte(tt.content), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			cm := NewConfigManager()
+			var cfg enumConfig
+			err := cm.AddConfig("app", dir, ".json", &cfg)
+			if err == nil {
+				err = cm.LoadConfig("app")
+			}
+			if len(tt.wantErr) > 0 {
+				if err == nil {
+					t.Fatal("load of an invalid value succeeded")
+				}
+				for _, want := range tt.wantErr {
+					if !strings.Contains(err.Error(), want) {
+						t.Fatalf("load error %q does not contain %q", err, want)
+					}
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("load: %v", err)
+			}
+			if !reflect.DeepEqual(cfg, tt.want) {
+				t.Fatalf("loaded %+v, want %+v", cfg, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package mkconf
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"sync"
+)
+
+// EnvConfigSource is a configuration made of a snapshot of environment variables, selected and keyed like an
+// EnvLayer: with prefix "APP_", APP_DB__HOST=db.local becomes {"db": {"host": "db.local"}}. The snapshot is exposed
+// to the manager as a JSON document and decoded into the configuration struct with its json tags, or its field
+// names matched case-insensitively. It lets env-only deployments use the tooling of file-based configurations:
+// Status, DumpTree with the variable each value comes from, search, export and change logs.
+// The source is also a Layer, so the same snapshot can be layered over files with AddLayeredConfig.
+type EnvConfigSource struct {
+	layer      EnvLayer       // Selection of the variables
+	configName string         // Name of the registered configuration
+	manager    *ConfigManager // Manager the configuration is registered with
+	environ    []string       // Snapshot of the selected variables as "name=value" pairs
+	content    []byte         // JSON document of the snapshot
+	mu         sync.Mutex     // Mutex for synchronizing access to the snapshot
+	valueOrigins
+}
+
+// AddEnvConfig registers a configuration made of a snapshot of the environment variables selected by layer.
+// The variables are read once; call Refresh on the returned source to take a new snapshot, e.g. after the process
+// environment was changed. The configuration is read-only.
+func (cm *ConfigManager) AddEnvConfig(configName string, layer EnvLayer, configInterface interface{}) (*EnvConfigSource, error) {
+	s := &EnvConfigSource{
+		layer:      layer,
+		configName: configName,
+		manager:    cm,
+	}
+	if err := s.snapshot(); err != nil {
+		return nil, fmt.Errorf("env config %v: %v", configName, err)
+	}
+	if err := cm.AddConfigFS(s, configName, "", ".json", configInterface); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Open implements fs.FS. Every name resolves to the snapshot of the variables.
+func (s *EnvConfigSource) Open(name string) (fs.File, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return newRemoteFile(name, s.content), nil
+}
+
+// Refresh takes a new snapshot of the variables and loads the configuration from it.
+func (s *EnvConfigSource) Refresh() error {
+	if err := s.snapshot(); err != nil {
+		return fmt.Errorf("env config %v: %v", s.configName, err)
+	}
+	return s.manager.LoadConfig(s.configName)
+}
+
+// Name implements Layer.
+func (s *EnvConfigSource) Name() string {
+	return "env config " + s.configName
+}
+
+// Load implements Layer, returning the values of the current snapshot.
+func (s *EnvConfigSource) Load() (map[string]interface{}, error) {
+	values, _ := s.load()
+	return values, nil
+}
+
+// load returns the values of the current snapshot and the variable each of them comes from.
+func (s *EnvConfigSource) load() (map[string]interface{}, map[string]string) {
+	s.mu.Lock()
+	environ := s.environ
+	s.mu.Unlock()
+	return s.layer.loadFrom(environ)
+}
+
+// snapshot reads the selected variables and records the variable each value comes from.
+func (s *EnvConfigSource) snapshot() error {
+	environ := s.layer.environ()
+	values, origins := s.layer.loadFrom(environ)
+	if values == nil {
+		values = make(map[string]interface{})
+	}
+	content, err := json.Marshal(values)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.environ, s.content = environ, content
+	s.mu.Unlock()
+	s.setOrigins(origins)
+	return nil
+}
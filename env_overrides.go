@@ -0,0 +1,273 @@
+package mkconf
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// EnvOverrides configures the environment variables overriding the values of every configuration.
+type EnvOverrides struct {
+	Prefix     string // Prefix of the variables, e.g. "APP" for APP_DB_HOST; overrides are disabled if empty
+	ConfigName bool   // Flag inserting the configuration name after the prefix, e.g. APP_CACHE_DB_HOST for config "cache"
+}
+
+// envOverride is a value of a configuration taken from an environment variable or a command-line flag.
+type envOverride struct {
+	source   string      // Kind of the override: "env" or "flag"
+	variable string      // Name of the variable, or the flag with its dash; empty for a value no longer overridden
+	value    interface{} // Value of the field after the override
+	previous interface{} // Value of the field before the override
+}
+
+// SetEnvOverrides makes every configuration apply environment variables on top of the values of its source
+// whenever it is loaded. The variable of a field is the prefix followed by the keys of its path, upper-cased and
+// joined with underscores. Keys are the format tags or field names, as when decoding; camelCase keys are split, so
+// db.maxConns is read from APP_DB_MAX_CONNS or APP_DB_MAXCONNS, and dashes and dots become underscores. Values are
+// parsed for the type of the field: "8080" sets an int, "5s" a time.Duration and `["a","b"]` a slice; a value that
+// does not parse fails the load like a broken file. Overrides that take effect, change or disappear are recorded in
+// the change log of configurations with change tracking, with Source "env", and DumpTree marks overridden values
+// with their variable. Overrides apply from the next load of each configuration. Fields bound with an env tag are
+// read from their own variable instead, see LoadConfig.
+func (cm *ConfigManager) SetEnvOverrides(overrides EnvOverrides) {
+	cm.configList.settingsMutex.Lock()
+	cm.configList.envOverrides = overrides
+	cm.configList.settingsMutex.Unlock()
+
+	for _, settings := range cm.configList.settingsSnapshot() {
+		settings.mu.Lock()
+		settings.envOverrides = overrides
+		settings.mu.Unlock()
+	}
+}
+
+// applyEnvOverrides stores the values of the environment overrides, env tag bindings and bound flags in the struct v
+// points to and returns them keyed by dot-separated path. The caller must hold c.mu.
+func (c *ConfigSettings) applyEnvOverrides(v interface{}) (map[string]envOverride, error) {
+	value := reflect.ValueOf(v)
+	for value.Kind() == reflect.Ptr || value.Kind() == reflect.Interface {
+		if value.IsNil() {
+			return nil, nil
+		}
+		value = value.Elem()
+	}
+	if value.Kind() != reflect.Struct || !value.CanSet() {
+		return nil, nil
+	}
+
+	var names []string
+	if c.envOverrides.Prefix != "" {
+		prefix := envVariableKeys(c.envOverrides.Prefix)[0]
+		if c.envOverrides.ConfigName {
+			prefix += "_" + envVariableKeys(c.configName)[0]
+		}
+		names = []string{prefix}
+	}
+	overrides := make(map[string]envOverride)
+	for path := range c.envApplied {
+		// Values overridden before are reported even if they are not overridden any more.
+		overrides[path] = envOverride{}
+	}
+	if err := applyEnvFields(value, "", names, formatTag(c.configType), c.flags, overrides); err != nil {
+		return nil, err
+	}
+	return overrides, nil
+}
+
+// applyEnvFields applies the overrides of the fields of the struct value at path, whose variables start with one
+// of names, the bindings of fields tagged with env and the flags set in flags, keyed by path. Fields of paths in
+// overrides that are not overridden get their current value.
+func applyEnvFields(value reflect.Value, path string, names []string, tag string, flags map[string]*configFlag, overrides map[string]envOverride) error {
+	for _, field := range treeFields(value, tag) {
+		var fieldNames []string
+		for _, name := range names {
+			for _, key := range envVariableKeys(field.key) {
+				fieldNames = append(fieldNames, name+"_"+key)
+			}
+		}
+		fieldPath := joinPath(path, field.key)
+
+		target := field.value
+		if target.Kind() == reflect.Ptr && !target.IsNil() && target.Elem().Kind() == reflect.Struct {
+			target = target.Elem()
+		}
+		if target.Kind() == reflect.Struct && !isEnvScalar(target) {
+			if err := applyEnvFields(target, fieldPath, fieldNames, tag, flags, overrides); err != nil {
+				return err
+			}
+			continue
+		}
+
+		binding := strings.Split(field.tag.Get("env"), ",")
+		if binding[0] != "" {
+			// A field bound with an env tag is read from its variable only.
+			fieldNames = binding[:1]
+		}
+		previous := field.value.Interface()
+		var override envOverride
+		for _, name := range fieldNames {
+			text, ok := os.LookupEnv(name)
+			if !ok {
+				continue
+			}
+			if err := assignEnvValue(field.value, text); err != nil {
+				return fmt.Errorf("env override %v: %v", name, err)
+			}
+			override = envOverride{source: "env", variable: name}
+			break
+		}
+		if override.variable == "" && binding[0] != "" {
+			for _, option := range binding[1:] {
+				if strings.TrimSpace(option) == "required" {
+					return fmt.Errorf("env %v: required variable is not set", binding[0])
+				}
+			}
+			if text, ok := field.tag.Lookup("envDefault"); ok && field.value.IsZero() {
+				if err := assignEnvValue(field.value, text); err != nil {
+					return fmt.Errorf("env default of %v: %v", binding[0], err)
+				}
+			}
+		}
+		if flag, ok := flags[fieldPath]; ok && flag.set {
+			// Flags take precedence over the environment.
+			if err := assignEnvValue(field.value, flag.text); err != nil {
+				return fmt.Errorf("flag -%v: %v", flag.name, err)
+			}
+			override = envOverride{source: "flag", variable: "-" + flag.name}
+		}
+		if override.variable != "" {
+			override.value, override.previous = field.value.Interface(), previous
+			overrides[fieldPath] = override
+		} else if _, ok := overrides[fieldPath]; ok {
+			overrides[fieldPath] = envOverride{value: field.value.Interface()}
+		}
+	}
+	return nil
+}
+
+// envVariableKeys returns the variable spellings of a key, the one with camelCase split first, e.g. MAX_CONNS and
+// MAXCONNS for maxConns.
+func envVariableKeys(key string) []string {
+	var split, compact strings.Builder
+	runes := []rune(key)
+	for i, r := range runes {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			split.WriteRune('_')
+			compact.WriteRune('_')
+			continue
+		}
+		if i > 0 && unicode.IsUpper(r) && (unicode.IsLower(runes[i-1]) || (i+1 < len(runes) && unicode.IsLower(runes[i+1]) && unicode.IsUpper(runes[i-1]))) {
+			split.WriteRune('_')
+		}
+		split.WriteRune(unicode.ToUpper(r))
+		compact.WriteRune(unicode.ToUpper(r))
+	}
+	if split.String() == compact.String() {
+		return []string{split.String()}
+	}
+	return []string{split.String(), compact.String()}
+}
+
+// isEnvScalar reports whether a struct value is set from a single variable, like time.Time.
+func isEnvScalar(value reflect.Value) bool {
+	if !value.CanAddr() {
+		return false
+	}
+	_, ok := value.Addr().Interface().(encoding.TextUnmarshaler)
+	return ok
+}
+
+// assignEnvValue stores the text of a variable in target, parsed for its type.
+func assignEnvValue(target reflect.Value, text string) error {
+	if target.Type() == reflect.TypeOf(time.Duration(0)) {
+		duration, err := time.ParseDuration(text)
+		if err != nil {
+			return err
+		}
+		target.SetInt(int64(duration))
+		return nil
+	}
+	if target.Kind() == reflect.String {
+		target.SetString(text)
+		return nil
+	}
+	if err := assignValue(target, text); err == nil {
+		return nil
+	}
+	// Text of types decoded from JSON strings, e.g. time.Time.
+	quoted, _ := json.Marshal(text)
+	converted := reflect.New(target.Type())
+	if err := json.Unmarshal(quoted, converted.Interface()); err != nil {
+		return fmt.Errorf("cannot use %q as %v", text, target.Type())
+	}
+	target.Set(converted.Elem())
+	return nil
+}
+
+// recordEnvOverrides records the overrides applied by the last load and, if change tracking is enabled, the changes
+// of the overrides since the previous load. The caller must hold c.mu.
+func (c *ConfigSettings) recordEnvOverrides(overrides map[string]envOverride) {
+	if c.enableChangeTracking {
+		var changes []ConfigChangeLog
+		for path, override := range overrides {
+			applied, ok := c.envApplied[path]
+			switch {
+			case !ok:
+				changes = append(changes, ConfigChangeLog{FieldName: path, OldValue: override.previous, NewValue: override.value, Source: override.source})
+			case override.variable == "":
+				changes = append(changes, ConfigChangeLog{FieldName: path, OldValue: applied.value, NewValue: override.value, Source: applied.source})
+			case !reflect.DeepEqual(applied.value, override.value):
+				changes = append(changes, ConfigChangeLog{FieldName: path, OldValue: applied.value, NewValue: override.value, Source: override.source})
+			}
+		}
+		sort.Slice(changes, func(i, j int) bool { return changes[i].FieldName < changes[j].FieldName })
+		now := time.Now()
+		for i := range changes {
+			changes[i].ConfigName, changes[i].Timestamp = c.configName, now
+		}
+		c.redactChanges(changes)
+		c.envChanges = append(c.envChanges, changes...)
+	}
+	c.envApplied = make(map[string]envOverride, len(overrides))
+	for path, override := range overrides {
+		if override.variable != "" {
+			c.envApplied[path] = override
+		}
+	}
+}
+
+// takeEnvChanges returns and clears the recorded changes of the overrides. The caller must hold c.mu.
+func (c *ConfigSettings) takeEnvChanges() []ConfigChangeLog {
+	changes := c.envChanges
+	c.envChanges = nil
+	return changes
+}
+
+// logEnvChanges adds the recorded changes of the overrides of a configuration to its change log.
+// The tracking channel is not notified, as the changes come with a load requested by the caller.
+func (c *ConfigList) logEnvChanges(settings *ConfigSettings) {
+	settings.mu.Lock()
+	changes := settings.takeEnvChanges()
+	settings.mu.Unlock()
+	if len(changes) > 0 {
+		c.recordChanges(settings.configName, changes)
+	}
+}
+
+// envOrigin returns the origin of the override of the value at path, e.g. "env APP_DB_HOST" or "flag -db.host",
+// or an empty string if it is not overridden.
+func (c *ConfigSettings) envOrigin(path []string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	override, ok := c.envApplied[strings.Join(path, ".")]
+	if !ok {
+		return ""
+	}
+	return override.source + " " + override.variable
+}
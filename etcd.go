@@ -0,0 +1,344 @@
+package mkconf
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// EtcdOptions configures an etcd v3 config source.
+type EtcdOptions struct {
+	Endpoints  []string      // Base URLs of the etcd cluster members, e.g. "http://127.0.0.1:2379"
+	HTTPClient *http.Client  // Client used for requests; a client without timeout is required for watching. http.DefaultClient if nil
+	Source     SourceOptions // TLS, proxy and token provider settings; a provided token is sent as the etcd auth token
+}
+
+// EtcdConfigSource is a configuration stored under a single etcd key. It talks to the etcd v3 JSON gateway,
+// so no etcd client library is required. The value can be in any registered format, selected by the config type.
+// The source is exposed to the manager as a file system, so it uses the same loading, callbacks and change logs
+// as file configurations; instead of polling, changes are applied as soon as etcd reports them on a watch.
+type EtcdConfigSource struct {
+	key        string             // etcd key holding the configuration
+	configName string             // Name of the registered configuration
+	options    EtcdOptions        // Source options
+	manager    *ConfigManager     // Manager the configuration is registered with
+	content    []byte             // Last value read from etcd
+	loaded     bool               // Flag indicating content holds a value
+	revision   int64              // Revision of the cluster the content was read at
+	mu         sync.Mutex         // Mutex for synchronizing access to the content
+	cancel     context.CancelFunc // Function canceling the running watch
+	waitGroup  sync.WaitGroup     // WaitGroup to wait for the watch goroutine
+}
+
+// etcdKeyValue is a key-value pair as returned by the etcd JSON gateway.
+type etcdKeyValue struct {
+	Key         string `json:"key"`
+	Value       string `json:"value"`
+	ModRevision int64  `json:"mod_revision,string"`
+}
+
+// etcdHeader is the response header returned by the etcd JSON gateway.
+type etcdHeader struct {
+	Revision int64 `json:"revision,string"`
+}
+
+// AddEtcdConfig registers a configuration loaded from an etcd key. configType selects the reader (e.g. ".yaml").
+// UpdateConfig writes the value back to the key. Call StartWatching on the returned source to apply changes
+// as soon as they are made; they are delivered through the same callbacks as file changes.
+func (cm *ConfigManager) AddEtcdConfig(configName, key, configType string, configInterface interface{}, options EtcdOptions) (*EtcdConfigSource, error) {
+	if len(options.Endpoints) == 0 {
+		return nil, fmt.Errorf("etcd config %v: no endpoints", configName)
+	}
+	client, err := options.Source.httpClient(options.HTTPClient)
+	if err != nil {
+		return nil, fmt.Errorf("etcd config %v: %v", configName, err)
+	}
+	options.HTTPClient = client
+
+	s := &EtcdConfigSource{key: key, configName: configName, options: options, manager: cm}
+	if err := cm.AddConfigFS(s, configName, "", configType, configInterface); err != nil {
+		return nil, err
+	}
+	cm.addRemoteSource(configName, s)
+	return s, nil
+}
+
+// Open implements fs.FS. Every name resolves to the value of the key; it is fetched if it was not read yet.
+func (s *EtcdConfigSource) Open(name string) (fs.File, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.loaded {
+		if err := s.fetchLocked(); err != nil {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+		}
+	}
+	return newRemoteFile(name, s.content), nil
+}
+
+// WriteFile implements reader.WriteFileFS by putting the content to the key.
+func (s *EtcdConfigSource) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	request := map[string]string{
+		"key":   base64.StdEncoding.EncodeToString([]byte(s.key)),
+		"value": base64.StdEncoding.EncodeToString(data),
+	}
+	var response struct {
+		Header etcdHeader `json:"header"`
+	}
+	if err := s.call(context.Background(), "/v3/kv/put", request, &response); err != nil {
+		return fmt.Errorf("etcd put %v: %v", s.key, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.content = append([]byte(nil), data...)
+	s.loaded = true
+	if response.Header.Revision > s.revision {
+		s.revision = response.Header.Revision
+	}
+	return nil
+}
+
+// Refresh re-reads the key and loads the configuration from its current value.
+// It is not needed while the source is watched.
+func (s *EtcdConfigSource) Refresh() error {
+	s.mu.Lock()
+	err := s.fetchLocked()
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return s.manager.LoadConfig(s.configName)
+}
+
+// StartWatching watches the key and applies every change as soon as etcd reports it.
+// A broken watch is re-established and resumes from the last seen revision, so no change is missed.
+// Errors are reported through errorFunc if it is set.
+func (s *EtcdConfigSource) StartWatching(errorFunc func(err error)) error {
+	s.StopWatching()
+	errorFunc = quietCircuitErrors(errorFunc)
+	if err := s.manager.setRemoteWatching(s.configName, true); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.mu.Lock()
+	s.cancel = cancel
+	s.mu.Unlock()
+
+	s.waitGroup.Add(1)
+	s.manager.configList.resources.acquire(s.configName, resourceRemoteWatch)
+	go func() {
+		defer s.waitGroup.Done()
+		defer s.manager.configList.resources.release(s.configName, resourceRemoteWatch)
+		for {
+			err := s.watch(ctx)
+			if ctx.Err() != nil {
+				return
+			}
+			if err != nil && errorFunc != nil {
+				errorFunc(fmt.Errorf("etcd watch %v: %w", s.key, err))
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(time.Second):
+			}
+		}
+	}()
+	return nil
+}
+
+// StopWatching stops watching the key and waits for the watch to finish.
+func (s *EtcdConfigSource) StopWatching() {
+	s.mu.Lock()
+	cancel := s.cancel
+	s.cancel = nil
+	s.mu.Unlock()
+
+	if cancel == nil {
+		return
+	}
+	cancel()
+	s.waitGroup.Wait()
+
+	s.manager.setRemoteWatching(s.configName, false)
+}
+
+// watch runs a single watch stream until it fails or ctx is canceled.
+func (s *EtcdConfigSource) watch(ctx context.Context) error {
+	s.mu.Lock()
+	startRevision := s.revision + 1
+	s.mu.Unlock()
+
+	request := map[string]interface{}{
+		"create_request": map[string]interface{}{
+			"key":            base64.StdEncoding.EncodeToString([]byte(s.key)),
+			"start_revision": fmt.Sprint(startRevision),
+		},
+	}
+	resp, err := s.post(ctx, "/v3/watch", request)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var message struct {
+			Result struct {
+				Header   etcdHeader `json:"header"`
+				Canceled bool       `json:"canceled"`
+				Reason   string     `json:"cancel_reason"`
+				Events   []struct {
+					Type string       `json:"type"`
+					Kv   etcdKeyValue `json:"kv"`
+				} `json:"events"`
+			} `json:"result"`
+			Error *struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if err := decoder.Decode(&message); err != nil {
+			if err == io.EOF {
+				return fmt.Errorf("stream closed")
+			}
+			return err
+		}
+		if message.Error != nil {
+			return fmt.Errorf("%v", message.Error.Message)
+		}
+		if message.Result.Canceled {
+			// The start revision was compacted; re-read the key and watch from the current revision.
+			s.mu.Lock()
+			err := s.fetchLocked()
+			s.mu.Unlock()
+			if err == nil {
+				err = s.apply()
+			}
+			if err != nil {
+				return err
+			}
+			return fmt.Errorf("watch canceled: %v", message.Result.Reason)
+		}
+
+		changed := false
+		s.mu.Lock()
+		for _, event := range message.Result.Events {
+			if event.Kv.ModRevision > s.revision {
+				s.revision = event.Kv.ModRevision
+			}
+			if event.Type == "DELETE" {
+				// A deleted key keeps the last value, like a file that disappeared.
+				continue
+			}
+			value, err := base64.StdEncoding.DecodeString(event.Kv.Value)
+			if err != nil {
+				s.mu.Unlock()
+				return err
+			}
+			s.content, s.loaded, changed = value, true, true
+		}
+		if message.Result.Header.Revision > s.revision {
+			s.revision = message.Result.Header.Revision
+		}
+		s.mu.Unlock()
+
+		if changed {
+			if err := s.apply(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// apply reloads the configuration from the current value through the change machinery.
+func (s *EtcdConfigSource) apply() error {
+	return s.manager.applyRemoteChange(s.configName)
+}
+
+// fetchLocked calls fetchOnceLocked according to the retry policy and circuit breaker of the configuration.
+// The caller must hold s.mu.
+func (s *EtcdConfigSource) fetchLocked() error {
+	return s.manager.retryFetch(context.Background(), s.configName, s.fetchOnceLocked)
+}
+
+// fetchOnceLocked reads the current value of the key. The caller must hold s.mu.
+func (s *EtcdConfigSource) fetchOnceLocked() error {
+	request := map[string]string{"key": base64.StdEncoding.EncodeToString([]byte(s.key))}
+	var response struct {
+		Header etcdHeader     `json:"header"`
+		Kvs    []etcdKeyValue `json:"kvs"`
+	}
+	if err := s.call(context.Background(), "/v3/kv/range", request, &response); err != nil {
+		return fmt.Errorf("etcd get %v: %v", s.key, err)
+	}
+	if len(response.Kvs) == 0 {
+		return fmt.Errorf("etcd get %v: key not found", s.key)
+	}
+
+	value, err := base64.StdEncoding.DecodeString(response.Kvs[0].Value)
+	if err != nil {
+		return fmt.Errorf("etcd get %v: %v", s.key, err)
+	}
+	s.content, s.loaded = value, true
+	s.revision = response.Header.Revision
+	s.manager.sourceReached(s.configName)
+	return nil
+}
+
+// call posts a JSON request to the first reachable endpoint and decodes the response into out.
+func (s *EtcdConfigSource) call(ctx context.Context, path string, request, out interface{}) error {
+	resp, err := s.post(ctx, path, request)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// post sends a JSON request to the endpoints in order and returns the first successful response.
+func (s *EtcdConfigSource) post(ctx context.Context, path string, request interface{}) (*http.Response, error) {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+	token, err := s.options.Source.token(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+
+	var errs []string
+	for _, endpoint := range s.options.Endpoints {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(endpoint, "/")+path, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", token)
+		}
+		resp, err := s.options.HTTPClient.Do(req)
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		if resp.StatusCode != http.StatusOK {
+			message, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+			resp.Body.Close()
+			errs = append(errs, fmt.Sprintf("%v: unexpected status %v: %s", endpoint, resp.Status, bytes.TrimSpace(message)))
+			continue
+		}
+		return resp, nil
+	}
+	return nil, fmt.Errorf("%v", strings.Join(errs, "; "))
+}
@@ -0,0 +1,68 @@
+package mkconf
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	reader "mkconf/readers"
+)
+
+// ExportAs serializes the in-memory configuration with the specified name in another format (e.g. ".yaml")
+// and writes it to w. Any built-in or registered reader that can write the target type is used,
+// so a configuration loaded from XML can be exported as YAML without a hand-written converter.
+func (cm *ConfigManager) ExportAs(configName, targetType string, w io.Writer) error {
+	configInterface, err := cm.GetConfig(configName)
+	if err != nil {
+		return err
+	}
+	settings, ok := cm.configList.getSettings(configName)
+	if !ok {
+		return fmt.Errorf("config with name %s not found", configName)
+	}
+
+	target := ConfigSettings{configType: targetType}
+	targetReader := target.checkReader()
+	if targetReader == nil {
+		return fmt.Errorf("export config %v: unsupported config type %q", configName, targetType)
+	}
+
+	// Hold the lock so the configuration is not reloaded while it is serialized.
+	settings.mu.Lock()
+	defer settings.mu.Unlock()
+
+	switch targetWriter := targetReader.(type) {
+	case reader.StreamWriter:
+		err = targetWriter.WriteConfigTo(w, configInterface)
+	case reader.Writer:
+		err = exportViaFile(targetWriter, targetType, configInterface, w)
+	default:
+		err = ErrReadOnlySource
+	}
+	if err != nil {
+		return fmt.Errorf("export config %v as %v: %w", configName, targetType, err)
+	}
+	return nil
+}
+
+// exportViaFile serializes v with a writer that only supports files by writing a temporary file and copying it to w.
+func exportViaFile(writer reader.Writer, targetType string, v interface{}, w io.Writer) error {
+	dir, err := ioutil.TempDir("", "mkconf")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "export"+targetType)
+	if err := writer.UpdateConfig(filename, v); err != nil {
+		return err
+	}
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(content)
+	return err
+}
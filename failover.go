@@ -0,0 +1,135 @@
+package mkconf
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FailoverSource is one source of a failover chain. Fetch returns the content of the configuration, or an
+// error if the source is unreachable. It is called whenever the configuration is loaded or checked for changes.
+type FailoverSource interface {
+	Name() string
+	Fetch() ([]byte, error)
+}
+
+// FileSource is a failover source read from a local file, e.g. a cache of a remote configuration.
+type FileSource struct {
+	Path string // Path of the file
+}
+
+// Name implements FailoverSource.
+func (s FileSource) Name() string {
+	return "file " + s.Path
+}
+
+// Fetch implements FailoverSource.
+func (s FileSource) Fetch() ([]byte, error) {
+	return ioutil.ReadFile(s.Path)
+}
+
+// URLSource is a failover source downloaded from an http(s) URL on every fetch.
+type URLSource struct {
+	URL     string        // URL of the configuration
+	Options HTTPOptions   // Headers, credentials and client of the requests; Interval is not used
+	Timeout time.Duration // Time allowed for a request before the source counts as unreachable; 10 seconds if zero
+}
+
+// Name implements FailoverSource.
+func (s URLSource) Name() string {
+	return s.URL
+}
+
+// Fetch implements FailoverSource.
+func (s URLSource) Fetch() ([]byte, error) {
+	timeout := s.Timeout
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.Options.setHeaders(req); err != nil {
+		return nil, err
+	}
+	client, err := s.Options.Source.httpClient(s.Options.HTTPClient)
+	if err != nil {
+		return nil, err
+	}
+	if client != s.Options.HTTPClient && client != http.DefaultClient {
+		// The client has a transport of its own for this request.
+		defer client.CloseIdleConnections()
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		message, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("unexpected status %v: %s", resp.Status, strings.TrimSpace(string(message)))
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+// FailoverConfig is a configuration served by the first reachable source of an ordered chain.
+type FailoverConfig struct {
+	sources []FailoverSource // Sources in order of preference
+	served  string           // Name of the source that served the configuration last; empty if none did yet
+	mu      sync.Mutex       // Mutex for synchronizing access to served
+}
+
+// AddFailoverConfig adds a configuration read from the first reachable of the sources, e.g. a remote URL
+// first and a local cache file second:
+//
+//	cm.AddFailoverConfig("app", ".yaml", &cfg, URLSource{URL: "https://config/app.yaml"}, FileSource{Path: "cache/app.yaml"})
+//
+// The chain is walked again on every load and change check, so the configuration falls back while the primary
+// is unreachable and returns to it once it recovers; switching sources fires a change event only if the content
+// differs. ServedBy and ConfigStatus.Source tell which source served the configuration. Failover configurations
+// are read-only.
+func (cm *ConfigManager) AddFailoverConfig(configName, configType string, configInterface interface{}, sources ...FailoverSource) (*FailoverConfig, error) {
+	if len(sources) == 0 {
+		return nil, fmt.Errorf("config %v: no failover sources", configName)
+	}
+	f := &FailoverConfig{sources: sources}
+	if err := cm.AddConfigFS(f, configName, "", configType, configInterface); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// ServedBy returns the name of the source that served the configuration last, or "" if none did yet. It is
+// kept while all sources are unreachable, as the configuration keeps the values of that source.
+func (f *FailoverConfig) ServedBy() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.served
+}
+
+// Open implements fs.FS. Every name resolves to the content of the first source that can be fetched.
+func (f *FailoverConfig) Open(name string) (fs.File, error) {
+	var failures []string
+	for _, source := range f.sources {
+		content, err := source.Fetch()
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%v: %v", source.Name(), err))
+			continue
+		}
+		f.mu.Lock()
+		f.served = source.Name()
+		f.mu.Unlock()
+		return newRemoteFile(name, content), nil
+	}
+	return nil, &fs.PathError{Op: "open", Path: name, Err: fmt.Errorf("all sources failed: %v", strings.Join(failures, "; "))}
+}
@@ -0,0 +1,126 @@
+package mkconf
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"sort"
+	"sync"
+	"time"
+)
+
+// remoteManagerTimeout is the time allowed for each request to an attached manager.
+const remoteManagerTimeout = 5 * time.Second
+
+// remoteManager is another ConfigManager attached through its control server.
+type remoteManager struct {
+	network string // Network of the control server, "unix" or "tcp"
+	address string // Address of the control server
+}
+
+// FederatedStatus is the status of the configurations of one manager in the federated view.
+type FederatedStatus struct {
+	Manager string         // Name the manager was attached with; empty for the local manager
+	Configs []ConfigStatus // Status of the configurations ordered by name
+	Error   string         // Why the manager could not be reached; Configs is empty then
+}
+
+// AttachRemoteManager attaches the ConfigManager of another service, reached through its control server
+// (see ServeControl and ServeControlListener) at address on network ("unix" or "tcp"), so its configurations
+// appear in FederatedStatus and FederatedConfig under name. The view is read-only: the manager is only
+// asked for the status and values of its configurations, never to reload or approve them. The connection is
+// made for each request, so attaching succeeds while the other service is down.
+func (cm *ConfigManager) AttachRemoteManager(name, network, address string) error {
+	if name == "" {
+		return fmt.Errorf("remote manager: empty name")
+	}
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	if _, ok := cm.remoteManagers[name]; ok {
+		return fmt.Errorf("remote manager %v already attached", name)
+	}
+	if cm.remoteManagers == nil {
+		cm.remoteManagers = make(map[string]*remoteManager)
+	}
+	cm.remoteManagers[name] = &remoteManager{network: network, address: address}
+	return nil
+}
+
+// DetachRemoteManager removes a manager attached with AttachRemoteManager from the federated view.
+func (cm *ConfigManager) DetachRemoteManager(name string) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	delete(cm.remoteManagers, name)
+}
+
+// FederatedStatus returns the status of the configurations of this manager, followed by those of every
+// attached manager ordered by name, for central dashboards. Attached managers are queried concurrently;
+// one that cannot be reached is reported with its error instead of failing the view.
+func (cm *ConfigManager) FederatedStatus() []FederatedStatus {
+	cm.mu.RLock()
+	names := make([]string, 0, len(cm.remoteManagers))
+	managers := make(map[string]*remoteManager, len(cm.remoteManagers))
+	for name, manager := range cm.remoteManagers {
+		names = append(names, name)
+		managers[name] = manager
+	}
+	cm.mu.RUnlock()
+	sort.Strings(names)
+
+	view := make([]FederatedStatus, len(names)+1)
+	var local []ConfigStatus
+	(&ControlService{manager: cm}).List(ControlArgs{}, &local)
+	view[0] = FederatedStatus{Configs: local}
+
+	var waitGroup sync.WaitGroup
+	for i, name := range names {
+		waitGroup.Add(1)
+		go func(i int, name string) {
+			defer waitGroup.Done()
+			status := FederatedStatus{Manager: name}
+			if err := managers[name].call("Control.List", ControlArgs{}, &status.Configs); err != nil {
+				status.Configs, status.Error = nil, err.Error()
+			}
+			view[i+1] = status
+		}(i, name)
+	}
+	waitGroup.Wait()
+	return view
+}
+
+// FederatedConfig returns the effective value of a configuration of an attached manager as JSON, or of this
+// manager if manager is empty.
+func (cm *ConfigManager) FederatedConfig(manager, configName string) (json.RawMessage, error) {
+	if manager == "" {
+		return cm.effectiveConfig(configName)
+	}
+	cm.mu.RLock()
+	remote, ok := cm.remoteManagers[manager]
+	cm.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("remote manager %v not attached", manager)
+	}
+
+	var value json.RawMessage
+	if err := remote.call("Control.Get", ControlArgs{Name: configName}, &value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// call makes a single request to the control server of the manager.
+func (m *remoteManager) call(method string, args ControlArgs, reply interface{}) error {
+	conn, err := net.DialTimeout(m.network, m.address, remoteManagerTimeout)
+	if err != nil {
+		return fmt.Errorf("remote manager %v: %v", m.address, err)
+	}
+	conn.SetDeadline(time.Now().Add(remoteManagerTimeout))
+	client := rpc.NewClientWithCodec(jsonrpc.NewClientCodec(conn))
+	defer client.Close()
+	if err := client.Call(method, args, reply); err != nil {
+		return fmt.Errorf("remote manager %v: %v", m.address, err)
+	}
+	return nil
+}
@@ -0,0 +1,174 @@
+package mkconf
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// File event codes of a configuration file detected by change monitoring, recorded in ConfigChangeLog.Event.
+const (
+	FileDeleted   = "deleted"   // The file was removed
+	FileRenamed   = "renamed"   // The file was moved to another name in its directory, recorded as the new value
+	FileRecreated = "recreated" // The file appeared again after it was deleted or renamed
+	FileTruncated = "truncated" // The file was emptied
+)
+
+// ErrFileEvent is wrapped by the warnings reported through the function set with SetErrorFunc when change monitoring
+// finds the file of a configuration deleted, renamed or truncated.
+var ErrFileEvent = errors.New("config file event")
+
+// FileEventPolicy selects how a configuration behaves when its file is deleted, renamed or truncated.
+type FileEventPolicy int
+
+const (
+	FileKeepLastGood FileEventPolicy = iota // Keep the values last applied, reporting the configuration as last-known-good
+	FileFail                                // Report the configuration as failed; Get fails until the file is back
+)
+
+// String returns the name of the policy.
+func (p FileEventPolicy) String() string {
+	switch p {
+	case FileKeepLastGood:
+		return "keep-last-good"
+	case FileFail:
+		return "fail"
+	}
+	return fmt.Sprintf("FileEventPolicy(%d)", int(p))
+}
+
+// MarshalText encodes the policy by its name, e.g. for JSON status output.
+func (p FileEventPolicy) MarshalText() ([]byte, error) {
+	return []byte(p.String()), nil
+}
+
+// UnmarshalText decodes a policy encoded by MarshalText.
+func (p *FileEventPolicy) UnmarshalText(text []byte) error {
+	for _, policy := range []FileEventPolicy{FileKeepLastGood, FileFail} {
+		if string(text) == policy.String() {
+			*p = policy
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown file event policy %q", text)
+}
+
+// SetFileEventPolicy sets how the specified configuration behaves when change monitoring finds its file deleted,
+// renamed within its directory or truncated to zero bytes; only files on the OS file system are checked. Each of
+// these is reported once, as a change log entry whose Event is FileDeleted, FileRenamed or FileTruncated, through
+// the change log, the sinks and the change and tracking callbacks, instead of failing every check. The values last
+// applied are kept either way; an emptied file is never applied. With FileKeepLastGood, the default, the
+// configuration is reported as ConfigLastKnownGood; with FileFail, as ConfigFailed, and Get returns
+// ErrConfigFailed. Each event is also reported as an error wrapping ErrFileEvent to the function set with
+// SetErrorFunc. When the file reappears, a FileRecreated event is reported with the changes of its content and the
+// configuration recovers.
+func (cm *ConfigManager) SetFileEventPolicy(configName string, policy FileEventPolicy) error {
+	settings, ok := cm.configList.getSettings(configName)
+	if !ok {
+		return fmt.Errorf("config with name %s not found", configName)
+	}
+	settings.mu.Lock()
+	defer settings.mu.Unlock()
+	settings.fileEventPolicy = policy
+	if settings.fileEvent != "" {
+		settings.applyFileEventPolicy()
+	}
+	return nil
+}
+
+// checkFile checks the configuration file for a deletion, rename or truncation, or its reappearance after one.
+// It returns the event detected, if any, and whether the file is gone or empty, so there is nothing to apply.
+// Events of a file that is still gone or empty are reported once. A file that is back stays affected by the event
+// until its content is applied or resolveFileEvent is called. Only files on the OS file system are checked.
+// The caller must hold c.mu.
+func (c *ConfigSettings) checkFile() (*ConfigChangeLog, bool) {
+	if c.fsys != nil {
+		return nil, false
+	}
+	info, err := os.Stat(c.configFullPath)
+	if err != nil {
+		// Files that were never applied, and other errors, are reported by reading the file.
+		if !errors.Is(err, fs.ErrNotExist) || c.lastGoodContent == nil {
+			return nil, false
+		}
+		if c.fileEvent == FileDeleted || c.fileEvent == FileRenamed {
+			return nil, true
+		}
+		event := ConfigChangeLog{ConfigName: c.configName, OldValue: c.configFullPath, Timestamp: time.Now(), Event: FileDeleted}
+		if renamed := c.renamedFile(); renamed != "" {
+			event.Event, event.NewValue = FileRenamed, renamed
+		}
+		c.startFileEvent(event.Event)
+		return &event, true
+	}
+
+	c.fileInfo = info
+	if info.Size() == 0 && len(c.lastGoodContent) > 0 {
+		if c.fileEvent == FileTruncated {
+			return nil, true
+		}
+		c.startFileEvent(FileTruncated)
+		return &ConfigChangeLog{ConfigName: c.configName, Timestamp: time.Now(), Event: FileTruncated}, true
+	}
+	if c.fileEvent == FileDeleted || c.fileEvent == FileRenamed {
+		return &ConfigChangeLog{ConfigName: c.configName, NewValue: c.configFullPath, Timestamp: time.Now(), Event: FileRecreated}, false
+	}
+	return nil, false
+}
+
+// renamedFile returns the path the configuration file was moved to within its directory, or "" if it is not there.
+// The caller must hold c.mu.
+func (c *ConfigSettings) renamedFile() string {
+	if c.fileInfo == nil {
+		return ""
+	}
+	dir := filepath.Dir(c.configFullPath)
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return ""
+	}
+	for _, entry := range entries {
+		path := filepath.Join(dir, entry.Name())
+		if info, err := os.Stat(path); err == nil && os.SameFile(c.fileInfo, info) {
+			return path
+		}
+	}
+	return ""
+}
+
+// startFileEvent marks the configuration as affected by a file event and applies the file event policy.
+// The caller must hold c.mu.
+func (c *ConfigSettings) startFileEvent(event string) {
+	if c.fileEvent == "" {
+		c.eventState, c.eventStateError = c.state, c.stateError
+	}
+	c.fileEvent = event
+	c.applyFileEventPolicy()
+	outcome := "keeping the last applied values"
+	if c.fileEventPolicy == FileFail {
+		outcome = "config failed"
+	}
+	c.reportError(fmt.Errorf("%w: file %v of config %v was %v, %v", ErrFileEvent, c.configFullPath, c.configName, event, outcome))
+}
+
+// applyFileEventPolicy sets the state of a configuration affected by a file event. The caller must hold c.mu.
+func (c *ConfigSettings) applyFileEventPolicy() {
+	c.state, c.stateError = ConfigLastKnownGood, "config file "+c.fileEvent
+	if c.fileEventPolicy == FileFail {
+		c.state = ConfigFailed
+	}
+}
+
+// resolveFileEvent ends the file event of a configuration whose file is back with the content last applied,
+// restoring the state it had before the event. The caller must hold c.mu.
+func (c *ConfigSettings) resolveFileEvent() {
+	if c.fileEvent == "" {
+		return
+	}
+	c.state, c.stateError = c.eventState, c.eventStateError
+	c.fileEvent = ""
+}
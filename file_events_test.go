@@ -0,0 +1,40 @@
+package mkconf
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileEventReportedThroughErrorFunc(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "events.json")
+	if err := os.WriteFile(path, []byte(`{"version": 1}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var reported []error
+	cm := NewConfigManager()
+	cm.SetErrorFunc(func(err error) { reported = append(reported, err) })
+	if err := cm.AddConfig("events", dir, ".json", &stressConfig{}); err != nil {
+		t.Fatalf("AddConfig: %v", err)
+	}
+	if err := cm.LoadConfig("events"); err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	if _, err := cm.CheckOnce("events"); err != nil {
+		t.Fatalf("CheckOnce: %v", err)
+	}
+
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := cm.CheckOnce("events"); err != nil {
+			t.Fatalf("CheckOnce after removal: %v", err)
+		}
+	}
+	if len(reported) != 1 || !errors.Is(reported[0], ErrFileEvent) {
+		t.Fatalf("reported %v, want one error wrapping ErrFileEvent", reported)
+	}
+}
@@ -0,0 +1,238 @@
+package mkconf
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// errFileNotifyUnsupported is returned by newDirWatcher on platforms without file system notifications.
+var errFileNotifyUnsupported = errors.New("file notifications are not supported on this platform")
+
+// notifyFallbackInterval is how often configurations watched with file notifications are still checked, in case
+// an event is missed, e.g. on network file systems or when the watched directory is replaced.
+const notifyFallbackInterval = time.Minute
+
+// dirWatcher is a platform watcher reporting changes of the files in a set of directories.
+type dirWatcher interface {
+	add(dir string) error    // Starts watching the directory
+	remove(dir string) error // Stops watching the directory
+	close() error            // Stops watching all directories and waits for the watcher to finish
+}
+
+// fileNotifier shares one platform watcher between the monitors of all configuration files, watching each
+// directory once and waking the monitors of the files in a directory when something in it changes.
+type fileNotifier struct {
+	mu      sync.Mutex                        // Mutex for synchronizing access to the watcher and the directories
+	watcher dirWatcher                        // Platform watcher, running while a directory is watched
+	dirs    map[string]map[chan struct{}]bool // Channels of the monitors waiting for each watched directory
+}
+
+// SetFileNotify enables or disables file system notifications for change monitoring started afterwards. Instead of
+// hashing the configuration file every few seconds, the monitor of a configuration read from the OS file system
+// sleeps until the file's directory reports a write, rename or removal and then checks the file immediately, which
+// cuts CPU use with many monitored configurations and reacts in well under a second. A check still runs every
+// minute, or at the configured interval if it is longer, in case an event is missed. Symlinks are followed: the
+// directories of a symlinked file and of its targets are watched too and resolved again after every event, so a
+// Kubernetes ConfigMap update, which atomically swaps the ..data symlink of the volume, or a symlink retargeted to
+// another directory is detected immediately. Where notifications are not available (platforms other than Linux, or
+// when the kernel refuses a watch), the monitor falls back to polling. Configurations read through a virtual file
+// system, and configurations checked by a watcher pool, are polled.
+func (cm *ConfigManager) SetFileNotify(enabled bool) {
+	cm.configList.settingsMutex.Lock()
+	defer cm.configList.settingsMutex.Unlock()
+	cm.configList.fileNotify = enabled
+}
+
+// maxSymlinkHops bounds the symlinks followed when resolving the directories of a watched file.
+const maxSymlinkHops = 40
+
+// fileSubscription is the subscription of a monitor to the directories a configuration file is reached through.
+type fileSubscription struct {
+	notifier *fileNotifier   // Notifier the subscription belongs to
+	path     string          // Absolute path of the file
+	events   chan struct{}   // Channel woken when something in one of the directories changes
+	dirs     map[string]bool // Directories the channel is subscribed to
+}
+
+// subscribe returns a subscription whose channel receives a value whenever something changes in the directory of
+// path or in a directory path is reached through by symlinks (see linkDirs). The channel buffers one event, so
+// events arriving during a check are coalesced.
+func (n *fileNotifier) subscribe(path string) (*fileSubscription, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.watcher == nil {
+		watcher, err := newDirWatcher(n.dispatch)
+		if err != nil {
+			return nil, err
+		}
+		n.watcher = watcher
+		n.dirs = make(map[string]map[chan struct{}]bool)
+	}
+
+	s := &fileSubscription{notifier: n, path: path, events: make(chan struct{}, 1), dirs: make(map[string]bool)}
+	if err := s.watch(linkDirs(path)); err != nil && len(s.dirs) == 0 {
+		n.closeIdle()
+		return nil, err
+	}
+	return s, nil
+}
+
+// refresh resolves the symlinks of the file again and moves the subscription to its current directories, e.g.
+// after Kubernetes swapped the ..data symlink of a ConfigMap volume to a new directory. Directories that were
+// removed and recreated are watched again.
+func (s *fileSubscription) refresh() {
+	n := s.notifier
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.watcher == nil {
+		return
+	}
+
+	dirs := linkDirs(s.path)
+	current := make(map[string]bool, len(dirs))
+	for _, dir := range dirs {
+		current[dir] = true
+	}
+	for dir := range s.dirs {
+		if !current[dir] {
+			n.unwatchDir(dir, s.events)
+			delete(s.dirs, dir)
+		}
+	}
+	// Directories that cannot be watched, e.g. while they are missing, are covered by the fallback checks.
+	s.watch(dirs)
+}
+
+// close ends the subscription, unwatching the directories and stopping the watcher when they are no longer needed.
+func (s *fileSubscription) close() {
+	n := s.notifier
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	s.unwatch()
+	n.closeIdle()
+}
+
+// watch subscribes the channel to the directories, watching those not watched yet. Watching a directory again is
+// a no-op for the platform watcher, unless the directory was removed since. It returns the first error, if any,
+// and continues with the remaining directories. The caller holds the lock.
+func (s *fileSubscription) watch(dirs []string) error {
+	n := s.notifier
+	var firstErr error
+	for _, dir := range dirs {
+		if err := n.watcher.add(dir); err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		if n.dirs[dir] == nil {
+			n.dirs[dir] = make(map[chan struct{}]bool)
+		}
+		n.dirs[dir][s.events] = true
+		s.dirs[dir] = true
+	}
+	return firstErr
+}
+
+// unwatch unsubscribes the channel from all its directories. The caller holds the lock.
+func (s *fileSubscription) unwatch() {
+	for dir := range s.dirs {
+		s.notifier.unwatchDir(dir, s.events)
+	}
+	s.dirs = make(map[string]bool)
+}
+
+// unwatchDir unsubscribes a channel from a directory, unwatching the directory when no channel waits for it.
+// The caller holds the lock.
+func (n *fileNotifier) unwatchDir(dir string, events chan struct{}) {
+	subscribers := n.dirs[dir]
+	if !subscribers[events] {
+		return
+	}
+	delete(subscribers, events)
+	if len(subscribers) == 0 {
+		delete(n.dirs, dir)
+		n.watcher.remove(dir)
+	}
+}
+
+// linkDirs returns the directories whose changes can change the file path refers to, resolved: the directory of
+// the file, the directories of the symlinks it is reached through and of their targets, and the directories
+// holding symlinked directories on the way, e.g. the directory of the ..data symlink Kubernetes swaps atomically
+// to update a mounted ConfigMap. A file reached without symlinks yields just its directory.
+func linkDirs(path string) []string {
+	seen := make(map[string]bool)
+	var dirs []string
+	add := func(dir string) {
+		if resolved, err := filepath.EvalSymlinks(dir); err == nil {
+			dir = resolved
+		}
+		if !seen[dir] {
+			seen[dir] = true
+			dirs = append(dirs, dir)
+		}
+	}
+
+	for hops := 0; hops < maxSymlinkHops; hops++ {
+		dir := filepath.Dir(path)
+		add(dir)
+		for parent := dir; parent != filepath.Dir(parent); parent = filepath.Dir(parent) {
+			if info, err := os.Lstat(parent); err == nil && info.Mode()&os.ModeSymlink != 0 {
+				add(filepath.Dir(parent))
+			}
+		}
+
+		info, err := os.Lstat(path)
+		if err != nil || info.Mode()&os.ModeSymlink == 0 {
+			break
+		}
+		target, err := os.Readlink(path)
+		if err != nil {
+			break
+		}
+		if !filepath.IsAbs(target) {
+			target = filepath.Join(dir, target)
+		}
+		path = target
+	}
+	return dirs
+}
+
+// closeIdle stops the watcher if no directory is watched. The caller holds the lock.
+func (n *fileNotifier) closeIdle() {
+	if len(n.dirs) > 0 || n.watcher == nil {
+		return
+	}
+	watcher := n.watcher
+	n.watcher = nil
+	// The watcher goroutine may be waiting for the lock in dispatch; close it without holding the lock.
+	n.mu.Unlock()
+	watcher.close()
+	n.mu.Lock()
+}
+
+// dispatch wakes the monitors waiting for the directory, or for all directories if dir is empty, e.g. after the
+// platform dropped events.
+func (n *fileNotifier) dispatch(dir string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for watched, subscribers := range n.dirs {
+		if dir != "" && watched != dir {
+			continue
+		}
+		for events := range subscribers {
+			select {
+			case events <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
@@ -0,0 +1,117 @@
+//go:build linux
+
+package mkconf
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+// inotifyMask selects the events signaling that a file in a watched directory got new content: writes closing the
+// file, files renamed into or out of the directory (editors saving atomically, Kubernetes ConfigMap updates), and
+// removals. Partial writes are not reported, so a check never reads a file while it is being written.
+const inotifyMask = syscall.IN_CLOSE_WRITE | syscall.IN_MOVED_TO | syscall.IN_MOVED_FROM | syscall.IN_DELETE |
+	syscall.IN_DELETE_SELF | syscall.IN_MOVE_SELF
+
+// inotifyWatcher is the dirWatcher of Linux, based on inotify.
+type inotifyWatcher struct {
+	fd      int              // Descriptor of the inotify instance
+	file    *os.File         // File of the descriptor; closing it stops the reading goroutine
+	mu      sync.Mutex       // Mutex for synchronizing access to the watch descriptors
+	dirs    map[int32]string // Watched directories by watch descriptor
+	wds     map[string]int32 // Watch descriptors by watched directory
+	events  func(dir string) // Function called with the directory of every event
+	stopped sync.WaitGroup   // WaitGroup to wait for the reading goroutine
+}
+
+// newDirWatcher starts an inotify watcher calling events with the directory of every event.
+func newDirWatcher(events func(dir string)) (dirWatcher, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, fmt.Errorf("inotify: %v", err)
+	}
+	w := &inotifyWatcher{
+		// A non-blocking descriptor is handled by the runtime poller, so closing the file interrupts a pending read.
+		fd:     fd,
+		file:   os.NewFile(uintptr(fd), "inotify"),
+		dirs:   make(map[int32]string),
+		wds:    make(map[string]int32),
+		events: events,
+	}
+	w.stopped.Add(1)
+	go w.read()
+	return w, nil
+}
+
+// add implements dirWatcher.
+func (w *inotifyWatcher) add(dir string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if _, ok := w.wds[dir]; ok {
+		return nil
+	}
+	wd, err := syscall.InotifyAddWatch(w.fd, dir, inotifyMask)
+	if err != nil {
+		return fmt.Errorf("inotify: watching %v: %v", dir, err)
+	}
+	w.dirs[int32(wd)] = dir
+	w.wds[dir] = int32(wd)
+	return nil
+}
+
+// remove implements dirWatcher.
+func (w *inotifyWatcher) remove(dir string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	wd, ok := w.wds[dir]
+	if !ok {
+		return nil
+	}
+	delete(w.wds, dir)
+	delete(w.dirs, wd)
+	// The watch is already gone if the directory was removed.
+	syscall.InotifyRmWatch(w.fd, uint32(wd))
+	return nil
+}
+
+// close implements dirWatcher.
+func (w *inotifyWatcher) close() error {
+	err := w.file.Close()
+	w.stopped.Wait()
+	return err
+}
+
+// read reports the events of the inotify instance until it is closed.
+func (w *inotifyWatcher) read() {
+	defer w.stopped.Done()
+	buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+	for {
+		n, err := w.file.Read(buf)
+		if err != nil {
+			return
+		}
+		for offset := 0; offset+syscall.SizeofInotifyEvent <= n; {
+			event := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			offset += syscall.SizeofInotifyEvent + int(event.Len)
+
+			if event.Mask&syscall.IN_Q_OVERFLOW != 0 {
+				w.events("")
+				continue
+			}
+			w.mu.Lock()
+			dir, ok := w.dirs[event.Wd]
+			if ok && event.Mask&syscall.IN_IGNORED != 0 {
+				// The directory was removed or unmounted; its monitors fall back to polling.
+				delete(w.dirs, event.Wd)
+				delete(w.wds, dir)
+			}
+			w.mu.Unlock()
+			if ok {
+				w.events(dir)
+			}
+		}
+	}
+}
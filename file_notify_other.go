@@ -0,0 +1,8 @@
+//go:build !linux
+
+package mkconf
+
+// newDirWatcher reports that file notifications are not available, so monitors poll.
+func newDirWatcher(events func(dir string)) (dirWatcher, error) {
+	return nil, errFileNotifyUnsupported
+}
@@ -0,0 +1,135 @@
+package mkconf
+
+import (
+	"flag"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// configFlag is a command-line flag overriding a value of a configuration.
+type configFlag struct {
+	name      string       // Name of the flag, without the dash
+	text      string       // Value given for the flag; the current value of the field until it is given
+	valueType reflect.Type // Type of the field, which values are checked against
+	set       bool         // Flag indicating the flag was given on the command line
+}
+
+// String implements flag.Value.
+func (f *configFlag) String() string {
+	if f == nil {
+		return ""
+	}
+	return f.text
+}
+
+// Set implements flag.Value, rejecting values that do not parse for the type of the field.
+func (f *configFlag) Set(text string) error {
+	if err := assignEnvValue(reflect.New(f.valueType).Elem(), text); err != nil {
+		return err
+	}
+	f.text, f.set = text, true
+	return nil
+}
+
+// IsBoolFlag lets bool fields be enabled with a bare flag, e.g. -debug.
+func (f *configFlag) IsBoolFlag() bool {
+	return f.valueType != nil && f.valueType.Kind() == reflect.Bool
+}
+
+// BindFlags registers a flag in flagSet for every value of the configuration with the specified name, so operators
+// can override single values at launch. Flags are named by the key path of their field, e.g. -db.host, or by the
+// flag tag of the field; `flag:"-"` skips a field and the fields below it. The usage of a flag is the doc tag of
+// its field, and its default the current value. Flags given on the command line override the values of the file
+// and of environment variables on every load, so bind the flags before flagSet.Parse and load the configuration
+// after it. Overridden values are recorded in the change log of tracked configurations with Source "flag", and
+// DumpTree marks them with their flag. It returns an error if a flag of the same name is already defined.
+func (cm *ConfigManager) BindFlags(flagSet *flag.FlagSet, configName string) error {
+	configInterface, err := cm.GetConfig(configName)
+	if err != nil {
+		return err
+	}
+	settings, ok := cm.configList.getSettings(configName)
+	if !ok {
+		return fmt.Errorf("config with name %s not found", configName)
+	}
+	value := reflect.ValueOf(configInterface)
+	for value.Kind() == reflect.Ptr || value.Kind() == reflect.Interface {
+		if value.IsNil() {
+			break
+		}
+		value = value.Elem()
+	}
+	if value.Kind() != reflect.Struct {
+		return fmt.Errorf("bind flags %v: config is not a struct", configName)
+	}
+
+	flags := make(map[string]*configFlag)
+	usages := make(map[string]string)
+	settings.mu.Lock()
+	bindFlagFields(value, "", formatTag(settings.configType), flags, usages)
+	settings.mu.Unlock()
+	for path, f := range flags {
+		if flagSet.Lookup(f.name) != nil {
+			return fmt.Errorf("bind flags %v: flag -%v of %v is already defined", configName, f.name, path)
+		}
+	}
+	for path, f := range flags {
+		usage := usages[path]
+		if usage == "" {
+			usage = fmt.Sprintf("%v of config %v", path, configName)
+		}
+		flagSet.Var(f, f.name, usage)
+	}
+
+	settings.mu.Lock()
+	defer settings.mu.Unlock()
+	if settings.flags == nil {
+		settings.flags = make(map[string]*configFlag)
+	}
+	for path, f := range flags {
+		settings.flags[path] = f
+	}
+	return nil
+}
+
+// bindFlagFields adds the flags of the fields of the struct value at path to flags, and their usages to usages,
+// both keyed by path.
+func bindFlagFields(value reflect.Value, path, tag string, flags map[string]*configFlag, usages map[string]string) {
+	for _, field := range treeFields(value, tag) {
+		name := strings.Split(field.tag.Get("flag"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		fieldPath := joinPath(path, field.key)
+
+		target := field.value
+		if target.Kind() == reflect.Ptr && !target.IsNil() && target.Elem().Kind() == reflect.Struct {
+			target = target.Elem()
+		}
+		if target.Kind() == reflect.Struct && !isEnvScalar(target) {
+			bindFlagFields(target, fieldPath, tag, flags, usages)
+			continue
+		}
+
+		if name == "" {
+			name = fieldPath
+		}
+		flags[fieldPath] = &configFlag{name: name, text: flagText(field.value), valueType: field.value.Type()}
+		usages[fieldPath] = field.tag.Get("doc")
+	}
+}
+
+// flagText returns the text of a value as given on the command line.
+func flagText(value reflect.Value) string {
+	switch {
+	case value.Kind() == reflect.Ptr && value.IsNil():
+		return ""
+	case value.Type() == reflect.TypeOf(time.Duration(0)):
+		return time.Duration(value.Int()).String()
+	case value.Kind() == reflect.String:
+		return value.String()
+	}
+	return docDefault(value)
+}
@@ -0,0 +1,405 @@
+package mkconf
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	reader "mkconf/readers"
+)
+
+// gcpSecretReference matches values referring to a Google Secret Manager secret, optionally with a version.
+var gcpSecretReference = regexp.MustCompile(`^projects/[^/]+/secrets/[^/]+(/versions/[^/]+)?$`)
+
+// GCPSecretOptions configures the resolution of Google Secret Manager references.
+type GCPSecretOptions struct {
+	Token      string                                    // Static OAuth2 access token, if set
+	TokenFunc  func(ctx context.Context) (string, error) // Function returning a current OAuth2 access token; takes precedence over Token
+	Endpoint   string                                    // Optional endpoint, e.g. of an emulator; "https://secretmanager.googleapis.com" if empty
+	Interval   time.Duration                             // Interval secrets are checked for new versions while watched; 5 minutes if zero
+	HTTPClient *http.Client                              // Client used for requests; http.DefaultClient if nil
+	Source     SourceOptions                             // TLS, proxy and token provider settings; TokenFunc takes precedence over the token provider
+}
+
+// GCPSecretSource is a configuration file whose string values may refer to Google Secret Manager secrets
+// ("projects/my-project/secrets/db-password", optionally with "/versions/<version>", "latest" by default).
+// References are replaced by the secret payloads when the configuration is read; the file itself keeps
+// the references. Secret values are redacted from change logs and quarantine reports.
+type GCPSecretSource struct {
+	path       string             // Path to the configuration file
+	configName string             // Name of the registered configuration
+	reader     reader.Reader      // Reader of the configuration type, implementing reader.StreamReader and reader.StreamWriter
+	options    GCPSecretOptions   // Source options
+	manager    *ConfigManager     // Manager the configuration is registered with
+	secrets    map[string]string  // Accessed secret values by reference
+	mu         sync.Mutex         // Mutex for synchronizing access to the secrets
+	cancel     context.CancelFunc // Function canceling the running refresh
+	waitGroup  sync.WaitGroup     // WaitGroup to wait for the refresh goroutine
+	secretRedaction
+}
+
+// AddGCPSecretConfig adds a configuration file whose values may refer to Google Secret Manager secrets, which are
+// resolved when the configuration is read. File changes are detected by StartChangeMonitoring as usual; call
+// StartWatching on the returned source to also check the secrets for new versions every interval. UpdateConfig
+// writes the references, not the secret values, back to the file.
+func (cm *ConfigManager) AddGCPSecretConfig(configName, configPath, configType string, configInterface interface{}, options GCPSecretOptions) (*GCPSecretSource, error) {
+	if reader.CompressionExt(configType) != "" {
+		return nil, fmt.Errorf("config %v: secret references are not supported for compressed configurations", configName)
+	}
+	configReader := (&ConfigSettings{configType: configType}).checkReader()
+	_, canRead := configReader.(reader.StreamReader)
+	_, canWrite := configReader.(reader.StreamWriter)
+	if !canRead || !canWrite {
+		return nil, fmt.Errorf("config %v: secret references are not supported for config type %v", configName, configType)
+	}
+	if options.TokenFunc == nil {
+		options.TokenFunc = options.Source.TokenFunc
+	}
+	client, err := options.Source.httpClient(options.HTTPClient)
+	if err != nil {
+		return nil, fmt.Errorf("config %v: %v", configName, err)
+	}
+	options.HTTPClient = client
+	if options.Endpoint == "" {
+		options.Endpoint = "https://secretmanager.googleapis.com"
+	}
+	if options.Interval <= 0 {
+		options.Interval = 5 * time.Minute
+	}
+
+	s := &GCPSecretSource{
+		path:       filepath.Join(configPath, configName+configType),
+		configName: configName,
+		reader:     configReader,
+		options:    options,
+		manager:    cm,
+		secrets:    make(map[string]string),
+	}
+	if err := cm.AddConfigFS(s, configName, configPath, configType, configInterface); err != nil {
+		return nil, err
+	}
+	cm.addRemoteSource(configName, s)
+	return s, nil
+}
+
+// Open implements fs.FS. Every name resolves to the configuration file with the secret references resolved.
+// The file is returned unchanged if it has no references.
+func (s *GCPSecretSource) Open(name string) (fs.File, error) {
+	content, err := s.resolved(context.Background())
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	return newRemoteFile(name, content), nil
+}
+
+// WriteFile implements reader.WriteFileFS. Values still equal to the secret they were resolved from are
+// written back as the reference.
+func (s *GCPSecretSource) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	s.mu.Lock()
+	hasSecrets := len(s.secrets) > 0
+	s.mu.Unlock()
+	if !hasSecrets {
+		return ioutil.WriteFile(s.path, data, perm)
+	}
+
+	content, err := ioutil.ReadFile(s.path)
+	if err != nil {
+		return err
+	}
+	original, err := decodeValues(s.reader, content)
+	if err != nil {
+		return err
+	}
+	values, err := decodeValues(s.reader, data)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	restored := s.restoreReferences(values, original)
+	s.mu.Unlock()
+	var b bytes.Buffer
+	if err := s.reader.(reader.StreamWriter).WriteConfigTo(&b, restored); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(s.path, b.Bytes(), perm)
+}
+
+// Refresh accesses the referenced secrets again and loads the configuration.
+// It is not needed while the source is watched.
+func (s *GCPSecretSource) Refresh() error {
+	if _, err := s.refresh(context.Background()); err != nil {
+		return err
+	}
+	return s.manager.LoadConfig(s.configName)
+}
+
+// StartWatching checks the referenced secrets for new versions every interval. New versions are applied
+// through the change callbacks if change monitoring is running. Errors are reported through errorFunc if it is set.
+func (s *GCPSecretSource) StartWatching(errorFunc func(err error)) error {
+	s.StopWatching()
+	errorFunc = quietCircuitErrors(errorFunc)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.mu.Lock()
+	s.cancel = cancel
+	s.mu.Unlock()
+
+	s.waitGroup.Add(1)
+	s.manager.configList.resources.acquire(s.configName, resourceRemoteWatch)
+	go func() {
+		defer s.waitGroup.Done()
+		defer s.manager.configList.resources.release(s.configName, resourceRemoteWatch)
+		ticker := time.NewTicker(s.options.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			changed, err := s.refresh(ctx)
+			if err == nil && changed {
+				err = s.manager.applyRemoteChange(s.configName)
+			}
+			if err != nil && ctx.Err() == nil && errorFunc != nil {
+				errorFunc(err)
+			}
+		}
+	}()
+	return nil
+}
+
+// StopWatching stops checking the secrets and waits for the check to finish.
+func (s *GCPSecretSource) StopWatching() {
+	s.mu.Lock()
+	cancel := s.cancel
+	s.cancel = nil
+	s.mu.Unlock()
+
+	if cancel == nil {
+		return
+	}
+	cancel()
+	s.waitGroup.Wait()
+}
+
+// refresh calls refreshOnce according to the retry policy and circuit breaker of the configuration.
+func (s *GCPSecretSource) refresh(ctx context.Context) (bool, error) {
+	var changed bool
+	err := s.manager.retryFetch(ctx, s.configName, func() error {
+		var err error
+		changed, err = s.refreshOnce(ctx)
+		return err
+	})
+	return changed, err
+}
+
+// refreshOnce accesses every referenced secret again and reports whether a value changed.
+func (s *GCPSecretSource) refreshOnce(ctx context.Context) (bool, error) {
+	s.mu.Lock()
+	references := make([]string, 0, len(s.secrets))
+	for reference := range s.secrets {
+		references = append(references, reference)
+	}
+	s.mu.Unlock()
+
+	changed := false
+	for _, reference := range references {
+		secret, err := s.access(ctx, reference)
+		if err != nil {
+			return changed, err
+		}
+		s.mu.Lock()
+		if s.secrets[reference] != secret {
+			changed = true
+		}
+		s.secrets[reference] = secret
+		s.mu.Unlock()
+	}
+	s.manager.sourceReached(s.configName)
+	return changed, nil
+}
+
+// resolved reads the configuration file and replaces the secret references with their values.
+func (s *GCPSecretSource) resolved(ctx context.Context) ([]byte, error) {
+	content, err := ioutil.ReadFile(s.path)
+	if err != nil {
+		return nil, err
+	}
+	values, err := decodeValues(s.reader, content)
+	if err != nil {
+		return nil, err
+	}
+	resolved, secrets, err := s.resolve(ctx, values)
+	if err != nil {
+		return nil, err
+	}
+	if secrets == nil {
+		return content, nil
+	}
+
+	s.recordSecrets(secrets.(map[string]interface{}))
+	var b bytes.Buffer
+	if err := s.reader.(reader.StreamWriter).WriteConfigTo(&b, resolved); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// resolve replaces the secret references in value. It returns the resolved value and a tree of the resolved
+// secrets shaped like value, or nil if value has no references.
+func (s *GCPSecretSource) resolve(ctx context.Context, value interface{}) (interface{}, interface{}, error) {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		resolved := make(map[string]interface{}, len(value))
+		secrets := make(map[string]interface{})
+		for key, item := range value {
+			item, secret, err := s.resolve(ctx, item)
+			if err != nil {
+				return nil, nil, err
+			}
+			resolved[key] = item
+			if secret != nil {
+				secrets[key] = secret
+			}
+		}
+		if len(secrets) == 0 {
+			return resolved, nil, nil
+		}
+		return resolved, secrets, nil
+	case []interface{}:
+		resolved := make([]interface{}, len(value))
+		hasSecrets := false
+		for i, item := range value {
+			item, secret, err := s.resolve(ctx, item)
+			if err != nil {
+				return nil, nil, err
+			}
+			resolved[i] = item
+			hasSecrets = hasSecrets || secret != nil
+		}
+		if !hasSecrets {
+			return resolved, nil, nil
+		}
+		// Lists are redacted as a whole.
+		return resolved, resolved, nil
+	case string:
+		if !gcpSecretReference.MatchString(value) {
+			return value, nil, nil
+		}
+		secret, err := s.secret(ctx, value)
+		if err != nil {
+			return nil, nil, err
+		}
+		return secret, secret, nil
+	default:
+		return value, nil, nil
+	}
+}
+
+// restoreReferences returns values with every value that still equals the secret it was resolved from
+// replaced by the reference in original. The caller must hold s.mu.
+func (s *GCPSecretSource) restoreReferences(values, original interface{}) interface{} {
+	switch value := values.(type) {
+	case map[string]interface{}:
+		originalMap, _ := original.(map[string]interface{})
+		restored := make(map[string]interface{}, len(value))
+		for key, item := range value {
+			restored[key] = s.restoreReferences(item, originalMap[key])
+		}
+		return restored
+	case []interface{}:
+		originalList, _ := original.([]interface{})
+		restored := make([]interface{}, len(value))
+		for i, item := range value {
+			var originalItem interface{}
+			if i < len(originalList) {
+				originalItem = originalList[i]
+			}
+			restored[i] = s.restoreReferences(item, originalItem)
+		}
+		return restored
+	case string:
+		reference, ok := original.(string)
+		if ok && gcpSecretReference.MatchString(reference) && s.secrets[reference] == value {
+			return reference
+		}
+		return value
+	default:
+		return values
+	}
+}
+
+// secret returns the value of the referenced secret, accessing it if it was not accessed yet.
+func (s *GCPSecretSource) secret(ctx context.Context, reference string) (string, error) {
+	s.mu.Lock()
+	secret, ok := s.secrets[reference]
+	s.mu.Unlock()
+	if ok {
+		return secret, nil
+	}
+
+	secret, err := s.access(ctx, reference)
+	if err != nil {
+		return "", err
+	}
+	s.mu.Lock()
+	s.secrets[reference] = secret
+	s.mu.Unlock()
+	return secret, nil
+}
+
+// access reads the referenced secret version from Secret Manager.
+func (s *GCPSecretSource) access(ctx context.Context, reference string) (string, error) {
+	name := reference
+	if !strings.Contains(name, "/versions/") {
+		name += "/versions/latest"
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(s.options.Endpoint, "/")+"/v1/"+name+":access", nil)
+	if err != nil {
+		return "", err
+	}
+	token := s.options.Token
+	if s.options.TokenFunc != nil {
+		if token, err = s.options.TokenFunc(ctx); err != nil {
+			return "", fmt.Errorf("secret manager %v: token: %v", reference, err)
+		}
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := doBlobRequest(s.options.HTTPClient, req)
+	if err != nil {
+		return "", fmt.Errorf("secret manager %v: %v", reference, err)
+	}
+	content, err := readBlobResponse(resp)
+	if err != nil {
+		return "", fmt.Errorf("secret manager %v: %v", reference, err)
+	}
+	var response struct {
+		Payload struct {
+			Data string `json:"data"`
+		} `json:"payload"`
+	}
+	if err := json.Unmarshal(content, &response); err != nil {
+		return "", fmt.Errorf("secret manager %v: %v", reference, err)
+	}
+	value, err := base64.StdEncoding.DecodeString(response.Payload.Data)
+	if err != nil {
+		return "", fmt.Errorf("secret manager %v: %v", reference, err)
+	}
+	return string(value), nil
+}
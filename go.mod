@@ -3,7 +3,7 @@ module mkconf
 go 1.20
 
 require (
-	github.com/pelletier/go-toml v1.9.5 // indirect
-	gopkg.in/ini.v1 v1.67.0 // indirect
-	gopkg.in/yaml.v2 v2.4.0 // indirect
+	github.com/pelletier/go-toml v1.9.5
+	gopkg.in/ini.v1 v1.67.0
+	gopkg.in/yaml.v2 v2.4.0
 )
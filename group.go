@@ -0,0 +1,259 @@
+package mkconf
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// GroupChangeCallbackFunc is a function type used for grouped change callbacks.
+// It receives the group name and the names of all configurations applied together.
+type GroupChangeCallbackFunc func(groupName string, configNames []string)
+
+// configGroup is a set of correlated configurations that are always applied together.
+type configGroup struct {
+	names     []string                // Names of the member configurations
+	callback  GroupChangeCallbackFunc // Callback invoked once per applied change of the group
+	stop      chan struct{}           // Channel closed to stop group monitoring
+	waitGroup sync.WaitGroup          // WaitGroup to wait for the monitoring goroutine
+}
+
+// pendingSnapshot is a validated, not yet applied configuration snapshot.
+type pendingSnapshot struct {
+	name      string                 // Name of the configuration
+	settings  *ConfigSettings        // Settings of the configuration
+	apply     func()                 // Function copying the snapshot into the configuration interface
+	config    interface{}            // Configuration interface the snapshot is applied to
+	hash      string                 // Hash of the file the snapshot was decoded from
+	content   []byte                 // Content of the file the snapshot was decoded from
+	configMap map[string]interface{} // Map representation of the snapshot
+}
+
+// AddConfigGroup defines a group of already added configurations that are validated and applied as a unit.
+// The callback, if set, is invoked once with all member names whenever the group is applied.
+// Returns an error if the group exists or a member is not found.
+func (cm *ConfigManager) AddConfigGroup(groupName string, configNames []string, callback GroupChangeCallbackFunc) error {
+	for _, name := range configNames {
+		if _, err := cm.GetConfig(name); err != nil {
+			return fmt.Errorf("config group %s: %v", groupName, err)
+		}
+	}
+
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	if cm.groups == nil {
+		cm.groups = make(map[string]*configGroup)
+	}
+	if _, ok := cm.groups[groupName]; ok {
+		return fmt.Errorf("config group with name %s already exists", groupName)
+	}
+	cm.groups[groupName] = &configGroup{names: append([]string(nil), configNames...), callback: callback}
+	return nil
+}
+
+// ApplyConfigGroup validates every member of the group and applies all of them or none.
+// Returns an error describing every member that failed validation.
+func (cm *ConfigManager) ApplyConfigGroup(groupName string) error {
+	group, err := cm.getGroup(groupName)
+	if err != nil {
+		return err
+	}
+
+	if err := cm.applyConfigsAtomically(group.names); err != nil {
+		return fmt.Errorf("config group %s: %v", groupName, err)
+	}
+	if group.callback != nil {
+		group.callback(groupName, append([]string(nil), group.names...))
+	}
+	return nil
+}
+
+// StartGroupMonitoring checks the member files of the group every interval and applies the whole group
+// when any of them changed. Members should not be monitored individually at the same time.
+func (cm *ConfigManager) StartGroupMonitoring(groupName string, interval time.Duration) error {
+	group, err := cm.getGroup(groupName)
+	if err != nil {
+		return err
+	}
+	cm.StopGroupMonitoring(groupName)
+
+	stop := make(chan struct{})
+	cm.mu.Lock()
+	group.stop = stop
+	cm.mu.Unlock()
+
+	group.waitGroup.Add(1)
+	go func() {
+		defer group.waitGroup.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				if !cm.groupChanged(group) {
+					continue
+				}
+				if err := cm.ApplyConfigGroup(groupName); err != nil {
+					cm.reportError(fmt.Errorf("monitoring: error applying config group %v: %w", groupName, err))
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+// StopGroupMonitoring stops monitoring of the group and waits for it to finish.
+func (cm *ConfigManager) StopGroupMonitoring(groupName string) {
+	group, err := cm.getGroup(groupName)
+	if err != nil {
+		return
+	}
+
+	cm.mu.Lock()
+	stop := group.stop
+	group.stop = nil
+	cm.mu.Unlock()
+
+	if stop != nil {
+		close(stop)
+	}
+	group.waitGroup.Wait()
+}
+
+// getGroup returns the group with the specified name.
+func (cm *ConfigManager) getGroup(groupName string) (*configGroup, error) {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+	group, ok := cm.groups[groupName]
+	if !ok {
+		return nil, fmt.Errorf("config group with name %s not found", groupName)
+	}
+	return group, nil
+}
+
+// groupChanged reports whether the file of any group member differs from its last applied hash.
+func (cm *ConfigManager) groupChanged(group *configGroup) bool {
+	for _, name := range group.names {
+		settings, ok := cm.configList.getSettings(name)
+		if !ok {
+			continue
+		}
+		settings.mu.Lock()
+		hash, err := settings.calculateFileHash(settings.configFullPath)
+		changed := err == nil && hash != settings.lastConfigHash
+		settings.mu.Unlock()
+		if changed {
+			return true
+		}
+	}
+	return false
+}
+
+// applyConfigsAtomically decodes and validates all named configurations and, only if all of them succeeded,
+// swaps every snapshot in while holding all of their locks, so readers never observe a half-applied state.
+func (cm *ConfigManager) applyConfigsAtomically(configNames []string) error {
+	names := append([]string(nil), configNames...)
+	sort.Strings(names)
+
+	pending := make([]pendingSnapshot, 0, len(names))
+	var errors []string
+	for _, name := range names {
+		snapshot, err := cm.prepareSnapshot(name)
+		if err != nil {
+			errors = append(errors, fmt.Sprintf("%v: %v", name, err))
+			continue
+		}
+		pending = append(pending, snapshot)
+	}
+	if len(errors) > 0 {
+		return fmt.Errorf("nothing applied: %v", strings.Join(errors, "; "))
+	}
+
+	// Locks are always taken in name order to avoid deadlocks between concurrent group applies.
+	for _, p := range pending {
+		p.settings.mu.Lock()
+	}
+	trackedChanges := make(map[string][]ConfigChangeLog)
+	for _, p := range pending {
+		p.apply()
+		if p.settings.enableChangeTracking && p.configMap != nil {
+			changes := make([]ConfigChangeLog, 0)
+			p.settings.pinMap(p.settings.configMAP, p.configMap)
+			compareFields(p.name, p.settings.configMAP, p.configMap, &changes)
+			p.settings.redactChanges(changes)
+			trackedChanges[p.name] = changes
+		}
+		if p.configMap != nil {
+			p.settings.configMAP = p.configMap
+		}
+		p.settings.config = p.config
+		p.settings.lastConfigHash = p.hash
+		p.settings.rememberContent(p.content)
+		p.settings.recordHistory(p.config)
+		p.settings.refreshSnapshot(p.config)
+	}
+	for i := len(pending) - 1; i >= 0; i-- {
+		pending[i].settings.mu.Unlock()
+	}
+
+	cm.configList.logMutex.Lock()
+	for name, changes := range trackedChanges {
+		changes = cm.configList.annotateImpacts(name, changes)
+		trackedChanges[name] = changes
+		cm.configList.changeLogs[name] = append(cm.configList.changeLogs[name], changes...)
+	}
+	sinks := cm.configList.changeSinks
+	cm.configList.logMutex.Unlock()
+
+	for _, sink := range sinks {
+		for name, changes := range trackedChanges {
+			if len(changes) > 0 {
+				sink.publishChanges(name, changes)
+			}
+		}
+	}
+	return nil
+}
+
+// prepareSnapshot decodes and validates a configuration without applying it.
+func (cm *ConfigManager) prepareSnapshot(configName string) (pendingSnapshot, error) {
+	configInterface, err := cm.GetConfig(configName)
+	if err != nil {
+		return pendingSnapshot{}, err
+	}
+	settings, ok := cm.configList.getSettings(configName)
+	if !ok {
+		return pendingSnapshot{}, fmt.Errorf("config with name %s not found", configName)
+	}
+
+	settings.mu.Lock()
+	defer settings.mu.Unlock()
+
+	if settings.Reader == nil {
+		return pendingSnapshot{}, fmt.Errorf("reader not set for config %s", configName)
+	}
+	// The file is read once, so the stored hash always matches the applied content.
+	content, err := settings.source().ReadSourceFile(settings.configFullPath)
+	if err != nil {
+		return pendingSnapshot{}, err
+	}
+	configMap, mapErr := settings.contentToMap(settings.configFullPath, content)
+	if mapErr == nil {
+		if err := settings.checkMapCoercions(configMap, configInterface); err != nil {
+			cm.configList.quarantineRejected(settings, content, err)
+			return pendingSnapshot{}, err
+		}
+	}
+	apply, err := settings.decodeContent(settings.configFullPath, content, configInterface)
+	if err != nil {
+		cm.configList.quarantineRejected(settings, content, err)
+		return pendingSnapshot{}, err
+	}
+
+	return pendingSnapshot{name: configName, settings: settings, apply: apply, config: configInterface,
+		hash: settings.hashContent(content), content: content, configMap: configMap}, nil
+}
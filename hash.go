@@ -0,0 +1,123 @@
+package mkconf
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"math/bits"
+	"strconv"
+)
+
+// Hasher computes the hash identifying the content of a configuration file, which change monitoring compares to
+// detect changes. Hashes are only compared with hashes of the same Hasher.
+type Hasher interface {
+	Hash(content []byte) string
+}
+
+// HasherFunc adapts a function to the Hasher interface.
+type HasherFunc func(content []byte) string
+
+// Hash implements Hasher.
+func (f HasherFunc) Hash(content []byte) string {
+	return f(content)
+}
+
+var (
+	// SHA256Hasher hashes content with SHA-256, available in FIPS-constrained environments. It is the default.
+	SHA256Hasher Hasher = HasherFunc(func(content []byte) string {
+		sum := sha256.Sum256(content)
+		return hex.EncodeToString(sum[:])
+	})
+
+	// MD5Hasher hashes content with MD5, the hash of earlier versions, e.g. for hashes passed to SetHash.
+	MD5Hasher Hasher = HasherFunc(func(content []byte) string {
+		sum := md5.Sum(content)
+		return hex.EncodeToString(sum[:])
+	})
+
+	// XXHasher hashes content with the non-cryptographic XXH64, several times faster than SHA-256 on large files.
+	XXHasher Hasher = HasherFunc(func(content []byte) string {
+		return strconv.FormatUint(xxhash64(content), 16)
+	})
+)
+
+// SetHasher sets the hash function used to detect changes of the configuration file; SHA256Hasher if nil. The
+// hash of the content last applied is recomputed, so switching does not cause a reload.
+func (c *ConfigSettings) SetHasher(hasher Hasher) *ConfigSettings {
+	if hasher == nil {
+		hasher = SHA256Hasher
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.hasher = hasher
+	if c.lastConfigHash != "" && c.lastGoodContent != nil {
+		c.lastConfigHash = hasher.Hash(c.lastGoodContent)
+	}
+	return c
+}
+
+// Primes of XXH64, variables so that arithmetic on them wraps around.
+var (
+	xxPrime1 uint64 = 11400714785074694791
+	xxPrime2 uint64 = 14029467366897019727
+	xxPrime3 uint64 = 1609587929392839161
+	xxPrime4 uint64 = 9650029242287828579
+	xxPrime5 uint64 = 2870177450012600261
+)
+
+// xxhash64 returns the XXH64 hash of data with seed 0.
+func xxhash64(data []byte) uint64 {
+	n := len(data)
+	var h uint64
+	if n >= 32 {
+		v1, v2, v3, v4 := xxPrime1+xxPrime2, xxPrime2, uint64(0), -xxPrime1
+		for ; len(data) >= 32; data = data[32:] {
+			v1 = xxRound(v1, binary.LittleEndian.Uint64(data[0:8]))
+			v2 = xxRound(v2, binary.LittleEndian.Uint64(data[8:16]))
+			v3 = xxRound(v3, binary.LittleEndian.Uint64(data[16:24]))
+			v4 = xxRound(v4, binary.LittleEndian.Uint64(data[24:32]))
+		}
+		h = bits.RotateLeft64(v1, 1) + bits.RotateLeft64(v2, 7) + bits.RotateLeft64(v3, 12) + bits.RotateLeft64(v4, 18)
+		h = xxMergeRound(h, v1)
+		h = xxMergeRound(h, v2)
+		h = xxMergeRound(h, v3)
+		h = xxMergeRound(h, v4)
+	} else {
+		h = xxPrime5
+	}
+	h += uint64(n)
+
+	for ; len(data) >= 8; data = data[8:] {
+		h ^= xxRound(0, binary.LittleEndian.Uint64(data))
+		h = bits.RotateLeft64(h, 27)*xxPrime1 + xxPrime4
+	}
+	if len(data) >= 4 {
+		h ^= uint64(binary.LittleEndian.Uint32(data)) * xxPrime1
+		h = bits.RotateLeft64(h, 23)*xxPrime2 + xxPrime3
+		data = data[4:]
+	}
+	for _, b := range data {
+		h ^= uint64(b) * xxPrime5
+		h = bits.RotateLeft64(h, 11) * xxPrime1
+	}
+
+	h ^= h >> 33
+	h *= xxPrime2
+	h ^= h >> 29
+	h *= xxPrime3
+	h ^= h >> 32
+	return h
+}
+
+// xxRound mixes an 8-byte lane into an accumulator of XXH64.
+func xxRound(acc, input uint64) uint64 {
+	acc += input * xxPrime2
+	return bits.RotateLeft64(acc, 31) * xxPrime1
+}
+
+// xxMergeRound merges an accumulator into the hash of XXH64.
+func xxMergeRound(h, acc uint64) uint64 {
+	h ^= xxRound(0, acc)
+	return h*xxPrime1 + xxPrime4
+}
@@ -0,0 +1,233 @@
+package mkconf
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// historyMutex serializes appends to history files, which come from reloads and from the change log.
+var historyMutex sync.Mutex
+
+// historyEntry is a line of the history file of a configuration: either a version of its values or a change.
+type historyEntry struct {
+	Time   time.Time        `json:"time"`             // Time the values were applied or the change was recorded
+	Values json.RawMessage  `json:"values,omitempty"` // Applied values, as in the snapshot endpoint
+	Change *ConfigChangeLog `json:"change,omitempty"` // Tracked change
+}
+
+// historySink appends the tracked changes of configurations to their history files.
+type historySink struct {
+	list *ConfigList // Configuration list the sink is registered with
+}
+
+// SetHistoryDir sets a directory where the history of every configuration is persisted, as a JSON Lines file
+// named after the configuration, e.g. app.history.jsonl. Every time the applied values change, by a load, a
+// reload or a group apply, the new values are appended as a version; tracked changes of the change log are
+// appended as they are recorded. GetValueAt looks up past values in this history, so post-incident investigations
+// can tell what a limit was set to at a given time, across restarts. Files of configurations with secrets are only
+// readable by the owner. The history is never pruned. Errors recording it are reported to the function set with
+// SetErrorFunc.
+func (cm *ConfigManager) SetHistoryDir(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("history dir: %v", err)
+	}
+
+	cm.configList.settingsMutex.Lock()
+	registered := cm.configList.historyDir != ""
+	cm.configList.historyDir = dir
+	cm.configList.settingsMutex.Unlock()
+	if !registered {
+		cm.configList.addChangeSink(&historySink{list: cm.configList})
+	}
+
+	for _, settings := range cm.configList.settingsSnapshot() {
+		settings.mu.Lock()
+		settings.historyPath = historyPath(dir, settings.configName)
+		settings.historyLast = nil
+		settings.mu.Unlock()
+	}
+	return nil
+}
+
+// GetValueAt returns the value at the dot-separated key path (e.g. "limits.rate") of a configuration at a past
+// time, from the history persisted in the directory set with SetHistoryDir. Keys match case-insensitively; list
+// elements are addressed by index, e.g. "servers.0.host"; an empty path returns all values. Values are returned as
+// decoded from JSON, so numbers are float64. It fails if no version was recorded at or before the time, or the
+// version held no value at the path.
+func (cm *ConfigManager) GetValueAt(configName, key string, at time.Time) (interface{}, error) {
+	settings, ok := cm.configList.getSettings(configName)
+	if !ok {
+		return nil, fmt.Errorf("config with name %s not found", configName)
+	}
+	settings.mu.Lock()
+	path := settings.historyPath
+	settings.mu.Unlock()
+	if path == "" {
+		return nil, fmt.Errorf("history of config %v: history dir is not set", configName)
+	}
+
+	historyMutex.Lock()
+	entries, err := readHistory(path)
+	historyMutex.Unlock()
+	if err != nil {
+		return nil, fmt.Errorf("history of config %v: %v", configName, err)
+	}
+	var version *historyEntry
+	for i := range entries {
+		if entries[i].Values != nil && !entries[i].Time.After(at) {
+			version = &entries[i]
+		}
+	}
+	if version == nil {
+		return nil, fmt.Errorf("history of config %v: no version at %v", configName, at.Format(time.RFC3339))
+	}
+
+	var values interface{}
+	if err := json.Unmarshal(version.Values, &values); err != nil {
+		return nil, fmt.Errorf("history of config %v: %v", configName, err)
+	}
+	if key == "" {
+		return values, nil
+	}
+	value, ok := historyValue(values, strings.Split(key, "."))
+	if !ok {
+		return nil, fmt.Errorf("history of config %v: %v not set at %v", configName, key, at.Format(time.RFC3339))
+	}
+	return value, nil
+}
+
+// historyPath returns the path of the history file of a configuration in dir.
+func historyPath(dir, configName string) string {
+	return filepath.Join(dir, configName+".history.jsonl")
+}
+
+// historyValue returns the value at path in decoded values, matching keys case-insensitively.
+func historyValue(value interface{}, path []string) (interface{}, bool) {
+	for _, key := range path {
+		switch current := value.(type) {
+		case map[string]interface{}:
+			item, ok := current[key]
+			if !ok {
+				for name, other := range current {
+					if strings.EqualFold(name, key) {
+						item, ok = other, true
+						break
+					}
+				}
+			}
+			if !ok {
+				return nil, false
+			}
+			value = item
+		case []interface{}:
+			index, err := strconv.Atoi(key)
+			if err != nil || index < 0 || index >= len(current) {
+				return nil, false
+			}
+			value = current[index]
+		default:
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+// recordHistory appends the values of v to the history file as a version if they changed since the last version.
+// The caller must hold c.mu.
+func (c *ConfigSettings) recordHistory(v interface{}) {
+	if c.historyPath == "" {
+		return
+	}
+	values, err := json.Marshal(jsonCompatible(v))
+	if err != nil {
+		c.reportError(fmt.Errorf("history: error recording config %v: %w", c.configName, err))
+		return
+	}
+	if bytes.Equal(values, c.historyLast) {
+		return
+	}
+	if err := appendHistory(c.historyPath, c.historyPerm(), historyEntry{Time: time.Now(), Values: values}); err != nil {
+		c.reportError(fmt.Errorf("history: error recording config %v: %w", c.configName, err))
+		return
+	}
+	c.historyLast = values
+}
+
+// historyPerm returns the permissions of the history file, which only the owner may read if it holds secrets.
+func (c *ConfigSettings) historyPerm() os.FileMode {
+	if _, ok := c.fsys.(configRedactor); ok {
+		return 0600
+	}
+	return 0644
+}
+
+// publishChanges implements changeSink, appending the changes to the history file of the configuration.
+func (s *historySink) publishChanges(configName string, changes []ConfigChangeLog) {
+	settings, ok := s.list.getSettings(configName)
+	if !ok {
+		return
+	}
+	settings.mu.Lock()
+	path, perm := settings.historyPath, settings.historyPerm()
+	settings.mu.Unlock()
+	if path == "" {
+		return
+	}
+	for i := range changes {
+		if err := appendHistory(path, perm, historyEntry{Time: changes[i].Timestamp, Change: &changes[i]}); err != nil {
+			s.list.reportError(fmt.Errorf("history: error recording config %v: %w", configName, err))
+			return
+		}
+	}
+}
+
+// appendHistory appends an entry to a history file.
+func appendHistory(path string, perm os.FileMode, entry historyEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	historyMutex.Lock()
+	defer historyMutex.Unlock()
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// readHistory returns the entries of a history file, or none if it does not exist. Lines that do not decode, such
+// as a line cut short by a crash, are skipped.
+func readHistory(path string) ([]historyEntry, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var entries []historyEntry
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 64<<20)
+	for scanner.Scan() {
+		var entry historyEntry
+		if json.Unmarshal(scanner.Bytes(), &entry) == nil {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, scanner.Err()
+}
@@ -0,0 +1,36 @@
+package mkconf
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestHistoryErrorsReportedThroughErrorFunc(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "hist.json"), []byte(`{"version": 1}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var reported []error
+	cm := NewConfigManager()
+	cm.SetErrorFunc(func(err error) { reported = append(reported, err) })
+	if err := cm.AddConfig("hist", dir, ".json", &stressConfig{}); err != nil {
+		t.Fatalf("AddConfig: %v", err)
+	}
+	historyDir := filepath.Join(dir, "history")
+	if err := cm.SetHistoryDir(historyDir); err != nil {
+		t.Fatalf("SetHistoryDir: %v", err)
+	}
+	// A directory in place of the history file makes appending to it fail.
+	if err := os.Mkdir(historyPath(historyDir, "hist"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := cm.LoadConfig("hist"); err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	if len(reported) != 1 || !strings.Contains(reported[0].Error(), "history: error recording config hist") {
+		t.Fatalf("reported %v, want the history error of config hist", reported)
+	}
+}
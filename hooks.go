@@ -0,0 +1,255 @@
+package mkconf
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+)
+
+// ConfigHook is a user-supplied hook invoked on a freshly decoded configuration before it is applied.
+// The configuration is passed to the hook as JSON so hooks stay independent of the file format.
+type ConfigHook interface {
+	Validate(configName string, data []byte) error         // Validate returns an error if the configuration must be rejected.
+	Mutate(configName string, data []byte) ([]byte, error) // Mutate returns the (possibly modified) configuration.
+}
+
+// WasmLimits describes the resource limits of a WASM hook.
+type WasmLimits struct {
+	MemoryPages uint32        // Maximum number of 64KiB memory pages the module may use; enforced by the WasmRuntime only
+	Timeout     time.Duration // Maximum execution time of a single hook call, 1s if zero; enforced by WasmHook
+	MaxOutput   int           // Maximum size in bytes of the output of a single hook call, 1MiB if zero; enforced by WasmHook
+}
+
+// defaultWasmMaxOutput is the output size limit of WASM hook calls if WasmLimits.MaxOutput is zero.
+const defaultWasmMaxOutput = 1 << 20
+
+// WasmRuntime instantiates compiled WASM modules. mkconf does not ship a runtime and provides no sandboxing itself:
+// isolating the module from the host and capping its memory at MemoryPages is entirely up to the implementation,
+// e.g. a wrapper around wazero or wasmtime. Implementations should abort calls when the context is done; WasmHook
+// stops waiting for calls exceeding the timeout in any case.
+type WasmRuntime interface {
+	Instantiate(ctx context.Context, code []byte, limits WasmLimits) (WasmModule, error)
+}
+
+// WasmModule is an instantiated WASM module exposing hook functions.
+// Call passes input to the exported function and returns its output; an absent export must return an error
+// wrapping ErrWasmExportNotFound.
+type WasmModule interface {
+	Call(ctx context.Context, function string, input []byte) ([]byte, error)
+	Close(ctx context.Context) error
+}
+
+// ErrWasmExportNotFound is returned by WasmModule.Call when the module does not export the requested function.
+var ErrWasmExportNotFound = errors.New("wasm export not found")
+
+// ErrWasmHookClosed is wrapped by the errors of Validate and Mutate calls of a closed WasmHook.
+var ErrWasmHookClosed = errors.New("wasm hook closed")
+
+// ErrWasmOutputTooLarge is wrapped by the errors of WasmHook calls whose output exceeds WasmLimits.MaxOutput.
+var ErrWasmOutputTooLarge = errors.New("wasm output too large")
+
+// WasmHook implements ConfigHook on top of a WASM module loaded at runtime.
+// The module may export "validate" (non-empty output is treated as the rejection message)
+// and "mutate" (output replaces the configuration). The module file is re-instantiated
+// whenever it changes on disk, so policy logic can be updated without recompiling the host.
+// The hook enforces the timeout and the output size limit of its calls; isolation and memory limits depend on
+// the WasmRuntime.
+type WasmHook struct {
+	path    string      // Path to the .wasm module
+	runtime WasmRuntime // Runtime used to instantiate the module
+	limits  WasmLimits  // Resource limits for the sandbox
+	module  WasmModule  // Currently instantiated module
+	modTime time.Time   // Modification time of the instantiated module file
+	closed  bool        // Flag set by Close, failing further calls
+	mu      sync.Mutex  // Mutex for synchronizing module reloads and calls
+}
+
+// NewWasmHook loads the WASM module at the given path using the provided runtime and limits.
+// Returns an error if the module cannot be read or instantiated.
+func NewWasmHook(runtime WasmRuntime, path string, limits WasmLimits) (*WasmHook, error) {
+	if runtime == nil {
+		return nil, fmt.Errorf("wasm hook %v: runtime is not set", path)
+	}
+	if limits.Timeout <= 0 {
+		limits.Timeout = time.Second
+	}
+	if limits.MaxOutput <= 0 {
+		limits.MaxOutput = defaultWasmMaxOutput
+	}
+	h := &WasmHook{path: path, runtime: runtime, limits: limits}
+	if err := h.reload(); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// Validate calls the module's "validate" export and rejects the configuration if it returns a message.
+func (h *WasmHook) Validate(configName string, data []byte) error {
+	out, err := h.call("validate", data)
+	if errors.Is(err, ErrWasmExportNotFound) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("wasm hook %v: validate %v: %w", h.path, configName, err)
+	}
+	if len(out) > 0 {
+		return fmt.Errorf("wasm hook %v: config %v rejected: %s", h.path, configName, out)
+	}
+	return nil
+}
+
+// Mutate calls the module's "mutate" export and returns its output as the new configuration.
+func (h *WasmHook) Mutate(configName string, data []byte) ([]byte, error) {
+	out, err := h.call("mutate", data)
+	if errors.Is(err, ErrWasmExportNotFound) {
+		return data, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("wasm hook %v: mutate %v: %w", h.path, configName, err)
+	}
+	return out, nil
+}
+
+// Close releases the instantiated module. Later Validate and Mutate calls fail with ErrWasmHookClosed.
+func (h *WasmHook) Close() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closed = true
+	if h.module == nil {
+		return nil
+	}
+	err := h.module.Close(context.Background())
+	h.module = nil
+	return err
+}
+
+// call reloads the module if it changed on disk or was discarded, and invokes the given export with a timeout,
+// rejecting output larger than the limit.
+// A call still running at the timeout is abandoned, even if the runtime ignores the context, and its module is
+// discarded, as it may still be running; the next call instantiates the module again.
+func (h *WasmHook) call(function string, input []byte) ([]byte, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		return nil, ErrWasmHookClosed
+	}
+	info, err := os.Stat(h.path)
+	if h.module == nil || (err == nil && !info.ModTime().Equal(h.modTime)) {
+		if err := h.reloadLocked(); err != nil {
+			return nil, err
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), h.limits.Timeout)
+	defer cancel()
+	type result struct {
+		out []byte
+		err error
+	}
+	module := h.module
+	done := make(chan result, 1)
+	go func() {
+		out, err := module.Call(ctx, function, input)
+		done <- result{out, err}
+	}()
+	select {
+	case r := <-done:
+		if r.err == nil && len(r.out) > h.limits.MaxOutput {
+			return nil, fmt.Errorf("%v: %w: %d bytes exceed the limit of %d", function, ErrWasmOutputTooLarge, len(r.out), h.limits.MaxOutput)
+		}
+		return r.out, r.err
+	case <-ctx.Done():
+		h.module = nil
+		go func() {
+			<-done
+			module.Close(context.Background())
+		}()
+		return nil, fmt.Errorf("%v timed out after %v", function, h.limits.Timeout)
+	}
+}
+
+// reload re-instantiates the module from disk.
+func (h *WasmHook) reload() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.reloadLocked()
+}
+
+// reloadLocked re-instantiates the module from disk; the caller must hold h.mu.
+func (h *WasmHook) reloadLocked() error {
+	info, err := os.Stat(h.path)
+	if err != nil {
+		return fmt.Errorf("wasm hook %v: %v", h.path, err)
+	}
+	code, err := ioutil.ReadFile(h.path)
+	if err != nil {
+		return fmt.Errorf("wasm hook %v: %v", h.path, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), h.limits.Timeout)
+	defer cancel()
+	module, err := h.runtime.Instantiate(ctx, code, h.limits)
+	if err != nil {
+		return fmt.Errorf("wasm hook %v: error instantiating module: %v", h.path, err)
+	}
+
+	if h.module != nil {
+		h.module.Close(ctx)
+	}
+	h.module = module
+	h.modTime = info.ModTime()
+	return nil
+}
+
+// AddHook appends a validation/mutation hook that is applied every time the configuration is loaded.
+func (c *ConfigSettings) AddHook(hook ConfigHook) *ConfigSettings {
+	c.hooks = append(c.hooks, hook)
+	return c
+}
+
+// applyHooks runs all registered hooks on v in registration order.
+// Validation failures are returned as errors; mutations are decoded back into v.
+func (c *ConfigSettings) applyHooks(v interface{}) error {
+	if len(c.hooks) == 0 {
+		return nil
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("hooks %v: error marshalling config: %v", c.configName, err)
+	}
+
+	for _, hook := range c.hooks {
+		if err := hook.Validate(c.configName, data); err != nil {
+			return err
+		}
+		data, err = hook.Mutate(c.configName, data)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("hooks %v: error unmarshalling mutated config: %v", c.configName, err)
+	}
+	return nil
+}
+
+// AddHook registers a validation/mutation hook for the specified configuration.
+// Returns an error if the configuration is not found.
+func (cm *ConfigManager) AddHook(configName string, hook ConfigHook) error {
+	settings, ok := cm.configList.getSettings(configName)
+	if !ok {
+		return fmt.Errorf("config with name %s not found", configName)
+	}
+	settings.mu.Lock()
+	settings.AddHook(hook)
+	settings.mu.Unlock()
+	return nil
+}
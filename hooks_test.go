@@ -0,0 +1,100 @@
+package mkconf
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// fakeWasmRuntime instantiates fakeWasmModules calling the functions of exports.
+type fakeWasmRuntime struct {
+	exports map[string]func(ctx context.Context, input []byte) ([]byte, error)
+}
+
+func (r *fakeWasmRuntime) Instantiate(ctx context.Context, code []byte, limits WasmLimits) (WasmModule, error) {
+	return &fakeWasmModule{exports: r.exports}, nil
+}
+
+type fakeWasmModule struct {
+	exports map[string]func(ctx context.Context, input []byte) ([]byte, error)
+}
+
+func (m *fakeWasmModule) Call(ctx context.Context, function string, input []byte) ([]byte, error) {
+	export, ok := m.exports[function]
+	if !ok {
+		return nil, fmt.Errorf("%v: %w", function, ErrWasmExportNotFound)
+	}
+	return export(ctx, input)
+}
+
+func (m *fakeWasmModule) Close(ctx context.Context) error {
+	return nil
+}
+
+func newFakeWasmHook(t *testing.T, limits WasmLimits, exports map[string]func(ctx context.Context, input []byte) ([]byte, error)) *WasmHook {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "policy.wasm")
+	if err := os.WriteFile(path, []byte("\x00asm"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	hook, err := NewWasmHook(&fakeWasmRuntime{exports: exports}, path, limits)
+	if err != nil {
+		t.Fatalf("NewWasmHook: %v", err)
+	}
+	t.Cleanup(func() { hook.Close() })
+	return hook
+}
+
+func TestWasmHookSkipsMissingExports(t *testing.T) {
+	hook := newFakeWasmHook(t, WasmLimits{}, nil)
+	if err := hook.Validate("app", []byte(`{}`)); err != nil {
+		t.Fatalf("Validate without export = %v, want nil", err)
+	}
+	if out, err := hook.Mutate("app", []byte(`{"a":1}`)); err != nil || string(out) != `{"a":1}` {
+		t.Fatalf("Mutate without export = %s, %v, want the input unchanged", out, err)
+	}
+}
+
+func TestWasmHookEnforcesTimeout(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	hook := newFakeWasmHook(t, WasmLimits{Timeout: 20 * time.Millisecond}, map[string]func(context.Context, []byte) ([]byte, error){
+		// The export ignores the context, like a runtime not interrupting the module.
+		"validate": func(ctx context.Context, input []byte) ([]byte, error) {
+			<-release
+			return nil, nil
+		},
+	})
+
+	start := time.Now()
+	err := hook.Validate("app", []byte(`{}`))
+	if err == nil {
+		t.Fatal("Validate of a hanging export succeeded")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("Validate returned after %v, want about the timeout", elapsed)
+	}
+}
+
+func TestWasmHookEnforcesOutputLimit(t *testing.T) {
+	hook := newFakeWasmHook(t, WasmLimits{MaxOutput: 16}, map[string]func(context.Context, []byte) ([]byte, error){
+		"mutate": func(ctx context.Context, input []byte) ([]byte, error) {
+			return bytes.Repeat([]byte("x"), 17), nil
+		},
+		"validate": func(ctx context.Context, input []byte) ([]byte, error) {
+			return bytes.Repeat([]byte("x"), 16), nil
+		},
+	})
+
+	if _, err := hook.Mutate("app", []byte(`{}`)); !errors.Is(err, ErrWasmOutputTooLarge) {
+		t.Fatalf("Mutate with oversized output = %v, want %v", err, ErrWasmOutputTooLarge)
+	}
+	if err := hook.Validate("app", []byte(`{}`)); err == nil || errors.Is(err, ErrWasmOutputTooLarge) {
+		t.Fatalf("Validate with output at the limit = %v, want the rejection message", err)
+	}
+}
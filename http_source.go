@@ -0,0 +1,228 @@
+package mkconf
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"sync"
+	"time"
+)
+
+// HTTPOptions configures an HTTP(S) config source.
+type HTTPOptions struct {
+	Interval    time.Duration // Polling interval; 30 seconds if zero
+	Headers     http.Header   // Additional request headers
+	BearerToken string        // Token sent as "Authorization: Bearer", if set
+	Username    string        // User name for basic authentication, if set
+	Password    string        // Password for basic authentication
+	HTTPClient  *http.Client  // Client used for requests; http.DefaultClient if nil
+	Source      SourceOptions // TLS, proxy and token provider settings; a provided token is sent as "Authorization: Bearer"
+}
+
+// HTTPConfigSource is a configuration fetched from an http(s) URL. It is polled on an interval with
+// conditional requests (ETag / If-Modified-Since), so unchanged configurations are not downloaded again.
+// Changes are delivered through the same callbacks and change logs as file changes.
+type HTTPConfigSource struct {
+	url          string             // URL of the configuration
+	configName   string             // Name of the registered configuration
+	options      HTTPOptions        // Source options
+	manager      *ConfigManager     // Manager the configuration is registered with
+	content      []byte             // Last downloaded content
+	loaded       bool               // Flag indicating content holds a value
+	etag         string             // ETag of the last downloaded content
+	lastModified string             // Last-Modified time of the last downloaded content
+	mu           sync.Mutex         // Mutex for synchronizing access to the content
+	cancel       context.CancelFunc // Function canceling the running polling
+	waitGroup    sync.WaitGroup     // WaitGroup to wait for the polling goroutine
+}
+
+// AddHTTPConfig registers a configuration fetched from an http(s) URL. An empty configType is derived
+// from the extension of the URL path (e.g. ".yaml"). The configuration is read-only.
+// Call StartWatching on the returned source to poll the URL for changes.
+func (cm *ConfigManager) AddHTTPConfig(configName, configURL, configType string, configInterface interface{}, options HTTPOptions) (*HTTPConfigSource, error) {
+	parsed, err := url.Parse(configURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+		return nil, fmt.Errorf("http config %v: invalid URL %q", configName, configURL)
+	}
+	if configType == "" {
+		_, configType = splitConfigFileName(path.Base(parsed.Path))
+	}
+	if options.Interval <= 0 {
+		options.Interval = 30 * time.Second
+	}
+	if options.HTTPClient, err = options.Source.httpClient(options.HTTPClient); err != nil {
+		return nil, fmt.Errorf("http config %v: %v", configName, err)
+	}
+
+	s := &HTTPConfigSource{url: configURL, configName: configName, options: options, manager: cm}
+	if err := cm.AddConfigFS(s, configName, "", configType, configInterface); err != nil {
+		return nil, err
+	}
+	cm.addRemoteSource(configName, s)
+	return s, nil
+}
+
+// Open implements fs.FS. Every name resolves to the downloaded content; it is fetched if it was not yet.
+func (s *HTTPConfigSource) Open(name string) (fs.File, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.loaded {
+		if _, err := s.fetchLocked(context.Background()); err != nil {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+		}
+	}
+	return newRemoteFile(name, s.content), nil
+}
+
+// Refresh fetches the URL and loads the configuration from it.
+// It is not needed while the source is watched.
+func (s *HTTPConfigSource) Refresh() error {
+	s.mu.Lock()
+	_, err := s.fetchLocked(context.Background())
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return s.manager.LoadConfig(s.configName)
+}
+
+// StartWatching polls the URL every interval and applies changed content.
+// Errors are reported through errorFunc if it is set.
+func (s *HTTPConfigSource) StartWatching(errorFunc func(err error)) error {
+	s.StopWatching()
+	errorFunc = quietCircuitErrors(errorFunc)
+	if err := s.manager.setRemoteWatching(s.configName, true); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.mu.Lock()
+	s.cancel = cancel
+	s.mu.Unlock()
+
+	s.waitGroup.Add(1)
+	s.manager.configList.resources.acquire(s.configName, resourceRemoteWatch)
+	go func() {
+		defer s.waitGroup.Done()
+		defer s.manager.configList.resources.release(s.configName, resourceRemoteWatch)
+		ticker := time.NewTicker(s.options.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			s.mu.Lock()
+			changed, err := s.fetchLocked(ctx)
+			s.mu.Unlock()
+			if err == nil && changed {
+				err = s.manager.applyRemoteChange(s.configName)
+			}
+			if err != nil && ctx.Err() == nil && errorFunc != nil {
+				errorFunc(err)
+			}
+		}
+	}()
+	return nil
+}
+
+// StopWatching stops polling the URL and waits for the polling to finish.
+func (s *HTTPConfigSource) StopWatching() {
+	s.mu.Lock()
+	cancel := s.cancel
+	s.cancel = nil
+	s.mu.Unlock()
+
+	if cancel == nil {
+		return
+	}
+	cancel()
+	s.waitGroup.Wait()
+	s.manager.setRemoteWatching(s.configName, false)
+}
+
+// fetchLocked calls fetchOnceLocked according to the retry policy and circuit breaker of the configuration.
+// The caller must hold s.mu.
+func (s *HTTPConfigSource) fetchLocked(ctx context.Context) (bool, error) {
+	var changed bool
+	err := s.manager.retryFetch(ctx, s.configName, func() error {
+		var err error
+		changed, err = s.fetchOnceLocked(ctx)
+		return err
+	})
+	return changed, err
+}
+
+// fetchOnceLocked downloads the URL unless it is unchanged according to the server and reports whether the
+// content changed. The caller must hold s.mu.
+func (s *HTTPConfigSource) fetchOnceLocked(ctx context.Context) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.url, nil)
+	if err != nil {
+		return false, err
+	}
+	if err := s.options.setHeaders(req); err != nil {
+		return false, fmt.Errorf("http config %v: %v", s.configName, err)
+	}
+	if s.loaded {
+		if s.etag != "" {
+			req.Header.Set("If-None-Match", s.etag)
+		}
+		if s.lastModified != "" {
+			req.Header.Set("If-Modified-Since", s.lastModified)
+		}
+	}
+
+	resp, err := s.options.HTTPClient.Do(req)
+	if err != nil {
+		return false, fmt.Errorf("http config %v: %v", s.configName, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified && s.loaded {
+		s.manager.sourceReached(s.configName)
+		return false, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		message, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return false, fmt.Errorf("http config %v: unexpected status %v: %s", s.configName, resp.Status, bytes.TrimSpace(message))
+	}
+	content, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return false, fmt.Errorf("http config %v: %v", s.configName, err)
+	}
+
+	changed := !s.loaded || !bytes.Equal(s.content, content)
+	s.content, s.loaded = content, true
+	s.etag = resp.Header.Get("ETag")
+	s.lastModified = resp.Header.Get("Last-Modified")
+	s.manager.sourceReached(s.configName)
+	return changed, nil
+}
+
+// setHeaders adds the additional headers and the credentials of the options to req.
+func (o HTTPOptions) setHeaders(req *http.Request) error {
+	for name, values := range o.Headers {
+		for _, value := range values {
+			req.Header.Add(name, value)
+		}
+	}
+	token, err := o.Source.token(req.Context(), o.BearerToken)
+	if err != nil {
+		return err
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	} else if o.Username != "" {
+		req.SetBasicAuth(o.Username, o.Password)
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package mkconf
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// ChangeImpact is a consequence of changing a configuration value, registered with SetImpact.
+type ChangeImpact struct {
+	Key         string // Dot-separated key path the impact was registered for, e.g. "db.dsn"
+	Description string // Consequence of changing the value, e.g. "reconnects all pools"
+}
+
+// SetImpact registers the consequence of changing the value at a dot-separated key path of a configuration, e.g.
+//
+//	cm.SetImpact("app", "db.dsn", "reconnects all database pools")
+//
+// The impact applies to changes of the value and of everything below it. It is attached to the tracked changes
+// affecting the value (ConfigChangeLog.Impacts), so notifications and the history show it, and listed ahead of the
+// diffs of Diff, the control server and EditConfig, so operators see the consequences before approving or writing
+// a change. An empty description removes the impact.
+func (cm *ConfigManager) SetImpact(configName, key, description string) error {
+	if _, ok := cm.configList.getSettings(configName); !ok {
+		return fmt.Errorf("config with name %s not found", configName)
+	}
+	if key == "" {
+		return fmt.Errorf("config %v: empty impact key", configName)
+	}
+
+	c := cm.configList
+	c.logMutex.Lock()
+	defer c.logMutex.Unlock()
+	if description == "" {
+		delete(c.impacts[configName], key)
+		return nil
+	}
+	if c.impacts == nil {
+		c.impacts = make(map[string]map[string]string)
+	}
+	if c.impacts[configName] == nil {
+		c.impacts[configName] = make(map[string]string)
+	}
+	c.impacts[configName][key] = description
+	return nil
+}
+
+// annotateImpacts returns a copy of the changes of a configuration with their registered impacts attached.
+// The caller must hold c.logMutex.
+func (c *ConfigList) annotateImpacts(configName string, changes []ConfigChangeLog) []ConfigChangeLog {
+	impacts := c.impacts[configName]
+	if len(impacts) == 0 || len(changes) == 0 {
+		return changes
+	}
+	annotated := append([]ConfigChangeLog(nil), changes...)
+	for i := range annotated {
+		annotated[i].Impacts = changeImpacts(impacts, annotated[i])
+	}
+	return annotated
+}
+
+// previewImpacts returns the registered impacts of the changes between two contents of a configuration file,
+// or nil if the contents cannot be decoded into generic values.
+func (c *ConfigList) previewImpacts(configName, path string, oldContent, newContent []byte) []ChangeImpact {
+	c.logMutex.Lock()
+	impacts := c.impacts[configName]
+	c.logMutex.Unlock()
+	if len(impacts) == 0 {
+		return nil
+	}
+
+	configReader, err := fileStreamReader(path)
+	if err != nil {
+		return nil
+	}
+	oldValues, err := decodeValues(configReader, oldContent)
+	if err != nil {
+		return nil
+	}
+	newValues, err := decodeValues(configReader, newContent)
+	if err != nil {
+		return nil
+	}
+	var changes []ConfigChangeLog
+	compareFields(configName, oldValues, newValues, &changes)
+
+	c.logMutex.Lock()
+	defer c.logMutex.Unlock()
+	seen := make(map[string]bool)
+	var result []ChangeImpact
+	for _, change := range changes {
+		for _, impact := range changeImpacts(c.impacts[configName], change) {
+			if !seen[impact.Key] {
+				seen[impact.Key] = true
+				result = append(result, impact)
+			}
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Key < result[j].Key })
+	return result
+}
+
+// changeImpacts returns the impacts affected by a change, ordered by key, see changeAffects.
+func changeImpacts(impacts map[string]string, change ConfigChangeLog) []ChangeImpact {
+	var result []ChangeImpact
+	for key, description := range impacts {
+		if changeAffects(change, key) {
+			result = append(result, ChangeImpact{Key: key, Description: description})
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Key < result[j].Key })
+	return result
+}
+
+// changeAffects reports whether a change affects the value at a dot-separated key path: the change is at or below
+// the key, or above it and the value at the key differs between the old and the new value. Keys match ignoring case.
+func changeAffects(change ConfigChangeLog, key string) bool {
+	field := strings.ToLower(change.FieldName)
+	lowerKey := strings.ToLower(key)
+	switch {
+	case field == lowerKey || strings.HasPrefix(field, lowerKey+"."):
+		return true
+	case strings.HasPrefix(lowerKey, field+"."):
+		path := strings.Split(lowerKey[len(field)+1:], ".")
+		// Values decoded from YAML hold maps with interface{} keys.
+		oldValue, oldOK := historyValue(jsonCompatible(change.OldValue), path)
+		newValue, newOK := historyValue(jsonCompatible(change.NewValue), path)
+		return oldOK != newOK || !reflect.DeepEqual(oldValue, newValue)
+	}
+	return false
+}
+
+// impactNotes formats impacts as lines prefixed with "!", to be shown ahead of a diff.
+func impactNotes(impacts []ChangeImpact) string {
+	var b strings.Builder
+	for _, impact := range impacts {
+		fmt.Fprintf(&b, "! %v: %v\n", impact.Key, impact.Description)
+	}
+	return b.String()
+}
@@ -0,0 +1,183 @@
+package mkconf
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// includeKeys are the keys of include directives.
+var includeKeys = []string{"$include", "include"}
+
+// SetIncludes enables or disables include directives for configurations added afterwards with AddConfig. When
+// enabled, a map of a configuration file with an "include" or "$include" key pulls in the files it names:
+//
+//	include: [base.yaml, "conf.d/*.yaml"]
+//	db:
+//	  $include: db.json
+//
+// A directive is a path or a list of paths, relative to the file containing it, and paths may be globs, whose
+// matches are included in lexical order. Included files may be of any format with a stream reader and include
+// further files; a file including itself, directly or not, fails the load. The values of the included files are
+// merged in the order named, and the other keys of the map containing the directive take precedence over them.
+// Change monitoring covers the whole include graph, so a change to any included file, or a new file matching a
+// glob, reloads the configuration, and DumpTree marks included values with their file, e.g. [from file db.json].
+// Files with include directives cannot be written by UpdateConfig and Set, which would flatten them. Only config
+// types with stream readers and writers (JSON, YAML, TOML, Plist and XML) support includes.
+func (cm *ConfigManager) SetIncludes(enabled bool) {
+	cm.configList.settingsMutex.Lock()
+	defer cm.configList.settingsMutex.Unlock()
+	cm.configList.includes = enabled
+}
+
+// resolveIncludes replaces the include directives in values, decoded from the file at path and found at the
+// dot-separated prefix, by the values of the files they name, recording their origins. stack holds the files
+// being resolved, for detecting cycles. It reports whether values held any directive.
+func resolveIncludes(values map[string]interface{}, path, prefix string, stack []string, origins map[string]string) (bool, error) {
+	var patterns []string
+	found := false
+	for _, key := range includeKeys {
+		directive, ok := values[key]
+		if !ok {
+			continue
+		}
+		found = true
+		delete(values, key)
+		switch directive := directive.(type) {
+		case string:
+			patterns = append(patterns, directive)
+		case []interface{}:
+			for _, element := range directive {
+				pattern, ok := element.(string)
+				if !ok {
+					return false, fmt.Errorf("%v: %v: expected a path, got %v", path, joinPath(prefix, key), element)
+				}
+				patterns = append(patterns, pattern)
+			}
+		default:
+			return false, fmt.Errorf("%v: %v: expected a path or a list of paths, got %v", path, joinPath(prefix, key), directive)
+		}
+	}
+
+	if found {
+		merged := make(map[string]interface{})
+		for _, pattern := range patterns {
+			files, err := includeFiles(filepath.Dir(path), pattern)
+			if err != nil {
+				return false, fmt.Errorf("%v: %v", path, err)
+			}
+			for _, file := range files {
+				included, err := includeFile(file, prefix, stack, origins)
+				if err != nil {
+					return false, err
+				}
+				mergeValues(merged, included)
+			}
+		}
+
+		// The keys next to the directive take precedence over the included values.
+		own := make(map[string]string)
+		collectOrigins(values, originPrefix(prefix), "", own)
+		for ownPath := range own {
+			delete(origins, ownPath)
+		}
+		mergeValues(merged, values)
+		for key := range values {
+			delete(values, key)
+		}
+		for key, value := range merged {
+			values[key] = value
+		}
+	}
+
+	for key, value := range values {
+		if nested, ok := value.(map[string]interface{}); ok {
+			nestedFound, err := resolveIncludes(nested, path, joinPath(prefix, key), stack, origins)
+			if err != nil {
+				return false, err
+			}
+			found = found || nestedFound
+		}
+	}
+	return found, nil
+}
+
+// includeFiles returns the files named by an include pattern relative to dir. Globs may match no file; other
+// patterns must name an existing file.
+func includeFiles(dir, pattern string) ([]string, error) {
+	if !filepath.IsAbs(pattern) {
+		pattern = filepath.Join(dir, pattern)
+	}
+	if !strings.ContainsAny(pattern, "*?[") {
+		return []string{pattern}, nil
+	}
+	files, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("include %v: %v", pattern, err)
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// includeFile returns the values of an included file, with its own include directives resolved, and records their
+// origins below prefix.
+func includeFile(file, prefix string, stack []string, origins map[string]string) (map[string]interface{}, error) {
+	file = filepath.Clean(file)
+	for i, including := range stack {
+		if including == file {
+			return nil, fmt.Errorf("include cycle: %v", strings.Join(append(append([]string(nil), stack[i:]...), file), " -> "))
+		}
+	}
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("include: %v", err)
+	}
+	configReader, err := fileStreamReader(file)
+	if err != nil {
+		return nil, fmt.Errorf("include %v: %v", file, err)
+	}
+	values, err := decodeValues(configReader, content)
+	if err != nil {
+		return nil, fmt.Errorf("include %v: %v", file, err)
+	}
+
+	// Values of files included by this one keep their own origins.
+	nested := make(map[string]string)
+	if _, err := resolveIncludes(values, file, prefix, append(stack, file), nested); err != nil {
+		return nil, err
+	}
+	own := make(map[string]string)
+	collectOrigins(values, originPrefix(prefix), "file "+filepath.Base(file), own)
+	for path, origin := range nested {
+		own[path] = origin
+	}
+	for path, origin := range own {
+		origins[path] = origin
+	}
+	return values, nil
+}
+
+// originPrefix returns the prefix of the origin paths of the values at the dot-separated path prefix.
+func originPrefix(prefix string) string {
+	if prefix == "" {
+		return ""
+	}
+	return prefix + "."
+}
+
+// hasIncludes reports whether the decoded values hold an include directive.
+func hasIncludes(values map[string]interface{}) bool {
+	for key, value := range values {
+		for _, includeKey := range includeKeys {
+			if key == includeKey {
+				return true
+			}
+		}
+		if nested, ok := value.(map[string]interface{}); ok && hasIncludes(nested) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,42 @@
+package mkconf
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// jitterRand returns the random fractions of the poll jitter; tests replace it.
+var jitterRand = rand.Float64
+
+// SetPollJitter randomizes the interval between the checks of polled configurations by the fraction jitter, from
+// 0 (none, the default) to 1: each interval is shortened by a random part of up to jitter of its length, so a
+// configuration is never checked later than its interval. The first check after a monitor starts is delayed by such
+// a random part too, so monitors started together with the same check interval spread their reads over the
+// interval from the start instead of hitting the disk at the same instant. It applies to monitors polling the file,
+// including the watcher pool, started or not; the first check is only delayed for monitors started after the call.
+func (cm *ConfigManager) SetPollJitter(jitter float64) error {
+	if jitter < 0 || jitter > 1 {
+		return fmt.Errorf("poll jitter %v out of range 0 to 1", jitter)
+	}
+	cm.configList.settingsMutex.Lock()
+	defer cm.configList.settingsMutex.Unlock()
+	cm.configList.pollJitter = jitter
+	return nil
+}
+
+// jitter returns interval shortened by a random part of up to the poll jitter.
+func (c *ConfigList) jitter(interval time.Duration) time.Duration {
+	c.settingsMutex.Lock()
+	jitter := c.pollJitter
+	c.settingsMutex.Unlock()
+	return interval - jitterPart(jitter, interval)
+}
+
+// jitterPart returns a random part of up to jitter of interval.
+func jitterPart(jitter float64, interval time.Duration) time.Duration {
+	if jitter <= 0 {
+		return 0
+	}
+	return time.Duration(jitterRand() * jitter * float64(interval))
+}
@@ -0,0 +1,62 @@
+package mkconf
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestPollJitterDelaysFirstCheck(t *testing.T) {
+	jitterRand = func() float64 { return 0.5 }
+	t.Cleanup(func() { jitterRand = rand.Float64 })
+
+	for _, pool := range []bool{false, true} {
+		name := "goroutine"
+		if pool {
+			name = "pool"
+		}
+		t.Run(name, func(t *testing.T) {
+			calls := make(chan string, 1)
+			cm, dir := newStressManager(t, func(configName string) { calls <- configName })
+			// The change callback runs on the monitoring goroutine, so no watcher is needed.
+			if err := cm.SetCallbackMode("stress", CallbackSync); err != nil {
+				t.Fatalf("SetCallbackMode: %v", err)
+			}
+			if pool {
+				if err := cm.SetWatcherPool(2); err != nil {
+					t.Fatalf("SetWatcherPool: %v", err)
+				}
+			}
+			if err := cm.SetPollJitter(1); err != nil {
+				t.Fatalf("SetPollJitter: %v", err)
+			}
+			// The first check is due after half of the interval of 400ms.
+			if err := cm.SetAdaptivePolling("stress", 400*time.Millisecond, time.Second); err != nil {
+				t.Fatalf("SetAdaptivePolling: %v", err)
+			}
+			writeStressConfig(t, dir, 1)
+			v, _ := cm.GetConfig("stress")
+			started := time.Now()
+			if err := cm.StartChangeMonitoring("stress", v); err != nil {
+				t.Fatalf("StartChangeMonitoring: %v", err)
+			}
+			defer cm.StopChangeMonitoring("stress")
+
+			waitForCall(t, calls)
+			if elapsed := time.Since(started); elapsed < 200*time.Millisecond {
+				t.Fatalf("first check after %v, want it delayed by the jitter of 200ms", elapsed)
+			}
+		})
+	}
+}
+
+func TestJitterPart(t *testing.T) {
+	if part := jitterPart(0, time.Second); part != 0 {
+		t.Fatalf("jitterPart without jitter = %v, want 0", part)
+	}
+	for i := 0; i < 100; i++ {
+		if part := jitterPart(0.25, time.Second); part < 0 || part >= 250*time.Millisecond {
+			t.Fatalf("jitterPart(0.25, 1s) = %v, want [0, 250ms)", part)
+		}
+	}
+}
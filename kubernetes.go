@@ -0,0 +1,496 @@
+package mkconf
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	reader "mkconf/readers"
+)
+
+// serviceAccountDir is where Kubernetes mounts the credentials of the pod's service account.
+const serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// KubernetesOptions configures a Kubernetes config source. Empty fields default to the in-cluster configuration
+// of the pod's service account.
+type KubernetesOptions struct {
+	APIServer  string        // URL of the API server; https://$KUBERNETES_SERVICE_HOST:$KUBERNETES_SERVICE_PORT if empty
+	Token      string        // Bearer token; the service account token (re-read on every request) if empty
+	CAFile     string        // CA certificate of the API server; the service account CA if empty
+	Namespace  string        // Namespace of the object; the service account namespace if empty
+	HTTPClient *http.Client  // Client used for requests; a client without timeout is required for watching. Built from CAFile if nil
+	Source     SourceOptions // TLS, proxy and token provider settings; a provided token replaces the service account token
+}
+
+// KubernetesConfigSource is a configuration stored in a Kubernetes object: a key of a ConfigMap or Secret, or the
+// spec of a custom resource. It is synced through the API server like an informer (list, then watch from the listed
+// resource version, relisting when the version expired) instead of through a mounted volume, so changes are
+// applied within moments and delivered through the same callbacks and change logs as file changes.
+type KubernetesConfigSource struct {
+	collection      string                                              // API path of the collection holding the object
+	objectName      string                                              // Name of the object
+	extract         func(object map[string]interface{}) ([]byte, error) // Function extracting the configuration from the object
+	patch           func(data []byte) interface{}                       // Function building a merge patch writing data, nil if read-only
+	onUpdate        func(content []byte)                                // Function called with every configuration read from the object, if set
+	configName      string                                              // Name of the registered configuration
+	options         KubernetesOptions                                   // Source options
+	tokenFile       string                                              // File the bearer token is read from, if options.Token is empty
+	manager         *ConfigManager                                      // Manager the configuration is registered with
+	content         []byte                                              // Last configuration read from the object
+	loaded          bool                                                // Flag indicating content holds a value
+	resourceVersion string                                              // Resource version the content was read at
+	mu              sync.Mutex                                          // Mutex for synchronizing access to the content
+	cancel          context.CancelFunc                                  // Function canceling the running watch
+	waitGroup       sync.WaitGroup                                      // WaitGroup to wait for the watch goroutine
+}
+
+// AddConfigMapConfig registers a configuration stored under key in a ConfigMap. An empty configType is derived
+// from the extension of the key (e.g. "app.yaml"). UpdateConfig patches the key of the ConfigMap.
+// Call StartWatching on the returned source to apply changes as soon as the API server reports them.
+func (cm *ConfigManager) AddConfigMapConfig(configName, configMap, key, configType string, configInterface interface{}, options KubernetesOptions) (*KubernetesConfigSource, error) {
+	if configType == "" {
+		_, configType = splitConfigFileName(key)
+	}
+	s, err := newKubernetesSource(configName, options)
+	if err != nil {
+		return nil, err
+	}
+	s.collection = "/api/v1/namespaces/" + url.PathEscape(s.options.Namespace) + "/configmaps"
+	s.objectName = configMap
+	s.extract = func(object map[string]interface{}) ([]byte, error) {
+		if data, ok := object["data"].(map[string]interface{}); ok {
+			if value, ok := data[key].(string); ok {
+				return []byte(value), nil
+			}
+		}
+		if data, ok := object["binaryData"].(map[string]interface{}); ok {
+			if value, ok := data[key].(string); ok {
+				return base64.StdEncoding.DecodeString(value)
+			}
+		}
+		return nil, fmt.Errorf("configmap %v has no key %v", configMap, key)
+	}
+	s.patch = func(data []byte) interface{} {
+		return map[string]interface{}{"data": map[string]string{key: string(data)}}
+	}
+	if err := cm.addKubernetesSource(s, s, configType, configInterface); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// kubernetesSecretSource is the file system of a configuration stored in a Secret. All of its values are
+// recorded as secrets, so they are redacted from change logs and quarantine reports.
+type kubernetesSecretSource struct {
+	*KubernetesConfigSource
+	secretRedaction
+}
+
+// AddSecretConfig registers a configuration stored under key in a Secret, like AddConfigMapConfig. The data of the
+// key is base64-decoded, and every value of the configuration is redacted from change logs and quarantine reports.
+// UpdateConfig patches the key of the Secret.
+func (cm *ConfigManager) AddSecretConfig(configName, secret, key, configType string, configInterface interface{}, options KubernetesOptions) (*KubernetesConfigSource, error) {
+	if configType == "" {
+		_, configType = splitConfigFileName(key)
+	}
+	configReader := (&ConfigSettings{configType: configType}).checkReader()
+	if _, ok := configReader.(reader.StreamReader); !ok {
+		return nil, fmt.Errorf("kubernetes config %v: secrets are not supported for config type %v", configName, configType)
+	}
+	s, err := newKubernetesSource(configName, options)
+	if err != nil {
+		return nil, err
+	}
+	s.collection = "/api/v1/namespaces/" + url.PathEscape(s.options.Namespace) + "/secrets"
+	s.objectName = secret
+	s.extract = func(object map[string]interface{}) ([]byte, error) {
+		if data, ok := object["data"].(map[string]interface{}); ok {
+			if value, ok := data[key].(string); ok {
+				return base64.StdEncoding.DecodeString(value)
+			}
+		}
+		return nil, fmt.Errorf("secret %v has no key %v", secret, key)
+	}
+	s.patch = func(data []byte) interface{} {
+		return map[string]interface{}{"data": map[string]string{key: base64.StdEncoding.EncodeToString(data)}}
+	}
+	fsys := &kubernetesSecretSource{KubernetesConfigSource: s}
+	s.onUpdate = func(content []byte) {
+		if values, err := decodeValues(configReader, content); err == nil {
+			fsys.recordSecrets(values)
+		}
+	}
+	if err := cm.addKubernetesSource(fsys, s, configType, configInterface); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// AddCustomResourceConfig registers a configuration stored in the spec of a namespaced custom resource, identified
+// by its API version (e.g. "example.com/v1"), resource plural (e.g. "appconfigs") and object name. The spec is
+// decoded as JSON. The configuration is read-only. Call StartWatching on the returned source to apply changes
+// as soon as the API server reports them.
+func (cm *ConfigManager) AddCustomResourceConfig(configName, apiVersion, resource, objectName string, configInterface interface{}, options KubernetesOptions) (*KubernetesConfigSource, error) {
+	s, err := newKubernetesSource(configName, options)
+	if err != nil {
+		return nil, err
+	}
+	s.collection = "/apis/" + apiVersion + "/namespaces/" + url.PathEscape(s.options.Namespace) + "/" + resource
+	s.objectName = objectName
+	s.extract = func(object map[string]interface{}) ([]byte, error) {
+		spec, ok := object["spec"]
+		if !ok {
+			return nil, fmt.Errorf("%v %v has no spec", resource, objectName)
+		}
+		return json.Marshal(spec)
+	}
+	if err := cm.addKubernetesSource(s, s, ".json", configInterface); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// newKubernetesSource returns a source with the in-cluster defaults applied to options.
+func newKubernetesSource(configName string, options KubernetesOptions) (*KubernetesConfigSource, error) {
+	s := &KubernetesConfigSource{configName: configName}
+	if options.APIServer == "" {
+		host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+		if host == "" || port == "" {
+			return nil, fmt.Errorf("kubernetes config %v: API server is not set and not running in a cluster", configName)
+		}
+		options.APIServer = "https://" + net.JoinHostPort(host, port)
+	}
+	if options.Token == "" {
+		s.tokenFile = path.Join(serviceAccountDir, "token")
+	}
+	if options.Namespace == "" {
+		namespace, err := ioutil.ReadFile(path.Join(serviceAccountDir, "namespace"))
+		if err != nil {
+			return nil, fmt.Errorf("kubernetes config %v: namespace is not set: %v", configName, err)
+		}
+		options.Namespace = strings.TrimSpace(string(namespace))
+	}
+	if options.HTTPClient == nil {
+		if options.CAFile == "" {
+			options.CAFile = path.Join(serviceAccountDir, "ca.crt")
+		}
+		client, err := kubernetesClient(options.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("kubernetes config %v: %v", configName, err)
+		}
+		options.HTTPClient = client
+	}
+	client, err := options.Source.httpClient(options.HTTPClient)
+	if err != nil {
+		return nil, fmt.Errorf("kubernetes config %v: %v", configName, err)
+	}
+	options.HTTPClient = client
+	s.options = options
+	return s, nil
+}
+
+// kubernetesClient returns a client trusting the CA certificate in caFile, or the system roots if it does not exist.
+func kubernetesClient(caFile string) (*http.Client, error) {
+	ca, err := ioutil.ReadFile(caFile)
+	if os.IsNotExist(err) {
+		return &http.Client{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(ca) {
+		return nil, fmt.Errorf("no certificates in %v", caFile)
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{RootCAs: roots}
+	return &http.Client{Transport: transport}, nil
+}
+
+// addKubernetesSource registers the source with the manager, reading the configuration through fsys.
+func (cm *ConfigManager) addKubernetesSource(fsys fs.FS, s *KubernetesConfigSource, configType string, configInterface interface{}) error {
+	s.manager = cm
+	if err := cm.AddConfigFS(fsys, s.configName, "", configType, configInterface); err != nil {
+		return err
+	}
+	cm.addRemoteSource(s.configName, s)
+	return nil
+}
+
+// Open implements fs.FS. Every name resolves to the configuration in the object; it is fetched if it was not yet.
+func (s *KubernetesConfigSource) Open(name string) (fs.File, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.loaded {
+		if _, err := s.fetchLocked(context.Background()); err != nil {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+		}
+	}
+	return newRemoteFile(name, s.content), nil
+}
+
+// WriteFile implements reader.WriteFileFS by patching the object. Sources without a writable field are read-only.
+func (s *KubernetesConfigSource) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	if s.patch == nil {
+		return fmt.Errorf("kubernetes config %v: %w", s.configName, ErrReadOnlySource)
+	}
+	body, err := json.Marshal(s.patch(data))
+	if err != nil {
+		return err
+	}
+	resp, err := s.do(context.Background(), http.MethodPatch, s.collection+"/"+url.PathEscape(s.objectName), body)
+	if err != nil {
+		return fmt.Errorf("kubernetes config %v: %v", s.configName, err)
+	}
+	defer resp.Body.Close()
+	var object map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&object); err != nil {
+		return fmt.Errorf("kubernetes config %v: %v", s.configName, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.updateLocked(object)
+	return err
+}
+
+// Refresh re-reads the object and loads the configuration from it.
+// It is not needed while the source is watched.
+func (s *KubernetesConfigSource) Refresh() error {
+	s.mu.Lock()
+	_, err := s.fetchLocked(context.Background())
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return s.manager.LoadConfig(s.configName)
+}
+
+// StartWatching watches the object and applies every change as soon as the API server reports it.
+// A broken watch is re-established from the last seen resource version; if that version expired, the object
+// is listed again. Errors are reported through errorFunc if it is set.
+func (s *KubernetesConfigSource) StartWatching(errorFunc func(err error)) error {
+	s.StopWatching()
+	errorFunc = quietCircuitErrors(errorFunc)
+	if err := s.manager.setRemoteWatching(s.configName, true); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.mu.Lock()
+	s.cancel = cancel
+	s.mu.Unlock()
+
+	s.waitGroup.Add(1)
+	s.manager.configList.resources.acquire(s.configName, resourceRemoteWatch)
+	go func() {
+		defer s.waitGroup.Done()
+		defer s.manager.configList.resources.release(s.configName, resourceRemoteWatch)
+		for {
+			err := s.watch(ctx)
+			if ctx.Err() != nil {
+				return
+			}
+			if err != nil && errorFunc != nil {
+				errorFunc(fmt.Errorf("kubernetes watch %v: %w", s.configName, err))
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(time.Second):
+			}
+		}
+	}()
+	return nil
+}
+
+// StopWatching stops watching the object and waits for the watch to finish.
+func (s *KubernetesConfigSource) StopWatching() {
+	s.mu.Lock()
+	cancel := s.cancel
+	s.cancel = nil
+	s.mu.Unlock()
+
+	if cancel == nil {
+		return
+	}
+	cancel()
+	s.waitGroup.Wait()
+
+	s.manager.setRemoteWatching(s.configName, false)
+}
+
+// watch runs a single watch stream until it fails, the server closes it or ctx is canceled.
+func (s *KubernetesConfigSource) watch(ctx context.Context) error {
+	s.mu.Lock()
+	relisted := false
+	if s.resourceVersion == "" {
+		changed, err := s.fetchLocked(ctx)
+		if err != nil {
+			s.mu.Unlock()
+			return err
+		}
+		relisted = changed
+	}
+	query := url.Values{
+		"watch":               {"true"},
+		"allowWatchBookmarks": {"true"},
+		"fieldSelector":       {"metadata.name=" + s.objectName},
+		"resourceVersion":     {s.resourceVersion},
+	}
+	s.mu.Unlock()
+	if relisted {
+		if err := s.manager.applyRemoteChange(s.configName); err != nil {
+			return err
+		}
+	}
+
+	resp, err := s.do(ctx, http.MethodGet, s.collection+"?"+query.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var event struct {
+			Type   string                 `json:"type"`
+			Object map[string]interface{} `json:"object"`
+		}
+		if err := decoder.Decode(&event); err != nil {
+			if err == io.EOF {
+				// Watches time out on the server side; the next watch resumes from the last version.
+				return nil
+			}
+			return err
+		}
+
+		changed := false
+		s.mu.Lock()
+		switch event.Type {
+		case "ADDED", "MODIFIED":
+			changed, err = s.updateLocked(event.Object)
+		case "DELETED", "BOOKMARK":
+			// A deleted object keeps the last value, like a file that disappeared.
+			s.resourceVersion = kubernetesResourceVersion(event.Object)
+		case "ERROR":
+			// The resource version expired (410 Gone); list the object again before the next watch.
+			s.resourceVersion = ""
+			err = fmt.Errorf("%v", event.Object["message"])
+		}
+		s.mu.Unlock()
+		if err != nil {
+			return err
+		}
+
+		if changed {
+			if err := s.manager.applyRemoteChange(s.configName); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// fetchLocked calls fetchOnceLocked according to the retry policy and circuit breaker of the configuration.
+// The caller must hold s.mu.
+func (s *KubernetesConfigSource) fetchLocked(ctx context.Context) (bool, error) {
+	var changed bool
+	err := s.manager.retryFetch(ctx, s.configName, func() error {
+		var err error
+		changed, err = s.fetchOnceLocked(ctx)
+		return err
+	})
+	return changed, err
+}
+
+// fetchOnceLocked reads the object and reports whether the configuration changed. The caller must hold s.mu.
+func (s *KubernetesConfigSource) fetchOnceLocked(ctx context.Context) (bool, error) {
+	resp, err := s.do(ctx, http.MethodGet, s.collection+"/"+url.PathEscape(s.objectName), nil)
+	if err != nil {
+		return false, fmt.Errorf("kubernetes config %v: %v", s.configName, err)
+	}
+	defer resp.Body.Close()
+	var object map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&object); err != nil {
+		return false, fmt.Errorf("kubernetes config %v: %v", s.configName, err)
+	}
+	s.manager.sourceReached(s.configName)
+	return s.updateLocked(object)
+}
+
+// updateLocked stores the configuration of the object and reports whether it changed. The caller must hold s.mu.
+func (s *KubernetesConfigSource) updateLocked(object map[string]interface{}) (bool, error) {
+	content, err := s.extract(object)
+	if err != nil {
+		return false, err
+	}
+	if s.onUpdate != nil {
+		s.onUpdate(content)
+	}
+	changed := !s.loaded || !bytes.Equal(s.content, content)
+	s.content, s.loaded = content, true
+	s.resourceVersion = kubernetesResourceVersion(object)
+	return changed, nil
+}
+
+// do sends a request to the API server and returns the response of a successful request.
+// The caller must close the body.
+func (s *KubernetesConfigSource) do(ctx context.Context, method, apiPath string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(s.options.APIServer, "/")+apiPath, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if method == http.MethodPatch {
+		req.Header.Set("Content-Type", "application/merge-patch+json")
+	}
+	token := s.options.Token
+	if s.tokenFile != "" && s.options.Source.TokenFunc == nil {
+		// Service account tokens are rotated, so the file is read on every request.
+		content, err := ioutil.ReadFile(s.tokenFile)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		token = strings.TrimSpace(string(content))
+	}
+	if token, err = s.options.Source.token(req.Context(), token); err != nil {
+		return nil, err
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := s.options.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		message, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		resp.Body.Close()
+		return nil, fmt.Errorf("%v %v: unexpected status %v: %s", method, req.URL.Path, resp.Status, bytes.TrimSpace(message))
+	}
+	return resp, nil
+}
+
+// kubernetesResourceVersion returns metadata.resourceVersion of an object.
+func kubernetesResourceVersion(object map[string]interface{}) string {
+	metadata, _ := object["metadata"].(map[string]interface{})
+	version, _ := metadata["resourceVersion"].(string)
+	return version
+}
@@ -0,0 +1,172 @@
+package mkconf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ErrDegraded is wrapped by the warnings reported through the function set with SetErrorFunc when a configuration
+// falls back to its last-known-good snapshot or to default values; IsDegraded and Status report the state.
+var ErrDegraded = errors.New("config degraded")
+
+// SetStateDir sets a directory where the last successfully validated content of every configuration is persisted.
+// If a configuration file is missing or broken at startup, it is loaded from this last-known-good snapshot instead
+// and the configuration is reported as degraded until a valid file is applied: IsDegraded and Status report it, and
+// an error wrapping ErrDegraded is passed to the function set with SetErrorFunc, like errors persisting snapshots.
+func (cm *ConfigManager) SetStateDir(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("state dir: %v", err)
+	}
+
+	cm.configList.settingsMutex.Lock()
+	cm.configList.stateDir = dir
+	cm.configList.settingsMutex.Unlock()
+
+	for _, settings := range cm.configList.settingsSnapshot() {
+		settings.mu.Lock()
+		settings.lastGoodPath = filepath.Join(dir, settings.configName+settings.configType)
+		settings.mu.Unlock()
+	}
+	return nil
+}
+
+// SetRemoteCache sets a directory where the last successfully fetched payload of every remote source (HTTP,
+// Redis, NATS, SQL and the other sources with StartWatching) is cached, taking precedence over the state directory
+// for these configurations. If the remote is down when the configuration is added or loaded, the cached payload is
+// served and the configuration is reported as degraded, like a last-known-good snapshot. A payload older than ttl is
+// still served, as stale values beat none, but IsStale and ConfigStatus.Stale report it; ttl 0 never reports
+// stale payloads. The cache applies to remote configurations added after the call.
+func (cm *ConfigManager) SetRemoteCache(dir string, ttl time.Duration) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("remote cache: %v", err)
+	}
+
+	cm.configList.settingsMutex.Lock()
+	defer cm.configList.settingsMutex.Unlock()
+	cm.configList.remoteCacheDir = dir
+	cm.configList.remoteCacheTTL = ttl
+	return nil
+}
+
+// IsDegraded reports whether the specified configuration is running on its last-known-good snapshot
+// or on default values because its file could not be loaded. See Status for details.
+func (cm *ConfigManager) IsDegraded(configName string) bool {
+	settings, ok := cm.configList.getSettings(configName)
+	if !ok {
+		return false
+	}
+	settings.mu.Lock()
+	defer settings.mu.Unlock()
+	return settings.state != ConfigLoaded
+}
+
+// rememberGoodContent stores the current file content as the last successfully applied content, see rememberContent.
+// The caller must hold settings.mu.
+func (c *ConfigSettings) rememberGoodContent() {
+	content, err := c.source().ReadSourceFile(c.configFullPath)
+	if err != nil {
+		return
+	}
+	c.rememberContent(content)
+}
+
+// rememberContent stores content read from the file as the last successfully applied content, persists it as the
+// last-known-good snapshot and clears the degraded state and the file event, if any. The caller must hold settings.mu.
+func (c *ConfigSettings) rememberContent(content []byte) {
+	changed := !bytes.Equal(c.lastGoodContent, content)
+	c.markRead(changed)
+	c.lastGoodContent = content
+	c.state, c.stateError, c.lastGoodTime = ConfigLoaded, "", time.Time{}
+	c.fileEvent = ""
+	if c.lastGoodPath == "" {
+		return
+	}
+	if _, err := os.Stat(c.lastGoodPath); changed || err != nil {
+		perm := os.FileMode(0644)
+		if _, ok := c.fsys.(configRedactor); ok {
+			perm = 0600
+		}
+		if err := writeFileAtomic(c.lastGoodPath, content, perm); err != nil {
+			c.reportError(fmt.Errorf("last-known-good: error persisting config %v: %w", c.configName, err))
+		}
+		return
+	}
+	// The modification time of the snapshot is the time its content was last known to be current.
+	now := time.Now()
+	os.Chtimes(c.lastGoodPath, now, now)
+}
+
+// IsStale reports whether the specified configuration is served from a snapshot older than its staleness TTL,
+// set with SetRemoteCache. See ConfigStatus.CacheAge for the age of the snapshot.
+func (cm *ConfigManager) IsStale(configName string) bool {
+	settings, ok := cm.configList.getSettings(configName)
+	if !ok {
+		return false
+	}
+	settings.mu.Lock()
+	defer settings.mu.Unlock()
+	return settings.staleTTL > 0 && settings.cacheAge() > settings.staleTTL
+}
+
+// cacheAge returns the age of the snapshot the values come from, or zero if they come from the source.
+// The caller must hold c.mu.
+func (c *ConfigSettings) cacheAge() time.Duration {
+	if c.state != ConfigLastKnownGood || c.lastGoodTime.IsZero() {
+		return 0
+	}
+	return time.Since(c.lastGoodTime)
+}
+
+// startFromLastKnownGood initializes a configuration whose file cannot be read at startup from its
+// last-known-good snapshot. It reports whether a snapshot was found.
+func (c *ConfigSettings) startFromLastKnownGood(v interface{}) bool {
+	if c.lastGoodPath == "" || c.Reader == nil {
+		return false
+	}
+	content, err := ioutil.ReadFile(c.lastGoodPath)
+	if err != nil {
+		return false
+	}
+
+	configMap, _ := c.contentToMap(c.lastGoodPath, content)
+	if info, err := os.Stat(c.lastGoodPath); err == nil {
+		c.lastGoodTime = info.ModTime()
+	}
+	c.config = &v
+	c.configMAP = configMap
+	c.lastGoodContent = content
+	return true
+}
+
+// loadLastKnownGood loads v from the last-known-good snapshot after the configuration file failed to load
+// with cause, and marks the configuration as degraded. Returns cause if there is no usable snapshot.
+// The caller must hold settings.mu.
+func (c *ConfigSettings) loadLastKnownGood(v interface{}, cause error) error {
+	if c.lastGoodPath == "" {
+		return cause
+	}
+	content, err := ioutil.ReadFile(c.lastGoodPath)
+	if err != nil {
+		return cause
+	}
+
+	apply, err := c.decodeContent(c.lastGoodPath, content, v)
+	if err != nil {
+		return fmt.Errorf("%v; last-known-good snapshot: %v", cause, err)
+	}
+	apply()
+
+	if info, err := os.Stat(c.lastGoodPath); err == nil && c.state != ConfigLastKnownGood {
+		c.lastGoodTime = info.ModTime()
+	}
+	c.config = v
+	c.lastGoodContent = content
+	c.state, c.stateError = ConfigLastKnownGood, cause.Error()
+	c.reportError(fmt.Errorf("%w: config %v is running on its last-known-good snapshot %v: %v", ErrDegraded, c.configName, c.lastGoodPath, cause))
+	return nil
+}
@@ -0,0 +1,65 @@
+package mkconf
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLastKnownGoodReportedThroughErrorFunc(t *testing.T) {
+	dir, stateDir := t.TempDir(), t.TempDir()
+	path := filepath.Join(dir, "lkg.json")
+	if err := os.WriteFile(path, []byte(`{"version": 1}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var reported []error
+	config := &stressConfig{}
+	cm := NewConfigManager()
+	cm.SetErrorFunc(func(err error) { reported = append(reported, err) })
+	if err := cm.SetStateDir(stateDir); err != nil {
+		t.Fatalf("SetStateDir: %v", err)
+	}
+	if err := cm.AddConfig("lkg", dir, ".json", config); err != nil {
+		t.Fatalf("AddConfig: %v", err)
+	}
+	if err := cm.LoadConfig("lkg"); err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	if len(reported) != 0 {
+		t.Fatalf("reported %v for a valid file", reported)
+	}
+
+	if err := os.WriteFile(path, []byte(`{"version": `), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := cm.LoadConfig("lkg"); err != nil {
+		t.Fatalf("LoadConfig of a broken file with a snapshot: %v", err)
+	}
+	if config.Version != 1 || !cm.IsDegraded("lkg") {
+		t.Fatalf("version %v, degraded %v, want 1 from the snapshot and degraded", config.Version, cm.IsDegraded("lkg"))
+	}
+	if len(reported) != 1 || !errors.Is(reported[0], ErrDegraded) {
+		t.Fatalf("reported %v, want one error wrapping ErrDegraded", reported)
+	}
+
+	// A snapshot that cannot be written is reported too.
+	reported = nil
+	snapshot := filepath.Join(stateDir, "lkg.json")
+	if err := os.Remove(snapshot); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(snapshot, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(`{"version": 2}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := cm.LoadConfig("lkg"); err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	if len(reported) != 1 || !strings.Contains(reported[0].Error(), "last-known-good: error persisting config lkg") {
+		t.Fatalf("reported %v, want the error persisting the snapshot", reported)
+	}
+}
@@ -0,0 +1,307 @@
+package mkconf
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	reader "mkconf/readers"
+)
+
+// Layer is one source of a layered configuration. Load returns the values of the layer keyed like the
+// configuration, or nil if the layer holds none. It is called whenever the configuration is loaded or checked
+// for changes.
+type Layer interface {
+	Name() string
+	Load() (map[string]interface{}, error)
+}
+
+// FileLayer is a layer read from a configuration file of any format with a stream reader, selected by the
+// file extension.
+type FileLayer struct {
+	Path     string // Path of the file
+	Optional bool   // Flag treating a missing file as an empty layer instead of an error
+}
+
+// Name implements Layer.
+func (l FileLayer) Name() string {
+	return "file " + l.Path
+}
+
+// Load implements Layer.
+func (l FileLayer) Load() (map[string]interface{}, error) {
+	content, err := ioutil.ReadFile(l.Path)
+	if os.IsNotExist(err) && l.Optional {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	configReader, err := fileStreamReader(l.Path)
+	if err != nil {
+		return nil, fmt.Errorf("%v for layers", err)
+	}
+	return decodeValues(configReader, content)
+}
+
+// fileConfigType returns the config type of a file, selected by its extension, e.g. ".yaml" or ".mk.json".
+func fileConfigType(path string) string {
+	configType := filepath.Ext(path)
+	if strings.HasSuffix(strings.ToLower(strings.TrimSuffix(path, configType)), ".mk") {
+		configType = ".mk" + configType
+	}
+	return configType
+}
+
+// fileStreamReader returns the stream reader of the config type of a file, selected by its extension.
+func fileStreamReader(path string) (reader.Reader, error) {
+	configType := fileConfigType(path)
+	configReader := (&ConfigSettings{configType: configType}).checkReader()
+	if _, ok := configReader.(reader.StreamReader); !ok {
+		return nil, fmt.Errorf("config type %v is not supported", configType)
+	}
+	return configReader, nil
+}
+
+// EnvLayer is a layer of environment variables starting with Prefix. The rest of a variable's name is the key path,
+// split at Separator and in lower case, so with the prefix "APP_" the variable APP_DB__HOST sets db.host. Values
+// that parse as booleans, numbers, JSON arrays or JSON objects are used as such; others are strings.
+type EnvLayer struct {
+	Prefix    string                 // Prefix of the variables, e.g. "APP_"
+	Separator string                 // Separator of nested keys; "__" if empty
+	Filter    func(name string) bool // Function selecting variables among those with the prefix by full name; all if nil
+}
+
+// Name implements Layer.
+func (l EnvLayer) Name() string {
+	return "env " + l.Prefix + "*"
+}
+
+// Load implements Layer.
+func (l EnvLayer) Load() (map[string]interface{}, error) {
+	values, _ := l.load()
+	return values, nil
+}
+
+// load returns the values of the layer and the name of the variable setting each of them, keyed by dot-separated path.
+func (l EnvLayer) load() (map[string]interface{}, map[string]string) {
+	return l.loadFrom(l.environ())
+}
+
+// environ returns the variables of the process environment selected by the layer, as "name=value" pairs.
+func (l EnvLayer) environ() []string {
+	var selected []string
+	for _, variable := range os.Environ() {
+		name := variable
+		if i := strings.Index(variable, "="); i >= 0 {
+			name = variable[:i]
+		}
+		if !strings.HasPrefix(name, l.Prefix) || len(name) == len(l.Prefix) || (l.Filter != nil && !l.Filter(name)) {
+			continue
+		}
+		selected = append(selected, variable)
+	}
+	return selected
+}
+
+// loadFrom returns the values of the selected variables in environ, as returned by environ, and their origins.
+func (l EnvLayer) loadFrom(environ []string) (map[string]interface{}, map[string]string) {
+	separator := l.Separator
+	if separator == "" {
+		separator = "__"
+	}
+	var values map[string]interface{}
+	origins := make(map[string]string)
+	for _, variable := range environ {
+		name, value := variable, ""
+		if i := strings.Index(variable, "="); i >= 0 {
+			name, value = variable[:i], variable[i+1:]
+		}
+		if values == nil {
+			values = make(map[string]interface{})
+		}
+		path := strings.Split(strings.ToLower(name[len(l.Prefix):]), separator)
+		setValuePath(values, path, envValue(value))
+		origins[strings.Join(path, ".")] = "env " + name
+	}
+	return values, origins
+}
+
+// envValue converts the text of an environment variable into a boolean, number, list, map or string.
+func envValue(text string) interface{} {
+	if b, err := strconv.ParseBool(text); err == nil && strings.ToLower(text) == strconv.FormatBool(b) {
+		return b
+	}
+	if i, err := strconv.ParseInt(text, 10, 64); err == nil {
+		return i
+	}
+	if f, err := strconv.ParseFloat(text, 64); err == nil {
+		return f
+	}
+	if trimmed := strings.TrimSpace(text); strings.HasPrefix(trimmed, "[") || strings.HasPrefix(trimmed, "{") {
+		var value interface{}
+		if err := json.Unmarshal([]byte(trimmed), &value); err == nil {
+			return value
+		}
+	}
+	return text
+}
+
+// setValuePath stores value at path in values, creating nested maps as needed.
+func setValuePath(values map[string]interface{}, path []string, value interface{}) {
+	for _, key := range path[:len(path)-1] {
+		nested, ok := values[key].(map[string]interface{})
+		if !ok {
+			nested = make(map[string]interface{})
+			values[key] = nested
+		}
+		values = nested
+	}
+	values[path[len(path)-1]] = value
+}
+
+// MapLayer is a layer of fixed values, or of values kept up to date by the application, e.g. overrides fetched
+// from a remote service. The function is called on every load.
+type MapLayer struct {
+	Label  string                                 // Name of the layer in error messages
+	Values func() (map[string]interface{}, error) // Function returning the current values
+}
+
+// Name implements Layer.
+func (l MapLayer) Name() string {
+	return l.Label
+}
+
+// Load implements Layer.
+func (l MapLayer) Load() (map[string]interface{}, error) {
+	values, err := l.Values()
+	if err != nil || values == nil {
+		return nil, err
+	}
+	return jsonCompatible(values).(map[string]interface{}), nil
+}
+
+// layeredFS presents the merged values of the layers of a configuration as a single configuration file.
+type layeredFS struct {
+	layers   []Layer       // Layers in increasing precedence
+	reader   reader.Reader // Reader of the configuration type, implementing reader.StreamWriter
+	strategy MergeStrategy // How the values of a layer are merged into those of earlier layers
+	valueOrigins
+}
+
+// originLayer is implemented by layers that know the origin of each of their values, keyed by dot-separated path.
+type originLayer interface {
+	load() (map[string]interface{}, map[string]string)
+}
+
+// configProvenance is implemented by config sources composed of several origins, such as layers or environment
+// variables, telling where a value comes from.
+type configProvenance interface {
+	provenance(path []string) string
+}
+
+// valueOrigins records the origin of every value of a composed configuration.
+type valueOrigins struct {
+	origins  map[string]string // Origins keyed by lower-case, dot-separated path
+	originMu sync.Mutex        // Mutex for synchronizing access to the origins
+}
+
+// AddLayeredConfig adds a configuration composed of layers merged in increasing precedence, e.g. a defaults file,
+// then environment overrides, then remote overrides:
+//
+//	cm.AddLayeredConfig("app", ".yaml", &cfg,
+//		FileLayer{Path: "defaults.yaml"}, EnvLayer{Prefix: "APP_"}, MapLayer{Label: "remote", Values: fetch})
+//
+// Nested maps are merged key by key; other values of a later layer replace those of earlier ones. configType is the
+// format the merged values are decoded from, so its struct tags apply. Change monitoring re-reads all layers, so a
+// change in any of them fires a single change event with the diff of the effective configuration. Layered
+// configurations are read-only.
+func (cm *ConfigManager) AddLayeredConfig(configName, configType string, configInterface interface{}, layers ...Layer) error {
+	if len(layers) == 0 {
+		return fmt.Errorf("config %v: no layers", configName)
+	}
+	configReader := (&ConfigSettings{configType: configType}).checkReader()
+	_, canRead := configReader.(reader.StreamReader)
+	_, canWrite := configReader.(reader.StreamWriter)
+	if !canRead || !canWrite {
+		return fmt.Errorf("config %v: layers are not supported for config type %v", configName, configType)
+	}
+
+	l := &layeredFS{layers: layers, reader: configReader}
+	return cm.AddConfigFS(l, configName, "", configType, configInterface)
+}
+
+// Open implements fs.FS. Every name resolves to the merged values of all layers.
+func (l *layeredFS) Open(name string) (fs.File, error) {
+	values := make(map[string]interface{})
+	origins := make(map[string]string)
+	for _, layer := range l.layers {
+		var layerValues map[string]interface{}
+		var layerOrigins map[string]string
+		if origin, ok := layer.(originLayer); ok {
+			layerValues, layerOrigins = origin.load()
+		} else {
+			var err error
+			if layerValues, err = layer.Load(); err != nil {
+				return nil, &fs.PathError{Op: "open", Path: name, Err: fmt.Errorf("layer %v: %v", layer.Name(), err)}
+			}
+			layerOrigins = make(map[string]string)
+			collectOrigins(layerValues, "", layer.Name(), layerOrigins)
+		}
+		if err := mergeLayer(values, layerValues, l.strategy, ""); err != nil {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: fmt.Errorf("layer %v: %v", layer.Name(), err)}
+		}
+		for path, origin := range layerOrigins {
+			origins[path] = origin
+		}
+	}
+	l.setOrigins(origins)
+
+	var b bytes.Buffer
+	if err := l.reader.(reader.StreamWriter).WriteConfigTo(&b, values); err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	return newRemoteFile(name, b.Bytes()), nil
+}
+
+// setOrigins replaces the recorded origins.
+func (o *valueOrigins) setOrigins(origins map[string]string) {
+	lower := make(map[string]string, len(origins))
+	for path, origin := range origins {
+		lower[strings.ToLower(path)] = origin
+	}
+	o.originMu.Lock()
+	defer o.originMu.Unlock()
+	o.origins = lower
+}
+
+// provenance returns the origin of the value at path, or of the nearest value containing it, e.g. a list.
+func (o *valueOrigins) provenance(path []string) string {
+	o.originMu.Lock()
+	defer o.originMu.Unlock()
+	for n := len(path); n > 0; n-- {
+		if origin, ok := o.origins[strings.ToLower(strings.Join(path[:n], "."))]; ok {
+			return origin
+		}
+	}
+	return ""
+}
+
+// collectOrigins records origin for every value below the nested maps of values, keyed by dot-separated path.
+func collectOrigins(values map[string]interface{}, prefix, origin string, origins map[string]string) {
+	for key, value := range values {
+		path := prefix + key
+		if nested, ok := value.(map[string]interface{}); ok && len(nested) > 0 {
+			collectOrigins(nested, path+".", origin, origins)
+			continue
+		}
+		origins[path] = origin
+	}
+}
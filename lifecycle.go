@@ -0,0 +1,255 @@
+package mkconf
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Kinds of resources held by a configuration while it is monitored or watched.
+const (
+	resourceMonitorGoroutine  = "monitor goroutine"
+	resourceMonitorContext    = "monitor context"
+	resourceDispatchGoroutine = "dispatch goroutine"
+	resourceRemoteWatch       = "remote watch goroutine"
+	resourceStaleWatch        = "stale watch goroutine"
+)
+
+// ErrLingeringResources is wrapped by the errors the lifecycle debug mode reports for resources still alive.
+var ErrLingeringResources = errors.New("lingering resources")
+
+// lingerGracePeriod is how long the lifecycle debug mode waits for resources to be released before reporting them.
+const lingerGracePeriod = time.Second
+
+// resourceTracker counts the live resources of each configuration.
+type resourceTracker struct {
+	mu     sync.Mutex                // Mutex for synchronizing access to the counts
+	counts map[string]map[string]int // Live resource counts by configName and resource kind
+}
+
+// acquire records a new live resource of the given kind.
+func (r *resourceTracker) acquire(configName, kind string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.counts == nil {
+		r.counts = make(map[string]map[string]int)
+	}
+	if r.counts[configName] == nil {
+		r.counts[configName] = make(map[string]int)
+	}
+	r.counts[configName][kind]++
+}
+
+// release records that a resource of the given kind was freed. Entries dropping to zero are removed.
+func (r *resourceTracker) release(configName, kind string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	counts := r.counts[configName]
+	if counts == nil {
+		return
+	}
+	counts[kind]--
+	if counts[kind] <= 0 {
+		delete(counts, kind)
+	}
+	if len(counts) == 0 {
+		delete(r.counts, configName)
+	}
+}
+
+// live returns the live resources of the configuration, limited to the given kinds if any are passed.
+func (r *resourceTracker) live(configName string, kinds ...string) map[string]int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	live := make(map[string]int)
+	for kind, count := range r.counts[configName] {
+		if len(kinds) == 0 || containsString(kinds, kind) {
+			live[kind] = count
+		}
+	}
+	return live
+}
+
+// snapshot returns a copy of all live resource counts.
+func (r *resourceTracker) snapshot() map[string]map[string]int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	snapshot := make(map[string]map[string]int, len(r.counts))
+	for configName, counts := range r.counts {
+		snapshot[configName] = make(map[string]int, len(counts))
+		for kind, count := range counts {
+			snapshot[configName][kind] = count
+		}
+	}
+	return snapshot
+}
+
+// SetLifecycleDebug enables a debug mode that reports goroutines and contexts still alive
+// shortly after StopChangeMonitoring or RemoveConfig, which points to a leak or a blocked callback.
+// They are passed to the function set with SetErrorFunc as errors wrapping ErrLingeringResources.
+func (cm *ConfigManager) SetLifecycleDebug(enabled bool) {
+	cm.configList.settingsMutex.Lock()
+	defer cm.configList.settingsMutex.Unlock()
+	cm.configList.lifecycleDebug = enabled
+}
+
+// LiveResources returns the number of live goroutines and contexts of each configuration, by resource kind.
+// Configurations without live resources are omitted.
+func (cm *ConfigManager) LiveResources() map[string]map[string]int {
+	return cm.configList.resources.snapshot()
+}
+
+// RemoveConfig stops all monitoring and watching of the configuration and removes it from the manager,
+// together with its callbacks, change logs, quarantine and startup policy. WatchForChanges goroutines
+// dispatching its changes return, and removing the last configuration stops the callback pool. Members of a configuration group cannot be removed.
+func (cm *ConfigManager) RemoveConfig(configName string) error {
+	cm.mu.Lock()
+	if _, ok := cm.configs[configName]; !ok {
+		cm.mu.Unlock()
+		return fmt.Errorf("config not found: %s", configName)
+	}
+	for groupName, group := range cm.groups {
+		if containsString(group.names, configName) {
+			cm.mu.Unlock()
+			return fmt.Errorf("remove config %s: member of config group %s", configName, groupName)
+		}
+	}
+	source := cm.remoteSources[configName]
+	delete(cm.remoteSources, configName)
+	delete(cm.configs, configName)
+	delete(cm.changeCallbacks, configName)
+	delete(cm.trackCallback, configName)
+	delete(cm.eventCallbacks, configName)
+	for id, sub := range cm.subscriptions {
+		if sub.configName == configName {
+			delete(cm.subscriptions, id)
+		}
+	}
+	delete(cm.loadPriorities, configName)
+	cm.order = removeString(cm.order, configName)
+	// The callback pool is not needed without configurations; queued callbacks still run.
+	var pool *callbackPool
+	if len(cm.configs) == 0 {
+		pool, cm.callbackPool = cm.callbackPool, nil
+	}
+	cm.mu.Unlock()
+	if pool != nil {
+		pool.close()
+	}
+
+	// The config is removed first, so a watcher blocked on delivering a change is released before it is stopped.
+	cm.configList.removeConfig(configName)
+	if source != nil {
+		source.StopWatching()
+	}
+	return nil
+}
+
+// removeConfig stops monitoring of the configuration, signals its goroutines to exit
+// and drops every entry kept for it.
+func (c *ConfigList) removeConfig(configName string) {
+	c.settingsMutex.Lock()
+	settings, ok := c.settings[configName]
+	delete(c.settings, configName)
+	delete(c.startupPolicies, configName)
+	c.settingsMutex.Unlock()
+	if !ok {
+		return
+	}
+
+	// Closing the channel first releases goroutines blocked on delivering a change nobody receives.
+	settings.mu.Lock()
+	settings.enableChangeValidation = false
+	close(settings.ch_ChangeValidation)
+	settings.mu.Unlock()
+	c.stopMonitor(settings)
+
+	c.logMutex.Lock()
+	delete(c.changeLogs, configName)
+	delete(c.impacts, configName)
+	c.logMutex.Unlock()
+
+	c.quarantineMutex.Lock()
+	delete(c.quarantine, configName)
+	c.quarantineMutex.Unlock()
+
+	c.reportLingering(configName, "RemoveConfig")
+}
+
+// dispatch invokes cb for every name received on ch until stop is closed or the configuration is removed.
+func (c *ConfigList) dispatch(settings *ConfigSettings, ch <-chan string, cb func(configName string), stop <-chan struct{}) {
+	c.resources.acquire(settings.configName, resourceDispatchGoroutine)
+	defer c.resources.release(settings.configName, resourceDispatchGoroutine)
+
+	for {
+		select {
+		case name := <-ch:
+			cb(name)
+		case <-settings.ch_ChangeValidation:
+			return
+		case <-stop:
+			return
+		}
+	}
+}
+
+// dispatchEvents calls publish with every ChangeEvent of the configuration until stop is closed or the
+// configuration is removed.
+func (c *ConfigList) dispatchEvents(settings *ConfigSettings, publish func(event ChangeEvent), stop <-chan struct{}) {
+	c.resources.acquire(settings.configName, resourceDispatchGoroutine)
+	defer c.resources.release(settings.configName, resourceDispatchGoroutine)
+
+	for {
+		select {
+		case event := <-settings.ch_ConfigEvents:
+			publish(event)
+		case <-settings.ch_ChangeValidation:
+			return
+		case <-stop:
+			return
+		}
+	}
+}
+
+// reportLingering reports the resources of the given kinds (all kinds if none are passed) that are still alive
+// after the grace period following operation, if the lifecycle debug mode is enabled.
+func (c *ConfigList) reportLingering(configName, operation string, kinds ...string) {
+	c.settingsMutex.Lock()
+	debug := c.lifecycleDebug
+	c.settingsMutex.Unlock()
+	if !debug {
+		return
+	}
+
+	go func() {
+		deadline := time.Now().Add(lingerGracePeriod)
+		live := c.resources.live(configName, kinds...)
+		for len(live) > 0 && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+			live = c.resources.live(configName, kinds...)
+		}
+		if len(live) == 0 {
+			return
+		}
+
+		lingering := make([]string, 0, len(live))
+		for kind, count := range live {
+			lingering = append(lingering, fmt.Sprintf("%d %s", count, kind))
+		}
+		sort.Strings(lingering)
+		c.reportError(fmt.Errorf("%w: config %v still holds %v after %v", ErrLingeringResources, configName, strings.Join(lingering, ", "), operation))
+	}()
+}
+
+// containsString reports whether values contains value.
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,27 @@
+package mkconf
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLingeringResourcesReportedThroughErrorFunc(t *testing.T) {
+	reported := make(chan error, 1)
+	cm := NewConfigManager()
+	cm.SetErrorFunc(func(err error) { reported <- err })
+	cm.SetLifecycleDebug(true)
+
+	cm.configList.resources.acquire("leaky", resourceMonitorGoroutine)
+	cm.configList.reportLingering("leaky", "RemoveConfig")
+
+	select {
+	case err := <-reported:
+		if !errors.Is(err, ErrLingeringResources) || !strings.Contains(err.Error(), "config leaky still holds 1 monitor goroutine after RemoveConfig") {
+			t.Fatalf("reported %v, want the lingering monitor goroutine of config leaky", err)
+		}
+	case <-time.After(lingerGracePeriod + 5*time.Second):
+		t.Fatal("lingering resource not reported")
+	}
+}
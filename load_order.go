@@ -0,0 +1,68 @@
+package mkconf
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// LoadResult is the outcome of loading one configuration with LoadAllConfigs.
+type LoadResult struct {
+	Name     string        // Name of the configuration
+	Duration time.Duration // Time loading took
+	Err      error         // Error loading the configuration, or nil if it was loaded
+}
+
+// SetLoadPriority sets the priority of a configuration in bulk loads: configurations with higher priorities are
+// loaded first, and configurations with equal priorities in registration order. The default priority is 0.
+func (cm *ConfigManager) SetLoadPriority(configName string, priority int) error {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	if _, ok := cm.configs[configName]; !ok {
+		return fmt.Errorf("config with name %s not found", configName)
+	}
+	if cm.loadPriorities == nil {
+		cm.loadPriorities = make(map[string]int)
+	}
+	cm.loadPriorities[configName] = priority
+	return nil
+}
+
+// LoadAllConfigs loads all registered configurations one after another in load order (see SetLoadPriority) and
+// returns the outcome of each, in the same order, so logs and retries of bulk loads are reproducible. A failed
+// configuration does not stop the others.
+func (cm *ConfigManager) LoadAllConfigs() []LoadResult {
+	names, configs := cm.loadOrder()
+	results := make([]LoadResult, 0, len(names))
+	for i, configName := range names {
+		start := time.Now()
+		err := cm.configList.LoadConfig(configName, configs[i])
+		results = append(results, LoadResult{Name: configName, Duration: time.Since(start), Err: err})
+	}
+	return results
+}
+
+// loadOrder returns the names of the registered configurations in load order, and their values.
+func (cm *ConfigManager) loadOrder() ([]string, []interface{}) {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+	names := append([]string(nil), cm.order...)
+	sort.SliceStable(names, func(i, j int) bool {
+		return cm.loadPriorities[names[i]] > cm.loadPriorities[names[j]]
+	})
+	configs := make([]interface{}, len(names))
+	for i, configName := range names {
+		configs[i] = cm.configs[configName]
+	}
+	return names, configs
+}
+
+// removeString returns values without the first occurrence of value.
+func removeString(values []string, value string) []string {
+	for i, item := range values {
+		if item == value {
+			return append(values[:i:i], values[i+1:]...)
+		}
+	}
+	return values
+}
@@ -0,0 +1,137 @@
+package mkconf
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	reader "mkconf/readers"
+)
+
+// localFilesFS presents a configuration file with the files it draws on merged in: its local override file, e.g.
+// app.local.json over app.json, and the files named by its include directives. Names are the slash-separated paths
+// of the main files on the OS file system.
+type localFilesFS struct {
+	configType string        // Config type of the files, e.g. ".json"
+	reader     reader.Reader // Reader of the config type, implementing reader.StreamReader and reader.StreamWriter
+	overlay    bool          // Flag merging the local override file over the main file
+	includes   bool          // Flag resolving include directives
+	valueOrigins
+}
+
+// SetLocalOverlays enables or disables local override files for configurations added afterwards with AddConfig.
+// When enabled, a file next to the configuration file with ".local" before the extension, e.g. app.local.json for
+// app.json, is merged over it whenever it exists: nested maps key by key, other values replaced. The local file is
+// monitored with the configuration, so creating, changing or removing it reloads the values, and DumpTree marks
+// the values it sets, e.g. [from file app.local.json]. Developers can keep the local file out of version control to
+// override settings without touching the committed configuration. While a local file exists, UpdateConfig and Set
+// fail rather than write its values into the main file. Only config types with stream readers and writers
+// (JSON, YAML, TOML, Plist and XML) support local files.
+func (cm *ConfigManager) SetLocalOverlays(enabled bool) {
+	cm.configList.settingsMutex.Lock()
+	defer cm.configList.settingsMutex.Unlock()
+	cm.configList.localOverlays = enabled
+}
+
+// localFilesFor returns the file system merging local override and included files of the config type, or nil if
+// both are disabled or the config type does not support them.
+func (cm *ConfigManager) localFilesFor(configType string) fs.FS {
+	cm.configList.settingsMutex.Lock()
+	overlay, includes := cm.configList.localOverlays, cm.configList.includes
+	cm.configList.settingsMutex.Unlock()
+	if !overlay && !includes {
+		return nil
+	}
+	configReader := (&ConfigSettings{configType: configType}).checkReader()
+	_, canRead := configReader.(reader.StreamReader)
+	_, canWrite := configReader.(reader.StreamWriter)
+	if !canRead || !canWrite {
+		return nil
+	}
+	return &localFilesFS{configType: configType, reader: configReader, overlay: overlay, includes: includes}
+}
+
+// localPath returns the path of the local override file of a configuration file.
+func (l *localFilesFS) localPath(name string) string {
+	main := filepath.FromSlash(name)
+	return strings.TrimSuffix(main, l.configType) + ".local" + l.configType
+}
+
+// Open implements fs.FS, returning the main file as stored if it draws on no other file.
+func (l *localFilesFS) Open(name string) (fs.File, error) {
+	mainPath := filepath.FromSlash(name)
+	content, err := ioutil.ReadFile(mainPath)
+	if err != nil {
+		return nil, err
+	}
+	var local []byte
+	localPath := l.localPath(name)
+	if l.overlay {
+		if local, err = ioutil.ReadFile(localPath); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+
+	values, err := decodeValues(l.reader, content)
+	if err != nil {
+		if local == nil {
+			// Content that does not decode is rejected when it is read, like without local files.
+			l.setOrigins(nil)
+			return newRemoteFile(name, content), nil
+		}
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	origins := make(map[string]string)
+	included := false
+	if l.includes {
+		if included, err = resolveIncludes(values, mainPath, "", []string{mainPath}, origins); err != nil {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+		}
+	}
+	if local == nil && !included {
+		l.setOrigins(nil)
+		return newRemoteFile(name, content), nil
+	}
+
+	if local != nil {
+		localValues, err := decodeValues(l.reader, local)
+		if err == nil && l.includes {
+			_, err = resolveIncludes(localValues, localPath, "", []string{mainPath, localPath}, origins)
+		}
+		if err != nil {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: fmt.Errorf("local file %v: %v", localPath, err)}
+		}
+		mergeValues(values, localValues)
+		collectOrigins(localValues, "", "file "+filepath.Base(localPath), origins)
+	}
+	l.setOrigins(origins)
+
+	var b bytes.Buffer
+	if err := l.reader.(reader.StreamWriter).WriteConfigTo(&b, values); err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	return newRemoteFile(name, b.Bytes()), nil
+}
+
+// WriteFile implements reader.WriteFileFS, writing the main file unless it draws on other files, whose values
+// would be copied into it.
+func (l *localFilesFS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	mainPath := filepath.FromSlash(name)
+	if _, err := os.Stat(l.localPath(name)); err == nil && l.overlay {
+		return fmt.Errorf("local file %v overrides %v; edit the files instead", l.localPath(name), mainPath)
+	}
+	if l.includes {
+		content, err := ioutil.ReadFile(mainPath)
+		if err != nil {
+			return err
+		}
+		if values, err := decodeValues(l.reader, content); err == nil && hasIncludes(values) {
+			return fmt.Errorf("%v includes other files; edit the files instead", mainPath)
+		}
+	}
+	return ioutil.WriteFile(mainPath, data, perm)
+}
@@ -0,0 +1,102 @@
+package mkconf
+
+import (
+	"fmt"
+	"reflect"
+
+	reader "mkconf/readers"
+)
+
+// MergeStrategy selects how the values of a file are merged into those of the files before it.
+type MergeStrategy int
+
+const (
+	MergeOverride        MergeStrategy = iota // Nested maps are merged key by key; other values of a later file replace earlier ones
+	MergeAppendArrays                         // Like MergeOverride, but lists of a later file are appended to earlier ones
+	MergeErrorOnConflict                      // Like MergeOverride, but a value set to different values by two files fails the load
+)
+
+// String returns the name of the strategy.
+func (s MergeStrategy) String() string {
+	switch s {
+	case MergeOverride:
+		return "override"
+	case MergeAppendArrays:
+		return "append-arrays"
+	case MergeErrorOnConflict:
+		return "error-on-conflict"
+	}
+	return fmt.Sprintf("MergeStrategy(%d)", int(s))
+}
+
+// AddMergedConfig adds a configuration deep-merged from several files, in the order given, with the specified
+// strategy, e.g. shared settings, then the settings of a region, then those of a host:
+//
+//	cm.AddMergedConfig("app", []string{"base.yaml", "eu.yaml", "host.json"}, mkconf.MergeAppendArrays, &cfg)
+//
+// Each file may be of any format with a stream reader, selected by its extension. The merged values are decoded
+// with the format of the first file, so the struct tags of that format apply to the keys of every file: with
+// base.yaml first, the yaml tags name the keys of host.json too, and its json tags are ignored. The files are
+// watched as a unit: change monitoring
+// re-reads all of them, and a change in any fires a single change event with the diff of the merged configuration.
+// DumpTree marks every value with the file it comes from. Merged configurations are read-only.
+func (cm *ConfigManager) AddMergedConfig(configName string, paths []string, strategy MergeStrategy, configInterface interface{}) error {
+	if len(paths) == 0 {
+		return fmt.Errorf("config %v: no files to merge", configName)
+	}
+	if strategy < MergeOverride || strategy > MergeErrorOnConflict {
+		return fmt.Errorf("config %v: unknown merge strategy %v", configName, strategy)
+	}
+	configType := fileConfigType(paths[0])
+	configReader := (&ConfigSettings{configType: configType}).checkReader()
+	_, canRead := configReader.(reader.StreamReader)
+	_, canWrite := configReader.(reader.StreamWriter)
+	if !canRead || !canWrite {
+		return fmt.Errorf("config %v: merging is not supported for config type %v", configName, configType)
+	}
+
+	layers := make([]Layer, len(paths))
+	for i, path := range paths {
+		layers[i] = FileLayer{Path: path}
+	}
+	l := &layeredFS{layers: layers, reader: configReader, strategy: strategy}
+	return cm.AddConfigFS(l, configName, "", configType, configInterface)
+}
+
+// mergeLayer merges the values of src, found at the dot-separated prefix, into dst with the strategy.
+func mergeLayer(dst, src map[string]interface{}, strategy MergeStrategy, prefix string) error {
+	if strategy == MergeOverride {
+		mergeValues(dst, src)
+		return nil
+	}
+	for key, value := range src {
+		current, exists := dst[key]
+		srcMap, srcIsMap := value.(map[string]interface{})
+		dstMap, dstIsMap := current.(map[string]interface{})
+		switch {
+		case srcIsMap && dstIsMap:
+			if err := mergeLayer(dstMap, srcMap, strategy, joinPath(prefix, key)); err != nil {
+				return err
+			}
+			continue
+		case !exists:
+		case strategy == MergeAppendArrays:
+			srcList, srcIsList := value.([]interface{})
+			dstList, dstIsList := current.([]interface{})
+			if srcIsList && dstIsList {
+				value = append(append(make([]interface{}, 0, len(dstList)+len(srcList)), dstList...), srcList...)
+			}
+		case strategy == MergeErrorOnConflict:
+			if !reflect.DeepEqual(current, value) {
+				return fmt.Errorf("conflicting values for %v: %v and %v", joinPath(prefix, key), current, value)
+			}
+		}
+		if srcIsMap {
+			copied := make(map[string]interface{}, len(srcMap))
+			mergeValues(copied, srcMap)
+			value = copied
+		}
+		dst[key] = value
+	}
+	return nil
+}
@@ -0,0 +1,164 @@
+package mkconf
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMergeLayer(t *testing.T) {
+	base := func() map[string]interface{} {
+		return map[string]interface{}{
+			"name":  "app",
+			"hosts": []interface{}{"a", "b"},
+			"server": map[string]interface{}{
+				"port": 80,
+				"tls":  map[string]interface{}{"enabled": false},
+			},
+		}
+	}
+	tests := []struct {
+		name     string
+		strategy MergeStrategy
+		src      map[string]interface{}
+		want     map[string]interface{}
+		wantErr  string
+	}{
+		{
+			name:     "override merges maps and replaces lists",
+			strategy: MergeOverride,
+			src: map[string]interface{}{
+				"hosts":  []interface{}{"c"},
+				"server": map[string]interface{}{"tls": map[string]interface{}{"enabled": true}},
+			},
+			want: map[string]interface{}{
+				"name":   "app",
+				"hosts":  []interface{}{"c"},
+				"server": map[string]interface{}{"port": 80, "tls": map[string]interface{}{"enabled": true}},
+			},
+		},
+		{
+			name:     "append arrays appends lists and replaces scalars",
+			strategy: MergeAppendArrays,
+			src: map[string]interface{}{
+				"name":   "other",
+				"hosts":  []interface{}{"c"},
+				"server": map[string]interface{}{"port": 8080},
+			},
+			want: map[string]interface{}{
+				"name":   "other",
+				"hosts":  []interface{}{"a", "b", "c"},
+				"server": map[string]interface{}{"port": 8080, "tls": map[string]interface{}{"enabled": false}},
+			},
+		},
+		{
+			name:     "append arrays replaces a list by a scalar",
+			strategy: MergeAppendArrays,
+			src:      map[string]interface{}{"hosts": "c"},
+			want: map[string]interface{}{
+				"name":   "app",
+				"hosts":  "c",
+				"server": map[string]interface{}{"port": 80, "tls": map[string]interface{}{"enabled": false}},
+			},
+		},
+		{
+			name:     "error on conflict accepts equal and new values",
+			strategy: MergeErrorOnConflict,
+			src: map[string]interface{}{
+				"name":   "app",
+				"hosts":  []interface{}{"a", "b"},
+				"server": map[string]interface{}{"host": "localhost"},
+			},
+			want: map[string]interface{}{
+				"name":   "app",
+				"hosts":  []interface{}{"a", "b"},
+				"server": map[string]interface{}{"host": "localhost", "port": 80, "tls": map[string]interface{}{"enabled": false}},
+			},
+		},
+		{
+			name:     "error on conflict names the dotted path",
+			strategy: MergeErrorOnConflict,
+			src:      map[string]interface{}{"server": map[string]interface{}{"tls": map[string]interface{}{"enabled": true}}},
+			wantErr:  "conflicting values for server.tls.enabled: false and true",
+		},
+		{
+			name:     "error on conflict rejects different lists",
+			strategy: MergeErrorOnConflict,
+			src:      map[string]interface{}{"hosts": []interface{}{"c"}},
+			wantErr:  "conflicting values for hosts",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dst := base()
+			err := mergeLayer(dst, tt.src, tt.strategy, "")
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("mergeLayer = %v, want an error containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("mergeLayer: %v", err)
+			}
+			if !reflect.DeepEqual(dst, tt.want) {
+				t.Fatalf("merged %#v, want %#v", dst, tt.want)
+			}
+		})
+	}
+}
+
+func TestAddMergedConfig(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	base := write("base.yaml", "listen_port: 80\nhosts: [a]\n")
+	host := write("host.json", `{"listen_port": 8080, "hosts": ["b"]}`)
+	conflicting := write("conflict.json", `{"hosts": ["a"], "listen_port": 443}`)
+
+	// The keys of every file are decoded with the yaml tags of the first file; the json tags are ignored.
+	type config struct {
+		Port  int      `yaml:"listen_port" json:"port"`
+		Hosts []string `yaml:"hosts" json:"servers"`
+	}
+
+	tests := []struct {
+		strategy MergeStrategy
+		paths    []string
+		want     config
+		wantErr  string
+	}{
+		{MergeOverride, []string{base, host}, config{Port: 8080, Hosts: []string{"b"}}, ""},
+		{MergeAppendArrays, []string{base, host}, config{Port: 8080, Hosts: []string{"a", "b"}}, ""},
+		{MergeErrorOnConflict, []string{base, conflicting}, config{}, "conflicting values for listen_port: 80 and 443"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.strategy.String(), func(t *testing.T) {
+			cm := NewConfigManager()
+			var cfg config
+			err := cm.AddMergedConfig("app", tt.paths, tt.strategy, &cfg)
+			if err == nil {
+				err = cm.LoadConfig("app")
+			}
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("merged load = %v, want an error containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("merged load: %v", err)
+			}
+			if !reflect.DeepEqual(cfg, tt.want) {
+				t.Fatalf("merged config %+v, want %+v", cfg, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package mkconf
+
+// CallbackKind is the kind of a callback passed through the callback middleware.
+type CallbackKind string
+
+const (
+	CallbackKindChange   CallbackKind = "change callback"   // The change callback, see ChangeCallbackFunc
+	CallbackKindTracking CallbackKind = "tracking callback" // The tracking callback, see TrackingCallbackFunc
+	CallbackKindEvent    CallbackKind = "event listener"    // A ChangeEventFunc callback or a Subscribe listener
+)
+
+// CallbackCall describes a call of a callback passed through the callback middleware.
+type CallbackCall struct {
+	ConfigName string       // Name of the configuration that changed
+	Kind       CallbackKind // Kind of the callback
+	Event      *ChangeEvent // Event of the change; nil for change and tracking callbacks dispatched by name
+}
+
+// CallbackHandler handles a call of a callback; the innermost handler of the middleware chain calls the callback.
+type CallbackHandler func(call CallbackCall)
+
+// CallbackMiddleware wraps the handling of callback calls, like HTTP middleware wraps a handler, e.g. to log or
+// time callbacks, count them for metrics, or filter calls by not calling next.
+type CallbackMiddleware func(next CallbackHandler) CallbackHandler
+
+// UseCallbackMiddleware appends middleware to the chain wrapping every change callback, tracking callback and event
+// listener of the manager, so cross-cutting concerns need not be repeated in each callback. The first middleware
+// registered is the outermost. The chain runs where the callback runs, see SetCallbackMode, and panics in it are
+// recovered like panics of callbacks.
+func (cm *ConfigManager) UseCallbackMiddleware(middleware ...CallbackMiddleware) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	cm.middleware = append(cm.middleware, middleware...)
+}
+
+// withMiddleware returns a handler calling the callback through the middleware chain of the manager.
+func (cm *ConfigManager) withMiddleware(callback func()) CallbackHandler {
+	cm.mu.RLock()
+	middleware := cm.middleware
+	cm.mu.RUnlock()
+
+	handler := CallbackHandler(func(CallbackCall) { callback() })
+	for i := len(middleware) - 1; i >= 0; i-- {
+		handler = middleware[i](handler)
+	}
+	return handler
+}
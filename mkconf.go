@@ -1,38 +1,128 @@
 package mkconf
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	reader "mkconf/readers"
 )
 
+// ErrReadOnlySource is returned when updating a configuration whose reader does not implement reader.Writer.
+var ErrReadOnlySource = errors.New("config source is read-only")
+
+// ErrVersionConflict is returned when updating a configuration whose stored version changed since it was read.
+var ErrVersionConflict = errors.New("config version conflict")
+
+// ErrConfigFailed is returned by Get for configurations whose file was deleted, renamed or truncated under FileFail.
+var ErrConfigFailed = errors.New("config failed")
+
+// ErrCircuitOpen is returned by fetches of a remote source whose circuit breaker is open, see RetryPolicy.
+var ErrCircuitOpen = errors.New("circuit breaker open")
+
 // ConfigSettings represents the configuration settings for a specific configuration file.
 type ConfigSettings struct {
 	configName     string                 // Name of the configuration
 	configPath     string                 // Path to the configuration file
 	configFullPath string                 // Full path to the configuration file
 	configType     string                 // Type of the configuration file (e.g., JSON, YAML)
-	Reader         reader.ConfigReader    // ConfigReader implementation for reading the configuration
+	fsys           fs.FS                  // File system the configuration is read from; the OS file system if nil
+	charset        string                 // Charset of the configuration file without a byte order mark; detected if empty
+	Reader         reader.Reader          // Reader implementation for reading (and, if it is a reader.Writer, writing) the configuration
 	checkSec       int                    // Interval in seconds for checking configuration changes
 	repeatSec      int                    // Interval in seconds for repeated configuration checks
 	lastConfigHash string                 // Hash of the last known configuration file content
+	hasher         Hasher                 // Hash function of the file content; SHA256Hasher if nil
 	configMAP      map[string]interface{} // Map representation of the configuration
 	config         interface{}            // Instance of the configuration struct
 	mu             sync.Mutex             // Mutex for synchronizing access to configuration data
 	ctx            context.Context        // Context for cancellation of configuration monitoring
 	cancel         context.CancelFunc     // Cancel function to stop configuration monitoring
-	waitGroup      *sync.WaitGroup        // WaitGroup to wait for the completion of monitoring goroutines
+	monitorState   MonitorState           // Lifecycle state of the change monitoring
+	monitorDone    chan struct{}          // Channel closed when the running monitoring goroutine finished
+	monitorParent  context.Context        // Context of the caller the running monitoring is tied to
 
 	enableChangeValidation bool // Flag to enable change validation for the configuration
 	enableChangeTracking   bool // Flag to enable change tracking for the configuration
 
-	ch_ChangeValidation chan struct{} // Channel for signaling change validation
-	Ch_ConfigChanged    chan string   // Channel for signaling configuration changes
-	Ch_ConfigTracking   chan string   // Channel for signaling configuration tracking
+	hooks []ConfigHook // Validation/mutation hooks applied after the configuration is decoded
+
+	strictCoercion  bool                // Flag to reject configurations that require type coercion
+	coercionWarning CoercionWarningFunc // Function receiving coercion warnings
+
+	jsonnetImportPaths []string                   // Library search paths used when evaluating Jsonnet configurations
+	jsonnetExtVars     map[string]string          // External variables used when evaluating Jsonnet configurations
+	jsonnetEvaluate    reader.JsonnetEvaluateFunc // Evaluator of Jsonnet configurations, see SetJsonnetEvaluator
+	cueEvaluate        reader.CUEEvaluateFunc     // Evaluator of CUE configurations, see SetCUEEvaluator
+
+	lastGoodContent []byte        // File content of the last successfully applied configuration
+	lastGoodPath    string        // Path the last-known-good snapshot is persisted to, if a state directory or remote cache is set
+	historyPath     string        // Path of the history file the applied values are appended to, if a history directory is set
+	historyLast     []byte        // Values of the version last appended to the history file, as JSON
+	lastGoodTime    time.Time     // Time the snapshot the values come from was persisted, if state is ConfigLastKnownGood
+	staleTTL        time.Duration // Age after which values served from the snapshot are reported as stale; never if zero
+
+	lastReached    atomic.Int64  // Time the source was last read successfully, in Unix nanoseconds
+	lastApplied    atomic.Int64  // Time content of the source last changed the values, in Unix nanoseconds
+	staleThreshold time.Duration // Time without reaching the source after which the configuration is stale; none if zero
+	staleStop      chan struct{} // Channel closed to stop the goroutine calling the stale callback, if set
+
+	startupPolicy StartupPolicy // Behavior when the source is unavailable at startup
+
+	envOverrides EnvOverrides           // Environment variables overriding the values of the source
+	envApplied   map[string]envOverride // Overrides applied by the last load, keyed by dot-separated path
+	envChanges   []ConfigChangeLog      // Changes of the overrides not yet added to the change log
+	flags        map[string]*configFlag // Flags bound with BindFlags, keyed by dot-separated path
+
+	dualWrite *DualWriteOptions // Second file every update is written to during a format migration, if set
+
+	pins       map[string]interface{} // Values pinned with Pin, keyed by dot-separated path
+	pinIgnored map[string]interface{} // Values of the file last ignored for the pins, keyed by dot-separated path
+	pinChanges []ConfigChangeLog      // Ignored changes of the pinned values not yet added to the change log
+
+	requireApproval bool           // Flag to hold detected changes until they are approved
+	pendingHash     string         // Hash of a detected change waiting for approval
+	anomalyGuard    *AnomalyGuard  // Guard against suspicious changes, if set
+	anomalyHash     string         // Hash of the content last checked by the anomaly guard
+	anomaly         *ConfigAnomaly // Anomaly of the content last checked, if it is suspicious
+	approvedHash    string         // Hash of the change approved to be applied
+	debounce        time.Duration  // Time changed content must stay the same before it is applied; none if zero
+	adaptiveMin     time.Duration  // Shortest interval of adaptive polling, see SetAdaptivePolling
+	adaptiveMax     time.Duration  // Longest interval of adaptive polling; adaptive polling is disabled if zero
+	debounceHash    string         // Hash of the changed content waiting for the debounce window, if any
+	debounceSince   time.Time      // Time the content waiting for the debounce window was first seen
+	state           ConfigState    // Where the current values of the configuration come from
+	stateError      string         // Why the source is not used, if state is not ConfigLoaded
+
+	fileEventPolicy FileEventPolicy // Behavior when the file is deleted, renamed or truncated
+	fileInfo        fs.FileInfo     // Information on the file at the last check, to find it after a rename
+	fileEvent       string          // File event the configuration is affected by, e.g. FileDeleted; empty if the file is fine
+	eventState      ConfigState     // State before the file event, restored when the file comes back
+	eventStateError string          // State error before the file event
+
+	labels []string // Labels classifying the configuration, e.g. "critical"
+
+	eventsEnabled bool                   // Flag to build a ChangeEvent for every applied change, see ChangeEventFunc
+	snapshot      map[string]interface{} // Values last applied, as encoded by JSON, if events are enabled
+
+	deliveryPolicy    DeliveryPolicy // What happens when a notification cannot be delivered, see SetDelivery
+	callbackMode      CallbackMode   // Where the change callback and event listeners run, see SetCallbackMode
+	droppedDeliveries atomic.Uint64  // Notifications dropped or merged by the delivery policy
+
+	ch_ChangeValidation chan struct{}    // Channel closed when the configuration is removed, stopping its goroutines
+	Ch_ConfigChanged    chan string      // Channel for signaling configuration changes
+	Ch_ConfigTracking   chan string      // Channel for signaling configuration tracking
+	ch_ConfigEvents     chan ChangeEvent // Channel delivering the events of applied changes, if events are enabled
+	errorFunc           func(err error)  // Function reporting errors and warnings of the configuration; printed if nil
 }
 
 // ConfigList represents a collection of configuration settings.
@@ -40,19 +130,70 @@ type ConfigList struct {
 	settingsMutex sync.Mutex                   // Mutex for synchronizing access to the settings map
 	settings      map[string]*ConfigSettings   // Map of configuration settings with configName as the key
 	changeLogs    map[string][]ConfigChangeLog // Map of configuration change logs with configName as the key
-	logMutex      sync.Mutex                   // Mutex for synchronizing access to the changeLogs map
+	logMutex      sync.Mutex                   // Mutex for synchronizing access to the changeLogs map and the change sinks
+	changeSinks   []changeSink                 // Sinks receiving the tracked changes of all configurations
+	syncCallbacks syncCallbacks                // Runner of the callbacks of configurations in CallbackSync mode, if any
+	errorFunc     func(err error)              // Function reporting errors and warnings, see SetErrorFunc; printed if nil
+	impacts       map[string]map[string]string // Impacts of changes by configName and key path, see SetImpact; guarded by logMutex
+
+	contentSniffing bool   // Flag to select readers by file content when the extension has no reader
+	localOverlays   bool   // Flag to merge local override files over configurations added afterwards
+	includes        bool   // Flag to resolve include directives of configurations added afterwards
+	passive         bool   // Flag disabling change monitoring goroutines, see SetPassive
+	stateDir        string // Directory last-known-good snapshots are persisted to, if set
+	historyDir      string // Directory the histories of the configurations are persisted to, if set
+
+	envOverrides EnvOverrides // Environment variables overriding the values of every configuration
+
+	remoteCacheDir string        // Directory the payloads of remote sources are cached in, if set
+	remoteCacheTTL time.Duration // Age after which cached payloads are reported as stale
+
+	startupPolicies      map[string]StartupPolicy // Startup policies with configName as the key
+	defaultStartupPolicy StartupPolicy            // Startup policy of configurations without their own
+
+	quarantine      map[string][]QuarantineEntry // Map of rejected contents with configName as the key
+	quarantineDir   string                       // Directory rejected contents are persisted to, if set
+	quarantineMutex sync.Mutex                   // Mutex for synchronizing access to the quarantine
+
+	resources      resourceTracker // Live goroutines and contexts per configuration
+	pool           *watcherPool    // Pool checking monitored configurations, if the goroutine count is bounded
+	fileNotify     bool            // Flag to wake monitors by file system notifications, see SetFileNotify
+	notifier       fileNotifier    // Watcher of the directories of the configuration files monitored with notifications
+	pollJitter     float64         // Fraction of the check intervals of polled configurations that is randomized, see SetPollJitter
+	lifecycleDebug bool            // Flag to report resources still alive after monitoring is stopped or a config is removed
 }
 
 // NewConfigList creates a new ConfigList instance.
 func NewConfigList() *ConfigList {
 	list := &ConfigList{}
 	list.settings = make(map[string]*ConfigSettings)
+	list.changeLogs = make(map[string][]ConfigChangeLog)
 	return list
 }
 
 // GetSettings returns the ConfigSettings for the specified configuration file name.
 func (c *ConfigList) GetSettings(fileName string) *ConfigSettings {
-	return c.settings[fileName]
+	settings, _ := c.getSettings(fileName)
+	return settings
+}
+
+// getSettings returns the ConfigSettings for the specified configuration name under the settings lock.
+func (c *ConfigList) getSettings(configName string) (*ConfigSettings, bool) {
+	c.settingsMutex.Lock()
+	defer c.settingsMutex.Unlock()
+	settings, ok := c.settings[configName]
+	return settings, ok
+}
+
+// settingsSnapshot returns a copy of the settings map, so it can be iterated without holding the settings lock.
+func (c *ConfigList) settingsSnapshot() map[string]*ConfigSettings {
+	c.settingsMutex.Lock()
+	defer c.settingsMutex.Unlock()
+	snapshot := make(map[string]*ConfigSettings, len(c.settings))
+	for name, settings := range c.settings {
+		snapshot[name] = settings
+	}
+	return snapshot
 }
 
 // SetConfigName sets the name of the configuration.
@@ -87,12 +228,18 @@ func (c *ConfigSettings) SetConfigFullpath(fullPath string) *ConfigSettings {
 
 // GetChangesChan returns the channel for signaling configuration changes for the specified configuration name.
 func (c *ConfigList) GetChangesChan(configName string) chan string {
-	return c.settings[configName].Ch_ConfigChanged
+	settings, ok := c.getSettings(configName)
+	if !ok {
+		return nil
+	}
+	return settings.Ch_ConfigChanged
 }
 
-// SetReader sets the ConfigReader for reading the configuration.
-func (c *ConfigSettings) SetReader(reader reader.ConfigReader) *ConfigSettings {
+// SetReader sets the Reader for reading the configuration.
+// Readers that do not implement reader.Writer make the configuration read-only.
+func (c *ConfigSettings) SetReader(reader reader.Reader) *ConfigSettings {
 	c.Reader = reader
+	c.applySource()
 	return c
 }
 
@@ -108,74 +255,390 @@ func (c *ConfigSettings) SetRepeatSec(checkInterval int) *ConfigSettings {
 	return c
 }
 
-// setHash sets the last known hash of the configuration file.
+// SetHash sets the last known hash of the configuration file, computed with the Hasher of the configuration.
 func (c *ConfigSettings) SetHash(hash string) *ConfigSettings {
 	c.lastConfigHash = hash
 	return c
 }
 
+// SetJsonnetImportPaths sets the library search paths used when evaluating Jsonnet configurations.
+func (c *ConfigSettings) SetJsonnetImportPaths(paths ...string) *ConfigSettings {
+	c.jsonnetImportPaths = paths
+	if jsonnetReader, ok := c.Reader.(*reader.JsonnetConfigReader); ok {
+		jsonnetReader.ImportPaths = paths
+	}
+	return c
+}
+
+// SetJsonnetExtVars sets the external variables (std.extVar) used when evaluating Jsonnet configurations.
+func (c *ConfigSettings) SetJsonnetExtVars(extVars map[string]string) *ConfigSettings {
+	c.jsonnetExtVars = extVars
+	if jsonnetReader, ok := c.Reader.(*reader.JsonnetConfigReader); ok {
+		jsonnetReader.ExtVars = extVars
+	}
+	return c
+}
+
+// SetJsonnetEvaluator sets the evaluator of Jsonnet configurations. mkconf does not embed one, so Jsonnet
+// configurations fail to load until it is set, e.g. to reader.EvaluateJsonnetCommand to run the jsonnet
+// command-line tool.
+func (c *ConfigSettings) SetJsonnetEvaluator(evaluate reader.JsonnetEvaluateFunc) *ConfigSettings {
+	c.jsonnetEvaluate = evaluate
+	if jsonnetReader, ok := c.Reader.(*reader.JsonnetConfigReader); ok {
+		jsonnetReader.Evaluate = evaluate
+	}
+	return c
+}
+
+// SetCUEEvaluator sets the evaluator of CUE configurations. mkconf does not embed one, so CUE configurations fail
+// to load until it is set, e.g. to reader.EvaluateCUECommand to run the cue command-line tool.
+func (c *ConfigSettings) SetCUEEvaluator(evaluate reader.CUEEvaluateFunc) *ConfigSettings {
+	c.cueEvaluate = evaluate
+	if cueReader, ok := c.Reader.(*reader.CUEConfigReader); ok {
+		cueReader.Evaluate = evaluate
+	}
+	return c
+}
+
+// SetCharset sets the charset of the configuration file (e.g. "windows-1252", "utf-16le").
+// Files with a byte order mark are always decoded according to it. An empty charset restores automatic detection
+// (UTF-8 with optional BOM, or UTF-16). The charset only applies to this configuration, even if other configurations
+// or managers read the same file.
+func (c *ConfigSettings) SetCharset(charset string) error {
+	if charset != "" && !reader.CharsetSupported(charset) {
+		return fmt.Errorf("unsupported charset %q", charset)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.charset = charset
+	c.applySource()
+	return nil
+}
+
 // SetChangeTracking sets the flag to enable or disable change tracking for the configuration.
 func (c *ConfigSettings) SetChangeTracking(mode bool) *ConfigSettings {
 	c.enableChangeTracking = mode
 	return c
 }
 
+// SetLabels sets labels classifying the configuration, e.g. "critical", used to select configurations for notifications.
+func (c *ConfigSettings) SetLabels(labels ...string) *ConfigSettings {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.labels = append([]string(nil), labels...)
+	return c
+}
+
+// hasLabel reports whether the configuration is labeled with label.
+func (c *ConfigSettings) hasLabel(label string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return containsString(c.labels, label)
+}
+
+// changeValidationEnabled reports whether change monitoring is enabled for the configuration.
+func (c *ConfigSettings) changeValidationEnabled() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.enableChangeValidation
+}
+
+// changeTrackingEnabled reports whether change tracking is enabled for the configuration.
+func (c *ConfigSettings) changeTrackingEnabled() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.enableChangeTracking
+}
+
+// getConfig returns the current configuration instance.
+func (c *ConfigSettings) getConfig() interface{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.config
+}
+
 // LoadConfig loads the configuration with the specified name and populates the provided interface.
 // It automatically selects the appropriate reader based on the file type if the reader is not set.
 // It returns an error if the configuration cannot be loaded or if there is an issue with the reader.
+//
+// After the file is decoded, fields tagged with env are set from their environment variable, e.g.
+//
+//	Password string `yaml:"password" env:"DB_PASSWORD,required"`
+//	Port     int    `yaml:"port" env:"DB_PORT" envDefault:"5432"`
+//
+// A set variable overrides the value of the file. The envDefault value is used if the variable is not set and the
+// field is still zero after decoding, and the required flag fails the load if the variable is not set.
 func (c *ConfigList) LoadConfig(configName string, v interface{}) error {
-	if c.settings[configName].Reader == nil {
-		reader := c.settings[configName].checkReader()
+	settings, ok := c.getSettings(configName)
+	if !ok {
+		return fmt.Errorf("config with name %s not found", configName)
+	}
+
+	defer c.logPinChanges(settings)
+	defer c.logEnvChanges(settings)
+	settings.mu.Lock()
+	defer settings.mu.Unlock()
+
+	if settings.Reader == nil {
+		reader := settings.checkReader()
 		if reader == nil {
 			return fmt.Errorf("%v error while setting reader type - check your config file type", configName)
 		}
 
-		c.settings[configName].SetReader(reader)
+		settings.SetReader(reader)
+	}
+	if err := settings.checkCoercions(v); err != nil {
+		c.quarantineContent(settings, err)
+		return settings.loadFallback(v, fmt.Errorf("load config %v: %v", configName, err))
 	}
-	err := c.settings[configName].Reader.ReadConfig(c.settings[configName].configFullPath, v)
+	if err := settings.readInto(v); err != nil {
+		c.quarantineContent(settings, err)
+		return settings.loadFallback(v, fmt.Errorf("load config %v: %v", configName, err))
+	}
+	settings.rememberGoodContent()
+	settings.config = v
+	settings.recordHistory(v)
+	settings.refreshSnapshot(v)
+	return nil
+}
+
+// LoadConfigFromReader loads the configuration with the specified name from a stream (e.g. stdin or an HTTP body)
+// instead of its file, using the configuration's reader. Hooks are applied and v is only updated on success.
+// Returns an error if the configuration is not found or its reader does not implement reader.StreamReader.
+func (c *ConfigList) LoadConfigFromReader(configName string, r io.Reader, v interface{}) error {
+	settings, ok := c.getSettings(configName)
+	if !ok {
+		return fmt.Errorf("config with name %s not found", configName)
+	}
+
+	defer c.logPinChanges(settings)
+	defer c.logEnvChanges(settings)
+	settings.mu.Lock()
+	defer settings.mu.Unlock()
+
+	streamReader, ok := settings.Reader.(reader.StreamReader)
+	if !ok {
+		return fmt.Errorf("load config %v: reader does not support streams", configName)
+	}
+	apply, err := settings.decodeWith(func(target interface{}) error { return streamReader.ReadConfigFrom(r, target) }, v)
 	if err != nil {
-		return fmt.Errorf("load config %v: error while read config: %v", configName, err)
+		return fmt.Errorf("load config %v: %v", configName, err)
 	}
-	c.settings[configName].config = v
+	apply()
+	settings.config = v
+	settings.recordHistory(v)
+	settings.refreshSnapshot(v)
 	return nil
 }
 
+// readInto decodes the configuration file into a copy of v, applies the hooks and copies the result into v
+// only if everything succeeded, so a broken file never leaves v partially updated.
+func (c *ConfigSettings) readInto(v interface{}) error {
+	apply, err := c.decodeSnapshot(v)
+	if err != nil {
+		return err
+	}
+	apply()
+	return nil
+}
+
+// decodeSnapshot decodes the configuration file into a copy of v and applies the hooks without modifying v.
+// The returned function copies the decoded snapshot into v.
+func (c *ConfigSettings) decodeSnapshot(v interface{}) (func(), error) {
+	return c.decodeFile(c.configFullPath, v)
+}
+
+// decodeFile decodes the named file with the configuration's reader into a copy of v and applies the hooks
+// without modifying v. The returned function copies the decoded snapshot into v.
+func (c *ConfigSettings) decodeFile(filename string, v interface{}) (func(), error) {
+	return c.decodeWith(func(target interface{}) error { return c.Reader.ReadConfig(filename, target) }, v)
+}
+
+// decodeContent decodes content read from the named file into a copy of v and applies the hooks without modifying v,
+// like decodeFile, see contentReader. The returned function copies the decoded snapshot into v.
+func (c *ConfigSettings) decodeContent(filename string, content []byte, v interface{}) (func(), error) {
+	return c.decodeWith(c.contentReader(filename, content), v)
+}
+
+// decodeContentValue is like decodeContent, but also returns the decoded snapshot before it is copied into v.
+func (c *ConfigSettings) decodeContentValue(filename string, content []byte, v interface{}) (func(), interface{}, error) {
+	return c.decodeValue(c.contentReader(filename, content), v)
+}
+
+// contentReader returns a function decoding content read from the named file into a target with the configuration's
+// reader. The content is passed to the reader as a stream, so it is decoded as read, whatever file system it comes
+// from. Readers not implementing reader.StreamReader read the file instead, as do the Jsonnet and CUE readers for
+// files on the OS file system, which they evaluate in place for relative imports.
+func (c *ConfigSettings) contentReader(filename string, content []byte) func(target interface{}) error {
+	streamReader, ok := c.Reader.(reader.StreamReader)
+	if !ok || c.evaluatesFile() {
+		return func(target interface{}) error { return c.Reader.ReadConfig(filename, target) }
+	}
+	return func(target interface{}) error {
+		decompressed, err := reader.Decompress(filename, content)
+		if err != nil {
+			return err
+		}
+		return streamReader.ReadConfigFrom(bytes.NewReader(decompressed), target)
+	}
+}
+
+// evaluatesFile reports whether the reader of the configuration evaluates its file in place, see contentReader.
+func (c *ConfigSettings) evaluatesFile() bool {
+	switch c.Reader.(type) {
+	case *reader.JsonnetConfigReader, *reader.CUEConfigReader:
+		return c.fsys == nil
+	}
+	return false
+}
+
+// decodeWith decodes into a copy of v using read and applies the hooks without modifying v.
+// The returned function copies the decoded snapshot into v.
+func (c *ConfigSettings) decodeWith(read func(target interface{}) error, v interface{}) (func(), error) {
+	apply, _, err := c.decodeValue(read, v)
+	return apply, err
+}
+
+// decodeValue is like decodeWith, but also returns the decoded snapshot. Values that cannot be decoded into a copy,
+// such as a map held by value, are decoded in place; the snapshot is then v itself.
+func (c *ConfigSettings) decodeValue(read func(target interface{}) error, v interface{}) (func(), interface{}, error) {
+	target := reflect.ValueOf(v)
+	for target.Kind() == reflect.Ptr && !target.IsNil() &&
+		(target.Elem().Kind() == reflect.Ptr || target.Elem().Kind() == reflect.Interface) {
+		target = target.Elem()
+		if target.Kind() == reflect.Interface {
+			target = target.Elem()
+		}
+	}
+
+	if target.Kind() != reflect.Ptr || target.IsNil() {
+		if err := read(v); err != nil {
+			return nil, nil, fmt.Errorf("error while read config: %v", err)
+		}
+		ignored, err := c.restorePins(v)
+		if err != nil {
+			return nil, nil, err
+		}
+		overrides, err := c.applyEnvOverrides(v)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := c.validateEnums(v); err != nil {
+			return nil, nil, err
+		}
+		return func() {
+			c.recordPinned(ignored)
+			c.recordEnvOverrides(overrides)
+		}, v, c.applyHooks(v)
+	}
+
+	fresh := reflect.New(target.Elem().Type())
+	if target.Elem().Kind() != reflect.Map {
+		// Maps are decoded from scratch, so removed keys disappear and the current map is never mutated.
+		fresh.Elem().Set(target.Elem())
+	}
+	if err := read(fresh.Interface()); err != nil {
+		return nil, nil, fmt.Errorf("error while read config: %v", err)
+	}
+	ignored, err := c.restorePins(fresh.Interface())
+	if err != nil {
+		return nil, nil, err
+	}
+	overrides, err := c.applyEnvOverrides(fresh.Interface())
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := c.validateEnums(fresh.Interface()); err != nil {
+		return nil, nil, err
+	}
+	if err := c.applyHooks(fresh.Interface()); err != nil {
+		return nil, nil, err
+	}
+
+	return func() {
+		target.Elem().Set(fresh.Elem())
+		c.recordPinned(ignored)
+		c.recordEnvOverrides(overrides)
+	}, fresh.Interface(), nil
+}
+
 // UpdateConfig updates the configuration with the specified name by applying changes from the provided interface.
 // It first stops the change monitoring, performs the update, and then restarts the change monitoring.
 // It returns an error if the update fails or if the reader is not set for the configuration.
 func (c *ConfigList) UpdateConfig(configName string, v interface{}) error {
-	c.settingsMutex.Lock()
-	defer c.settingsMutex.Unlock()
+	return c.updateConfig(configName, v, nil, nil)
+}
 
-	settings, ok := c.settings[configName]
+// updateConfig writes v to the configuration file like UpdateConfig. If edit is set, it is called once monitoring
+// is stopped, before v is written, so edits of v are not overwritten by a concurrent reload. If afterWrite is set,
+// it is called after the file is written and before the configuration is reloaded, e.g. to annotate the file.
+func (c *ConfigList) updateConfig(configName string, v interface{}, edit func() error, afterWrite func(settings *ConfigSettings) error) error {
+	settings, ok := c.getSettings(configName)
 	if !ok {
 		return fmt.Errorf("config with name %s not found", configName)
 	}
 
-	if settings.Reader == nil {
+	settings.mu.Lock()
+	configReader := settings.Reader
+	parent := settings.monitorParent
+	settings.mu.Unlock()
+	if configReader == nil {
 		return fmt.Errorf("reader not set for config %s", configName)
 	}
+	configWriter, ok := configReader.(reader.Writer)
+	if !ok || !settings.source().IsWritable() {
+		return fmt.Errorf("update config %s: %w", configName, ErrReadOnlySource)
+	}
 
+	// Monitoring tied to the context of a caller stays tied to it when restarted.
+	if parent == nil {
+		parent = context.Background()
+	}
 	c.StopChangeMonitoring(configName)
-	defer c.StartChangeMonitoring(configName, v)
+	defer c.StartChangeMonitoringContext(parent, configName, v)
 
-	err := settings.Reader.UpdateConfig(settings.configFullPath, v)
-	if err != nil {
-		return fmt.Errorf("update config %s: %v", configName, err)
+	if edit != nil {
+		if err := edit(); err != nil {
+			return err
+		}
+	}
+	err := configWriter.UpdateConfig(settings.configFullPath, v)
+	if errors.Is(err, reader.ErrRewritten) {
+		// The values are written, only the formatting of the file is lost.
+		c.reportError(fmt.Errorf("update config %s: %w", configName, err))
+	} else if err != nil {
+		return fmt.Errorf("update config %s: %w", configName, err)
+	}
+	if afterWrite != nil {
+		if err := afterWrite(settings); err != nil {
+			return fmt.Errorf("update config %s: %v", configName, err)
+		}
 	}
 
-	err = c.LoadConfig(configName, settings.config)
+	settings.mu.Lock()
+	config := settings.config
+	settings.mu.Unlock()
+
+	err = c.LoadConfig(configName, config)
 	if err != nil {
 		return fmt.Errorf("reload config %s: %v", configName, err)
 	}
 
+	if err := c.writeDualFile(settings, v); err != nil {
+		return fmt.Errorf("update config %s: %v", configName, err)
+	}
 	return nil
 }
 
 // checkReader selects a ConfigReader based on the file type and returns it.
+// Readers registered with RegisterReader take precedence over the built-in ones.
 // It is used to automatically set the reader if it is not explicitly provided.
-func (s *ConfigSettings) checkReader() reader.ConfigReader {
+func (s *ConfigSettings) checkReader() reader.Reader {
 	_type := strings.ToLower(s.configType)
+	_type = strings.TrimSuffix(_type, reader.CompressionExt(_type))
+	if factory, ok := registeredReader(_type); ok {
+		return factory()
+	}
 	switch _type {
 	case ".json", ".mk.json":
 		return &reader.JSONConfigReader{}
@@ -187,6 +650,12 @@ func (s *ConfigSettings) checkReader() reader.ConfigReader {
 		return &reader.TOMLConfigReader{}
 	case ".ini", ".mk.ini":
 		return &reader.INIConfigReader{}
+	case ".plist", ".mk.plist":
+		return &reader.PlistConfigReader{}
+	case ".cue", ".mk.cue":
+		return &reader.CUEConfigReader{Evaluate: s.cueEvaluate}
+	case ".jsonnet", ".mk.jsonnet":
+		return &reader.JsonnetConfigReader{ImportPaths: s.jsonnetImportPaths, ExtVars: s.jsonnetExtVars, Evaluate: s.jsonnetEvaluate}
 	default:
 		return nil
 	}
@@ -196,11 +665,17 @@ func (s *ConfigSettings) checkReader() reader.ConfigReader {
 // It initializes the configuration settings, including channels and readers, and calculates the initial hash.
 // Returns an error if there's an issue adding the new configuration.
 func (c *ConfigList) AddConfigList(configName, configPath, configType string, v interface{}) error {
+	return c.addConfigList(nil, configName, configPath, configType, v)
+}
+
+// addConfigList adds a new configuration read from the given file system, or the OS file system if fsys is nil.
+func (c *ConfigList) addConfigList(fsys fs.FS, configName, configPath, configType string, v interface{}) error {
 	var err error
-	settings := ConfigSettings{
+	settings := &ConfigSettings{
 		configName:             configName,
 		configPath:             configPath,
 		configType:             configType,
+		fsys:                   fsys,
 		enableChangeValidation: false,
 		enableChangeTracking:   false,
 		checkSec:               1,
@@ -208,17 +683,40 @@ func (c *ConfigList) AddConfigList(configName, configPath, configType string, v
 		ch_ChangeValidation:    make(chan struct{}),
 		Ch_ConfigChanged:       make(chan string),
 		Ch_ConfigTracking:      make(chan string),
-		waitGroup:              new(sync.WaitGroup),
+		ch_ConfigEvents:        make(chan ChangeEvent),
+		errorFunc:              c.reportError,
 	}
-	c.changeLogs = map[string][]ConfigChangeLog{}
-	c.settings[configName] = &settings
 	fullConfigName := configName + configType
 	fullPath := filepath.Join(configPath, fullConfigName)
-	c.settings[configName].SetConfigPath(configPath).SetConfigFullpath(fullPath).defineReader()
-	err = c.settings[configName].defineHash(v)
+	settings.SetConfigPath(configPath).SetConfigFullpath(fullPath).defineReader()
+
+	c.settingsMutex.Lock()
+	contentSniffing := c.contentSniffing
+	if c.stateDir != "" {
+		settings.lastGoodPath = filepath.Join(c.stateDir, fullConfigName)
+	}
+	if c.historyDir != "" {
+		settings.historyPath = historyPath(c.historyDir, configName)
+	}
+	if _, remote := fsys.(remoteSource); remote && c.remoteCacheDir != "" {
+		settings.lastGoodPath = filepath.Join(c.remoteCacheDir, fullConfigName)
+		settings.staleTTL = c.remoteCacheTTL
+	}
+	settings.startupPolicy = c.startupPolicyFor(configName)
+	settings.envOverrides = c.envOverrides
+	c.settingsMutex.Unlock()
+	if settings.Reader == nil && contentSniffing {
+		settings.sniffReader()
+	}
+
+	err = settings.initialize(v)
 	if err != nil {
 		return fmt.Errorf("mkconf: error add new config %v: %v", configName, err)
 	}
+
+	c.settingsMutex.Lock()
+	defer c.settingsMutex.Unlock()
+	c.settings[configName] = settings
 	return nil
 }
 
@@ -230,7 +728,12 @@ func (c *ConfigSettings) defineHash(v interface{}) error {
 	if err != nil {
 		return fmt.Errorf("error calculate hash: %v", err)
 	}
-	configMap, _ := c.convertToMap(c.configFullPath)
+	configMap, err := c.convertToMap(c.configFullPath)
+	if err == nil {
+		if content, err := c.source().ReadSourceFile(c.configFullPath); err == nil {
+			c.lastGoodContent = content
+		}
+	}
 	c.config = &v
 	c.configMAP = configMap
 	return nil
@@ -240,30 +743,50 @@ func (c *ConfigSettings) defineHash(v interface{}) error {
 // It returns the updated ConfigSettings instance.
 func (c *ConfigSettings) defineReader() *ConfigSettings {
 	c.Reader = c.checkReader()
+	c.applySource()
 	return c
 }
 
+// source describes how the reader of the configuration reads and writes its file.
+func (c *ConfigSettings) source() reader.Source {
+	return reader.Source{FS: c.fsys, Charset: c.charset}
+}
+
+// applySource passes the source of the configuration to its reader, if it is a reader.SourceReader.
+func (c *ConfigSettings) applySource() {
+	if sourceReader, ok := c.Reader.(reader.SourceReader); ok {
+		sourceReader.SetSource(c.source())
+	}
+}
+
 // convertToMap converts the configuration file to a map based on its type using the appropriate reader.
 // It returns the map representation of the configuration file and an error if there's an issue.
 func (c *ConfigSettings) convertToMap(fullPath string) (map[string]interface{}, error) {
-	tmp := make(map[string]interface{})
-	var err error
+	if c.Reader == nil {
+		return nil, fmt.Errorf("unsupported ConfigReader type - %v", c.Reader)
+	}
 
-	switch reader := c.Reader.(type) {
-	case *reader.JSONConfigReader:
-		tmp, err = reader.ReadConfigToMap(fullPath)
-	case *reader.XMLConfigReader:
-		tmp, err = reader.ReadConfigToMap(fullPath)
-	case *reader.YAMLConfigReader:
-		tmp, err = reader.ReadConfigToMap(fullPath)
-	case *reader.TOMLConfigReader:
-		tmp, err = reader.ReadConfigToMap(fullPath)
-	case *reader.INIConfigReader:
-		tmp, err = reader.ReadConfigToMap(fullPath)
-	default:
-		return nil, fmt.Errorf("unsupported ConfigReader type - %v", reader)
+	tmp, err := c.Reader.ReadConfigToMap(fullPath)
+	if err != nil {
+		return nil, fmt.Errorf("error converting config to map: %v", err)
 	}
 
+	return tmp, nil
+}
+
+// contentToMap converts content read from the named file to a map like convertToMap, passing it to the reader as
+// a stream like contentReader. Readers not implementing reader.StreamMapReader read the file instead.
+func (c *ConfigSettings) contentToMap(filename string, content []byte) (map[string]interface{}, error) {
+	mapReader, ok := c.Reader.(reader.StreamMapReader)
+	if !ok || c.evaluatesFile() {
+		return c.convertToMap(filename)
+	}
+
+	decompressed, err := reader.Decompress(filename, content)
+	if err != nil {
+		return nil, fmt.Errorf("error converting config to map: %v", err)
+	}
+	tmp, err := mapReader.ReadConfigToMapFrom(bytes.NewReader(decompressed))
 	if err != nil {
 		return nil, fmt.Errorf("error converting config to map: %v", err)
 	}
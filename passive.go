@@ -0,0 +1,66 @@
+package mkconf
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrPassiveMode is returned when starting change monitoring in passive mode, see SetPassive.
+var ErrPassiveMode = errors.New("change monitoring is disabled in passive mode")
+
+// SetPassive enables or disables passive mode, for serverless functions, cron jobs and other short-lived binaries
+// that must not leave goroutines behind. In passive mode the manager runs no watcher goroutines: running change
+// monitoring is stopped, StartChangeMonitoring fails with ErrPassiveMode, and UpdateConfig and Set do not restart
+// monitoring. The application checks for changes itself with CheckOnce, e.g. from its own ticker or at the start of
+// each request. Sources with StartWatching and WatchForChanges still start goroutines when called.
+func (cm *ConfigManager) SetPassive(enabled bool) {
+	cm.configList.settingsMutex.Lock()
+	cm.configList.passive = enabled
+	cm.configList.settingsMutex.Unlock()
+	if enabled {
+		cm.StopAllChangeMonitoring()
+	}
+}
+
+// CheckOnce checks the specified configuration for changes once, on the calling goroutine, and applies them like
+// change monitoring does, whether or not monitoring is running. It returns whether a change was applied. Changes
+// are recorded in the change log if change tracking is enabled, and the change and tracking callbacks and the event
+// listeners of the configuration are called on the calling goroutine instead of notifying the channels, so no
+// WatchForChanges goroutine is needed; in CallbackAsync mode, the change callback and event listeners run on the
+// worker pool, and in CallbackSync mode, before the change is applied.
+func (cm *ConfigManager) CheckOnce(configName string) (bool, error) {
+	configInterface, err := cm.GetConfig(configName)
+	if err != nil {
+		return false, err
+	}
+	settings, ok := cm.configList.getSettings(configName)
+	if !ok {
+		return false, fmt.Errorf("config with name %s not found", configName)
+	}
+
+	changed, tracking, event, err := cm.configList.applyConfigChanges(settings, configInterface, true)
+	if err != nil || !changed {
+		return false, err
+	}
+
+	cm.mu.RLock()
+	changeCallback, trackCallback := cm.changeCallbacks[configName], cm.trackCallback[configName]
+	cm.mu.RUnlock()
+	if tracking {
+		cm.configList.recordChanges(configName, event.Changes)
+		if trackCallback != nil {
+			call := CallbackCall{ConfigName: configName, Kind: CallbackKindTracking, Event: &event}
+			cm.callCallback(call, func() { trackCallback(configName) })
+		}
+	}
+	if event.delivered() {
+		// In CallbackSync mode, the change callback and event listeners ran before the change was applied.
+		return true, nil
+	}
+	if changeCallback != nil {
+		call := CallbackCall{ConfigName: configName, Kind: CallbackKindChange, Event: &event}
+		cm.runCallback(settings, call, func() { changeCallback(configName) })
+	}
+	cm.publishEvent(event)
+	return true, nil
+}
@@ -0,0 +1,262 @@
+package mkconf
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// RejectPinned is the reason code of changes of pinned values ignored on reload, recorded in ConfigChangeLog.Reason.
+const RejectPinned = "pinned"
+
+// ErrPinnedChange is wrapped by the warnings reported through the function set with SetErrorFunc for changes of
+// pinned values ignored on reload.
+var ErrPinnedChange = errors.New("ignored change of pinned value")
+
+// Pin freezes the value at the dot-separated key path (e.g. "payments.provider") of a loaded configuration, for
+// example during an incident freeze. Keys are matched like in Set. Until Unpin is called, reloads keep the pinned
+// value whatever the file says: an ignored change is reported as an error wrapping ErrPinnedChange to the function
+// set with SetErrorFunc and, with change tracking, recorded in the change log with the reason RejectPinned, once per
+// ignored value. Set fails on pinned values and the values below them.
+// Pinning a value already pinned keeps the value it was pinned with.
+func (cm *ConfigManager) Pin(configName, key string) error {
+	configInterface, err := cm.GetConfig(configName)
+	if err != nil {
+		return err
+	}
+	settings, ok := cm.configList.getSettings(configName)
+	if !ok {
+		return fmt.Errorf("config with name %s not found", configName)
+	}
+
+	settings.mu.Lock()
+	defer settings.mu.Unlock()
+	if _, ok := settings.pins[key]; ok {
+		return nil
+	}
+	value, err := getPath(reflect.ValueOf(configInterface), strings.Split(key, "."))
+	if err != nil {
+		return fmt.Errorf("pin %v in config %v: %v", key, configName, err)
+	}
+	if settings.pins == nil {
+		settings.pins = make(map[string]interface{})
+	}
+	// The pin keeps its own copy, so later changes of the maps and slices of the configuration do not reach it.
+	settings.pins[key] = copyInterface(value.Interface())
+	return nil
+}
+
+// Unpin releases a value pinned with Pin and reloads the configuration, so the value of the file applies again.
+func (cm *ConfigManager) Unpin(configName, key string) error {
+	settings, ok := cm.configList.getSettings(configName)
+	if !ok {
+		return fmt.Errorf("config with name %s not found", configName)
+	}
+
+	settings.mu.Lock()
+	_, pinned := settings.pins[key]
+	delete(settings.pins, key)
+	delete(settings.pinIgnored, key)
+	settings.mu.Unlock()
+	if !pinned {
+		return fmt.Errorf("unpin %v in config %v: not pinned", key, configName)
+	}
+	return cm.LoadConfig(configName)
+}
+
+// Pinned returns the sorted key paths pinned in a configuration.
+func (cm *ConfigManager) Pinned(configName string) []string {
+	settings, ok := cm.configList.getSettings(configName)
+	if !ok {
+		return nil
+	}
+
+	settings.mu.Lock()
+	defer settings.mu.Unlock()
+	keys := make([]string, 0, len(settings.pins))
+	for key := range settings.pins {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// pinFor returns the pinned key path that key is, or is below or above, if any. The caller must hold c.mu.
+func (c *ConfigSettings) pinFor(key string) (string, bool) {
+	for pin := range c.pins {
+		if key == pin || strings.HasPrefix(key, pin+".") || strings.HasPrefix(pin, key+".") {
+			return pin, true
+		}
+	}
+	return "", false
+}
+
+// restorePins stores the pinned values in the freshly decoded v and returns the changes of the file it ignored.
+// The caller must hold c.mu.
+func (c *ConfigSettings) restorePins(v interface{}) ([]ConfigChangeLog, error) {
+	var ignored []ConfigChangeLog
+	for key, pinned := range c.pins {
+		path := strings.Split(key, ".")
+		var decoded interface{}
+		if value, err := getPath(reflect.ValueOf(v), path); err == nil {
+			decoded = value.Interface()
+		}
+		if reflect.DeepEqual(decoded, pinned) {
+			continue
+		}
+		if err := setPath(reflect.ValueOf(v), path, copyInterface(pinned)); err != nil {
+			return nil, fmt.Errorf("restore pinned %v: %v", key, err)
+		}
+		ignored = append(ignored, ConfigChangeLog{FieldName: key, OldValue: pinned, NewValue: decoded, Reason: RejectPinned})
+	}
+	sort.Slice(ignored, func(i, j int) bool { return ignored[i].FieldName < ignored[j].FieldName })
+	return ignored, nil
+}
+
+// recordPinned reports the ignored changes of pinned values not reported before. The caller must hold c.mu.
+func (c *ConfigSettings) recordPinned(ignored []ConfigChangeLog) {
+	now := time.Now()
+	for key := range c.pinIgnored {
+		if !containsChange(ignored, key) {
+			delete(c.pinIgnored, key)
+		}
+	}
+	for _, change := range ignored {
+		if previous, ok := c.pinIgnored[change.FieldName]; ok && reflect.DeepEqual(previous, change.NewValue) {
+			continue
+		}
+		if c.pinIgnored == nil {
+			c.pinIgnored = make(map[string]interface{})
+		}
+		c.pinIgnored[change.FieldName] = change.NewValue
+
+		change.ConfigName, change.Timestamp = c.configName, now
+		changes := []ConfigChangeLog{change}
+		c.redactChanges(changes)
+		c.reportError(fmt.Errorf("%w: %v of config %v to %v", ErrPinnedChange, change.FieldName, c.configName, changes[0].NewValue))
+		if c.enableChangeTracking {
+			c.pinChanges = append(c.pinChanges, changes...)
+		}
+	}
+}
+
+// takePinChanges returns and clears the recorded ignored changes of pinned values. The caller must hold c.mu.
+func (c *ConfigSettings) takePinChanges() []ConfigChangeLog {
+	changes := c.pinChanges
+	c.pinChanges = nil
+	return changes
+}
+
+// logPinChanges adds the recorded ignored changes of pinned values of a configuration to its change log.
+// The tracking channel is not notified, as the changes come with a load requested by the caller.
+func (c *ConfigList) logPinChanges(settings *ConfigSettings) {
+	settings.mu.Lock()
+	changes := settings.takePinChanges()
+	settings.mu.Unlock()
+	if len(changes) > 0 {
+		c.recordChanges(settings.configName, changes)
+	}
+}
+
+// containsChange reports whether changes hold a change of the field at key.
+func containsChange(changes []ConfigChangeLog, key string) bool {
+	for _, change := range changes {
+		if change.FieldName == key {
+			return true
+		}
+	}
+	return false
+}
+
+// pinMap stores the pinned values of oldMap in newMap, the map representations of the configuration, so the
+// changes of pinned values are not tracked as applied. The caller must hold c.mu.
+func (c *ConfigSettings) pinMap(oldMap, newMap map[string]interface{}) {
+	for key := range c.pins {
+		path := strings.Split(key, ".")
+		oldParent, newParent := oldMap, newMap
+		for _, name := range path[:len(path)-1] {
+			oldNested, oldOK := oldParent[name].(map[string]interface{})
+			newNested, newOK := newParent[name].(map[string]interface{})
+			if !oldOK || !newOK {
+				oldParent = nil
+				break
+			}
+			oldParent, newParent = oldNested, newNested
+		}
+		if oldParent == nil {
+			continue
+		}
+		last := path[len(path)-1]
+		if value, ok := oldParent[last]; ok {
+			newParent[last] = value
+		} else {
+			delete(newParent, last)
+		}
+	}
+}
+
+// copyInterface returns a deep copy of value, which shares no maps, slices or pointers with it.
+func copyInterface(value interface{}) interface{} {
+	if value == nil {
+		return nil
+	}
+	return copyValue(reflect.ValueOf(value)).Interface()
+}
+
+// copyValue returns a deep copy of v. Unexported struct fields are copied shallowly.
+func copyValue(v reflect.Value) reflect.Value {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return v
+		}
+		copied := reflect.New(v.Elem().Type())
+		copied.Elem().Set(copyValue(v.Elem()))
+		return copied
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+		copied := reflect.New(v.Type()).Elem()
+		copied.Set(copyValue(v.Elem()))
+		return copied
+	case reflect.Map:
+		if v.IsNil() {
+			return v
+		}
+		copied := reflect.MakeMapWithSize(v.Type(), v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			copied.SetMapIndex(iter.Key(), copyValue(iter.Value()))
+		}
+		return copied
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		copied := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			copied.Index(i).Set(copyValue(v.Index(i)))
+		}
+		return copied
+	case reflect.Array:
+		copied := reflect.New(v.Type()).Elem()
+		for i := 0; i < v.Len(); i++ {
+			copied.Index(i).Set(copyValue(v.Index(i)))
+		}
+		return copied
+	case reflect.Struct:
+		copied := reflect.New(v.Type()).Elem()
+		copied.Set(v)
+		for i := 0; i < v.NumField(); i++ {
+			if copied.Field(i).CanSet() {
+				copied.Field(i).Set(copyValue(v.Field(i)))
+			}
+		}
+		return copied
+	}
+	return v
+}
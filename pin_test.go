@@ -0,0 +1,86 @@
+package mkconf
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+type pinConfig struct {
+	Limits map[string]int `json:"limits"`
+	Hosts  []string       `json:"hosts"`
+}
+
+func TestPinKeepsOwnCopy(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "pinned.json")
+	if err := os.WriteFile(path, []byte(`{"limits": {"rps": 10}, "hosts": ["a", "b"]}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	config := &pinConfig{}
+	var reported []error
+	cm := NewConfigManager()
+	cm.SetErrorFunc(func(err error) { reported = append(reported, err) })
+	if err := cm.AddConfig("pinned", dir, ".json", config); err != nil {
+		t.Fatalf("AddConfig: %v", err)
+	}
+	if err := cm.LoadConfig("pinned"); err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	cm.GetSettings("pinned").SetChangeTracking(true)
+	for _, key := range []string{"limits", "hosts"} {
+		if err := cm.Pin("pinned", key); err != nil {
+			t.Fatalf("Pin %v: %v", key, err)
+		}
+	}
+
+	// Changes of the maps and slices of the configuration do not reach the pinned values.
+	config.Limits["rps"] = 99
+	config.Hosts[0] = "changed"
+	if err := os.WriteFile(path, []byte(`{"limits": {"rps": 20}, "hosts": ["c"]}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := cm.LoadConfig("pinned"); err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	want := pinConfig{Limits: map[string]int{"rps": 10}, Hosts: []string{"a", "b"}}
+	if !reflect.DeepEqual(*config, want) {
+		t.Fatalf("config after reload = %+v, want the pinned values %+v", *config, want)
+	}
+
+	// The restored values are copies too, so the next reload restores the pinned values again.
+	config.Limits["rps"] = 99
+	if err := cm.LoadConfig("pinned"); err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	if config.Limits["rps"] != 10 {
+		t.Fatalf("limits.rps after second reload = %v, want 10", config.Limits["rps"])
+	}
+
+	var ignored []string
+	for _, change := range cm.GetChangesForConfig("pinned") {
+		if change.Reason == RejectPinned {
+			ignored = append(ignored, change.FieldName)
+		}
+	}
+	if !reflect.DeepEqual(ignored, []string{"hosts", "limits"}) {
+		t.Fatalf("ignored changes in the change log = %v, want [hosts limits]", ignored)
+	}
+	// Each ignored value is reported once, although the second reload ignored the pinned limits again.
+	if len(reported) != 2 {
+		t.Fatalf("reported %v, want the ignored changes of hosts and limits", reported)
+	}
+	for _, err := range reported {
+		if !errors.Is(err, ErrPinnedChange) {
+			t.Fatalf("reported %v, want an error wrapping ErrPinnedChange", err)
+		}
+	}
+	settings := cm.GetSettings("pinned")
+	settings.mu.Lock()
+	defer settings.mu.Unlock()
+	if len(settings.envChanges) != 0 || len(settings.pinChanges) != 0 {
+		t.Fatalf("got %d env and %d pin changes left after the load, want none", len(settings.envChanges), len(settings.pinChanges))
+	}
+}
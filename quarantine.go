@@ -0,0 +1,105 @@
+package mkconf
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// maxQuarantineEntries is the number of quarantined contents kept in memory per configuration.
+const maxQuarantineEntries = 10
+
+// QuarantineEntry holds configuration content that failed to parse or validate.
+type QuarantineEntry struct {
+	ConfigName string    // Name of the configuration
+	Timestamp  time.Time // Time the content was rejected
+	Content    []byte    // Rejected file content
+	Error      string    // Reason the content was rejected
+	Diff       string    // Line diff between the last applied content and the rejected content
+}
+
+// SetQuarantineDir sets a directory where rejected contents are additionally persisted,
+// so they can be inspected after the file was fixed or the process restarted. Errors persisting
+// them are passed to the function set with SetErrorFunc.
+func (cm *ConfigManager) SetQuarantineDir(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("quarantine: %v", err)
+	}
+	cm.configList.quarantineMutex.Lock()
+	defer cm.configList.quarantineMutex.Unlock()
+	cm.configList.quarantineDir = dir
+	return nil
+}
+
+// GetQuarantine returns the rejected contents of the specified configuration, oldest first.
+func (cm *ConfigManager) GetQuarantine(configName string) []QuarantineEntry {
+	cm.configList.quarantineMutex.Lock()
+	defer cm.configList.quarantineMutex.Unlock()
+	return append([]QuarantineEntry(nil), cm.configList.quarantine[configName]...)
+}
+
+// ClearQuarantine removes the in-memory quarantine entries of the specified configuration.
+func (cm *ConfigManager) ClearQuarantine(configName string) {
+	cm.configList.quarantineMutex.Lock()
+	defer cm.configList.quarantineMutex.Unlock()
+	delete(cm.configList.quarantine, configName)
+}
+
+// quarantineContent stores the current file content of the configuration together with the cause of its rejection,
+// see quarantine. The caller must hold settings.mu.
+func (c *ConfigList) quarantineContent(settings *ConfigSettings, cause error) {
+	content, err := settings.source().ReadSourceFile(settings.configFullPath)
+	if err != nil {
+		return
+	}
+	c.quarantineRejected(settings, content, cause)
+}
+
+// quarantineRejected stores content read from the file of the configuration together with the cause of its rejection.
+// Repeated failures for the same content are recorded once. The caller must hold settings.mu.
+func (c *ConfigList) quarantineRejected(settings *ConfigSettings, content []byte, cause error) {
+	c.quarantineMutex.Lock()
+	defer c.quarantineMutex.Unlock()
+
+	entries := c.quarantine[settings.configName]
+	if len(entries) > 0 && bytes.Equal(entries[len(entries)-1].Content, content) {
+		return
+	}
+
+	entry := QuarantineEntry{
+		ConfigName: settings.configName,
+		Timestamp:  time.Now(),
+		Content:    content,
+		Error:      cause.Error(),
+		Diff:       lineDiff(string(settings.lastGoodContent), string(content)),
+	}
+	if redactor, ok := settings.fsys.(configRedactor); ok {
+		entry.Content = []byte(redactor.redactText(string(content)))
+		entry.Diff = redactor.redactText(entry.Diff)
+	}
+	entries = append(entries, entry)
+	if len(entries) > maxQuarantineEntries {
+		entries = entries[len(entries)-maxQuarantineEntries:]
+	}
+	if c.quarantine == nil {
+		c.quarantine = make(map[string][]QuarantineEntry)
+	}
+	c.quarantine[settings.configName] = entries
+
+	if c.quarantineDir != "" {
+		base := filepath.Join(c.quarantineDir, strings.ReplaceAll(settings.configName, string(filepath.Separator), "_")+
+			"."+entry.Timestamp.Format("20060102T150405.000000000"))
+		if err := ioutil.WriteFile(base+".content", content, 0600); err != nil {
+			c.reportError(fmt.Errorf("quarantine: error persisting config %v: %w", settings.configName, err))
+			return
+		}
+		report := fmt.Sprintf("config: %v\ntime: %v\nerror: %v\n\n%v", entry.ConfigName, entry.Timestamp.Format(time.RFC3339), entry.Error, entry.Diff)
+		if err := ioutil.WriteFile(base+".report", []byte(report), 0600); err != nil {
+			c.reportError(fmt.Errorf("quarantine: error persisting config %v: %w", settings.configName, err))
+		}
+	}
+}
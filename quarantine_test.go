@@ -0,0 +1,38 @@
+package mkconf
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestQuarantinePersistErrorReportedThroughErrorFunc(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "broken.json"), []byte(`{"version": `), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var reported []error
+	cm := NewConfigManager()
+	cm.SetErrorFunc(func(err error) { reported = append(reported, err) })
+	quarantineDir := filepath.Join(dir, "quarantine")
+	if err := cm.SetQuarantineDir(quarantineDir); err != nil {
+		t.Fatalf("SetQuarantineDir: %v", err)
+	}
+	if err := os.Remove(quarantineDir); err != nil {
+		t.Fatal(err)
+	}
+	if err := cm.AddConfig("broken", dir, ".json", &stressConfig{}); err != nil {
+		t.Fatalf("AddConfig: %v", err)
+	}
+	if err := cm.LoadConfig("broken"); err == nil {
+		t.Fatal("LoadConfig of broken content succeeded")
+	}
+
+	if len(cm.GetQuarantine("broken")) != 1 {
+		t.Fatalf("quarantine %v, want the broken content", cm.GetQuarantine("broken"))
+	}
+	if len(reported) != 1 || !strings.Contains(reported[0].Error(), "quarantine: error persisting config broken") {
+		t.Fatalf("reported %v, want the error persisting the quarantined content", reported)
+	}
+}
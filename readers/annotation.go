@@ -0,0 +1,166 @@
+package readers
+
+import (
+	"reflect"
+	"strings"
+)
+
+// annotationMarker starts the comments written by AnnotateEntry, so a later annotation replaces an earlier one.
+const annotationMarker = "mkconf:"
+
+// AnnotateEntry writes the comment "mkconf: <note>" on the line above the entry at path of a YAML, TOML or INI
+// configuration file, replacing an annotation written earlier. configType selects the format. It reports whether
+// the entry was annotated: other formats cannot hold comments, and entries that are not found are left unchanged.
+// The path of an INI entry is its (dotted) section and key, or just the key in the default section. The file is
+// read as described by source.
+func AnnotateEntry(source Source, filename, configType string, path []string, note string) (bool, error) {
+	locate, prefix := annotationFormat(configType)
+	if locate == nil {
+		return false, nil
+	}
+
+	content, err := source.readFile(filename)
+	if err != nil {
+		return false, err
+	}
+	lines := strings.Split(string(content), "\n")
+	line, ok := locate(lines, path)
+	if !ok {
+		return false, nil
+	}
+
+	indent := lines[line][:len(lines[line])-len(strings.TrimLeft(lines[line], " \t"))]
+	comment := indent + prefix + annotationMarker + " " + strings.ReplaceAll(note, "\n", " ")
+	if line > 0 && isAnnotation(lines[line-1]) {
+		lines[line-1] = comment
+	} else {
+		lines = append(lines[:line], append([]string{comment}, lines[line:]...)...)
+	}
+	return true, source.writeFile(filename, []byte(strings.Join(lines, "\n")))
+}
+
+// EntryAnnotations returns the notes written by AnnotateEntry for the entries at paths, or "" for entries without
+// one. Files of formats that cannot hold comments have no annotations. The file is read as described by source.
+func EntryAnnotations(source Source, filename, configType string, paths [][]string) ([]string, error) {
+	notes := make([]string, len(paths))
+	locate, _ := annotationFormat(configType)
+	if locate == nil {
+		return notes, nil
+	}
+
+	content, err := source.readFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	lines := strings.Split(string(content), "\n")
+	for i, path := range paths {
+		if line, ok := locate(lines, path); ok && line > 0 && isAnnotation(lines[line-1]) {
+			note := strings.TrimSpace(lines[line-1])
+			notes[i] = strings.TrimSpace(note[strings.Index(note, annotationMarker)+len(annotationMarker):])
+		}
+	}
+	return notes, nil
+}
+
+// annotationFormat returns the function locating entries of the config type and the comment prefix of the format,
+// or a nil function if the format cannot hold comments.
+func annotationFormat(configType string) (func(lines []string, path []string) (int, bool), string) {
+	switch strings.TrimSuffix(strings.ToLower(configType), CompressionExt(configType)) {
+	case ".yaml", ".yml", ".mk.yaml", ".mk.yml":
+		return locateYAMLEntry, "# "
+	case ".toml", ".mk.toml":
+		return locateTOMLEntry, "# "
+	case ".ini", ".mk.ini":
+		return locateINIEntry, "; "
+	}
+	return nil, ""
+}
+
+// isAnnotation reports whether the line is a comment written by AnnotateEntry.
+func isAnnotation(line string) bool {
+	trimmed := strings.TrimSpace(line)
+	for _, prefix := range []string{"#", ";"} {
+		if strings.HasPrefix(trimmed, prefix) && strings.HasPrefix(strings.TrimSpace(trimmed[1:]), annotationMarker) {
+			return true
+		}
+	}
+	return false
+}
+
+// locateYAMLEntry returns the index of the key line of the entry at path of a block mapping document.
+func locateYAMLEntry(lines []string, path []string) (int, bool) {
+	start, end := 0, len(lines)
+	for depth, key := range path {
+		indent := -1
+		for _, line := range lines[start:end] {
+			if isYAMLContentLine(line) && !strings.HasPrefix(line, "---") && !strings.HasPrefix(line, "%") {
+				indent = lineIndent(line)
+				break
+			}
+		}
+		if indent < 0 || (depth > 0 && indent <= lineIndent(lines[start-1])) {
+			return 0, false
+		}
+
+		found := false
+		for _, entry := range scanYAMLEntries(lines[start:end], indent) {
+			if entry.key == key {
+				if depth == len(path)-1 {
+					return start + entry.start, true
+				}
+				start, end = start+entry.start+1, start+entry.bodyEnd
+				found = true
+				break
+			}
+		}
+		if !found {
+			return 0, false
+		}
+	}
+	return 0, false
+}
+
+// locateTOMLEntry returns the index of the key line of the entry at path, which may be written as a dotted key
+// or below a table header.
+func locateTOMLEntry(lines []string, path []string) (int, bool) {
+	for _, section := range scanTOMLSections(lines) {
+		if section.array || len(section.path) >= len(path) || !reflect.DeepEqual(section.path, path[:len(section.path)]) {
+			continue
+		}
+		for i := section.header + 1; i < section.end; i++ {
+			key, _, _, _, ok := splitTOMLKeyLine(lines[i])
+			if !ok {
+				continue
+			}
+			if reflect.DeepEqual(key, path[len(section.path):]) {
+				return i, true
+			}
+			i += tomlValueLines(lines[i:]) - 1
+		}
+	}
+	return 0, false
+}
+
+// locateINIEntry returns the index of the key line of the entry at path ([section,] key). Nested sections are
+// written with dots, so the path server.tls.cert is the key cert of the section [server.tls].
+func locateINIEntry(lines []string, path []string) (int, bool) {
+	if len(path) == 0 {
+		return 0, false
+	}
+	section, key := strings.Join(path[:len(path)-1], "."), path[len(path)-1]
+
+	current := ""
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "" || strings.HasPrefix(trimmed, "#") || strings.HasPrefix(trimmed, ";"):
+		case strings.HasPrefix(trimmed, "[") && strings.HasSuffix(trimmed, "]"):
+			current = strings.TrimSpace(trimmed[1 : len(trimmed)-1])
+		case strings.EqualFold(current, section) || (section == "" && current == "DEFAULT"):
+			if separator := strings.IndexAny(trimmed, "=:"); separator > 0 && strings.TrimSpace(trimmed[:separator]) == key {
+				return i, true
+			}
+		}
+	}
+	return 0, false
+}
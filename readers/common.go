@@ -1,8 +1,65 @@
 package readers
 
-// ConfigReader is an interface for reading and updating configuration files.
-type ConfigReader interface {
+import (
+	"errors"
+	"io"
+	"io/fs"
+)
+
+// Reader is an interface for reading configuration files.
+type Reader interface {
 	ReadConfig(filename string, v interface{}) error                 // ReadConfig reads the content of a configuration file into the provided struct.
 	ReadConfigToMap(filename string) (map[string]interface{}, error) // ReadConfigToMap reads the content of a configuration file into a map.
-	UpdateConfig(filename string, v interface{}) error               // UpdateConfig writes the provided struct as JSON to the configuration file.
+}
+
+// Writer is an interface for writing configuration files.
+type Writer interface {
+	UpdateConfig(filename string, v interface{}) error // UpdateConfig writes the provided struct to the configuration file.
+}
+
+// ErrRewritten is wrapped by the errors of writers that patch files in place when an existing file could not be
+// patched and was rewritten in full instead: the file holds the new values, but the comments and formatting of the
+// old content are lost.
+var ErrRewritten = errors.New("file rewritten in full")
+
+// StreamReader is an interface for reading configurations from a stream, e.g. stdin or an HTTP body.
+type StreamReader interface {
+	ReadConfigFrom(r io.Reader, v interface{}) error // ReadConfigFrom reads configuration content from the stream into the provided struct.
+}
+
+// StreamMapReader is an interface for reading configurations from a stream into a map.
+type StreamMapReader interface {
+	ReadConfigToMapFrom(r io.Reader) (map[string]interface{}, error) // ReadConfigToMapFrom reads configuration content from the stream into a map.
+}
+
+// StreamWriter is an interface for writing configurations to a stream.
+type StreamWriter interface {
+	WriteConfigTo(w io.Writer, v interface{}) error // WriteConfigTo writes the provided struct to the stream.
+}
+
+// ConfigReader is an interface for reading, streaming and updating configuration files.
+type ConfigReader interface {
+	Reader
+	StreamReader
+	Writer
+	StreamWriter
+}
+
+// Source describes where and how a reader reads and writes configuration files. The built-in readers embed it, so
+// every reader instance, and the configuration it belongs to, has its own; the zero Source reads the OS file system
+// and detects the charset.
+type Source struct {
+	FS      fs.FS  // File system the files are read from, e.g. an embed.FS, by slash-separated path; the OS file system if nil
+	Charset string // Charset of content without a byte order mark, see RegisterCharset; detected if empty
+}
+
+// SourceReader is an interface for readers reading configuration files as described by a Source.
+// Readers that do not implement it read files from the OS file system.
+type SourceReader interface {
+	SetSource(source Source) // SetSource sets how the reader reads and writes configuration files.
+}
+
+// SetSource implements SourceReader for the readers embedding Source.
+func (s *Source) SetSource(source Source) {
+	*s = source
 }
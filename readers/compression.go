@@ -0,0 +1,115 @@
+package readers
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"sync"
+)
+
+// Codec compresses and decompresses configuration file content.
+type Codec struct {
+	Compress   func(content []byte) ([]byte, error) // Compress returns the compressed content
+	Decompress func(content []byte) ([]byte, error) // Decompress returns the decompressed content
+}
+
+var (
+	codecMutex sync.RWMutex         // Mutex for synchronizing access to the codecs map
+	codecs     = map[string]Codec{} // Registered codecs keyed by lower-case file extension (e.g. ".gz")
+)
+
+func init() {
+	RegisterCodec(".gz", Codec{Compress: gzipCompress, Decompress: gzipDecompress})
+}
+
+// RegisterCodec registers a compression codec for files ending with the given extension, replacing any existing one.
+// Only ".gz" is built in; other formats, such as ".zst" with github.com/klauspost/compress/zstd, can be registered.
+func RegisterCodec(ext string, codec Codec) {
+	codecMutex.Lock()
+	defer codecMutex.Unlock()
+	codecs[strings.ToLower(ext)] = codec
+}
+
+// CompressionExt returns the registered compression extension the file name ends with, or an empty string.
+func CompressionExt(filename string) string {
+	codecMutex.RLock()
+	defer codecMutex.RUnlock()
+	lower := strings.ToLower(filename)
+	for ext := range codecs {
+		if strings.HasSuffix(lower, ext) {
+			return ext
+		}
+	}
+	return ""
+}
+
+// codecFor returns the codec for the file name, if it is compressed.
+func codecFor(filename string) (Codec, bool) {
+	ext := CompressionExt(filename)
+	if ext == "" {
+		return Codec{}, false
+	}
+	codecMutex.RLock()
+	defer codecMutex.RUnlock()
+	codec, ok := codecs[ext]
+	return codec, ok
+}
+
+// readRawFile reads a configuration file, decompressing it if its extension has a registered codec.
+func (s Source) readRawFile(filename string) ([]byte, error) {
+	content, err := s.ReadSourceFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return Decompress(filename, content)
+}
+
+// Decompress decompresses content read from the named file if its extension has a registered codec.
+func Decompress(filename string, content []byte) ([]byte, error) {
+	codec, ok := codecFor(filename)
+	if !ok {
+		return content, nil
+	}
+	content, err := codec.Decompress(content)
+	if err != nil {
+		return nil, fmt.Errorf("error decompressing %v: %v", filename, err)
+	}
+	return content, nil
+}
+
+// writeFile writes a configuration file, compressing it if its extension has a registered codec.
+func (s Source) writeFile(filename string, content []byte) error {
+	if codec, ok := codecFor(filename); ok {
+		compressed, err := codec.Compress(content)
+		if err != nil {
+			return fmt.Errorf("error compressing %v: %v", filename, err)
+		}
+		content = compressed
+	}
+	return s.writeSourceFile(filename, content)
+}
+
+// gzipCompress compresses content with gzip.
+func gzipCompress(content []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(content); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// gzipDecompress decompresses gzip content.
+func gzipDecompress(content []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(content))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
@@ -0,0 +1,45 @@
+package readers
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestCompressionCodecs(t *testing.T) {
+	content := []byte(`{"port": 8080}`)
+
+	if ext := CompressionExt("config.json.gz"); ext != ".gz" {
+		t.Fatalf("CompressionExt(config.json.gz) = %q, want .gz", ext)
+	}
+	compressed, err := gzipCompress(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decompressed, err := Decompress("config.json.gz", compressed); err != nil || !bytes.Equal(decompressed, content) {
+		t.Fatalf("Decompress(gzip) = %q, %v, want %q", decompressed, err, content)
+	}
+
+	// zstd is not built in: the content is returned as is.
+	if ext := CompressionExt("config.json.zst"); ext != "" {
+		t.Fatalf("CompressionExt(config.json.zst) = %q, want none", ext)
+	}
+	if decompressed, err := Decompress("config.json.zst", content); err != nil || !bytes.Equal(decompressed, content) {
+		t.Fatalf("Decompress(unregistered) = %q, %v, want %q", decompressed, err, content)
+	}
+
+	RegisterCodec(".ZST", Codec{
+		Compress:   func(content []byte) ([]byte, error) { return append([]byte("zst:"), content...), nil },
+		Decompress: func(content []byte) ([]byte, error) { return bytes.TrimPrefix(content, []byte("zst:")), nil },
+	})
+	t.Cleanup(func() {
+		codecMutex.Lock()
+		delete(codecs, ".zst")
+		codecMutex.Unlock()
+	})
+	if ext := CompressionExt("config.JSON.ZST"); ext != ".zst" {
+		t.Fatalf("CompressionExt(config.JSON.ZST) = %q, want .zst", ext)
+	}
+	if decompressed, err := Decompress("config.json.zst", []byte(`zst:{"port": 8080}`)); err != nil || !bytes.Equal(decompressed, content) {
+		t.Fatalf("Decompress(registered) = %q, %v, want %q", decompressed, err, content)
+	}
+}
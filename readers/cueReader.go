@@ -0,0 +1,160 @@
+package readers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"sync"
+)
+
+// ErrNoCUEEvaluator is wrapped by the errors of CUEConfigReader when its Evaluate function is not set.
+var ErrNoCUEEvaluator = errors.New("no CUE evaluator set")
+
+// ErrCUENotFound is wrapped by the errors of EvaluateCUECommand when the cue command-line tool is not installed.
+var ErrCUENotFound = errors.New("cue binary not found")
+
+// CUEEvaluateFunc evaluates a CUE file, checks its constraints and returns the resulting JSON document.
+type CUEEvaluateFunc func(filename string) ([]byte, error)
+
+// CUEConfigReader implements the read-only Reader interface for CUE configuration files.
+// The file is evaluated and validated against its own constraints; any violation or incomplete
+// value is reported as an error before anything is decoded into the configuration struct.
+// mkconf does not embed a CUE evaluator: set Evaluate to opt in, either to EvaluateCUECommand, which runs the cue
+// command-line tool and requires it to be installed, or to an embedded evaluator, e.g. built on cuelang.org/go.
+// Without it, reading fails with ErrNoCUEEvaluator. Files read from an fs.FS, see Source, are evaluated from a
+// temporary copy.
+type CUEConfigReader struct {
+	Source                   // Where configuration files are read from
+	Evaluate CUEEvaluateFunc // Evaluator of the files, e.g. EvaluateCUECommand; reading fails if nil
+	mu       sync.Mutex      // Mutex to ensure thread safety during file read operations.
+}
+
+// ReadConfig evaluates a CUE configuration file into the provided struct.
+func (c *CUEConfigReader) ReadConfig(filename string, v interface{}) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	jsonData, err := c.evaluate(filename)
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(jsonData, &v); err != nil {
+		return fmt.Errorf("error unmarshalling CUE output: %v\n", err)
+	}
+
+	return nil
+}
+
+// ReadConfigFrom evaluates CUE content from the stream into the provided struct.
+func (c *CUEConfigReader) ReadConfigFrom(r io.Reader, v interface{}) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	local, cleanup, err := streamFile(r, "stdin.cue")
+	if err != nil {
+		return fmt.Errorf("error reading CUE stream: %v\n", err)
+	}
+	defer cleanup()
+
+	jsonData, err := c.evaluateLocal(local)
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(jsonData, &v); err != nil {
+		return fmt.Errorf("error unmarshalling CUE output: %v\n", err)
+	}
+
+	return nil
+}
+
+// ReadConfigToMap evaluates a CUE configuration file into a map.
+func (c *CUEConfigReader) ReadConfigToMap(filename string) (map[string]interface{}, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	jsonData, err := c.evaluate(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var configMap map[string]interface{}
+	if err := json.Unmarshal(jsonData, &configMap); err != nil {
+		return nil, fmt.Errorf("error unmarshalling CUE output: %v\n", err)
+	}
+
+	return configMap, nil
+}
+
+// ReadConfigToMapFrom evaluates CUE content from the stream into a map.
+func (c *CUEConfigReader) ReadConfigToMapFrom(r io.Reader) (map[string]interface{}, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	local, cleanup, err := streamFile(r, "stdin.cue")
+	if err != nil {
+		return nil, fmt.Errorf("error reading CUE stream: %v\n", err)
+	}
+	defer cleanup()
+
+	jsonData, err := c.evaluateLocal(local)
+	if err != nil {
+		return nil, err
+	}
+
+	var configMap map[string]interface{}
+	if err := json.Unmarshal(jsonData, &configMap); err != nil {
+		return nil, fmt.Errorf("error unmarshalling CUE output: %v\n", err)
+	}
+
+	return configMap, nil
+}
+
+// evaluate runs the configured evaluator on the file, on a temporary copy if it is not on the OS file system.
+func (c *CUEConfigReader) evaluate(filename string) ([]byte, error) {
+	local, cleanup, err := c.localFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("error reading CUE file: %v\n", err)
+	}
+	defer cleanup()
+
+	return c.evaluateLocal(local)
+}
+
+// evaluateLocal runs the configured evaluator on a file on the OS file system.
+func (c *CUEConfigReader) evaluateLocal(filename string) ([]byte, error) {
+	if c.Evaluate == nil {
+		return nil, fmt.Errorf("error evaluating CUE file: %w: set an evaluator, e.g. EvaluateCUECommand\n", ErrNoCUEEvaluator)
+	}
+
+	jsonData, err := c.Evaluate(filename)
+	if err != nil {
+		return nil, fmt.Errorf("error evaluating CUE file: %w\n", err)
+	}
+	return jsonData, nil
+}
+
+// EvaluateCUECommand evaluates and validates a CUE file using the cue command-line tool, which must be installed.
+// It fails with ErrCUENotFound if cue is not found in PATH.
+func EvaluateCUECommand(filename string) ([]byte, error) {
+	if _, err := exec.LookPath("cue"); err != nil {
+		return nil, fmt.Errorf("%w in PATH: install it from https://cuelang.org or set another evaluator", ErrCUENotFound)
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("cue", "export", "--out", "json", filename)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if stderr.Len() > 0 {
+			return nil, fmt.Errorf("%v: %s", err, bytes.TrimSpace(stderr.Bytes()))
+		}
+		return nil, err
+	}
+
+	return stdout.Bytes(), nil
+}
@@ -0,0 +1,41 @@
+package readers
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCUEConfigReaderRequiresEvaluator(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "config.cue")
+	if err := os.WriteFile(filename, []byte("port: 8080\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var config struct {
+		Port int `json:"port"`
+	}
+
+	if err := (&CUEConfigReader{}).ReadConfig(filename, &config); !errors.Is(err, ErrNoCUEEvaluator) {
+		t.Fatalf("ReadConfig without evaluator = %v, want %v", err, ErrNoCUEEvaluator)
+	}
+
+	evaluated := ""
+	cueReader := &CUEConfigReader{Evaluate: func(filename string) ([]byte, error) {
+		evaluated = filename
+		return []byte(`{"port": 8080}`), nil
+	}}
+	if err := cueReader.ReadConfig(filename, &config); err != nil {
+		t.Fatalf("ReadConfig: %v", err)
+	}
+	if evaluated != filename || config.Port != 8080 {
+		t.Fatalf("evaluated %q into %+v, want %q evaluated into port 8080", evaluated, config, filename)
+	}
+}
+
+func TestEvaluateCUECommandReportsMissingBinary(t *testing.T) {
+	t.Setenv("PATH", t.TempDir())
+	if _, err := EvaluateCUECommand("config.cue"); !errors.Is(err, ErrCUENotFound) {
+		t.Fatalf("EvaluateCUECommand without cue in PATH = %v, want %v", err, ErrCUENotFound)
+	}
+}
@@ -0,0 +1,159 @@
+package readers
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// CharsetDecodeFunc converts content in a specific charset to UTF-8.
+type CharsetDecodeFunc func(content []byte) ([]byte, error)
+
+var (
+	charsetMutex sync.RWMutex                     // Mutex for synchronizing access to the charsets map
+	charsets     = map[string]CharsetDecodeFunc{} // Registered charset decoders keyed by lower-case name
+	utf8BOM      = []byte{0xEF, 0xBB, 0xBF}       // UTF-8 byte order mark
+	cp1252       = [32]rune{                      // Windows-1252 characters for bytes 0x80-0x9F
+		'€', 0x81, '‚', 'ƒ', '„', '…', '†', '‡', 'ˆ', '‰', 'Š', '‹', 'Œ', 0x8D, 'Ž', 0x8F,
+		0x90, '‘', '’', '“', '”', '•', '–', '—', '˜', '™', 'š', '›', 'œ', 0x9D, 'ž', 'Ÿ',
+	}
+)
+
+func init() {
+	RegisterCharset("utf-8", decodeUTF8)
+	RegisterCharset("utf-16le", func(content []byte) ([]byte, error) { return decodeUTF16(content, false) })
+	RegisterCharset("utf-16be", func(content []byte) ([]byte, error) { return decodeUTF16(content, true) })
+	RegisterCharset("iso-8859-1", decodeLatin1)
+	RegisterCharset("latin1", decodeLatin1)
+	RegisterCharset("windows-1252", decodeWindows1252)
+	RegisterCharset("cp1252", decodeWindows1252)
+}
+
+// RegisterCharset registers a decoder for the named charset, replacing any existing one.
+func RegisterCharset(name string, decode CharsetDecodeFunc) {
+	charsetMutex.Lock()
+	defer charsetMutex.Unlock()
+	charsets[strings.ToLower(name)] = decode
+}
+
+// CharsetSupported reports whether a decoder is registered for the named charset.
+func CharsetSupported(charset string) bool {
+	charsetMutex.RLock()
+	defer charsetMutex.RUnlock()
+	_, ok := charsets[strings.ToLower(charset)]
+	return ok
+}
+
+// readFile reads a configuration file and returns its content as UTF-8.
+// A byte order mark selects UTF-8 or UTF-16 automatically; otherwise the charset of the source is used.
+func (s Source) readFile(filename string) ([]byte, error) {
+	content, err := s.readRawFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return s.DecodeContent(filename, content)
+}
+
+// readStream reads configuration content from a stream and returns it as UTF-8, like readFile.
+func (s Source) readStream(r io.Reader) ([]byte, error) {
+	content, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return s.DecodeContent("", content)
+}
+
+// DecodeContent converts content of the named file, or of a stream if filename is empty, to UTF-8 as readFile does.
+func (s Source) DecodeContent(filename string, content []byte) ([]byte, error) {
+	switch {
+	case bytes.HasPrefix(content, utf8BOM):
+		return content[len(utf8BOM):], nil
+	case bytes.HasPrefix(content, []byte{0xFF, 0xFE}):
+		return decodeUTF16(content[2:], false)
+	case bytes.HasPrefix(content, []byte{0xFE, 0xFF}):
+		return decodeUTF16(content[2:], true)
+	}
+
+	if s.Charset != "" {
+		charsetMutex.RLock()
+		decode, ok := charsets[strings.ToLower(s.Charset)]
+		charsetMutex.RUnlock()
+		if !ok {
+			return nil, fmt.Errorf("error decoding %v: unsupported charset %q", filename, s.Charset)
+		}
+		decoded, err := decode(content)
+		if err != nil {
+			return nil, fmt.Errorf("error decoding %v as %v: %v", filename, s.Charset, err)
+		}
+		return decoded, nil
+	}
+
+	// UTF-16 without a byte order mark is recognized by the zero byte of its first ASCII character.
+	if len(content) >= 2 && len(content)%2 == 0 {
+		if content[0] != 0 && content[1] == 0 {
+			return decodeUTF16(content, false)
+		}
+		if content[0] == 0 && content[1] != 0 {
+			return decodeUTF16(content, true)
+		}
+	}
+
+	return content, nil
+}
+
+// decodeUTF8 validates UTF-8 content and strips an optional byte order mark.
+func decodeUTF8(content []byte) ([]byte, error) {
+	content = bytes.TrimPrefix(content, utf8BOM)
+	if !utf8.Valid(content) {
+		return nil, fmt.Errorf("invalid UTF-8 content")
+	}
+	return content, nil
+}
+
+// decodeUTF16 converts UTF-16 content in the given byte order to UTF-8.
+func decodeUTF16(content []byte, bigEndian bool) ([]byte, error) {
+	if len(content)%2 != 0 {
+		return nil, fmt.Errorf("invalid UTF-16 content: odd number of bytes")
+	}
+
+	units := make([]uint16, len(content)/2)
+	for i := range units {
+		if bigEndian {
+			units[i] = uint16(content[2*i])<<8 | uint16(content[2*i+1])
+		} else {
+			units[i] = uint16(content[2*i+1])<<8 | uint16(content[2*i])
+		}
+	}
+	if len(units) > 0 && units[0] == 0xFEFF {
+		units = units[1:]
+	}
+
+	return []byte(string(utf16.Decode(units))), nil
+}
+
+// decodeLatin1 converts ISO-8859-1 content to UTF-8.
+func decodeLatin1(content []byte) ([]byte, error) {
+	runes := make([]rune, len(content))
+	for i, b := range content {
+		runes[i] = rune(b)
+	}
+	return []byte(string(runes)), nil
+}
+
+// decodeWindows1252 converts Windows-1252 content to UTF-8.
+func decodeWindows1252(content []byte) ([]byte, error) {
+	runes := make([]rune, len(content))
+	for i, b := range content {
+		if b >= 0x80 && b <= 0x9F {
+			runes[i] = cp1252[b-0x80]
+		} else {
+			runes[i] = rune(b)
+		}
+	}
+	return []byte(string(runes)), nil
+}
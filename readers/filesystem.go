@@ -0,0 +1,96 @@
+package readers
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// WriteFileFS is implemented by file systems that support writing configuration files.
+type WriteFileFS interface {
+	fs.FS
+	WriteFile(name string, data []byte, perm fs.FileMode) error
+}
+
+// ReadSourceFile reads a configuration file as stored, from the file system of the source or the OS file system.
+func (s Source) ReadSourceFile(filename string) ([]byte, error) {
+	if s.FS != nil {
+		return fs.ReadFile(s.FS, filepath.ToSlash(filename))
+	}
+	return ioutil.ReadFile(filename)
+}
+
+// IsWritable reports whether configuration files of the source can be written, i.e. they are on the OS file system
+// or on a file system implementing WriteFileFS.
+func (s Source) IsWritable() bool {
+	if s.FS == nil {
+		return true
+	}
+	_, ok := s.FS.(WriteFileFS)
+	return ok
+}
+
+// writeSourceFile writes a configuration file to the file system of the source or the OS file system.
+func (s Source) writeSourceFile(filename string, content []byte) error {
+	if s.FS == nil {
+		return ioutil.WriteFile(filename, content, 0644)
+	}
+	writable, ok := s.FS.(WriteFileFS)
+	if !ok {
+		return fmt.Errorf("error writing %v: file system is read-only", filename)
+	}
+	return writable.WriteFile(filepath.ToSlash(filename), content, 0644)
+}
+
+// streamFile copies the stream to a temporary file with the given base name, for tools that can only read from disk.
+// The returned cleanup function removes the temporary copy.
+func streamFile(r io.Reader, base string) (string, func(), error) {
+	dir, err := ioutil.TempDir("", "mkconf")
+	if err != nil {
+		return "", nil, err
+	}
+	cleanup := func() { os.RemoveAll(dir) }
+
+	f, err := os.Create(filepath.Join(dir, base))
+	if err != nil {
+		cleanup()
+		return "", nil, err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		cleanup()
+		return "", nil, err
+	}
+	if err := f.Close(); err != nil {
+		cleanup()
+		return "", nil, err
+	}
+	return f.Name(), cleanup, nil
+}
+
+// localFile returns a path on the OS file system holding the content of the configuration file,
+// for tools that can only read from disk. The returned cleanup function removes any temporary copy.
+func (s Source) localFile(filename string) (string, func(), error) {
+	if s.FS == nil {
+		return filename, func() {}, nil
+	}
+
+	content, err := s.ReadSourceFile(filename)
+	if err != nil {
+		return "", nil, err
+	}
+	dir, err := ioutil.TempDir("", "mkconf")
+	if err != nil {
+		return "", nil, err
+	}
+	cleanup := func() { os.RemoveAll(dir) }
+	local := filepath.Join(dir, filepath.Base(filename))
+	if err := ioutil.WriteFile(local, content, 0600); err != nil {
+		cleanup()
+		return "", nil, err
+	}
+	return local, cleanup, nil
+}
@@ -1,8 +1,12 @@
 package readers
 
 import (
+	"bytes"
 	"fmt"
-	"io/ioutil"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
 
 	"gopkg.in/ini.v1"
@@ -10,25 +14,36 @@ import (
 
 // INIConfigReader implements the ConfigReader interface for INI configuration files.
 type INIConfigReader struct {
-	mu sync.Mutex // Mutex to ensure thread safety during file read and write operations.
+	Source            // Where and how configuration files are read and written
+	mu     sync.Mutex // Mutex to ensure thread safety during file read and write operations.
 }
 
-// ReadConfig reads the content of an INI configuration file into the provided struct.
+// ReadConfig reads the content of an INI configuration file into the provided struct. Dotted sections such as
+// [server.tls] map to nested structs and numbered sections such as [servers.0] to slices of structs.
 func (i *INIConfigReader) ReadConfig(filename string, v interface{}) error {
 	i.mu.Lock()
 	defer i.mu.Unlock()
 
-	fileContent, err := ioutil.ReadFile(filename)
+	fileContent, err := i.readFile(filename)
 	if err != nil {
 		return err
 	}
 
-	cfg, err := ini.Load(fileContent)
-	if err != nil {
+	if err := decodeINI(fileContent, v); err != nil {
 		return fmt.Errorf("error unmarshalling INI content: %v\n", err)
 	}
 
-	if err := cfg.MapTo(&v); err != nil {
+	return nil
+}
+
+// ReadConfigFrom reads INI configuration content from the stream into the provided struct.
+func (i *INIConfigReader) ReadConfigFrom(r io.Reader, v interface{}) error {
+	content, err := i.readStream(r)
+	if err != nil {
+		return fmt.Errorf("error reading INI stream: %v\n", err)
+	}
+
+	if err := decodeINI(content, v); err != nil {
 		return fmt.Errorf("error unmarshalling INI content: %v\n", err)
 	}
 
@@ -40,12 +55,29 @@ func (i *INIConfigReader) ReadConfigToMap(filename string) (map[string]interface
 	i.mu.Lock()
 	defer i.mu.Unlock()
 
-	fileContent, err := ioutil.ReadFile(filename)
+	fileContent, err := i.readFile(filename)
 	if err != nil {
 		return nil, fmt.Errorf("error reading INI file: %v\n", err)
 	}
 
-	cfg, err := ini.Load(fileContent)
+	return iniToMap(fileContent)
+}
+
+// ReadConfigToMapFrom reads INI configuration content from the stream into a map.
+func (i *INIConfigReader) ReadConfigToMapFrom(r io.Reader) (map[string]interface{}, error) {
+	content, err := i.readStream(r)
+	if err != nil {
+		return nil, fmt.Errorf("error reading INI stream: %v\n", err)
+	}
+
+	return iniToMap(content)
+}
+
+// iniToMap converts INI content into a map of sections holding maps of their keys, with the keys of the default
+// section in "DEFAULT". Like decodeINI maps them, dotted sections such as [server.tls] are nested into the map of
+// their parent, and numbered sections such as [servers.0], [servers.1] become a list.
+func iniToMap(content []byte) (map[string]interface{}, error) {
+	cfg, err := ini.LoadSources(iniLoadOptions, content)
 	if err != nil {
 		return nil, fmt.Errorf("error unmarshalling INI content: %v\n", err)
 	}
@@ -56,24 +88,102 @@ func (i *INIConfigReader) ReadConfigToMap(filename string) (map[string]interface
 		for _, key := range section.KeyStrings() {
 			sectionMap[key] = section.Key(key).String()
 		}
-		configMap[section.Name()] = sectionMap
+		if section.Name() == ini.DefaultSection {
+			configMap[section.Name()] = sectionMap
+			continue
+		}
+
+		parent := configMap
+		path := strings.Split(section.Name(), ".")
+		for _, name := range path {
+			child, ok := parent[name].(map[string]interface{})
+			if !ok {
+				if _, exists := parent[name]; exists {
+					return nil, fmt.Errorf("error unmarshalling INI content: section [%v] conflicts with key %v\n", section.Name(), name)
+				}
+				child = make(map[string]interface{})
+				parent[name] = child
+			}
+			parent = child
+		}
+		// The map may already hold the sections nested below, e.g. [server.tls] before [server].
+		for key, value := range sectionMap {
+			if _, exists := parent[key]; exists {
+				return nil, fmt.Errorf("error unmarshalling INI content: key %v of section [%v] conflicts with a section\n", key, section.Name())
+			}
+			parent[key] = value
+		}
 	}
 
+	for name, value := range configMap {
+		configMap[name] = iniSectionLists(value)
+	}
 	return configMap, nil
 }
 
-// UpdateConfig writes the provided struct as INI to the configuration file.
+// iniSectionLists replaces the maps of the nested sections of value holding only sections numbered from 0 or 1
+// without gaps, e.g. [servers.0] and [servers.1], by lists.
+func iniSectionLists(value interface{}) interface{} {
+	sections, ok := value.(map[string]interface{})
+	if !ok {
+		return value
+	}
+	for name, child := range sections {
+		sections[name] = iniSectionLists(child)
+	}
+
+	numbers := make([]int, 0, len(sections))
+	for name, child := range sections {
+		number, err := strconv.Atoi(name)
+		if _, isSection := child.(map[string]interface{}); err != nil || number < 0 || !isSection {
+			return sections
+		}
+		numbers = append(numbers, number)
+	}
+	sort.Ints(numbers)
+	if len(numbers) == 0 || numbers[0] > 1 || numbers[len(numbers)-1] != numbers[0]+len(numbers)-1 {
+		return sections
+	}
+	list := make([]interface{}, len(numbers))
+	for i, number := range numbers {
+		list[i] = sections[strconv.Itoa(number)]
+	}
+	return list
+}
+
+// UpdateConfig writes the provided struct as INI to the configuration file, with nested structs as dotted
+// sections and slices of structs as numbered sections. The numbering of an existing file and its sections that do
+// not map to a field are kept.
 func (i *INIConfigReader) UpdateConfig(filename string, v interface{}) error {
 	i.mu.Lock()
 	defer i.mu.Unlock()
 
-	cfg := ini.Empty()
-	if err := cfg.ReflectFrom(v); err != nil {
+	existing, _ := i.readFile(filename)
+	cfg, err := encodeINI(v, existing)
+	if err != nil {
 		return fmt.Errorf("error updating INI config: %v", err)
 	}
 
-	if err := cfg.SaveTo(filename); err != nil {
-		return fmt.Errorf("error writing INI file: %v", err)
+	var buf bytes.Buffer
+	if _, err := cfg.WriteTo(&buf); err != nil {
+		return fmt.Errorf("error writing INI file: %w", err)
+	}
+
+	if err := i.writeFile(filename, buf.Bytes()); err != nil {
+		return fmt.Errorf("error writing INI file: %w", err)
+	}
+
+	return nil
+}
+
+// WriteConfigTo writes the provided struct as INI to the stream.
+func (i *INIConfigReader) WriteConfigTo(w io.Writer, v interface{}) error {
+	cfg, err := encodeINI(v, nil)
+	if err != nil {
+		return fmt.Errorf("error updating INI config: %v", err)
+	}
+	if _, err := cfg.WriteTo(w); err != nil {
+		return fmt.Errorf("error writing INI stream: %v", err)
 	}
 
 	return nil
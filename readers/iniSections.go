@@ -0,0 +1,403 @@
+package readers
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/ini.v1"
+)
+
+// iniLoadOptions disables the inheritance of parent section keys by child sections ([server.tls] reading the keys
+// of [server]), since child sections are mapped to nested structs of their own.
+var iniLoadOptions = ini.LoadOptions{ChildSectionDelimiter: "\x00"}
+
+// iniField is a field of a struct mapped to INI keys or sections.
+type iniField struct {
+	index   []int               // Index of the field, through embedded structs
+	name    string              // Key or section name of the field
+	field   reflect.StructField // The field itself
+	section bool                // Flag indicating the field is a nested struct mapped to a section
+	slice   bool                // Flag indicating the field is a slice of structs mapped to numbered sections
+}
+
+// iniFields returns the mapped fields of a struct type. Embedded structs without a name are flattened like in
+// encoding/json, unless they use the go-ini "extends" option, which go-ini handles itself.
+func iniFields(t reflect.Type, index []int) []iniField {
+	var fields []iniField
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("ini")
+		if tag == "-" || (field.PkgPath != "" && !field.Anonymous) {
+			continue
+		}
+		options := strings.Split(tag, ",")
+		name := options[0]
+		fieldIndex := append(append([]int(nil), index...), i)
+
+		elem := field.Type
+		if elem.Kind() == reflect.Ptr {
+			elem = elem.Elem()
+		}
+		if field.Anonymous && name == "" && isINISection(elem) && !hasOption(options[1:], "extends") {
+			fields = append(fields, iniFields(elem, fieldIndex)...)
+			continue
+		}
+		if field.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		f := iniField{index: fieldIndex, name: name, field: field}
+		switch {
+		case hasOption(options[1:], "nonunique") || hasOption(options[1:], "extends"):
+		case isINISection(elem):
+			f.section = true
+		case field.Type.Kind() == reflect.Slice:
+			elem = field.Type.Elem()
+			if elem.Kind() == reflect.Ptr {
+				elem = elem.Elem()
+			}
+			f.slice = isINISection(elem)
+		}
+		fields = append(fields, f)
+	}
+	return fields
+}
+
+// isINISection reports whether values of the type are mapped to a section rather than a key.
+func isINISection(t reflect.Type) bool {
+	return t.Kind() == reflect.Struct && t != reflect.TypeOf(time.Time{})
+}
+
+// hasOption reports whether the tag options contain option.
+func hasOption(options []string, option string) bool {
+	for _, o := range options {
+		if o == option {
+			return true
+		}
+	}
+	return false
+}
+
+// iniKeyView returns a pointer to a new struct holding the key fields, for go-ini to map keys with its own
+// conversions without descending into nested structs. The fields get unique names and carry their key names in
+// the ini tag.
+func iniKeyView(fields []iniField) reflect.Value {
+	var viewFields []reflect.StructField
+	for i, f := range fields {
+		if f.section || f.slice {
+			continue
+		}
+		options := strings.SplitN(f.field.Tag.Get("ini"), ",", 2)
+		tag := f.name
+		if len(options) > 1 {
+			tag += "," + options[1]
+		}
+		viewFields = append(viewFields, reflect.StructField{
+			Name: "F" + strconv.Itoa(i),
+			Type: f.field.Type,
+			Tag:  reflect.StructTag(fmt.Sprintf(`ini:%q delim:%q comment:%q`, tag, f.field.Tag.Get("delim"), f.field.Tag.Get("comment"))),
+		})
+	}
+	return reflect.New(reflect.StructOf(viewFields))
+}
+
+// fieldByIndex returns the field at index of the struct v. Nil embedded pointers are allocated if alloc is set;
+// otherwise the field is reported as missing.
+func fieldByIndex(v reflect.Value, index []int, alloc bool) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				if !alloc {
+					return reflect.Value{}, false
+				}
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, true
+}
+
+// copyINIKeys copies the key fields between the struct v and its key view; toView selects the direction.
+func copyINIKeys(v, view reflect.Value, fields []iniField, toView bool) {
+	n := 0
+	for _, f := range fields {
+		if f.section || f.slice {
+			continue
+		}
+		field, ok := fieldByIndex(v, f.index, !toView)
+		if ok {
+			if toView {
+				view.Elem().Field(n).Set(field)
+			} else {
+				field.Set(view.Elem().Field(n))
+			}
+		}
+		n++
+	}
+}
+
+// decodeINI maps INI content into the struct v points to. Keys of the default section map to top-level fields,
+// a section such as [server] to the nested struct field server, [server.tls] to its field tls, and numbered
+// sections such as [servers.0], [servers.1] to the elements of a slice of structs. Numbering may start at 0 or 1
+// but must not have gaps, and sections that do not map to a field are rejected.
+func decodeINI(content []byte, v interface{}) error {
+	cfg, err := ini.LoadSources(iniLoadOptions, content)
+	if err != nil {
+		return err
+	}
+	val := reflect.ValueOf(v)
+	for val.Kind() == reflect.Interface || (val.Kind() == reflect.Ptr && val.Elem().Kind() == reflect.Ptr) {
+		val = val.Elem()
+	}
+	if val.Kind() != reflect.Ptr || val.IsNil() || val.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("INI content can only be decoded into a struct pointer, not %T", v)
+	}
+
+	used, err := mapINI(cfg, val.Elem())
+	if err != nil {
+		return err
+	}
+	for _, name := range cfg.SectionStrings() {
+		if !used[name] {
+			return fmt.Errorf("unknown section [%v]", name)
+		}
+	}
+	return nil
+}
+
+// mapINI maps the sections of cfg into the struct v and returns the names of the sections mapped to a field.
+func mapINI(cfg *ini.File, v reflect.Value) (map[string]bool, error) {
+	used := map[string]bool{ini.DefaultSection: true}
+	if err := mapINISection(cfg, cfg.Section(""), v, "", used); err != nil {
+		return nil, err
+	}
+	return used, nil
+}
+
+// mapINISection maps the keys of sec (if not nil) and the sections below prefix into the struct v, recording the
+// names of the mapped sections in used.
+func mapINISection(cfg *ini.File, sec *ini.Section, v reflect.Value, prefix string, used map[string]bool) error {
+	fields := iniFields(v.Type(), nil)
+	if sec != nil {
+		view := iniKeyView(fields)
+		copyINIKeys(v, view, fields, true)
+		if err := sec.MapTo(view.Interface()); err != nil {
+			return fmt.Errorf("section [%v]: %v", sec.Name(), err)
+		}
+		copyINIKeys(v, view, fields, false)
+	}
+
+	for _, f := range fields {
+		name := f.name
+		if prefix != "" {
+			name = prefix + "." + f.name
+		}
+		switch {
+		case f.section:
+			child, err := cfg.GetSection(name)
+			if err != nil {
+				child = nil
+				if !hasINISectionsBelow(cfg, name) {
+					continue
+				}
+			}
+			used[name] = true
+			field, _ := fieldByIndex(v, f.index, true)
+			if field.Kind() == reflect.Ptr {
+				if field.IsNil() {
+					field.Set(reflect.New(field.Type().Elem()))
+				}
+				field = field.Elem()
+			}
+			if err := mapINISection(cfg, child, field, name, used); err != nil {
+				return err
+			}
+		case f.slice:
+			numbers, err := iniSectionNumbers(cfg, name)
+			if err != nil {
+				return err
+			}
+			if len(numbers) == 0 {
+				continue
+			}
+			field, _ := fieldByIndex(v, f.index, true)
+			slice := reflect.MakeSlice(field.Type(), len(numbers), len(numbers))
+			for i, number := range numbers {
+				elementName := name + "." + strconv.Itoa(number)
+				used[elementName] = true
+				element := slice.Index(i)
+				if element.Kind() == reflect.Ptr {
+					element.Set(reflect.New(element.Type().Elem()))
+					element = element.Elem()
+				}
+				if err := mapINISection(cfg, cfg.Section(elementName), element, elementName, used); err != nil {
+					return err
+				}
+			}
+			field.Set(slice)
+		}
+	}
+	return nil
+}
+
+// hasINISectionsBelow reports whether there are sections nested below name, e.g. [server.tls] for server.
+func hasINISectionsBelow(cfg *ini.File, name string) bool {
+	for _, section := range cfg.SectionStrings() {
+		if strings.HasPrefix(section, name+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// iniSectionNumbers returns the sorted numbers of the sections [name.N].
+func iniSectionNumbers(cfg *ini.File, name string) ([]int, error) {
+	var numbers []int
+	for _, section := range cfg.SectionStrings() {
+		if !strings.HasPrefix(section, name+".") {
+			continue
+		}
+		if number, err := strconv.Atoi(section[len(name)+1:]); err == nil && number >= 0 {
+			numbers = append(numbers, number)
+		}
+	}
+	sort.Ints(numbers)
+	for i, number := range numbers {
+		if number != numbers[0]+i || numbers[0] > 1 {
+			return nil, fmt.Errorf("sections [%v.N] must be numbered from 0 or 1 without gaps", name)
+		}
+	}
+	return numbers, nil
+}
+
+// encodeINI builds an INI file from the struct v, writing nested structs as dotted sections and slices of structs
+// as numbered sections, as read by decodeINI. If original, the current content of the file, is set, numbered
+// sections keep its numbering from 0 or 1, and its sections that do not map to a field of v are kept after the
+// others; otherwise numbering starts at 0.
+func encodeINI(v interface{}, original []byte) (*ini.File, error) {
+	val := reflect.ValueOf(v)
+	for val.Kind() == reflect.Interface || val.Kind() == reflect.Ptr {
+		if val.IsNil() {
+			return nil, fmt.Errorf("cannot encode nil %T as INI", v)
+		}
+		val = val.Elem()
+	}
+	if val.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("only structs can be encoded as INI, not %T", v)
+	}
+
+	var originalCfg *ini.File
+	var used map[string]bool
+	if len(original) > 0 {
+		// Content that does not map onto v is rewritten like a new file.
+		if cfg, err := ini.LoadSources(iniLoadOptions, original); err == nil {
+			if used, err = mapINI(cfg, reflect.New(val.Type()).Elem()); err == nil {
+				originalCfg = cfg
+			}
+		}
+	}
+
+	cfg := ini.Empty(iniLoadOptions)
+	if err := reflectINISection(cfg, cfg.Section(""), val, "", originalCfg); err != nil {
+		return nil, err
+	}
+	if originalCfg != nil {
+		for _, sec := range originalCfg.Sections() {
+			if !used[sec.Name()] {
+				if err := copyINISection(cfg, sec); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	return cfg, nil
+}
+
+// copyINISection adds a copy of the section sec of another file, with its keys and comments, to cfg.
+func copyINISection(cfg *ini.File, sec *ini.Section) error {
+	child, err := cfg.NewSection(sec.Name())
+	if err != nil {
+		return err
+	}
+	child.Comment = sec.Comment
+	for _, key := range sec.Keys() {
+		copied, err := child.NewKey(key.Name(), key.Value())
+		if err != nil {
+			return err
+		}
+		copied.Comment = key.Comment
+	}
+	return nil
+}
+
+// reflectINISection writes the key fields of the struct v into sec and its nested structs into sections below
+// prefix. Numbered sections start at the number of the sections in original, if set.
+func reflectINISection(cfg *ini.File, sec *ini.Section, v reflect.Value, prefix string, original *ini.File) error {
+	fields := iniFields(v.Type(), nil)
+	view := iniKeyView(fields)
+	copyINIKeys(v, view, fields, true)
+	if err := sec.ReflectFrom(view.Interface()); err != nil {
+		return fmt.Errorf("section [%v]: %v", sec.Name(), err)
+	}
+
+	for _, f := range fields {
+		if !f.section && !f.slice {
+			continue
+		}
+		field, ok := fieldByIndex(v, f.index, false)
+		if !ok {
+			continue
+		}
+		name := f.name
+		if prefix != "" {
+			name = prefix + "." + f.name
+		}
+
+		var elements []reflect.Value
+		var names []string
+		if f.section {
+			elements, names = []reflect.Value{field}, []string{name}
+		} else {
+			first := 0
+			if original != nil {
+				if numbers, err := iniSectionNumbers(original, name); err == nil && len(numbers) > 0 {
+					first = numbers[0]
+				}
+			}
+			for i := 0; i < field.Len(); i++ {
+				elements = append(elements, field.Index(i))
+				names = append(names, name+"."+strconv.Itoa(first+i))
+			}
+		}
+		for i, element := range elements {
+			if element.Kind() == reflect.Ptr {
+				if element.IsNil() {
+					if f.section {
+						continue
+					}
+					// Keep the numbering of the following elements.
+					element = reflect.New(element.Type().Elem())
+				}
+				element = element.Elem()
+			}
+			child, err := cfg.NewSection(names[i])
+			if err != nil {
+				return err
+			}
+			child.Comment = f.field.Tag.Get("comment")
+			if err := reflectINISection(cfg, child, element, names[i], original); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
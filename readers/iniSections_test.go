@@ -0,0 +1,129 @@
+package readers
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type iniTLS struct {
+	Enabled bool   `ini:"enabled"`
+	Cert    string `ini:"cert"`
+}
+
+type iniServer struct {
+	Host string `ini:"host"`
+	TLS  iniTLS `ini:"tls"`
+}
+
+type iniSectionsConfig struct {
+	Name    string      `ini:"name"`
+	Server  iniServer   `ini:"server"`
+	Servers []iniServer `ini:"servers"`
+}
+
+func TestDecodeINISections(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    iniSectionsConfig
+		wantErr string
+	}{
+		{
+			name:    "nested sections",
+			content: "name = app\n[server]\nhost = a\n[server.tls]\nenabled = true\ncert = a.pem\n",
+			want:    iniSectionsConfig{Name: "app", Server: iniServer{Host: "a", TLS: iniTLS{Enabled: true, Cert: "a.pem"}}},
+		},
+		{
+			name:    "numbered sections from 1",
+			content: "[servers.1]\nhost = a\n[servers.2]\nhost = b\n[servers.2.tls]\nenabled = true\n",
+			want:    iniSectionsConfig{Servers: []iniServer{{Host: "a"}, {Host: "b", TLS: iniTLS{Enabled: true}}}},
+		},
+		{name: "unmapped section", content: "name = app\n[bogus]\nx = 1\n", wantErr: "unknown section [bogus]"},
+		{name: "unmapped nested section", content: "[server.bogus]\nx = 1\n", wantErr: "unknown section [server.bogus]"},
+		{name: "numbering gap", content: "[servers.0]\nhost = a\n[servers.2]\nhost = b\n", wantErr: "without gaps"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got iniSectionsConfig
+			err := (&INIConfigReader{}).ReadConfigFrom(strings.NewReader(tt.content), &got)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("ReadConfigFrom = %v, want an error containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ReadConfigFrom: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("decoded %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestINIToMapNestsSections(t *testing.T) {
+	content := "name = app\n[server.tls]\nenabled = true\n[server]\nhost = a\n[servers.1]\nhost = b\n[servers.2]\nhost = c\n[ports]\n0 = 80\n"
+	got, err := (&INIConfigReader{}).ReadConfigToMapFrom(strings.NewReader(content))
+	if err != nil {
+		t.Fatalf("ReadConfigToMapFrom: %v", err)
+	}
+	want := map[string]interface{}{
+		"DEFAULT": map[string]interface{}{"name": "app"},
+		"server":  map[string]interface{}{"host": "a", "tls": map[string]interface{}{"enabled": "true"}},
+		"servers": []interface{}{map[string]interface{}{"host": "b"}, map[string]interface{}{"host": "c"}},
+		"ports":   map[string]interface{}{"0": "80"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("map %v, want %v", got, want)
+	}
+
+	if _, err := (&INIConfigReader{}).ReadConfigToMapFrom(strings.NewReader("[server]\ntls = on\n[server.tls]\nenabled = true\n")); err == nil {
+		t.Fatal("ReadConfigToMapFrom of a section conflicting with a key succeeded")
+	}
+}
+
+func TestINIUpdateConfigKeepsSections(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "config.ini")
+	original := "name = app\n\n[servers.1]\nhost = a\n\n[servers.2]\nhost = b\n\n[servers.3]\nhost = c\n\n; kept for the admin tool\n[admin]\n; listen port\nport = 9000\n"
+	if err := os.WriteFile(filename, []byte(original), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	update := iniSectionsConfig{Name: "svc", Servers: []iniServer{{Host: "a"}, {Host: "d"}}}
+	if err := (&INIConfigReader{}).UpdateConfig(filename, &update); err != nil {
+		t.Fatalf("UpdateConfig: %v", err)
+	}
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"[servers.1]", "[servers.2]", "; kept for the admin tool\n[admin]", "; listen port\nport = 9000"} {
+		if !bytes.Contains(content, []byte(want)) {
+			t.Fatalf("updated file lacks %q:\n%s", want, content)
+		}
+	}
+	for _, unwanted := range []string{"[servers.0]", "[servers.3]"} {
+		if bytes.Contains(content, []byte(unwanted)) {
+			t.Fatalf("updated file holds %q:\n%s", unwanted, content)
+		}
+	}
+
+	// The kept section does not map to a field, so the file only decodes into a type holding it.
+	var got struct {
+		iniSectionsConfig
+		Admin struct {
+			Port int `ini:"port"`
+		} `ini:"admin"`
+	}
+	if err := (&INIConfigReader{}).ReadConfig(filename, &got); err != nil {
+		t.Fatalf("ReadConfig of the updated file: %v", err)
+	}
+	if got.Name != "svc" || !reflect.DeepEqual(got.Servers, update.Servers) || got.Admin.Port != 9000 {
+		t.Fatalf("updated file holds %+v", got)
+	}
+}
@@ -3,20 +3,21 @@ package readers
 import (
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
+	"io"
 	"sync"
 )
 
 // JSONConfigReader implements the ConfigReader interface for JSON configuration files.
 type JSONConfigReader struct {
-	mu sync.Mutex // Mutex to ensure thread safety during file read and write operations.
+	Source            // Where and how configuration files are read and written
+	mu     sync.Mutex // Mutex to ensure thread safety during file read and write operations.
 }
 
 // ReadConfig reads the content of a JSON configuration file into the provided struct.
 func (j *JSONConfigReader) ReadConfig(filename string, v interface{}) error {
 	j.mu.Lock()
 	defer j.mu.Unlock()
-	fileContent, err := ioutil.ReadFile(filename)
+	fileContent, err := j.readFile(filename)
 	if err != nil {
 		return fmt.Errorf("error reading JSON file: %v\n", err)
 	}
@@ -28,11 +29,25 @@ func (j *JSONConfigReader) ReadConfig(filename string, v interface{}) error {
 	return nil
 }
 
+// ReadConfigFrom reads JSON configuration content from the stream into the provided struct.
+func (j *JSONConfigReader) ReadConfigFrom(r io.Reader, v interface{}) error {
+	content, err := j.readStream(r)
+	if err != nil {
+		return fmt.Errorf("error reading JSON stream: %v\n", err)
+	}
+
+	if err := json.Unmarshal(content, &v); err != nil {
+		return fmt.Errorf("error unmarshalling JSON content: %v\n", err)
+	}
+
+	return nil
+}
+
 // ReadConfigToMap reads the content of a JSON configuration file into a map.
 func (j *JSONConfigReader) ReadConfigToMap(filename string) (map[string]interface{}, error) {
 	j.mu.Lock()
 	defer j.mu.Unlock()
-	fileContent, err := ioutil.ReadFile(filename)
+	fileContent, err := j.readFile(filename)
 	if err != nil {
 		return nil, fmt.Errorf("error reading JSON file: %v\n", err)
 	}
@@ -45,6 +60,21 @@ func (j *JSONConfigReader) ReadConfigToMap(filename string) (map[string]interfac
 	return configMap, nil
 }
 
+// ReadConfigToMapFrom reads JSON configuration content from the stream into a map.
+func (j *JSONConfigReader) ReadConfigToMapFrom(r io.Reader) (map[string]interface{}, error) {
+	content, err := j.readStream(r)
+	if err != nil {
+		return nil, fmt.Errorf("error reading JSON stream: %v\n", err)
+	}
+
+	var configMap map[string]interface{}
+	if err := json.Unmarshal(content, &configMap); err != nil {
+		return nil, fmt.Errorf("error unmarshalling JSON content: %v\n", err)
+	}
+
+	return configMap, nil
+}
+
 // UpdateConfig writes the provided struct as JSON to the configuration file.
 func (j *JSONConfigReader) UpdateConfig(filename string, v interface{}) error {
 	j.mu.Lock()
@@ -53,9 +83,22 @@ func (j *JSONConfigReader) UpdateConfig(filename string, v interface{}) error {
 	if err != nil {
 		return fmt.Errorf("error marshalling JSON content: %v", err)
 	}
-	err = ioutil.WriteFile(filename, jsonData, 0644)
+	err = j.writeFile(filename, jsonData)
+	if err != nil {
+		return fmt.Errorf("error writing JSON file: %w", err)
+	}
+
+	return nil
+}
+
+// WriteConfigTo writes the provided struct as JSON to the stream.
+func (j *JSONConfigReader) WriteConfigTo(w io.Writer, v interface{}) error {
+	jsonData, err := json.MarshalIndent(v, "", "  ")
 	if err != nil {
-		return fmt.Errorf("error writing JSON file: %v", err)
+		return fmt.Errorf("error marshalling JSON content: %v", err)
+	}
+	if _, err := w.Write(jsonData); err != nil {
+		return fmt.Errorf("error writing JSON stream: %v", err)
 	}
 
 	return nil
@@ -0,0 +1,179 @@
+package readers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"sort"
+	"sync"
+)
+
+// ErrNoJsonnetEvaluator is wrapped by the errors of JsonnetConfigReader when its Evaluate function is not set.
+var ErrNoJsonnetEvaluator = errors.New("no Jsonnet evaluator set")
+
+// ErrJsonnetNotFound is wrapped by the errors of EvaluateJsonnetCommand when the jsonnet command-line tool is not
+// installed.
+var ErrJsonnetNotFound = errors.New("jsonnet binary not found")
+
+// JsonnetEvaluateFunc evaluates a Jsonnet file and returns the resulting JSON document.
+type JsonnetEvaluateFunc func(filename string, importPaths []string, extVars map[string]string) ([]byte, error)
+
+// JsonnetConfigReader implements the read-only Reader interface for Jsonnet configuration files.
+// The file is evaluated to JSON, which is then decoded like a JSON configuration.
+// mkconf does not embed a Jsonnet evaluator: set Evaluate to opt in, either to EvaluateJsonnetCommand, which runs the
+// jsonnet command-line tool and requires it to be installed, or to an embedded evaluator, e.g. built on
+// github.com/google/go-jsonnet. Without it, reading fails with ErrNoJsonnetEvaluator.
+// Files read from an fs.FS, see Source, are evaluated from a temporary copy, so imports must resolve through ImportPaths.
+type JsonnetConfigReader struct {
+	Source                          // Where configuration files are read from
+	ImportPaths []string            // Library search paths passed to the evaluator (-J)
+	ExtVars     map[string]string   // External string variables passed to the evaluator (--ext-str)
+	Evaluate    JsonnetEvaluateFunc // Evaluator of the files, e.g. EvaluateJsonnetCommand; reading fails if nil
+	mu          sync.Mutex          // Mutex to ensure thread safety during file read operations.
+}
+
+// ReadConfig evaluates a Jsonnet configuration file into the provided struct.
+func (j *JsonnetConfigReader) ReadConfig(filename string, v interface{}) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	jsonData, err := j.evaluate(filename)
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(jsonData, &v); err != nil {
+		return fmt.Errorf("error unmarshalling Jsonnet output: %v\n", err)
+	}
+
+	return nil
+}
+
+// ReadConfigFrom evaluates Jsonnet content from the stream into the provided struct.
+// Relative imports are resolved through ImportPaths only.
+func (j *JsonnetConfigReader) ReadConfigFrom(r io.Reader, v interface{}) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	local, cleanup, err := streamFile(r, "stdin.jsonnet")
+	if err != nil {
+		return fmt.Errorf("error reading Jsonnet stream: %v\n", err)
+	}
+	defer cleanup()
+
+	jsonData, err := j.evaluateLocal(local)
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(jsonData, &v); err != nil {
+		return fmt.Errorf("error unmarshalling Jsonnet output: %v\n", err)
+	}
+
+	return nil
+}
+
+// ReadConfigToMap evaluates a Jsonnet configuration file into a map.
+func (j *JsonnetConfigReader) ReadConfigToMap(filename string) (map[string]interface{}, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	jsonData, err := j.evaluate(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var configMap map[string]interface{}
+	if err := json.Unmarshal(jsonData, &configMap); err != nil {
+		return nil, fmt.Errorf("error unmarshalling Jsonnet output: %v\n", err)
+	}
+
+	return configMap, nil
+}
+
+// ReadConfigToMapFrom evaluates Jsonnet content from the stream into a map.
+func (j *JsonnetConfigReader) ReadConfigToMapFrom(r io.Reader) (map[string]interface{}, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	local, cleanup, err := streamFile(r, "stdin.jsonnet")
+	if err != nil {
+		return nil, fmt.Errorf("error reading Jsonnet stream: %v\n", err)
+	}
+	defer cleanup()
+
+	jsonData, err := j.evaluateLocal(local)
+	if err != nil {
+		return nil, err
+	}
+
+	var configMap map[string]interface{}
+	if err := json.Unmarshal(jsonData, &configMap); err != nil {
+		return nil, fmt.Errorf("error unmarshalling Jsonnet output: %v\n", err)
+	}
+
+	return configMap, nil
+}
+
+// evaluate runs the configured evaluator on the file, on a temporary copy if it is not on the OS file system.
+func (j *JsonnetConfigReader) evaluate(filename string) ([]byte, error) {
+	local, cleanup, err := j.localFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("error reading Jsonnet file: %v\n", err)
+	}
+	defer cleanup()
+
+	return j.evaluateLocal(local)
+}
+
+// evaluateLocal runs the configured evaluator on a file on the OS file system.
+func (j *JsonnetConfigReader) evaluateLocal(filename string) ([]byte, error) {
+	if j.Evaluate == nil {
+		return nil, fmt.Errorf("error evaluating Jsonnet file: %w: set an evaluator, e.g. EvaluateJsonnetCommand\n", ErrNoJsonnetEvaluator)
+	}
+
+	jsonData, err := j.Evaluate(filename, j.ImportPaths, j.ExtVars)
+	if err != nil {
+		return nil, fmt.Errorf("error evaluating Jsonnet file: %w\n", err)
+	}
+	return jsonData, nil
+}
+
+// EvaluateJsonnetCommand evaluates a Jsonnet file using the jsonnet command-line tool, which must be installed.
+// It fails with ErrJsonnetNotFound if jsonnet is not found in PATH.
+func EvaluateJsonnetCommand(filename string, importPaths []string, extVars map[string]string) ([]byte, error) {
+	if _, err := exec.LookPath("jsonnet"); err != nil {
+		return nil, fmt.Errorf("%w in PATH: install it from https://jsonnet.org or set another evaluator", ErrJsonnetNotFound)
+	}
+
+	args := make([]string, 0, 2*len(importPaths)+2*len(extVars)+1)
+	for _, path := range importPaths {
+		args = append(args, "-J", path)
+	}
+
+	names := make([]string, 0, len(extVars))
+	for name := range extVars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		args = append(args, "--ext-str", name+"="+extVars[name])
+	}
+	args = append(args, filename)
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("jsonnet", args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if stderr.Len() > 0 {
+			return nil, fmt.Errorf("%v: %s", err, bytes.TrimSpace(stderr.Bytes()))
+		}
+		return nil, err
+	}
+
+	return stdout.Bytes(), nil
+}
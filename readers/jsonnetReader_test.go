@@ -0,0 +1,47 @@
+package readers
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestJsonnetConfigReaderRequiresEvaluator(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "config.jsonnet")
+	if err := os.WriteFile(filename, []byte("{ port: 8000 + 80 }\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var config struct {
+		Port int `json:"port"`
+	}
+
+	if err := (&JsonnetConfigReader{}).ReadConfig(filename, &config); !errors.Is(err, ErrNoJsonnetEvaluator) {
+		t.Fatalf("ReadConfig without evaluator = %v, want %v", err, ErrNoJsonnetEvaluator)
+	}
+
+	var gotPaths []string
+	var gotVars map[string]string
+	jsonnetReader := &JsonnetConfigReader{
+		ImportPaths: []string{"lib"},
+		ExtVars:     map[string]string{"env": "prod"},
+		Evaluate: func(filename string, importPaths []string, extVars map[string]string) ([]byte, error) {
+			gotPaths, gotVars = importPaths, extVars
+			return []byte(`{"port": 8080}`), nil
+		},
+	}
+	if err := jsonnetReader.ReadConfig(filename, &config); err != nil {
+		t.Fatalf("ReadConfig: %v", err)
+	}
+	if config.Port != 8080 || !reflect.DeepEqual(gotPaths, []string{"lib"}) || gotVars["env"] != "prod" {
+		t.Fatalf("evaluated into %+v with import paths %v and ext vars %v", config, gotPaths, gotVars)
+	}
+}
+
+func TestEvaluateJsonnetCommandReportsMissingBinary(t *testing.T) {
+	t.Setenv("PATH", t.TempDir())
+	if _, err := EvaluateJsonnetCommand("config.jsonnet", nil, nil); !errors.Is(err, ErrJsonnetNotFound) {
+		t.Fatalf("EvaluateJsonnetCommand without jsonnet in PATH = %v, want %v", err, ErrJsonnetNotFound)
+	}
+}
@@ -0,0 +1,868 @@
+package readers
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf16"
+)
+
+// PlistConfigReader implements the ConfigReader interface for Apple property list files.
+// Both XML and binary (bplist00) plists are supported. Struct fields are matched using their json tags.
+// UpdateConfig keeps the format of the existing file and writes XML for new files.
+type PlistConfigReader struct {
+	Source            // Where and how configuration files are read and written
+	mu     sync.Mutex // Mutex to ensure thread safety during file read and write operations.
+}
+
+// plistEpoch is the reference date for plist dates (2001-01-01 00:00:00 UTC).
+var plistEpoch = time.Date(2001, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// ReadConfig reads the content of a plist configuration file into the provided struct.
+func (p *PlistConfigReader) ReadConfig(filename string, v interface{}) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	value, err := p.readPlistFile(filename)
+	if err != nil {
+		return err
+	}
+
+	return plistInto(value, v)
+}
+
+// ReadConfigFrom reads XML or binary plist content from the stream into the provided struct.
+func (p *PlistConfigReader) ReadConfigFrom(r io.Reader, v interface{}) error {
+	content, err := ioutil.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("error reading plist stream: %v\n", err)
+	}
+
+	value, err := p.decodePlist("", content)
+	if err != nil {
+		return err
+	}
+
+	return plistInto(value, v)
+}
+
+// plistInto maps decoded plist values onto the provided struct using its json tags.
+func plistInto(value interface{}, v interface{}) error {
+	jsonData, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("error unmarshalling plist content: %v\n", err)
+	}
+
+	if err := json.Unmarshal(jsonData, &v); err != nil {
+		return fmt.Errorf("error unmarshalling plist content: %v\n", err)
+	}
+
+	return nil
+}
+
+// ReadConfigToMap reads the content of a plist configuration file into a map.
+func (p *PlistConfigReader) ReadConfigToMap(filename string) (map[string]interface{}, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	value, err := p.readPlistFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	return plistMap(value)
+}
+
+// ReadConfigToMapFrom reads XML or binary plist content from the stream into a map.
+func (p *PlistConfigReader) ReadConfigToMapFrom(r io.Reader) (map[string]interface{}, error) {
+	content, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("error reading plist stream: %v\n", err)
+	}
+
+	value, err := p.decodePlist("", content)
+	if err != nil {
+		return nil, err
+	}
+
+	return plistMap(value)
+}
+
+// plistMap returns the top-level dict of decoded plist values.
+func plistMap(value interface{}) (map[string]interface{}, error) {
+	configMap, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("error unmarshalling plist content: top-level object is not a dict\n")
+	}
+
+	return configMap, nil
+}
+
+// UpdateConfig writes the provided struct as plist to the configuration file.
+func (p *PlistConfigReader) UpdateConfig(filename string, v interface{}) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	value, err := plistValue(v)
+	if err != nil {
+		return err
+	}
+
+	binaryFormat := false
+	if existing, err := p.readRawFile(filename); err == nil {
+		binaryFormat = bytes.HasPrefix(existing, []byte("bplist00"))
+	}
+
+	var data []byte
+	if binaryFormat {
+		data, err = encodeBinaryPlist(value)
+	} else {
+		data, err = encodeXMLPlist(value)
+	}
+	if err != nil {
+		return fmt.Errorf("error marshalling plist: %v", err)
+	}
+
+	if err := p.writeFile(filename, data); err != nil {
+		return fmt.Errorf("error writing plist file: %w", err)
+	}
+
+	return nil
+}
+
+// WriteConfigTo writes the provided struct as XML plist to the stream.
+func (p *PlistConfigReader) WriteConfigTo(w io.Writer, v interface{}) error {
+	value, err := plistValue(v)
+	if err != nil {
+		return err
+	}
+
+	data, err := encodeXMLPlist(value)
+	if err != nil {
+		return fmt.Errorf("error marshalling plist: %v", err)
+	}
+	if _, err := w.Write(data); err != nil {
+		return fmt.Errorf("error writing plist stream: %v", err)
+	}
+
+	return nil
+}
+
+// plistValue converts the provided struct into generic values using its json tags.
+func plistValue(v interface{}) (interface{}, error) {
+	jsonData, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("error marshalling plist: %v", err)
+	}
+
+	var value interface{}
+	decoder := json.NewDecoder(bytes.NewReader(jsonData))
+	decoder.UseNumber()
+	if err := decoder.Decode(&value); err != nil {
+		return nil, fmt.Errorf("error marshalling plist: %v", err)
+	}
+	return value, nil
+}
+
+// readPlistFile reads a plist file and decodes it into generic Go values.
+func (s Source) readPlistFile(filename string) (interface{}, error) {
+	fileContent, err := s.readRawFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("error reading plist file: %v\n", err)
+	}
+
+	return s.decodePlist(filename, fileContent)
+}
+
+// decodePlist decodes XML or binary plist content into generic Go values.
+func (s Source) decodePlist(filename string, fileContent []byte) (interface{}, error) {
+	var value interface{}
+	var err error
+	if bytes.HasPrefix(fileContent, []byte("bplist00")) {
+		value, err = decodeBinaryPlist(fileContent)
+	} else if fileContent, err = s.DecodeContent(filename, fileContent); err == nil {
+		value, err = decodeXMLPlist(fileContent)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error unmarshalling plist content: %v\n", err)
+	}
+
+	return value, nil
+}
+
+// decodeXMLPlist decodes an XML property list.
+func decodeXMLPlist(data []byte) (interface{}, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	decoder.Strict = false
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+		if start, ok := token.(xml.StartElement); ok {
+			if start.Name.Local == "plist" {
+				continue
+			}
+			return decodeXMLPlistValue(decoder, start)
+		}
+	}
+}
+
+// decodeXMLPlistValue decodes the element started by start.
+func decodeXMLPlistValue(decoder *xml.Decoder, start xml.StartElement) (interface{}, error) {
+	switch start.Name.Local {
+	case "dict":
+		dict := make(map[string]interface{})
+		var key *string
+		for {
+			token, err := decoder.Token()
+			if err != nil {
+				return nil, err
+			}
+			switch t := token.(type) {
+			case xml.StartElement:
+				if t.Name.Local == "key" {
+					var k string
+					if err := decoder.DecodeElement(&k, &t); err != nil {
+						return nil, err
+					}
+					key = &k
+					continue
+				}
+				if key == nil {
+					return nil, fmt.Errorf("plist dict value <%v> without key", t.Name.Local)
+				}
+				value, err := decodeXMLPlistValue(decoder, t)
+				if err != nil {
+					return nil, err
+				}
+				dict[*key] = value
+				key = nil
+			case xml.EndElement:
+				return dict, nil
+			}
+		}
+	case "array":
+		array := make([]interface{}, 0)
+		for {
+			token, err := decoder.Token()
+			if err != nil {
+				return nil, err
+			}
+			switch t := token.(type) {
+			case xml.StartElement:
+				value, err := decodeXMLPlistValue(decoder, t)
+				if err != nil {
+					return nil, err
+				}
+				array = append(array, value)
+			case xml.EndElement:
+				return array, nil
+			}
+		}
+	case "true", "false":
+		if err := decoder.Skip(); err != nil {
+			return nil, err
+		}
+		return start.Name.Local == "true", nil
+	}
+
+	var text string
+	if err := decoder.DecodeElement(&text, &start); err != nil {
+		return nil, err
+	}
+	text = strings.TrimSpace(text)
+
+	switch start.Name.Local {
+	case "string":
+		return text, nil
+	case "integer":
+		if i, err := strconv.ParseInt(text, 0, 64); err == nil {
+			return i, nil
+		}
+		u, err := strconv.ParseUint(text, 0, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid plist integer %q", text)
+		}
+		return u, nil
+	case "real":
+		f, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid plist real %q", text)
+		}
+		return f, nil
+	case "date":
+		t, err := time.Parse(time.RFC3339, text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid plist date %q", text)
+		}
+		return t, nil
+	case "data":
+		clean := strings.Map(func(r rune) rune {
+			if r == ' ' || r == '\n' || r == '\r' || r == '\t' {
+				return -1
+			}
+			return r
+		}, text)
+		data, err := base64.StdEncoding.DecodeString(clean)
+		if err != nil {
+			return nil, fmt.Errorf("invalid plist data: %v", err)
+		}
+		return data, nil
+	default:
+		return nil, fmt.Errorf("unsupported plist element <%v>", start.Name.Local)
+	}
+}
+
+// encodeXMLPlist encodes generic Go values as an XML property list.
+func encodeXMLPlist(value interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	buf.WriteString(`<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">` + "\n")
+	buf.WriteString(`<plist version="1.0">` + "\n")
+	if err := encodeXMLPlistValue(&buf, value, 0); err != nil {
+		return nil, err
+	}
+	buf.WriteString("</plist>\n")
+	return buf.Bytes(), nil
+}
+
+// encodeXMLPlistValue writes a single value with the given indentation depth.
+func encodeXMLPlistValue(buf *bytes.Buffer, value interface{}, depth int) error {
+	indent := strings.Repeat("\t", depth)
+	writeText := func(tag, text string) {
+		buf.WriteString(indent + "<" + tag + ">")
+		xml.EscapeText(buf, []byte(text))
+		buf.WriteString("</" + tag + ">\n")
+	}
+
+	switch val := value.(type) {
+	case nil:
+		writeText("string", "")
+	case map[string]interface{}:
+		buf.WriteString(indent + "<dict>\n")
+		keys := make([]string, 0, len(val))
+		for k := range val {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			buf.WriteString(indent + "\t<key>")
+			xml.EscapeText(buf, []byte(k))
+			buf.WriteString("</key>\n")
+			if err := encodeXMLPlistValue(buf, val[k], depth+1); err != nil {
+				return err
+			}
+		}
+		buf.WriteString(indent + "</dict>\n")
+	case []interface{}:
+		buf.WriteString(indent + "<array>\n")
+		for _, item := range val {
+			if err := encodeXMLPlistValue(buf, item, depth+1); err != nil {
+				return err
+			}
+		}
+		buf.WriteString(indent + "</array>\n")
+	case string:
+		writeText("string", val)
+	case bool:
+		if val {
+			buf.WriteString(indent + "<true/>\n")
+		} else {
+			buf.WriteString(indent + "<false/>\n")
+		}
+	case json.Number:
+		if _, err := val.Int64(); err == nil {
+			writeText("integer", val.String())
+		} else {
+			writeText("real", val.String())
+		}
+	case int64:
+		writeText("integer", strconv.FormatInt(val, 10))
+	case uint64:
+		writeText("integer", strconv.FormatUint(val, 10))
+	case float64:
+		writeText("real", strconv.FormatFloat(val, 'g', -1, 64))
+	case time.Time:
+		writeText("date", val.UTC().Format(time.RFC3339))
+	case []byte:
+		writeText("data", base64.StdEncoding.EncodeToString(val))
+	default:
+		return fmt.Errorf("unsupported plist value type %T", value)
+	}
+	return nil
+}
+
+// binaryPlistDecoder decodes binary (bplist00) property lists.
+type binaryPlistDecoder struct {
+	data          []byte   // Raw file content
+	offsets       []uint64 // Object offsets from the offset table
+	objectRefSize int      // Size of object references in bytes
+	depth         int      // Current nesting depth, used to reject reference cycles
+}
+
+// decodeBinaryPlist decodes a binary property list.
+func decodeBinaryPlist(data []byte) (interface{}, error) {
+	if len(data) < 8+32 {
+		return nil, fmt.Errorf("binary plist is too short")
+	}
+
+	trailer := data[len(data)-32:]
+	offsetIntSize := int(trailer[6])
+	objectRefSize := int(trailer[7])
+	numObjects := binary.BigEndian.Uint64(trailer[8:16])
+	topObject := binary.BigEndian.Uint64(trailer[16:24])
+	offsetTableOffset := binary.BigEndian.Uint64(trailer[24:32])
+
+	if offsetIntSize == 0 || offsetIntSize > 8 || objectRefSize == 0 || objectRefSize > 8 {
+		return nil, fmt.Errorf("invalid binary plist trailer")
+	}
+	// The sizes are checked by division first, so crafted trailers cannot overflow the bounds check.
+	tableEnd := uint64(len(data) - 32)
+	if numObjects == 0 || topObject >= numObjects || offsetTableOffset > tableEnd ||
+		numObjects > (tableEnd-offsetTableOffset)/uint64(offsetIntSize) {
+		return nil, fmt.Errorf("invalid binary plist offset table")
+	}
+
+	d := &binaryPlistDecoder{data: data, objectRefSize: objectRefSize}
+	d.offsets = make([]uint64, numObjects)
+	for i := range d.offsets {
+		start := offsetTableOffset + uint64(i*offsetIntSize)
+		d.offsets[i] = readBigEndian(data[start : start+uint64(offsetIntSize)])
+	}
+
+	return d.object(topObject)
+}
+
+// object decodes the object with the given reference.
+func (d *binaryPlistDecoder) object(ref uint64) (interface{}, error) {
+	if ref >= uint64(len(d.offsets)) {
+		return nil, fmt.Errorf("binary plist object reference %d out of range", ref)
+	}
+	d.depth++
+	defer func() { d.depth-- }()
+	if d.depth > 512 {
+		return nil, fmt.Errorf("binary plist is nested too deeply")
+	}
+
+	offset := d.offsets[ref]
+	if offset >= uint64(len(d.data)) {
+		return nil, fmt.Errorf("binary plist object offset out of range")
+	}
+	marker := d.data[offset]
+	kind, info := marker>>4, int(marker&0x0f)
+	pos := offset + 1
+
+	switch kind {
+	case 0x0:
+		switch marker {
+		case 0x08:
+			return false, nil
+		case 0x09:
+			return true, nil
+		default:
+			return nil, nil
+		}
+	case 0x1:
+		size := uint64(1) << uint(info)
+		raw, err := d.slice(pos, size)
+		if err != nil {
+			return nil, err
+		}
+		if size == 16 {
+			raw = raw[8:]
+		}
+		if len(raw) == 8 {
+			return int64(binary.BigEndian.Uint64(raw)), nil
+		}
+		return int64(readBigEndian(raw)), nil
+	case 0x2:
+		size := uint64(1) << uint(info)
+		raw, err := d.slice(pos, size)
+		if err != nil {
+			return nil, err
+		}
+		if size == 4 {
+			return float64(math.Float32frombits(binary.BigEndian.Uint32(raw))), nil
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(raw)), nil
+	case 0x3:
+		raw, err := d.slice(pos, 8)
+		if err != nil {
+			return nil, err
+		}
+		seconds := math.Float64frombits(binary.BigEndian.Uint64(raw))
+		return plistEpoch.Add(time.Duration(seconds * float64(time.Second))), nil
+	case 0x4, 0x5, 0x6, 0x8, 0xA, 0xD:
+	default:
+		return nil, fmt.Errorf("unsupported binary plist marker 0x%02x", marker)
+	}
+
+	count, pos, err := d.count(info, pos)
+	if err != nil {
+		return nil, err
+	}
+
+	switch kind {
+	case 0x4:
+		raw, err := d.slice(pos, count)
+		if err != nil {
+			return nil, err
+		}
+		return append([]byte(nil), raw...), nil
+	case 0x5:
+		raw, err := d.slice(pos, count)
+		if err != nil {
+			return nil, err
+		}
+		return string(raw), nil
+	case 0x6:
+		if count > uint64(len(d.data))/2 {
+			return nil, fmt.Errorf("binary plist object exceeds file size")
+		}
+		raw, err := d.slice(pos, count*2)
+		if err != nil {
+			return nil, err
+		}
+		units := make([]uint16, count)
+		for i := range units {
+			units[i] = binary.BigEndian.Uint16(raw[i*2:])
+		}
+		return string(utf16.Decode(units)), nil
+	case 0x8:
+		raw, err := d.slice(offset+1, uint64(info)+1)
+		if err != nil {
+			return nil, err
+		}
+		return int64(readBigEndian(raw)), nil
+	case 0xA:
+		refs, err := d.refs(pos, count)
+		if err != nil {
+			return nil, err
+		}
+		array := make([]interface{}, 0, len(refs))
+		for _, r := range refs {
+			item, err := d.object(r)
+			if err != nil {
+				return nil, err
+			}
+			array = append(array, item)
+		}
+		return array, nil
+	default:
+		if count > uint64(len(d.data))/2 {
+			return nil, fmt.Errorf("binary plist object exceeds file size")
+		}
+		refs, err := d.refs(pos, count*2)
+		if err != nil {
+			return nil, err
+		}
+		dict := make(map[string]interface{}, count)
+		for i := uint64(0); i < count; i++ {
+			key, err := d.object(refs[i])
+			if err != nil {
+				return nil, err
+			}
+			keyString, ok := key.(string)
+			if !ok {
+				return nil, fmt.Errorf("binary plist dict key is not a string")
+			}
+			value, err := d.object(refs[count+i])
+			if err != nil {
+				return nil, err
+			}
+			dict[keyString] = value
+		}
+		return dict, nil
+	}
+}
+
+// count reads the length of a collection, which may be stored as a trailing integer object.
+func (d *binaryPlistDecoder) count(info int, pos uint64) (uint64, uint64, error) {
+	if info != 0x0f {
+		return uint64(info), pos, nil
+	}
+	if pos >= uint64(len(d.data)) || d.data[pos]>>4 != 0x1 {
+		return 0, 0, fmt.Errorf("invalid binary plist length marker")
+	}
+	size := uint64(1) << uint(d.data[pos]&0x0f)
+	raw, err := d.slice(pos+1, size)
+	if err != nil {
+		return 0, 0, err
+	}
+	return readBigEndian(raw), pos + 1 + size, nil
+}
+
+// refs reads n object references starting at pos.
+func (d *binaryPlistDecoder) refs(pos, n uint64) ([]uint64, error) {
+	if n > uint64(len(d.data))/uint64(d.objectRefSize) {
+		return nil, fmt.Errorf("binary plist object exceeds file size")
+	}
+	raw, err := d.slice(pos, n*uint64(d.objectRefSize))
+	if err != nil {
+		return nil, err
+	}
+	refs := make([]uint64, n)
+	for i := range refs {
+		start := i * d.objectRefSize
+		refs[i] = readBigEndian(raw[start : start+d.objectRefSize])
+	}
+	return refs, nil
+}
+
+// slice returns size bytes starting at pos, checking bounds.
+func (d *binaryPlistDecoder) slice(pos, size uint64) ([]byte, error) {
+	if pos+size < pos || pos+size > uint64(len(d.data)) {
+		return nil, fmt.Errorf("binary plist object exceeds file size")
+	}
+	return d.data[pos : pos+size], nil
+}
+
+// readBigEndian reads an unsigned big-endian integer of up to 8 bytes.
+func readBigEndian(raw []byte) uint64 {
+	var n uint64
+	for _, b := range raw {
+		n = n<<8 | uint64(b)
+	}
+	return n
+}
+
+// binaryPlistEncoder encodes generic Go values as a binary (bplist00) property list.
+type binaryPlistEncoder struct {
+	objects [][]byte // Encoded objects; references are filled in after all objects are known
+	refSize int      // Size of object references in bytes
+}
+
+// encodeBinaryPlist encodes generic Go values as a binary property list.
+func encodeBinaryPlist(value interface{}) ([]byte, error) {
+	e := &binaryPlistEncoder{}
+	total := countPlistObjects(value)
+	switch {
+	case total < 1<<8:
+		e.refSize = 1
+	case total < 1<<16:
+		e.refSize = 2
+	default:
+		e.refSize = 4
+	}
+
+	if _, err := e.add(value); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("bplist00")
+	offsets := make([]uint64, len(e.objects))
+	for i, object := range e.objects {
+		offsets[i] = uint64(buf.Len())
+		buf.Write(object)
+	}
+
+	offsetTableOffset := uint64(buf.Len())
+	offsetIntSize := bytesNeeded(offsetTableOffset)
+	for _, offset := range offsets {
+		writeBigEndian(&buf, offset, offsetIntSize)
+	}
+
+	trailer := make([]byte, 32)
+	trailer[6] = byte(offsetIntSize)
+	trailer[7] = byte(e.refSize)
+	binary.BigEndian.PutUint64(trailer[8:], uint64(len(e.objects)))
+	binary.BigEndian.PutUint64(trailer[16:], 0)
+	binary.BigEndian.PutUint64(trailer[24:], offsetTableOffset)
+	buf.Write(trailer)
+
+	return buf.Bytes(), nil
+}
+
+// countPlistObjects returns the number of objects needed to encode value.
+func countPlistObjects(value interface{}) int {
+	switch val := value.(type) {
+	case map[string]interface{}:
+		n := 1
+		for _, item := range val {
+			n += 1 + countPlistObjects(item)
+		}
+		return n
+	case []interface{}:
+		n := 1
+		for _, item := range val {
+			n += countPlistObjects(item)
+		}
+		return n
+	default:
+		return 1
+	}
+}
+
+// add encodes value and its children, returning the object reference of value.
+func (e *binaryPlistEncoder) add(value interface{}) (uint64, error) {
+	ref := uint64(len(e.objects))
+	e.objects = append(e.objects, nil)
+
+	var buf bytes.Buffer
+	switch val := value.(type) {
+	case nil:
+		buf.WriteByte(0x00)
+	case bool:
+		if val {
+			buf.WriteByte(0x09)
+		} else {
+			buf.WriteByte(0x08)
+		}
+	case json.Number:
+		if i, err := val.Int64(); err == nil {
+			writePlistInt(&buf, i)
+		} else {
+			f, err := val.Float64()
+			if err != nil {
+				return 0, err
+			}
+			writePlistReal(&buf, f)
+		}
+	case int64:
+		writePlistInt(&buf, val)
+	case uint64:
+		writePlistInt(&buf, int64(val))
+	case float64:
+		writePlistReal(&buf, val)
+	case time.Time:
+		buf.WriteByte(0x33)
+		seconds := val.Sub(plistEpoch).Seconds()
+		binary.Write(&buf, binary.BigEndian, math.Float64bits(seconds))
+	case []byte:
+		writePlistHeader(&buf, 0x4, len(val))
+		buf.Write(val)
+	case string:
+		if isASCII(val) {
+			writePlistHeader(&buf, 0x5, len(val))
+			buf.WriteString(val)
+		} else {
+			units := utf16.Encode([]rune(val))
+			writePlistHeader(&buf, 0x6, len(units))
+			for _, u := range units {
+				binary.Write(&buf, binary.BigEndian, u)
+			}
+		}
+	case []interface{}:
+		refs := make([]uint64, 0, len(val))
+		for _, item := range val {
+			r, err := e.add(item)
+			if err != nil {
+				return 0, err
+			}
+			refs = append(refs, r)
+		}
+		writePlistHeader(&buf, 0xA, len(refs))
+		for _, r := range refs {
+			writeBigEndian(&buf, r, e.refSize)
+		}
+	case map[string]interface{}:
+		keys := make([]string, 0, len(val))
+		for k := range val {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		keyRefs := make([]uint64, 0, len(keys))
+		valueRefs := make([]uint64, 0, len(keys))
+		for _, k := range keys {
+			r, err := e.add(k)
+			if err != nil {
+				return 0, err
+			}
+			keyRefs = append(keyRefs, r)
+		}
+		for _, k := range keys {
+			r, err := e.add(val[k])
+			if err != nil {
+				return 0, err
+			}
+			valueRefs = append(valueRefs, r)
+		}
+		writePlistHeader(&buf, 0xD, len(keys))
+		for _, r := range append(keyRefs, valueRefs...) {
+			writeBigEndian(&buf, r, e.refSize)
+		}
+	default:
+		return 0, fmt.Errorf("unsupported plist value type %T", value)
+	}
+
+	e.objects[ref] = buf.Bytes()
+	return ref, nil
+}
+
+// writePlistHeader writes a marker with an inline or trailing length.
+func writePlistHeader(buf *bytes.Buffer, kind byte, count int) {
+	if count < 0x0f {
+		buf.WriteByte(kind<<4 | byte(count))
+		return
+	}
+	buf.WriteByte(kind<<4 | 0x0f)
+	writePlistInt(buf, int64(count))
+}
+
+// writePlistInt writes an integer object using the smallest suitable width.
+func writePlistInt(buf *bytes.Buffer, i int64) {
+	switch {
+	case i >= 0 && i < 1<<8:
+		buf.WriteByte(0x10)
+		buf.WriteByte(byte(i))
+	case i >= 0 && i < 1<<16:
+		buf.WriteByte(0x11)
+		writeBigEndian(buf, uint64(i), 2)
+	case i >= 0 && i < 1<<32:
+		buf.WriteByte(0x12)
+		writeBigEndian(buf, uint64(i), 4)
+	default:
+		buf.WriteByte(0x13)
+		writeBigEndian(buf, uint64(i), 8)
+	}
+}
+
+// writePlistReal writes a 64-bit real object.
+func writePlistReal(buf *bytes.Buffer, f float64) {
+	buf.WriteByte(0x23)
+	binary.Write(buf, binary.BigEndian, math.Float64bits(f))
+}
+
+// writeBigEndian writes n as a big-endian integer of the given size.
+func writeBigEndian(buf *bytes.Buffer, n uint64, size int) {
+	for i := size - 1; i >= 0; i-- {
+		buf.WriteByte(byte(n >> (uint(i) * 8)))
+	}
+}
+
+// bytesNeeded returns the number of bytes needed to store n (1, 2, 4 or 8).
+func bytesNeeded(n uint64) int {
+	switch {
+	case n < 1<<8:
+		return 1
+	case n < 1<<16:
+		return 2
+	case n < 1<<32:
+		return 4
+	default:
+		return 8
+	}
+}
+
+// isASCII reports whether s contains only ASCII characters.
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,76 @@
+package readers
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+// binaryPlist assembles a binary plist from the encoded objects following the header and a crafted trailer.
+func binaryPlist(objects []byte, offsetIntSize, objectRefSize byte, numObjects, topObject, offsetTableOffset uint64, offsets []byte) []byte {
+	data := append([]byte("bplist00"), objects...)
+	data = append(data, offsets...)
+	trailer := make([]byte, 32)
+	trailer[6] = offsetIntSize
+	trailer[7] = objectRefSize
+	binary.BigEndian.PutUint64(trailer[8:16], numObjects)
+	binary.BigEndian.PutUint64(trailer[16:24], topObject)
+	binary.BigEndian.PutUint64(trailer[24:32], offsetTableOffset)
+	return append(data, trailer...)
+}
+
+func TestDecodeBinaryPlistRejectsCraftedSizes(t *testing.T) {
+	// A dict, array or UTF-16 string whose length is stored as the 8-byte integer 1<<63.
+	hugeCount := func(marker byte) []byte {
+		return []byte{marker, 0x13, 0x80, 0, 0, 0, 0, 0, 0, 0}
+	}
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"object count overflowing the offset table", binaryPlist([]byte{0x08}, 8, 1, 1<<61, 0, 8, nil)},
+		{"offset table beyond the trailer", binaryPlist([]byte{0x08}, 1, 1, 1, 0, 1<<63, []byte{8})},
+		{"dict count overflowing the references", binaryPlist(hugeCount(0xDF), 1, 1, 1, 0, 18, []byte{8})},
+		{"array count overflowing the references", binaryPlist(hugeCount(0xAF), 8, 8, 1, 0, 18, []byte{0, 0, 0, 0, 0, 0, 0, 8})},
+		{"UTF-16 string count overflowing its size", binaryPlist(hugeCount(0x6F), 1, 1, 1, 0, 18, []byte{8})},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				if r := recover(); r != nil {
+					t.Fatalf("decodeBinaryPlist panicked: %v", r)
+				}
+			}()
+			if _, err := decodeBinaryPlist(tt.data); err == nil {
+				t.Fatal("decodeBinaryPlist succeeded, want an error")
+			}
+			if _, err := (&PlistConfigReader{}).ReadConfigToMapFrom(bytes.NewReader(tt.data)); err == nil {
+				t.Fatal("ReadConfigToMapFrom succeeded, want an error")
+			}
+		})
+	}
+}
+
+func TestBinaryPlistRoundTrip(t *testing.T) {
+	value := map[string]interface{}{
+		"name":    "mkconf",
+		"unicode": "größe",
+		"enabled": true,
+		"port":    int64(8080),
+		"ratio":   0.5,
+		"tags":    []interface{}{"a", "b"},
+		"nested":  map[string]interface{}{"depth": int64(2)},
+	}
+	data, err := encodeBinaryPlist(value)
+	if err != nil {
+		t.Fatalf("encodeBinaryPlist: %v", err)
+	}
+	decoded, err := decodeBinaryPlist(data)
+	if err != nil {
+		t.Fatalf("decodeBinaryPlist: %v", err)
+	}
+	if !reflect.DeepEqual(decoded, value) {
+		t.Fatalf("decoded %#v, want %#v", decoded, value)
+	}
+}
@@ -0,0 +1,481 @@
+package readers
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/pelletier/go-toml"
+)
+
+// errTOMLNotPatchable is returned when a TOML document cannot be patched in place and has to be rewritten.
+var errTOMLNotPatchable = errors.New("document cannot be patched in place")
+
+// tomlSection is a table of a TOML document and the lines it spans.
+type tomlSection struct {
+	path     []string // Path of the table; empty for the root table
+	array    bool     // Flag indicating an array of tables ([[path]])
+	header   int      // Index of the header line, -1 for the root table
+	end      int      // Index after the last line of the section
+	contents []string // Patched lines of the section, without the header
+}
+
+// patchTOML updates the TOML document so that it represents v, keeping comments, whitespace, key and table order
+// of every entry whose value did not change. Changed values are replaced on their line, removed keys and tables are
+// dropped and new keys are appended to their table. Arrays of tables are rewritten only if the whole document is.
+func patchTOML(original []byte, v interface{}) ([]byte, error) {
+	oldTree, err := toml.LoadBytes(original)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := toml.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	newTree, err := toml.LoadBytes(buf.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	oldMap, newMap := oldTree.ToMap(), newTree.ToMap()
+
+	lines := strings.Split(string(original), "\n")
+	sections := scanTOMLSections(lines)
+
+	seenTables := map[string]bool{"": true}
+	seenKeys := make(map[string]bool)
+	var out []string
+	for i := range sections {
+		section := &sections[i]
+		markTOMLTable(seenTables, section.path, true)
+		body := lines[section.header+1 : section.end]
+
+		if section.array || insideTOMLArray(sections, section.path) {
+			oldValue, _ := lookupTOMLPath(oldMap, section.path)
+			newValue, _ := lookupTOMLPath(newMap, section.path)
+			if !reflect.DeepEqual(oldValue, newValue) {
+				return nil, errTOMLNotPatchable
+			}
+			start := section.header
+			if start < 0 {
+				start = 0
+			}
+			out = append(out, lines[start:section.end]...)
+			seenKeys[strings.Join(section.path, "\x00")] = true
+			continue
+		}
+
+		if section.header >= 0 {
+			if _, ok := lookupTOMLPath(newMap, section.path); !ok {
+				continue // Removed table.
+			}
+			out = append(out, lines[section.header])
+		}
+
+		patched, err := patchTOMLSection(body, section.path, oldMap, newMap, seenTables, seenKeys)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, patched...)
+	}
+
+	// Keys of existing tables were appended by patchTOMLSection; new tables are appended at the end.
+	added, err := missingTOMLTables(newMap, nil, seenTables, seenKeys)
+	if err != nil {
+		return nil, err
+	}
+	if len(added) > 0 {
+		insert := len(out)
+		for insert > 0 && strings.TrimSpace(out[insert-1]) == "" {
+			insert--
+		}
+		tail := append([]string(nil), out[insert:]...)
+		out = append(append(out[:insert], added...), tail...)
+	}
+
+	return []byte(strings.Join(out, "\n")), nil
+}
+
+// patchTOMLSection patches the key lines of a table and appends keys of the table that are missing in the file.
+func patchTOMLSection(body []string, path []string, oldMap, newMap map[string]interface{}, seenTables, seenKeys map[string]bool) ([]string, error) {
+	var out []string
+	for i := 0; i < len(body); i++ {
+		line := body[i]
+		key, prefix, _, comment, ok := splitTOMLKeyLine(line)
+		if !ok {
+			out = append(out, line)
+			continue
+		}
+
+		last := i + tomlValueLines(body[i:]) - 1
+		fullPath := append(append([]string(nil), path...), key...)
+		seenKeys[strings.Join(fullPath, "\x00")] = true
+		markTOMLTable(seenTables, fullPath[:len(fullPath)-1], false)
+		newValue, inNew := lookupTOMLPath(newMap, fullPath)
+		oldValue, inOld := lookupTOMLPath(oldMap, fullPath)
+		switch {
+		case !inNew:
+			// Removed key.
+		case inOld && reflect.DeepEqual(oldValue, newValue):
+			out = append(out, body[i:last+1]...)
+		default:
+			rendered, err := renderTOMLValue(newValue)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, prefix+rendered+comment)
+		}
+		i = last
+	}
+
+	table, ok := lookupTOMLPath(newMap, path)
+	if !ok {
+		return out, nil
+	}
+	tableMap, _ := table.(map[string]interface{})
+	keys := make([]string, 0, len(tableMap))
+	for key, value := range tableMap {
+		if _, isTable := value.(map[string]interface{}); isTable || isTOMLTableArray(value) {
+			continue
+		}
+		fullPath := append(append([]string(nil), path...), key)
+		if !seenKeys[strings.Join(fullPath, "\x00")] {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	insert := len(out)
+	for insert > 0 && strings.TrimSpace(out[insert-1]) == "" {
+		insert--
+	}
+	var added []string
+	for _, key := range keys {
+		rendered, err := renderTOMLValue(tableMap[key])
+		if err != nil {
+			return nil, err
+		}
+		added = append(added, quoteTOMLKey(key)+" = "+rendered)
+		seenKeys[strings.Join(append(append([]string(nil), path...), key), "\x00")] = true
+	}
+	tail := append([]string(nil), out[insert:]...)
+	return append(append(out[:insert], added...), tail...), nil
+}
+
+// missingTOMLTables renders the tables of m below path that are not present in the file.
+// seenTables holds the tables defined by a header (true) or only implied by sub-tables and dotted keys (false).
+func missingTOMLTables(m map[string]interface{}, path []string, seenTables, seenKeys map[string]bool) ([]string, error) {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var out []string
+	for _, name := range names {
+		childPath := append(append([]string(nil), path...), name)
+		if seenKeys[strings.Join(childPath, "\x00")] {
+			continue // Defined by a dotted key or inline table.
+		}
+		tablePath := strings.Join(childPath, ".")
+		explicit, seen := seenTables[tablePath]
+		switch value := m[name].(type) {
+		case map[string]interface{}:
+			if !seen {
+				rendered, err := renderTOMLTable(nestTOMLMap(childPath, value))
+				if err != nil {
+					return nil, err
+				}
+				out = append(out, rendered...)
+				continue
+			}
+			if !explicit {
+				// Keys of an implied table can only be added by restructuring the document.
+				for key, item := range value {
+					_, isTable := item.(map[string]interface{})
+					if !isTable && !isTOMLTableArray(item) && !seenKeys[strings.Join(append(append([]string(nil), childPath...), key), "\x00")] {
+						return nil, errTOMLNotPatchable
+					}
+				}
+			}
+			rendered, err := missingTOMLTables(value, childPath, seenTables, seenKeys)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, rendered...)
+		default:
+			if isTOMLTableArray(value) && !seen {
+				rendered, err := renderTOMLTable(nestTOMLMap(path, map[string]interface{}{name: value}))
+				if err != nil {
+					return nil, err
+				}
+				out = append(out, rendered...)
+			}
+		}
+	}
+	return out, nil
+}
+
+// renderTOMLTable renders a document holding new tables, preceded by a blank line.
+func renderTOMLTable(m map[string]interface{}) ([]string, error) {
+	tree, err := toml.TreeFromMap(m)
+	if err != nil {
+		return nil, err
+	}
+	rendered, err := tree.ToTomlString()
+	if err != nil {
+		return nil, err
+	}
+	return append([]string{""}, strings.Split(strings.TrimSpace(rendered), "\n")...), nil
+}
+
+// markTOMLTable records the table at path as defined by a header (explicit) and its parents as implied.
+func markTOMLTable(seenTables map[string]bool, path []string, explicit bool) {
+	for i := 1; i <= len(path); i++ {
+		tablePath := strings.Join(path[:i], ".")
+		if i == len(path) && explicit {
+			seenTables[tablePath] = true
+		} else if _, ok := seenTables[tablePath]; !ok {
+			seenTables[tablePath] = false
+		}
+	}
+}
+
+// scanTOMLSections splits the document into its root table and the tables introduced by headers.
+func scanTOMLSections(lines []string) []tomlSection {
+	sections := []tomlSection{{header: -1}}
+	for i := 0; i < len(lines); i++ {
+		trimmed := strings.TrimSpace(lines[i])
+		if strings.HasPrefix(trimmed, "[") {
+			array := strings.HasPrefix(trimmed, "[[")
+			header := strings.TrimSpace(stripTOMLComment(trimmed))
+			header = strings.TrimSuffix(strings.TrimPrefix(header, "["), "]")
+			if array {
+				header = strings.TrimSuffix(strings.TrimPrefix(header, "["), "]")
+			}
+			sections[len(sections)-1].end = i
+			sections = append(sections, tomlSection{path: parseTOMLKey(header), array: array, header: i})
+			continue
+		}
+		if _, _, _, _, ok := splitTOMLKeyLine(lines[i]); ok {
+			i += tomlValueLines(lines[i:]) - 1
+		}
+	}
+	sections[len(sections)-1].end = len(lines)
+	return sections
+}
+
+// insideTOMLArray reports whether the table path lies inside an array of tables of the document.
+func insideTOMLArray(sections []tomlSection, path []string) bool {
+	for _, section := range sections {
+		if section.array && len(section.path) < len(path) && reflect.DeepEqual(section.path, path[:len(section.path)]) {
+			return true
+		}
+	}
+	return false
+}
+
+// splitTOMLKeyLine splits a "key = value # comment" line into the key path, the prefix up to the value,
+// the value and the trailing comment including the whitespace before it.
+func splitTOMLKeyLine(line string) ([]string, string, string, string, bool) {
+	trimmed := strings.TrimSpace(line)
+	if trimmed == "" || strings.HasPrefix(trimmed, "#") || strings.HasPrefix(trimmed, "[") {
+		return nil, "", "", "", false
+	}
+
+	inQuote := byte(0)
+	for i := 0; i < len(line); i++ {
+		switch {
+		case inQuote != 0:
+			if line[i] == inQuote {
+				inQuote = 0
+			}
+		case line[i] == '"' || line[i] == '\'':
+			inQuote = line[i]
+		case line[i] == '=':
+			key := parseTOMLKey(strings.TrimSpace(line[:i]))
+			if len(key) == 0 {
+				return nil, "", "", "", false
+			}
+			rest := line[i+1:]
+			prefix := line[:len(line)-len(strings.TrimLeft(rest, " \t"))]
+			code := stripTOMLComment(rest)
+			comment := ""
+			if len(code) < len(rest) {
+				comment = code[len(strings.TrimRight(code, " \t")):] + rest[len(code):]
+			}
+			return key, prefix, strings.TrimSpace(code), comment, true
+		}
+	}
+	return nil, "", "", "", false
+}
+
+// tomlValueLines returns the number of lines spanned by the key line at lines[0], counting multi-line
+// strings and arrays.
+func tomlValueLines(lines []string) int {
+	_, _, value, _, _ := splitTOMLKeyLine(lines[0])
+	for _, delimiter := range []string{`"""`, "'''"} {
+		if strings.HasPrefix(value, delimiter) {
+			if strings.Count(value, delimiter) >= 2 {
+				return 1
+			}
+			for i := 1; i < len(lines); i++ {
+				if strings.Contains(lines[i], delimiter) {
+					return i + 1
+				}
+			}
+			return len(lines)
+		}
+	}
+
+	depth := 0
+	for i, line := range lines {
+		text := line
+		if i == 0 {
+			text = value
+		}
+		inQuote := byte(0)
+		for j := 0; j < len(text); j++ {
+			c := text[j]
+			switch {
+			case inQuote != 0:
+				if c == '\\' && inQuote == '"' {
+					j++
+				} else if c == inQuote {
+					inQuote = 0
+				}
+			case c == '"' || c == '\'':
+				inQuote = c
+			case c == '#':
+				j = len(text)
+			case c == '[' || c == '{':
+				depth++
+			case c == ']' || c == '}':
+				depth--
+			}
+		}
+		if depth <= 0 {
+			return i + 1
+		}
+	}
+	return len(lines)
+}
+
+// stripTOMLComment returns the line up to a comment outside of strings.
+func stripTOMLComment(line string) string {
+	inQuote := byte(0)
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case inQuote != 0:
+			if c == '\\' && inQuote == '"' {
+				i++
+			} else if c == inQuote {
+				inQuote = 0
+			}
+		case c == '"' || c == '\'':
+			inQuote = c
+		case c == '#':
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// parseTOMLKey splits a possibly dotted and quoted key into its parts.
+func parseTOMLKey(key string) []string {
+	var parts []string
+	var current strings.Builder
+	inQuote := byte(0)
+	for i := 0; i < len(key); i++ {
+		c := key[i]
+		switch {
+		case inQuote != 0:
+			if c == '\\' && inQuote == '"' && i+1 < len(key) {
+				i++
+				current.WriteByte(key[i])
+			} else if c == inQuote {
+				inQuote = 0
+			} else {
+				current.WriteByte(c)
+			}
+		case c == '"' || c == '\'':
+			inQuote = c
+		case c == '.':
+			parts = append(parts, strings.TrimSpace(current.String()))
+			current.Reset()
+		case c != ' ' && c != '\t':
+			current.WriteByte(c)
+		}
+	}
+	return append(parts, strings.TrimSpace(current.String()))
+}
+
+// quoteTOMLKey quotes a key if it is not a bare key.
+func quoteTOMLKey(key string) string {
+	for _, c := range key {
+		if !(c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '_' || c == '-') {
+			return `"` + strings.ReplaceAll(strings.ReplaceAll(key, `\`, `\\`), `"`, `\"`) + `"`
+		}
+	}
+	return key
+}
+
+// renderTOMLValue renders a value as it appears on the right-hand side of a key line.
+func renderTOMLValue(value interface{}) (string, error) {
+	if _, ok := value.(map[string]interface{}); ok || isTOMLTableArray(value) {
+		return "", errTOMLNotPatchable
+	}
+	tree, err := toml.TreeFromMap(map[string]interface{}{"v": value})
+	if err != nil {
+		return "", err
+	}
+	rendered, err := tree.ToTomlString()
+	if err != nil {
+		return "", err
+	}
+	rendered = strings.TrimSpace(rendered)
+	if !strings.HasPrefix(rendered, "v = ") || strings.Contains(rendered, "\n") {
+		return "", errTOMLNotPatchable
+	}
+	return strings.TrimPrefix(rendered, "v = "), nil
+}
+
+// lookupTOMLPath returns the value at the path of the document map.
+func lookupTOMLPath(m map[string]interface{}, path []string) (interface{}, bool) {
+	var value interface{} = m
+	for _, part := range path {
+		table, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if value, ok = table[part]; !ok {
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+// nestTOMLMap wraps value into tables along path.
+func nestTOMLMap(path []string, value map[string]interface{}) map[string]interface{} {
+	for i := len(path) - 1; i >= 0; i-- {
+		value = map[string]interface{}{path[i]: value}
+	}
+	return value
+}
+
+// isTOMLTableArray reports whether the value is an array of tables.
+func isTOMLTableArray(value interface{}) bool {
+	switch items := value.(type) {
+	case []map[string]interface{}:
+		return true
+	case []interface{}:
+		if len(items) == 0 {
+			return false
+		}
+		_, ok := items[0].(map[string]interface{})
+		return ok
+	}
+	return false
+}
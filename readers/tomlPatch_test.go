@@ -0,0 +1,113 @@
+package readers
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pelletier/go-toml"
+)
+
+func TestTOMLUpdateConfigPatchesInPlace(t *testing.T) {
+	tests := []struct {
+		name     string
+		original string
+		update   func(doc map[string]interface{})
+		want     string
+	}{
+		{
+			name:     "comments",
+			original: "# service\nname = \"app\" # the name\nport = 8080   # listen port\n\n# tuning\nworkers = 4\n",
+			update:   func(doc map[string]interface{}) { doc["port"] = int64(9090) },
+			want:     "# service\nname = \"app\" # the name\nport = 9090   # listen port\n\n# tuning\nworkers = 4\n",
+		},
+		{
+			name:     "nested tables",
+			original: "log = \"info\"\n\n[server]\n# bind address\nhost = \"localhost\"\n\n[server.tls]\nenabled = false # off in dev\ncert = \"a.pem\"\n",
+			update: func(doc map[string]interface{}) {
+				tls := doc["server"].(map[string]interface{})["tls"].(map[string]interface{})
+				tls["enabled"] = true
+				tls["key"] = "a.key"
+			},
+			want: "log = \"info\"\n\n[server]\n# bind address\nhost = \"localhost\"\n\n[server.tls]\nenabled = true # off in dev\ncert = \"a.pem\"\nkey = \"a.key\"\n",
+		},
+		{
+			name:     "new table",
+			original: "# root\nlog = \"info\"\n",
+			update: func(doc map[string]interface{}) {
+				doc["db"] = map[string]interface{}{"host": "db1"}
+			},
+			want: "# root\nlog = \"info\"\n\n[db]\n  host = \"db1\"\n",
+		},
+		{
+			name:     "arrays",
+			original: "# peers\npeers = [\"a\", \"b\"] # all peers\nname = \"app\" # kept\n",
+			update: func(doc map[string]interface{}) {
+				doc["peers"] = []interface{}{"a", "c"}
+			},
+			want: "# peers\npeers = [\"a\", \"c\"] # all peers\nname = \"app\" # kept\n",
+		},
+		{
+			name:     "unchanged array of tables",
+			original: "name = \"app\" # the name\n\n[[servers]]\nhost = \"a\" # first\n",
+			update:   func(doc map[string]interface{}) { doc["name"] = "svc" },
+			want:     "name = \"svc\" # the name\n\n[[servers]]\nhost = \"a\" # first\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), "config.toml")
+			if err := os.WriteFile(filename, []byte(tt.original), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			tree, err := toml.Load(tt.original)
+			if err != nil {
+				t.Fatal(err)
+			}
+			doc := tree.ToMap()
+			tt.update(doc)
+
+			if err := (&TOMLConfigReader{}).UpdateConfig(filename, doc); err != nil {
+				t.Fatalf("UpdateConfig: %v", err)
+			}
+			got, err := os.ReadFile(filename)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Fatalf("patched file:\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTOMLUpdateConfigReportsRewrite(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "config.toml")
+	if err := os.WriteFile(filename, []byte("# servers\n[[servers]]\nhost = \"a\"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// A changed array of tables cannot be patched in place.
+	doc := map[string]interface{}{"servers": []map[string]interface{}{{"host": "b"}}}
+	if err := (&TOMLConfigReader{}).UpdateConfig(filename, doc); !errors.Is(err, ErrRewritten) {
+		t.Fatalf("UpdateConfig = %v, want %v", err, ErrRewritten)
+	}
+	var got struct {
+		Servers []struct {
+			Host string `toml:"host"`
+		} `toml:"servers"`
+	}
+	if err := (&TOMLConfigReader{}).ReadConfig(filename, &got); err != nil {
+		t.Fatalf("ReadConfig of the rewritten file: %v", err)
+	}
+	if len(got.Servers) != 1 || got.Servers[0].Host != "b" {
+		t.Fatalf("rewritten file holds %+v, want the new values", got)
+	}
+
+	// A new file is written in full without an error.
+	newFile := filepath.Join(t.TempDir(), "new.toml")
+	if err := (&TOMLConfigReader{}).UpdateConfig(newFile, map[string]interface{}{"a": 1}); err != nil {
+		t.Fatalf("UpdateConfig of a new file = %v", err)
+	}
+}
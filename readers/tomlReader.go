@@ -3,7 +3,7 @@ package readers
 import (
 	"bytes"
 	"fmt"
-	"io/ioutil"
+	"io"
 	"sync"
 
 	"github.com/pelletier/go-toml"
@@ -11,7 +11,8 @@ import (
 
 // TOMLConfigReader implements the ConfigReader interface for TOML configuration files.
 type TOMLConfigReader struct {
-	mu sync.Mutex // Mutex to ensure thread safety during file read and write operations.
+	Source            // Where and how configuration files are read and written
+	mu     sync.Mutex // Mutex to ensure thread safety during file read and write operations.
 }
 
 // ReadConfig reads the content of a TOML configuration file into the provided struct.
@@ -19,7 +20,7 @@ func (t *TOMLConfigReader) ReadConfig(filename string, v interface{}) error {
 	t.mu.Lock()
 	defer t.mu.Unlock()
 
-	fileContent, err := ioutil.ReadFile(filename)
+	fileContent, err := t.readFile(filename)
 	if err != nil {
 		return fmt.Errorf("error reading TOML content: %v\n", err)
 	}
@@ -29,7 +30,26 @@ func (t *TOMLConfigReader) ReadConfig(filename string, v interface{}) error {
 		return fmt.Errorf("error unmarshalling TOML content: %v\n", err)
 	}
 
-	if err := tree.Unmarshal(&v); err != nil {
+	if err := tree.Unmarshal(v); err != nil {
+		return fmt.Errorf("error unmarshalling TOML content: %v\n", err)
+	}
+
+	return nil
+}
+
+// ReadConfigFrom reads TOML configuration content from the stream into the provided struct.
+func (t *TOMLConfigReader) ReadConfigFrom(r io.Reader, v interface{}) error {
+	content, err := t.readStream(r)
+	if err != nil {
+		return fmt.Errorf("error reading TOML stream: %v\n", err)
+	}
+
+	tree, err := toml.Load(string(content))
+	if err != nil {
+		return fmt.Errorf("error unmarshalling TOML content: %v\n", err)
+	}
+
+	if err := tree.Unmarshal(v); err != nil {
 		return fmt.Errorf("error unmarshalling TOML content: %v\n", err)
 	}
 
@@ -41,7 +61,7 @@ func (t *TOMLConfigReader) ReadConfigToMap(filename string) (map[string]interfac
 	t.mu.Lock()
 	defer t.mu.Unlock()
 
-	fileContent, err := ioutil.ReadFile(filename)
+	fileContent, err := t.readFile(filename)
 	if err != nil {
 		return nil, fmt.Errorf("error reading TOML content: %v\n", err)
 	}
@@ -57,18 +77,58 @@ func (t *TOMLConfigReader) ReadConfigToMap(filename string) (map[string]interfac
 	return configMap, nil
 }
 
+// ReadConfigToMapFrom reads TOML configuration content from the stream into a map.
+func (t *TOMLConfigReader) ReadConfigToMapFrom(r io.Reader) (map[string]interface{}, error) {
+	content, err := t.readStream(r)
+	if err != nil {
+		return nil, fmt.Errorf("error reading TOML stream: %v\n", err)
+	}
+
+	var configMap map[string]interface{}
+	tree, err := toml.Load(string(content))
+	if err != nil {
+		return nil, fmt.Errorf("error unmarshalling TOML content: %v\n", err)
+	}
+	tree.Unmarshal(&configMap)
+
+	return configMap, nil
+}
+
 // UpdateConfig writes the provided struct as TOML to the configuration file.
+// An existing file is patched in place, so comments, whitespace and the order of unchanged keys and tables are preserved.
+// If it cannot be patched, e.g. because an array of tables changed, it is rewritten in full and an error wrapping
+// ErrRewritten is returned.
 func (t *TOMLConfigReader) UpdateConfig(filename string, v interface{}) error {
 	t.mu.Lock()
 	defer t.mu.Unlock()
 
-	var buf bytes.Buffer
-	if err := toml.NewEncoder(&buf).Encode(v); err != nil {
-		return fmt.Errorf("error encoding TOML: %v", err)
+	var tomlData []byte
+	var patchErr error
+	if existing, err := t.readFile(filename); err == nil && len(bytes.TrimSpace(existing)) > 0 {
+		tomlData, patchErr = patchTOML(existing, v)
+	}
+	if tomlData == nil {
+		var buf bytes.Buffer
+		if err := toml.NewEncoder(&buf).Encode(v); err != nil {
+			return fmt.Errorf("error encoding TOML: %v", err)
+		}
+		tomlData = buf.Bytes()
+	}
+
+	if err := t.writeFile(filename, tomlData); err != nil {
+		return fmt.Errorf("error writing TOML file: %w", err)
+	}
+	if patchErr != nil {
+		return fmt.Errorf("error patching TOML file: %w: %v", ErrRewritten, patchErr)
 	}
 
-	if err := ioutil.WriteFile(filename, buf.Bytes(), 0644); err != nil {
-		return fmt.Errorf("error writing TOML file: %v", err)
+	return nil
+}
+
+// WriteConfigTo writes the provided struct as TOML to the stream.
+func (t *TOMLConfigReader) WriteConfigTo(w io.Writer, v interface{}) error {
+	if err := toml.NewEncoder(w).Encode(v); err != nil {
+		return fmt.Errorf("error encoding TOML: %v", err)
 	}
 
 	return nil
@@ -1,22 +1,25 @@
 package readers
 
 import (
+	"bytes"
 	"encoding/xml"
 	"fmt"
-	"io/ioutil"
+	"io"
+	"strings"
 	"sync"
 )
 
 // XMLConfigReader implements the ConfigReader interface for XML configuration files.
 type XMLConfigReader struct {
-	mu sync.Mutex // Mutex to ensure thread safety during file read and write operations.
+	Source            // Where and how configuration files are read and written
+	mu     sync.Mutex // Mutex to ensure thread safety during file read and write operations.
 }
 
 // ReadConfig reads the content of an XML configuration file into the provided struct.
 func (x *XMLConfigReader) ReadConfig(filename string, v interface{}) error {
 	x.mu.Lock()
 	defer x.mu.Unlock()
-	fileContent, err := ioutil.ReadFile(filename)
+	fileContent, err := x.readFile(filename)
 	if err != nil {
 		return fmt.Errorf("error unmarshalling XML content: %v\n", err)
 	}
@@ -28,17 +31,49 @@ func (x *XMLConfigReader) ReadConfig(filename string, v interface{}) error {
 	return nil
 }
 
+// ReadConfigFrom reads XML configuration content from the stream into the provided struct.
+func (x *XMLConfigReader) ReadConfigFrom(r io.Reader, v interface{}) error {
+	content, err := x.readStream(r)
+	if err != nil {
+		return fmt.Errorf("error reading XML stream: %v\n", err)
+	}
+
+	if err := xml.Unmarshal(content, &v); err != nil {
+		return fmt.Errorf("error unmarshalling XML content: %v\n", err)
+	}
+
+	return nil
+}
+
 // ReadConfigToMap reads the content of an XML configuration file into a map.
+// The children of the root element become the keys of the map: elements holding only text map to strings,
+// nested elements to maps, repeated elements to slices, attributes to "@name" keys and the text of elements
+// with attributes or children to "#text".
 func (x *XMLConfigReader) ReadConfigToMap(filename string) (map[string]interface{}, error) {
 	x.mu.Lock()
 	defer x.mu.Unlock()
-	fileContent, err := ioutil.ReadFile(filename)
+	fileContent, err := x.readFile(filename)
 	if err != nil {
 		return nil, fmt.Errorf("error reading XML file: %v\n", err)
 	}
 
-	var configMap map[string]interface{}
-	if err := xml.Unmarshal(fileContent, &configMap); err != nil {
+	configMap, err := xmlToMap(fileContent)
+	if err != nil {
+		return nil, fmt.Errorf("error unmarshalling XML content: %v\n", err)
+	}
+
+	return configMap, nil
+}
+
+// ReadConfigToMapFrom reads XML configuration content from the stream into a map, like ReadConfigToMap.
+func (x *XMLConfigReader) ReadConfigToMapFrom(r io.Reader) (map[string]interface{}, error) {
+	content, err := x.readStream(r)
+	if err != nil {
+		return nil, fmt.Errorf("error reading XML stream: %v\n", err)
+	}
+
+	configMap, err := xmlToMap(content)
+	if err != nil {
 		return nil, fmt.Errorf("error unmarshalling XML content: %v\n", err)
 	}
 
@@ -54,9 +89,90 @@ func (x *XMLConfigReader) UpdateConfig(filename string, v interface{}) error {
 		return fmt.Errorf("error marshalling XML: %v", err)
 	}
 
-	if err := ioutil.WriteFile(filename, xmlData, 0644); err != nil {
-		return fmt.Errorf("error writing XML file: %v", err)
+	if err := x.writeFile(filename, xmlData); err != nil {
+		return fmt.Errorf("error writing XML file: %w", err)
+	}
+
+	return nil
+}
+
+// WriteConfigTo writes the provided struct as XML to the stream.
+func (x *XMLConfigReader) WriteConfigTo(w io.Writer, v interface{}) error {
+	xmlData, err := xml.MarshalIndent(v, "", "    ")
+	if err != nil {
+		return fmt.Errorf("error marshalling XML: %v", err)
+	}
+	if _, err := w.Write(xmlData); err != nil {
+		return fmt.Errorf("error writing XML stream: %v", err)
 	}
 
 	return nil
 }
+
+// xmlToMap converts an XML document into a map of the root element's attributes and children.
+func xmlToMap(content []byte) (map[string]interface{}, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(content))
+	decoder.Strict = false
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+		if start, ok := token.(xml.StartElement); ok {
+			value, err := xmlElementValue(decoder, start)
+			if err != nil {
+				return nil, err
+			}
+			if configMap, ok := value.(map[string]interface{}); ok {
+				return configMap, nil
+			}
+			return map[string]interface{}{"#text": value}, nil
+		}
+	}
+}
+
+// xmlElementValue converts the element opened by start into a string, or a map if it has attributes or children.
+func xmlElementValue(decoder *xml.Decoder, start xml.StartElement) (interface{}, error) {
+	element := make(map[string]interface{})
+	for _, attr := range start.Attr {
+		if attr.Name.Space == "xmlns" || attr.Name.Local == "xmlns" {
+			continue
+		}
+		element["@"+attr.Name.Local] = attr.Value
+	}
+
+	var text strings.Builder
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			child, err := xmlElementValue(decoder, t)
+			if err != nil {
+				return nil, err
+			}
+			name := t.Name.Local
+			switch existing := element[name].(type) {
+			case nil:
+				element[name] = child
+			case []interface{}:
+				element[name] = append(existing, child)
+			default:
+				element[name] = []interface{}{existing, child}
+			}
+		case xml.CharData:
+			text.Write(t)
+		case xml.EndElement:
+			content := strings.TrimSpace(text.String())
+			if len(element) == 0 {
+				return content, nil
+			}
+			if content != "" {
+				element["#text"] = content
+			}
+			return element, nil
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package readers
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestXMLConfigReaderToMap(t *testing.T) {
+	tests := []struct {
+		name string
+		xml  string
+		want map[string]interface{}
+	}{
+		{
+			"attributes",
+			`<config><server host="db" port="5432"/></config>`,
+			map[string]interface{}{"server": map[string]interface{}{"@host": "db", "@port": "5432"}},
+		},
+		{
+			"attributes with text",
+			`<config><server host="db">primary</server></config>`,
+			map[string]interface{}{"server": map[string]interface{}{"@host": "db", "#text": "primary"}},
+		},
+		{
+			"root attributes",
+			`<config version="2"><name>app</name></config>`,
+			map[string]interface{}{"@version": "2", "name": "app"},
+		},
+		{
+			"namespace declarations",
+			`<config xmlns="urn:app" xmlns:x="urn:x"><x:name>app</x:name></config>`,
+			map[string]interface{}{"name": "app"},
+		},
+		{
+			"repeated elements",
+			`<config><port>80</port><port>443</port><port>8080</port></config>`,
+			map[string]interface{}{"port": []interface{}{"80", "443", "8080"}},
+		},
+		{
+			"repeated nested elements",
+			`<config><user><name>ann</name></user><user><name>bob</name></user></config>`,
+			map[string]interface{}{"user": []interface{}{
+				map[string]interface{}{"name": "ann"},
+				map[string]interface{}{"name": "bob"},
+			}},
+		},
+		{
+			"mixed content",
+			`<config><motd>Welcome to <b>prod</b></motd></config>`,
+			map[string]interface{}{"motd": map[string]interface{}{"#text": "Welcome to", "b": "prod"}},
+		},
+		{
+			"text root",
+			`<config>plain</config>`,
+			map[string]interface{}{"#text": "plain"},
+		},
+		{
+			"empty element",
+			`<config><empty/></config>`,
+			map[string]interface{}{"empty": ""},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := (&XMLConfigReader{}).ReadConfigToMapFrom(strings.NewReader(tt.xml))
+			if err != nil {
+				t.Fatalf("ReadConfigToMapFrom: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("ReadConfigToMapFrom = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestXMLConfigReaderDecodesAttributesAndLists(t *testing.T) {
+	type server struct {
+		Host string `xml:"host,attr"`
+		Port int    `xml:"port,attr"`
+	}
+	var config struct {
+		Servers []server `xml:"server"`
+		Ports   []int    `xml:"port"`
+	}
+	content := `<config><server host="a" port="1"/><server host="b" port="2"/><port>80</port><port>443</port></config>`
+	if err := (&XMLConfigReader{}).ReadConfigFrom(strings.NewReader(content), &config); err != nil {
+		t.Fatalf("ReadConfigFrom: %v", err)
+	}
+	if want := []server{{"a", 1}, {"b", 2}}; !reflect.DeepEqual(config.Servers, want) {
+		t.Fatalf("Servers = %+v, want %+v", config.Servers, want)
+	}
+	if want := []int{80, 443}; !reflect.DeepEqual(config.Ports, want) {
+		t.Fatalf("Ports = %v, want %v", config.Ports, want)
+	}
+}
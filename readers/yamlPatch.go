@@ -0,0 +1,398 @@
+package readers
+
+import (
+	"errors"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+var (
+	errYAMLNotPatchable  = errors.New("document is not a block mapping")        // Document cannot be patched in place
+	errYAMLAnchorChanged = errors.New("changed entry defines an anchor")        // Patching could break aliases
+	yamlAnchorPattern    = regexp.MustCompile(`(?:^|[\s\[{,:-])&[^\s,\[\]{}]+`) // Anchor definition in a line
+)
+
+// yamlEntry is a key of a block mapping and the lines it spans.
+type yamlEntry struct {
+	key     string // Unquoted key
+	start   int    // Index of the key line
+	bodyEnd int    // Index after the last line holding the entry's value
+	end     int    // Index of the next entry's key line; lines from bodyEnd belong to the next entry (comments, blanks)
+}
+
+// patchYAML updates the YAML document so that it represents v, keeping comments, anchors, key order and
+// formatting of every entry whose value did not change. Changed scalars are replaced on their line,
+// changed nested mappings are patched recursively, other changed entries are re-rendered and new keys are appended.
+// The document is compared with aliases and merge keys resolved, so unchanged aliases are kept as well.
+func patchYAML(original []byte, v interface{}) ([]byte, error) {
+	// The values are decoded generically, as decoding into a MapSlice drops the keys of merge keys.
+	var oldValue interface{}
+	if err := yaml.Unmarshal(original, &oldValue); err != nil {
+		return nil, err
+	}
+	oldDoc, _ := toYAMLMapSlice(oldValue).(yaml.MapSlice)
+	if len(oldDoc) == 0 {
+		return nil, errYAMLNotPatchable
+	}
+
+	data, err := yaml.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var newDoc yaml.MapSlice
+	if err := yaml.Unmarshal(data, &newDoc); err != nil {
+		return nil, err
+	}
+
+	lines := strings.Split(string(original), "\n")
+	indent := -1
+	for _, line := range lines {
+		if isYAMLContentLine(line) && !strings.HasPrefix(line, "---") && !strings.HasPrefix(line, "%") {
+			indent = lineIndent(line)
+			break
+		}
+	}
+	if indent < 0 {
+		return nil, errYAMLNotPatchable
+	}
+
+	patched, err := patchYAMLMapping(lines, indent, oldDoc, newDoc)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(strings.Join(patched, "\n")), nil
+}
+
+// patchYAMLMapping patches the block mapping at the given indentation held by lines.
+func patchYAMLMapping(lines []string, indent int, oldMap, newMap yaml.MapSlice) ([]string, error) {
+	entries := scanYAMLEntries(lines, indent)
+	if len(entries) == 0 {
+		return append(lines, renderYAMLMapping(newMap, indent)...), nil
+	}
+
+	out := append([]string(nil), lines[:entries[0].start]...)
+	seen := make(map[string]bool)
+	for _, e := range entries {
+		seen[e.key] = true
+		body := lines[e.start:e.bodyEnd]
+		trailer := lines[e.bodyEnd:e.end]
+
+		newValue, inNew := lookupYAMLKey(newMap, e.key)
+		oldValue, inOld := lookupYAMLKey(oldMap, e.key)
+		switch {
+		case e.key == "<<":
+			out = append(out, body...)
+		case !inNew:
+			// A removed key drops its value but keeps the comments that belong to the next entry.
+			if definesYAMLAnchor(body) {
+				return nil, errYAMLAnchorChanged
+			}
+		case inOld && equalYAMLValues(oldValue, newValue):
+			out = append(out, body...)
+		default:
+			patched, err := patchYAMLEntry(body, indent, e.key, oldValue, newValue)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, patched...)
+		}
+		out = append(out, trailer...)
+	}
+
+	insert := len(out)
+	for insert > 0 && strings.TrimSpace(out[insert-1]) == "" {
+		insert--
+	}
+	var added []string
+	for _, item := range newMap {
+		key := yamlKeyString(item.Key)
+		if seen[key] {
+			continue
+		}
+		if oldValue, ok := lookupYAMLKey(oldMap, key); ok && equalYAMLValues(oldValue, item.Value) {
+			continue // Provided by a merge key.
+		}
+		added = append(added, renderYAMLEntry(item.Key, item.Value, indent)...)
+	}
+	if len(added) == 0 {
+		return out, nil
+	}
+	return append(append(append([]string(nil), out[:insert]...), added...), out[insert:]...), nil
+}
+
+// patchYAMLEntry patches a changed entry: scalars in place, nested mappings recursively, anything else re-rendered.
+func patchYAMLEntry(body []string, indent int, key string, oldValue, newValue interface{}) ([]string, error) {
+	keyLine := body[0]
+	prefix, value, comment := splitYAMLKeyLine(keyLine, indent)
+	anchor := ""
+	if strings.HasPrefix(value, "&") {
+		anchor, value = splitFirstField(value)
+	}
+
+	switch nv := newValue.(type) {
+	case yaml.MapSlice:
+		ov, ok := oldValue.(yaml.MapSlice)
+		if ok && value == "" && len(body) > 1 {
+			childIndent := -1
+			for _, line := range body[1:] {
+				if isYAMLContentLine(line) {
+					childIndent = lineIndent(line)
+					if strings.HasPrefix(strings.TrimSpace(line), "- ") {
+						childIndent = -1
+					}
+					break
+				}
+			}
+			if childIndent > indent {
+				patched, err := patchYAMLMapping(body[1:], childIndent, ov, nv)
+				if err != nil {
+					return nil, err
+				}
+				return append([]string{keyLine}, patched...), nil
+			}
+		}
+	case []interface{}:
+	default:
+		rendered, err := yaml.Marshal(newValue)
+		text := strings.TrimSuffix(string(rendered), "\n")
+		if err == nil && len(body) == 1 && value != "" && !strings.HasPrefix(value, "|") && !strings.HasPrefix(value, ">") &&
+			!strings.Contains(text, "\n") {
+			line := prefix + " "
+			if anchor != "" {
+				line += anchor + " "
+			}
+			line += text
+			line += comment
+			return []string{line}, nil
+		}
+	}
+
+	if definesYAMLAnchor(body) {
+		return nil, errYAMLAnchorChanged
+	}
+	rendered := renderYAMLEntry(key, newValue, indent)
+	if comment != "" && len(rendered) > 0 {
+		rendered[0] += comment
+	}
+	return rendered, nil
+}
+
+// scanYAMLEntries returns the keys of the block mapping at the given indentation.
+func scanYAMLEntries(lines []string, indent int) []yamlEntry {
+	var entries []yamlEntry
+	for i, line := range lines {
+		if !isYAMLContentLine(line) || lineIndent(line) != indent {
+			continue
+		}
+		key, ok := yamlLineKey(line[indent:])
+		if !ok {
+			continue
+		}
+		entries = append(entries, yamlEntry{key: key, start: i})
+	}
+
+	for i := range entries {
+		end := len(lines)
+		if i+1 < len(entries) {
+			end = entries[i+1].start
+		}
+		bodyEnd := end
+		for bodyEnd > entries[i].start+1 && !isYAMLContentLine(lines[bodyEnd-1]) {
+			bodyEnd--
+		}
+		entries[i].bodyEnd = bodyEnd
+		entries[i].end = end
+	}
+	return entries
+}
+
+// yamlLineKey returns the unquoted key of a "key: value" line without indentation.
+func yamlLineKey(line string) (string, bool) {
+	if strings.HasPrefix(line, "- ") || line == "-" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "---") {
+		return "", false
+	}
+
+	if strings.HasPrefix(line, `"`) || strings.HasPrefix(line, "'") {
+		quote := line[:1]
+		for i := 1; i < len(line); i++ {
+			if quote == `"` && line[i] == '\\' {
+				i++
+				continue
+			}
+			if line[i:i+1] == quote {
+				if quote == "'" && i+1 < len(line) && line[i+1] == '\'' {
+					i++
+					continue
+				}
+				rest := strings.TrimLeft(line[i+1:], " ")
+				if !strings.HasPrefix(rest, ":") {
+					return "", false
+				}
+				var key string
+				if err := yaml.Unmarshal([]byte(line[:i+1]), &key); err != nil {
+					return "", false
+				}
+				return key, true
+			}
+		}
+		return "", false
+	}
+
+	for i := 0; i < len(line); i++ {
+		if line[i] == ':' && (i+1 == len(line) || line[i+1] == ' ' || line[i+1] == '\t') {
+			return strings.TrimSpace(line[:i]), true
+		}
+		if line[i] == '#' && i > 0 && line[i-1] == ' ' {
+			return "", false
+		}
+	}
+	return "", false
+}
+
+// splitYAMLKeyLine splits a key line into the "key:" prefix (with indentation), the value and the trailing comment
+// including the whitespace before it.
+func splitYAMLKeyLine(line string, indent int) (string, string, string) {
+	rest := line[indent:]
+	colon := 0
+	if strings.HasPrefix(rest, `"`) || strings.HasPrefix(rest, "'") {
+		colon = strings.Index(rest[1:], rest[:1]) + 1
+	}
+	for i := colon; i < len(rest); i++ {
+		if rest[i] == ':' && (i+1 == len(rest) || rest[i+1] == ' ' || rest[i+1] == '\t') {
+			colon = i
+			break
+		}
+	}
+
+	prefix := line[:indent+colon+1]
+	value := strings.TrimSpace(rest[colon+1:])
+	comment := ""
+	inSingle, inDouble := false, false
+	for i := 0; i < len(value); i++ {
+		switch {
+		case value[i] == '\\' && inDouble:
+			i++
+		case value[i] == '"' && !inSingle:
+			inDouble = !inDouble
+		case value[i] == '\'' && !inDouble:
+			inSingle = !inSingle
+		case value[i] == '#' && !inSingle && !inDouble && (i == 0 || value[i-1] == ' ' || value[i-1] == '\t'):
+			value, comment = strings.TrimRight(value[:i], " \t"), value[len(strings.TrimRight(value[:i], " \t")):]
+			return prefix, value, comment
+		}
+	}
+	return prefix, value, comment
+}
+
+// renderYAMLEntry renders a single "key: value" entry at the given indentation.
+func renderYAMLEntry(key, value interface{}, indent int) []string {
+	return renderYAMLMapping(yaml.MapSlice{{Key: key, Value: value}}, indent)
+}
+
+// renderYAMLMapping renders a mapping at the given indentation.
+func renderYAMLMapping(m yaml.MapSlice, indent int) []string {
+	data, err := yaml.Marshal(m)
+	if err != nil {
+		return nil
+	}
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	pad := strings.Repeat(" ", indent)
+	for i, line := range lines {
+		if line != "" {
+			lines[i] = pad + line
+		}
+	}
+	return lines
+}
+
+// toYAMLMapSlice converts the maps of a generically decoded YAML value into MapSlices, in no particular order.
+func toYAMLMapSlice(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(yaml.MapSlice, 0, len(v))
+		for key, value := range v {
+			m = append(m, yaml.MapItem{Key: key, Value: toYAMLMapSlice(value)})
+		}
+		return m
+	case []interface{}:
+		list := make([]interface{}, len(v))
+		for i, value := range v {
+			list[i] = toYAMLMapSlice(value)
+		}
+		return list
+	default:
+		return v
+	}
+}
+
+// lookupYAMLKey returns the value of the key in the mapping.
+func lookupYAMLKey(m yaml.MapSlice, key string) (interface{}, bool) {
+	for _, item := range m {
+		if yamlKeyString(item.Key) == key {
+			return item.Value, true
+		}
+	}
+	return nil, false
+}
+
+// yamlKeyString returns the string form of a mapping key.
+func yamlKeyString(key interface{}) string {
+	if s, ok := key.(string); ok {
+		return s
+	}
+	data, err := yaml.Marshal(key)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSuffix(string(data), "\n")
+}
+
+// equalYAMLValues reports whether two decoded YAML values are equal regardless of key order.
+func equalYAMLValues(a, b interface{}) bool {
+	return reflect.DeepEqual(normalizeYAMLValue(a), normalizeYAMLValue(b))
+}
+
+// normalizeYAMLValue converts a decoded YAML value into plain maps and slices.
+func normalizeYAMLValue(v interface{}) interface{} {
+	data, err := yaml.Marshal(v)
+	if err != nil {
+		return v
+	}
+	var normalized interface{}
+	if err := yaml.Unmarshal(data, &normalized); err != nil {
+		return v
+	}
+	return normalized
+}
+
+// definesYAMLAnchor reports whether any of the lines defines an anchor.
+func definesYAMLAnchor(lines []string) bool {
+	for _, line := range lines {
+		if isYAMLContentLine(line) && yamlAnchorPattern.MatchString(line) {
+			return true
+		}
+	}
+	return false
+}
+
+// isYAMLContentLine reports whether the line holds YAML content rather than a comment or whitespace.
+func isYAMLContentLine(line string) bool {
+	trimmed := strings.TrimSpace(line)
+	return trimmed != "" && !strings.HasPrefix(trimmed, "#")
+}
+
+// lineIndent returns the number of leading spaces of the line.
+func lineIndent(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " "))
+}
+
+// splitFirstField splits s into its first space-separated field and the trimmed remainder.
+func splitFirstField(s string) (string, string) {
+	if i := strings.IndexAny(s, " \t"); i >= 0 {
+		return s[:i], strings.TrimSpace(s[i:])
+	}
+	return s, ""
+}
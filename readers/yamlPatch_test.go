@@ -0,0 +1,103 @@
+package readers
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+func TestYAMLUpdateConfigPatchesInPlace(t *testing.T) {
+	tests := []struct {
+		name     string
+		original string
+		update   func(doc map[string]interface{})
+		want     string
+	}{
+		{
+			name:     "comments",
+			original: "# service\nname: app # the name\nport: 8080   # listen port\n\n# tuning\nworkers: 4\n",
+			update:   func(doc map[string]interface{}) { doc["port"] = 9090 },
+			want:     "# service\nname: app # the name\nport: 9090   # listen port\n\n# tuning\nworkers: 4\n",
+		},
+		{
+			name:     "anchors",
+			original: "defaults: &defaults\n  timeout: 5\nprimary:\n  <<: *defaults\n  host: a\nbackup: *defaults\n",
+			update: func(doc map[string]interface{}) {
+				doc["primary"].(map[interface{}]interface{})["host"] = "b"
+			},
+			want: "defaults: &defaults\n  timeout: 5\nprimary:\n  <<: *defaults\n  host: b\nbackup: *defaults\n",
+		},
+		{
+			name:     "nested maps",
+			original: "server:\n  # bind address\n  host: localhost\n  tls:\n    enabled: false # off in dev\n    cert: a.pem\nlog: info\n",
+			update: func(doc map[string]interface{}) {
+				tls := doc["server"].(map[interface{}]interface{})["tls"].(map[interface{}]interface{})
+				tls["enabled"] = true
+				tls["key"] = "a.key"
+			},
+			want: "server:\n  # bind address\n  host: localhost\n  tls:\n    enabled: true # off in dev\n    cert: a.pem\n    key: a.key\nlog: info\n",
+		},
+		{
+			name:     "lists",
+			original: "# peers\npeers:\n  - a\n  - b\nports: [80, 443] # public\nname: app # kept\n",
+			update: func(doc map[string]interface{}) {
+				doc["peers"] = []interface{}{"a", "c"}
+				doc["ports"] = []interface{}{8080}
+			},
+			want: "# peers\npeers:\n- a\n- c\nports: # public\n- 8080\nname: app # kept\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), "config.yaml")
+			if err := os.WriteFile(filename, []byte(tt.original), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			var doc map[string]interface{}
+			if err := yaml.Unmarshal([]byte(tt.original), &doc); err != nil {
+				t.Fatal(err)
+			}
+			tt.update(doc)
+
+			if err := (&YAMLConfigReader{}).UpdateConfig(filename, doc); err != nil {
+				t.Fatalf("UpdateConfig: %v", err)
+			}
+			got, err := os.ReadFile(filename)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Fatalf("patched file:\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestYAMLUpdateConfigReportsRewrite(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(filename, []byte("# shared\nbase: &base 1\ncopy: *base\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Changing the anchored value cannot be patched without breaking the alias.
+	err := (&YAMLConfigReader{}).UpdateConfig(filename, map[string]interface{}{"base": []int{2}, "copy": 1})
+	if !errors.Is(err, ErrRewritten) {
+		t.Fatalf("UpdateConfig = %v, want %v", err, ErrRewritten)
+	}
+	var got map[string]interface{}
+	if err := (&YAMLConfigReader{}).ReadConfig(filename, &got); err != nil {
+		t.Fatalf("ReadConfig of the rewritten file: %v", err)
+	}
+	if base, ok := got["base"].([]interface{}); !ok || len(base) != 1 || base[0] != 2 || got["copy"] != 1 {
+		t.Fatalf("rewritten file holds %v, want the new values", got)
+	}
+
+	// A new file is written in full without an error.
+	newFile := filepath.Join(t.TempDir(), "new.yaml")
+	if err := (&YAMLConfigReader{}).UpdateConfig(newFile, map[string]interface{}{"a": 1}); err != nil {
+		t.Fatalf("UpdateConfig of a new file = %v", err)
+	}
+}
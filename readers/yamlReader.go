@@ -1,8 +1,9 @@
 package readers
 
 import (
+	"bytes"
 	"fmt"
-	"io/ioutil"
+	"io"
 	"sync"
 
 	"gopkg.in/yaml.v2"
@@ -10,14 +11,15 @@ import (
 
 // YAMLConfigReader implements the ConfigReader interface for YAML configuration files.
 type YAMLConfigReader struct {
-	mu sync.Mutex // Mutex to ensure thread safety during file read and write operations.
+	Source            // Where and how configuration files are read and written
+	mu     sync.Mutex // Mutex to ensure thread safety during file read and write operations.
 }
 
 // ReadConfig reads the content of a YAML configuration file into the provided struct.
 func (y *YAMLConfigReader) ReadConfig(filename string, v interface{}) error {
 	y.mu.Lock()
 	defer y.mu.Unlock()
-	yamlContent, err := ioutil.ReadFile(filename)
+	yamlContent, err := y.readFile(filename)
 	if err != nil {
 		return fmt.Errorf("error reading YAML file: %v\n", err)
 	}
@@ -29,11 +31,25 @@ func (y *YAMLConfigReader) ReadConfig(filename string, v interface{}) error {
 	return nil
 }
 
+// ReadConfigFrom reads YAML configuration content from the stream into the provided struct.
+func (y *YAMLConfigReader) ReadConfigFrom(r io.Reader, v interface{}) error {
+	content, err := y.readStream(r)
+	if err != nil {
+		return fmt.Errorf("error reading YAML stream: %v\n", err)
+	}
+
+	if err := yaml.Unmarshal(content, v); err != nil {
+		return fmt.Errorf("error unmarshalling YAML content: %v\n", err)
+	}
+
+	return nil
+}
+
 // ReadConfigToMap reads the content of a YAML configuration file into a map.
 func (y *YAMLConfigReader) ReadConfigToMap(filename string) (map[string]interface{}, error) {
 	y.mu.Lock()
 	defer y.mu.Unlock()
-	fileContent, err := ioutil.ReadFile(filename)
+	fileContent, err := y.readFile(filename)
 	if err != nil {
 		return nil, fmt.Errorf("error reading YAML content: %v\n", err)
 	}
@@ -46,17 +62,59 @@ func (y *YAMLConfigReader) ReadConfigToMap(filename string) (map[string]interfac
 	return configMap, nil
 }
 
+// ReadConfigToMapFrom reads YAML configuration content from the stream into a map.
+func (y *YAMLConfigReader) ReadConfigToMapFrom(r io.Reader) (map[string]interface{}, error) {
+	content, err := y.readStream(r)
+	if err != nil {
+		return nil, fmt.Errorf("error reading YAML stream: %v\n", err)
+	}
+
+	var configMap map[string]interface{}
+	if err := yaml.Unmarshal(content, &configMap); err != nil {
+		return nil, fmt.Errorf("error unmarshalling YAML content: %v\n", err)
+	}
+
+	return configMap, nil
+}
+
 // UpdateConfig writes the provided struct as YAML to the configuration file.
+// An existing file is patched in place, so comments, anchors and key order of unchanged entries are preserved.
+// If it cannot be patched, e.g. because a changed entry defines an anchor, it is rewritten in full and an error
+// wrapping ErrRewritten is returned.
 func (y *YAMLConfigReader) UpdateConfig(filename string, v interface{}) error {
 	y.mu.Lock()
 	defer y.mu.Unlock()
+	var yamlData []byte
+	var patchErr error
+	if existing, err := y.readFile(filename); err == nil && len(bytes.TrimSpace(existing)) > 0 {
+		yamlData, patchErr = patchYAML(existing, v)
+	}
+	if yamlData == nil {
+		data, err := yaml.Marshal(v)
+		if err != nil {
+			return fmt.Errorf("error marshalling YAML: %v", err)
+		}
+		yamlData = data
+	}
+
+	if err := y.writeFile(filename, yamlData); err != nil {
+		return fmt.Errorf("error writing YAML file: %w", err)
+	}
+	if patchErr != nil {
+		return fmt.Errorf("error patching YAML file: %w: %v", ErrRewritten, patchErr)
+	}
+
+	return nil
+}
+
+// WriteConfigTo writes the provided struct as YAML to the stream.
+func (y *YAMLConfigReader) WriteConfigTo(w io.Writer, v interface{}) error {
 	yamlData, err := yaml.Marshal(v)
 	if err != nil {
 		return fmt.Errorf("error marshalling YAML: %v", err)
 	}
-
-	if err := ioutil.WriteFile(filename, yamlData, 0644); err != nil {
-		return fmt.Errorf("error writing YAML file: %v", err)
+	if _, err := w.Write(yamlData); err != nil {
+		return fmt.Errorf("error writing YAML stream: %v", err)
 	}
 
 	return nil
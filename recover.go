@@ -0,0 +1,62 @@
+package mkconf
+
+import (
+	"errors"
+	"fmt"
+	"runtime/debug"
+)
+
+// ErrCallbackPanic is wrapped by the errors reporting a panic of a callback, recovered so the dispatch of the
+// changes of its configuration goes on.
+var ErrCallbackPanic = errors.New("callback panicked")
+
+// SetErrorFunc sets the function receiving the errors and warnings of the manager that are not returned to a caller,
+// e.g. the panics of callbacks wrapping ErrCallbackPanic, the errors of change and group monitoring and the file
+// events wrapping ErrFileEvent. Without one, or with nil, they are printed. The function is called on the goroutine
+// that hit the error, possibly while the configuration concerned is locked, so it must not call the manager back.
+func (cm *ConfigManager) SetErrorFunc(errorFunc func(err error)) {
+	if errorFunc == nil {
+		cm.errorFunc.Store(nil)
+		return
+	}
+	cm.errorFunc.Store(&errorFunc)
+}
+
+// reportError passes err to the error function, or prints it if none is set.
+func (cm *ConfigManager) reportError(err error) {
+	errorFunc := cm.errorFunc.Load()
+	if errorFunc == nil {
+		fmt.Printf("mkconf: %v\n", err)
+		return
+	}
+	(*errorFunc)(err)
+}
+
+// reportError passes err to the error function of the manager of the list, or prints it if there is none.
+func (c *ConfigList) reportError(err error) {
+	if c.errorFunc == nil {
+		fmt.Printf("mkconf: %v\n", err)
+		return
+	}
+	c.errorFunc(err)
+}
+
+// reportError passes err to the error function of the manager of the configuration, or prints it if there is none.
+func (c *ConfigSettings) reportError(err error) {
+	if c.errorFunc == nil {
+		fmt.Printf("mkconf: %v\n", err)
+		return
+	}
+	c.errorFunc(err)
+}
+
+// callCallback calls a callback through the callback middleware, recovering a panic and reporting it with the
+// stack of the callback, so neither the dispatch goroutine nor the other listeners are affected.
+func (cm *ConfigManager) callCallback(call CallbackCall, callback func()) {
+	defer func() {
+		if r := recover(); r != nil {
+			cm.reportError(fmt.Errorf("config %v: %v: %w: %v\n%s", call.ConfigName, call.Kind, ErrCallbackPanic, r, debug.Stack()))
+		}
+	}()
+	cm.withMiddleware(callback)(call)
+}
@@ -0,0 +1,477 @@
+package mkconf
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	reader "mkconf/readers"
+)
+
+// RedisOptions configures a Redis config source.
+type RedisOptions struct {
+	Addr         string        // Address of the server; "localhost:6379" if empty
+	Username     string        // User name of an ACL user; the default user if empty
+	Password     string        // Password; no authentication if empty
+	DB           int           // Number of the database holding the key
+	TLSConfig    *tls.Config   // TLS configuration; plain TCP if nil
+	Channel      string        // Pub/sub channel announcing changes; keyspace notifications of the key if empty
+	ReadOnly     bool          // Flag rejecting UpdateConfig instead of writing the key
+	DialTimeout  time.Duration // Timeout of connecting and of single commands; 5 seconds if zero
+	VersionField string        // Top-level field of the value holding a version number; enables replay protection if set
+	Source       SourceOptions // TLS, proxy and token provider settings; TLS settings enable TLS and a provided token is sent as the password
+}
+
+// RedisConfigSource is a configuration stored in a Redis string key. It speaks the Redis protocol directly,
+// so no client library is required. While watched, it subscribes to the keyspace notifications of the key
+// (which requires notify-keyspace-events to include "K$" or "KA" on the server) or to an explicit pub/sub
+// channel, and reloads the key as soon as a notification arrives.
+//
+// Redis values carry no version, so replay protection requires options.VersionField: writers increase this field
+// with every update, and a value whose version is not newer than the applied one is rejected. Rejected pushes
+// are recorded in the change log with a reason code (see RejectReplayed); Refresh returns a *RejectedChangeError.
+type RedisConfigSource struct {
+	key        string             // Redis key holding the configuration
+	configName string             // Name of the registered configuration
+	options    RedisOptions       // Source options
+	manager    *ConfigManager     // Manager the configuration is registered with
+	content    []byte             // Last value read from Redis
+	version    uint64             // Version of content, if options.VersionField is set
+	reader     reader.Reader      // Reader of the configuration type, reading the version
+	loaded     bool               // Flag indicating content holds a value
+	mu         sync.Mutex         // Mutex for synchronizing access to the content
+	cancel     context.CancelFunc // Function canceling the running subscription
+	waitGroup  sync.WaitGroup     // WaitGroup to wait for the subscription goroutine
+}
+
+// AddRedisConfig registers a configuration loaded from a Redis key. configType selects the reader (e.g. ".yaml").
+// Unless options.ReadOnly is set, UpdateConfig writes the value back to the key and, if options.Channel is set,
+// publishes the key on the channel so other instances reload it. Call StartWatching on the returned source to
+// apply changes as soon as they are announced.
+func (cm *ConfigManager) AddRedisConfig(configName, key, configType string, configInterface interface{}, options RedisOptions) (*RedisConfigSource, error) {
+	if options.Addr == "" {
+		options.Addr = "localhost:6379"
+	}
+	if options.DialTimeout <= 0 {
+		options.DialTimeout = 5 * time.Second
+	}
+	config, err := options.Source.tlsConfig(options.TLSConfig)
+	if err != nil {
+		return nil, fmt.Errorf("redis config %v: %v", configName, err)
+	}
+	options.TLSConfig = config
+
+	s := &RedisConfigSource{key: key, configName: configName, options: options, manager: cm}
+	if options.VersionField != "" {
+		s.reader = (&ConfigSettings{configType: configType}).checkReader()
+		if _, ok := s.reader.(reader.StreamReader); !ok {
+			return nil, fmt.Errorf("redis config %v: version fields are not supported for config type %v", configName, configType)
+		}
+	}
+	if err := cm.AddConfigFS(s, configName, "", configType, configInterface); err != nil {
+		return nil, err
+	}
+	cm.addRemoteSource(configName, s)
+	return s, nil
+}
+
+// Open implements fs.FS. Every name resolves to the value of the key; it is fetched if it was not read yet.
+func (s *RedisConfigSource) Open(name string) (fs.File, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.loaded {
+		if _, err := s.fetchLocked(context.Background()); err != nil {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+		}
+	}
+	return newRemoteFile(name, s.content), nil
+}
+
+// WriteFile implements reader.WriteFileFS by setting the key and announcing the change on the channel, if set.
+func (s *RedisConfigSource) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	if s.options.ReadOnly {
+		return fmt.Errorf("redis config %v: %w", s.configName, ErrReadOnlySource)
+	}
+	conn, err := dialRedis(context.Background(), s.options)
+	if err != nil {
+		return fmt.Errorf("redis set %v: %v", s.key, err)
+	}
+	defer conn.Close()
+	if _, err := conn.do("SET", s.key, string(data)); err != nil {
+		return fmt.Errorf("redis set %v: %v", s.key, err)
+	}
+	if s.options.Channel != "" {
+		if _, err := conn.do("PUBLISH", s.options.Channel, s.key); err != nil {
+			return fmt.Errorf("redis publish %v: %v", s.options.Channel, err)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.options.VersionField != "" {
+		if version, err := s.versionOf(data); err == nil {
+			s.version = version
+		}
+	}
+	s.content = append([]byte(nil), data...)
+	s.loaded = true
+	return nil
+}
+
+// Refresh re-reads the key and loads the configuration from its current value.
+// It is not needed while the source is watched.
+func (s *RedisConfigSource) Refresh() error {
+	s.mu.Lock()
+	_, err := s.fetchLocked(context.Background())
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return s.manager.LoadConfig(s.configName)
+}
+
+// StartWatching subscribes to the change notifications of the key and applies every change as soon as it is
+// announced. A broken subscription is re-established, and the key is re-read on every subscription, so changes
+// made while disconnected are not missed. Errors are reported through errorFunc if it is set.
+func (s *RedisConfigSource) StartWatching(errorFunc func(err error)) error {
+	s.StopWatching()
+	errorFunc = quietCircuitErrors(errorFunc)
+	if err := s.manager.setRemoteWatching(s.configName, true); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.mu.Lock()
+	s.cancel = cancel
+	s.mu.Unlock()
+
+	s.waitGroup.Add(1)
+	s.manager.configList.resources.acquire(s.configName, resourceRemoteWatch)
+	go func() {
+		defer s.waitGroup.Done()
+		defer s.manager.configList.resources.release(s.configName, resourceRemoteWatch)
+		for {
+			err := s.subscribe(ctx)
+			if ctx.Err() != nil {
+				return
+			}
+			if err != nil && errorFunc != nil {
+				errorFunc(fmt.Errorf("redis subscribe %v: %w", s.key, err))
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(time.Second):
+			}
+		}
+	}()
+	return nil
+}
+
+// StopWatching cancels the subscription and waits for it to finish.
+func (s *RedisConfigSource) StopWatching() {
+	s.mu.Lock()
+	cancel := s.cancel
+	s.cancel = nil
+	s.mu.Unlock()
+
+	if cancel == nil {
+		return
+	}
+	cancel()
+	s.waitGroup.Wait()
+
+	s.manager.setRemoteWatching(s.configName, false)
+}
+
+// subscribe runs a single subscription until the connection fails or ctx is canceled.
+func (s *RedisConfigSource) subscribe(ctx context.Context) error {
+	conn, err := dialRedis(ctx, s.options)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	channel := s.options.Channel
+	if channel == "" {
+		channel = fmt.Sprintf("__keyspace@%d__:%v", s.options.DB, s.key)
+	}
+	if err := conn.send("SUBSCRIBE", channel); err != nil {
+		return err
+	}
+	// Subscriptions never time out; only commands do.
+	conn.conn.SetDeadline(time.Time{})
+
+	for {
+		reply, err := conn.readReply()
+		if err != nil {
+			return err
+		}
+		message, ok := reply.([]interface{})
+		if !ok || len(message) < 3 {
+			return fmt.Errorf("unexpected reply %v", reply)
+		}
+		kind, _ := message[0].([]byte)
+		switch string(kind) {
+		case "subscribe":
+			// The key may have changed before the subscription was active.
+		case "message":
+			event, _ := message[2].([]byte)
+			if s.options.Channel == "" && (string(event) == "del" || string(event) == "expired" || string(event) == "evicted") {
+				// A deleted key keeps the last value, like a file that disappeared.
+				continue
+			}
+		default:
+			continue
+		}
+
+		s.mu.Lock()
+		changed, err := s.fetchLocked(ctx)
+		s.mu.Unlock()
+		var rejected *RejectedChangeError
+		if errors.As(err, &rejected) {
+			s.manager.rejectRemoteChange(s.configName, rejected)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if changed {
+			if err := s.manager.applyRemoteChange(s.configName); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// fetchLocked calls fetchOnceLocked according to the retry policy and circuit breaker of the configuration.
+// The caller must hold s.mu.
+func (s *RedisConfigSource) fetchLocked(ctx context.Context) (bool, error) {
+	var changed bool
+	err := s.manager.retryFetch(ctx, s.configName, func() error {
+		var err error
+		changed, err = s.fetchOnceLocked(ctx)
+		return err
+	})
+	return changed, err
+}
+
+// fetchOnceLocked reads the current value of the key and reports whether it changed. The caller must hold s.mu.
+func (s *RedisConfigSource) fetchOnceLocked(ctx context.Context) (bool, error) {
+	conn, err := dialRedis(ctx, s.options)
+	if err != nil {
+		return false, fmt.Errorf("redis get %v: %v", s.key, err)
+	}
+	defer conn.Close()
+	reply, err := conn.do("GET", s.key)
+	if err != nil {
+		return false, fmt.Errorf("redis get %v: %v", s.key, err)
+	}
+	value, ok := reply.([]byte)
+	if !ok {
+		return false, fmt.Errorf("redis get %v: key not found", s.key)
+	}
+
+	if s.options.VersionField != "" {
+		version, err := s.versionOf(value)
+		if err != nil {
+			return false, fmt.Errorf("redis get %v: %v", s.key, err)
+		}
+		if s.loaded {
+			if err := checkPushVersion(s.version, version, s.content, value); err != nil {
+				return false, err
+			}
+		}
+		s.version = version
+	}
+
+	changed := !s.loaded || !bytes.Equal(s.content, value)
+	s.content, s.loaded = value, true
+	s.manager.sourceReached(s.configName)
+	return changed, nil
+}
+
+// versionOf returns the version held by the VersionField of a value.
+func (s *RedisConfigSource) versionOf(value []byte) (uint64, error) {
+	values, err := decodeValues(s.reader, value)
+	if err != nil {
+		return 0, err
+	}
+	field, ok := values[s.options.VersionField]
+	if !ok {
+		return 0, fmt.Errorf("version field %v missing", s.options.VersionField)
+	}
+	text := fmt.Sprint(field)
+	if number, ok := field.(float64); ok {
+		// JSON numbers are decoded as float64.
+		text = strconv.FormatFloat(number, 'f', -1, 64)
+	}
+	version, err := strconv.ParseUint(text, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("version field %v: %v is not a version number", s.options.VersionField, field)
+	}
+	return version, nil
+}
+
+// redisConn is a connection speaking the Redis serialization protocol (RESP).
+type redisConn struct {
+	conn    net.Conn      // Underlying connection
+	reader  *bufio.Reader // Buffered reader of replies
+	timeout time.Duration // Timeout of single commands
+}
+
+// redisError is an error reply of the server.
+type redisError string
+
+func (e redisError) Error() string { return string(e) }
+
+// dialRedis connects to the server, authenticates and selects the database.
+func dialRedis(ctx context.Context, options RedisOptions) (*redisConn, error) {
+	password, err := options.Source.token(ctx, options.Password)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := options.Source.dial(ctx, &net.Dialer{Timeout: options.DialTimeout}, options.Addr)
+	if err != nil {
+		return nil, err
+	}
+	if options.TLSConfig != nil {
+		config := options.TLSConfig
+		if config.ServerName == "" {
+			host, _, _ := net.SplitHostPort(options.Addr)
+			config = config.Clone()
+			config.ServerName = host
+		}
+		tlsConn := tls.Client(conn, config)
+		handshakeCtx, cancel := context.WithTimeout(ctx, options.DialTimeout)
+		err := tlsConn.HandshakeContext(handshakeCtx)
+		cancel()
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		conn = tlsConn
+	}
+
+	c := &redisConn{conn: conn, reader: bufio.NewReader(conn), timeout: options.DialTimeout}
+	if password != "" {
+		args := []string{"AUTH", password}
+		if options.Username != "" {
+			args = []string{"AUTH", options.Username, password}
+		}
+		if _, err := c.do(args...); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("auth: %v", err)
+		}
+	}
+	if options.DB != 0 {
+		if _, err := c.do("SELECT", strconv.Itoa(options.DB)); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("select: %v", err)
+		}
+	}
+	return c, nil
+}
+
+// Close closes the connection.
+func (c *redisConn) Close() error {
+	return c.conn.Close()
+}
+
+// do sends a command and returns its reply. Error replies are returned as redisError.
+func (c *redisConn) do(args ...string) (interface{}, error) {
+	if err := c.send(args...); err != nil {
+		return nil, err
+	}
+	reply, err := c.readReply()
+	if err != nil {
+		return nil, err
+	}
+	if err, ok := reply.(redisError); ok {
+		return nil, err
+	}
+	return reply, nil
+}
+
+// send writes a command as an array of bulk strings.
+func (c *redisConn) send(args ...string) error {
+	c.conn.SetDeadline(time.Now().Add(c.timeout))
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	_, err := c.conn.Write(b.Bytes())
+	return err
+}
+
+// readReply reads a reply: a string, redisError, int64, []byte (nil for a null bulk string) or []interface{}.
+func (c *redisConn) readReply() (interface{}, error) {
+	line, err := c.reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, fmt.Errorf("redis: empty reply")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return redisError(line[1:]), nil
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		size, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if size < 0 {
+			return nil, nil
+		}
+		data := make([]byte, size+2)
+		if _, err := io.ReadFull(c.reader, data); err != nil {
+			return nil, err
+		}
+		return data[:size], nil
+	case '*':
+		count, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if count < 0 {
+			return nil, nil
+		}
+		items := make([]interface{}, count)
+		for i := range items {
+			if items[i], err = c.readReply(); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	default:
+		return nil, fmt.Errorf("redis: unexpected reply %q", line)
+	}
+}
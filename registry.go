@@ -0,0 +1,60 @@
+package mkconf
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	reader "mkconf/readers"
+)
+
+// ReaderFactory is a function type used to create a Reader for a registered file type.
+// Readers that also implement reader.Writer support UpdateConfig.
+type ReaderFactory func() reader.Reader
+
+var (
+	readerRegistryMutex sync.RWMutex                 // Mutex for synchronizing access to the reader registry
+	readerRegistry      = map[string]ReaderFactory{} // Registered reader factories keyed by lower-case extension
+)
+
+// RegisterReader registers a factory creating the Reader for files with the given extension (e.g. ".conf").
+// Registered readers take precedence over the built-in ones, so a built-in format can be overridden as well.
+// A nil factory removes the registration.
+func RegisterReader(ext string, factory func() reader.Reader) {
+	ext = strings.ToLower(ext)
+	if !strings.HasPrefix(ext, ".") {
+		ext = "." + ext
+	}
+
+	readerRegistryMutex.Lock()
+	defer readerRegistryMutex.Unlock()
+	if factory == nil {
+		delete(readerRegistry, ext)
+		return
+	}
+	readerRegistry[ext] = factory
+}
+
+// registeredReader returns the factory registered for the given extension.
+func registeredReader(ext string) (ReaderFactory, bool) {
+	readerRegistryMutex.RLock()
+	defer readerRegistryMutex.RUnlock()
+	factory, ok := readerRegistry[strings.ToLower(ext)]
+	return factory, ok
+}
+
+// DecodeConfig decodes configuration content of the given type (e.g. ".yaml") from a stream into v,
+// without registering a configuration. It is useful for configurations piped over stdin or sockets.
+func DecodeConfig(configType string, r io.Reader, v interface{}) error {
+	settings := ConfigSettings{configType: configType}
+	configReader := settings.checkReader()
+	if configReader == nil {
+		return fmt.Errorf("decode config: unsupported config type %q", configType)
+	}
+	streamReader, ok := configReader.(reader.StreamReader)
+	if !ok {
+		return fmt.Errorf("decode config: reader for %q does not support streams", configType)
+	}
+	return streamReader.ReadConfigFrom(r, v)
+}
@@ -0,0 +1,124 @@
+package mkconf
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"time"
+)
+
+// remoteSource is a config source pushing changes from a remote store.
+type remoteSource interface {
+	StopWatching()
+}
+
+// addRemoteSource registers a remote source, so it is stopped when its configuration is removed.
+func (cm *ConfigManager) addRemoteSource(configName string, source remoteSource) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	if cm.remoteSources == nil {
+		cm.remoteSources = make(map[string]remoteSource)
+	}
+	cm.remoteSources[configName] = source
+}
+
+// setRemoteWatching enables or disables change validation for a configuration whose changes are pushed
+// by a remote source watch instead of file polling.
+func (cm *ConfigManager) setRemoteWatching(configName string, enabled bool) error {
+	settings, ok := cm.configList.getSettings(configName)
+	if !ok {
+		return fmt.Errorf("config not found: %s", configName)
+	}
+	settings.mu.Lock()
+	settings.enableChangeValidation = enabled
+	settings.mu.Unlock()
+	return nil
+}
+
+// applyRemoteChange reloads a configuration after its remote source reported a change,
+// through the same change machinery as polled files, so callbacks and change logs are triggered.
+func (cm *ConfigManager) applyRemoteChange(configName string) error {
+	cm.mu.RLock()
+	v, ok := cm.configs[configName]
+	cm.mu.RUnlock()
+	if !ok {
+		return fmt.Errorf("config not found: %s", configName)
+	}
+	return cm.configList.checkConfigChanges(configName, v)
+}
+
+// Reason codes of remote changes rejected by replay protection, recorded in ConfigChangeLog.Reason.
+const (
+	RejectReplayed   = "replayed"     // The change carries the version already applied, but different content
+	RejectOutOfOrder = "out-of-order" // The change carries an older version than the applied one
+)
+
+// RejectedChangeError reports a remote change rejected because its version is not newer than the applied one.
+// Pushed changes that are rejected are recorded in the change log instead; Refresh returns this error.
+type RejectedChangeError struct {
+	Reason  string // Reason code, RejectReplayed or RejectOutOfOrder
+	Applied uint64 // Version of the applied content
+	Version uint64 // Version of the rejected content
+}
+
+// Error implements error.
+func (e *RejectedChangeError) Error() string {
+	return fmt.Sprintf("rejected %v change: version %d, applied version %d", e.Reason, e.Version, e.Applied)
+}
+
+// checkPushVersion returns an error if a change with version and content must be rejected after the content
+// with the applied version. A change repeating the applied content is not rejected, as it changes nothing;
+// this happens when a watch is re-established.
+func checkPushVersion(applied, version uint64, appliedContent, content []byte) error {
+	switch {
+	case version > applied || bytes.Equal(appliedContent, content):
+		return nil
+	case version == applied:
+		return &RejectedChangeError{Reason: RejectReplayed, Applied: applied, Version: version}
+	}
+	return &RejectedChangeError{Reason: RejectOutOfOrder, Applied: applied, Version: version}
+}
+
+// rejectRemoteChange records a remote change rejected by replay protection in the change log of the configuration,
+// if change tracking is enabled. The entry has no field name, the versions as old and new value and the reason code.
+func (cm *ConfigManager) rejectRemoteChange(configName string, rejected *RejectedChangeError) {
+	settings, ok := cm.configList.getSettings(configName)
+	if !ok || !settings.changeTrackingEnabled() {
+		return
+	}
+	cm.configList.logChanges(configName, []ConfigChangeLog{{
+		ConfigName: configName,
+		OldValue:   rejected.Applied,
+		NewValue:   rejected.Version,
+		Timestamp:  time.Now(),
+		Reason:     rejected.Reason,
+	}})
+}
+
+// remoteFile is an open value of a remote config source.
+type remoteFile struct {
+	*bytes.Reader
+	name string // Name the value was opened as
+	size int64  // Size of the value
+}
+
+// newRemoteFile returns an open file holding content.
+func newRemoteFile(name string, content []byte) *remoteFile {
+	return &remoteFile{Reader: bytes.NewReader(content), name: name, size: int64(len(content))}
+}
+
+// Stat implements fs.File.
+func (f *remoteFile) Stat() (fs.FileInfo, error) { return remoteFileInfo{f}, nil }
+
+// Close implements fs.File.
+func (f *remoteFile) Close() error { return nil }
+
+// remoteFileInfo describes an open remote value.
+type remoteFileInfo struct{ f *remoteFile }
+
+func (i remoteFileInfo) Name() string       { return i.f.name }
+func (i remoteFileInfo) Size() int64        { return i.f.size }
+func (i remoteFileInfo) Mode() fs.FileMode  { return 0444 }
+func (i remoteFileInfo) ModTime() time.Time { return time.Time{} }
+func (i remoteFileInfo) IsDir() bool        { return false }
+func (i remoteFileInfo) Sys() interface{}   { return nil }
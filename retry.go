@@ -0,0 +1,174 @@
+package mkconf
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// RetryPolicy configures retries and the circuit breaker of the fetches of a remote source. The zero value fetches
+// once and has no circuit breaker.
+type RetryPolicy struct {
+	Attempts  int           // Attempts per fetch, including the first; one if zero
+	BaseDelay time.Duration // Delay before the first retry, doubled with every further retry; 100ms if zero
+	MaxDelay  time.Duration // Upper bound of the delay; 10 seconds if zero
+	Jitter    float64       // Fraction of each delay that is randomized, from 0 (none) to 1 (full jitter)
+
+	BreakerThreshold int           // Consecutive failed fetches opening the circuit breaker; no breaker if zero
+	BreakerCooldown  time.Duration // Time the open breaker fails fetches fast before trying again; 30 seconds if zero
+}
+
+// circuitBreaker counts the consecutive failed fetches of a remote source.
+type circuitBreaker struct {
+	failures  int        // Consecutive failed fetches
+	openUntil time.Time  // End of the cooldown while the breaker is open
+	mu        sync.Mutex // Mutex for synchronizing access to the breaker
+}
+
+// SetRetryPolicy sets the retry policy of the fetches of the specified remote configuration. It may be called
+// before the configuration is added, so the first fetch is retried as well.
+func (cm *ConfigManager) SetRetryPolicy(configName string, policy RetryPolicy) {
+	cm.retryMu.Lock()
+	defer cm.retryMu.Unlock()
+	if cm.retryPolicies == nil {
+		cm.retryPolicies = make(map[string]RetryPolicy)
+	}
+	cm.retryPolicies[configName] = policy
+}
+
+// SetDefaultRetryPolicy sets the retry policy of remote configurations without a policy of their own.
+func (cm *ConfigManager) SetDefaultRetryPolicy(policy RetryPolicy) {
+	cm.retryMu.Lock()
+	defer cm.retryMu.Unlock()
+	cm.defaultRetryPolicy = policy
+}
+
+// CircuitOpen reports whether the circuit breaker of the specified configuration is open, so its fetches fail
+// fast with ErrCircuitOpen.
+func (cm *ConfigManager) CircuitOpen(configName string) bool {
+	cm.retryMu.Lock()
+	breaker := cm.breakers[configName]
+	cm.retryMu.Unlock()
+	if breaker == nil {
+		return false
+	}
+	breaker.mu.Lock()
+	defer breaker.mu.Unlock()
+	return time.Now().Before(breaker.openUntil)
+}
+
+// retryFetch calls fetch according to the retry policy of the configuration. Once the circuit breaker is open,
+// fetch is not called until the cooldown passed, and the error wraps ErrCircuitOpen; the error opening the breaker
+// does not, so it is reported once. Rejected changes are not retried and do not count as failed fetches.
+func (cm *ConfigManager) retryFetch(ctx context.Context, configName string, fetch func() error) error {
+	// The manager lock may be held by AddConfigFS while the first fetch runs.
+	cm.retryMu.Lock()
+	policy, ok := cm.retryPolicies[configName]
+	if !ok {
+		policy = cm.defaultRetryPolicy
+	}
+	var breaker *circuitBreaker
+	if policy.BreakerThreshold > 0 {
+		if cm.breakers == nil {
+			cm.breakers = make(map[string]*circuitBreaker)
+		}
+		if breaker = cm.breakers[configName]; breaker == nil {
+			breaker = &circuitBreaker{}
+			cm.breakers[configName] = breaker
+		}
+	}
+	cm.retryMu.Unlock()
+
+	attempts := policy.Attempts
+	if breaker != nil {
+		breaker.mu.Lock()
+		openUntil, failures := breaker.openUntil, breaker.failures
+		breaker.mu.Unlock()
+		if time.Now().Before(openUntil) {
+			return fmt.Errorf("config %v: %w until %v", configName, ErrCircuitOpen, openUntil.Format(time.RFC3339))
+		}
+		if failures >= policy.BreakerThreshold {
+			// The cooldown passed; a single trial fetch closes the breaker or opens it again.
+			attempts = 1
+		}
+	}
+
+	err := fetch()
+	for attempt := 1; attempt < attempts && err != nil && ctx.Err() == nil; attempt++ {
+		var rejected *RejectedChangeError
+		if errors.As(err, &rejected) {
+			break
+		}
+		timer := time.NewTimer(policy.delay(attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+		err = fetch()
+	}
+	if breaker == nil {
+		return err
+	}
+
+	breaker.mu.Lock()
+	defer breaker.mu.Unlock()
+	// A rejected change was fetched from a reachable source, so it closes the breaker like a successful fetch.
+	var rejected *RejectedChangeError
+	if err == nil || errors.As(err, &rejected) {
+		breaker.failures, breaker.openUntil = 0, time.Time{}
+		return err
+	}
+	breaker.failures++
+	if breaker.failures >= policy.BreakerThreshold {
+		cooldown := policy.BreakerCooldown
+		if cooldown <= 0 {
+			cooldown = 30 * time.Second
+		}
+		breaker.openUntil = time.Now().Add(cooldown)
+		return fmt.Errorf("%v (%d failed fetches, circuit breaker open for %v)", err, breaker.failures, cooldown)
+	}
+	return err
+}
+
+// delay returns the delay before the given retry, counted from 1.
+func (p RetryPolicy) delay(retry int) time.Duration {
+	base, limit := p.BaseDelay, p.MaxDelay
+	if base <= 0 {
+		base = 100 * time.Millisecond
+	}
+	if limit <= 0 {
+		limit = 10 * time.Second
+	}
+	delay := base
+	for i := 1; i < retry && delay < limit; i++ {
+		delay *= 2
+	}
+	if delay > limit {
+		delay = limit
+	}
+	if jitter := p.Jitter; jitter > 0 {
+		if jitter > 1 {
+			jitter = 1
+		}
+		delay -= time.Duration(rand.Float64() * jitter * float64(delay))
+	}
+	return delay
+}
+
+// quietCircuitErrors returns an error function that drops the errors of fetches failed fast by an open circuit
+// breaker, so a flapping backend is reported once per cooldown instead of on every poll.
+func quietCircuitErrors(errorFunc func(err error)) func(err error) {
+	if errorFunc == nil {
+		return nil
+	}
+	return func(err error) {
+		if !errors.Is(err, ErrCircuitOpen) {
+			errorFunc(err)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package mkconf
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestRetryFetchRejectedChangesKeepBreakerClosed(t *testing.T) {
+	for _, attempts := range []int{1, 3} {
+		t.Run(fmt.Sprintf("%d attempts", attempts), func(t *testing.T) {
+			testRejectedChangesKeepBreakerClosed(t, attempts)
+		})
+	}
+}
+
+func testRejectedChangesKeepBreakerClosed(t *testing.T, attempts int) {
+	cm := NewConfigManager()
+	cm.SetRetryPolicy("remote", RetryPolicy{Attempts: attempts, BaseDelay: time.Millisecond, BreakerThreshold: 2, BreakerCooldown: time.Hour})
+
+	// A failed fetch counts towards the threshold, and a replayed push afterwards resets the count.
+	failed := errors.New("connection refused")
+	if err := cm.retryFetch(context.Background(), "remote", func() error { return failed }); !errors.Is(err, failed) {
+		t.Fatalf("retryFetch = %v, want %v", err, failed)
+	}
+	for i := 0; i < 5; i++ {
+		calls := 0
+		replayed := checkPushVersion(7, 7, []byte("applied"), []byte("replayed"))
+		err := cm.retryFetch(context.Background(), "remote", func() error {
+			calls++
+			return replayed
+		})
+		var rejected *RejectedChangeError
+		if !errors.As(err, &rejected) || rejected.Reason != RejectReplayed {
+			t.Fatalf("retryFetch of a replayed push = %v, want a %v RejectedChangeError", err, RejectReplayed)
+		}
+		if calls != 1 {
+			t.Fatalf("replayed push fetched %d times, want 1", calls)
+		}
+		if cm.CircuitOpen("remote") {
+			t.Fatalf("circuit breaker open after %d replayed pushes", i+1)
+		}
+	}
+
+	// The replayed pushes reset the count, so a single further failure does not open the breaker.
+	cm.retryFetch(context.Background(), "remote", func() error { return failed })
+	if cm.CircuitOpen("remote") {
+		t.Fatal("circuit breaker open after one failed fetch following replayed pushes")
+	}
+
+	// A valid update still goes through.
+	if err := cm.retryFetch(context.Background(), "remote", func() error { return nil }); err != nil {
+		t.Fatalf("retryFetch of a valid update = %v", err)
+	}
+
+	// Failures still open the breaker.
+	for i := 0; i < 2; i++ {
+		cm.retryFetch(context.Background(), "remote", func() error { return failed })
+	}
+	if !cm.CircuitOpen("remote") {
+		t.Fatal("circuit breaker closed after reaching the threshold of failed fetches")
+	}
+	if err := cm.retryFetch(context.Background(), "remote", func() error { return nil }); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("retryFetch with open breaker = %v, want %v", err, ErrCircuitOpen)
+	}
+}
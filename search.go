@@ -0,0 +1,77 @@
+package mkconf
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// SearchResult is a value found by Search or SearchRegexp.
+type SearchResult struct {
+	ConfigName string // Name of the configuration holding the value
+	Path       string // Dot-separated path of the value, e.g. "db.pool.timeout" or "servers.0.host"
+	Value      string // Value as text; empty for nested structures and redacted for secrets
+	Type       string // Go type of the value
+}
+
+// Search finds the keys and values of a configuration, or of all configurations if configName is empty, that
+// contain query. Matching is approximate: it ignores case, "_" and "-", so "readtimeout" finds read_timeout and
+// Read-Timeout. Secret values are redacted and only matched by their keys, so searching cannot reveal them.
+// Results are ordered by configuration name and then as in the configuration.
+func (cm *ConfigManager) Search(configName, query string) ([]SearchResult, error) {
+	query = normalizeSearchText(query)
+	return cm.search(configName, func(text string) bool {
+		return strings.Contains(normalizeSearchText(text), query)
+	})
+}
+
+// SearchRegexp finds the keys and values of a configuration, or of all configurations if configName is empty,
+// matching pattern. A key matches with its full path, so "^db\\." finds all values below db. Secrets are handled
+// as by Search.
+func (cm *ConfigManager) SearchRegexp(configName string, pattern *regexp.Regexp) ([]SearchResult, error) {
+	return cm.search(configName, pattern.MatchString)
+}
+
+// search returns the values whose path or (non-secret) value satisfies match.
+func (cm *ConfigManager) search(configName string, match func(text string) bool) ([]SearchResult, error) {
+	var names []string
+	if configName != "" {
+		names = []string{configName}
+	} else {
+		for name := range cm.configsSnapshot() {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+	}
+
+	var results []SearchResult
+	for _, name := range names {
+		nodes, settings, err := cm.configNodes(name)
+		if err != nil {
+			return nil, err
+		}
+		redactor, _ := settings.fsys.(configRedactor)
+		for _, node := range nodes {
+			path := strings.Join(node.path, ".")
+			value := node.value
+			if unquoted, err := strconv.Unquote(value); err == nil {
+				value = unquoted
+			}
+			secret := node.leaf && redactor != nil && redactor.isSecret(node.path)
+			if !match(path) && (secret || !node.leaf || !match(value)) {
+				continue
+			}
+			if secret {
+				value = redactedValue
+			}
+			results = append(results, SearchResult{ConfigName: name, Path: path, Value: value, Type: node.valueType})
+		}
+	}
+	return results, nil
+}
+
+// normalizeSearchText returns text in lower case without "_" and "-".
+func normalizeSearchText(text string) string {
+	return strings.NewReplacer("_", "", "-", "").Replace(strings.ToLower(text))
+}
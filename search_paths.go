@@ -0,0 +1,85 @@
+package mkconf
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// ErrConfigNotFound is returned when a configuration file is in none of the searched directories.
+var ErrConfigNotFound = errors.New("config file not found")
+
+// ConfigSearchPaths returns the directories configuration files of an application are conventionally kept in on
+// the current platform, in the order they are searched, with appName appended to each:
+//
+//   - Windows: %APPDATA%, then %ProgramData%
+//   - macOS: $XDG_CONFIG_HOME, ~/Library/Application Support, ~/.config, then /etc
+//   - other systems: $XDG_CONFIG_HOME, ~/.config, the directories of $XDG_CONFIG_DIRS (/etc/xdg if unset), then /etc
+//
+// Directories whose base is unknown, e.g. an unset variable or home directory, are left out.
+func ConfigSearchPaths(appName string) []string {
+	home, _ := os.UserHomeDir()
+	homeDir := func(elem ...string) string {
+		if home == "" {
+			return ""
+		}
+		return filepath.Join(append([]string{home}, elem...)...)
+	}
+
+	var bases []string
+	switch runtime.GOOS {
+	case "windows":
+		bases = []string{os.Getenv("APPDATA"), os.Getenv("ProgramData")}
+	case "darwin":
+		bases = []string{os.Getenv("XDG_CONFIG_HOME"), homeDir("Library", "Application Support"), homeDir(".config"), "/etc"}
+	default:
+		bases = []string{os.Getenv("XDG_CONFIG_HOME"), homeDir(".config")}
+		configDirs := os.Getenv("XDG_CONFIG_DIRS")
+		if configDirs == "" {
+			configDirs = "/etc/xdg"
+		}
+		bases = append(bases, filepath.SplitList(configDirs)...)
+		bases = append(bases, "/etc")
+	}
+
+	var dirs []string
+	seen := make(map[string]bool)
+	for _, base := range bases {
+		// Relative paths in the variables are invalid and ignored, as the XDG specification requires.
+		if base == "" || !filepath.IsAbs(base) {
+			continue
+		}
+		dir := filepath.Join(base, appName)
+		if !seen[dir] {
+			seen[dir] = true
+			dirs = append(dirs, dir)
+		}
+	}
+	return dirs
+}
+
+// FindConfigDir returns the first directory of ConfigSearchPaths(appName) containing fileName, e.g. "app.yaml",
+// so it can be passed to AddConfig. It returns an error wrapping ErrConfigNotFound that lists the searched
+// directories if no directory contains the file.
+func FindConfigDir(appName, fileName string) (string, error) {
+	dirs := ConfigSearchPaths(appName)
+	for _, dir := range dirs {
+		if info, err := os.Stat(filepath.Join(dir, fileName)); err == nil && !info.IsDir() {
+			return dir, nil
+		}
+	}
+	return "", fmt.Errorf("%v: %w in %v", fileName, ErrConfigNotFound, strings.Join(dirs, ", "))
+}
+
+// AddConfigFromSearchPaths adds the configuration file configName+configType found in the conventional directories
+// of the application, see FindConfigDir, like AddConfig.
+func (cm *ConfigManager) AddConfigFromSearchPaths(appName, configName, configType string, configInterface interface{}) error {
+	dir, err := FindConfigDir(appName, configName+configType)
+	if err != nil {
+		return err
+	}
+	return cm.AddConfig(configName, dir, configType, configInterface)
+}
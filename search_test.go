@@ -0,0 +1,94 @@
+package mkconf
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+type searchConfig struct {
+	DB struct {
+		Pool struct {
+			ReadTimeout int `json:"read_timeout"`
+		} `json:"pool"`
+		Host string `json:"host"`
+	} `json:"db"`
+	Servers []struct {
+		Host string `json:"host"`
+		Port int    `json:"port"`
+	} `json:"servers"`
+	Tags []string `json:"tags"`
+}
+
+func TestSearch(t *testing.T) {
+	dir := t.TempDir()
+	content := `{"db": {"pool": {"read_timeout": 30}, "host": "db.local"},
+		"servers": [{"host": "a.local", "port": 80}, {"host": "b.local", "port": 443}],
+		"tags": ["blue", "green"]}`
+	if err := os.WriteFile(filepath.Join(dir, "app.json"), []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cm := NewConfigManager()
+	var cfg searchConfig
+	if err := cm.AddConfig("app", dir, ".json", &cfg); err != nil {
+		t.Fatalf("AddConfig: %v", err)
+	}
+	if err := cm.LoadConfig("app"); err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+
+	result := func(path, value, valueType string) SearchResult {
+		return SearchResult{ConfigName: "app", Path: path, Value: value, Type: valueType}
+	}
+	tests := []struct {
+		name  string
+		query string
+		want  []SearchResult
+	}{
+		{"nested key, approximately", "ReadTimeout", []SearchResult{result("db.pool.read_timeout", "30", "int")}},
+		{"nested path", "pool.read", []SearchResult{result("db.pool.read_timeout", "30", "int")}},
+		{"values", "local", []SearchResult{
+			result("db.host", "db.local", "string"),
+			result("servers.0.host", "a.local", "string"),
+			result("servers.1.host", "b.local", "string"),
+		}},
+		{"keys in list elements", "port", []SearchResult{
+			result("servers.0.port", "80", "int"),
+			result("servers.1.port", "443", "int"),
+		}},
+		{"list element value", "green", []SearchResult{result("tags.1", "green", "string")}},
+		{"list key", "tags", []SearchResult{
+			result("tags", "", "[]string"),
+			result("tags.0", "blue", "string"),
+			result("tags.1", "green", "string"),
+		}},
+		{"no match", "nothing", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := cm.Search("app", tt.query)
+			if err != nil {
+				t.Fatalf("Search: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("Search(%q) = %+v, want %+v", tt.query, got, tt.want)
+			}
+		})
+	}
+
+	got, err := cm.SearchRegexp("", regexp.MustCompile(`^servers\.\d+\.host$`))
+	if err != nil {
+		t.Fatalf("SearchRegexp: %v", err)
+	}
+	if want := []SearchResult{result("servers.0.host", "a.local", "string"), result("servers.1.host", "b.local", "string")}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("SearchRegexp = %+v, want %+v", got, want)
+	}
+	if got, err := cm.SearchRegexp("app", regexp.MustCompile(`^missing`)); err != nil || got != nil {
+		t.Fatalf("SearchRegexp without match = %+v, %v, want none", got, err)
+	}
+	if _, err := cm.Search("unknown", "port"); err == nil {
+		t.Fatal("Search of an unknown configuration succeeded")
+	}
+}
@@ -0,0 +1,308 @@
+package mkconf
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+
+	reader "mkconf/readers"
+)
+
+// redactedValue replaces secret values in change logs and quarantine reports.
+const redactedValue = "[REDACTED]"
+
+// secretsFS presents a values file merged with its optional secrets file (e.g. config.yaml and
+// config.secrets.yaml) as a single configuration file. Values in the secrets file take precedence.
+type secretsFS struct {
+	valuesPath  string                 // Path to the values file
+	secretsPath string                 // Path to the secrets file, which may be absent
+	reader      reader.Reader          // Reader of the configuration type, implementing reader.StreamReader and reader.StreamWriter
+	secrets     map[string]interface{} // Secrets read last, nil if the secrets file is absent
+	mu          sync.Mutex             // Mutex for synchronizing access to the secrets
+	secretRedaction
+}
+
+// configRedactor is implemented by config sources whose content holds secrets that must not show up
+// in change logs, quarantine reports or world-readable snapshots.
+type configRedactor interface {
+	redactChanges(changes []ConfigChangeLog)
+	redactText(text string) string
+	isSecret(path []string) bool
+}
+
+// secretRedaction records the secrets of a configuration so they can be redacted.
+type secretRedaction struct {
+	known    map[string]interface{} // Every secret path seen so far, so removed secrets stay redacted
+	texts    map[string]bool        // Every secret value seen so far, as text
+	redactMu sync.Mutex             // Mutex for synchronizing access to the recorded secrets
+}
+
+// AddConfigWithSecrets adds a configuration split into a values file and a secrets file next to it, named
+// configName + ".secrets" + configType (e.g. config.yaml and config.secrets.yaml). Both files are merged, with the
+// secrets file taking precedence, and both are watched for changes. The secrets file may be absent; if present, it
+// must not be accessible by group or others. Secret values are redacted from change logs and quarantine reports,
+// and UpdateConfig writes only the values file, leaving secrets out of it.
+func (cm *ConfigManager) AddConfigWithSecrets(configName, configPath, configType string, configInterface interface{}) error {
+	if reader.CompressionExt(configType) != "" {
+		return fmt.Errorf("config %v: secrets files are not supported for compressed configurations", configName)
+	}
+	configReader := (&ConfigSettings{configType: configType}).checkReader()
+	_, canRead := configReader.(reader.StreamReader)
+	_, canWrite := configReader.(reader.StreamWriter)
+	if !canRead || !canWrite {
+		return fmt.Errorf("config %v: secrets files are not supported for config type %v", configName, configType)
+	}
+
+	s := &secretsFS{
+		valuesPath:  filepath.Join(configPath, configName+configType),
+		secretsPath: filepath.Join(configPath, configName+".secrets"+configType),
+		reader:      configReader,
+	}
+	return cm.AddConfigFS(s, configName, configPath, configType, configInterface)
+}
+
+// Open implements fs.FS. Every name resolves to the merged content of the values and secrets files.
+func (s *secretsFS) Open(name string) (fs.File, error) {
+	content, err := s.merged()
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	return newRemoteFile(name, content), nil
+}
+
+// WriteFile implements reader.WriteFileFS. Secrets are removed from data before it is written to the values file.
+func (s *secretsFS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	s.mu.Lock()
+	secrets := s.secrets
+	s.mu.Unlock()
+	if secrets == nil {
+		return ioutil.WriteFile(s.valuesPath, data, perm)
+	}
+
+	values, err := decodeValues(s.reader, data)
+	if err != nil {
+		return err
+	}
+	removeSecrets(values, secrets)
+	var b bytes.Buffer
+	if err := s.reader.(reader.StreamWriter).WriteConfigTo(&b, values); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(s.valuesPath, b.Bytes(), perm)
+}
+
+// merged reads both files and returns the values file with the secrets merged in.
+// The values file is returned unchanged if there is no secrets file.
+func (s *secretsFS) merged() ([]byte, error) {
+	content, err := ioutil.ReadFile(s.valuesPath)
+	if err != nil {
+		return nil, err
+	}
+	secrets, err := s.readSecrets()
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	s.secrets = secrets
+	s.mu.Unlock()
+	if secrets != nil {
+		s.recordSecrets(secrets)
+	}
+	if secrets == nil {
+		return content, nil
+	}
+
+	values, err := decodeValues(s.reader, content)
+	if err != nil {
+		return nil, err
+	}
+	mergeValues(values, secrets)
+	var b bytes.Buffer
+	if err := s.reader.(reader.StreamWriter).WriteConfigTo(&b, values); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// readSecrets reads the secrets file. It returns nil if the file does not exist, and an error if it is
+// accessible by group or others.
+func (s *secretsFS) readSecrets() (map[string]interface{}, error) {
+	info, err := os.Stat(s.secretsPath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if runtime.GOOS != "windows" && info.Mode().Perm()&0077 != 0 {
+		return nil, fmt.Errorf("secrets file %v is accessible by group or others (mode %v), expected 0600", s.secretsPath, info.Mode().Perm())
+	}
+
+	content, err := ioutil.ReadFile(s.secretsPath)
+	if err != nil {
+		return nil, err
+	}
+	secrets, err := decodeValues(s.reader, content)
+	if err != nil {
+		return nil, fmt.Errorf("secrets file %v: %v", s.secretsPath, err)
+	}
+	return secrets, nil
+}
+
+// decodeValues parses content with configReader, which must implement reader.StreamReader,
+// into a map with string keys at every level.
+func decodeValues(configReader reader.Reader, content []byte) (map[string]interface{}, error) {
+	var values map[string]interface{}
+	if err := configReader.(reader.StreamReader).ReadConfigFrom(bytes.NewReader(content), &values); err != nil {
+		return nil, err
+	}
+	if values == nil {
+		return make(map[string]interface{}), nil
+	}
+	return jsonCompatible(values).(map[string]interface{}), nil
+}
+
+// recordSecrets records a tree of secret values, keyed like the configuration.
+func (s *secretRedaction) recordSecrets(secrets map[string]interface{}) {
+	s.redactMu.Lock()
+	defer s.redactMu.Unlock()
+	if s.known == nil {
+		s.known = make(map[string]interface{})
+		s.texts = make(map[string]bool)
+	}
+	mergeValues(s.known, secrets)
+	collectSecretTexts(secrets, s.texts)
+}
+
+// redactChanges replaces the secret values in change log entries.
+func (s *secretRedaction) redactChanges(changes []ConfigChangeLog) {
+	s.redactMu.Lock()
+	defer s.redactMu.Unlock()
+	for i := range changes {
+		secret, ok := s.known[changes[i].FieldName]
+		if !ok {
+			continue
+		}
+		changes[i].OldValue = redactValue(changes[i].OldValue, secret)
+		changes[i].NewValue = redactValue(changes[i].NewValue, secret)
+	}
+}
+
+// isSecret reports whether the value at path is a secret seen so far, or part of one.
+func (s *secretRedaction) isSecret(path []string) bool {
+	s.redactMu.Lock()
+	defer s.redactMu.Unlock()
+	var value interface{} = s.known
+	for _, key := range path {
+		secrets, ok := value.(map[string]interface{})
+		if !ok {
+			return true
+		}
+		if value, ok = secrets[key]; !ok {
+			return false
+		}
+	}
+	_, nested := value.(map[string]interface{})
+	return !nested
+}
+
+// redactText replaces every secret value seen so far in text.
+func (s *secretRedaction) redactText(text string) string {
+	s.redactMu.Lock()
+	defer s.redactMu.Unlock()
+	for secret := range s.texts {
+		text = strings.ReplaceAll(text, secret, redactedValue)
+	}
+	return text
+}
+
+// mergeValues merges src into dst recursively; values in src take precedence.
+func mergeValues(dst, src map[string]interface{}) {
+	for key, value := range src {
+		srcMap, srcIsMap := value.(map[string]interface{})
+		dstMap, dstIsMap := dst[key].(map[string]interface{})
+		if srcIsMap && dstIsMap {
+			mergeValues(dstMap, srcMap)
+			continue
+		}
+		if srcIsMap {
+			copied := make(map[string]interface{}, len(srcMap))
+			mergeValues(copied, srcMap)
+			value = copied
+		}
+		dst[key] = value
+	}
+}
+
+// removeSecrets deletes every value of values that is defined in secrets.
+func removeSecrets(values, secrets map[string]interface{}) {
+	for key, secret := range secrets {
+		secretMap, secretIsMap := secret.(map[string]interface{})
+		valueMap, valueIsMap := values[key].(map[string]interface{})
+		if secretIsMap && valueIsMap {
+			removeSecrets(valueMap, secretMap)
+			if len(valueMap) == 0 {
+				delete(values, key)
+			}
+			continue
+		}
+		delete(values, key)
+	}
+}
+
+// redactValue replaces the parts of value that are defined in secret.
+func redactValue(value, secret interface{}) interface{} {
+	if value == nil {
+		return nil
+	}
+	secretMap, ok := secret.(map[string]interface{})
+	if !ok {
+		return redactedValue
+	}
+	valueMap, ok := jsonCompatible(value).(map[string]interface{})
+	if !ok {
+		return redactedValue
+	}
+	redacted := make(map[string]interface{}, len(valueMap))
+	for key, item := range valueMap {
+		if nested, ok := secretMap[key]; ok {
+			item = redactValue(item, nested)
+		}
+		redacted[key] = item
+	}
+	return redacted
+}
+
+// collectSecretTexts adds the text of every scalar secret value to texts.
+func collectSecretTexts(value interface{}, texts map[string]bool) {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		for _, item := range value {
+			collectSecretTexts(item, texts)
+		}
+	case []interface{}:
+		for _, item := range value {
+			collectSecretTexts(item, texts)
+		}
+	case nil, bool:
+	default:
+		// Very short values would redact unrelated text.
+		if text := fmt.Sprint(value); len(text) >= 4 {
+			texts[text] = true
+		}
+	}
+}
+
+// redactChanges replaces secret values in change log entries of a configuration whose source holds secrets.
+func (c *ConfigSettings) redactChanges(changes []ConfigChangeLog) {
+	if redactor, ok := c.fsys.(configRedactor); ok {
+		redactor.redactChanges(changes)
+	}
+}
@@ -0,0 +1,18 @@
+package mkconf
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// SnapshotHash returns a stable hash of the applied values of the specified configuration.
+// It is computed from the canonical JSON encoding of the values, so it only changes when the configuration's
+// semantics change, not when the file is reformatted, reordered or commented. It can be used as a cache key or ETag.
+func (cm *ConfigManager) SnapshotHash(configName string) (string, error) {
+	value, err := cm.effectiveConfig(configName)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(value)
+	return hex.EncodeToString(sum[:]), nil
+}
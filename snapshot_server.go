@@ -0,0 +1,241 @@
+package mkconf
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	snapshotRequestTimeout = 200 * time.Millisecond // Time to wait for a request line before sending all configurations
+	snapshotWatchInterval  = 500 * time.Millisecond // Interval at which watched configurations are checked for changes
+)
+
+// SnapshotServer publishes the effective configuration snapshot on a local unix socket,
+// so sidecar processes and scripts can read the same values the service uses.
+//
+// Protocol: a client connects and optionally sends one request line, then reads the JSON response
+// until the server closes the connection. Supported requests:
+//   - "GET <name>": the effective value of one configuration
+//   - "LIST": the names of all configurations
+//   - "ALL" or no request within 200ms: an object with all configurations keyed by name
+//   - "WATCH [<name>]": the current value of one (or all) configurations as a JSON line, followed by a new
+//     line every time the value changes; the connection stays open until the client or server closes it
+//
+// Responses are single JSON lines. Errors are returned as {"error": "..."}. For example: echo "GET app" | socat - UNIX-CONNECT:/run/app/mkconf.sock
+type SnapshotServer struct {
+	manager   *ConfigManager // Manager whose configurations are published
+	listener  net.Listener   // Unix socket listener
+	path      string         // Path of the socket file
+	waitGroup sync.WaitGroup // WaitGroup to wait for the accept loop and connections
+	done      chan struct{}  // Channel closed when the server is closed, ending watches
+}
+
+// ServeSnapshot starts a SnapshotServer on the unix socket at socketPath, replacing a stale socket file.
+// The socket is accessible by the owner and group of the process. Close the server to stop it.
+func (cm *ConfigManager) ServeSnapshot(socketPath string) (*SnapshotServer, error) {
+	if info, err := os.Lstat(socketPath); err == nil && info.Mode()&os.ModeSocket != 0 {
+		os.Remove(socketPath)
+	}
+
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return nil, fmt.Errorf("snapshot server: %v", err)
+	}
+	if err := os.Chmod(socketPath, 0660); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("snapshot server: %v", err)
+	}
+
+	s := &SnapshotServer{manager: cm, listener: listener, path: socketPath, done: make(chan struct{})}
+	s.waitGroup.Add(1)
+	go s.serve()
+	return s, nil
+}
+
+// Close stops the server, ends watches, waits for open connections to finish and removes the socket file.
+func (s *SnapshotServer) Close() error {
+	close(s.done)
+	err := s.listener.Close()
+	s.waitGroup.Wait()
+	os.Remove(s.path)
+	return err
+}
+
+// serve accepts connections until the listener is closed.
+func (s *SnapshotServer) serve() {
+	defer s.waitGroup.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.waitGroup.Add(1)
+		go func() {
+			defer s.waitGroup.Done()
+			defer conn.Close()
+			s.handle(conn)
+		}()
+	}
+}
+
+// handle answers a single request.
+func (s *SnapshotServer) handle(conn net.Conn) {
+	conn.SetReadDeadline(time.Now().Add(snapshotRequestTimeout))
+	request, _ := bufio.NewReader(conn).ReadString('\n')
+	conn.SetReadDeadline(time.Time{})
+
+	command, argument := splitFirstWord(strings.TrimSpace(request))
+	var response interface{}
+	switch strings.ToUpper(command) {
+	case "", "ALL":
+		response = s.manager.effectiveSnapshot()
+	case "LIST":
+		names := s.manager.configList.GetConfigNames()
+		sort.Strings(names)
+		response = names
+	case "WATCH":
+		s.watch(conn, argument)
+		return
+	case "GET":
+		value, err := s.manager.effectiveConfig(argument)
+		if err != nil {
+			response = map[string]string{"error": err.Error()}
+		} else {
+			response = value
+		}
+	default:
+		response = map[string]string{"error": fmt.Sprintf("unknown request %q", command)}
+	}
+
+	conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+	json.NewEncoder(conn).Encode(response)
+}
+
+// watch writes the value of the configuration (or of all configurations if configName is empty)
+// every time it changes, until the client disconnects or the server is closed.
+func (s *SnapshotServer) watch(conn net.Conn, configName string) {
+	disconnected := make(chan struct{})
+	go func() {
+		// The client sends nothing after the request; a read returns once it disconnects.
+		buf := make([]byte, 1)
+		for {
+			if _, err := conn.Read(buf); err != nil {
+				close(disconnected)
+				return
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(snapshotWatchInterval)
+	defer ticker.Stop()
+
+	var last []byte
+	for {
+		var response interface{}
+		if configName == "" {
+			response = s.manager.effectiveSnapshot()
+		} else if value, err := s.manager.effectiveConfig(configName); err != nil {
+			response = map[string]string{"error": err.Error()}
+		} else {
+			response = value
+		}
+
+		data, err := json.Marshal(response)
+		if err == nil && !bytes.Equal(data, last) {
+			last = data
+			conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+			if _, err := conn.Write(append(data, '\n')); err != nil {
+				return
+			}
+		}
+
+		select {
+		case <-ticker.C:
+		case <-disconnected:
+			return
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// effectiveSnapshot returns the JSON encoding of every configuration keyed by name.
+func (cm *ConfigManager) effectiveSnapshot() map[string]json.RawMessage {
+	snapshot := make(map[string]json.RawMessage)
+	for name := range cm.configsSnapshot() {
+		if value, err := cm.effectiveConfig(name); err == nil {
+			snapshot[name] = value
+		}
+	}
+	return snapshot
+}
+
+// effectiveConfig returns the JSON encoding of the current value of the configuration.
+func (cm *ConfigManager) effectiveConfig(configName string) (json.RawMessage, error) {
+	configInterface, err := cm.GetConfig(configName)
+	if err != nil {
+		return nil, err
+	}
+	settings, ok := cm.configList.getSettings(configName)
+	if !ok {
+		return nil, fmt.Errorf("config with name %s not found", configName)
+	}
+
+	// Hold the lock so the configuration is not reloaded while it is encoded.
+	settings.mu.Lock()
+	defer settings.mu.Unlock()
+	data, err := json.Marshal(jsonCompatible(configInterface))
+	if err != nil {
+		return nil, fmt.Errorf("config %v: %v", configName, err)
+	}
+	return data, nil
+}
+
+// jsonCompatible converts generic maps decoded with interface{} keys (e.g. by the YAML reader)
+// into maps with string keys, so they can be encoded as JSON. Other values are returned unchanged.
+func jsonCompatible(v interface{}) interface{} {
+	switch value := v.(type) {
+	case *interface{}:
+		if value == nil {
+			return nil
+		}
+		return jsonCompatible(*value)
+	case *map[string]interface{}:
+		if value == nil {
+			return nil
+		}
+		return jsonCompatible(*value)
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(value))
+		for k, item := range value {
+			result[k] = jsonCompatible(item)
+		}
+		return result
+	case map[interface{}]interface{}:
+		return jsonCompatible(toStringMap(value))
+	case []interface{}:
+		result := make([]interface{}, len(value))
+		for i, item := range value {
+			result[i] = jsonCompatible(item)
+		}
+		return result
+	default:
+		return v
+	}
+}
+
+// splitFirstWord splits s into its first space-separated word and the trimmed remainder.
+func splitFirstWord(s string) (string, string) {
+	if i := strings.IndexAny(s, " \t"); i >= 0 {
+		return s[:i], strings.TrimSpace(s[i:])
+	}
+	return s, ""
+}
@@ -0,0 +1,120 @@
+package mkconf
+
+import (
+	"bufio"
+	"bytes"
+	"regexp"
+	"strconv"
+	"strings"
+
+	reader "mkconf/readers"
+)
+
+var (
+	sniffSectionLine  = regexp.MustCompile(`^\[\[?[^\]\[{}"',]+\]\]?\s*([#;].*)?$`)                       // INI/TOML section header
+	sniffKeyValueLine = regexp.MustCompile(`^["']?[A-Za-z0-9_.\- ]+["']?\s*=\s*(.*)$`)                    // INI/TOML key = value
+	sniffYAMLLine     = regexp.MustCompile(`^(- |[A-Za-z0-9_.\-"' ]+:(\s|$))`)                            // YAML mapping or sequence entry
+	sniffTOMLValue    = regexp.MustCompile(`^("|'|\[|\{|true$|false$|[+-]?(inf|nan)$|\d{4}-\d{2}-\d{2})`) // Typed TOML value
+)
+
+// SetContentSniffing enables or disables content sniffing for configurations added afterwards.
+// When enabled, a configuration whose extension is missing or has no reader gets its reader
+// selected by inspecting the file content instead (leading "{", "---", "[section]", etc.).
+func (cm *ConfigManager) SetContentSniffing(enabled bool) {
+	cm.configList.settingsMutex.Lock()
+	defer cm.configList.settingsMutex.Unlock()
+	cm.configList.contentSniffing = enabled
+}
+
+// contentSniffingEnabled reports whether content sniffing is enabled.
+func (cm *ConfigManager) contentSniffingEnabled() bool {
+	cm.configList.settingsMutex.Lock()
+	defer cm.configList.settingsMutex.Unlock()
+	return cm.configList.contentSniffing
+}
+
+// sniffReader selects the reader by sniffing the content of the configuration file.
+// It returns the updated ConfigSettings instance.
+func (c *ConfigSettings) sniffReader() *ConfigSettings {
+	if reader.CompressionExt(c.configFullPath) != "" {
+		return c
+	}
+	content, err := c.source().ReadSourceFile(c.configFullPath)
+	if err != nil {
+		return c
+	}
+
+	sniffed := ConfigSettings{configType: SniffConfigType(content)}
+	if sniffed.configType != "" {
+		c.Reader = sniffed.checkReader()
+		c.applySource()
+	}
+	return c
+}
+
+// SniffConfigType guesses the config type (e.g. ".json") of the content, or returns an empty string.
+func SniffConfigType(content []byte) string {
+	if bytes.HasPrefix(content, []byte("bplist")) {
+		return ".plist"
+	}
+	decoded, err := reader.Source{}.DecodeContent("", content)
+	if err == nil {
+		content = decoded
+	}
+
+	trimmed := bytes.TrimSpace(content)
+	switch {
+	case len(trimmed) == 0:
+		return ""
+	case trimmed[0] == '<':
+		if bytes.Contains(trimmed, []byte("<plist")) {
+			return ".plist"
+		}
+		return ".xml"
+	case trimmed[0] == '{':
+		return ".json"
+	case bytes.HasPrefix(trimmed, []byte("---")):
+		return ".yaml"
+	}
+
+	sections, keyValues, yamlLines, typedValues, untypedValues := 0, 0, 0, 0, 0
+	scanner := bufio.NewScanner(bytes.NewReader(trimmed))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+
+		switch {
+		case sniffSectionLine.MatchString(line):
+			sections++
+			if strings.HasPrefix(line, "[[") {
+				typedValues++
+			}
+		case sniffKeyValueLine.MatchString(line):
+			keyValues++
+			value := strings.TrimSpace(sniffKeyValueLine.FindStringSubmatch(line)[1])
+			if _, err := strconv.ParseFloat(strings.ReplaceAll(value, "_", ""), 64); err == nil || sniffTOMLValue.MatchString(value) {
+				typedValues++
+			} else {
+				untypedValues++
+			}
+		case sniffYAMLLine.MatchString(line):
+			yamlLines++
+		}
+	}
+
+	switch {
+	case trimmed[0] == '[' && sections == 0:
+		return ".json"
+	case sections+keyValues > yamlLines:
+		// Unquoted string values are invalid TOML, so they indicate INI.
+		if untypedValues > 0 || typedValues == 0 {
+			return ".ini"
+		}
+		return ".toml"
+	case yamlLines > 0:
+		return ".yaml"
+	}
+	return ""
+}
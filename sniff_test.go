@@ -0,0 +1,81 @@
+package mkconf
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSniffConfigType(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		// Detection branches.
+		{"binary plist", "bplist00\x00\x01", ".plist"},
+		{"XML plist", `<?xml version="1.0"?><plist version="1.0"><dict/></plist>`, ".plist"},
+		{"XML", "<config><port>80</port></config>", ".xml"},
+		{"JSON object", `{"port": 80}`, ".json"},
+		{"JSON array", `[80, 443]`, ".json"},
+		{"YAML document marker", "---\nport: 80\n", ".yaml"},
+		{"YAML mapping", "server:\n  port: 80\n", ".yaml"},
+		{"YAML sequence", "- 80\n- 443\n", ".yaml"},
+		{"TOML", "title = \"app\"\n[server]\nport = 80\n", ".toml"},
+		{"TOML array of tables", "[[servers]]\nhost = \"a\"\n", ".toml"},
+		{"INI", "[server]\nhost = localhost\nport = 80\n", ".ini"},
+		{"UTF-8 BOM", "\xEF\xBB\xBF{\"port\": 80}", ".json"},
+
+		// Ambiguous content.
+		{"YAML flow mapping looking like JSON", `{port: 80}`, ".json"},
+		{"YAML with JSON values", "server: {\"port\": 80}\nhosts: [\"a\", \"b\"]\n", ".yaml"},
+		{"section with typed values only", "[server]\nport = 80\nenabled = true\n", ".toml"},
+		{"section with an unquoted string", "[server]\nport = 80\nhost = localhost\n", ".ini"},
+		{"section without values", "[server]\n", ".ini"},
+		{"comments", "# port = 80\n; host = x\nport: 80\n", ".yaml"},
+
+		// Fallback.
+		{"empty", "  \n\t\n", ""},
+		{"plain text", "just some words\n", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := SniffConfigType([]byte(tt.content)); got != tt.want {
+				t.Fatalf("SniffConfigType(%q) = %q, want %q", tt.content, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestContentSniffing(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "app"), []byte("port: 8080\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "notes"), []byte("just some words\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	type config struct {
+		Port int `yaml:"port"`
+	}
+
+	cm := NewConfigManager()
+	cm.SetContentSniffing(true)
+	var app config
+	if err := cm.AddConfig("app", dir, "", &app); err != nil {
+		t.Fatalf("AddConfig of sniffed YAML: %v", err)
+	}
+	if err := cm.LoadConfig("app"); err != nil || app.Port != 8080 {
+		t.Fatalf("LoadConfig = %v, port %v, want 8080", err, app.Port)
+	}
+
+	// Content that cannot be sniffed leaves the configuration without a reader.
+	var notes config
+	if err := cm.AddConfig("notes", dir, "", &notes); err != nil {
+		t.Fatalf("AddConfig of unrecognized content: %v", err)
+	}
+	if err := cm.LoadConfig("notes"); err == nil || !strings.Contains(err.Error(), "reader") {
+		t.Fatalf("LoadConfig of unrecognized content = %v, want an error about the missing reader", err)
+	}
+}
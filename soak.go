@@ -0,0 +1,262 @@
+package mkconf
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SoakPattern selects how the churn generator of a soak test writes the configuration file.
+type SoakPattern int
+
+const (
+	SoakInPlace SoakPattern = iota // Rewrite the file in place, so checks may read it half-written
+	SoakAtomic                     // Write a temporary file and rename it over the file, like editors and deploy tools
+	SoakBurst                      // Write bursts of changes back to back, atomically, pausing between bursts
+	SoakMixed                      // Alternate in-place and atomic writes
+)
+
+// String returns the name of the pattern.
+func (p SoakPattern) String() string {
+	switch p {
+	case SoakInPlace:
+		return "in-place"
+	case SoakAtomic:
+		return "atomic"
+	case SoakBurst:
+		return "burst"
+	case SoakMixed:
+		return "mixed"
+	}
+	return fmt.Sprintf("SoakPattern(%d)", int(p))
+}
+
+// MarshalText encodes the pattern by its name.
+func (p SoakPattern) MarshalText() ([]byte, error) {
+	return []byte(p.String()), nil
+}
+
+// UnmarshalText decodes a pattern encoded by MarshalText, e.g. given on the command line.
+func (p *SoakPattern) UnmarshalText(text []byte) error {
+	for _, pattern := range []SoakPattern{SoakInPlace, SoakAtomic, SoakBurst, SoakMixed} {
+		if string(text) == pattern.String() {
+			*p = pattern
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown soak pattern %q", text)
+}
+
+// SoakOptions configures a soak test, see RunSoakTest. Zero fields take their defaults.
+type SoakOptions struct {
+	Rate       float64       // Changes written per second; 10 if zero
+	Duration   time.Duration // Time changes are written for; 10 seconds if zero
+	Pattern    SoakPattern   // How the file is written
+	Burst      int           // Changes per burst with SoakBurst; 10 if zero
+	Size       int           // Approximate size of the file in bytes; 1 KiB if zero
+	CheckSec   int           // Interval in seconds of the change checks; 1 if zero
+	FileNotify bool          // Flag to wait for file system notifications instead of polling, see SetFileNotify
+	Settle     time.Duration // Time to wait for the last change to be detected once writing stopped; 5 seconds if zero
+	Dir        string        // Directory the temporary configuration is created in; the system temporary directory if empty
+}
+
+// SoakReport is the result of a soak test. Latencies are measured from the write of a change to the change
+// callback seeing its values; they are zero if no change was detected.
+type SoakReport struct {
+	Written     int           // Changes written to the file
+	Detected    int           // Changes whose values reached the change callback
+	Dropped     int           // Changes that never reached the callback, e.g. superseded by a later change before a check
+	LastSeen    bool          // Flag indicating the last change was detected before Settle elapsed
+	MinLatency  time.Duration // Shortest detection latency
+	MeanLatency time.Duration // Mean detection latency
+	P50Latency  time.Duration // Median detection latency
+	P95Latency  time.Duration // 95th percentile of the detection latency
+	P99Latency  time.Duration // 99th percentile of the detection latency
+	MaxLatency  time.Duration // Longest detection latency
+}
+
+// String formats the report for humans, one value per line.
+func (r SoakReport) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "written:   %d\n", r.Written)
+	fmt.Fprintf(&b, "detected:  %d\n", r.Detected)
+	fmt.Fprintf(&b, "dropped:   %d\n", r.Dropped)
+	fmt.Fprintf(&b, "last seen: %v\n", r.LastSeen)
+	fmt.Fprintf(&b, "latency:   min %v, mean %v, p50 %v, p95 %v, p99 %v, max %v\n",
+		r.MinLatency, r.MeanLatency, r.P50Latency, r.P95Latency, r.P99Latency, r.MaxLatency)
+	return b.String()
+}
+
+// soakConfig is the configuration written by the churn generator of a soak test.
+type soakConfig struct {
+	Seq     int    `json:"seq"`     // Sequence number of the change, starting at 1
+	Payload string `json:"payload"` // Filler bringing the file to the configured size
+}
+
+// RunSoakTest benchmarks the change detection of mkconf on the current machine before a production rollout. It
+// creates a temporary JSON configuration, monitors it like a service would, with a change callback through
+// Watch, and mutates it at options.Rate for options.Duration following options.Pattern. Every change
+// carries a sequence number, so the report gives the end-to-end latency from write to callback and the number of
+// changes that were dropped, i.e. overwritten before a check saw them. The temporary files are removed afterwards.
+func RunSoakTest(options SoakOptions) (SoakReport, error) {
+	if options.Rate <= 0 {
+		options.Rate = 10
+	}
+	if options.Duration <= 0 {
+		options.Duration = 10 * time.Second
+	}
+	if options.Burst <= 0 {
+		options.Burst = 10
+	}
+	if options.Size <= 0 {
+		options.Size = 1024
+	}
+	if options.CheckSec <= 0 {
+		options.CheckSec = 1
+	}
+	if options.Settle <= 0 {
+		options.Settle = 5 * time.Second
+	}
+
+	dir, err := ioutil.TempDir(options.Dir, "mkconf-soak")
+	if err != nil {
+		return SoakReport{}, fmt.Errorf("soak: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "soak.json")
+	payload := strings.Repeat("x", options.Size)
+	if err := writeSoakFile(path, soakConfig{Payload: payload}, false); err != nil {
+		return SoakReport{}, err
+	}
+
+	var (
+		mu       sync.Mutex
+		written  []time.Time // Write times by sequence number - 1
+		detected = make(map[int]time.Duration)
+		last     = make(chan struct{})
+		total    int
+	)
+	cm := NewConfigManager()
+	cm.SetFileNotify(options.FileNotify)
+	config := &soakConfig{}
+	if err := cm.AddConfig("soak", dir, ".json", config); err != nil {
+		return SoakReport{}, fmt.Errorf("soak: %v", err)
+	}
+	cm.GetSettings("soak").SetCheckSec(options.CheckSec)
+	if err := cm.LoadConfig("soak"); err != nil {
+		return SoakReport{}, fmt.Errorf("soak: %v", err)
+	}
+	cm.ChangeCallbackFunc("soak", func(configName string) {
+		seq, err := cm.Get(configName, "seq")
+		if err != nil {
+			return
+		}
+		n, _ := seq.(int)
+		now := time.Now()
+		mu.Lock()
+		defer mu.Unlock()
+		if n < 1 || n > len(written) {
+			return
+		}
+		if _, ok := detected[n]; !ok {
+			detected[n] = now.Sub(written[n-1])
+			if n == total {
+				close(last)
+			}
+		}
+	})
+	if err := cm.StartChangeMonitoring("soak", config); err != nil {
+		return SoakReport{}, fmt.Errorf("soak: %v", err)
+	}
+	watcher, err := cm.Watch()
+	if err != nil {
+		cm.RemoveConfig("soak")
+		return SoakReport{}, fmt.Errorf("soak: %v", err)
+	}
+
+	interval := time.Duration(float64(time.Second) / options.Rate)
+	deadline := time.Now().Add(options.Duration)
+	for seq := 1; time.Now().Before(deadline); seq++ {
+		atomic := options.Pattern != SoakInPlace && !(options.Pattern == SoakMixed && seq%2 == 0)
+		mu.Lock()
+		written = append(written, time.Now())
+		mu.Unlock()
+		if err := writeSoakFile(path, soakConfig{Seq: seq, Payload: payload}, atomic); err != nil {
+			cm.RemoveConfig("soak")
+			return SoakReport{}, err
+		}
+
+		wait := interval
+		if options.Pattern == SoakBurst {
+			// Bursts keep the average rate: the changes of a burst are written back to back, then the generator
+			// pauses for the time they would have taken.
+			wait = 0
+			if seq%options.Burst == 0 {
+				wait = interval * time.Duration(options.Burst)
+			}
+		}
+		time.Sleep(wait)
+	}
+
+	mu.Lock()
+	total = len(written)
+	if _, ok := detected[total]; ok || total == 0 {
+		close(last)
+	}
+	mu.Unlock()
+	timer := time.NewTimer(options.Settle)
+	select {
+	case <-last:
+	case <-timer.C:
+	}
+	timer.Stop()
+	cm.RemoveConfig("soak")
+	<-watcher.Done()
+
+	mu.Lock()
+	defer mu.Unlock()
+	report := SoakReport{Written: total, Detected: len(detected), Dropped: total - len(detected)}
+	_, report.LastSeen = detected[total]
+	latencies := make([]time.Duration, 0, len(detected))
+	var sum time.Duration
+	for _, latency := range detected {
+		latencies = append(latencies, latency)
+		sum += latency
+	}
+	if len(latencies) > 0 {
+		sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+		percentile := func(p int) time.Duration { return latencies[(len(latencies)-1)*p/100] }
+		report.MinLatency, report.MaxLatency = latencies[0], latencies[len(latencies)-1]
+		report.MeanLatency = sum / time.Duration(len(latencies))
+		report.P50Latency, report.P95Latency, report.P99Latency = percentile(50), percentile(95), percentile(99)
+	}
+	return report, nil
+}
+
+// writeSoakFile writes the configuration of a soak test, in place or atomically through a temporary file.
+func writeSoakFile(path string, config soakConfig, atomic bool) error {
+	content, err := json.Marshal(config)
+	if err != nil {
+		return fmt.Errorf("soak: %v", err)
+	}
+	if !atomic {
+		if err := ioutil.WriteFile(path, content, 0644); err != nil {
+			return fmt.Errorf("soak: %v", err)
+		}
+		return nil
+	}
+	temp := path + ".tmp"
+	if err := ioutil.WriteFile(temp, content, 0644); err != nil {
+		return fmt.Errorf("soak: %v", err)
+	}
+	if err := os.Rename(temp, path); err != nil {
+		return fmt.Errorf("soak: %v", err)
+	}
+	return nil
+}
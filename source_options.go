@@ -0,0 +1,224 @@
+package mkconf
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+)
+
+// SourceOptions holds the transport and authentication settings shared by all remote sources, for config backends
+// behind mTLS, proxies and rotating tokens. Every remote source accepts it in the Source field of its options (or
+// with AddRemoteConfigWithOptions for Consul). TLS settings are applied on top of the source's own TLS configuration
+// or HTTP client, and the token provider replaces the static token of the source, unless the source has a TokenFunc
+// of its own. SQL sources use the TLS settings of their database/sql driver. The zero value changes nothing.
+type SourceOptions struct {
+	CAFile     string                                    // PEM bundle of CA certificates trusted for the server instead of the system roots, if set
+	CertFile   string                                    // PEM client certificate for mutual TLS, if set; re-read when the file changes, so it can be rotated
+	KeyFile    string                                    // PEM private key of the client certificate
+	ServerName string                                    // Name verified in the server certificate; the host name of the address if empty
+	TokenFunc  func(ctx context.Context) (string, error) // Function returning a current token, called for every request or connection; takes precedence over static tokens
+	ProxyURL   string                                    // Proxy the source connects through, e.g. "http://proxy:3128"; HTTP_PROXY, HTTPS_PROXY and NO_PROXY for HTTP-based sources if empty
+}
+
+// hasTLS reports whether the options hold TLS settings.
+func (o SourceOptions) hasTLS() bool {
+	return o.CAFile != "" || o.CertFile != "" || o.ServerName != ""
+}
+
+// token returns the token of the token provider, or static if there is none.
+func (o SourceOptions) token(ctx context.Context, static string) (string, error) {
+	if o.TokenFunc == nil {
+		return static, nil
+	}
+	token, err := o.TokenFunc(ctx)
+	if err != nil {
+		return "", fmt.Errorf("token: %v", err)
+	}
+	return token, nil
+}
+
+// tlsConfig returns base, or a new configuration if it is nil, with the TLS settings of the options applied.
+// It returns base unchanged if the options hold no TLS settings.
+func (o SourceOptions) tlsConfig(base *tls.Config) (*tls.Config, error) {
+	if !o.hasTLS() {
+		return base, nil
+	}
+	config := &tls.Config{}
+	if base != nil {
+		config = base.Clone()
+	}
+	if o.CAFile != "" {
+		ca, err := ioutil.ReadFile(o.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("CA bundle: %v", err)
+		}
+		roots := x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("CA bundle: no certificates in %v", o.CAFile)
+		}
+		config.RootCAs = roots
+	}
+	if o.CertFile != "" {
+		certificate := &clientCertificate{certFile: o.CertFile, keyFile: o.KeyFile}
+		if _, err := certificate.get(nil); err != nil {
+			return nil, err
+		}
+		config.Certificates = nil
+		config.GetClientCertificate = certificate.get
+	}
+	if o.ServerName != "" {
+		config.ServerName = o.ServerName
+	}
+	return config, nil
+}
+
+// httpClient returns base, or http.DefaultClient if it is nil, with the TLS and proxy settings of the options
+// applied to a copy of its transport. Tokens are applied by the sources, as each sends them in its own header.
+func (o SourceOptions) httpClient(base *http.Client) (*http.Client, error) {
+	if base == nil {
+		base = http.DefaultClient
+	}
+	if !o.hasTLS() && o.ProxyURL == "" {
+		return base, nil
+	}
+
+	var transport *http.Transport
+	switch t := base.Transport.(type) {
+	case nil:
+		transport = http.DefaultTransport.(*http.Transport).Clone()
+	case *http.Transport:
+		transport = t.Clone()
+	default:
+		return nil, fmt.Errorf("source options: TLS and proxy settings need an *http.Transport, the client has %T", base.Transport)
+	}
+	config, err := o.tlsConfig(transport.TLSClientConfig)
+	if err != nil {
+		return nil, err
+	}
+	transport.TLSClientConfig = config
+	if o.ProxyURL != "" {
+		proxy, err := url.Parse(o.ProxyURL)
+		if err != nil {
+			return nil, fmt.Errorf("proxy: %v", err)
+		}
+		transport.Proxy = http.ProxyURL(proxy)
+	}
+
+	client := *base
+	client.Transport = transport
+	return &client, nil
+}
+
+// dial connects to the TCP address addr, through the proxy of the options if one is set. HTTP proxies are
+// asked to tunnel the connection with CONNECT.
+func (o SourceOptions) dial(ctx context.Context, dialer *net.Dialer, addr string) (net.Conn, error) {
+	if o.ProxyURL == "" {
+		return dialer.DialContext(ctx, "tcp", addr)
+	}
+	proxy, err := url.Parse(o.ProxyURL)
+	if err != nil {
+		return nil, fmt.Errorf("proxy: %v", err)
+	}
+	if proxy.Scheme != "http" {
+		return nil, fmt.Errorf("proxy %v: unsupported scheme %q", proxy.Redacted(), proxy.Scheme)
+	}
+	proxyAddr := proxy.Host
+	if proxy.Port() == "" {
+		proxyAddr = net.JoinHostPort(proxy.Hostname(), "80")
+	}
+	conn, err := dialer.DialContext(ctx, "tcp", proxyAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(dialer.Timeout)
+	if d, ok := ctx.Deadline(); ok && (dialer.Timeout == 0 || d.Before(deadline)) {
+		deadline = d
+	}
+	if !deadline.IsZero() && deadline.After(time.Now()) {
+		conn.SetDeadline(deadline)
+	}
+	req := &http.Request{Method: http.MethodConnect, URL: &url.URL{Opaque: addr}, Host: addr, Header: make(http.Header)}
+	if proxy.User != nil {
+		password, _ := proxy.User.Password()
+		credentials := base64.StdEncoding.EncodeToString([]byte(proxy.User.Username() + ":" + password))
+		req.Header.Set("Proxy-Authorization", "Basic "+credentials)
+	}
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("proxy %v: %v", proxy.Redacted(), err)
+	}
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("proxy %v: %v", proxy.Redacted(), err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		conn.Close()
+		return nil, fmt.Errorf("proxy %v: CONNECT %v: %v", proxy.Redacted(), addr, resp.Status)
+	}
+	conn.SetDeadline(time.Time{})
+	if br.Buffered() > 0 {
+		// The server spoke first and its greeting was read along with the response of the proxy.
+		return &bufferedConn{Conn: conn, reader: br}, nil
+	}
+	return conn, nil
+}
+
+// bufferedConn is a connection whose first bytes were already read into a buffer.
+type bufferedConn struct {
+	net.Conn
+	reader *bufio.Reader // Reader holding the bytes read ahead
+}
+
+// Read implements net.Conn.
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	return c.reader.Read(p)
+}
+
+// clientCertificate is a client certificate read from files, re-read when either file is modified.
+type clientCertificate struct {
+	certFile    string           // File of the certificate
+	keyFile     string           // File of the private key
+	certificate *tls.Certificate // Certificate last read
+	modified    time.Time        // Latest modification time of the files when they were last read
+	mu          sync.Mutex       // Mutex for synchronizing access to the certificate
+}
+
+// get returns the current certificate; it implements tls.Config.GetClientCertificate.
+func (c *clientCertificate) get(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var modified time.Time
+	for _, file := range []string{c.certFile, c.keyFile} {
+		if info, err := os.Stat(file); err == nil && info.ModTime().After(modified) {
+			modified = info.ModTime()
+		}
+	}
+	if c.certificate != nil && !modified.After(c.modified) {
+		return c.certificate, nil
+	}
+	certificate, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		if c.certificate != nil {
+			// Keep the previous certificate while the files are being replaced.
+			return c.certificate, nil
+		}
+		return nil, fmt.Errorf("client certificate: %v", err)
+	}
+	c.certificate, c.modified = &certificate, modified
+	return c.certificate, nil
+}
@@ -0,0 +1,297 @@
+package mkconf
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io/fs"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SQLStoreOptions configures an SQL config store source.
+type SQLStoreOptions struct {
+	Table        string                                                                       // Table holding the configurations; "mkconf_configs" if empty
+	Placeholders string                                                                       // Placeholder style of the driver: "?" (MySQL, SQLite) or "$" ($1, PostgreSQL); "?" if empty
+	Interval     time.Duration                                                                // Polling interval while the source is watched; 10 seconds if zero
+	Channel      string                                                                       // PostgreSQL channel notified with the configuration name on updates, if set
+	Listen       func(ctx context.Context, channel string, notify func(payload string)) error // Function listening on the channel with the driver (e.g. pq.Listener), if set
+	ReadOnly     bool                                                                         // Flag rejecting UpdateConfig instead of writing the row
+}
+
+// SQLConfigSource is a configuration stored as a row of a database table with the columns name, format (e.g.
+// "yaml"), payload and version (an integer). It works with any database/sql driver; the table can be created
+// with, for example:
+//
+//	CREATE TABLE mkconf_configs (name VARCHAR(255) PRIMARY KEY, format VARCHAR(16) NOT NULL,
+//		payload TEXT NOT NULL, version BIGINT NOT NULL DEFAULT 1)
+//
+// Updates are optimistic: the row is only written if its version is still the one that was read, and the version
+// is incremented. While watched, the version is polled, and on PostgreSQL a LISTEN on options.Channel triggers an
+// immediate check.
+type SQLConfigSource struct {
+	db         *sql.DB            // Database holding the table
+	configName string             // Name of the registered configuration and of its row
+	options    SQLStoreOptions    // Source options
+	manager    *ConfigManager     // Manager the configuration is registered with
+	content    []byte             // Last payload read from the row
+	version    int64              // Version of the row the content was read at
+	loaded     bool               // Flag indicating content holds a value
+	notify     chan struct{}      // Channel waking the polling up for an immediate check
+	mu         sync.Mutex         // Mutex for synchronizing access to the content
+	cancel     context.CancelFunc // Function canceling the running polling
+	waitGroup  sync.WaitGroup     // WaitGroup to wait for the polling goroutines
+}
+
+// AddSQLConfig registers the configuration stored in the row named configName. The reader is selected by the
+// format column of the row, which must exist. Unless options.ReadOnly is set, UpdateConfig writes the row back,
+// failing with ErrVersionConflict (wrapped) if another writer updated it first. Call StartWatching on the returned
+// source to apply changes made by other instances.
+func (cm *ConfigManager) AddSQLConfig(configName string, db *sql.DB, configInterface interface{}, options SQLStoreOptions) (*SQLConfigSource, error) {
+	if options.Table == "" {
+		options.Table = "mkconf_configs"
+	}
+	if options.Placeholders == "" {
+		options.Placeholders = "?"
+	}
+	if options.Placeholders != "?" && options.Placeholders != "$" {
+		return nil, fmt.Errorf("sql config %v: unsupported placeholders %q", configName, options.Placeholders)
+	}
+	if options.Interval <= 0 {
+		options.Interval = 10 * time.Second
+	}
+
+	s := &SQLConfigSource{db: db, configName: configName, options: options, manager: cm, notify: make(chan struct{}, 1)}
+	var format string
+	row := db.QueryRow(s.query("SELECT format FROM %v WHERE name = %v", 1), configName)
+	if err := row.Scan(&format); err != nil {
+		return nil, fmt.Errorf("sql config %v: %v", configName, err)
+	}
+	format = strings.ToLower(strings.TrimSpace(format))
+	if !strings.HasPrefix(format, ".") {
+		format = "." + format
+	}
+
+	if err := cm.AddConfigFS(s, configName, "", format, configInterface); err != nil {
+		return nil, err
+	}
+	cm.addRemoteSource(configName, s)
+	return s, nil
+}
+
+// Version returns the version of the row the configuration was last read or written at.
+func (s *SQLConfigSource) Version() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.version
+}
+
+// Open implements fs.FS. Every name resolves to the payload of the row; it is read if it was not yet.
+func (s *SQLConfigSource) Open(name string) (fs.File, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.loaded {
+		if _, err := s.fetchLocked(context.Background()); err != nil {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+		}
+	}
+	return newRemoteFile(name, s.content), nil
+}
+
+// WriteFile implements reader.WriteFileFS by updating the payload of the row if its version is unchanged.
+// If the channel is set, the other instances are notified in the same transaction.
+func (s *SQLConfigSource) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	if s.options.ReadOnly {
+		return fmt.Errorf("sql config %v: %w", s.configName, ErrReadOnlySource)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("sql config %v: %v", s.configName, err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(s.query("UPDATE %v SET payload = %v, version = version + 1 WHERE name = %v AND version = %v", 3),
+		string(data), s.configName, s.version)
+	if err != nil {
+		return fmt.Errorf("sql config %v: %v", s.configName, err)
+	}
+	if rows, err := result.RowsAffected(); err != nil {
+		return fmt.Errorf("sql config %v: %v", s.configName, err)
+	} else if rows == 0 {
+		return fmt.Errorf("sql config %v: row was changed since version %d: %w", s.configName, s.version, ErrVersionConflict)
+	}
+	if s.options.Channel != "" {
+		if _, err := tx.Exec("SELECT pg_notify($1, $2)", s.options.Channel, s.configName); err != nil {
+			return fmt.Errorf("sql config %v: notify %v: %v", s.configName, s.options.Channel, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("sql config %v: %v", s.configName, err)
+	}
+
+	s.content = append([]byte(nil), data...)
+	s.version++
+	s.loaded = true
+	return nil
+}
+
+// Refresh re-reads the row and loads the configuration from its current payload.
+// It is not needed while the source is watched.
+func (s *SQLConfigSource) Refresh() error {
+	s.mu.Lock()
+	_, err := s.fetchLocked(context.Background())
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return s.manager.LoadConfig(s.configName)
+}
+
+// StartWatching polls the version of the row every interval and applies changed payloads. If options.Listen is
+// set, it listens on options.Channel as well and checks the row as soon as a notification naming the
+// configuration arrives; a failed listener is restarted. Errors are reported through errorFunc if it is set.
+func (s *SQLConfigSource) StartWatching(errorFunc func(err error)) error {
+	s.StopWatching()
+	errorFunc = quietCircuitErrors(errorFunc)
+	if err := s.manager.setRemoteWatching(s.configName, true); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.mu.Lock()
+	s.cancel = cancel
+	s.mu.Unlock()
+
+	if s.options.Listen != nil && s.options.Channel != "" {
+		s.waitGroup.Add(1)
+		go func() {
+			defer s.waitGroup.Done()
+			for {
+				err := s.options.Listen(ctx, s.options.Channel, func(payload string) {
+					if payload == "" || payload == s.configName {
+						s.Notify()
+					}
+				})
+				if ctx.Err() != nil {
+					return
+				}
+				if err != nil && errorFunc != nil {
+					errorFunc(fmt.Errorf("sql config %v: listen %v: %v", s.configName, s.options.Channel, err))
+				}
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(time.Second):
+				}
+				// Notifications sent while not listening are lost.
+				s.Notify()
+			}
+		}()
+	}
+
+	s.waitGroup.Add(1)
+	s.manager.configList.resources.acquire(s.configName, resourceRemoteWatch)
+	go func() {
+		defer s.waitGroup.Done()
+		defer s.manager.configList.resources.release(s.configName, resourceRemoteWatch)
+		ticker := time.NewTicker(s.options.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			case <-s.notify:
+			}
+
+			s.mu.Lock()
+			changed, err := s.fetchLocked(ctx)
+			s.mu.Unlock()
+			if err == nil && changed {
+				err = s.manager.applyRemoteChange(s.configName)
+			}
+			if err != nil && ctx.Err() == nil && errorFunc != nil {
+				errorFunc(err)
+			}
+		}
+	}()
+	return nil
+}
+
+// Notify makes the watching source check the row immediately instead of waiting for the next poll.
+func (s *SQLConfigSource) Notify() {
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+}
+
+// StopWatching stops polling and listening and waits for them to finish.
+func (s *SQLConfigSource) StopWatching() {
+	s.mu.Lock()
+	cancel := s.cancel
+	s.cancel = nil
+	s.mu.Unlock()
+
+	if cancel == nil {
+		return
+	}
+	cancel()
+	s.waitGroup.Wait()
+	s.manager.setRemoteWatching(s.configName, false)
+}
+
+// fetchLocked calls fetchOnceLocked according to the retry policy and circuit breaker of the configuration.
+// The caller must hold s.mu.
+func (s *SQLConfigSource) fetchLocked(ctx context.Context) (bool, error) {
+	var changed bool
+	err := s.manager.retryFetch(ctx, s.configName, func() error {
+		var err error
+		changed, err = s.fetchOnceLocked(ctx)
+		return err
+	})
+	return changed, err
+}
+
+// fetchOnceLocked reads the version of the row, then its payload if the version changed, and reports whether the
+// configuration changed. The caller must hold s.mu.
+func (s *SQLConfigSource) fetchOnceLocked(ctx context.Context) (bool, error) {
+	var version int64
+	row := s.db.QueryRowContext(ctx, s.query("SELECT version FROM %v WHERE name = %v", 1), s.configName)
+	if err := row.Scan(&version); err != nil {
+		return false, fmt.Errorf("sql config %v: %v", s.configName, err)
+	}
+	if s.loaded && version == s.version {
+		s.manager.sourceReached(s.configName)
+		return false, nil
+	}
+
+	var payload []byte
+	row = s.db.QueryRowContext(ctx, s.query("SELECT payload, version FROM %v WHERE name = %v", 1), s.configName)
+	if err := row.Scan(&payload, &version); err != nil {
+		return false, fmt.Errorf("sql config %v: %v", s.configName, err)
+	}
+	changed := !s.loaded || string(payload) != string(s.content)
+	s.content, s.version, s.loaded = payload, version, true
+	s.manager.sourceReached(s.configName)
+	return changed, nil
+}
+
+// query formats a statement on the table with count placeholders in the style of the driver.
+func (s *SQLConfigSource) query(format string, count int) string {
+	args := []interface{}{s.options.Table}
+	for i := 1; i <= count; i++ {
+		if s.options.Placeholders == "$" {
+			args = append(args, "$"+strconv.Itoa(i))
+		} else {
+			args = append(args, "?")
+		}
+	}
+	return fmt.Sprintf(format, args...)
+}
@@ -0,0 +1,128 @@
+package mkconf
+
+import (
+	"fmt"
+	"time"
+)
+
+// Staleness describes how outdated the values of a configuration may be.
+type Staleness struct {
+	SinceReachable time.Duration // Time since the source was last read successfully
+	SinceApplied   time.Duration // Time since the values last changed by applying content of the source
+	Stale          bool          // Flag indicating SinceReachable exceeds the threshold set with SetStaleCallback
+}
+
+// StaleCallbackFunc is a function type used for staleness callbacks. stale is true when the configuration
+// became stale and false when its source was reached again.
+type StaleCallbackFunc func(configName string, stale bool, staleness Staleness)
+
+// Staleness returns how outdated the values of the specified configuration may be. If the source was never
+// reached, the times are counted from the last-known-good snapshot the values come from, or from the time the
+// configuration was added.
+func (cm *ConfigManager) Staleness(configName string) (Staleness, error) {
+	settings, ok := cm.configList.getSettings(configName)
+	if !ok {
+		return Staleness{}, fmt.Errorf("config not found: %s", configName)
+	}
+	settings.mu.Lock()
+	threshold := settings.staleThreshold
+	settings.mu.Unlock()
+	return settings.staleness(threshold), nil
+}
+
+// SetStaleCallback calls callback once the source of the specified configuration was not reached for longer than
+// threshold, e.g. so the service can reduce functionality while running on outdated values, and again once the
+// source is reached. Sources are reached by change monitoring, LoadConfig and the watching of remote sources, so
+// threshold should be well above their intervals. The callback runs on its own goroutine, which ends when the
+// configuration is removed; a later call replaces the callback, and a nil callback removes it.
+func (cm *ConfigManager) SetStaleCallback(configName string, threshold time.Duration, callback StaleCallbackFunc) error {
+	settings, ok := cm.configList.getSettings(configName)
+	if !ok {
+		return fmt.Errorf("config not found: %s", configName)
+	}
+	if callback != nil && threshold <= 0 {
+		return fmt.Errorf("config %v: stale threshold must be positive", configName)
+	}
+
+	settings.mu.Lock()
+	defer settings.mu.Unlock()
+	if settings.staleStop != nil {
+		close(settings.staleStop)
+		settings.staleStop = nil
+	}
+	settings.staleThreshold = 0
+	if callback == nil {
+		return nil
+	}
+	settings.staleThreshold = threshold
+	stop := make(chan struct{})
+	settings.staleStop = stop
+
+	interval := threshold / 4
+	if interval > time.Second {
+		interval = time.Second
+	}
+	if interval < 10*time.Millisecond {
+		interval = 10 * time.Millisecond
+	}
+	cm.configList.resources.acquire(configName, resourceStaleWatch)
+	go func() {
+		defer cm.configList.resources.release(configName, resourceStaleWatch)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		stale := false
+		for {
+			select {
+			case <-stop:
+				return
+			case <-settings.ch_ChangeValidation:
+				return
+			case <-ticker.C:
+			}
+			if staleness := settings.staleness(threshold); staleness.Stale != stale {
+				stale = staleness.Stale
+				callback(configName, stale, staleness)
+			}
+		}
+	}()
+	return nil
+}
+
+// staleness returns the staleness of the configuration measured against threshold, which is ignored if zero.
+func (c *ConfigSettings) staleness(threshold time.Duration) Staleness {
+	now := time.Now().UnixNano()
+	staleness := Staleness{
+		SinceReachable: time.Duration(now - c.lastReached.Load()),
+		SinceApplied:   time.Duration(now - c.lastApplied.Load()),
+	}
+	staleness.Stale = threshold > 0 && staleness.SinceReachable > threshold
+	return staleness
+}
+
+// markReached records that the source of the configuration was read successfully, and that its content
+// was applied if applied is true. It takes no locks, so sources may call it while the configuration is loaded.
+func (c *ConfigSettings) markReached(applied bool) {
+	now := time.Now().UnixNano()
+	c.lastReached.Store(now)
+	if applied {
+		c.lastApplied.Store(now)
+	}
+}
+
+// markRead records that the configuration was read from its source, and applied if applied is true. Remote
+// sources serve the value they fetched last, so for them only the applied time is recorded; they call
+// sourceReached themselves when they reach the remote.
+func (c *ConfigSettings) markRead(applied bool) {
+	if _, remote := c.fsys.(remoteSource); !remote {
+		c.markReached(applied)
+	} else if applied {
+		c.lastApplied.Store(time.Now().UnixNano())
+	}
+}
+
+// sourceReached records that a remote source read the value of a configuration successfully.
+func (cm *ConfigManager) sourceReached(configName string) {
+	if settings, ok := cm.configList.getSettings(configName); ok {
+		settings.markReached(false)
+	}
+}
@@ -0,0 +1,232 @@
+package mkconf
+
+import (
+	"fmt"
+	"time"
+)
+
+// StartupFallback selects what happens when a configuration source is still unavailable after the startup timeout.
+type StartupFallback int
+
+const (
+	StartupLastKnownGood StartupFallback = iota // Use the last-known-good snapshot if a state directory is set, otherwise fail
+	StartupFail                                 // Fail adding the configuration
+	StartupUseDefaults                          // Keep the values already present in the configuration struct
+)
+
+// String returns the name of the fallback.
+func (f StartupFallback) String() string {
+	switch f {
+	case StartupLastKnownGood:
+		return "last-known-good"
+	case StartupFail:
+		return "fail"
+	case StartupUseDefaults:
+		return "defaults"
+	}
+	return fmt.Sprintf("StartupFallback(%d)", int(f))
+}
+
+// MarshalText encodes the fallback by its name, e.g. for JSON status output.
+func (f StartupFallback) MarshalText() ([]byte, error) {
+	return []byte(f.String()), nil
+}
+
+// UnmarshalText decodes a fallback encoded by MarshalText, e.g. in the status of an attached manager.
+func (f *StartupFallback) UnmarshalText(text []byte) error {
+	for _, fallback := range []StartupFallback{StartupLastKnownGood, StartupFail, StartupUseDefaults} {
+		if string(text) == fallback.String() {
+			*f = fallback
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown startup fallback %q", text)
+}
+
+// StartupPolicy configures how a configuration behaves when its source is unavailable at startup.
+type StartupPolicy struct {
+	Timeout  time.Duration   // Time to wait for the source to become available
+	Fallback StartupFallback // Behavior when the source is still unavailable after Timeout
+}
+
+// ConfigState describes where the current values of a configuration come from.
+type ConfigState int
+
+const (
+	ConfigLoaded        ConfigState = iota // Values come from the configuration source
+	ConfigDefaults                         // Source was unavailable at startup; values are the struct's defaults
+	ConfigLastKnownGood                    // Source is unavailable or broken; values come from the last-known-good snapshot
+	ConfigFailed                           // File was deleted, renamed or truncated and its FileEventPolicy is FileFail
+)
+
+// String returns the name of the state.
+func (s ConfigState) String() string {
+	switch s {
+	case ConfigLoaded:
+		return "loaded"
+	case ConfigDefaults:
+		return "defaults"
+	case ConfigLastKnownGood:
+		return "last-known-good"
+	case ConfigFailed:
+		return "failed"
+	}
+	return fmt.Sprintf("ConfigState(%d)", int(s))
+}
+
+// MarshalText encodes the state by its name, e.g. for JSON status output.
+func (s ConfigState) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// UnmarshalText decodes a state encoded by MarshalText, e.g. in the status of an attached manager.
+func (s *ConfigState) UnmarshalText(text []byte) error {
+	for _, state := range []ConfigState{ConfigLoaded, ConfigDefaults, ConfigLastKnownGood, ConfigFailed} {
+		if string(text) == state.String() {
+			*s = state
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown config state %q", text)
+}
+
+// ConfigStatus reports the state of a configuration.
+type ConfigStatus struct {
+	Name   string        // Name of the configuration
+	State  ConfigState   // Where the current values come from
+	Policy StartupPolicy // Startup policy the configuration was added with
+	Error  string        // Why the source is not used, if State is not ConfigLoaded
+
+	Monitoring      MonitorState  // State of the change monitoring
+	PendingApproval bool          // Flag indicating a detected change is waiting for approval
+	Anomaly         string        // Why the change waiting for approval is suspicious, if it was held by SetAnomalyGuard
+	SnapshotHash    string        // Semantic hash of the applied values, see ConfigManager.SnapshotHash
+	Source          string        // Source that served the configuration, for failover configurations
+	Stale           bool          // Flag indicating the values come from a cached payload older than its TTL, see SetRemoteCache
+	CacheAge        time.Duration // Age of the cached payload or snapshot the values come from; zero if they come from the source
+	Staleness       Staleness     // How outdated the values may be, see ConfigManager.Staleness
+	CircuitOpen     bool          // Flag indicating fetches of the remote source fail fast, see RetryPolicy
+	FileEvent       string        // File event the configuration is affected by, e.g. FileDeleted; empty if the file is fine
+
+	DroppedDeliveries uint64 // Change notifications dropped or merged by the delivery policy, see SetDelivery
+}
+
+// startupPollInterval is the interval at which an unavailable source is retried during the startup timeout.
+const startupPollInterval = 100 * time.Millisecond
+
+// SetStartupPolicy sets the startup policy of the specified configuration. It must be called before the configuration
+// is added; AddConfig then waits up to policy.Timeout for the source and applies policy.Fallback if it is still unavailable.
+// A fallback to the last-known-good snapshot or to default values is reported as an error wrapping ErrDegraded to the
+// function set with SetErrorFunc.
+func (cm *ConfigManager) SetStartupPolicy(configName string, policy StartupPolicy) {
+	cm.configList.settingsMutex.Lock()
+	defer cm.configList.settingsMutex.Unlock()
+	if cm.configList.startupPolicies == nil {
+		cm.configList.startupPolicies = make(map[string]StartupPolicy)
+	}
+	cm.configList.startupPolicies[configName] = policy
+}
+
+// SetDefaultStartupPolicy sets the startup policy of configurations without a policy of their own.
+func (cm *ConfigManager) SetDefaultStartupPolicy(policy StartupPolicy) {
+	cm.configList.settingsMutex.Lock()
+	defer cm.configList.settingsMutex.Unlock()
+	cm.configList.defaultStartupPolicy = policy
+}
+
+// Status returns the status of all configurations keyed by name.
+func (cm *ConfigManager) Status() map[string]ConfigStatus {
+	status := make(map[string]ConfigStatus)
+	for name, settings := range cm.configList.settingsSnapshot() {
+		var source string
+		if failover, ok := settings.fsys.(*FailoverConfig); ok {
+			source = failover.ServedBy()
+		}
+		settings.mu.Lock()
+		status[name] = ConfigStatus{
+			Name:   name,
+			State:  settings.state,
+			Policy: settings.startupPolicy,
+			Error:  settings.stateError,
+
+			Monitoring:      settings.monitorState,
+			PendingApproval: settings.pendingHash != "" && settings.pendingHash != settings.lastConfigHash,
+			Anomaly:         settings.heldAnomaly(),
+			Source:          source,
+			Stale:           settings.staleTTL > 0 && settings.cacheAge() > settings.staleTTL,
+			CacheAge:        settings.cacheAge(),
+			Staleness:       settings.staleness(settings.staleThreshold),
+			FileEvent:       settings.fileEvent,
+
+			DroppedDeliveries: settings.droppedDeliveries.Load(),
+		}
+		settings.mu.Unlock()
+	}
+	for name, configStatus := range status {
+		configStatus.SnapshotHash, _ = cm.SnapshotHash(name)
+		configStatus.CircuitOpen = cm.CircuitOpen(name)
+		status[name] = configStatus
+	}
+	return status
+}
+
+// startupPolicyFor returns the startup policy of the specified configuration.
+// The caller must hold settingsMutex.
+func (c *ConfigList) startupPolicyFor(configName string) StartupPolicy {
+	if policy, ok := c.startupPolicies[configName]; ok {
+		return policy
+	}
+	return c.defaultStartupPolicy
+}
+
+// initialize reads the hash and map of a newly added configuration, waiting up to the startup timeout
+// for its source and applying the startup fallback if the source is still unavailable.
+func (c *ConfigSettings) initialize(v interface{}) error {
+	// Until the source is reached, staleness is counted from the time the configuration is added.
+	c.markReached(true)
+	err := c.defineHash(v)
+	deadline := time.Now().Add(c.startupPolicy.Timeout)
+	for err != nil && time.Now().Before(deadline) {
+		time.Sleep(startupPollInterval)
+		err = c.defineHash(v)
+	}
+	if err == nil {
+		c.markReached(true)
+		return nil
+	}
+
+	switch c.startupPolicy.Fallback {
+	case StartupLastKnownGood:
+		if c.startFromLastKnownGood(v) {
+			c.state, c.stateError = ConfigLastKnownGood, err.Error()
+			if !c.lastGoodTime.IsZero() {
+				// The snapshot was current when it was persisted.
+				c.lastReached.Store(c.lastGoodTime.UnixNano())
+				c.lastApplied.Store(c.lastGoodTime.UnixNano())
+			}
+			c.reportError(fmt.Errorf("%w: config %v is unavailable, running on its last-known-good snapshot %v: %v", ErrDegraded, c.configName, c.lastGoodPath, err))
+			return nil
+		}
+	case StartupUseDefaults:
+		c.config = &v
+		c.state, c.stateError = ConfigDefaults, err.Error()
+		c.reportError(fmt.Errorf("%w: config %v is unavailable, running on default values: %v", ErrDegraded, c.configName, err))
+		return nil
+	}
+	return err
+}
+
+// loadFallback handles a failed load of v with cause according to the startup policy.
+// The caller must hold settings.mu.
+func (c *ConfigSettings) loadFallback(v interface{}, cause error) error {
+	switch c.startupPolicy.Fallback {
+	case StartupLastKnownGood:
+		return c.loadLastKnownGood(v, cause)
+	case StartupUseDefaults:
+		if c.state == ConfigDefaults {
+			c.stateError = cause.Error()
+			return nil
+		}
+	}
+	return cause
+}
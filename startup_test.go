@@ -0,0 +1,24 @@
+package mkconf
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestStartupDefaultsReportedThroughErrorFunc(t *testing.T) {
+	var reported []error
+	config := &stressConfig{Version: 7}
+	cm := NewConfigManager()
+	cm.SetErrorFunc(func(err error) { reported = append(reported, err) })
+	cm.SetStartupPolicy("missing", StartupPolicy{Timeout: time.Millisecond, Fallback: StartupUseDefaults})
+	if err := cm.AddConfig("missing", t.TempDir(), ".json", config); err != nil {
+		t.Fatalf("AddConfig: %v", err)
+	}
+	if config.Version != 7 || !cm.IsDegraded("missing") {
+		t.Fatalf("version %v, degraded %v, want the default 7 and degraded", config.Version, cm.IsDegraded("missing"))
+	}
+	if len(reported) != 1 || !errors.Is(reported[0], ErrDegraded) {
+		t.Fatalf("reported %v, want one error wrapping ErrDegraded", reported)
+	}
+}
@@ -0,0 +1,140 @@
+package mkconf
+
+import (
+	"fmt"
+	"sort"
+)
+
+// SubscriptionID identifies a subscription made with Subscribe.
+type SubscriptionID uint64
+
+// subscription is a listener of the change events of a configuration.
+type subscription struct {
+	configName string          // Name of the configuration
+	key        string          // Dot-separated key path the listener watches, see SubscribeField; empty for all changes
+	callback   ChangeEventFunc // Function called with every change event
+}
+
+// Subscribe adds a listener receiving a ChangeEvent for every applied change of the specified configuration.
+// Any number of independent listeners can subscribe to a configuration; every event is passed to each of them, in
+// the order they subscribed, after the callback set with ChangeEventFunc. Events are dispatched by WatchForChanges
+// and CheckOnce, like change callbacks. Events and their snapshots are shared by the listeners and must not be
+// modified. Returns an error if the configuration is not found.
+func (cm *ConfigManager) Subscribe(configName string, callback ChangeEventFunc) (SubscriptionID, error) {
+	return cm.subscribe(configName, "", callback)
+}
+
+// SubscribeField is like Subscribe, but the listener only receives the events of changes of the value at a
+// dot-separated key path, e.g. "database.pool.size", so a component is not invoked by edits of values it does not
+// use. A change affects the value if it is at or below the key path, or above it and the value at the key path
+// differs, as computed for SetImpact. File events without a change of the value are not passed to the listener.
+func (cm *ConfigManager) SubscribeField(configName, key string, callback ChangeEventFunc) (SubscriptionID, error) {
+	if key == "" {
+		return 0, fmt.Errorf("subscribe to config %s: empty key path", configName)
+	}
+	return cm.subscribe(configName, key, callback)
+}
+
+// subscribe adds a listener of the changes of the configuration at the key path, or of all changes if key is empty.
+func (cm *ConfigManager) subscribe(configName, key string, callback ChangeEventFunc) (SubscriptionID, error) {
+	if callback == nil {
+		return 0, fmt.Errorf("subscribe to config %s: nil callback", configName)
+	}
+	cm.mu.Lock()
+	if _, ok := cm.configs[configName]; !ok {
+		cm.mu.Unlock()
+		return 0, fmt.Errorf("config not found: %s", configName)
+	}
+	if cm.subscriptions == nil {
+		cm.subscriptions = make(map[SubscriptionID]subscription)
+	}
+	cm.lastSubscription++
+	id := cm.lastSubscription
+	cm.subscriptions[id] = subscription{configName: configName, key: key, callback: callback}
+	cm.mu.Unlock()
+
+	cm.updateEvents(configName)
+	return id, nil
+}
+
+// Unsubscribe removes the listener of a subscription made with Subscribe or SubscribeField. Unknown or already removed
+// subscriptions are ignored. An event being dispatched may still reach the listener.
+func (cm *ConfigManager) Unsubscribe(id SubscriptionID) {
+	cm.mu.Lock()
+	sub, ok := cm.subscriptions[id]
+	delete(cm.subscriptions, id)
+	cm.mu.Unlock()
+
+	if ok {
+		cm.updateEvents(sub.configName)
+	}
+}
+
+// updateEvents enables change events for a configuration while it has an event callback or a subscription,
+// and disables them once it has none.
+func (cm *ConfigManager) updateEvents(configName string) {
+	cm.mu.RLock()
+	enabled := cm.eventCallbacks[configName] != nil
+	for _, sub := range cm.subscriptions {
+		enabled = enabled || sub.configName == configName
+	}
+	configInterface := cm.configs[configName]
+	cm.mu.RUnlock()
+
+	settings, ok := cm.configList.getSettings(configName)
+	if !ok {
+		return
+	}
+	settings.mu.Lock()
+	defer settings.mu.Unlock()
+	if settings.eventsEnabled != enabled {
+		settings.enableEvents(enabled, configInterface)
+	}
+}
+
+// eventListeners returns the event callback and the subscribed listeners of a configuration, in dispatch order.
+func (cm *ConfigManager) eventListeners(configName string) []subscription {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+	var listeners []subscription
+	if callback := cm.eventCallbacks[configName]; callback != nil {
+		listeners = append(listeners, subscription{configName: configName, callback: callback})
+	}
+	ids := make([]SubscriptionID, 0, len(cm.subscriptions))
+	for id, sub := range cm.subscriptions {
+		if sub.configName == configName {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	for _, id := range ids {
+		listeners = append(listeners, cm.subscriptions[id])
+	}
+	return listeners
+}
+
+// publishEvent passes the event to every listener of its configuration watching a changed value, according to the
+// callback mode of the configuration. A panicking listener is reported and does not keep the event from the others.
+func (cm *ConfigManager) publishEvent(event ChangeEvent) {
+	settings, ok := cm.configList.getSettings(event.ConfigName)
+	if !ok {
+		return
+	}
+	for _, listener := range cm.eventListeners(event.ConfigName) {
+		if listener.key == "" || eventAffects(event, listener.key) {
+			callback := listener.callback
+			call := CallbackCall{ConfigName: event.ConfigName, Kind: CallbackKindEvent, Event: &event}
+			cm.runCallback(settings, call, func() { callback(event) })
+		}
+	}
+}
+
+// eventAffects reports whether a change of the event affects the value at a dot-separated key path.
+func eventAffects(event ChangeEvent, key string) bool {
+	for _, change := range event.Changes {
+		if change.Event == "" && changeAffects(change, key) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,309 @@
+package mkconf
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	reader "mkconf/readers"
+)
+
+// treeNode is a line of a configuration tree.
+type treeNode struct {
+	path      []string // Keys from the root of the configuration to the value
+	value     string   // Rendered scalar value; empty for containers
+	valueType string   // Go type of the value
+	leaf      bool     // Flag indicating the node holds a scalar value
+	element   bool     // Flag indicating the node is an element of a list, shown as [index]
+}
+
+// DumpTree writes the effective configuration as an indented tree, one value per line with its Go type, e.g.
+//
+//	app (.yaml, loaded)
+//	  db (main.DB)
+//	    host: "db.local" (string)
+//	    port: 5432 (int) [default]
+//	    password: [REDACTED] (string) [secret]
+//
+// Provenance markers tell where a value comes from: [default] values are not set in the source, so the struct
+// keeps its default; [secret] values come from a secret source and are redacted; values of layered and env
+// configurations and values overridden by SetEnvOverrides or BindFlags name their origin, e.g. [from env
+// APP_DB__HOST], [from flag -db.host] or [from file defaults.yaml]; and values written by Set with an annotation show it, e.g. [set by alice at
+// 2024-05-01T10:00:00Z: raise limit]. The first line gives the config type and the state of the configuration
+// (see ConfigState).
+func (cm *ConfigManager) DumpTree(w io.Writer, configName string) error {
+	nodes, settings, err := cm.configNodes(configName)
+	if err != nil {
+		return err
+	}
+	settings.mu.Lock()
+	state, configType, fullPath, fileSource := settings.state, settings.configType, settings.configFullPath, settings.source()
+	settings.mu.Unlock()
+
+	// The source tells which values are defaults; it is unknown if the source cannot be read.
+	source, sourceErr := settings.convertToMap(fullPath)
+	if defaults, ok := source["DEFAULT"].(map[string]interface{}); sourceErr == nil && ok && formatTag(configType) == "ini" {
+		// Keys of the INI default section map onto the top-level fields.
+		for key, value := range defaults {
+			source[key] = value
+		}
+	}
+	redactor, _ := settings.fsys.(configRedactor)
+	origins, _ := settings.fsys.(configProvenance)
+	paths := make([][]string, len(nodes))
+	for i, node := range nodes {
+		paths[i] = node.path
+	}
+	notes, err := reader.EntryAnnotations(fileSource, fullPath, configType, paths)
+	if err != nil {
+		notes = make([]string, len(nodes))
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%v (%v, %v)\n", configName, configType, state)
+	var defaultPath, envPath []string
+	for i, node := range nodes {
+		var markers []string
+		// Values below a default or overridden container come with it; only the container is marked.
+		below := defaultPath != nil && len(node.path) > len(defaultPath) && reflect.DeepEqual(node.path[:len(defaultPath)], defaultPath)
+		belowEnv := envPath != nil && len(node.path) > len(envPath) && reflect.DeepEqual(node.path[:len(envPath)], envPath)
+		override := ""
+		if !belowEnv {
+			envPath = nil
+			if override = settings.envOrigin(node.path); override != "" {
+				envPath = node.path
+			}
+		}
+		if !below {
+			defaultPath = nil
+			if sourceErr == nil && override == "" && !belowEnv && !hasSourceValue(source, node.path) {
+				markers = append(markers, "default")
+				defaultPath = node.path
+			}
+		}
+		value := node.value
+		if node.leaf && redactor != nil && redactor.isSecret(node.path) {
+			value = redactedValue
+			markers = append(markers, "secret")
+		}
+		if override != "" {
+			markers = append(markers, "from "+override)
+		} else if node.leaf && origins != nil && defaultPath == nil {
+			if origin := origins.provenance(node.path); origin != "" {
+				markers = append(markers, "from "+origin)
+			}
+		}
+		if notes[i] != "" {
+			markers = append(markers, notes[i])
+		}
+
+		b.WriteString(strings.Repeat("  ", len(node.path)))
+		if key := node.path[len(node.path)-1]; node.element {
+			b.WriteString("[" + key + "]")
+		} else {
+			b.WriteString(key)
+		}
+		if node.leaf {
+			b.WriteString(": " + value)
+		}
+		fmt.Fprintf(&b, " (%v)", node.valueType)
+		for _, marker := range markers {
+			fmt.Fprintf(&b, " [%v]", marker)
+		}
+		b.WriteString("\n")
+	}
+	_, err = io.WriteString(w, b.String())
+	return err
+}
+
+// configNodes returns the nodes of the tree of a configuration and its settings.
+func (cm *ConfigManager) configNodes(configName string) ([]treeNode, *ConfigSettings, error) {
+	configInterface, err := cm.GetConfig(configName)
+	if err != nil {
+		return nil, nil, err
+	}
+	settings, ok := cm.configList.getSettings(configName)
+	if !ok {
+		return nil, nil, fmt.Errorf("config with name %s not found", configName)
+	}
+
+	// Hold the lock so the configuration is not reloaded while it is walked.
+	settings.mu.Lock()
+	defer settings.mu.Unlock()
+	var nodes []treeNode
+	collectTree(reflect.ValueOf(configInterface), nil, formatTag(settings.configType), &nodes)
+	return nodes, settings, nil
+}
+
+// collectTree appends the nodes of value and of the values it holds, in field order (sorted keys for maps).
+// Struct fields are named by their format tag, another format tag or their field name, in this order.
+func collectTree(value reflect.Value, path []string, tag string, nodes *[]treeNode) {
+	valueType := "interface {}"
+	if value.IsValid() {
+		valueType = value.Type().String()
+	}
+	for value.IsValid() && (value.Kind() == reflect.Interface || value.Kind() == reflect.Ptr) {
+		if value.IsNil() {
+			value = reflect.Value{}
+			break
+		}
+		if value.Kind() == reflect.Interface {
+			valueType = value.Elem().Type().String()
+		}
+		value = value.Elem()
+	}
+
+	node := treeNode{path: path, valueType: valueType}
+	var children func()
+	switch {
+	case !value.IsValid():
+		node.value, node.leaf = "null", true
+	case value.Kind() == reflect.Struct && value.Type() != reflect.TypeOf(time.Time{}):
+		children = func() {
+			for _, field := range treeFields(value, tag) {
+				collectTree(field.value, appendPath(path, field.key), tag, nodes)
+			}
+		}
+	case value.Kind() == reflect.Map:
+		if value.Len() == 0 {
+			node.value, node.leaf = "{}", true
+			break
+		}
+		children = func() {
+			keys := value.MapKeys()
+			sort.Slice(keys, func(i, j int) bool { return fmt.Sprint(keys[i]) < fmt.Sprint(keys[j]) })
+			for _, key := range keys {
+				collectTree(value.MapIndex(key), appendPath(path, fmt.Sprint(key)), tag, nodes)
+			}
+		}
+	case (value.Kind() == reflect.Slice || value.Kind() == reflect.Array) && value.Type().Elem().Kind() != reflect.Uint8:
+		if value.Len() == 0 {
+			node.value, node.leaf = "[]", true
+			break
+		}
+		children = func() {
+			for i := 0; i < value.Len(); i++ {
+				// The element's own node is appended first.
+				first := len(*nodes)
+				collectTree(value.Index(i), appendPath(path, strconv.Itoa(i)), tag, nodes)
+				(*nodes)[first].element = true
+			}
+		}
+	case value.Kind() == reflect.String:
+		node.value, node.leaf = strconv.Quote(value.String()), true
+	case value.CanInterface():
+		node.value, node.leaf = fmt.Sprint(value.Interface()), true
+	default:
+		// Values of unexported embedded structs cannot be used as interfaces.
+		node.value, node.leaf = scalarText(value), true
+	}
+
+	if path != nil {
+		*nodes = append(*nodes, node)
+	}
+	if children != nil {
+		children()
+	}
+}
+
+// treeField is a named field of a struct value.
+type treeField struct {
+	key   string            // Key of the field
+	value reflect.Value     // Value of the field
+	tag   reflect.StructTag // Tag of the field
+}
+
+// treeFields returns the exported fields of a struct value. Fields of embedded structs are flattened.
+func treeFields(value reflect.Value, tag string) []treeField {
+	var fields []treeField
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		name := ""
+		if tag != "" {
+			name = strings.Split(field.Tag.Get(tag), ",")[0]
+		}
+		if name == "-" {
+			continue
+		}
+		embedded := value.Field(i)
+		if embedded.Kind() == reflect.Ptr && !embedded.IsNil() {
+			embedded = embedded.Elem()
+		}
+		if field.Anonymous && name == "" && embedded.Kind() == reflect.Struct {
+			fields = append(fields, treeFields(embedded, tag)...)
+			continue
+		}
+		if field.PkgPath != "" {
+			continue
+		}
+		for _, other := range []string{"json", "yaml", "toml", "ini", "xml"} {
+			if name == "" {
+				name = strings.Split(field.Tag.Get(other), ",")[0]
+			}
+		}
+		if name == "" || name == "-" {
+			name = field.Name
+		}
+		fields = append(fields, treeField{key: name, value: value.Field(i), tag: field.Tag})
+	}
+	return fields
+}
+
+// appendPath returns a new path with key appended.
+func appendPath(path []string, key string) []string {
+	return append(append(make([]string, 0, len(path)+1), path...), key)
+}
+
+// formatTag returns the struct tag key of the config type's format, e.g. "yaml" for ".mk.yaml.gz".
+func formatTag(configType string) string {
+	name := strings.TrimSuffix(strings.ToLower(configType), reader.CompressionExt(configType))
+	name = strings.TrimPrefix(strings.TrimPrefix(name, ".mk"), ".")
+	switch name {
+	case "yml":
+		return "yaml"
+	case "json", "yaml", "toml", "ini", "xml", "plist":
+		return name
+	}
+	return ""
+}
+
+// hasSourceValue reports whether the source map holds a value at path. Keys match case-insensitively, as when
+// decoding into field names, and may contain dots, as in INI sections such as [server.tls].
+func hasSourceValue(value interface{}, path []string) bool {
+	if len(path) == 0 {
+		return true
+	}
+	if items, ok := value.([]interface{}); ok {
+		index, err := strconv.Atoi(path[0])
+		return err == nil && index >= 0 && index < len(items) && hasSourceValue(items[index], path[1:])
+	}
+	values := toStringMap(value)
+	for n := 1; n <= len(path); n++ {
+		key := strings.Join(path[:n], ".")
+		for name, item := range values {
+			if strings.EqualFold(name, key) && hasSourceValue(item, path[n:]) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// scalarText formats a scalar value that cannot be used as an interface.
+func scalarText(value reflect.Value) string {
+	switch value.Kind() {
+	case reflect.Bool:
+		return strconv.FormatBool(value.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(value.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(value.Uint(), 10)
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(value.Float(), 'g', -1, 64)
+	}
+	return "?"
+}
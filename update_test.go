@@ -0,0 +1,45 @@
+package mkconf
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	reader "mkconf/readers"
+)
+
+type rewrittenConfig struct {
+	Base []int `yaml:"base"`
+	Copy int   `yaml:"copy"`
+}
+
+func TestUpdateConfigReportsRewrittenFile(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "app.yaml"), []byte("# shared\nbase: &base [1]\ncopy: 1\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var reported []error
+	cm := NewConfigManager()
+	cm.SetErrorFunc(func(err error) { reported = append(reported, err) })
+	config := &rewrittenConfig{}
+	if err := cm.AddConfig("app", dir, ".yaml", config); err != nil {
+		t.Fatalf("AddConfig: %v", err)
+	}
+	if err := cm.LoadConfig("app"); err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	// UpdateConfig restarts the monitoring, which must stop before the directory is removed; removing the
+	// configuration also drops the notification of the update nobody watches.
+	t.Cleanup(func() { cm.RemoveConfig("app") })
+
+	if err := cm.UpdateConfig("app", &rewrittenConfig{Base: []int{2}, Copy: 1}); err != nil {
+		t.Fatalf("UpdateConfig of a file rewritten in full = %v, want nil", err)
+	}
+	if len(reported) != 1 || !errors.Is(reported[0], reader.ErrRewritten) {
+		t.Fatalf("reported %v, want an error wrapping %v", reported, reader.ErrRewritten)
+	}
+	if len(config.Base) != 1 || config.Base[0] != 2 {
+		t.Fatalf("config %+v, want the updated values", config)
+	}
+}
@@ -0,0 +1,310 @@
+package mkconf
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// VaultOptions configures a HashiCorp Vault config source.
+type VaultOptions struct {
+	Address         string        // Vault address; VAULT_ADDR if empty
+	Token           string        // Vault token; VAULT_TOKEN if empty
+	Namespace       string        // Optional Vault Enterprise namespace
+	RefreshInterval time.Duration // Interval KV secrets without a lease are re-read at; one minute if zero
+	HTTPClient      *http.Client  // Client used for requests; http.DefaultClient if nil
+	Source          SourceOptions // TLS, proxy and token provider settings; a provided token is sent as the Vault token
+}
+
+// VaultConfigSource is a configuration read from a Vault secret, either a KV v2 entry (e.g. "secret/data/app")
+// or a dynamic secret (e.g. "database/creds/app"). The secret data is exposed to the manager as a JSON document
+// and decoded into the configuration struct with its json tags.
+// While the source is watched, leases are renewed before they expire; when a lease can no longer be renewed
+// or a KV entry changes, the secret is re-read and the new values trigger the normal change callbacks.
+type VaultConfigSource struct {
+	path       string             // API path of the secret without the "/v1/" prefix
+	configName string             // Name of the registered configuration
+	options    VaultOptions       // Source options
+	manager    *ConfigManager     // Manager the configuration is registered with
+	content    []byte             // JSON document of the last read secret data
+	loaded     bool               // Flag indicating content holds a value
+	lease      vaultLease         // Lease of the last read secret
+	mu         sync.Mutex         // Mutex for synchronizing access to the content and lease
+	cancel     context.CancelFunc // Function canceling the running watch
+	waitGroup  sync.WaitGroup     // WaitGroup to wait for the watch goroutine
+}
+
+// vaultLease is the lease of a secret as returned by Vault.
+type vaultLease struct {
+	ID        string        // Lease ID; empty for secrets without a lease
+	Duration  time.Duration // Remaining lease duration when it was issued or last renewed
+	Renewable bool          // Flag indicating the lease can be renewed
+	Initial   time.Duration // Duration of the lease when the secret was read
+	Obtained  time.Time     // Time the lease was issued or last renewed
+}
+
+// vaultResponse is a secret or lease response of the Vault API.
+type vaultResponse struct {
+	LeaseID       string                 `json:"lease_id"`
+	LeaseDuration int                    `json:"lease_duration"`
+	Renewable     bool                   `json:"renewable"`
+	Data          map[string]interface{} `json:"data"`
+}
+
+// AddVaultConfig registers a configuration read from the Vault secret at path (e.g. "secret/data/app").
+// KV v2 entries are unwrapped, so the struct receives the secret's keys. The configuration is read-only.
+// Call StartWatching on the returned source to renew leases and pick up rotated secrets.
+func (cm *ConfigManager) AddVaultConfig(configName, path string, configInterface interface{}, options VaultOptions) (*VaultConfigSource, error) {
+	if options.Address == "" {
+		options.Address = os.Getenv("VAULT_ADDR")
+	}
+	if options.Token == "" {
+		options.Token = os.Getenv("VAULT_TOKEN")
+	}
+	if options.Address == "" {
+		return nil, fmt.Errorf("vault config %v: no address", configName)
+	}
+	if options.RefreshInterval <= 0 {
+		options.RefreshInterval = time.Minute
+	}
+	client, err := options.Source.httpClient(options.HTTPClient)
+	if err != nil {
+		return nil, fmt.Errorf("vault config %v: %v", configName, err)
+	}
+	options.HTTPClient = client
+
+	s := &VaultConfigSource{
+		path:       strings.TrimPrefix(strings.TrimPrefix(path, "/"), "v1/"),
+		configName: configName,
+		options:    options,
+		manager:    cm,
+	}
+	if err := cm.AddConfigFS(s, configName, "", ".json", configInterface); err != nil {
+		return nil, err
+	}
+	cm.addRemoteSource(configName, s)
+	return s, nil
+}
+
+// Open implements fs.FS. Every name resolves to the secret data; it is read if it was not read yet.
+func (s *VaultConfigSource) Open(name string) (fs.File, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.loaded {
+		if err := s.readLocked(context.Background()); err != nil {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+		}
+	}
+	return newRemoteFile(name, s.content), nil
+}
+
+// Refresh re-reads the secret and loads the configuration from it.
+// It is not needed while the source is watched.
+func (s *VaultConfigSource) Refresh() error {
+	s.mu.Lock()
+	err := s.readLocked(context.Background())
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return s.manager.LoadConfig(s.configName)
+}
+
+// StartWatching renews the lease of the secret before it expires and re-reads the secret when the lease
+// cannot be renewed any more or, for secrets without a lease, every refresh interval. Changed secret data is
+// applied through the change machinery. Errors are reported through errorFunc if it is set.
+func (s *VaultConfigSource) StartWatching(errorFunc func(err error)) error {
+	s.StopWatching()
+	errorFunc = quietCircuitErrors(errorFunc)
+	if err := s.manager.setRemoteWatching(s.configName, true); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.mu.Lock()
+	s.cancel = cancel
+	s.mu.Unlock()
+
+	s.waitGroup.Add(1)
+	s.manager.configList.resources.acquire(s.configName, resourceRemoteWatch)
+	go func() {
+		defer s.waitGroup.Done()
+		defer s.manager.configList.resources.release(s.configName, resourceRemoteWatch)
+		for {
+			timer := time.NewTimer(s.nextCheck())
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+
+			if err := s.check(ctx); err != nil && ctx.Err() == nil {
+				if errorFunc != nil {
+					errorFunc(fmt.Errorf("vault %v: %w", s.path, err))
+				}
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(5 * time.Second):
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+// StopWatching stops renewing and re-reading the secret and waits for the watch to finish.
+func (s *VaultConfigSource) StopWatching() {
+	s.mu.Lock()
+	cancel := s.cancel
+	s.cancel = nil
+	s.mu.Unlock()
+
+	if cancel == nil {
+		return
+	}
+	cancel()
+	s.waitGroup.Wait()
+	s.manager.setRemoteWatching(s.configName, false)
+}
+
+// nextCheck returns how long to wait before the lease is renewed or the secret is re-read.
+func (s *VaultConfigSource) nextCheck() time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.lease.Duration <= 0 {
+		return s.options.RefreshInterval
+	}
+	// Act after two thirds of the lease, leaving time to retry before it expires.
+	wait := time.Until(s.lease.Obtained.Add(s.lease.Duration * 2 / 3))
+	if wait < time.Second {
+		wait = time.Second
+	}
+	return wait
+}
+
+// check renews the lease if possible and re-reads the secret otherwise, applying changed data.
+func (s *VaultConfigSource) check(ctx context.Context) error {
+	s.mu.Lock()
+	lease := s.lease
+	s.mu.Unlock()
+
+	if lease.ID != "" && lease.Renewable {
+		renewed, err := s.renew(ctx, lease)
+		if err == nil && renewed.Duration > lease.Initial/3 {
+			s.mu.Lock()
+			s.lease = renewed
+			s.mu.Unlock()
+			s.manager.sourceReached(s.configName)
+			return nil
+		}
+		// The lease is close to its maximum TTL or was revoked; fetch a new secret.
+	}
+
+	s.mu.Lock()
+	previous := s.content
+	err := s.readLocked(ctx)
+	changed := err == nil && !bytes.Equal(previous, s.content)
+	s.mu.Unlock()
+	if err != nil || !changed {
+		return err
+	}
+	return s.manager.applyRemoteChange(s.configName)
+}
+
+// renew extends the lease and returns the renewed lease.
+func (s *VaultConfigSource) renew(ctx context.Context, lease vaultLease) (vaultLease, error) {
+	body := map[string]interface{}{"lease_id": lease.ID, "increment": int(lease.Initial.Seconds())}
+	var response vaultResponse
+	if err := s.call(ctx, http.MethodPut, "sys/leases/renew", body, &response); err != nil {
+		return lease, err
+	}
+	lease.Duration = time.Duration(response.LeaseDuration) * time.Second
+	lease.Renewable = response.Renewable
+	lease.Obtained = time.Now()
+	return lease, nil
+}
+
+// readLocked calls readOnceLocked according to the retry policy and circuit breaker of the configuration.
+// The caller must hold s.mu.
+func (s *VaultConfigSource) readLocked(ctx context.Context) error {
+	return s.manager.retryFetch(ctx, s.configName, func() error { return s.readOnceLocked(ctx) })
+}
+
+// readOnceLocked reads the secret, unwrapping KV v2 entries. The caller must hold s.mu.
+func (s *VaultConfigSource) readOnceLocked(ctx context.Context) error {
+	var response vaultResponse
+	if err := s.call(ctx, http.MethodGet, s.path, nil, &response); err != nil {
+		return err
+	}
+
+	data := response.Data
+	if inner, ok := data["data"].(map[string]interface{}); ok {
+		if _, ok := data["metadata"].(map[string]interface{}); ok {
+			data = inner
+		}
+	}
+	if data == nil {
+		return fmt.Errorf("vault %v: secret has no data", s.path)
+	}
+	content, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("vault %v: %v", s.path, err)
+	}
+
+	duration := time.Duration(response.LeaseDuration) * time.Second
+	s.content, s.loaded = content, true
+	s.lease = vaultLease{ID: response.LeaseID, Duration: duration, Renewable: response.Renewable, Initial: duration, Obtained: time.Now()}
+	s.manager.sourceReached(s.configName)
+	return nil
+}
+
+// call sends a request to the Vault API and decodes the response into out.
+func (s *VaultConfigSource) call(ctx context.Context, method, path string, request, out interface{}) error {
+	var body io.Reader
+	if request != nil {
+		content, err := json.Marshal(request)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(content)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(s.options.Address, "/")+"/v1/"+path, body)
+	if err != nil {
+		return err
+	}
+	token, err := s.options.Source.token(ctx, s.options.Token)
+	if err != nil {
+		return err
+	}
+	if token != "" {
+		req.Header.Set("X-Vault-Token", token)
+	}
+	if s.options.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", s.options.Namespace)
+	}
+	resp, err := s.options.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		message, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%v %v: unexpected status %v: %s", method, path, resp.Status, bytes.TrimSpace(message))
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
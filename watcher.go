@@ -0,0 +1,121 @@
+package mkconf
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// Watcher is a running dispatch of the changes of configurations to their callbacks, started with Watch.
+type Watcher struct {
+	stop     chan struct{} // Channel closed to stop the dispatch goroutines
+	stopOnce sync.Once     // Guard closing stop once
+	done     chan struct{} // Channel closed once all dispatch goroutines finished
+}
+
+// Stop stops the watcher and waits for its goroutines to finish, i.e. for running callbacks to return, or for ctx
+// to be done, returning its error. Changes detected while no watcher runs wait for the next one to be delivered.
+func (w *Watcher) Stop(ctx context.Context) error {
+	w.stopOnce.Do(func() { close(w.stop) })
+	select {
+	case <-w.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Done returns a channel closed once the watcher stopped, either by Stop or because all watched configurations
+// were removed.
+func (w *Watcher) Done() <-chan struct{} {
+	return w.done
+}
+
+// Watch starts watching for changes in configurations and returns without blocking.
+// It iterates through all configurations and launches goroutines to handle change validation and tracking, which
+// run until the watcher is stopped or their configuration is removed.
+// ChangeEvents are dispatched to the ChangeEventFunc callback and the Subscribe listeners, including those added
+// later; configurations with such listeners need no change callback.
+// A panic of a callback is recovered and reported through the function set with SetErrorFunc; the dispatch goes on.
+// Returns an error if change or track callback functions are not set for any configuration; no goroutine is left
+// running then.
+func (cm *ConfigManager) Watch() (*Watcher, error) {
+	var wg sync.WaitGroup
+	watcher := &Watcher{stop: make(chan struct{}), done: make(chan struct{})}
+	fail := func(err error) (*Watcher, error) {
+		close(watcher.stop)
+		wg.Wait()
+		return nil, err
+	}
+
+	// Iterate through all configurations
+	for _, configName := range cm.configList.GetConfigNames() {
+		// Get settings for the current configuration
+		settings := cm.configList.GetSettings(configName)
+
+		// Handle change validation
+		if settings.changeValidationEnabled() {
+			var changeCallback ChangeCallbackFunc
+			// Check if change callback function is set for the configuration
+			cm.mu.RLock()
+			if cb, ok := cm.changeCallbacks[configName]; ok {
+				changeCallback = cb
+			}
+			cm.mu.RUnlock()
+
+			// Names of changes are drained without a change callback if events have listeners
+			if changeCallback == nil && len(cm.eventListeners(configName)) > 0 {
+				changeCallback = func(string) {}
+			}
+
+			// Launch goroutines to handle change validation and to dispatch change events
+			if changeCallback != nil {
+				wg.Add(2)
+				go func(cb ChangeCallbackFunc) {
+					defer wg.Done()
+					cm.configList.dispatch(settings, settings.Ch_ConfigChanged, func(name string) {
+						cm.runCallback(settings, CallbackCall{ConfigName: name, Kind: CallbackKindChange}, func() { cb(name) })
+					}, watcher.stop)
+				}(changeCallback)
+				go func() {
+					defer wg.Done()
+					cm.configList.dispatchEvents(settings, cm.publishEvent, watcher.stop)
+				}()
+			} else {
+				// Return error if change callback function is not set
+				return fail(fmt.Errorf("change callback function not set for config '%s'", configName))
+			}
+		}
+
+		// Handle change tracking
+		if settings.changeTrackingEnabled() {
+			var trackCallback TrackCallbackFunc
+			// Check if track callback function is set for the configuration
+			cm.mu.RLock()
+			if cb, ok := cm.trackCallback[configName]; ok {
+				trackCallback = cb
+			}
+			cm.mu.RUnlock()
+
+			// Launch goroutine to handle change tracking
+			if trackCallback != nil {
+				wg.Add(1)
+				go func(cb TrackCallbackFunc) {
+					defer wg.Done()
+					cm.configList.dispatch(settings, settings.Ch_ConfigTracking, func(name string) {
+						cm.callCallback(CallbackCall{ConfigName: name, Kind: CallbackKindTracking}, func() { cb(name) })
+					}, watcher.stop)
+				}(trackCallback)
+			} else {
+				// Return error if track callback function is not set
+				return fail(fmt.Errorf("track callback function not set for config '%s'", configName))
+			}
+		}
+	}
+
+	go func() {
+		wg.Wait()
+		close(watcher.done)
+	}()
+	return watcher, nil
+}
@@ -0,0 +1,221 @@
+package mkconf
+
+import (
+	"container/heap"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// watcherPool checks monitored configurations on a fixed number of worker goroutines instead of one
+// goroutine per configuration. A scheduler hands due configurations to whichever worker is free.
+type watcherPool struct {
+	list     *ConfigList        // ConfigList whose configurations are checked
+	schedule watchSchedule      // Monitored configurations ordered by their next check
+	mu       sync.Mutex         // Mutex for synchronizing access to the schedule
+	wake     chan struct{}      // Channel signaling the scheduler that the schedule changed
+	work     chan *watchEntry   // Channel handing due configurations to the workers
+	cancel   context.CancelFunc // Function stopping the scheduler and the workers
+	stopped  sync.WaitGroup     // WaitGroup to wait for the scheduler and the workers
+}
+
+// watchEntry is a configuration monitored by a watcherPool.
+type watchEntry struct {
+	configName string          // Name of the configuration
+	v          interface{}     // Configuration interface changes are applied to
+	interval   time.Duration   // Interval between checks
+	next       time.Time       // Time of the next check
+	ctx        context.Context // Context canceled when the monitoring is stopped
+	done       chan struct{}   // Channel closed when the entry left the pool
+	index      int             // Index in the schedule; -1 while a worker checks the entry
+}
+
+// watchSchedule is a min-heap of watch entries ordered by their next check.
+type watchSchedule []*watchEntry
+
+func (s watchSchedule) Len() int           { return len(s) }
+func (s watchSchedule) Less(i, j int) bool { return s[i].next.Before(s[j].next) }
+func (s watchSchedule) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+	s[i].index, s[j].index = i, j
+}
+func (s *watchSchedule) Push(x interface{}) {
+	entry := x.(*watchEntry)
+	entry.index = len(*s)
+	*s = append(*s, entry)
+}
+func (s *watchSchedule) Pop() interface{} {
+	old := *s
+	entry := old[len(old)-1]
+	old[len(old)-1] = nil
+	entry.index = -1
+	*s = old[:len(old)-1]
+	return entry
+}
+
+// SetWatcherPool bounds the number of goroutines checking monitored configurations to workers, regardless of
+// the number of configurations, which suits agents watching thousands of small fragments. Zero restores one
+// goroutine per configuration. It must be called while no configuration is monitored.
+func (cm *ConfigManager) SetWatcherPool(workers int) error {
+	c := cm.configList
+	c.settingsMutex.Lock()
+	defer c.settingsMutex.Unlock()
+
+	for name, settings := range c.settings {
+		settings.mu.Lock()
+		running := settings.monitorState != MonitorIdle
+		settings.mu.Unlock()
+		if running {
+			return fmt.Errorf("watcher pool: config %s is monitored", name)
+		}
+	}
+
+	if c.pool != nil {
+		c.pool.stop()
+		c.pool = nil
+	}
+	if workers > 0 {
+		c.pool = newWatcherPool(c, workers)
+	}
+	return nil
+}
+
+// newWatcherPool starts a pool with the given number of workers.
+func newWatcherPool(list *ConfigList, workers int) *watcherPool {
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &watcherPool{
+		list:   list,
+		wake:   make(chan struct{}, 1),
+		work:   make(chan *watchEntry),
+		cancel: cancel,
+	}
+
+	p.stopped.Add(workers + 1)
+	go p.run(ctx)
+	for i := 0; i < workers; i++ {
+		go p.worker(ctx)
+	}
+	return p
+}
+
+// add schedules the first check of a configuration after delay and returns a function removing it again.
+func (p *watcherPool) add(entry *watchEntry, delay time.Duration) func() {
+	p.mu.Lock()
+	entry.next = time.Now().Add(delay)
+	heap.Push(&p.schedule, entry)
+	p.mu.Unlock()
+	p.signal()
+
+	return func() {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		// An entry being checked is released by its worker once the check finished.
+		if entry.index >= 0 {
+			heap.Remove(&p.schedule, entry.index)
+			close(entry.done)
+		}
+	}
+}
+
+// signal wakes the scheduler up.
+func (p *watcherPool) signal() {
+	select {
+	case p.wake <- struct{}{}:
+	default:
+	}
+}
+
+// run hands every configuration to a worker when its check is due.
+func (p *watcherPool) run(ctx context.Context) {
+	defer p.stopped.Done()
+	for {
+		p.mu.Lock()
+		var wait <-chan time.Time
+		var timer *time.Timer
+		var due *watchEntry
+		if len(p.schedule) > 0 {
+			if delay := time.Until(p.schedule[0].next); delay <= 0 {
+				due = heap.Pop(&p.schedule).(*watchEntry)
+			} else {
+				timer = time.NewTimer(delay)
+				wait = timer.C
+			}
+		}
+		p.mu.Unlock()
+
+		if due != nil {
+			select {
+			case p.work <- due:
+			case <-ctx.Done():
+				return
+			}
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			if timer != nil {
+				timer.Stop()
+			}
+			return
+		case <-p.wake:
+		case <-wait:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+}
+
+// worker checks due configurations and reschedules them until the pool is stopped.
+func (p *watcherPool) worker(ctx context.Context) {
+	defer p.stopped.Done()
+	for {
+		var entry *watchEntry
+		select {
+		case <-ctx.Done():
+			return
+		case entry = <-p.work:
+		}
+
+		next := entry.interval
+		if entry.ctx.Err() == nil {
+			if err := p.list.checkConfigChanges(entry.configName, entry.v); err != nil {
+				// A configuration removed meanwhile is dropped once RemoveConfig cancels its entry.
+				if _, ok := p.list.getSettings(entry.configName); ok {
+					p.list.reportError(fmt.Errorf("monitoring: error checking config changes %v: %w", entry.configName, err))
+				}
+				next = time.Second * 10
+			} else if settings, ok := p.list.getSettings(entry.configName); ok {
+				next = p.list.jitter(settings.pollInterval(next))
+				if debounce := settings.debounceWait(); debounce > 0 && debounce < next {
+					next = debounce
+				}
+			}
+		}
+
+		p.mu.Lock()
+		if entry.ctx.Err() != nil {
+			close(entry.done)
+		} else {
+			entry.next = time.Now().Add(next)
+			heap.Push(&p.schedule, entry)
+		}
+		p.mu.Unlock()
+		p.signal()
+	}
+}
+
+// stop stops the scheduler and the workers and waits for them. The pool must not monitor any configuration.
+func (p *watcherPool) stop() {
+	p.cancel()
+	p.stopped.Wait()
+}
+
+// watcherPool returns the pool monitored configurations are checked on, or nil for one goroutine per configuration.
+func (c *ConfigList) watcherPool() *watcherPool {
+	c.settingsMutex.Lock()
+	defer c.settingsMutex.Unlock()
+	return c.pool
+}